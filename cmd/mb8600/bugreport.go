@@ -0,0 +1,294 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+// The longest excerpt of a response included in a bug report.
+const maxPayloadExcerpt = 2048
+
+// A report of a failing command to attach to a GitHub issue. Secrets are
+// redacted and identifiers replaced with pseudonyms.
+type bugReport struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+	Firmware  string `json:"firmware,omitempty"`
+	Hardware  string `json:"hardware,omitempty"`
+	Command   string `json:"command"`
+	// The action of the request that failed, or of the last request sent if
+	// the command failed otherwise, e.g. parsing a response.
+	FailingAction string `json:"failing_action,omitempty"`
+	// The error the command failed with and the errors it wraps, outermost
+	// first. Empty if the command succeeded.
+	Errors   []string           `json:"errors,omitempty"`
+	Requests []bugReportRequest `json:"requests"`
+	// The redacted response to the failing action, truncated.
+	Payload string `json:"payload,omitempty"`
+}
+
+type bugReportRequest struct {
+	Action     string        `json:"action"`
+	StatusCode int           `json:"status_code"`
+	Duration   time.Duration `json:"duration"`
+	Err        string        `json:"error,omitempty"`
+}
+
+// Records the requests of a client and the redacted responses it logs at
+// debug level.
+type bugReportRecorder struct {
+	mu        sync.Mutex
+	requests  []mb8600.RequestInfo
+	responses []bugReportPayload
+}
+
+type bugReportPayload struct {
+	action, data string
+}
+
+func (r *bugReportRecorder) Log(keyvals ...any) error {
+	var msg, action string
+	var data any
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		switch keyvals[i] {
+		case "msg":
+			msg = fmt.Sprint(keyvals[i+1])
+		case "action":
+			action = fmt.Sprint(keyvals[i+1])
+		case "data":
+			data = keyvals[i+1]
+		}
+	}
+	if msg != "received response" || data == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.responses = append(r.responses, bugReportPayload{action: action, data: fmt.Sprint(data)})
+	return nil
+}
+
+func (r *bugReportRecorder) hooks() mb8600.RequestHooks {
+	return mb8600.RequestHooks{OnRequestDone: func(info mb8600.RequestInfo) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.requests = append(r.requests, info)
+	}}
+}
+
+// Returns the action of the last failed request, or of the last request if
+// none failed.
+func (r *bugReportRecorder) failingAction() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := len(r.requests) - 1; i >= 0; i-- {
+		if r.requests[i].Err != nil {
+			return r.requests[i].Action
+		}
+	}
+	if len(r.requests) == 0 {
+		return ""
+	}
+	return r.requests[len(r.requests)-1].Action
+}
+
+// Returns the last response logged for action, or the last response if
+// there is none for it.
+func (r *bugReportRecorder) payload(action string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := len(r.responses) - 1; i >= 0; i-- {
+		if r.responses[i].action == action {
+			return r.responses[i].data
+		}
+	}
+	if len(r.responses) == 0 {
+		return ""
+	}
+	return r.responses[len(r.responses)-1].data
+}
+
+// Returns the messages of err and of the errors it wraps, outermost first.
+func errorChain(err error) []string {
+	var chain []string
+	for err != nil {
+		chain = append(chain, err.Error())
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, inner := range joined.Unwrap() {
+				chain = append(chain, errorChain(inner)...)
+			}
+			break
+		}
+		err = errors.Unwrap(err)
+	}
+	return chain
+}
+
+// Returns the module version the CLI was built from, "(devel)" for a local
+// build.
+func buildVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+// Replaces the secrets and identifiers in a bug report.
+type bugReportSanitizer struct {
+	anon *mb8600.Anonymizer
+	// Literal values replaced wherever they appear, e.g. the password.
+	replacer *strings.Replacer
+}
+
+// Returns a sanitizer replacing identifiers with pseudonyms under key, or
+// under a random key if it is empty, and removing the credentials of p.
+func newBugReportSanitizer(key string, p *profile, software *mb8600.SoftwareStatus) *bugReportSanitizer {
+	if key == "" {
+		random := make([]byte, 16)
+		rand.Read(random)
+		key = hex.EncodeToString(random)
+	}
+	anon := mb8600.NewAnonymizer(key)
+
+	var pairs []string
+	if p.Password != "" {
+		pairs = append(pairs, p.Password, "[REDACTED]")
+	}
+	if p.Username != "" {
+		pairs = append(pairs, p.Username, anon.Username(p.Username))
+	}
+	if software != nil && software.SerialNumber != "" {
+		pairs = append(pairs, software.SerialNumber, anon.Serial(software.SerialNumber))
+	}
+	return &bugReportSanitizer{anon: anon, replacer: strings.NewReplacer(pairs...)}
+}
+
+func (s *bugReportSanitizer) text(text string) string {
+	return s.anon.Text(s.replacer.Replace(text))
+}
+
+// Runs the command named name with a fresh login, so a failing login is
+// captured too, and writes a bug report of the run to w as Markdown, or as
+// JSON if output is json. The report is written whether or not the command
+// failed.
+func runBugReport(p *profile, name string, timeout time.Duration, anonymizeKey, output string, w io.Writer) error {
+	cmd, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("unknown command: %s", name)
+	}
+
+	opts, err := p.clientOptions(timeout)
+	if err != nil {
+		return err
+	}
+	recorder := &bugReportRecorder{}
+	client := mb8600.NewMotoClient(p.Address, p.Username, p.Password, recorder,
+		append(opts, mb8600.WithRequestHooks(recorder.hooks()))...)
+	defer client.CloseIdleConnections()
+
+	report := &bugReport{
+		Version:   buildVersion(),
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		Command:   name,
+	}
+
+	var software *mb8600.SoftwareStatus
+	_, err = client.Login()
+	if err == nil {
+		// The firmware is best effort; a failure shows in the requests.
+		software, _ = client.GetSoftwareStatus()
+		err = cmd.run(client, "json", nil, io.Discard)
+	}
+	if software != nil {
+		report.Firmware = software.SoftwareVersion
+		report.Hardware = software.HardwareVersion
+	}
+
+	sanitizer := newBugReportSanitizer(anonymizeKey, p, software)
+	for _, message := range errorChain(err) {
+		report.Errors = append(report.Errors, sanitizer.text(message))
+	}
+	report.FailingAction = recorder.failingAction()
+	if payload := recorder.payload(report.FailingAction); payload != "" {
+		if len(payload) > maxPayloadExcerpt {
+			payload = payload[:maxPayloadExcerpt] + "..."
+		}
+		report.Payload = sanitizer.text(payload)
+	}
+	for _, info := range recorder.requests {
+		request := bugReportRequest{Action: info.Action, StatusCode: info.StatusCode, Duration: info.Duration}
+		if info.Err != nil {
+			request.Err = sanitizer.text(info.Err.Error())
+		}
+		report.Requests = append(report.Requests, request)
+	}
+
+	if output == "json" {
+		return writeJSON(w, report)
+	}
+	writeBugReport(w, report)
+	return nil
+}
+
+// Writes report as Markdown, ready to paste into a GitHub issue.
+func writeBugReport(w io.Writer, report *bugReport) {
+	fmt.Fprintf(w, "### Environment\n\n")
+	fmt.Fprintf(w, "- mb8600: %s (%s, %s)\n", report.Version, report.GoVersion, report.Platform)
+	if report.Firmware != "" {
+		fmt.Fprintf(w, "- Firmware: %s (hardware %s)\n", report.Firmware, report.Hardware)
+	} else {
+		fmt.Fprintf(w, "- Firmware: unknown\n")
+	}
+
+	fmt.Fprintf(w, "\n### What failed\n\n")
+	fmt.Fprintf(w, "- Command: `mb8600 %s`\n", report.Command)
+	if report.FailingAction != "" {
+		fmt.Fprintf(w, "- Failing action: `%s`\n", report.FailingAction)
+	}
+	if len(report.Errors) == 0 {
+		fmt.Fprintf(w, "\nThe command succeeded.\n")
+	} else {
+		fmt.Fprintf(w, "\n```text\n")
+		for i, message := range report.Errors {
+			fmt.Fprintf(w, "%s%s\n", strings.Repeat("  ", i), message)
+		}
+		fmt.Fprintf(w, "```\n")
+	}
+
+	fmt.Fprintf(w, "\n### Requests\n\n| Action | Status | Duration | Error |\n| --- | --- | --- | --- |\n")
+	for _, request := range report.Requests {
+		fmt.Fprintf(w, "| %s | %d | %s | %s |\n", request.Action, request.StatusCode,
+			request.Duration.Round(time.Millisecond), strings.ReplaceAll(request.Err, "|", `\|`))
+	}
+
+	if report.Payload != "" {
+		fmt.Fprintf(w, "\n### Response to %s\n\n```text\n%s\n```\n", report.FailingAction, report.Payload)
+	}
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/thelande/mb8600/pkg/mb8600test"
+)
+
+func TestRun_bugreport(t *testing.T) {
+	modem := mb8600test.NewModem("admin", "motorola")
+	server := mb8600test.NewServer(modem)
+	defer server.Close()
+	getenv := func(string) string { return "" }
+	address := mb8600test.Address(server)
+
+	tests := []struct {
+		name       string
+		password   string
+		command    []string
+		fail       string
+		wantAction string
+		wantErr    string
+	}{
+		{"failing action", "motorola", []string{"channels"}, "GetMotoStatusDownstreamChannelInfo", "GetMotoStatusDownstreamChannelInfo", "received non-OK status code: 500"},
+		{"failing login", "wrong", nil, "", "Login", "request not authorized by modem"},
+		{"success", "motorola", nil, "", "GetMotoStatusUpstreamChannelInfo", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.fail != "" {
+				modem.SetStatus(tt.fail, http.StatusInternalServerError)
+				defer modem.SetStatus(tt.fail, 0)
+			}
+			args := append([]string{"--session-dir", "", "--address", address, "--password", tt.password, "--output", "json", "bugreport"}, tt.command...)
+			var stdout bytes.Buffer
+			if err := run(args, getenv, &stdout, io.Discard); err != nil {
+				t.Fatalf("run(%v) error = %v", args, err)
+			}
+
+			var report bugReport
+			if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+				t.Fatalf("run() output = %s: %v", stdout.String(), err)
+			}
+			if report.FailingAction != tt.wantAction {
+				t.Errorf("FailingAction = %q, want %q", report.FailingAction, tt.wantAction)
+			}
+			if errs := strings.Join(report.Errors, "\n"); !strings.Contains(errs, tt.wantErr) || (tt.wantErr == "") != (errs == "") {
+				t.Errorf("Errors = %q, want %q", report.Errors, tt.wantErr)
+			}
+			if len(report.Requests) == 0 || report.Requests[0].Action != "Login" {
+				t.Errorf("Requests = %+v, want the login first", report.Requests)
+			}
+			for _, secret := range []string{"motorola", "00:11:22:33:44:55", "2018123456789"} {
+				if strings.Contains(stdout.String(), secret) {
+					t.Errorf("run() output contains %q:\n%s", secret, stdout.String())
+				}
+			}
+		})
+	}
+}
+
+func TestRun_bugreportMarkdown(t *testing.T) {
+	modem := mb8600test.NewModem("admin", "motorola")
+	server := mb8600test.NewServer(modem)
+	defer server.Close()
+	modem.SetResponse("GetMotoStatusDownstreamChannelInfo", map[string]string{
+		"MotoConnDownstreamChannel": "1^Locked^QAM256^x^531.0^ 2.8^45.1^0^0^",
+	})
+
+	var stdout bytes.Buffer
+	args := []string{"--session-dir", "", "--address", mb8600test.Address(server), "--password", "motorola", "bugreport", "channels"}
+	if err := run(args, func(string) string { return "" }, &stdout, io.Discard); err != nil {
+		t.Fatalf("run(%v) error = %v", args, err)
+	}
+	for _, want := range []string{
+		"- Firmware: 8600-19.3.18",
+		"- Command: `mb8600 channels`",
+		"- Failing action: `GetMotoStatusDownstreamChannelInfo`",
+		"| Login | 200 |",
+		"### Response to GetMotoStatusDownstreamChannelInfo",
+		"1^Locked^QAM256^x^531.0",
+	} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("run() output is missing %q:\n%s", want, stdout.String())
+		}
+	}
+}
+
+func TestErrorChain(t *testing.T) {
+	inner := fmt.Errorf("timeout")
+	err := fmt.Errorf("action, Login: %w", inner)
+	joined := fmt.Errorf("poll failed: %w", errors.Join(err, fmt.Errorf("other")))
+
+	tests := []struct {
+		name string
+		err  error
+		want []string
+	}{
+		{"nil", nil, nil},
+		{"wrapped", err, []string{"action, Login: timeout", "timeout"}},
+		{"joined", joined, []string{"poll failed: action, Login: timeout\nother", "action, Login: timeout\nother", "action, Login: timeout", "timeout", "other"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := errorChain(tt.err)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("errorChain() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
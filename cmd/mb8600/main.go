@@ -0,0 +1,415 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Command mb8600 queries a Motorola MB8600 cable modem.
+//
+// Usage:
+//
+//	mb8600 [flags] <command>
+//	mb8600 [flags] bugreport [command]
+//	mb8600 schema [name]
+//
+// Named profiles in the configuration file select the modem address,
+// credentials and output format, e.g. mb8600 --profile parents-house channels.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/thelande/mb8600/pkg/health"
+	"github.com/thelande/mb8600/pkg/i18n"
+	"github.com/thelande/mb8600/pkg/mb8600"
+	"github.com/thelande/mb8600/pkg/render"
+	"github.com/thelande/mb8600/pkg/schema"
+)
+
+// A CLI command, run with a logged in client. Commands pass identifiers
+// through anon, if not nil, before printing them.
+type command struct {
+	description string
+	run         func(c *mb8600.MotoClient, output string, anon *mb8600.Anonymizer, w io.Writer) error
+}
+
+var commands = map[string]command{
+	"capabilities": {"Probe which HNAP actions the modem supports.", runCapabilities},
+	"channels":     {"Print the downstream and upstream channels.", runChannels},
+	"doctor":       {"Check the signal levels and the modem's security settings.", runDoctor},
+	"logs":         {"Print the event log.", runLogs},
+	"status":       {"Print the software, connection and startup status and the channels.", runStatus},
+}
+
+func usage(fs *flag.FlagSet) func() {
+	return func() {
+		w := fs.Output()
+		fmt.Fprintf(w, "Usage: mb8600 [flags] <command>\n\nCommands:\n")
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(w, "  %-12s %s\n", name, commands[name].description)
+		}
+		fmt.Fprintf(w, "  %-12s %s\n", "bugreport", "Run a command, status by default, and print a redacted report of it for a GitHub issue.")
+		fmt.Fprintf(w, "  %-12s %s\n", "schema", "Print the JSON schema of an output, or list the schemas.")
+		fmt.Fprintf(w, "\nFlags:\n")
+		fs.PrintDefaults()
+	}
+}
+
+// Runs the CLI with args, writing results to stdout.
+func run(args []string, getenv func(string) string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("mb8600", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = usage(fs)
+
+	configPath := fs.String("config", defaultConfigPath(getenv), "Configuration file defining profiles and aliases.")
+	profileName := fs.String("profile", getenv("MB8600_PROFILE"), "Profile to use from the configuration file.")
+	address := fs.String("address", "", "Address of the modem. Overrides the profile.")
+	username := fs.String("username", "", "Username used to log in to the modem. Overrides the profile.")
+	password := fs.String("password", "", "Password used to log in to the modem. Overrides the profile.")
+	output := fs.String("output", "", "Output format: table, json or influx (InfluxDB line protocol, channels only). Overrides the profile.")
+	timeout := fs.Duration("timeout", 10*time.Second, "Timeout of each request to the modem.")
+	anonymizeKey := fs.String("anonymize-key", getenv("MB8600_ANONYMIZE_KEY"), "Key used to replace MAC addresses, serial numbers, IP addresses and account names with pseudonyms, e.g. to share the output publicly. Not anonymized if empty.")
+	capturePath := fs.String("capture-payloads", "", "File every request to the modem and the raw response to it are written to, with secrets and identifiers replaced, e.g. to attach to a bug report about a parsing failure.")
+	sessionDir := fs.String("session-dir", defaultSessionDir(), "Directory logins are kept in to be reused by later runs. Every run logs in if empty.")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	// The schema command does not talk to the modem.
+	if fs.Arg(0) == "schema" {
+		return runSchema(fs.Args()[1:], stdout)
+	}
+	if fs.NArg() != 1 && !(fs.Arg(0) == "bugreport" && fs.NArg() == 2) {
+		fs.Usage()
+		return fmt.Errorf("expected one command, got %d", fs.NArg())
+	}
+
+	cfg, err := loadConfigFile(*configPath)
+	if err != nil {
+		return err
+	}
+	p, err := cfg.profile(*profileName)
+	if err != nil {
+		return err
+	}
+	p.merge(&profile{Address: *address, Username: *username, Password: *password, Output: *output})
+	if p.Output != "table" && p.Output != "json" && p.Output != "influx" {
+		return fmt.Errorf("invalid output format: %s", p.Output)
+	}
+
+	name := cfg.resolveAlias(fs.Arg(0))
+	// The bug report logs in itself, so that a failing login is reported.
+	if name == "bugreport" {
+		reported := "status"
+		if fs.NArg() == 2 {
+			reported = cfg.resolveAlias(fs.Arg(1))
+		}
+		return runBugReport(p, reported, *timeout, *anonymizeKey, p.Output, stdout)
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("unknown command: %s", name)
+	}
+
+	opts, err := p.clientOptions(*timeout)
+	if err != nil {
+		return err
+	}
+	if *capturePath != "" {
+		capture, err := mb8600.CreatePayloadFile(*capturePath)
+		if err != nil {
+			return err
+		}
+		defer capture.Close()
+		opts = append(opts, mb8600.WithPayloadRecorder(capture))
+	}
+	client := mb8600.NewMotoClient(p.Address, p.Username, p.Password, log.NewNopLogger(), opts...)
+	defer client.CloseIdleConnections()
+
+	// Reuse the session of a previous run if there is one. The client logs in
+	// again if the modem has expired it.
+	var store mb8600.SessionStore
+	if *sessionDir != "" {
+		store = &mb8600.FileSessionStore{Path: sessionPath(*sessionDir, p)}
+	}
+	if store == nil || client.LoadSession(store) != nil {
+		if _, err := client.Login(); err != nil {
+			return err
+		}
+	}
+
+	var anon *mb8600.Anonymizer
+	if *anonymizeKey != "" {
+		anon = mb8600.NewAnonymizer(*anonymizeKey)
+	}
+	if err := cmd.run(client, p.Output, anon, stdout); err != nil {
+		return err
+	}
+
+	if store != nil {
+		if err := os.MkdirAll(*sessionDir, 0700); err != nil {
+			return err
+		}
+		return client.SaveSession(store)
+	}
+	return nil
+}
+
+// Returns mb8600 in the user cache directory, or an empty string if there
+// is none.
+func defaultSessionDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "mb8600")
+}
+
+// Returns the file the session of the modem and user of p is kept in.
+func sessionPath(dir string, p *profile) string {
+	name := strings.NewReplacer("/", "_", ":", "_").Replace(p.Username + "@" + p.Address)
+	return filepath.Join(dir, "session-"+name+".json")
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func runChannels(c *mb8600.MotoClient, output string, anon *mb8600.Anonymizer, w io.Writer) error {
+	downstream, err := c.GetDownstreamChannels()
+	if err != nil {
+		return err
+	}
+	upstream, err := c.GetUpstreamChannels()
+	if err != nil {
+		return err
+	}
+
+	switch output {
+	case "json":
+		return writeJSON(w, map[string]any{"downstream": downstream, "upstream": upstream})
+	case "influx":
+		return mb8600.NewLineProtocolEncoder(w).EncodeSnapshot(&mb8600.Snapshot{
+			Time:       time.Now(),
+			Downstream: downstream,
+			Upstream:   upstream,
+		})
+	}
+
+	if err := render.DownstreamChannels(w, downstream, render.Text); err != nil {
+		return err
+	}
+	fmt.Fprintln(w)
+	return render.UpstreamChannels(w, upstream, render.Text)
+}
+
+func runCapabilities(c *mb8600.MotoClient, output string, anon *mb8600.Anonymizer, w io.Writer) error {
+	caps, err := c.Capabilities()
+	if err != nil {
+		return err
+	}
+
+	switch output {
+	case "json":
+		return writeJSON(w, caps)
+	case "influx":
+		return fmt.Errorf("capabilities cannot be written as influx")
+	}
+
+	actions := make([]string, 0, len(caps.Actions))
+	for action := range caps.Actions {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ACTION\tSUPPORT")
+	for _, action := range actions {
+		fmt.Fprintf(tw, "%s\t%s\n", action, caps.Actions[action])
+	}
+	return tw.Flush()
+}
+
+func runLogs(c *mb8600.MotoClient, output string, anon *mb8600.Anonymizer, w io.Writer) error {
+	entries, err := c.GetLogs()
+	if err != nil {
+		return err
+	}
+	if anon != nil {
+		entries = anon.Logs(entries)
+	}
+
+	switch output {
+	case "json":
+		return writeJSON(w, entries)
+	case "influx":
+		return fmt.Errorf("logs cannot be written as influx")
+	}
+
+	return render.Logs(w, entries, render.Text)
+}
+
+// A problem found by the doctor command.
+type finding struct {
+	Check   string   `json:"check"`
+	Status  string   `json:"status"`
+	Reasons []string `json:"reasons"`
+}
+
+func runDoctor(c *mb8600.MotoClient, output string, anon *mb8600.Anonymizer, w io.Writer) error {
+	status, err := c.GetStatus()
+	if err != nil {
+		return err
+	}
+	account, err := c.GetAccountInfo()
+	if err != nil {
+		return err
+	}
+	if anon != nil {
+		account = anon.Account(account)
+	}
+
+	switch output {
+	case "json":
+		// JSON is for machines, so it stays in English.
+		findings := doctorFindings(status, account, nil)
+		if findings == nil {
+			findings = []finding{}
+		}
+		return writeJSON(w, findings)
+	case "influx":
+		return fmt.Errorf("doctor results cannot be written as influx")
+	}
+
+	p := i18n.NewPrinter(i18n.LanguageFromEnv())
+	findings := doctorFindings(status, account, p)
+	if len(findings) == 0 {
+		_, err := fmt.Fprintln(w, p.Translate("No problems found."))
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\t%s\t%s\n", p.Translate("CHECK"), p.Translate("STATUS"), p.Translate("DETAILS"))
+	for _, f := range findings {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", f.Check, f.Status, strings.Join(f.Reasons, "; "))
+	}
+	return tw.Flush()
+}
+
+// Returns the problems with the signal levels and the account, translated by
+// p. A nil Printer returns them in English.
+func doctorFindings(status *mb8600.ModemStatus, account *mb8600.AccountInfo, p *i18n.Printer) []finding {
+	var findings []finding
+	add := func(check string, v *health.Verdict) {
+		findings = append(findings, finding{check, v.Status.Localize(p), v.LocalizedReasons(p)})
+	}
+
+	report := health.Evaluate(status.Snapshot(), nil, health.DefaultThresholds())
+	for _, v := range report.Channels {
+		if v.Status != health.StatusOK {
+			add(p.Sprintf("%s %d", p.Translate(v.Direction), v.ChannelID), v)
+		}
+	}
+	if v := report.UpstreamCount; v.Status != health.StatusOK {
+		add(p.Translate("upstream channels"), v)
+	}
+	if v := report.PartialService; v.Status != health.StatusOK {
+		add(p.Translate("partial service"), v)
+	}
+	if v := health.CheckAccount(account); v.Status != health.StatusOK {
+		add(p.Translate("account"), v)
+	}
+	return findings
+}
+
+// Prints the JSON schema named by args, or the names of the schemas if there
+// are no args.
+func runSchema(args []string, w io.Writer) error {
+	switch len(args) {
+	case 0:
+		for _, name := range schema.Names() {
+			fmt.Fprintf(w, "%s\t%s\n", name, schema.ID(name))
+		}
+		return nil
+	case 1:
+		data, err := schema.Get(args[0])
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+	return fmt.Errorf("expected at most one schema name, got %d", len(args))
+}
+
+func runStatus(c *mb8600.MotoClient, output string, anon *mb8600.Anonymizer, w io.Writer) error {
+	status, err := c.GetStatus()
+	if err != nil {
+		return err
+	}
+	if anon != nil {
+		status = anon.Status(status)
+	}
+
+	switch output {
+	case "json":
+		return writeJSON(w, status)
+	case "influx":
+		return mb8600.NewLineProtocolEncoder(w).EncodeSnapshot(status.Snapshot())
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Software version\t%s\n", status.Software.SoftwareVersion)
+	fmt.Fprintf(tw, "Hardware version\t%s\n", status.Software.HardwareVersion)
+	fmt.Fprintf(tw, "MAC address\t%s\n", status.Software.MACAddress)
+	fmt.Fprintf(tw, "Serial number\t%s\n", status.Software.SerialNumber)
+	fmt.Fprintf(tw, "Uptime\t%s\n", status.Connection.Uptime)
+	fmt.Fprintf(tw, "Network access\t%s\n", status.Connection.NetworkAccess)
+	fmt.Fprintf(tw, "Boot\t%s\t%s\n", status.Startup.BootStatus, status.Startup.BootComment)
+	fmt.Fprintf(tw, "Configuration file\t%s\t%s\n", status.Startup.ConfigFileStatus, status.Startup.ConfigFileComment)
+	fmt.Fprintf(tw, "Security\t%s\t%s\n", status.Startup.SecurityStatus, status.Startup.SecurityComment)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w)
+	if err := render.DownstreamChannels(w, status.Downstream, render.Text); err != nil {
+		return err
+	}
+	fmt.Fprintln(w)
+	return render.UpstreamChannels(w, status.Upstream, render.Text)
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Getenv, os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(os.Stderr, "mb8600: %v\n", err)
+		}
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+
+	"github.com/thelande/mb8600/pkg/mb8600"
+	"github.com/thelande/mb8600/pkg/mb8600test"
+)
+
+func TestRun(t *testing.T) {
+	modem := mb8600test.NewModem("admin", "motorola")
+	server := mb8600test.NewServer(modem)
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	sessionDir := filepath.Join(t.TempDir(), "sessions")
+	config := `{
+		"profiles": {"parents-house": {"address": "` + mb8600test.Address(server) + `", "password": "motorola", "output": "json"}},
+		"aliases": {"ch": "channels"}
+	}`
+	if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	getenv := func(key string) string {
+		if key == "MB8600_CONFIG" {
+			return path
+		}
+		return ""
+	}
+	run := func(args []string, getenv func(string) string, stdout, stderr io.Writer) error {
+		return run(append([]string{"--session-dir", sessionDir}, args...), getenv, stdout, stderr)
+	}
+
+	var stdout bytes.Buffer
+	if err := run([]string{"--profile", "parents-house", "ch"}, getenv, &stdout, io.Discard); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	var channels struct {
+		Downstream []json.RawMessage `json:"downstream"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &channels); err != nil || len(channels.Downstream) != 5 {
+		t.Errorf("run() output = %s, want JSON with 5 downstream channels", stdout.String())
+	}
+
+	// Flags override the profile.
+	stdout.Reset()
+	if err := run([]string{"--profile", "parents-house", "--output", "table", "channels"}, getenv, &stdout, io.Discard); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if !strings.HasPrefix(stdout.String(), "Channel") || !strings.Contains(stdout.String(), "Symb. Rate") {
+		t.Errorf("run() output = %s, want downstream and upstream tables", stdout.String())
+	}
+
+	stdout.Reset()
+	if err := run([]string{"--profile", "parents-house", "--output", "influx", "channels"}, getenv, &stdout, io.Discard); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if !strings.HasPrefix(stdout.String(), "mb8600_downstream_") {
+		t.Errorf("run() output = %s, want line protocol", stdout.String())
+	}
+
+	// The test modem uses the default password, which the doctor flags, in
+	// the language of the environment.
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LC_MESSAGES", "")
+	for lang, want := range map[string]string{
+		"en_US.UTF-8": "account  warning  default credentials in use for account admin",
+		"de_DE.UTF-8": "Konto    Warnung  Standardzugangsdaten für das Konto admin in Verwendung",
+	} {
+		t.Setenv("LANG", lang)
+		stdout.Reset()
+		if err := run([]string{"--profile", "parents-house", "--output", "table", "doctor"}, getenv, &stdout, io.Discard); err != nil {
+			t.Fatalf("run() error = %v", err)
+		}
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("run() output in %s = %s, want a default credentials warning", lang, stdout.String())
+		}
+	}
+	t.Setenv("LANG", "C")
+
+	// Identifiers are replaced with pseudonyms when anonymizing.
+	for _, output := range []string{"table", "json"} {
+		stdout.Reset()
+		if err := run([]string{"--profile", "parents-house", "--output", output, "--anonymize-key", "secret", "status"}, getenv, &stdout, io.Discard); err != nil {
+			t.Fatalf("run() error = %v", err)
+		}
+		if !strings.Contains(stdout.String(), "8600-19.3.18") {
+			t.Errorf("run() output = %s, want the status", stdout.String())
+		}
+		if strings.Contains(stdout.String(), "00:11:22:33:44:55") || strings.Contains(stdout.String(), "2018123456789") {
+			t.Errorf("run() output = %s, want the MAC address and serial number anonymized", stdout.String())
+		}
+	}
+	stdout.Reset()
+	if err := run([]string{"--profile", "parents-house", "--output", "table", "--anonymize-key", "secret", "doctor"}, getenv, &stdout, io.Discard); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	if !strings.Contains(stdout.String(), "for account user-") {
+		t.Errorf("run() output = %s, want the account name anonymized", stdout.String())
+	}
+
+	// Later runs reuse the session of the first.
+	logins := 0
+	for _, action := range modem.Requests() {
+		if action == "Login" {
+			logins++
+		}
+	}
+	if logins != 2 {
+		t.Errorf("Modem.Requests() = %v, want a single login exchange", modem.Requests())
+	}
+
+	// Captured payloads replay without the modem.
+	capture := filepath.Join(t.TempDir(), "payloads.jsonl")
+	if err := run([]string{"--profile", "parents-house", "--session-dir", "", "--capture-payloads", capture, "channels"}, getenv, io.Discard, io.Discard); err != nil {
+		t.Fatalf("run() error = %v", err)
+	}
+	payloads, err := mb8600.LoadPayloadFile(capture)
+	if err != nil {
+		t.Fatalf("LoadPayloadFile() error = %v", err)
+	}
+	replay := mb8600.NewMotoClient("192.0.2.1", "admin", "", log.NewNopLogger(), mb8600.WithTransport(mb8600.NewReplayTransport(payloads)))
+	if _, err := replay.Login(); err != nil {
+		t.Fatalf("replayed MotoClient.Login() error = %v", err)
+	}
+	if _, err := replay.GetDownstreamChannels(); err != nil {
+		t.Errorf("replayed MotoClient.GetDownstreamChannels() error = %v", err)
+	}
+
+	for _, args := range [][]string{
+		{"--profile", "cabin", "channels"},
+		{"--profile", "parents-house", "reboot"},
+		{"--profile", "parents-house", "--password", "wrong", "--session-dir", "", "channels"},
+		{},
+	} {
+		if err := run(args, getenv, io.Discard, io.Discard); err == nil {
+			t.Errorf("run(%v) error = nil, want error", args)
+		}
+	}
+}
+
+func TestRun_capabilities(t *testing.T) {
+	modem := mb8600test.NewModem("admin", "motorola")
+	server := mb8600test.NewServer(modem)
+	defer server.Close()
+	modem.SetStatus("GetMotoLagStatus", 404)
+
+	var stdout bytes.Buffer
+	args := []string{"--session-dir", "", "--address", mb8600test.Address(server), "--password", "motorola", "--output", "table", "capabilities"}
+	if err := run(args, func(string) string { return "" }, &stdout, io.Discard); err != nil {
+		t.Fatalf("run(%v) error = %v", args, err)
+	}
+	for _, want := range []string{"GetMotoLagStatus                    unsupported\n", "GetMotoStatusSoftware               supported\n"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("run() output is missing %q:\n%s", want, stdout.String())
+		}
+	}
+}
+
+func TestRun_schema(t *testing.T) {
+	getenv := func(string) string { return "" }
+
+	var stdout bytes.Buffer
+	if err := run([]string{"schema"}, getenv, &stdout, io.Discard); err != nil {
+		t.Fatalf("run(schema) error = %v", err)
+	}
+	if !strings.Contains(stdout.String(), "modem-status\t") {
+		t.Errorf("run(schema) output = %s, want the schema names", stdout.String())
+	}
+
+	stdout.Reset()
+	if err := run([]string{"schema", "modem-status"}, getenv, &stdout, io.Discard); err != nil {
+		t.Fatalf("run(schema modem-status) error = %v", err)
+	}
+	var doc struct {
+		ID string `json:"$id"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &doc); err != nil || !strings.HasSuffix(doc.ID, "/modem-status.json") {
+		t.Errorf("run(schema modem-status) output = %s, want the modem status schema", stdout.String())
+	}
+
+	if err := run([]string{"schema", "nope"}, getenv, io.Discard, io.Discard); err == nil {
+		t.Error("run(schema nope) error = nil, want an error")
+	}
+}
@@ -0,0 +1,187 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	pkgconfig "github.com/thelande/mb8600/pkg/config"
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+// The settings of a modem the user manages. Empty fields fall back to the
+// defaults.
+type profile struct {
+	Address      string `json:"address,omitempty"`
+	Username     string `json:"username,omitempty"`
+	Password     string `json:"password,omitempty"`
+	PasswordFile string `json:"password_file,omitempty"`
+	// How the connection to the modem is secured, see pkg/config.
+	TLS             pkgconfig.TLSMode `json:"tls,omitempty"`
+	CertFingerprint string            `json:"cert_fingerprint,omitempty"`
+	// The default output format: table, json or influx.
+	Output string `json:"output,omitempty"`
+}
+
+// The CLI configuration file, YAML, TOML or JSON as read by pkg/config,
+// e.g.
+//
+//	default_profile: home
+//	profiles:
+//	  home:
+//	    password_file: /home/me/.modem-password
+//	  parents-house:
+//	    address: 10.1.0.1
+//	    password: motorola
+//	    tls: pinned
+//	    cert_fingerprint: "AB:CD:..."
+//	    output: json
+//	aliases:
+//	  ch: channels
+type configFile struct {
+	DefaultProfile string              `json:"default_profile,omitempty"`
+	Profiles       map[string]*profile `json:"profiles,omitempty"`
+	// Alternative names of commands.
+	Aliases map[string]string `json:"aliases,omitempty"`
+}
+
+var defaultProfile = profile{
+	Address:  "192.168.100.1",
+	Username: "admin",
+	TLS:      pkgconfig.TLSInsecure,
+	Output:   "table",
+}
+
+// Returns the path of the configuration file: $MB8600_CONFIG, or the first
+// of mb8600/config.yaml, config.toml and config.json in the user
+// configuration directory that exists, config.json if none does.
+func defaultConfigPath(getenv func(string) string) string {
+	if path := getenv("MB8600_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	for _, name := range []string{"config.yaml", "config.toml"} {
+		if path := filepath.Join(dir, "mb8600", name); fileExists(path) {
+			return path
+		}
+	}
+	return filepath.Join(dir, "mb8600", "config.json")
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Reads the configuration file at path. A missing file is an empty
+// configuration.
+func loadConfigFile(path string) (*configFile, error) {
+	cfg := &configFile{}
+	if path == "" {
+		return cfg, nil
+	}
+
+	if err := pkgconfig.UnmarshalFile(path, cfg); errors.Is(err, fs.ErrNotExist) {
+		return &configFile{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Returns the named profile merged over the defaults. An empty name selects
+// the default profile, if one is configured.
+func (c *configFile) profile(name string) (*profile, error) {
+	p := defaultProfile
+	if name == "" {
+		name = c.DefaultProfile
+	}
+	if name == "" {
+		return &p, nil
+	}
+
+	named, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile: %s", name)
+	}
+	p.merge(named)
+
+	if p.PasswordFile != "" {
+		data, err := os.ReadFile(p.PasswordFile)
+		if err != nil {
+			return nil, err
+		}
+		p.Password = strings.TrimRight(string(data), "\r\n")
+	}
+	return &p, nil
+}
+
+// Overrides the fields of p that are set in o.
+func (p *profile) merge(o *profile) {
+	if o.Address != "" {
+		p.Address = o.Address
+	}
+	if o.Username != "" {
+		p.Username = o.Username
+	}
+	if o.Password != "" {
+		p.Password = o.Password
+	}
+	if o.PasswordFile != "" {
+		p.PasswordFile = o.PasswordFile
+	}
+	if o.TLS != "" {
+		p.TLS = o.TLS
+	}
+	if o.CertFingerprint != "" {
+		p.CertFingerprint = o.CertFingerprint
+	}
+	if o.Output != "" {
+		p.Output = o.Output
+	}
+}
+
+// Returns the client options reaching the modem of p, with the given
+// timeout.
+func (p *profile) clientOptions(timeout time.Duration) ([]mb8600.Option, error) {
+	modem := pkgconfig.Modem{
+		Address:         p.Address,
+		TLS:             p.TLS,
+		CertFingerprint: p.CertFingerprint,
+		Timeout:         pkgconfig.Duration(timeout),
+	}
+	if err := modem.Validate(); err != nil {
+		return nil, err
+	}
+	return modem.ClientOptions()
+}
+
+// Returns the command an alias stands for, or name if it is not an alias.
+func (c *configFile) resolveAlias(name string) string {
+	if command, ok := c.Aliases[name]; ok {
+		return command
+	}
+	return name
+}
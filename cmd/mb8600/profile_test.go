@@ -0,0 +1,106 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pkgconfig "github.com/thelande/mb8600/pkg/config"
+)
+
+func TestConfigFile_profile(t *testing.T) {
+	dir := t.TempDir()
+	passwordFile := filepath.Join(dir, "password")
+	if err := os.WriteFile(passwordFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.yaml")
+	config := `
+default_profile: home
+profiles:
+  home:
+    password_file: ` + passwordFile + `
+  parents-house:
+    address: 10.1.0.1
+    password: motorola
+    tls: pinned
+    cert_fingerprint: "AB:CD"
+    output: json
+aliases:
+  ch: channels
+`
+	if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := loadConfigFile(path)
+	if err != nil {
+		t.Fatalf("loadConfigFile() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		want    profile
+		wantErr bool
+	}{
+		{"", profile{Address: "192.168.100.1", Username: "admin", Password: "secret", PasswordFile: passwordFile, TLS: pkgconfig.TLSInsecure, Output: "table"}, false},
+		{"parents-house", profile{Address: "10.1.0.1", Username: "admin", Password: "motorola", TLS: pkgconfig.TLSPinned, CertFingerprint: "AB:CD", Output: "json"}, false},
+		{"cabin", profile{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := cfg.profile(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("configFile.profile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && *got != tt.want {
+				t.Errorf("configFile.profile() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+
+	if got := cfg.resolveAlias("ch"); got != "channels" {
+		t.Errorf("configFile.resolveAlias(ch) = %s, want channels", got)
+	}
+	if got := cfg.resolveAlias("logs"); got != "logs" {
+		t.Errorf("configFile.resolveAlias(logs) = %s, want logs", got)
+	}
+}
+
+func TestLoadConfigFile_missing(t *testing.T) {
+	cfg, err := loadConfigFile(filepath.Join(t.TempDir(), "config.json"))
+	if err != nil {
+		t.Fatalf("loadConfigFile() error = %v", err)
+	}
+	p, err := cfg.profile("")
+	if err != nil || *p != defaultProfile {
+		t.Errorf("configFile.profile() = %+v, %v, want the default profile", p, err)
+	}
+}
+
+func TestProfile_clientOptions(t *testing.T) {
+	p := defaultProfile
+	if _, err := p.clientOptions(time.Second); err != nil {
+		t.Errorf("profile.clientOptions() error = %v", err)
+	}
+	p.TLS = pkgconfig.TLSPinned
+	if _, err := p.clientOptions(time.Second); err == nil {
+		t.Error("profile.clientOptions() error = nil, want one for pinned without a fingerprint")
+	}
+}
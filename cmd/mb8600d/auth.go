@@ -0,0 +1,127 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// Authenticates requests to the HTTP server, either by a bearer token or,
+// behind an authenticating reverse proxy such as oauth2-proxy, by a header
+// naming the user that is only trusted from the proxy's addresses.
+type authenticator struct {
+	// SHA-256 hashes of the accepted tokens, compared in constant time.
+	tokens         [][sha256.Size]byte
+	proxyHeader    string
+	trustedProxies []netip.Prefix
+}
+
+// Returns the authenticator configured by cfg, or nil if authentication is
+// disabled.
+func newAuthenticator(cfg *config) (*authenticator, error) {
+	a := &authenticator{proxyHeader: cfg.AuthProxyHeader}
+
+	tokens := cfg.AuthTokens
+	if cfg.AuthTokenFile != "" {
+		data, err := os.ReadFile(cfg.AuthTokenFile)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, strings.Fields(string(data))...)
+	}
+	for _, token := range tokens {
+		a.tokens = append(a.tokens, sha256.Sum256([]byte(token)))
+	}
+
+	for _, proxy := range cfg.AuthTrustedProxies {
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(proxy)
+			if addrErr != nil {
+				return nil, fmt.Errorf("invalid trusted proxy: %w", err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		a.trustedProxies = append(a.trustedProxies, prefix)
+	}
+
+	if a.proxyHeader != "" && len(a.trustedProxies) == 0 {
+		return nil, fmt.Errorf("an auth proxy header requires trusted proxies")
+	}
+	if len(a.tokens) == 0 && a.proxyHeader == "" {
+		return nil, nil
+	}
+	return a, nil
+}
+
+// Returns handler, rejecting unauthenticated requests. A nil authenticator
+// accepts every request.
+func (a *authenticator) wrap(handler http.Handler) http.Handler {
+	if a == nil {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.authenticated(r) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mb8600d"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func (a *authenticator) authenticated(r *http.Request) bool {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		sum := sha256.Sum256([]byte(strings.TrimSpace(token)))
+		match := 0
+		for _, t := range a.tokens {
+			match |= subtle.ConstantTimeCompare(sum[:], t[:])
+		}
+		if match == 1 {
+			return true
+		}
+	}
+
+	if a.proxyHeader != "" && r.Header.Get(a.proxyHeader) != "" {
+		return a.trustedProxy(r.RemoteAddr)
+	}
+	return false
+}
+
+func (a *authenticator) trustedProxy(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range a.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAuthenticator(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "tokens")
+	if err := os.WriteFile(tokenFile, []byte("file-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	auth, err := newAuthenticator(&config{
+		AuthTokens:         []string{"flag-token"},
+		AuthTokenFile:      tokenFile,
+		AuthProxyHeader:    "X-Forwarded-User",
+		AuthTrustedProxies: []string{"10.0.0.0/8", "::1"},
+	})
+	if err != nil {
+		t.Fatalf("newAuthenticator() error = %v", err)
+	}
+	handler := auth.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       int
+	}{
+		{"no credentials", "192.168.1.2:40000", nil, http.StatusUnauthorized},
+		{"flag token", "192.168.1.2:40000", map[string]string{"Authorization": "Bearer flag-token"}, http.StatusOK},
+		{"file token", "192.168.1.2:40000", map[string]string{"Authorization": "Bearer file-token"}, http.StatusOK},
+		{"wrong token", "192.168.1.2:40000", map[string]string{"Authorization": "Bearer guess"}, http.StatusUnauthorized},
+		{"trusted proxy", "10.1.2.3:40000", map[string]string{"X-Forwarded-User": "me"}, http.StatusOK},
+		{"trusted IPv6 proxy", "[::1]:40000", map[string]string{"X-Forwarded-User": "me"}, http.StatusOK},
+		{"untrusted proxy", "192.168.1.2:40000", map[string]string{"X-Forwarded-User": "me"}, http.StatusUnauthorized},
+		{"trusted proxy without user", "10.1.2.3:40000", nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/channels", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewAuthenticator(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *config
+		wantNil bool
+		wantErr bool
+	}{
+		{"disabled", &config{}, true, false},
+		{"tokens", &config{AuthTokens: []string{"token"}}, false, false},
+		{"proxy without trusted proxies", &config{AuthProxyHeader: "X-Forwarded-User"}, false, true},
+		{"invalid trusted proxy", &config{AuthProxyHeader: "X-Forwarded-User", AuthTrustedProxies: []string{"proxy"}}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newAuthenticator(tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newAuthenticator() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (got == nil) != tt.wantNil {
+				t.Errorf("newAuthenticator() = %v, want nil %v", got, tt.wantNil)
+			}
+		})
+	}
+}
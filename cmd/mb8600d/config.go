@@ -0,0 +1,387 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/anomaly"
+	"github.com/thelande/mb8600/pkg/compression"
+	pkgconfig "github.com/thelande/mb8600/pkg/config"
+	"github.com/thelande/mb8600/pkg/health"
+	"github.com/thelande/mb8600/pkg/mb8600"
+	"github.com/thelande/mb8600/pkg/mqtt"
+	"github.com/thelande/mb8600/pkg/notify"
+	"github.com/thelande/mb8600/pkg/simdgen"
+)
+
+const envPrefix = "MB8600_"
+
+// The daemon configuration. Every setting can be given as a flag or as an
+// environment variable named MB8600_<FLAG>, with dashes replaced by
+// underscores, e.g. MB8600_POLL_INTERVAL. Flags take precedence over the
+// environment, which takes precedence over the file given with -config-file.
+type config struct {
+	Address      string
+	HNAPPath     string
+	Username     string
+	Password     string
+	PasswordFile string
+	// How the connection to the modem is secured, TLSPinned if
+	// CertFingerprint is set.
+	TLS             pkgconfig.TLSMode
+	CertFingerprint string
+	UserAgent       string
+	// Additional headers set on every request to the modem.
+	Headers       map[string]string
+	SOAPNamespace string
+	HNAPEncoding  mb8600.Encoding
+	PollInterval  time.Duration
+	// When the modem is polled, collectBackground or collectOnScrape.
+	Collection string
+	// Whether channel metrics are scored for anomalies, and how.
+	Anomalies     bool
+	AnomalyMethod anomaly.Method
+	Timeout       time.Duration
+	// Limits of the stages of a request, unlimited within Timeout if 0.
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	// How long the modem keeps an idle session.
+	SessionTTL time.Duration
+	// The wait after a failed login, and the consecutive failed logins after
+	// which logins stop for LoginLockout.
+	LoginInterval    time.Duration
+	LoginMaxFailures int
+	LoginLockout     time.Duration
+	LogLevel         string
+	LogFormat        string
+	LogFile          string
+	// The size in megabytes at which the log file is rotated.
+	LogFileMaxSize    int
+	LogFileMaxAge     time.Duration
+	LogFileMaxBackups int
+	ListenAddress     string
+	GraphQL           bool
+	CaptureCommand    []string
+	CaptureCooldown   time.Duration
+	CaptureTimeout    time.Duration
+	PostPollCommand   []string
+	PostPollTimeout   time.Duration
+	StateFile         string
+	// The scenario of the simulated modem polled instead of a real one, see
+	// pkg/simdgen.
+	Simulate simdgen.Scenario
+	// The codec the state and history files are compressed with, see
+	// pkg/compression.
+	StateCompression string
+	HistoryFile      string
+	MQTTAddress      string
+	MQTTUsername     string
+	MQTTPassword     string
+	MQTTDiscovery    string
+	WebhookURL       string
+	WebhookFormat    notify.Format
+	// The minimum time between two notifications of the same alert.
+	WebhookMinInterval time.Duration
+	// The thresholds channel health is evaluated with, set from the file
+	// given with -config-file.
+	Thresholds health.Thresholds
+	// Bearer tokens accepted by the HTTP server.
+	AuthTokens         []string
+	AuthTokenFile      string
+	AuthProxyHeader    string
+	AuthTrustedProxies []string
+}
+
+// The flags holding secrets, which are not passed on to the commands the
+// daemon runs.
+// The values of -anomaly-method other than off.
+var anomalyMethods = map[string]anomaly.Method{"zscore": anomaly.ZScore, "mad": anomaly.MAD}
+
+var secretFlags = []string{"password", "auth-tokens", "mqtt-password", "webhook-url"}
+
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// Returns environ, in the form of os.Environ, without the variables of
+// secretFlags.
+func commandEnv(environ []string) []string {
+	var env []string
+	for _, v := range environ {
+		name, _, _ := strings.Cut(v, "=")
+		if !slices.ContainsFunc(secretFlags, func(flag string) bool { return envName(flag) == name }) {
+			env = append(env, v)
+		}
+	}
+	return env
+}
+
+// Splits a comma-separated list, dropping empty elements.
+func splitList(list string) []string {
+	var elems []string
+	for _, elem := range strings.Split(list, ",") {
+		if elem = strings.TrimSpace(elem); elem != "" {
+			elems = append(elems, elem)
+		}
+	}
+	return elems
+}
+
+// Parses the configuration from args, using getenv for defaults.
+func loadConfig(args []string, getenv func(string) string) (*config, error) {
+	cfg := &config{Thresholds: health.DefaultThresholds()}
+	fs := flag.NewFlagSet("mb8600d", flag.ContinueOnError)
+
+	var configFile string
+	fs.StringVar(&configFile, "config-file", "", "YAML, TOML or JSON file with the modem, poll interval and sinks, see pkg/config. Flags and environment variables take precedence.")
+
+	fs.StringVar(&cfg.Address, "address", "192.168.100.1", "Address of the modem, with an optional port, e.g. 192.168.100.1:8443 or [fe80::1].")
+	fs.StringVar(&cfg.HNAPPath, "hnap-path", "/HNAP1/", "Path of the modem's HNAP endpoint, e.g. when reached through a reverse proxy.")
+	fs.StringVar(&cfg.Username, "username", "admin", "Username used to log in to the modem.")
+	fs.StringVar(&cfg.Password, "password", "", "Password used to log in to the modem.")
+	fs.StringVar(&cfg.PasswordFile, "password-file", "", "File containing the password, e.g. a container secret.")
+	var tlsMode string
+	fs.StringVar(&tlsMode, "tls", string(pkgconfig.TLSInsecure), "How the connection to the modem is secured: insecure (HTTPS without verifying the modem's self-signed certificate), pinned (to -cert-fingerprint), verify (against the system's roots) or off (plain HTTP).")
+	fs.StringVar(&cfg.CertFingerprint, "cert-fingerprint", "", "SHA-256 fingerprint of the modem certificate to pin. Implies -tls pinned.")
+	fs.StringVar(&cfg.UserAgent, "user-agent", "", "User-Agent of requests to the modem, e.g. for a reverse proxy in front of it. Go's default if empty.")
+	var headers string
+	fs.StringVar(&headers, "headers", "", "Comma-separated Name: value headers added to every request to the modem.")
+	fs.StringVar(&cfg.SOAPNamespace, "soap-namespace", "", "SOAPAction namespace, for firmware that does not use http://purenetworks.com/HNAP1/.")
+	var encoding string
+	fs.StringVar(&encoding, "hnap-encoding", string(mb8600.EncodingJSON), "Encoding of requests to the modem: json, xml (SOAP envelopes, for firmware that rejects JSON) or auto (switch to xml if the modem rejects json).")
+	var simulate string
+	fs.StringVar(&simulate, "simulate", "", "Poll a simulated modem playing a scenario instead of a real one, for demos: healthy, noise-ingress, power-drift, flapping, partial-service or reboots.")
+	fs.DurationVar(&cfg.PollInterval, "poll-interval", 30*time.Second, "Interval between polls of the modem.")
+	fs.StringVar(&cfg.Collection, "collection", collectBackground, "When the modem is polled: background (every poll interval, scrapes are served the latest poll) or scrape (whenever /metrics is scraped, for fresh data at the cost of scrape latency).")
+	var anomalyMethod string
+	fs.StringVar(&anomalyMethod, "anomaly-method", "zscore", "How channel SNR and power are scored against their recent values to log anomalies and export scores: zscore, mad (median absolute deviation, less sensitive to earlier outliers) or off.")
+	fs.DurationVar(&cfg.Timeout, "timeout", 10*time.Second, "Timeout of each request to the modem.")
+	fs.DurationVar(&cfg.DialTimeout, "dial-timeout", 3*time.Second, "Timeout of connecting to the modem, so an unreachable modem fails fast.")
+	fs.DurationVar(&cfg.TLSHandshakeTimeout, "tls-handshake-timeout", 5*time.Second, "Timeout of the TLS handshake with the modem.")
+	fs.DurationVar(&cfg.ResponseHeaderTimeout, "response-header-timeout", 0, "Timeout of waiting for the modem to answer a request. Limited only by -timeout if 0.")
+	fs.DurationVar(&cfg.SessionTTL, "session-ttl", mb8600.DefaultSessionTTL, "How long the modem keeps an idle session. The daemon logs in again shortly before, and lowers it if the modem expires sessions sooner. Disabled if 0.")
+	fs.DurationVar(&cfg.LoginInterval, "login-interval", mb8600.DefaultLoginInterval, "Minimum time between a failed login and the next attempt.")
+	fs.IntVar(&cfg.LoginMaxFailures, "login-max-failures", mb8600.DefaultLoginMaxFailures, "Consecutive logins rejected by the modem after which the daemon stops logging in, so a wrong password does not lock the modem's web interface. Never stops if 0.")
+	fs.DurationVar(&cfg.LoginLockout, "login-lockout", mb8600.DefaultLoginLockout, "How long logins stop after -login-max-failures rejected logins. Until restart if 0.")
+	fs.StringVar(&cfg.LogLevel, "log-level", "info", "Log level: debug, info, warn or error.")
+	fs.StringVar(&cfg.LogFormat, "log-format", "logfmt", "Log format: logfmt or json.")
+	fs.StringVar(&cfg.LogFile, "log-file", "", "File logs are written to in addition to stderr. Rotated on SIGHUP. Disabled if empty.")
+	fs.IntVar(&cfg.LogFileMaxSize, "log-file-max-size", 10, "Size in megabytes at which the log file is rotated.")
+	fs.DurationVar(&cfg.LogFileMaxAge, "log-file-max-age", 0, "Age after which rotated log files are removed, rounded up to whole days. Kept regardless of age if 0.")
+	fs.IntVar(&cfg.LogFileMaxBackups, "log-file-max-backups", 3, "Number of rotated log files kept. All are kept if 0.")
+	fs.StringVar(&cfg.ListenAddress, "listen-address", ":9860", "Address the HTTP server listens on.")
+	fs.BoolVar(&cfg.GraphQL, "graphql", false, "Serve a GraphQL endpoint for the latest snapshot at /graphql.")
+	fs.StringVar(&cfg.StateFile, "state-file", "", "File the channel history is kept in across restarts. Kept in memory only if empty.")
+	fs.StringVar(&cfg.StateCompression, "state-compression", compression.None, "Compression of the state and history files: none, gzip or zstd. Files are read back whatever they were written with.")
+	fs.StringVar(&cfg.HistoryFile, "history-file", "", "File every snapshot is appended to, for queries over days or weeks. Disabled if empty.")
+	fs.StringVar(&cfg.MQTTAddress, "mqtt-address", "", "Address of an MQTT broker to publish to for Home Assistant, e.g. localhost:1883. Disabled if empty.")
+	fs.StringVar(&cfg.MQTTUsername, "mqtt-username", "", "Username used to connect to the MQTT broker.")
+	fs.StringVar(&cfg.MQTTPassword, "mqtt-password", "", "Password used to connect to the MQTT broker.")
+	fs.StringVar(&cfg.MQTTDiscovery, "mqtt-discovery-prefix", mqtt.DefaultDiscoveryPrefix, "Home Assistant MQTT discovery prefix.")
+	fs.StringVar(&cfg.WebhookURL, "webhook-url", "", "URL alerts are posted to when a channel loses its lock, a downstream SNR drops below its threshold or the modem reboots. Disabled if empty.")
+	var webhookFormat string
+	fs.StringVar(&webhookFormat, "webhook-format", string(notify.FormatJSON), "Payload of the webhook: json, slack or discord.")
+	fs.DurationVar(&cfg.WebhookMinInterval, "webhook-min-interval", notify.DefaultMinInterval, "Minimum time between two alerts about the same channel and condition, so a flapping channel does not flood the webhook.")
+	var authTokens, authTrustedProxies string
+	fs.StringVar(&authTokens, "auth-tokens", "", "Comma-separated bearer tokens required by the HTTP server. Authentication is disabled unless tokens or a proxy header are set.")
+	fs.StringVar(&cfg.AuthTokenFile, "auth-token-file", "", "File containing bearer tokens required by the HTTP server, one per line.")
+	fs.StringVar(&cfg.AuthProxyHeader, "auth-proxy-header", "", "Header set by an authenticating reverse proxy, e.g. X-Forwarded-User, accepted from trusted proxies.")
+	fs.StringVar(&authTrustedProxies, "auth-trusted-proxies", "", "Comma-separated addresses or CIDRs of the reverse proxies trusted to set the proxy header.")
+	var captureCommand string
+	fs.StringVar(&captureCommand, "capture-command", "", "Command run when channel health becomes critical, e.g. to start a packet capture. Split on spaces and not run through a shell.")
+	fs.DurationVar(&cfg.CaptureCooldown, "capture-cooldown", 15*time.Minute, "Minimum time between two runs of the capture command.")
+	fs.DurationVar(&cfg.CaptureTimeout, "capture-timeout", time.Minute, "Time limit of each run of the capture command, which delays the handling of the next poll while it runs. Unlimited if 0.")
+	var postPollCommand string
+	fs.StringVar(&postPollCommand, "post-poll-command", "", "Command run after each poll, reading the snapshot as JSON on stdin and a summary from MB8600_HOOK_* environment variables. Split on spaces and not run through a shell.")
+	fs.DurationVar(&cfg.PostPollTimeout, "post-poll-timeout", 30*time.Second, "Time limit of each run of the post-poll command. Unlimited if 0.")
+
+	// Apply the environment before parsing so flags take precedence.
+	set := map[string]bool{}
+	var envErr error
+	fs.VisitAll(func(f *flag.Flag) {
+		if value := getenv(envName(f.Name)); value != "" {
+			set[f.Name] = true
+			if err := f.Value.Set(value); err != nil && envErr == nil {
+				envErr = fmt.Errorf("invalid value %q for %s: %w", value, envName(f.Name), err)
+			}
+		}
+	})
+	if envErr != nil {
+		return nil, envErr
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	if configFile != "" {
+		if err := applyConfigFile(fs, cfg, configFile, set); err != nil {
+			return nil, err
+		}
+	}
+
+	cfg.CaptureCommand = strings.Fields(captureCommand)
+	cfg.PostPollCommand = strings.Fields(postPollCommand)
+	cfg.AuthTokens = splitList(authTokens)
+	for _, header := range splitList(headers) {
+		name, value, ok := strings.Cut(header, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("invalid header, want Name: value: %q", header)
+		}
+		if cfg.Headers == nil {
+			cfg.Headers = map[string]string{}
+		}
+		cfg.Headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	cfg.AuthTrustedProxies = splitList(authTrustedProxies)
+
+	if cfg.PasswordFile != "" {
+		data, err := os.ReadFile(cfg.PasswordFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Password = strings.TrimRight(string(data), "\r\n")
+	}
+
+	cfg.TLS = pkgconfig.TLSMode(tlsMode)
+	if cfg.CertFingerprint != "" && !set["tls"] {
+		cfg.TLS = pkgconfig.TLSPinned
+	}
+	if err := cfg.modem().Validate(); err != nil {
+		return nil, err
+	}
+	hnapEncoding, err := mb8600.ParseEncoding(encoding)
+	if err != nil {
+		return nil, err
+	}
+	cfg.HNAPEncoding = hnapEncoding
+	if _, err := compression.Lookup(cfg.StateCompression); err != nil {
+		return nil, err
+	}
+	if cfg.WebhookFormat, err = notify.ParseFormat(webhookFormat); err != nil {
+		return nil, err
+	}
+	if cfg.Collection != collectBackground && cfg.Collection != collectOnScrape {
+		return nil, fmt.Errorf("invalid collection, want %s or %s: %q", collectBackground, collectOnScrape, cfg.Collection)
+	}
+	if anomalyMethod != "off" {
+		if cfg.AnomalyMethod, cfg.Anomalies = anomalyMethods[anomalyMethod]; !cfg.Anomalies {
+			return nil, fmt.Errorf("invalid anomaly method, want zscore, mad or off: %q", anomalyMethod)
+		}
+	}
+	if simulate != "" {
+		if cfg.Simulate, err = simdgen.ParseScenario(simulate); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.DialTimeout < 0 || cfg.TLSHandshakeTimeout < 0 || cfg.ResponseHeaderTimeout < 0 || cfg.SessionTTL < 0 {
+		return nil, fmt.Errorf("timeouts must not be negative")
+	}
+
+	if cfg.LoginInterval < 0 || cfg.LoginMaxFailures < 0 || cfg.LoginLockout < 0 {
+		return nil, fmt.Errorf("login limits must not be negative")
+	}
+
+	if cfg.LogFileMaxSize <= 0 {
+		return nil, fmt.Errorf("log file max size must be positive: %d", cfg.LogFileMaxSize)
+	}
+
+	if cfg.PollInterval <= 0 {
+		return nil, fmt.Errorf("poll interval must be positive: %s", cfg.PollInterval)
+	}
+
+	if cfg.MQTTPassword != "" && cfg.MQTTUsername == "" {
+		return nil, fmt.Errorf("an MQTT password requires an MQTT username")
+	}
+
+	return cfg, nil
+}
+
+// Returns the modem settings of cfg in the form of pkg/config.
+func (cfg *config) modem() pkgconfig.Modem {
+	return pkgconfig.Modem{
+		Address:         cfg.Address,
+		TLS:             cfg.TLS,
+		CertFingerprint: cfg.CertFingerprint,
+		Timeout:         pkgconfig.Duration(cfg.Timeout),
+	}
+}
+
+// Sets the flags not in set, and the thresholds of cfg, from the
+// configuration file at path.
+func applyConfigFile(fs *flag.FlagSet, cfg *config, path string, set map[string]bool) error {
+	fileCfg, err := pkgconfig.Load(path, nil)
+	if err != nil {
+		return err
+	}
+
+	values := map[string]string{
+		"address":              fileCfg.Modem.Address,
+		"username":             fileCfg.Modem.Username,
+		"password":             fileCfg.Modem.Password,
+		"timeout":              time.Duration(fileCfg.Modem.Timeout).String(),
+		"tls":                  string(fileCfg.Modem.TLS),
+		"cert-fingerprint":     fileCfg.Modem.CertFingerprint,
+		"poll-interval":        time.Duration(fileCfg.Poll.Interval).String(),
+		"log-level":            fileCfg.Log.Level,
+		"log-format":           fileCfg.Log.Format,
+		"log-file":             fileCfg.Log.File,
+		"log-file-max-size":    strconv.Itoa(fileCfg.Log.FileMaxSize),
+		"log-file-max-age":     time.Duration(fileCfg.Log.FileMaxAge).String(),
+		"log-file-max-backups": strconv.Itoa(fileCfg.Log.FileMaxBackups),
+	}
+	cfg.Thresholds = fileCfg.Thresholds.Health()
+	for _, sink := range fileCfg.Sinks {
+		switch sink.Type {
+		case pkgconfig.SinkPrometheus:
+			if sink.Address != "" {
+				values["listen-address"] = sink.Address
+			}
+		case pkgconfig.SinkMQTT:
+			values["mqtt-address"] = sink.Address
+			values["mqtt-username"] = sink.Username
+			values["mqtt-password"] = sink.Password
+			if prefix := sink.Options["discovery_prefix"]; prefix != "" {
+				values["mqtt-discovery-prefix"] = prefix
+			}
+		case pkgconfig.SinkWebhook:
+			values["webhook-url"] = sink.Address
+			values["webhook-format"] = sink.Options["format"]
+		case pkgconfig.SinkFile:
+			values["history-file"] = sink.Address
+		}
+	}
+
+	for name, value := range values {
+		if set[name] || value == "" {
+			continue
+		}
+		if err := fs.Set(name, value); err != nil {
+			return fmt.Errorf("invalid value %q for %s in %s: %w", value, name, path, err)
+		}
+	}
+	return nil
+}
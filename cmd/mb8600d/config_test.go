@@ -0,0 +1,387 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/anomaly"
+	"github.com/thelande/mb8600/pkg/compression"
+	pkgconfig "github.com/thelande/mb8600/pkg/config"
+	"github.com/thelande/mb8600/pkg/health"
+	"github.com/thelande/mb8600/pkg/mb8600"
+	"github.com/thelande/mb8600/pkg/notify"
+	"github.com/thelande/mb8600/pkg/simdgen"
+)
+
+func TestLoadConfig(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(passwordFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	configFile := filepath.Join(t.TempDir(), "mb8600.yaml")
+	configYAML := `
+modem:
+  address: 10.0.0.3
+  password: from-file
+poll:
+  interval: 2m
+log:
+  level: debug
+  file_max_backups: 7
+thresholds:
+  min_locked_upstream: 2
+sinks:
+  - type: mqtt
+    address: broker:1883
+    options:
+      discovery_prefix: ha
+  - type: prometheus
+    address: ":9100"
+  - type: webhook
+    address: https://hooks.example.com/alerts
+    options:
+      format: slack
+`
+	if err := os.WriteFile(configFile, []byte(configYAML), 0600); err != nil {
+		t.Fatal(err)
+	}
+	verifyFile := filepath.Join(t.TempDir(), "mb8600.toml")
+	if err := os.WriteFile(verifyFile, []byte("[modem]\ntls = \"verify\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		check   func(cfg *config) bool
+		wantErr bool
+	}{
+		{
+			"defaults",
+			nil,
+			nil,
+			func(cfg *config) bool {
+				return cfg.Address == "192.168.100.1" && cfg.Username == "admin" && cfg.PollInterval == 30*time.Second &&
+					cfg.TLS == pkgconfig.TLSInsecure && reflect.DeepEqual(cfg.Thresholds, health.DefaultThresholds())
+			},
+			false,
+		},
+		{
+			"env",
+			nil,
+			map[string]string{"MB8600_ADDRESS": "10.0.0.1", "MB8600_POLL_INTERVAL": "1m"},
+			func(cfg *config) bool { return cfg.Address == "10.0.0.1" && cfg.PollInterval == time.Minute },
+			false,
+		},
+		{
+			"flag overrides env",
+			[]string{"-address", "10.0.0.2"},
+			map[string]string{"MB8600_ADDRESS": "10.0.0.1"},
+			func(cfg *config) bool { return cfg.Address == "10.0.0.2" },
+			false,
+		},
+		{
+			"password file",
+			nil,
+			map[string]string{"MB8600_PASSWORD_FILE": passwordFile},
+			func(cfg *config) bool { return cfg.Password == "secret" },
+			false,
+		},
+		{
+			"timeouts",
+			nil,
+			map[string]string{"MB8600_TIMEOUT": "1m", "MB8600_RESPONSE_HEADER_TIMEOUT": "45s"},
+			func(cfg *config) bool {
+				return cfg.Timeout == time.Minute && cfg.DialTimeout == 3*time.Second &&
+					cfg.TLSHandshakeTimeout == 5*time.Second && cfg.ResponseHeaderTimeout == 45*time.Second
+			},
+			false,
+		},
+		{
+			"negative timeout",
+			[]string{"-dial-timeout", "-1s"},
+			nil,
+			nil,
+			true,
+		},
+		{
+			"log file",
+			[]string{"-log-file", "/var/log/mb8600d.log", "-log-file-max-age", "168h"},
+			nil,
+			func(cfg *config) bool {
+				return cfg.LogFile == "/var/log/mb8600d.log" && cfg.LogFileMaxSize == 10 &&
+					cfg.LogFileMaxAge == 168*time.Hour && cfg.LogFileMaxBackups == 3
+			},
+			false,
+		},
+		{
+			"mqtt password without username",
+			[]string{"-mqtt-address", "localhost:1883", "-mqtt-password", "secret"},
+			nil,
+			nil,
+			true,
+		},
+		{
+			"anomaly method",
+			nil,
+			map[string]string{"MB8600_ANOMALY_METHOD": "mad"},
+			func(cfg *config) bool { return cfg.Anomalies && cfg.AnomalyMethod == anomaly.MAD },
+			false,
+		},
+		{
+			"anomalies off",
+			[]string{"-anomaly-method", "off"},
+			nil,
+			func(cfg *config) bool { return !cfg.Anomalies },
+			false,
+		},
+		{
+			"invalid anomaly method",
+			[]string{"-anomaly-method", "ewma"},
+			nil,
+			nil,
+			true,
+		},
+		{
+			"invalid log file max size",
+			[]string{"-log-file-max-size", "0"},
+			nil,
+			nil,
+			true,
+		},
+		{
+			"capture command",
+			nil,
+			map[string]string{"MB8600_CAPTURE_COMMAND": "ssh router  capture.sh  eth0"},
+			func(cfg *config) bool {
+				return slices.Equal(cfg.CaptureCommand, []string{"ssh", "router", "capture.sh", "eth0"}) &&
+					cfg.CaptureCooldown == 15*time.Minute && cfg.CaptureTimeout == time.Minute
+			},
+			false,
+		},
+		{
+			"headers",
+			[]string{"-user-agent", "exporter", "-headers", "X-Real-IP: 10.0.0.2, X-Modem:mb8600"},
+			nil,
+			func(cfg *config) bool {
+				return cfg.UserAgent == "exporter" &&
+					cfg.Headers["X-Real-IP"] == "10.0.0.2" && cfg.Headers["X-Modem"] == "mb8600"
+			},
+			false,
+		},
+		{
+			"hnap encoding",
+			[]string{"-hnap-encoding", "auto"},
+			nil,
+			func(cfg *config) bool { return cfg.HNAPEncoding == mb8600.EncodingAuto },
+			false,
+		},
+		{
+			"invalid hnap encoding",
+			[]string{"-hnap-encoding", "yaml"},
+			nil,
+			nil,
+			true,
+		},
+		{
+			"state compression",
+			[]string{"-state-compression", "gzip"},
+			nil,
+			func(cfg *config) bool { return cfg.StateCompression == compression.Gzip },
+			false,
+		},
+		{
+			"unknown state compression",
+			[]string{"-state-compression", "lz4"},
+			nil,
+			nil,
+			true,
+		},
+		{
+			"login limits",
+			[]string{"-login-max-failures", "5", "-login-lockout", "0"},
+			nil,
+			func(cfg *config) bool {
+				return cfg.LoginMaxFailures == 5 && cfg.LoginLockout == 0 && cfg.LoginInterval == mb8600.DefaultLoginInterval
+			},
+			false,
+		},
+		{
+			"negative login interval",
+			[]string{"-login-interval", "-1s"},
+			nil,
+			nil,
+			true,
+		},
+		{
+			"collection",
+			nil,
+			map[string]string{"MB8600_COLLECTION": "scrape"},
+			func(cfg *config) bool { return cfg.Collection == collectOnScrape },
+			false,
+		},
+		{
+			"invalid collection",
+			[]string{"-collection", "lazy"},
+			nil,
+			nil,
+			true,
+		},
+		{
+			"simulate",
+			[]string{"-simulate", "noise-ingress"},
+			nil,
+			func(cfg *config) bool { return cfg.Simulate == simdgen.NoiseIngress },
+			false,
+		},
+		{
+			"invalid simulate",
+			[]string{"-simulate", "meteor-strike"},
+			nil,
+			nil,
+			true,
+		},
+		{
+			"invalid header",
+			[]string{"-headers", "X-Real-IP"},
+			nil,
+			nil,
+			true,
+		},
+		{
+			"post-poll command",
+			[]string{"-post-poll-command", "plug.sh cycle", "-post-poll-timeout", "1m"},
+			nil,
+			func(cfg *config) bool {
+				return slices.Equal(cfg.PostPollCommand, []string{"plug.sh", "cycle"}) &&
+					cfg.PostPollTimeout == time.Minute
+			},
+			false,
+		},
+		{
+			"mqtt",
+			[]string{"-mqtt-address", "localhost:1883"},
+			nil,
+			func(cfg *config) bool {
+				return cfg.MQTTAddress == "localhost:1883" && cfg.MQTTDiscovery == "homeassistant"
+			},
+			false,
+		},
+		{
+			"IPv6 address",
+			[]string{"-address", "[fe80::1]:8443"},
+			nil,
+			func(cfg *config) bool { return cfg.Address == "[fe80::1]:8443" },
+			false,
+		},
+		{
+			"config file",
+			[]string{"-config-file", configFile},
+			nil,
+			func(cfg *config) bool {
+				return cfg.Address == "10.0.0.3" && cfg.Password == "from-file" && cfg.PollInterval == 2*time.Minute &&
+					cfg.MQTTAddress == "broker:1883" && cfg.MQTTDiscovery == "ha" && cfg.ListenAddress == ":9100" &&
+					cfg.WebhookURL == "https://hooks.example.com/alerts" && cfg.WebhookFormat == notify.FormatSlack &&
+					cfg.LogLevel == "debug" && cfg.LogFileMaxBackups == 7 && cfg.LogFileMaxSize == 10 &&
+					cfg.Thresholds.MinLockedUpstream == 2 && cfg.TLS == pkgconfig.TLSInsecure
+			},
+			false,
+		},
+		{
+			"flags and env override config file",
+			[]string{"-config-file", configFile, "-poll-interval", "5m"},
+			map[string]string{"MB8600_ADDRESS": "10.0.0.4", "MB8600_PASSWORD_FILE": passwordFile},
+			func(cfg *config) bool {
+				return cfg.Address == "10.0.0.4" && cfg.Password == "secret" && cfg.PollInterval == 5*time.Minute &&
+					cfg.MQTTAddress == "broker:1883"
+			},
+			false,
+		},
+		{
+			"webhook",
+			[]string{"-webhook-url", "https://hooks.example.com/alerts", "-webhook-format", "discord"},
+			nil,
+			func(cfg *config) bool {
+				return cfg.WebhookFormat == notify.FormatDiscord && cfg.WebhookMinInterval == notify.DefaultMinInterval
+			},
+			false,
+		},
+		{"invalid webhook format", []string{"-webhook-format", "teams"}, nil, nil, true},
+		{
+			"config file tls",
+			[]string{"-config-file", verifyFile},
+			nil,
+			func(cfg *config) bool { return cfg.TLS == pkgconfig.TLSVerify },
+			false,
+		},
+		{
+			"cert fingerprint overrides config file tls",
+			[]string{"-config-file", verifyFile, "-cert-fingerprint", "AB:CD"},
+			nil,
+			func(cfg *config) bool { return cfg.TLS == pkgconfig.TLSPinned && cfg.CertFingerprint == "AB:CD" },
+			false,
+		},
+		{
+			"tls off",
+			[]string{"-tls", "off"},
+			nil,
+			func(cfg *config) bool { return cfg.TLS == pkgconfig.TLSOff },
+			false,
+		},
+		{"pinned without fingerprint", []string{"-tls", "pinned"}, nil, nil, true},
+		{"invalid tls", []string{"-tls", "yes"}, nil, nil, true},
+		{"missing config file", []string{"-config-file", filepath.Join(t.TempDir(), "missing.yaml")}, nil, nil, true},
+		{"invalid address", []string{"-address", "https://192.168.100.1/"}, nil, nil, true},
+		{"invalid env", nil, map[string]string{"MB8600_POLL_INTERVAL": "soon"}, nil, true},
+		{"invalid interval", []string{"-poll-interval", "0s"}, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadConfig(tt.args, func(key string) string { return tt.env[key] })
+			if (err != nil) != tt.wantErr {
+				t.Errorf("loadConfig() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil && !tt.check(got) {
+				t.Errorf("loadConfig() = %+v", got)
+			}
+		})
+	}
+}
+
+func TestCommandEnv(t *testing.T) {
+	environ := []string{
+		"PATH=/usr/bin",
+		"MB8600_PASSWORD=secret",
+		"MB8600_PASSWORD_FILE=/run/secrets/modem",
+		"MB8600_AUTH_TOKENS=token",
+		"MB8600_MQTT_PASSWORD=secret",
+		"MB8600_WEBHOOK_URL=https://hooks.example.com/secret",
+		"MB8600_POLL_INTERVAL=1m",
+	}
+	want := []string{"PATH=/usr/bin", "MB8600_PASSWORD_FILE=/run/secrets/modem", "MB8600_POLL_INTERVAL=1m"}
+	if got := commandEnv(environ); !slices.Equal(got, want) {
+		t.Errorf("commandEnv() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/correlate"
+	"github.com/thelande/mb8600/pkg/history"
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+// Returns the since query parameter, an RFC 3339 time, or the zero time if
+// it is not given.
+func sinceParam(query url.Values) (time.Time, error) {
+	since := query.Get("since")
+	if since == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, since)
+}
+
+// Serves the errors of the downstream channel given by the channel_id query
+// parameter over time, see history.Store.ErrorsOverTime.
+func historyErrorsHandler(store *history.Store) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		channelID, err := strconv.Atoi(query.Get("channel_id"))
+		if err != nil {
+			http.Error(w, "invalid channel_id: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		since, err := sinceParam(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		samples, err := store.ErrorsOverTime(channelID, since)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if samples == nil {
+			samples = []history.ErrorSample{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(samples)
+	})
+}
+
+// Serves the gaps in the modem's service, see history.Store.UptimeGaps.
+// Gaps between polls longer than maxInterval, or the max_interval query
+// parameter, are reported.
+func historyGapsHandler(store *history.Store, maxInterval time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		since, err := sinceParam(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		interval := maxInterval
+		if value := query.Get("max_interval"); value != "" {
+			if interval, err = time.ParseDuration(value); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		gaps, err := store.UptimeGaps(since, interval)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if gaps == nil {
+			gaps = []history.Gap{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(gaps)
+	})
+}
+
+// Serves the incidents of the modem's event log joined with the history, see
+// correlate.Correlate. The event log is fetched with logs on every request.
+// The window query parameter sets the time around an event within which
+// channel data is joined.
+func historyIncidentsHandler(store *history.Store, logs func() ([]*mb8600.LogEntry, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		since, err := sinceParam(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		cfg := correlate.DefaultConfig()
+		if value := query.Get("window"); value != "" {
+			if cfg.Window, err = time.ParseDuration(value); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		entries, err := logs()
+		if err != nil {
+			http.Error(w, "unable to fetch event log: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+		// Channel data from just before since still describes the first
+		// incidents.
+		from := since
+		if !from.IsZero() {
+			from = from.Add(-cfg.Window)
+		}
+		snapshots, err := store.Snapshots(from)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		incidents := []*correlate.Incident{}
+		for _, incident := range correlate.Correlate(entries, snapshots, cfg) {
+			if !incident.End.Before(since) {
+				incidents = append(incidents, incident)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(incidents)
+	})
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/history"
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+func TestHistoryHandlers(t *testing.T) {
+	store, err := history.Open(filepath.Join(t.TempDir(), "history.jsonl"))
+	if err != nil {
+		t.Fatalf("history.Open() error = %v", err)
+	}
+	defer store.Close()
+
+	start := time.Date(2023, 12, 16, 0, 0, 0, 0, time.UTC)
+	for idx, offset := range []time.Duration{0, time.Minute, time.Hour} {
+		store.Append(&mb8600.Snapshot{Time: start.Add(offset), Downstream: []*mb8600.DownstreamChannel{
+			{ChannelID: 20, LockStatus: "Locked", UncorrectedErrors: float64(idx)},
+		}})
+	}
+
+	logs := func() ([]*mb8600.LogEntry, error) {
+		return []*mb8600.LogEntry{
+			{Timestamp: start.Add(30 * time.Second), Code: mb8600.EventT3Timeout},
+			{Timestamp: start.Add(50 * time.Minute), Code: mb8600.EventSyncLoss},
+			{Description: "Time Not Established", Code: mb8600.EventT3Timeout},
+		}, nil
+	}
+	failingLogs := func() ([]*mb8600.LogEntry, error) { return nil, errors.New("timeout") }
+
+	tests := []struct {
+		name       string
+		handler    http.Handler
+		target     string
+		wantStatus int
+		wantLen    int
+	}{
+		{"errors", historyErrorsHandler(store), "/history/errors?channel_id=20", http.StatusOK, 2},
+		{"errors since", historyErrorsHandler(store), "/history/errors?channel_id=20&since=2023-12-16T00:30:00Z", http.StatusOK, 0},
+		{"errors without channel", historyErrorsHandler(store), "/history/errors", http.StatusBadRequest, 0},
+		{"gaps", historyGapsHandler(store, 3*time.Minute), "/history/gaps", http.StatusOK, 1},
+		{"gaps max interval", historyGapsHandler(store, 3*time.Minute), "/history/gaps?max_interval=2h", http.StatusOK, 0},
+		{"incidents", historyIncidentsHandler(store, logs), "/history/incidents", http.StatusOK, 2},
+		{"incidents since", historyIncidentsHandler(store, logs), "/history/incidents?since=2023-12-16T00:10:00Z", http.StatusOK, 1},
+		{"incidents invalid window", historyIncidentsHandler(store, logs), "/history/incidents?window=long", http.StatusBadRequest, 0},
+		{"incidents without log", historyIncidentsHandler(store, failingLogs), "/history/incidents", http.StatusBadGateway, 0},
+		{"gaps invalid since", historyGapsHandler(store, 3*time.Minute), "/history/gaps?since=yesterday", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var items []json.RawMessage
+			if err := json.Unmarshal(rec.Body.Bytes(), &items); err != nil || len(items) != tt.wantLen {
+				t.Errorf("body = %s, want %d items", rec.Body.String(), tt.wantLen)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/thelande/mb8600/pkg/health"
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+// A user command run after each poll, for local automation such as
+// power-cycling the router, without writing Go. The command reads the
+// snapshot as JSON on stdin, and a summary of it from the environment.
+type pollHook struct {
+	// The command and its arguments. It is not run through a shell.
+	command []string
+	// The time limit of each run of the command. Zero means no limit.
+	timeout time.Duration
+	// The thresholds the health summary is evaluated with.
+	thresholds health.Thresholds
+
+	run func(ctx context.Context, name string, args, env []string, stdin []byte) error
+}
+
+// Runs the hook with the snapshot curr, prev being the snapshot before it or
+// nil.
+func (h *pollHook) Run(ctx context.Context, prev, curr *mb8600.Snapshot) error {
+	stdin, err := json.Marshal(curr)
+	if err != nil {
+		return err
+	}
+
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+
+	run := h.run
+	if run == nil {
+		run = runHookCommand
+	}
+	if err := run(ctx, h.command[0], h.command[1:], hookEnv(prev, curr, h.thresholds), stdin); err != nil {
+		return fmt.Errorf("post-poll command %s failed: %w", h.command[0], err)
+	}
+	return nil
+}
+
+func runHookCommand(ctx context.Context, name string, args, env []string, stdin []byte) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(commandEnv(os.Environ()), env...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// Returns the environment summarizing the snapshot curr, its health
+// evaluated with thresholds. The variables are prefixed MB8600_HOOK_ so that
+// they do not configure a daemon the command starts.
+func hookEnv(prev, curr *mb8600.Snapshot, thresholds health.Thresholds) []string {
+	report := health.Evaluate(curr, prev, thresholds)
+	env := []string{
+		"MB8600_HOOK_POLL_TIME=" + curr.Time.Format(time.RFC3339),
+		"MB8600_HOOK_FIRST_POLL=" + strconv.FormatBool(prev == nil),
+		"MB8600_HOOK_DOWNSTREAM_CHANNELS=" + strconv.Itoa(len(curr.Downstream)),
+		"MB8600_HOOK_DOWNSTREAM_LOCKED=" + strconv.Itoa(len(mb8600.FilterLockedDownstream(curr.Downstream))),
+		"MB8600_HOOK_UPSTREAM_CHANNELS=" + strconv.Itoa(len(curr.Upstream)),
+		"MB8600_HOOK_UPSTREAM_LOCKED=" + strconv.Itoa(curr.LockedUpstreamChannels()),
+		"MB8600_HOOK_UNCORRECTED=" + strconv.FormatFloat(mb8600.TotalUncorrected(curr.Downstream), 'f', 0, 64),
+		"MB8600_HOOK_HEALTH_STATUS=" + report.Status.String(),
+		fmt.Sprintf("MB8600_HOOK_HEALTH_SCORE=%.1f", report.Score),
+	}
+	scqam, _ := mb8600.PartitionDownstreamChannels(curr.Downstream)
+	if snr, ok := mb8600.MinSNR(scqam); ok {
+		env = append(env, "MB8600_HOOK_MIN_SNR="+strconv.FormatFloat(snr, 'f', -1, 64))
+	}
+	if partial := curr.PartialService; partial != nil {
+		env = append(env,
+			"MB8600_HOOK_DOWNSTREAM_PARTIAL_SERVICE="+strconv.FormatBool(partial.Downstream),
+			"MB8600_HOOK_UPSTREAM_PARTIAL_SERVICE="+strconv.FormatBool(partial.Upstream),
+		)
+	}
+	return env
+}
+
+// Returns a snapshot handler that runs hook.
+func pollHookHandler(ctx context.Context, hook *pollHook, logger log.Logger) func(prev, curr *mb8600.Snapshot) {
+	return func(prev, curr *mb8600.Snapshot) {
+		if err := hook.Run(ctx, prev, curr); err != nil {
+			level.Error(logger).Log("msg", "post-poll hook failed", "err", err)
+		}
+	}
+}
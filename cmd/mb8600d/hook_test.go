@@ -0,0 +1,118 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/health"
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+func hookSnapshot() *mb8600.Snapshot {
+	return &mb8600.Snapshot{
+		Time: time.Date(2023, 12, 16, 0, 0, 0, 0, time.UTC),
+		Downstream: []*mb8600.DownstreamChannel{
+			{Channel: 1, ChannelID: 20, LockStatus: "Locked", Modulation: "QAM256", Frequency: 531, Power: 2.8, SignalToNoise: 40.5, UncorrectedErrors: 3},
+			{Channel: 2, ChannelID: 21, LockStatus: "Not Locked", Modulation: "QAM256"},
+		},
+		Upstream: []*mb8600.UpstreamChannel{
+			{Channel: 1, ChannelID: 4, LockStatus: "Locked", ChannelType: "SC-QAM", SymbolRate: 5120, Frequency: 35.6, Power: 44},
+		},
+		PartialService: &mb8600.PartialService{Upstream: true},
+	}
+}
+
+func TestPollHook(t *testing.T) {
+	var (
+		gotName  string
+		gotArgs  []string
+		gotEnv   []string
+		gotStdin []byte
+	)
+	hook := &pollHook{
+		command:    []string{"notify", "--quiet"},
+		thresholds: health.DefaultThresholds(),
+		run: func(ctx context.Context, name string, args, env []string, stdin []byte) error {
+			gotName, gotArgs, gotEnv, gotStdin = name, args, env, stdin
+			return nil
+		},
+	}
+
+	curr := hookSnapshot()
+	if err := hook.Run(context.Background(), nil, curr); err != nil {
+		t.Fatalf("pollHook.Run() error = %v", err)
+	}
+
+	if gotName != "notify" || !slices.Equal(gotArgs, []string{"--quiet"}) {
+		t.Errorf("ran %s %v, want notify [--quiet]", gotName, gotArgs)
+	}
+	for _, want := range []string{
+		"MB8600_HOOK_POLL_TIME=2023-12-16T00:00:00Z",
+		"MB8600_HOOK_FIRST_POLL=true",
+		"MB8600_HOOK_DOWNSTREAM_CHANNELS=2",
+		"MB8600_HOOK_DOWNSTREAM_LOCKED=1",
+		"MB8600_HOOK_UPSTREAM_LOCKED=1",
+		"MB8600_HOOK_UNCORRECTED=3",
+		"MB8600_HOOK_MIN_SNR=40.5",
+		"MB8600_HOOK_DOWNSTREAM_PARTIAL_SERVICE=false",
+		"MB8600_HOOK_UPSTREAM_PARTIAL_SERVICE=true",
+	} {
+		if !slices.Contains(gotEnv, want) {
+			t.Errorf("environment %v is missing %s", gotEnv, want)
+		}
+	}
+
+	var snapshot mb8600.Snapshot
+	if err := json.Unmarshal(gotStdin, &snapshot); err != nil {
+		t.Fatalf("stdin is not a JSON snapshot: %v", err)
+	}
+	if len(snapshot.Downstream) != 2 || snapshot.Upstream[0].ChannelID != 4 {
+		t.Errorf("stdin snapshot = %+v", snapshot)
+	}
+}
+
+func TestPollHook_error(t *testing.T) {
+	hook := &pollHook{
+		command: []string{"false"},
+		run: func(context.Context, string, []string, []string, []byte) error {
+			return errors.New("exit status 1")
+		},
+	}
+	err := hook.Run(context.Background(), nil, hookSnapshot())
+	if err == nil || !strings.Contains(err.Error(), "false") {
+		t.Errorf("pollHook.Run() error = %v, want one naming the command", err)
+	}
+}
+
+func TestRunHookCommand(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+	t.Setenv("MB8600_PASSWORD", "secret")
+	script := `test "$MB8600_HOOK_FIRST_POLL" = true && test -z "$MB8600_PASSWORD" && grep -q '"downstream"'`
+	err := runHookCommand(context.Background(), "sh", []string{"-c", script}, []string{"MB8600_HOOK_FIRST_POLL=true"}, []byte(`{"downstream":[]}`))
+	if err != nil {
+		t.Errorf("runHookCommand() error = %v", err)
+	}
+}
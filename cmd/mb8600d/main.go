@@ -0,0 +1,561 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command mb8600d polls a Motorola MB8600 cable modem and logs changes in its
+// channel state.
+//
+// It is configured entirely through flags and environment variables and, unless
+// a state or log file is configured, does not write to the filesystem, so it
+// runs unmodified in scratch or distroless containers. SIGINT and SIGTERM
+// trigger a graceful shutdown, SIGHUP rotates the log file.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/thelande/mb8600/pkg/anomaly"
+	"github.com/thelande/mb8600/pkg/atomicfile"
+	"github.com/thelande/mb8600/pkg/compression"
+	"github.com/thelande/mb8600/pkg/graphql"
+	"github.com/thelande/mb8600/pkg/health"
+	"github.com/thelande/mb8600/pkg/history"
+	"github.com/thelande/mb8600/pkg/mb8600"
+	"github.com/thelande/mb8600/pkg/mb8600/kitlog"
+	"github.com/thelande/mb8600/pkg/mqtt"
+	"github.com/thelande/mb8600/pkg/notify"
+	"github.com/thelande/mb8600/pkg/supervisor"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+func newLogger(logLevel, format string, w io.Writer) (log.Logger, error) {
+	var logger log.Logger
+	switch format {
+	case "logfmt":
+		logger = log.NewLogfmtLogger(log.NewSyncWriter(w))
+	case "json":
+		logger = log.NewJSONLogger(log.NewSyncWriter(w))
+	default:
+		return nil, fmt.Errorf("invalid log format: %s", format)
+	}
+
+	var option level.Option
+	switch logLevel {
+	case "debug":
+		option = level.AllowDebug()
+	case "info":
+		option = level.AllowInfo()
+	case "warn":
+		option = level.AllowWarn()
+	case "error":
+		option = level.AllowError()
+	default:
+		return nil, fmt.Errorf("invalid log level: %s", logLevel)
+	}
+
+	logger = level.NewFilter(logger, option)
+	return log.With(logger, "ts", log.DefaultTimestampUTC, "caller", log.DefaultCaller), nil
+}
+
+// Opens the log file configured in cfg, which lumberjack rotates by size and
+// prunes by age, rounded up to whole days, and number.
+func newLogFile(cfg *config) (*lumberjack.Logger, error) {
+	// lumberjack opens the file on the first write; opening it now reports
+	// an unwritable path at startup rather than losing the logs.
+	file, err := os.OpenFile(cfg.LogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+
+	return &lumberjack.Logger{
+		Filename:   cfg.LogFile,
+		MaxSize:    cfg.LogFileMaxSize,
+		MaxAge:     int((cfg.LogFileMaxAge + 24*time.Hour - 1) / (24 * time.Hour)),
+		MaxBackups: cfg.LogFileMaxBackups,
+	}, nil
+}
+
+// Rotates the log file on SIGHUP until ctx is done, which also starts a new
+// file once logrotate or an operator moved it away.
+func rotateOnHangup(ctx context.Context, file *lumberjack.Logger, logger log.Logger) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			if err := file.Rotate(); err != nil {
+				level.Error(logger).Log("msg", "failed to rotate log file", "err", err)
+				continue
+			}
+			level.Info(logger).Log("msg", "rotated log file")
+		}
+	}
+}
+
+func newClient(cfg *config, logger log.Logger, extra ...mb8600.Option) (*mb8600.MotoClient, error) {
+	opts, err := cfg.modem().ClientOptions()
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts,
+		mb8600.WithTimeouts(mb8600.Timeouts{
+			Dial:           cfg.DialTimeout,
+			TLSHandshake:   cfg.TLSHandshakeTimeout,
+			ResponseHeader: cfg.ResponseHeaderTimeout,
+			Overall:        cfg.Timeout,
+		}),
+		mb8600.WithHNAPPath(cfg.HNAPPath),
+		mb8600.WithSessionTTL(cfg.SessionTTL),
+		mb8600.WithEncoding(cfg.HNAPEncoding),
+		mb8600.WithLoginRateLimit(cfg.LoginInterval),
+		mb8600.WithLoginLockout(cfg.LoginMaxFailures, cfg.LoginLockout),
+	)
+	if cfg.UserAgent != "" {
+		opts = append(opts, mb8600.WithUserAgent(cfg.UserAgent))
+	}
+	for name, value := range cfg.Headers {
+		opts = append(opts, mb8600.WithHeader(name, value))
+	}
+	if cfg.SOAPNamespace != "" {
+		opts = append(opts, mb8600.WithSOAPNamespace(cfg.SOAPNamespace))
+	}
+
+	opts = append(opts, extra...)
+	client := mb8600.NewMotoClient(cfg.Address, cfg.Username, cfg.Password, kitlog.New(logger), opts...)
+	return client, client.Err()
+}
+
+// Serves handler on addr until ctx is cancelled. Returns once the server has
+// shut down, with an error if it failed on its own.
+func serve(ctx context.Context, addr string, handler http.Handler, logger log.Logger) error {
+	server := &http.Server{Addr: addr, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+
+	// Shuts the server down when ctx is cancelled, or exits when the server
+	// fails on its own.
+	stopped := make(chan struct{})
+	shutdown := make(chan struct{})
+	go func() {
+		defer close(shutdown)
+		select {
+		case <-ctx.Done():
+		case <-stopped:
+			return
+		}
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	level.Info(logger).Log("msg", "listening", "address", addr)
+	err := server.ListenAndServe()
+	close(stopped)
+	<-shutdown
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return fmt.Errorf("HTTP server failed: %w", err)
+}
+
+// Serves the supervision status of the daemon's tasks as JSON, with status
+// 503 if any of them is failing.
+func supervisionHandler(group *supervisor.Group) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if !group.Healthy() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(group.Statuses())
+	})
+}
+
+// Serves the management plane health of the modem, see
+// mb8600.ManagementHealth.
+func managementHandler(monitor *mb8600.ManagementMonitor) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(monitor.Health())
+	})
+}
+
+// Calls each handler with every new snapshot of poller and the snapshot
+// before it, checking every interval.
+func watchSnapshots(ctx context.Context, poller *mb8600.Poller, interval time.Duration, handlers ...func(prev, curr *mb8600.Snapshot)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var prev *mb8600.Snapshot
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		curr := poller.Last()
+		if curr == nil || curr == prev {
+			continue
+		}
+		for _, handler := range handlers {
+			handler(prev, curr)
+		}
+		prev = curr
+	}
+}
+
+// Returns a snapshot handler that fires trigger when channel health,
+// evaluated with thresholds, degrades.
+func captureHandler(ctx context.Context, trigger *health.CommandTrigger, thresholds health.Thresholds, logger log.Logger) func(prev, curr *mb8600.Snapshot) {
+	return func(prev, curr *mb8600.Snapshot) {
+		report := health.Evaluate(curr, prev, thresholds)
+		fired, err := trigger.Fire(ctx, report, curr.Time)
+		if err != nil {
+			level.Error(logger).Log("msg", "capture trigger failed", "err", err)
+		} else if fired {
+			level.Info(logger).Log("msg", "ran capture command", "status", report.Status, "score", report.Score)
+		}
+	}
+}
+
+// Returns a snapshot handler that notifies of the alerts detected by
+// notifier.
+func notifyHandler(ctx context.Context, notifier *notify.Notifier, logger log.Logger) func(prev, curr *mb8600.Snapshot) {
+	return func(prev, curr *mb8600.Snapshot) {
+		alerts, err := notifier.Notify(ctx, prev, curr)
+		if err != nil {
+			level.Error(logger).Log("msg", "unable to send alerts", "err", err)
+		}
+		for _, alert := range alerts {
+			level.Info(logger).Log("msg", "sent alert", "kind", alert.Kind, "alert", alert.Message)
+		}
+	}
+}
+
+// Returns a snapshot handler that records channel history in tracker, saving
+// it to stateFile, compressed with codec, if it is not empty.
+func trackerHandler(tracker *mb8600.ChannelTracker, stateFile, codec string, logger log.Logger) func(prev, curr *mb8600.Snapshot) {
+	return func(prev, curr *mb8600.Snapshot) {
+		tracker.Observe(curr)
+		if stateFile == "" {
+			return
+		}
+		if err := saveTracker(tracker, stateFile, codec); err != nil {
+			level.Error(logger).Log("msg", "unable to save channel history", "file", stateFile, "err", err)
+		}
+	}
+}
+
+// Returns a snapshot handler that publishes snapshots to the MQTT broker for
+// Home Assistant, and a function closing the connection. The bridge is set up
+// on the first snapshot, once the modem's identity can be queried.
+func mqttHandler(cfg *config, client *mb8600.MotoClient, logger log.Logger) (func(prev, curr *mb8600.Snapshot), func()) {
+	var (
+		publisher *mqtt.Client
+		bridge    *mqtt.Bridge
+	)
+
+	handler := func(prev, curr *mb8600.Snapshot) {
+		if bridge == nil {
+			software, err := client.GetSoftwareStatus()
+			if err != nil {
+				level.Error(logger).Log("msg", "unable to identify modem for MQTT", "err", err)
+				return
+			}
+			nodeID := mqtt.NodeID(software)
+			availability := mqtt.AvailabilityTopic(mqtt.DefaultTopicPrefix, nodeID)
+			publisher = mqtt.NewClient(cfg.MQTTAddress, mqtt.ClientOptions{
+				ClientID:  "mb8600d-" + nodeID,
+				Username:  cfg.MQTTUsername,
+				Password:  cfg.MQTTPassword,
+				KeepAlive: time.Minute,
+				Will:      &mqtt.Message{Topic: availability, Payload: []byte(mqtt.PayloadOffline), Retain: true},
+				Birth:     &mqtt.Message{Topic: availability, Payload: []byte(mqtt.PayloadOnline), Retain: true},
+			})
+			bridge = mqtt.NewBridge(publisher, software)
+			bridge.DiscoveryPrefix = cfg.MQTTDiscovery
+		}
+
+		if err := bridge.Publish(curr); err != nil {
+			level.Error(logger).Log("msg", "unable to publish to MQTT", "address", cfg.MQTTAddress, "err", err)
+		}
+	}
+	closer := func() {
+		if publisher != nil {
+			publisher.Close()
+		}
+	}
+	return handler, closer
+}
+
+// Returns a tracker with the state saved in stateFile, or an empty tracker
+// if the file does not exist. The file is decompressed if it was saved
+// compressed.
+func loadTracker(stateFile string) (*mb8600.ChannelTracker, error) {
+	tracker := mb8600.NewChannelTracker()
+	if stateFile == "" {
+		return tracker, nil
+	}
+
+	data, err := os.ReadFile(stateFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return tracker, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if data, err = compression.Decompress(data); err != nil {
+		return nil, fmt.Errorf("invalid channel history in %s: %w", stateFile, err)
+	}
+
+	if err := json.Unmarshal(data, tracker); err != nil {
+		return nil, fmt.Errorf("invalid channel history in %s: %w", stateFile, err)
+	}
+	return tracker, nil
+}
+
+func saveTracker(tracker *mb8600.ChannelTracker, stateFile, codec string) error {
+	data, err := json.Marshal(tracker)
+	if err != nil {
+		return err
+	}
+	if data, err = compression.Compress(data, codec); err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(stateFile, data, 0600)
+}
+
+// Serves the channel history as JSON. The since query parameter, an RFC 3339
+// time, limits the response to channels last seen locked before it.
+func channelsHandler(tracker *mb8600.ChannelTracker) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		channels := tracker.Channels()
+		if since := r.URL.Query().Get("since"); since != "" {
+			t, err := time.Parse(time.RFC3339, since)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			channels = tracker.LostSince(t)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(channels)
+	})
+}
+
+func run(ctx context.Context, cfg *config, logger log.Logger) error {
+	if cfg.Simulate != "" {
+		sim := startSimulation(cfg.Simulate, cfg.Username, cfg.Password, cfg.PollInterval)
+		defer sim.Close()
+		simulated := *cfg
+		simulated.Address = sim.Address()
+		cfg = &simulated
+		level.Warn(logger).Log("msg", "polling a simulated modem", "scenario", cfg.Simulate)
+	}
+
+	monitor := mb8600.NewManagementMonitor(time.Hour)
+	client, err := newClient(cfg, logger, mb8600.WithRequestHooks(monitor.Hooks()))
+	if err != nil {
+		return err
+	}
+
+	tracker, err := loadTracker(cfg.StateFile)
+	if err != nil {
+		return err
+	}
+
+	auth, err := newAuthenticator(cfg)
+	if err != nil {
+		return err
+	}
+
+	var store *history.Store
+	if cfg.HistoryFile != "" {
+		if store, err = history.Open(cfg.HistoryFile, history.WithCompression(cfg.StateCompression)); err != nil {
+			return err
+		}
+		// Deferred first, so it runs once the poller has stopped appending.
+		defer func() {
+			if err := store.Close(); err != nil {
+				level.Error(logger).Log("msg", "unable to close history", "file", cfg.HistoryFile, "err", err)
+			}
+		}()
+	}
+
+	// Every goroutine started below derives from ctx and is waited for
+	// before returning, so nothing outlives run. Tasks other than the poller
+	// are supervised, so a failing handler or server is restarted without
+	// stopping the polling.
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	group := supervisor.NewGroup(supervisor.DefaultPolicy(), kitlog.New(logger))
+	closeMQTT := func() {}
+	defer func() {
+		cancel()
+		wg.Wait()
+		group.Wait()
+		closeMQTT()
+		client.CloseIdleConnections()
+	}()
+
+	poller := mb8600.NewPoller(client, cfg.PollInterval, kitlog.New(logger))
+	// Snapshots polled on scrape are as old as the time between scrapes, so
+	// their age says nothing about the daemon's health.
+	maxAge := staleIntervals * cfg.PollInterval
+	if cfg.Collection == collectOnScrape {
+		poller.PollOnDemand()
+		maxAge = 0
+	}
+	if store != nil {
+		poller.RecordTo(store)
+	}
+	var detector *anomaly.Detector
+	if cfg.Anomalies {
+		detector = anomaly.NewDetector(anomaly.Config{Method: cfg.AnomalyMethod})
+		poller.ObserveWith(detector)
+	}
+	done := make(chan error, 1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		done <- poller.Run(ctx)
+	}()
+
+	handlers := []func(prev, curr *mb8600.Snapshot){trackerHandler(tracker, cfg.StateFile, cfg.StateCompression, logger)}
+	if len(cfg.CaptureCommand) > 0 {
+		trigger := health.NewCommandTrigger(cfg.CaptureCommand, cfg.CaptureCooldown)
+		trigger.Timeout = cfg.CaptureTimeout
+		trigger.Env = commandEnv(os.Environ())
+		handlers = append(handlers, captureHandler(ctx, trigger, cfg.Thresholds, logger))
+	}
+	if len(cfg.PostPollCommand) > 0 {
+		hook := &pollHook{command: cfg.PostPollCommand, timeout: cfg.PostPollTimeout, thresholds: cfg.Thresholds}
+		handlers = append(handlers, pollHookHandler(ctx, hook, logger))
+	}
+	if cfg.WebhookURL != "" {
+		notifier := notify.NewNotifier(notify.NewWebhook(cfg.WebhookURL, cfg.WebhookFormat))
+		notifier.MinInterval = cfg.WebhookMinInterval
+		notifier.Thresholds = cfg.Thresholds
+		handlers = append(handlers, notifyHandler(ctx, notifier, logger))
+	}
+	if cfg.MQTTAddress != "" {
+		var handler func(prev, curr *mb8600.Snapshot)
+		handler, closeMQTT = mqttHandler(cfg, client, logger)
+		handlers = append(handlers, handler)
+	}
+	group.Go(ctx, "snapshots", func(ctx context.Context) error {
+		return watchSnapshots(ctx, poller, cfg.PollInterval, handlers...)
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("/channels", channelsHandler(tracker))
+	mux.Handle("/supervision", supervisionHandler(group))
+	mux.Handle("/management", managementHandler(monitor))
+	mux.Handle("/metrics", metricsHandler(poller, monitor, detector, cfg.Collection, maxAge, cfg.Thresholds))
+	mux.Handle("/status.json", statusHandler(poller, monitor, maxAge, cfg.Thresholds))
+	if store != nil {
+		mux.Handle("/history/errors", historyErrorsHandler(store))
+		mux.Handle("/history/gaps", historyGapsHandler(store, staleIntervals*cfg.PollInterval))
+		mux.Handle("/history/incidents", historyIncidentsHandler(store, client.GetLogs))
+	}
+	if cfg.GraphQL {
+		mux.Handle("/graphql", graphql.Handler(func() any { return poller.Last() }))
+	}
+	// The liveness check reveals nothing about the modem and is served
+	// without authentication, so probes need no token.
+	root := http.NewServeMux()
+	root.Handle("/healthz", healthzHandler(poller, maxAge))
+	root.Handle("/", auth.wrap(mux))
+	group.Go(ctx, "http", func(ctx context.Context) error {
+		return serve(ctx, cfg.ListenAddress, root, logger)
+	})
+
+	level.Info(logger).Log("msg", "polling modem", "address", cfg.Address, "interval", cfg.PollInterval, "collection", cfg.Collection)
+	for event := range poller.Events() {
+		level.Info(logger).Log(
+			"msg", "modem event",
+			"type", event.Type,
+			"direction", event.Direction,
+			"channel_id", event.ChannelID,
+			"previous", event.Previous,
+			"current", event.Current,
+			"previous_state", event.PreviousState,
+			"current_state", event.CurrentState,
+			"metric", event.Metric,
+			"score", event.Score,
+			"err", event.Err,
+		)
+	}
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
+
+func main() {
+	cfg, err := loadConfig(os.Args[1:], os.Getenv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	var logWriter io.Writer = os.Stderr
+	var logFile *lumberjack.Logger
+	if cfg.LogFile != "" {
+		logFile, err = newLogFile(cfg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		defer logFile.Close()
+		logWriter = io.MultiWriter(os.Stderr, logFile)
+	}
+
+	logger, err := newLogger(cfg.LogLevel, cfg.LogFormat, logWriter)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if logFile != nil {
+		go rotateOnHangup(ctx, logFile, logger)
+	}
+
+	if err := run(ctx, cfg, logger); err != nil {
+		level.Error(logger).Log("msg", "daemon failed", "err", err)
+		os.Exit(1)
+	}
+	level.Info(logger).Log("msg", "shut down")
+}
@@ -0,0 +1,228 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/thelande/mb8600/pkg/compression"
+	"github.com/thelande/mb8600/pkg/mb8600"
+	"github.com/thelande/mb8600/pkg/mb8600test"
+	"github.com/thelande/mb8600/pkg/supervisor"
+	"go.uber.org/goleak"
+)
+
+func TestTracker(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "channels.json")
+	start := time.Date(2023, 12, 23, 20, 0, 0, 0, time.UTC)
+
+	tracker, err := loadTracker(stateFile)
+	if err != nil {
+		t.Fatalf("loadTracker() error = %v", err)
+	}
+
+	handle := trackerHandler(tracker, stateFile, compression.None, log.NewNopLogger())
+	first := &mb8600.Snapshot{Time: start, Downstream: []*mb8600.DownstreamChannel{
+		{ChannelID: 1, Frequency: 531, LockStatus: "Locked"},
+		{ChannelID: 2, Frequency: 537, LockStatus: "Locked"},
+	}}
+	handle(nil, first)
+	handle(first, &mb8600.Snapshot{Time: start.Add(time.Hour), Downstream: []*mb8600.DownstreamChannel{
+		{ChannelID: 1, Frequency: 531, LockStatus: "Locked"},
+	}})
+
+	restored, err := loadTracker(stateFile)
+	if err != nil {
+		t.Fatalf("loadTracker() error = %v", err)
+	}
+	if got := len(restored.Channels()); got != 2 {
+		t.Fatalf("len(loadTracker().Channels()) = %v, want 2", got)
+	}
+
+	tests := []struct {
+		query      string
+		wantStatus int
+		wantLen    int
+	}{
+		{"", http.StatusOK, 2},
+		{"?since=2023-12-23T20:30:00Z", http.StatusOK, 1},
+		{"?since=yesterday", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			channelsHandler(restored).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/channels"+tt.query, nil))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %v, want %v", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var channels []mb8600.ChannelHistory
+			if err := json.Unmarshal(w.Body.Bytes(), &channels); err != nil {
+				t.Fatalf("json.Unmarshal() error = %v", err)
+			}
+			if len(channels) != tt.wantLen {
+				t.Errorf("len(channels) = %v, want %v", len(channels), tt.wantLen)
+			}
+		})
+	}
+}
+
+func TestTracker_compressed(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "channels.json.gz")
+	handle := trackerHandler(mb8600.NewChannelTracker(), stateFile, compression.Gzip, log.NewNopLogger())
+	handle(nil, &mb8600.Snapshot{Time: time.Date(2023, 12, 23, 20, 0, 0, 0, time.UTC), Downstream: []*mb8600.DownstreamChannel{
+		{ChannelID: 1, Frequency: 531, LockStatus: "Locked"},
+	}})
+
+	data, err := os.ReadFile(stateFile)
+	if err != nil {
+		t.Fatalf("os.ReadFile() error = %v", err)
+	}
+	if !bytes.HasPrefix(data, []byte{0x1f, 0x8b}) {
+		t.Errorf("state file = %q, want gzip data", data)
+	}
+
+	restored, err := loadTracker(stateFile)
+	if err != nil {
+		t.Fatalf("loadTracker() error = %v", err)
+	}
+	if got := len(restored.Channels()); got != 1 {
+		t.Errorf("len(loadTracker().Channels()) = %v, want 1", got)
+	}
+}
+
+func TestRun(t *testing.T) {
+	ignore := goleak.IgnoreCurrent()
+	t.Cleanup(func() { goleak.VerifyNone(t, ignore) })
+
+	server := mb8600test.NewServer(mb8600test.NewModem("admin", "motorola"))
+	defer server.Close()
+
+	cfg, err := loadConfig([]string{
+		"-address", mb8600test.Address(server),
+		"-password", "motorola",
+		"-poll-interval", "10ms",
+		"-listen-address", "127.0.0.1:0",
+		"-graphql",
+		"-history-file", filepath.Join(t.TempDir(), "history.jsonl"),
+	}, func(string) string { return "" })
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer time.AfterFunc(200*time.Millisecond, cancel).Stop()
+	if err := run(ctx, cfg, log.NewNopLogger()); err != nil {
+		t.Errorf("run() error = %v", err)
+	}
+}
+
+func TestRun_simulate(t *testing.T) {
+	ignore := goleak.IgnoreCurrent()
+	t.Cleanup(func() { goleak.VerifyNone(t, ignore) })
+
+	cfg, err := loadConfig([]string{
+		"-simulate", "flapping",
+		"-poll-interval", "10ms",
+		"-listen-address", "127.0.0.1:0",
+	}, func(string) string { return "" })
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer time.AfterFunc(200*time.Millisecond, cancel).Stop()
+	if err := run(ctx, cfg, log.NewNopLogger()); err != nil {
+		t.Errorf("run() error = %v", err)
+	}
+}
+
+func TestSupervisionHandler(t *testing.T) {
+	ignore := goleak.IgnoreCurrent()
+	t.Cleanup(func() { goleak.VerifyNone(t, ignore) })
+	group := supervisor.NewGroup(supervisor.Policy{MaxRestarts: 1}, nil)
+	group.Go(context.Background(), "broken", func(ctx context.Context) error { return errors.New("bind: address in use") })
+	group.Wait()
+
+	rec := httptest.NewRecorder()
+	supervisionHandler(group).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/supervision", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	var statuses []supervisor.Status
+	if err := json.Unmarshal(rec.Body.Bytes(), &statuses); err != nil || len(statuses) != 1 || statuses[0].State != supervisor.StateFailed {
+		t.Errorf("body = %s, want a failed task", rec.Body.String())
+	}
+}
+
+func TestManagementHandler(t *testing.T) {
+	monitor := mb8600.NewManagementMonitor(time.Hour)
+	hooks := monitor.Hooks()
+	hooks.OnRequestDone(mb8600.RequestInfo{Action: "Login", Start: time.Now(), Duration: time.Second, StatusCode: http.StatusOK})
+
+	rec := httptest.NewRecorder()
+	managementHandler(monitor).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/management", nil))
+	var health mb8600.ManagementHealth
+	if err := json.Unmarshal(rec.Body.Bytes(), &health); err != nil || health.Requests != 1 || health.Score != 1 {
+		t.Errorf("body = %s, want one healthy request", rec.Body.String())
+	}
+}
+
+func TestNewLogFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mb8600d.log")
+	cfg := &config{LogFile: path, LogFileMaxSize: 10, LogFileMaxAge: 36 * time.Hour, LogFileMaxBackups: 3}
+	logFile, err := newLogFile(cfg)
+	if err != nil {
+		t.Fatalf("newLogFile() error = %v", err)
+	}
+	defer logFile.Close()
+	if logFile.MaxSize != 10 || logFile.MaxAge != 2 || logFile.MaxBackups != 3 {
+		t.Errorf("newLogFile() = %+v, want a max size of 10, age of 2 days and 3 backups", logFile)
+	}
+
+	logFile.Write([]byte("before\n"))
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := logFile.Rotate(); err != nil {
+		t.Fatalf("Logger.Rotate() error = %v", err)
+	}
+	logFile.Write([]byte("after\n"))
+	for name, want := range map[string]string{path: "after\n", path + ".1": "before\n"} {
+		if data, err := os.ReadFile(name); err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v, want %q", filepath.Base(name), data, err, want)
+		}
+	}
+
+	cfg.LogFile = filepath.Join(t.TempDir(), "missing", "mb8600d.log")
+	if _, err := newLogFile(cfg); err == nil {
+		t.Errorf("newLogFile() error = nil for a missing directory, want error")
+	}
+}
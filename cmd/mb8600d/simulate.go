@@ -0,0 +1,72 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/mb8600test"
+	"github.com/thelande/mb8600/pkg/simdgen"
+)
+
+// A fake modem serving data generated for a scenario, for demos without a
+// modem.
+type simulation struct {
+	server *httptest.Server
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Starts a fake modem accepting username and password that serves data
+// generated for scenario, advancing by one snapshot every interval.
+func startSimulation(scenario simdgen.Scenario, username, password string, interval time.Duration) *simulation {
+	modem := mb8600test.NewModem(username, password)
+	gen := simdgen.New(simdgen.Config{Scenario: scenario, Interval: interval, Seed: time.Now().UnixNano()})
+	gen.Apply(modem)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &simulation{server: mb8600test.NewServer(modem), cancel: cancel}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				gen.Apply(modem)
+			}
+		}
+	}()
+	return s
+}
+
+// Returns the address of the fake modem.
+func (s *simulation) Address() string {
+	return mb8600test.Address(s.server)
+}
+
+// Stops the fake modem.
+func (s *simulation) Close() {
+	s.cancel()
+	s.wg.Wait()
+	s.server.Close()
+}
@@ -0,0 +1,282 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/anomaly"
+	"github.com/thelande/mb8600/pkg/health"
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+// The number of poll intervals without a successful poll after which
+// /healthz reports the daemon unhealthy.
+const staleIntervals = 3
+
+// When the modem is polled for /metrics.
+const (
+	// Every poll interval, serving scrapes the latest poll: fast scrapes and
+	// a bounded load on the modem.
+	collectBackground = "background"
+	// Whenever /metrics is scraped: fresh data, at the cost of scrape latency.
+	collectOnScrape = "scrape"
+)
+
+// The body of /status.json.
+type daemonStatus struct {
+	// The time of the latest successful poll, null before the first one.
+	Time         *time.Time              `json:"time"`
+	Healthy      bool                    `json:"healthy"`
+	Connectivity string                  `json:"connectivity,omitempty"`
+	Health       *healthSummary          `json:"health,omitempty"`
+	Management   mb8600.ManagementHealth `json:"management"`
+	Snapshot     *mb8600.Snapshot        `json:"snapshot,omitempty"`
+}
+
+type healthSummary struct {
+	Status string  `json:"status"`
+	Score  float64 `json:"score"`
+}
+
+// Returns true if last, the latest snapshot of poller, is no older than
+// maxAge at now. Without a maxAge, when collecting on scrape, snapshots age
+// between scrapes, so the latest poll need only have succeeded.
+func fresh(poller *mb8600.Poller, last *mb8600.Snapshot, maxAge time.Duration, now time.Time) bool {
+	if last == nil {
+		return false
+	}
+	if maxAge == 0 {
+		return poller.Err() == nil
+	}
+	return now.Sub(last.Time) <= maxAge
+}
+
+// Serves the latest snapshot of poller with its channel and management
+// health as JSON, healthy if it is fresh within maxAge. Channel health is
+// evaluated with thresholds.
+func statusHandler(poller *mb8600.Poller, monitor *mb8600.ManagementMonitor, maxAge time.Duration, thresholds health.Thresholds) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		last := poller.Last()
+		status := daemonStatus{
+			Healthy:      fresh(poller, last, maxAge, time.Now()),
+			Connectivity: poller.ConnectivityState(),
+			Management:   monitor.Health(),
+			Snapshot:     last,
+		}
+		if last != nil {
+			status.Time = &last.Time
+			report := health.Evaluate(last, nil, thresholds)
+			status.Health = &healthSummary{Status: report.Status.String(), Score: report.Score}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	})
+}
+
+// Serves a liveness check for container orchestrators: status 200 while the
+// latest snapshot of poller is fresh within maxAge, 503 otherwise.
+func healthzHandler(poller *mb8600.Poller, maxAge time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		last := poller.Last()
+		if !fresh(poller, last, maxAge, time.Now()) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			if last == nil {
+				io.WriteString(w, "no successful poll yet\n")
+			} else {
+				fmt.Fprintf(w, "last successful poll at %s\n", last.Time.UTC().Format(time.RFC3339))
+			}
+			return
+		}
+		io.WriteString(w, "ok\n")
+	})
+}
+
+// Serves a snapshot of poller and the management health in the Prometheus
+// text exposition format: the latest snapshot, or with collectOnScrape one
+// polled for the scrape. The modem is reported down if the latest poll failed
+// or the snapshot is older than maxAge. The anomaly scores of detector are
+// included unless it is nil.
+func metricsHandler(poller *mb8600.Poller, monitor *mb8600.ManagementMonitor, detector *anomaly.Detector, collection string, maxAge time.Duration, thresholds health.Thresholds) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		snapshot := poller.Last()
+		if collection == collectOnScrape {
+			snapshot, _ = poller.Refresh(r.Context())
+		}
+		up := fresh(poller, snapshot, maxAge, time.Now()) && poller.Err() == nil
+		var scores []anomaly.Score
+		if detector != nil {
+			scores = detector.Scores()
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetrics(w, snapshot, up, scores, monitor.Health(), thresholds)
+	})
+}
+
+// A metric family in the text exposition format.
+type metricFamily struct {
+	name, help, kind string
+	samples          []metricSample
+}
+
+type metricSample struct {
+	labels []string // alternating names and values
+	value  float64
+}
+
+func (f *metricFamily) add(value float64, labels ...string) {
+	f.samples = append(f.samples, metricSample{labels: labels, value: value})
+}
+
+func (f *metricFamily) writeTo(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+	for _, s := range f.samples {
+		io.WriteString(w, f.name)
+		if len(s.labels) > 0 {
+			pairs := make([]string, 0, len(s.labels)/2)
+			for i := 0; i+1 < len(s.labels); i += 2 {
+				pairs = append(pairs, s.labels[i]+"="+strconv.Quote(s.labels[i+1]))
+			}
+			io.WriteString(w, "{"+strings.Join(pairs, ",")+"}")
+		}
+		io.WriteString(w, " "+strconv.FormatFloat(s.value, 'g', -1, 64)+"\n")
+	}
+}
+
+func gauge(name, help string) *metricFamily {
+	return &metricFamily{name: "mb8600_" + name, help: help, kind: "gauge"}
+}
+
+func counter(name, help string) *metricFamily {
+	return &metricFamily{name: "mb8600_" + name, help: help, kind: "counter"}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Writes the metrics of snapshot, which may be nil before the first
+// successful poll, and of the management health to w, evaluating channel
+// health with thresholds, along with the anomaly scores of its channels.
+// Unless the modem is up, only the time of snapshot is written, as its
+// channels are out of date.
+func writeMetrics(w io.Writer, snapshot *mb8600.Snapshot, up bool, scores []anomaly.Score, management mb8600.ManagementHealth, thresholds health.Thresholds) {
+	upGauge := gauge("up", "Whether the latest poll of the modem succeeded and is recent.")
+	upGauge.add(boolValue(up && snapshot != nil))
+	families := []*metricFamily{upGauge}
+
+	if snapshot != nil {
+		lastPoll := gauge("last_poll_timestamp_seconds", "The time of the latest successful poll.")
+		lastPoll.add(float64(snapshot.Time.UnixNano()) / 1e9)
+		families = append(families, lastPoll)
+	}
+
+	if snapshot != nil && up {
+
+		dsLocked := gauge("downstream_locked", "Whether the downstream channel is locked.")
+		dsFrequency := gauge("downstream_frequency_mhz", "The center frequency of the downstream channel.")
+		dsPower := gauge("downstream_power_dbmv", "The received power of the downstream channel.")
+		dsSNR := gauge("downstream_snr_db", "The signal-to-noise ratio of the downstream channel.")
+		dsCorrected := counter("downstream_corrected_total", "The corrected codewords of the downstream channel since the modem booted.")
+		dsUncorrected := counter("downstream_uncorrected_total", "The uncorrected codewords of the downstream channel since the modem booted.")
+		// The snapshot is shared with the other handlers, so its channels
+		// are sorted in copies.
+		downstream := append([]*mb8600.DownstreamChannel(nil), snapshot.Downstream...)
+		mb8600.SortDownstreamByChannelID(downstream)
+		for _, ch := range downstream {
+			labels := []string{"channel_id", strconv.Itoa(ch.ChannelID), "modulation", ch.Modulation}
+			dsLocked.add(boolValue(ch.LockStatus == "Locked"), labels...)
+			dsFrequency.add(ch.Frequency, labels...)
+			dsPower.add(ch.Power, labels...)
+			dsSNR.add(ch.SignalToNoise, labels...)
+			dsCorrected.add(ch.CorrectedErrors, labels...)
+			dsUncorrected.add(ch.UncorrectedErrors, labels...)
+		}
+
+		usLocked := gauge("upstream_locked", "Whether the upstream channel is locked.")
+		usFrequency := gauge("upstream_frequency_mhz", "The center frequency of the upstream channel.")
+		usPower := gauge("upstream_power_dbmv", "The transmit power of the upstream channel.")
+		usSymbolRate := gauge("upstream_symbol_rate_ksyms", "The symbol rate of the upstream channel.")
+		upstream := append([]*mb8600.UpstreamChannel(nil), snapshot.Upstream...)
+		mb8600.SortUpstreamByChannelID(upstream)
+		for _, ch := range upstream {
+			labels := []string{"channel_id", strconv.Itoa(ch.ChannelID), "channel_type", ch.ChannelType}
+			usLocked.add(boolValue(ch.LockStatus == "Locked"), labels...)
+			usFrequency.add(ch.Frequency, labels...)
+			usPower.add(ch.Power, labels...)
+			usSymbolRate.add(ch.SymbolRate, labels...)
+		}
+
+		dsLockedCount := gauge("downstream_locked_channels", "The number of locked downstream channels.")
+		dsLockedCount.add(float64(len(mb8600.FilterLockedDownstream(downstream))))
+		usLockedCount := gauge("upstream_locked_channels", "The number of locked upstream channels.")
+		usLockedCount.add(float64(snapshot.LockedUpstreamChannels()))
+
+		if partial := snapshot.PartialService; partial != nil {
+			partialService := gauge("partial_service", "Whether the modem flags partial service in the direction.")
+			partialService.add(boolValue(partial.Downstream), "direction", mb8600.DirectionDownstream)
+			partialService.add(boolValue(partial.Upstream), "direction", mb8600.DirectionUpstream)
+			families = append(families, partialService)
+		}
+
+		report := health.Evaluate(snapshot, nil, thresholds)
+		healthScore := gauge("health_score", "The percentage of channels with an OK status.")
+		healthScore.add(report.Score)
+
+		if len(scores) > 0 {
+			anomalyScore := gauge("channel_anomaly_score", "How far the latest value of the channel metric is from its recent values, in deviations.")
+			for _, score := range scores {
+				anomalyScore.add(score.Score, "metric", string(score.Metric), "channel_id", strconv.Itoa(score.ChannelID))
+			}
+			families = append(families, anomalyScore)
+		}
+
+		families = append(families,
+			dsLocked, dsFrequency, dsPower, dsSNR, dsCorrected, dsUncorrected,
+			usLocked, usFrequency, usPower, usSymbolRate,
+			dsLockedCount, usLockedCount, healthScore,
+		)
+	}
+
+	mgmtRequests := gauge("management_requests", "The requests to the modem within the management health window.")
+	mgmtRequests.add(float64(management.Requests))
+	mgmtErrors := gauge("management_error_rate", "The fraction of requests to the modem failing within the window.")
+	mgmtErrors.add(management.ErrorRate)
+	mgmtLatency := gauge("management_latency_ratio", "The recent request latency relative to the long-term baseline.")
+	mgmtLatency.add(management.LatencyRatio)
+	mgmtLogins := gauge("management_logins_per_hour", "The login exchanges within the window, scaled to an hour.")
+	mgmtLogins.add(management.LoginsPerHour)
+	mgmtScore := gauge("management_score", "The composite management plane health from 0 to 1.")
+	mgmtScore.add(management.Score)
+	families = append(families, mgmtRequests, mgmtErrors, mgmtLatency, mgmtLogins, mgmtScore)
+
+	sort.SliceStable(families, func(i, j int) bool { return families[i].name < families[j].name })
+	for _, f := range families {
+		f.writeTo(w)
+	}
+}
@@ -0,0 +1,255 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/anomaly"
+	"github.com/thelande/mb8600/pkg/health"
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+type stubPollerClient struct {
+	downstream []*mb8600.DownstreamChannel
+	upstream   []*mb8600.UpstreamChannel
+	err        error
+}
+
+func (c *stubPollerClient) Login() (map[string]string, error) { return nil, nil }
+
+func (c *stubPollerClient) GetDownstreamChannels() ([]*mb8600.DownstreamChannel, error) {
+	return c.downstream, c.err
+}
+
+func (c *stubPollerClient) GetUpstreamChannels() ([]*mb8600.UpstreamChannel, error) {
+	return c.upstream, c.err
+}
+
+// Returns a poller that has polled the stub channels once.
+func polledPoller(t *testing.T) *mb8600.Poller {
+	t.Helper()
+	poller := mb8600.NewPoller(&stubPollerClient{
+		downstream: []*mb8600.DownstreamChannel{
+			{ChannelID: 2, LockStatus: "Locked", Modulation: "QAM256", Frequency: 537, Power: 1.5, SignalToNoise: 40, CorrectedErrors: 12},
+			{ChannelID: 1, LockStatus: "Locked", Modulation: "QAM256", Frequency: 531, Power: 2, SignalToNoise: 39.5},
+		},
+		upstream: []*mb8600.UpstreamChannel{
+			{ChannelID: 1, LockStatus: "Locked", ChannelType: "SC-QAM", Frequency: 35.6, Power: 44, SymbolRate: 5120},
+		},
+	}, time.Minute, nil)
+	if _, err := poller.Poll(); err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+	return poller
+}
+
+func TestMetricsHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	metricsHandler(polledPoller(t), mb8600.NewManagementMonitor(time.Hour), nil, collectBackground, time.Minute, health.DefaultThresholds()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE mb8600_up gauge\nmb8600_up 1\n",
+		"# TYPE mb8600_downstream_corrected_total counter\n",
+		`mb8600_downstream_power_dbmv{channel_id="1",modulation="QAM256"} 2` + "\n" +
+			`mb8600_downstream_power_dbmv{channel_id="2",modulation="QAM256"} 1.5` + "\n",
+		`mb8600_upstream_symbol_rate_ksyms{channel_id="1",channel_type="SC-QAM"} 5120` + "\n",
+		"mb8600_downstream_locked_channels 2\n",
+		"mb8600_upstream_locked_channels 1\n",
+		"mb8600_health_score 100\n",
+		"mb8600_management_score 1\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body is missing %q:\n%s", want, body)
+		}
+	}
+}
+
+func TestWriteMetrics_partialService(t *testing.T) {
+	var b strings.Builder
+	writeMetrics(&b, &mb8600.Snapshot{PartialService: &mb8600.PartialService{Upstream: true}}, true, nil, mb8600.ManagementHealth{}, health.DefaultThresholds())
+	for _, want := range []string{
+		`mb8600_partial_service{direction="downstream"} 0` + "\n",
+		`mb8600_partial_service{direction="upstream"} 1` + "\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("metrics are missing %q:\n%s", want, b.String())
+		}
+	}
+}
+
+func TestWriteMetrics_anomalyScores(t *testing.T) {
+	scores := []anomaly.Score{{Metric: anomaly.MetricDownstreamSNR, ChannelID: 20, Score: -4.5}}
+	var b strings.Builder
+	writeMetrics(&b, &mb8600.Snapshot{}, true, scores, mb8600.ManagementHealth{}, health.DefaultThresholds())
+	if want := `mb8600_channel_anomaly_score{metric="downstream_snr",channel_id="20"} -4.5` + "\n"; !strings.Contains(b.String(), want) {
+		t.Errorf("metrics are missing %q:\n%s", want, b.String())
+	}
+
+	b.Reset()
+	writeMetrics(&b, &mb8600.Snapshot{}, false, scores, mb8600.ManagementHealth{}, health.DefaultThresholds())
+	if strings.Contains(b.String(), "anomaly") {
+		t.Errorf("metrics of a down modem include anomaly scores:\n%s", b.String())
+	}
+}
+
+func TestMetricsHandler_down(t *testing.T) {
+	client := &stubPollerClient{downstream: []*mb8600.DownstreamChannel{{ChannelID: 1, LockStatus: "Locked"}}}
+	failing := mb8600.NewPoller(client, time.Hour, nil)
+	if _, err := failing.Poll(); err != nil {
+		t.Fatalf("Poll() error = %v", err)
+	}
+	client.err = errors.New("connection refused")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- failing.Run(ctx) }()
+	go func() {
+		for range failing.Events() {
+		}
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	if _, err := failing.Refresh(ctx); err == nil {
+		t.Fatal("Refresh() error = nil, want the client error")
+	}
+
+	tests := []struct {
+		name   string
+		poller *mb8600.Poller
+		maxAge time.Duration
+	}{
+		{"stale", polledPoller(t), -time.Second},
+		{"failing", failing, time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			metricsHandler(tt.poller, mb8600.NewManagementMonitor(time.Hour), nil, collectBackground, tt.maxAge, health.DefaultThresholds()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+			body := rec.Body.String()
+			if !strings.Contains(body, "mb8600_up 0\n") || !strings.Contains(body, "mb8600_last_poll_timestamp_seconds") || strings.Contains(body, "mb8600_downstream") {
+				t.Errorf("body = %s, want mb8600_up 0 and the last poll time without channels", body)
+			}
+		})
+	}
+}
+
+func TestMetricsHandler_noPoll(t *testing.T) {
+	poller := mb8600.NewPoller(&stubPollerClient{}, time.Minute, nil)
+	rec := httptest.NewRecorder()
+	metricsHandler(poller, mb8600.NewManagementMonitor(time.Hour), nil, collectBackground, time.Minute, health.DefaultThresholds()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := rec.Body.String()
+	if !strings.Contains(body, "mb8600_up 0\n") || strings.Contains(body, "mb8600_downstream") {
+		t.Errorf("body = %s, want only mb8600_up 0 and management metrics", body)
+	}
+}
+
+func TestMetricsHandler_onScrape(t *testing.T) {
+	client := &stubPollerClient{downstream: []*mb8600.DownstreamChannel{{ChannelID: 1, LockStatus: "Locked"}}}
+	// A long interval, so only scrapes poll.
+	poller := mb8600.NewPoller(client, time.Hour, nil)
+	poller.PollOnDemand()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- poller.Run(ctx) }()
+	go func() {
+		for range poller.Events() {
+		}
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	handler := metricsHandler(poller, mb8600.NewManagementMonitor(time.Hour), nil, collectOnScrape, 0, health.DefaultThresholds())
+
+	scrape := func() string {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		return rec.Body.String()
+	}
+	if body := scrape(); !strings.Contains(body, "mb8600_up 1\n") || !strings.Contains(body, "mb8600_downstream_locked_channels 1\n") {
+		t.Errorf("body = %s, want a polled modem", body)
+	}
+
+	// The scrape polls again, so a channel lost since shows at once.
+	client.downstream = nil
+	if body := scrape(); !strings.Contains(body, "mb8600_downstream_locked_channels 0\n") {
+		t.Errorf("body = %s, want no locked channels", body)
+	}
+
+	// A failed poll reports the modem down rather than the stale snapshot.
+	client.err = errors.New("timeout")
+	if body := scrape(); !strings.Contains(body, "mb8600_up 0\n") {
+		t.Errorf("body = %s, want mb8600_up 0", body)
+	}
+	rec := httptest.NewRecorder()
+	healthzHandler(poller, 0).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("healthz status after failed poll = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	statusHandler(polledPoller(t), mb8600.NewManagementMonitor(time.Hour), staleIntervals*time.Minute, health.DefaultThresholds()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status.json", nil))
+
+	var status daemonStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("body = %s: %v", rec.Body.String(), err)
+	}
+	if !status.Healthy || status.Time == nil || status.Health == nil || status.Health.Status != "ok" {
+		t.Errorf("status = %+v, want a healthy poll", status)
+	}
+	if status.Snapshot == nil || len(status.Snapshot.Downstream) != 2 {
+		t.Errorf("snapshot = %+v, want two downstream channels", status.Snapshot)
+	}
+}
+
+func TestHealthzHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		poller *mb8600.Poller
+		maxAge time.Duration
+		want   int
+	}{
+		{"polled", polledPoller(t), time.Minute, http.StatusOK},
+		{"no poll", mb8600.NewPoller(&stubPollerClient{}, time.Minute, nil), time.Minute, http.StatusServiceUnavailable},
+		{"stale", polledPoller(t), -time.Second, http.StatusServiceUnavailable},
+		{"on scrape", polledPoller(t), 0, http.StatusOK},
+		{"on scrape, no poll", mb8600.NewPoller(&stubPollerClient{}, time.Minute, nil), 0, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			healthzHandler(tt.poller, tt.maxAge).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package anomaly flags statistically unusual changes in per-channel signal
+// levels, catching degradation that static thresholds miss.
+package anomaly
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+type Method int
+
+const (
+	// Rolling z-score against the window mean and standard deviation.
+	ZScore Method = iota
+	// Modified z-score against the window median and median absolute deviation,
+	// which is less sensitive to earlier outliers in the window.
+	MAD
+)
+
+type Metric string
+
+const (
+	MetricDownstreamSNR   Metric = "downstream_snr"
+	MetricDownstreamPower Metric = "downstream_power"
+	MetricUpstreamPower   Metric = "upstream_power"
+)
+
+const (
+	defaultWindow     = 30
+	defaultMinSamples = 10
+	defaultThreshold  = 3.5
+	defaultMinSpread  = 0.1
+)
+
+type Config struct {
+	Method Method
+	// Number of previous samples per channel used as the baseline.
+	Window int
+	// Number of samples required before a channel is evaluated.
+	MinSamples int
+	// Absolute score above which a sample is flagged.
+	Threshold float64
+	// Lower bound on the spread (standard deviation or MAD) so that very flat
+	// series don't flag insignificant changes.
+	MinSpread float64
+}
+
+// A statistically unusual sample.
+type Anomaly struct {
+	Time      time.Time
+	Metric    Metric
+	ChannelID int
+	Value     float64
+	Baseline  float64
+	Score     float64
+}
+
+// The most recent score of a channel metric, suitable for exporting.
+type Score struct {
+	Metric    Metric
+	ChannelID int
+	Score     float64
+}
+
+type seriesKey struct {
+	metric    Metric
+	channelID int
+}
+
+// Scores channel metrics against their recent values. It is safe for
+// concurrent use.
+type Detector struct {
+	config Config
+
+	mu     sync.Mutex
+	series map[seriesKey][]float64
+	scores map[seriesKey]float64
+}
+
+// Returns a new detector. Zero values in config are replaced by defaults.
+func NewDetector(config Config) *Detector {
+	if config.Window <= 0 {
+		config.Window = defaultWindow
+	}
+	if config.MinSamples <= 0 {
+		config.MinSamples = defaultMinSamples
+	}
+	if config.MinSamples > config.Window {
+		config.MinSamples = config.Window
+	}
+	if config.Threshold <= 0 {
+		config.Threshold = defaultThreshold
+	}
+	if config.MinSpread <= 0 {
+		config.MinSpread = defaultMinSpread
+	}
+
+	return &Detector{
+		config: config,
+		series: map[seriesKey][]float64{},
+		scores: map[seriesKey]float64{},
+	}
+}
+
+// Adds a snapshot of channel data taken at t and returns any anomalies found.
+//
+// Downstream SNR is only flagged when it drops, while power levels are flagged
+// when they move in either direction.
+func (d *Detector) Observe(t time.Time, downstream []*mb8600.DownstreamChannel, upstream []*mb8600.UpstreamChannel) []Anomaly {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var anomalies []Anomaly
+
+	for _, ch := range downstream {
+		if a, ok := d.observe(t, MetricDownstreamSNR, ch.ChannelID, ch.SignalToNoise, true); ok {
+			anomalies = append(anomalies, a)
+		}
+		if a, ok := d.observe(t, MetricDownstreamPower, ch.ChannelID, ch.Power, false); ok {
+			anomalies = append(anomalies, a)
+		}
+	}
+
+	for _, ch := range upstream {
+		if a, ok := d.observe(t, MetricUpstreamPower, ch.ChannelID, ch.Power, false); ok {
+			anomalies = append(anomalies, a)
+		}
+	}
+
+	return anomalies
+}
+
+// Observes the channels of snapshot and returns a ChannelAnomaly event for
+// each anomaly, so a Poller can feed the detector with ObserveWith.
+func (d *Detector) ObserveSnapshot(snapshot *mb8600.Snapshot) []mb8600.Event {
+	var events []mb8600.Event
+	for _, a := range d.Observe(snapshot.Time, snapshot.Downstream, snapshot.Upstream) {
+		direction := mb8600.DirectionDownstream
+		if a.Metric == MetricUpstreamPower {
+			direction = mb8600.DirectionUpstream
+		}
+		events = append(events, mb8600.Event{
+			Type:      mb8600.ChannelAnomaly,
+			Time:      a.Time,
+			Direction: direction,
+			ChannelID: a.ChannelID,
+			Previous:  a.Baseline,
+			Current:   a.Value,
+			Metric:    string(a.Metric),
+			Score:     a.Score,
+		})
+	}
+	return events
+}
+
+// Returns the most recent score of every evaluated channel metric.
+func (d *Detector) Scores() []Score {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	scores := make([]Score, 0, len(d.scores))
+	for key, score := range d.scores {
+		scores = append(scores, Score{Metric: key.metric, ChannelID: key.channelID, Score: score})
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		if scores[i].Metric != scores[j].Metric {
+			return scores[i].Metric < scores[j].Metric
+		}
+		return scores[i].ChannelID < scores[j].ChannelID
+	})
+	return scores
+}
+
+func (d *Detector) observe(t time.Time, metric Metric, channelID int, value float64, dropsOnly bool) (Anomaly, bool) {
+	key := seriesKey{metric, channelID}
+	window := d.series[key]
+
+	var (
+		anomaly Anomaly
+		flagged bool
+	)
+	if len(window) >= d.config.MinSamples {
+		baseline, score := d.score(window, value)
+		d.scores[key] = score
+
+		if (dropsOnly && score <= -d.config.Threshold) || (!dropsOnly && math.Abs(score) >= d.config.Threshold) {
+			anomaly = Anomaly{
+				Time:      t,
+				Metric:    metric,
+				ChannelID: channelID,
+				Value:     value,
+				Baseline:  baseline,
+				Score:     score,
+			}
+			flagged = true
+		}
+	}
+
+	window = append(window, value)
+	if len(window) > d.config.Window {
+		window = window[len(window)-d.config.Window:]
+	}
+	d.series[key] = window
+
+	return anomaly, flagged
+}
+
+// Returns the baseline of window and the score of value against it.
+func (d *Detector) score(window []float64, value float64) (float64, float64) {
+	switch d.config.Method {
+	case MAD:
+		m := median(window)
+		deviations := make([]float64, len(window))
+		for idx, v := range window {
+			deviations[idx] = math.Abs(v - m)
+		}
+		spread := math.Max(median(deviations), d.config.MinSpread)
+		// 0.6745 scales the MAD to be comparable with a standard deviation.
+		return m, 0.6745 * (value - m) / spread
+	default:
+		var sum float64
+		for _, v := range window {
+			sum += v
+		}
+		mean := sum / float64(len(window))
+
+		var variance float64
+		for _, v := range window {
+			variance += (v - mean) * (v - mean)
+		}
+		spread := math.Max(math.Sqrt(variance/float64(len(window))), d.config.MinSpread)
+		return mean, (value - mean) / spread
+	}
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
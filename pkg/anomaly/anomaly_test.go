@@ -0,0 +1,116 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package anomaly
+
+import (
+	"testing"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+func downstream(snr, power float64) []*mb8600.DownstreamChannel {
+	return []*mb8600.DownstreamChannel{{Channel: 1, ChannelID: 20, SignalToNoise: snr, Power: power}}
+}
+
+func TestDetector_Observe(t *testing.T) {
+	// Slightly noisy but stable history.
+	history := []float64{45.1, 45.3, 44.9, 45.0, 45.2, 45.1, 44.8, 45.0, 45.3, 45.1}
+
+	tests := []struct {
+		name       string
+		method     Method
+		snr        float64
+		power      float64
+		wantMetric Metric
+		wantCount  int
+	}{
+		{"zscore stable", ZScore, 45.0, 3.0, "", 0},
+		{"zscore snr drop", ZScore, 38.0, 3.0, MetricDownstreamSNR, 1},
+		{"zscore snr rise ignored", ZScore, 50.0, 3.0, "", 0},
+		{"zscore power jump", ZScore, 45.0, 9.0, MetricDownstreamPower, 1},
+		{"mad snr drop", MAD, 38.0, 3.0, MetricDownstreamSNR, 1},
+		{"mad stable", MAD, 45.2, 3.0, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDetector(Config{Method: tt.method})
+			start := time.Unix(0, 0)
+			for idx, snr := range history {
+				if got := d.Observe(start.Add(time.Duration(idx)*time.Minute), downstream(snr, 3.0), nil); len(got) != 0 {
+					t.Fatalf("Detector.Observe() flagged history sample %d: %v", idx, got)
+				}
+			}
+
+			got := d.Observe(start.Add(time.Hour), downstream(tt.snr, tt.power), nil)
+			if len(got) != tt.wantCount {
+				t.Fatalf("len(Detector.Observe()) = %v, want %v", len(got), tt.wantCount)
+			}
+			if tt.wantCount > 0 && got[0].Metric != tt.wantMetric {
+				t.Errorf("Detector.Observe()[0].Metric = %v, want %v", got[0].Metric, tt.wantMetric)
+			}
+		})
+	}
+}
+
+func TestDetector_minSamples(t *testing.T) {
+	d := NewDetector(Config{MinSamples: 3})
+	for idx, snr := range []float64{45.0, 45.0, 20.0} {
+		if got := d.Observe(time.Unix(int64(idx), 0), downstream(snr, 3.0), nil); len(got) != 0 {
+			t.Errorf("Detector.Observe() flagged sample %d before MinSamples reached", idx)
+		}
+	}
+	if got := d.Scores(); len(got) != 0 {
+		t.Errorf("len(Detector.Scores()) = %v, want 0", len(got))
+	}
+
+	upstream := []*mb8600.UpstreamChannel{{ChannelID: 4, Power: 45.0}}
+	d.Observe(time.Unix(3, 0), downstream(45.0, 3.0), upstream)
+	if got := d.Scores(); len(got) != 2 {
+		t.Errorf("len(Detector.Scores()) = %v, want 2", len(got))
+	}
+}
+
+func TestDetector_ObserveSnapshot(t *testing.T) {
+	d := NewDetector(Config{MinSamples: 3})
+	upstream := func(power float64) []*mb8600.UpstreamChannel {
+		return []*mb8600.UpstreamChannel{{Channel: 1, ChannelID: 4, Power: power}}
+	}
+	for idx, power := range []float64{44.0, 44.0, 44.0} {
+		if got := d.ObserveSnapshot(&mb8600.Snapshot{Time: time.Unix(int64(idx), 0), Upstream: upstream(power)}); len(got) != 0 {
+			t.Fatalf("Detector.ObserveSnapshot() flagged sample %d: %v", idx, got)
+		}
+	}
+
+	got := d.ObserveSnapshot(&mb8600.Snapshot{Time: time.Unix(3, 0), Upstream: upstream(51.0)})
+	if len(got) != 1 {
+		t.Fatalf("len(Detector.ObserveSnapshot()) = %v, want 1", len(got))
+	}
+	want := mb8600.Event{
+		Type:      mb8600.ChannelAnomaly,
+		Time:      time.Unix(3, 0),
+		Direction: mb8600.DirectionUpstream,
+		ChannelID: 4,
+		Previous:  44.0,
+		Current:   51.0,
+		Metric:    string(MetricUpstreamPower),
+		Score:     got[0].Score,
+	}
+	if got[0] != want || got[0].Score < defaultThreshold {
+		t.Errorf("Detector.ObserveSnapshot() = %+v, want %+v", got[0], want)
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package atomicfile writes files crash-safely by writing to a temporary file
+// in the same directory and renaming it over the destination, so readers only
+// ever observe the old or the new contents, even after a power loss.
+//
+// All persisted state (history, baselines, session caches) should be written
+// through this package.
+package atomicfile
+
+import (
+	"bufio"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+type SyncMode int
+
+const (
+	// Fsync the file before renaming and the directory after, so the new
+	// contents survive a power loss once the write returns. This is the default.
+	SyncFull SyncMode = iota
+	// Fsync the file before renaming only. The rename itself may be lost on
+	// power loss, leaving the old contents in place.
+	SyncFile
+	// Don't fsync. The rename is still atomic with respect to other processes,
+	// but not with respect to power loss.
+	SyncNone
+)
+
+type options struct {
+	sync SyncMode
+}
+
+type Option func(*options)
+
+// Sets how durably the write is committed to disk.
+func WithSync(mode SyncMode) Option {
+	return func(o *options) {
+		o.sync = mode
+	}
+}
+
+// Atomically replaces the named file with data, creating it with perm if it
+// does not exist.
+func WriteFile(name string, data []byte, perm fs.FileMode, opts ...Option) error {
+	return WriteFunc(name, perm, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	}, opts...)
+}
+
+// Atomically replaces the named file with the output of write. If write
+// returns an error, the named file is left untouched.
+func WriteFunc(name string, perm fs.FileMode, write func(io.Writer) error, opts ...Option) (err error) {
+	o := options{sync: SyncFull}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	dir := filepath.Dir(name)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(name)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	buf := bufio.NewWriter(tmp)
+	if err = write(buf); err != nil {
+		return err
+	}
+	if err = buf.Flush(); err != nil {
+		return err
+	}
+	if err = tmp.Chmod(perm); err != nil {
+		return err
+	}
+	if o.sync != SyncNone {
+		if err = tmp.Sync(); err != nil {
+			return err
+		}
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), name); err != nil {
+		return err
+	}
+
+	if o.sync == SyncFull {
+		return syncDir(dir)
+	}
+	return nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
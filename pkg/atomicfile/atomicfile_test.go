@@ -0,0 +1,79 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package atomicfile
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"full", nil},
+		{"file", []Option{WithSync(SyncFile)}},
+		{"none", []Option{WithSync(SyncNone)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "state.json")
+			if err := os.WriteFile(name, []byte("old"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := WriteFile(name, []byte("new"), 0600, tt.opts...); err != nil {
+				t.Fatalf("WriteFile() error = %v", err)
+			}
+
+			got, err := os.ReadFile(name)
+			if err != nil || string(got) != "new" {
+				t.Errorf("ReadFile() = %q, %v, want %q", got, err, "new")
+			}
+			if info, _ := os.Stat(name); info.Mode().Perm() != 0600 {
+				t.Errorf("Mode() = %v, want %v", info.Mode().Perm(), os.FileMode(0600))
+			}
+		})
+	}
+}
+
+func TestWriteFunc_error(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "state.json")
+	if err := os.WriteFile(name, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := WriteFunc(name, 0644, func(w io.Writer) error {
+		io.WriteString(w, "partial")
+		return fmt.Errorf("failed")
+	})
+	if err == nil {
+		t.Fatalf("WriteFunc() error = nil, want error")
+	}
+
+	if got, _ := os.ReadFile(name); string(got) != "old" {
+		t.Errorf("ReadFile() = %q, want %q", got, "old")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("len(ReadDir()) = %v, want 1; temporary file not removed", len(entries))
+	}
+}
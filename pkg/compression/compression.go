@@ -0,0 +1,197 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Package compression compresses stored history, such as the snapshots a
+// daemon keeps on a Raspberry Pi's SD card, with a codec chosen by name.
+// Reading is transparent: the codec is recognized by the magic number the
+// compressed data starts with, so files written with any codec, or none, can
+// be read back without configuration.
+//
+// Gzip and zstd are built in, zstd compressing better at a lower CPU cost.
+// Other codecs are added with Register.
+package compression
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// The names of the known codecs.
+const (
+	None = "none"
+	Gzip = "gzip"
+	Zstd = "zstd"
+)
+
+// A compression format.
+type Codec struct {
+	Name string
+	// The bytes the compressed data starts with, used to recognize it.
+	Magic []byte
+	// Returns a writer compressing to w. Closing it flushes the compressed
+	// data but does not close w.
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+	// Returns a reader decompressing from r.
+	NewReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	mu     sync.RWMutex
+	codecs = map[string]*Codec{
+		Gzip: {
+			Name:  Gzip,
+			Magic: []byte{0x1f, 0x8b},
+			NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+				return gzip.NewWriter(w), nil
+			},
+			NewReader: func(r io.Reader) (io.ReadCloser, error) {
+				return gzip.NewReader(r)
+			},
+		},
+		Zstd: {
+			Name:  Zstd,
+			Magic: []byte{0x28, 0xb5, 0x2f, 0xfd},
+			NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+				// A single goroutine is plenty for snapshots and spares a
+				// Raspberry Pi the memory of one encoder per core.
+				return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+			},
+			NewReader: func(r io.Reader) (io.ReadCloser, error) {
+				d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+				if err != nil {
+					return nil, err
+				}
+				return d.IOReadCloser(), nil
+			},
+		},
+	}
+)
+
+// Adds codec, replacing any codec of the same name.
+func Register(codec *Codec) {
+	mu.Lock()
+	defer mu.Unlock()
+	codecs[codec.Name] = codec
+}
+
+// Returns the names of the available codecs, including None.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := []string{None}
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// Returns the codec named name, or nil for None.
+func Lookup(name string) (*Codec, error) {
+	if name == None || name == "" {
+		return nil, nil
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	if codec, ok := codecs[name]; ok {
+		return codec, nil
+	}
+	return nil, fmt.Errorf("unknown compression: %s", name)
+}
+
+// Returns a writer compressing to w with the codec named name. Closing it
+// does not close w.
+func NewWriter(w io.Writer, name string) (io.WriteCloser, error) {
+	codec, err := Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	if codec == nil {
+		return nopCloser{w}, nil
+	}
+	return codec.NewWriter(w)
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// Returns the name of the codec data starting with head is compressed with,
+// or None.
+func Detect(head []byte) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	for name, codec := range codecs {
+		if len(codec.Magic) > 0 && bytes.HasPrefix(head, codec.Magic) {
+			return name
+		}
+	}
+	return None
+}
+
+// Returns a reader decompressing r with the codec recognized by its magic
+// number, or reading r as is if it starts with none.
+func NewReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	// A short or empty input cannot be compressed; Peek returns what there
+	// is.
+	head, _ := br.Peek(8)
+
+	name := Detect(head)
+	if name == None {
+		return io.NopCloser(br), nil
+	}
+	codec, err := Lookup(name)
+	if err != nil {
+		return nil, fmt.Errorf("data is %s compressed: %w", name, err)
+	}
+	return codec.NewReader(br)
+}
+
+// Returns data compressed with the codec named name.
+func Compress(data []byte, name string) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Returns data decompressed with the codec recognized by its magic number,
+// or data itself if it is not compressed.
+func Decompress(data []byte) ([]byte, error) {
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
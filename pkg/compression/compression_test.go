@@ -0,0 +1,150 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package compression
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	data := []byte(strings.Repeat(`{"time":"2023-12-16T00:00:00Z","downstream":[]}`+"\n", 100))
+
+	tests := []struct {
+		name      string
+		wantMagic []byte
+	}{
+		{None, []byte(`{"time"`)},
+		{"", []byte(`{"time"`)},
+		{Gzip, []byte{0x1f, 0x8b}},
+		{Zstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compressed, err := Compress(data, tt.name)
+			if err != nil {
+				t.Fatalf("Compress() error = %v", err)
+			}
+			if !bytes.HasPrefix(compressed, tt.wantMagic) {
+				t.Errorf("Compress() = % x..., want it to start with % x", compressed[:4], tt.wantMagic)
+			}
+			if (tt.name == Gzip || tt.name == Zstd) && len(compressed) >= len(data)/10 {
+				t.Errorf("len(Compress()) = %d, want under a tenth of %d", len(compressed), len(data))
+			}
+
+			got, err := Decompress(compressed)
+			if err != nil {
+				t.Fatalf("Decompress() error = %v", err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("Decompress() = %q, want %q", got, data)
+			}
+		})
+	}
+}
+
+func TestDecompress_empty(t *testing.T) {
+	got, err := Decompress(nil)
+	if err != nil || len(got) != 0 {
+		t.Errorf("Decompress(nil) = %q, %v, want empty", got, err)
+	}
+}
+
+func TestDecompress_corrupt(t *testing.T) {
+	if _, err := Decompress([]byte{0x28, 0xb5, 0x2f, 0xfd, 0xff, 0xff, 0xff, 0xff}); err == nil {
+		t.Errorf("Decompress() error = nil, want error")
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		head []byte
+		want string
+	}{
+		{nil, None},
+		{[]byte(`{"time":`), None},
+		{[]byte{0x1f, 0x8b, 0x08}, Gzip},
+		{[]byte{0x28, 0xb5, 0x2f, 0xfd}, Zstd},
+	}
+	for _, tt := range tests {
+		if got := Detect(tt.head); got != tt.want {
+			t.Errorf("Detect(% x) = %v, want %v", tt.head, got, tt.want)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr string
+	}{
+		{None, ""},
+		{Gzip, ""},
+		{Zstd, ""},
+		{"lz4", "unknown compression"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Lookup(tt.name)
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Lookup() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	// Raw deflate has no magic number, so one is prepended.
+	magic := []byte("DFL1")
+	Register(&Codec{
+		Name:  "test-deflate",
+		Magic: magic,
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+			if _, err := w.Write(magic); err != nil {
+				return nil, err
+			}
+			return flate.NewWriter(w, flate.BestSpeed)
+		},
+		NewReader: func(r io.Reader) (io.ReadCloser, error) {
+			if _, err := io.ReadFull(r, make([]byte, len(magic))); err != nil {
+				return nil, err
+			}
+			return flate.NewReader(r), nil
+		},
+	})
+	t.Cleanup(func() {
+		mu.Lock()
+		delete(codecs, "test-deflate")
+		mu.Unlock()
+	})
+
+	if names := Names(); !slices.Equal(names, []string{None, Gzip, "test-deflate", Zstd}) {
+		t.Errorf("Names() = %v", names)
+	}
+
+	compressed, err := Compress([]byte("snapshot"), "test-deflate")
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+	if got, err := Decompress(compressed); err != nil || string(got) != "snapshot" {
+		t.Errorf("Decompress() = %q, %v, want snapshot", got, err)
+	}
+}
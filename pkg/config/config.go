@@ -0,0 +1,568 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package config loads the configuration shared by tools built on the mb8600
+// package: the modem to poll and how to reach it, the poll interval, the
+// health thresholds and where results are sent.
+//
+// Configuration files are YAML, TOML or JSON, chosen by their extension,
+// e.g.
+//
+//	modem:
+//	  address: 192.168.100.1
+//	  password_file: /run/secrets/modem-password
+//	  tls: pinned
+//	  cert_fingerprint: "AB:CD:..."
+//	poll:
+//	  interval: 1m
+//	log:
+//	  file: /var/log/mb8600d.log
+//	  file_max_backups: 5
+//	thresholds:
+//	  min_snr:
+//	    QAM256: 36
+//	sinks:
+//	  - type: mqtt
+//	    address: localhost:1883
+//
+// YAML and TOML are parsed with gopkg.in/yaml.v3 and
+// github.com/BurntSushi/toml. Unquoted scalars such as 1234 or true are
+// accepted for string settings, taking the text as written, so that e.g. a
+// numeric password keeps its leading zeros.
+//
+// Every scalar setting can be overridden by an environment variable named
+// after its path, e.g. MB8600_MODEM_ADDRESS or MB8600_POLL_INTERVAL.
+package config
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/health"
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+// The prefix of the environment variables overriding settings.
+const EnvPrefix = "MB8600_"
+
+// The format of a configuration file.
+type Format string
+
+const (
+	YAML Format = "yaml"
+	TOML Format = "toml"
+	JSON Format = "json"
+)
+
+// How the connection to the modem is secured.
+type TLSMode string
+
+const (
+	// HTTPS without verifying the certificate, which the modem signs itself.
+	TLSInsecure TLSMode = "insecure"
+	// HTTPS accepting only the certificate with Modem.CertFingerprint.
+	TLSPinned TLSMode = "pinned"
+	// HTTPS verifying the certificate against the system roots, e.g. behind
+	// a reverse proxy with a trusted certificate.
+	TLSVerify TLSMode = "verify"
+	// Plain HTTP, for firmware that does not serve HTTPS.
+	TLSOff TLSMode = "off"
+)
+
+// The kinds of sink results are sent to.
+const (
+	// Serves Prometheus metrics, Address being the listen address.
+	SinkPrometheus = "prometheus"
+	// Publishes to an MQTT broker at Address.
+	SinkMQTT = "mqtt"
+	// Posts events to the URL in Address.
+	SinkWebhook = "webhook"
+	// Appends snapshots to the history file at Address.
+	SinkFile = "file"
+)
+
+// A duration written as a string such as "30s" or "1h30m", or as a number
+// of seconds.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var seconds float64
+	if err := json.Unmarshal(data, &seconds); err == nil {
+		*d = Duration(seconds * float64(time.Second))
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid duration: %s", data)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// The configuration of a tool polling a modem.
+type Config struct {
+	Modem      Modem      `json:"modem"`
+	Poll       Poll       `json:"poll"`
+	Log        Log        `json:"log"`
+	Thresholds Thresholds `json:"thresholds"`
+	// Where results are sent. Sinks cannot be set from the environment.
+	Sinks []Sink `json:"sinks"`
+}
+
+// The modem and how to reach it.
+type Modem struct {
+	Address  string `json:"address"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// A file the password is read from, e.g. a container secret. Takes
+	// precedence over Password.
+	PasswordFile    string   `json:"password_file"`
+	TLS             TLSMode  `json:"tls"`
+	CertFingerprint string   `json:"cert_fingerprint"`
+	Timeout         Duration `json:"timeout"`
+}
+
+type Poll struct {
+	Interval Duration `json:"interval"`
+}
+
+// Where and how logs are written.
+type Log struct {
+	// debug, info, warn or error.
+	Level string `json:"level"`
+	// logfmt or json.
+	Format string `json:"format"`
+	// A file logs are written to in addition to stderr, disabled if empty.
+	File string `json:"file"`
+	// The size in megabytes at which the file is rotated.
+	FileMaxSize int `json:"file_max_size"`
+	// The age after which rotated files are removed, never if 0.
+	FileMaxAge Duration `json:"file_max_age"`
+	// The number of rotated files kept, all if 0.
+	FileMaxBackups int `json:"file_max_backups"`
+}
+
+// The limits of health.Thresholds, see there.
+type Thresholds struct {
+	DownstreamPowerMin       float64            `json:"downstream_power_min"`
+	DownstreamPowerMax       float64            `json:"downstream_power_max"`
+	UpstreamPowerMin         float64            `json:"upstream_power_min"`
+	UpstreamPowerMax         float64            `json:"upstream_power_max"`
+	MinSNR                   map[string]float64 `json:"min_snr"`
+	DefaultMinSNR            float64            `json:"default_min_snr"`
+	CriticalMargin           float64            `json:"critical_margin"`
+	MaxUncorrectedDelta      float64            `json:"max_uncorrected_delta"`
+	CriticalUncorrectedDelta float64            `json:"critical_uncorrected_delta"`
+	MinLockedUpstream        int                `json:"min_locked_upstream"`
+	MaxUncorrectedPerHour    float64            `json:"max_uncorrected_per_hour"`
+	ForecastHorizon          Duration           `json:"forecast_horizon"`
+}
+
+// A destination of results.
+type Sink struct {
+	// SinkPrometheus, SinkMQTT, SinkWebhook or SinkFile.
+	Type     string `json:"type"`
+	Address  string `json:"address"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// Settings specific to the kind of sink, e.g. the MQTT discovery prefix.
+	Options map[string]string `json:"options,omitempty"`
+}
+
+// Returns the default configuration: the modem at its factory address with
+// its factory username, polled every 30 seconds, logging at level info to
+// stderr, with the health package's default thresholds and no sinks.
+func Default() *Config {
+	t := health.DefaultThresholds()
+	return &Config{
+		Modem: Modem{
+			Address:  "192.168.100.1",
+			Username: "admin",
+			TLS:      TLSInsecure,
+			Timeout:  Duration(10 * time.Second),
+		},
+		Poll: Poll{Interval: Duration(30 * time.Second)},
+		Log: Log{
+			Level:          "info",
+			Format:         "logfmt",
+			FileMaxSize:    10,
+			FileMaxBackups: 3,
+		},
+		Thresholds: Thresholds{
+			DownstreamPowerMin:       t.DownstreamPowerMin,
+			DownstreamPowerMax:       t.DownstreamPowerMax,
+			UpstreamPowerMin:         t.UpstreamPowerMin,
+			UpstreamPowerMax:         t.UpstreamPowerMax,
+			MinSNR:                   t.MinSNR,
+			DefaultMinSNR:            t.DefaultMinSNR,
+			CriticalMargin:           t.CriticalMargin,
+			MaxUncorrectedDelta:      t.MaxUncorrectedDelta,
+			CriticalUncorrectedDelta: t.CriticalUncorrectedDelta,
+			MinLockedUpstream:        t.MinLockedUpstream,
+			MaxUncorrectedPerHour:    t.MaxUncorrectedPerHour,
+			ForecastHorizon:          Duration(t.ForecastHorizon),
+		},
+	}
+}
+
+// Returns the format of the file at path from its extension.
+func FormatOf(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return YAML, nil
+	case ".toml":
+		return TOML, nil
+	case ".json":
+		return JSON, nil
+	}
+	return "", fmt.Errorf("unknown configuration format of %s, want .yaml, .toml or .json", path)
+}
+
+// Loads the configuration file at path over the defaults, applies the
+// environment overrides read with getenv, unless it is nil, reads the
+// password file and validates the result.
+func Load(path string, getenv func(string) string) (*Config, error) {
+	cfg := Default()
+	if err := UnmarshalFile(path, cfg); err != nil {
+		return nil, err
+	}
+	if getenv != nil {
+		if err := cfg.ApplyEnv(getenv); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Modem.PasswordFile != "" {
+		data, err := os.ReadFile(cfg.Modem.PasswordFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Modem.Password = strings.TrimRight(string(data), "\r\n")
+	}
+	return cfg, cfg.Validate()
+}
+
+// Parses a configuration in format over the defaults. Unknown settings are
+// an error, so that typos do not go unnoticed.
+func Parse(data []byte, format Format) (*Config, error) {
+	cfg := Default()
+	if err := Unmarshal(data, format, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Decodes a document in format into v, a pointer to a struct whose fields
+// are named by their json tags, e.g. the configuration of another tool built
+// on this package. Fields missing from the document are left unchanged, and
+// fields unknown to v are an error.
+func Unmarshal(data []byte, format Format, v any) error {
+	var doc map[string]any
+	var err error
+	switch format {
+	case YAML:
+		doc, err = parseYAML(data)
+	case TOML:
+		doc, err = parseTOML(data)
+	case JSON:
+		err = json.Unmarshal(data, &doc)
+	default:
+		err = fmt.Errorf("unknown configuration format: %s", format)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The parsed document is decoded into v through JSON, which does the type
+	// checking for all three formats.
+	encoded, err := json.Marshal(resolveScalars(doc, reflect.TypeOf(v)))
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(encoded))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// Decodes the file at path into v like Unmarshal, in the format of its
+// extension.
+func UnmarshalFile(path string, v any) error {
+	format, err := FormatOf(path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := Unmarshal(data, format, v); err != nil {
+		return fmt.Errorf("invalid configuration in %s: %w", path, err)
+	}
+	return nil
+}
+
+// A YAML or TOML scalar: its text as written and its value as typed by the
+// format, e.g. "0123" and 123.
+type scalar struct {
+	text  string
+	value any
+}
+
+// Returns value, parsed from YAML or TOML, with every scalar replaced by its
+// text where t, the type it is decoded into, holds a string, and by its
+// typed value elsewhere.
+func resolveScalars(value any, t reflect.Type) any {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch v := value.(type) {
+	case scalar:
+		if t != nil && t.Kind() == reflect.String {
+			return v.text
+		}
+		return v.value
+	case map[string]any:
+		resolved := make(map[string]any, len(v))
+		for key, value := range v {
+			resolved[key] = resolveScalars(value, fieldType(t, key))
+		}
+		return resolved
+	case []any:
+		var elem reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			elem = t.Elem()
+		}
+		resolved := make([]any, len(v))
+		for i, value := range v {
+			resolved[i] = resolveScalars(value, elem)
+		}
+		return resolved
+	}
+	return value
+}
+
+// Returns the type of the value at key of t, a struct with json tags or a
+// map, or nil if it has none.
+func fieldType(t reflect.Type, key string) reflect.Type {
+	switch {
+	case t == nil:
+		return nil
+	case t.Kind() == reflect.Map:
+		return t.Elem()
+	case t.Kind() != reflect.Struct:
+		return nil
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" {
+			name = field.Name
+		}
+		if strings.EqualFold(name, key) {
+			return field.Type
+		}
+	}
+	return nil
+}
+
+// Overrides the scalar settings for which getenv returns a value, each read
+// from the variable named EnvPrefix followed by its path in upper case, e.g.
+// MB8600_MODEM_ADDRESS. Setting a variable for a list or map, such as
+// MB8600_SINKS, is an error.
+func (c *Config) ApplyEnv(getenv func(string) string) error {
+	return applyEnv(reflect.ValueOf(c).Elem(), strings.TrimSuffix(EnvPrefix, "_"), getenv)
+}
+
+var durationType = reflect.TypeOf(Duration(0))
+
+func applyEnv(v reflect.Value, name string, getenv func(string) string) error {
+	if v.Kind() == reflect.Struct {
+		for i := 0; i < v.NumField(); i++ {
+			tag, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+			if err := applyEnv(v.Field(i), name+"_"+strings.ToUpper(tag), getenv); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	value := getenv(name)
+	if value == "" {
+		return nil
+	}
+	invalid := func(err error) error {
+		return fmt.Errorf("invalid value %q for %s: %w", value, name, err)
+	}
+	switch {
+	case v.Type() == durationType:
+		var d Duration
+		if err := d.UnmarshalJSON(strconv.AppendQuote(nil, value)); err != nil {
+			return invalid(err)
+		}
+		v.Set(reflect.ValueOf(d))
+	case v.Kind() == reflect.String:
+		v.SetString(value)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return invalid(err)
+		}
+		v.SetInt(int64(n))
+	case v.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return invalid(err)
+		}
+		v.SetFloat(f)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return invalid(err)
+		}
+		v.SetBool(b)
+	default:
+		return fmt.Errorf("%s cannot be set from the environment", name)
+	}
+	return nil
+}
+
+// Returns an error describing the first invalid setting, if any.
+func (c *Config) Validate() error {
+	if err := c.Modem.Validate(); err != nil {
+		return err
+	}
+	if c.Poll.Interval <= 0 {
+		return fmt.Errorf("poll interval must be positive: %s", time.Duration(c.Poll.Interval))
+	}
+	switch c.Log.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("invalid log level, want debug, info, warn or error: %q", c.Log.Level)
+	}
+	if c.Log.Format != "logfmt" && c.Log.Format != "json" {
+		return fmt.Errorf("invalid log format, want logfmt or json: %q", c.Log.Format)
+	}
+	if c.Log.FileMaxSize <= 0 {
+		return fmt.Errorf("log file max size must be positive: %d", c.Log.FileMaxSize)
+	}
+	if c.Log.FileMaxAge < 0 || c.Log.FileMaxBackups < 0 {
+		return fmt.Errorf("log file max age and backups must not be negative")
+	}
+	for i, sink := range c.Sinks {
+		switch sink.Type {
+		case SinkPrometheus, SinkMQTT, SinkWebhook, SinkFile:
+		default:
+			return fmt.Errorf("invalid type of sink %d, want prometheus, mqtt, webhook or file: %q", i, sink.Type)
+		}
+		if sink.Address == "" && sink.Type != SinkPrometheus {
+			return fmt.Errorf("sink %d of type %s needs an address", i, sink.Type)
+		}
+	}
+	return nil
+}
+
+// Returns an error describing the first invalid modem setting, if any.
+func (m Modem) Validate() error {
+	if _, err := mb8600.ParseAddress(m.Address); err != nil {
+		return err
+	}
+	switch m.TLS {
+	case TLSInsecure, TLSVerify, TLSOff:
+	case TLSPinned:
+		if m.CertFingerprint == "" {
+			return fmt.Errorf("tls mode %s requires a cert_fingerprint", TLSPinned)
+		}
+	default:
+		return fmt.Errorf("invalid tls mode, want insecure, pinned, verify or off: %q", m.TLS)
+	}
+	if m.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative: %s", time.Duration(m.Timeout))
+	}
+	return nil
+}
+
+// Returns the sinks of the given type.
+func (c *Config) SinksOf(sinkType string) []Sink {
+	var sinks []Sink
+	for _, sink := range c.Sinks {
+		if sink.Type == sinkType {
+			sinks = append(sinks, sink)
+		}
+	}
+	return sinks
+}
+
+// Returns the thresholds as used by the health package.
+func (t Thresholds) Health() health.Thresholds {
+	return health.Thresholds{
+		DownstreamPowerMin:       t.DownstreamPowerMin,
+		DownstreamPowerMax:       t.DownstreamPowerMax,
+		UpstreamPowerMin:         t.UpstreamPowerMin,
+		UpstreamPowerMax:         t.UpstreamPowerMax,
+		MinSNR:                   t.MinSNR,
+		DefaultMinSNR:            t.DefaultMinSNR,
+		CriticalMargin:           t.CriticalMargin,
+		MaxUncorrectedDelta:      t.MaxUncorrectedDelta,
+		CriticalUncorrectedDelta: t.CriticalUncorrectedDelta,
+		MinLockedUpstream:        t.MinLockedUpstream,
+		MaxUncorrectedPerHour:    t.MaxUncorrectedPerHour,
+		ForecastHorizon:          time.Duration(t.ForecastHorizon),
+	}
+}
+
+// Returns the client options reaching the modem as configured.
+func (m Modem) ClientOptions() ([]mb8600.Option, error) {
+	opts := []mb8600.Option{mb8600.WithTimeout(time.Duration(m.Timeout))}
+	switch m.TLS {
+	case TLSPinned:
+		tlsConfig, err := mb8600.PinnedTLSConfig(m.CertFingerprint)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, mb8600.WithTLSConfig(tlsConfig))
+	case TLSVerify:
+		opts = append(opts, mb8600.WithTLSConfig(&tls.Config{}))
+	case TLSOff:
+		opts = append(opts, mb8600.WithScheme(mb8600.SchemeHTTP))
+	}
+	return opts, nil
+}
+
+// Returns a client for the configured modem, with extra options applied
+// after the configured ones.
+func (c *Config) NewClient(logger mb8600.Logger, extra ...mb8600.Option) (*mb8600.MotoClient, error) {
+	opts, err := c.Modem.ClientOptions()
+	if err != nil {
+		return nil, err
+	}
+	client := mb8600.NewMotoClient(c.Modem.Address, c.Modem.Username, c.Modem.Password, logger, append(opts, extra...)...)
+	return client, client.Err()
+}
@@ -0,0 +1,290 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/health"
+)
+
+const (
+	testYAML = `
+modem:
+  address: 192.168.0.1
+  password: secret
+  tls: pinned
+  cert_fingerprint: "AB:CD"
+poll:
+  interval: 1m
+log:
+  file: /var/log/mb8600d.log
+  file_max_age: 168h
+thresholds:
+  min_snr:
+    QAM256: 35
+  forecast_horizon: 3600
+sinks:
+  - type: mqtt
+    address: localhost:1883
+    options:
+      discovery_prefix: ha
+  - type: prometheus
+    address: ":9100"
+`
+	testTOML = `
+sinks = [
+  { type = "mqtt", address = "localhost:1883", options = { discovery_prefix = "ha" } },
+  { type = "prometheus", address = ":9100" },
+]
+
+[modem]
+address = "192.168.0.1"
+password = "secret"
+tls = "pinned"
+cert_fingerprint = "AB:CD"
+
+[poll]
+interval = "1m"
+
+[log]
+file = "/var/log/mb8600d.log"
+file_max_age = "168h"
+
+[thresholds]
+min_snr.QAM256 = 35
+forecast_horizon = 3600
+`
+	testJSON = `{
+  "modem": {"address": "192.168.0.1", "password": "secret", "tls": "pinned", "cert_fingerprint": "AB:CD"},
+  "poll": {"interval": "1m"},
+  "log": {"file": "/var/log/mb8600d.log", "file_max_age": "168h"},
+  "thresholds": {"min_snr": {"QAM256": 35}, "forecast_horizon": 3600},
+  "sinks": [
+    {"type": "mqtt", "address": "localhost:1883", "options": {"discovery_prefix": "ha"}},
+    {"type": "prometheus", "address": ":9100"}
+  ]
+}`
+)
+
+// Returns the configuration the test files describe.
+func testConfig() *Config {
+	want := Default()
+	want.Modem.Address = "192.168.0.1"
+	want.Modem.Password = "secret"
+	want.Modem.TLS = TLSPinned
+	want.Modem.CertFingerprint = "AB:CD"
+	want.Poll.Interval = Duration(time.Minute)
+	want.Log.File = "/var/log/mb8600d.log"
+	want.Log.FileMaxAge = Duration(168 * time.Hour)
+	want.Thresholds.MinSNR["QAM256"] = 35
+	want.Thresholds.ForecastHorizon = Duration(time.Hour)
+	want.Sinks = []Sink{
+		{Type: SinkMQTT, Address: "localhost:1883", Options: map[string]string{"discovery_prefix": "ha"}},
+		{Type: SinkPrometheus, Address: ":9100"},
+	}
+	return want
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		format  Format
+		want    *Config
+		wantErr string
+	}{
+		{"yaml", testYAML, YAML, testConfig(), ""},
+		{"toml", testTOML, TOML, testConfig(), ""},
+		{"json", testJSON, JSON, testConfig(), ""},
+		{"empty", "", YAML, Default(), ""},
+		{"unknown setting", "modem:\n  adress: x\n", YAML, nil, `unknown field "adress"`},
+		{"wrong type", "[poll]\ninterval = true\n", TOML, nil, "invalid duration"},
+		{"unknown format", "", Format("ini"), nil, "unknown configuration format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse([]byte(tt.input), tt.format)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Parse() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_ApplyEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		check   func(*Config) bool
+		wantErr string
+	}{
+		{
+			"strings and durations",
+			map[string]string{
+				"MB8600_MODEM_ADDRESS": "10.0.0.1",
+				"MB8600_MODEM_TLS":     "off",
+				"MB8600_POLL_INTERVAL": "5m",
+			},
+			func(c *Config) bool {
+				return c.Modem.Address == "10.0.0.1" && c.Modem.TLS == TLSOff && c.Poll.Interval == Duration(5*time.Minute)
+			},
+			"",
+		},
+		{
+			"numbers",
+			map[string]string{
+				"MB8600_THRESHOLDS_MIN_LOCKED_UPSTREAM":  "2",
+				"MB8600_THRESHOLDS_DOWNSTREAM_POWER_MAX": "12.5",
+			},
+			func(c *Config) bool {
+				return c.Thresholds.MinLockedUpstream == 2 && c.Thresholds.DownstreamPowerMax == 12.5
+			},
+			"",
+		},
+		{"invalid number", map[string]string{"MB8600_THRESHOLDS_MIN_LOCKED_UPSTREAM": "two"}, nil, "MB8600_THRESHOLDS_MIN_LOCKED_UPSTREAM"},
+		{"invalid duration", map[string]string{"MB8600_MODEM_TIMEOUT": "soon"}, nil, "MB8600_MODEM_TIMEOUT"},
+		{"list", map[string]string{"MB8600_SINKS": "mqtt"}, nil, "MB8600_SINKS cannot be set from the environment"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			err := cfg.ApplyEnv(func(name string) string { return tt.env[name] })
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ApplyEnv() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyEnv() error = %v", err)
+			}
+			if !tt.check(cfg) {
+				t.Errorf("ApplyEnv() = %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*Config)
+		wantErr string
+	}{
+		{"default", func(*Config) {}, ""},
+		{"pinned without fingerprint", func(c *Config) { c.Modem.TLS = TLSPinned }, "requires a cert_fingerprint"},
+		{"invalid tls", func(c *Config) { c.Modem.TLS = "yes" }, "invalid tls mode"},
+		{"invalid address", func(c *Config) { c.Modem.Address = "" }, "address"},
+		{"zero interval", func(c *Config) { c.Poll.Interval = 0 }, "poll interval must be positive"},
+		{"negative timeout", func(c *Config) { c.Modem.Timeout = -1 }, "timeout must not be negative"},
+		{"invalid log level", func(c *Config) { c.Log.Level = "trace" }, "invalid log level"},
+		{"invalid log format", func(c *Config) { c.Log.Format = "text" }, "invalid log format"},
+		{"zero log file max size", func(c *Config) { c.Log.FileMaxSize = 0 }, "log file max size must be positive"},
+		{"invalid sink", func(c *Config) { c.Sinks = []Sink{{Type: "email"}} }, "invalid type of sink 0"},
+		{"sink without address", func(c *Config) { c.Sinks = []Sink{{Type: SinkWebhook}} }, "needs an address"},
+		{"prometheus without address", func(c *Config) { c.Sinks = []Sink{{Type: SinkPrometheus}} }, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.modify(cfg)
+			err := cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	passwordFile := filepath.Join(dir, "password")
+	if err := os.WriteFile(passwordFile, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "mb8600.yml")
+	if err := os.WriteFile(path, []byte("modem:\n  password_file: "+passwordFile+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{"MB8600_MODEM_USERNAME": "root"}
+	cfg, err := Load(path, func(name string) string { return env[name] })
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Modem.Password != "from-file" || cfg.Modem.Username != "root" {
+		t.Errorf("Load() modem = %+v", cfg.Modem)
+	}
+
+	if _, err := Load(filepath.Join(dir, "mb8600.ini"), nil); err == nil || !strings.Contains(err.Error(), "unknown configuration format") {
+		t.Errorf("Load() error = %v, want unknown format", err)
+	}
+	if err := os.WriteFile(path, []byte("poll:\n  interval: 0\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path, nil); err == nil || !strings.Contains(err.Error(), "poll interval") {
+		t.Errorf("Load() error = %v, want invalid poll interval", err)
+	}
+}
+
+func TestThresholds_Health(t *testing.T) {
+	if got, want := Default().Thresholds.Health(), health.DefaultThresholds(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Health() = %+v, want %+v", got, want)
+	}
+}
+
+func TestModem_ClientOptions(t *testing.T) {
+	for _, mode := range []TLSMode{TLSInsecure, TLSVerify, TLSOff} {
+		cfg := Default()
+		cfg.Modem.TLS = mode
+		client, err := cfg.NewClient(nil)
+		if err != nil || client == nil {
+			t.Errorf("NewClient() with tls %s error = %v", mode, err)
+		}
+	}
+
+	cfg := Default()
+	cfg.Modem.TLS = TLSPinned
+	cfg.Modem.CertFingerprint = "not hex"
+	if _, err := cfg.Modem.ClientOptions(); err == nil {
+		t.Error("ClientOptions() with an invalid fingerprint succeeded")
+	}
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Parses a TOML document into its tables, as map[string]any, arrays as []any
+// and values as scalar.
+func parseTOML(data []byte) (map[string]any, error) {
+	doc := map[string]any{}
+	if _, err := toml.Decode(string(data), &doc); err != nil {
+		return nil, err
+	}
+	return tomlValue(doc).(map[string]any), nil
+}
+
+func tomlValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		table := make(map[string]any, len(v))
+		for key, value := range v {
+			table[key] = tomlValue(value)
+		}
+		return table
+	case []map[string]any:
+		tables := make([]any, 0, len(v))
+		for _, table := range v {
+			tables = append(tables, tomlValue(table))
+		}
+		return tables
+	case []any:
+		array := make([]any, 0, len(v))
+		for _, value := range v {
+			array = append(array, tomlValue(value))
+		}
+		return array
+	case string:
+		return scalar{text: v, value: v}
+	case int64:
+		return scalar{text: strconv.FormatInt(v, 10), value: v}
+	case float64:
+		return scalar{text: strconv.FormatFloat(v, 'f', -1, 64), value: v}
+	case bool:
+		return scalar{text: strconv.FormatBool(v), value: v}
+	case time.Time:
+		return scalar{text: v.Format(time.RFC3339Nano), value: v}
+	}
+	return scalar{text: fmt.Sprint(value), value: value}
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestUnmarshal_toml(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    testSettings
+		wantErr string
+	}{
+		{"empty", "# nothing\n", testSettings{}, ""},
+		{
+			"quoting",
+			"name = 'C:\\path # not a comment'\npassword = \"\"\"\nmulti\nline\"\"\" # a comment\n",
+			testSettings{Name: "C:\\path # not a comment", Password: "multi\nline"},
+			"",
+		},
+		{
+			"escapes",
+			"name = \"tab\\tquote\\\" \\u00e9 \\U0001F600\"\n",
+			testSettings{Name: "tab\tquote\" é 😀"},
+			"",
+		},
+		{
+			"bare numbers for strings",
+			"name = 8600\npassword = 1_234\nlabels = { floor = 2, vip = true, ratio = 1.5 }\n",
+			testSettings{Name: "8600", Password: "1234", Labels: map[string]string{"floor": "2", "vip": "true", "ratio": "1.5"}},
+			"",
+		},
+		{
+			"typed values",
+			"port = 0x50\nratio = 1e-1\nenabled = true\nlimits.QAM256 = 36\nlimits.\"OFDM PLC\" = 33.5\n",
+			testSettings{Port: 80, Ratio: 0.1, Enabled: true, Limits: map[string]float64{"QAM256": 36, "OFDM PLC": 33.5}},
+			"",
+		},
+		{
+			"arrays and tables",
+			"tags = [\n  \"a\", # first\n  \"b, c\",\n]\n\n[[items]]\ntype = \"mqtt\"\naddress = \"localhost:1883\"\n\n[[items]]\ntype = \"prometheus\"\n",
+			testSettings{Tags: []string{"a", "b, c"}, Items: []testItem{{"mqtt", "localhost:1883"}, {Type: "prometheus"}}},
+			"",
+		},
+		{"duplicate key", "name = \"a\"\nname = \"b\"\n", testSettings{}, "already been defined"},
+		{"wrong type", "port = \"many\"\n", testSettings{}, "cannot unmarshal"},
+		{"unknown field", "nmae = \"x\"\n", testSettings{}, `unknown field "nmae"`},
+		{"invalid", "name =\n", testSettings{}, "expected value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got testSettings
+			err := Unmarshal([]byte(tt.input), TOML, &got)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Unmarshal() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Unmarshal() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
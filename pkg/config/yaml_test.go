@@ -0,0 +1,111 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The settings decoded by the YAML and TOML tests.
+type testSettings struct {
+	Name     string             `json:"name"`
+	Password string             `json:"password"`
+	Port     int                `json:"port"`
+	Ratio    float64            `json:"ratio"`
+	Enabled  bool               `json:"enabled"`
+	Tags     []string           `json:"tags"`
+	Limits   map[string]float64 `json:"limits"`
+	Labels   map[string]string  `json:"labels"`
+	Items    []testItem         `json:"items"`
+}
+
+type testItem struct {
+	Type    string `json:"type"`
+	Address string `json:"address"`
+}
+
+func TestUnmarshal_yaml(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    testSettings
+		wantErr string
+	}{
+		{"empty", "# nothing\n---\n", testSettings{}, ""},
+		{
+			"quoting",
+			"name: 'it''s # not a comment'\npassword: \"tab\\there\\u00e9\" # a comment\n",
+			testSettings{Name: "it's # not a comment", Password: "tab\there\u00e9"},
+			"",
+		},
+		{
+			"escapes",
+			"name: \"line\\nbreak \\x41 \\u00e9 \\U0001F600 \\e\\_\"\n",
+			testSettings{Name: "line\nbreak A é 😀 \x1b\u00a0"},
+			"",
+		},
+		{
+			"bare numbers for strings",
+			"name: 8600\npassword: 0123\nlabels: {floor: 2, vip: yes, ratio: 1.50}\n",
+			testSettings{Name: "8600", Password: "0123", Labels: map[string]string{"floor": "2", "vip": "yes", "ratio": "1.50"}},
+			"",
+		},
+		{
+			"typed scalars",
+			"port: 0x50\nratio: 1e-1\nenabled: true\nlimits: {QAM256: 36, OFDM PLC: 33.5}\n",
+			testSettings{Port: 80, Ratio: 0.1, Enabled: true, Limits: map[string]float64{"QAM256": 36, "OFDM PLC": 33.5}},
+			"",
+		},
+		{
+			"block collections",
+			"tags:\n- a\n- \"b, c\"\nitems:\n  - type: mqtt\n    address: localhost:1883\n  - type: prometheus\n",
+			testSettings{Tags: []string{"a", "b, c"}, Items: []testItem{{"mqtt", "localhost:1883"}, {Type: "prometheus"}}},
+			"",
+		},
+		{
+			"multi-line string and anchor",
+			"name: &n |\n  first\n  second\npassword: *n\n",
+			testSettings{Name: "first\nsecond\n", Password: "first\nsecond\n"},
+			"",
+		},
+		{"duplicate key", "name: a\nname: b\n", testSettings{}, "duplicate key"},
+		{"not a mapping", "- a\n", testSettings{}, "not a mapping"},
+		{"wrong type", "port: many\n", testSettings{}, "cannot unmarshal"},
+		{"unknown field", "nmae: x\n", testSettings{}, `unknown field "nmae"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got testSettings
+			err := Unmarshal([]byte(tt.input), YAML, &got)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Unmarshal() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Unmarshal() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,305 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package correlate joins the modem's event log with the channel data polled
+// around each event, turning entries such as T3 timeouts or lost sync into
+// incidents annotated with what the channels looked like at the time, e.g.
+// "T3 timeout at 02:13, upstream ch4 power 54.0 dBmV".
+package correlate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/health"
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+const defaultWindow = 5 * time.Minute
+
+// The event codes correlated by default, those pointing at problems of the
+// plant or the provisioning.
+var DefaultCodes = []mb8600.EventCode{
+	mb8600.EventT3Timeout,
+	mb8600.EventT4Timeout,
+	mb8600.EventSyncLoss,
+	mb8600.EventMDDTimeout,
+	mb8600.EventDHCPRenew,
+	mb8600.EventDHCPFailed,
+	mb8600.EventDSPartialService,
+	mb8600.EventUSPartialService,
+	mb8600.EventRebootPower,
+	mb8600.EventReboot,
+}
+
+// The event codes concerning the upstream, whose incidents report the
+// upstream power.
+var upstreamCodes = map[mb8600.EventCode]bool{
+	mb8600.EventT3Timeout:        true,
+	mb8600.EventT4Timeout:        true,
+	mb8600.EventUSPartialService: true,
+}
+
+type Config struct {
+	// The time around an event within which channel data is joined to it,
+	// and within which repeated events of the same code are merged into one
+	// incident. Five minutes if zero.
+	Window time.Duration
+	// The event codes correlated, DefaultCodes if empty.
+	Codes []mb8600.EventCode
+	// The limits of the upstream power, see health.Thresholds. The default
+	// thresholds if zero.
+	Thresholds health.Thresholds
+}
+
+// Returns the default configuration.
+func DefaultConfig() Config {
+	return Config{Window: defaultWindow, Codes: DefaultCodes, Thresholds: health.DefaultThresholds()}
+}
+
+// The errors a downstream channel accumulated around an incident.
+type ChannelErrors struct {
+	ChannelID   int     `json:"channel_id"`
+	Corrected   float64 `json:"corrected"`
+	Uncorrected float64 `json:"uncorrected"`
+}
+
+// The power of an upstream channel at the poll nearest an incident.
+type UpstreamPower struct {
+	ChannelID int     `json:"channel_id"`
+	Power     float64 `json:"power"`
+	// Whether the power is outside the thresholds.
+	OutOfRange bool `json:"out_of_range"`
+}
+
+// One or more log entries of the same code, joined with the channel data
+// polled around them.
+type Incident struct {
+	Code mb8600.EventCode `json:"code"`
+	// The times of the first and last entry merged into the incident.
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// The number of entries merged into the incident.
+	Count       int    `json:"count"`
+	Description string `json:"description"`
+	// The downstream channels whose error counters increased between polls
+	// overlapping the incident's window, ordered by channel ID.
+	Errors []ChannelErrors `json:"errors,omitempty"`
+	// For upstream events, the upstream channels at the poll nearest the
+	// incident, ordered by channel ID.
+	Upstream []UpstreamPower `json:"upstream,omitempty"`
+	// A one-line description of the incident and the notable channel data.
+	Summary string `json:"summary"`
+}
+
+// Returns the incidents of the log entries with a configured code, joined
+// with snapshots, in chronological order. Entries logged before the modem
+// established the time of day cannot be placed and are skipped.
+func Correlate(entries []*mb8600.LogEntry, snapshots []*mb8600.Snapshot, cfg Config) []*Incident {
+	if cfg.Window <= 0 {
+		cfg.Window = defaultWindow
+	}
+	if cfg.Thresholds.UpstreamPowerMin == 0 && cfg.Thresholds.UpstreamPowerMax == 0 {
+		cfg.Thresholds = health.DefaultThresholds()
+	}
+	codes := cfg.Codes
+	if len(codes) == 0 {
+		codes = DefaultCodes
+	}
+	wanted := make(map[mb8600.EventCode]bool, len(codes))
+	for _, code := range codes {
+		wanted[code] = true
+	}
+
+	var events []*mb8600.LogEntry
+	for _, entry := range entries {
+		if wanted[entry.Code] && !entry.Timestamp.IsZero() {
+			events = append(events, entry)
+		}
+	}
+	// The modem logs the newest entry first.
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Timestamp.Before(events[j].Timestamp) })
+
+	snapshots = append([]*mb8600.Snapshot(nil), snapshots...)
+	sort.SliceStable(snapshots, func(i, j int) bool { return snapshots[i].Time.Before(snapshots[j].Time) })
+
+	// Events of the same code within the window of the previous one are
+	// merged, as the modem repeats e.g. T3 timeouts every few seconds.
+	var incidents []*Incident
+	open := map[mb8600.EventCode]*Incident{}
+	for _, entry := range events {
+		if incident := open[entry.Code]; incident != nil && entry.Timestamp.Sub(incident.End) <= cfg.Window {
+			incident.End = entry.Timestamp
+			incident.Count++
+			continue
+		}
+		incident := &Incident{
+			Code:        entry.Code,
+			Start:       entry.Timestamp,
+			End:         entry.Timestamp,
+			Count:       1,
+			Description: entry.Description,
+		}
+		open[entry.Code] = incident
+		incidents = append(incidents, incident)
+	}
+
+	for _, incident := range incidents {
+		from, to := incident.Start.Add(-cfg.Window), incident.End.Add(cfg.Window)
+		incident.Errors = errorsBetween(snapshots, from, to)
+		if upstreamCodes[incident.Code] {
+			if nearest := nearestSnapshot(snapshots, incident.Start, cfg.Window); nearest != nil {
+				incident.Upstream = upstreamPower(nearest, cfg.Thresholds)
+			}
+		}
+		incident.Summary = summarize(incident)
+	}
+	return incidents
+}
+
+// Returns the increases of the downstream error counters between successive
+// snapshots overlapping from..to, skipping intervals where the counters were
+// reset.
+func errorsBetween(snapshots []*mb8600.Snapshot, from, to time.Time) []ChannelErrors {
+	totals := map[int]*ChannelErrors{}
+	for i := 1; i < len(snapshots); i++ {
+		prev, curr := snapshots[i-1], snapshots[i]
+		if curr.Time.Before(from) || prev.Time.After(to) {
+			continue
+		}
+		before := make(map[int]*mb8600.DownstreamChannel, len(prev.Downstream))
+		for _, ch := range prev.Downstream {
+			before[ch.ChannelID] = ch
+		}
+		for _, ch := range curr.Downstream {
+			old, ok := before[ch.ChannelID]
+			if !ok || ch.CorrectedErrors < old.CorrectedErrors || ch.UncorrectedErrors < old.UncorrectedErrors {
+				continue
+			}
+			corrected, uncorrected := ch.CorrectedErrors-old.CorrectedErrors, ch.UncorrectedErrors-old.UncorrectedErrors
+			if corrected == 0 && uncorrected == 0 {
+				continue
+			}
+			total := totals[ch.ChannelID]
+			if total == nil {
+				total = &ChannelErrors{ChannelID: ch.ChannelID}
+				totals[ch.ChannelID] = total
+			}
+			total.Corrected += corrected
+			total.Uncorrected += uncorrected
+		}
+	}
+
+	var result []ChannelErrors
+	for _, total := range totals {
+		result = append(result, *total)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ChannelID < result[j].ChannelID })
+	return result
+}
+
+// Returns the snapshot nearest t within window, or nil.
+func nearestSnapshot(snapshots []*mb8600.Snapshot, t time.Time, window time.Duration) *mb8600.Snapshot {
+	var nearest *mb8600.Snapshot
+	var distance time.Duration
+	for _, s := range snapshots {
+		d := s.Time.Sub(t)
+		if d < 0 {
+			d = -d
+		}
+		if d <= window && (nearest == nil || d < distance) {
+			nearest, distance = s, d
+		}
+	}
+	return nearest
+}
+
+func upstreamPower(snapshot *mb8600.Snapshot, thresholds health.Thresholds) []UpstreamPower {
+	var power []UpstreamPower
+	for _, ch := range snapshot.Upstream {
+		power = append(power, UpstreamPower{
+			ChannelID:  ch.ChannelID,
+			Power:      ch.Power,
+			OutOfRange: ch.Power < thresholds.UpstreamPowerMin || ch.Power > thresholds.UpstreamPowerMax,
+		})
+	}
+	sort.Slice(power, func(i, j int) bool { return power[i].ChannelID < power[j].ChannelID })
+	return power
+}
+
+// Returns the summary of incident: its code and time, then the upstream
+// channels out of range, or else the one with the highest power, and the
+// downstream channels with uncorrected errors.
+func summarize(incident *Incident) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s at %s", describeCode(incident.Code), incident.Start.Format("15:04"))
+	if incident.Count > 1 {
+		fmt.Fprintf(&b, " (%d times until %s)", incident.Count, incident.End.Format("15:04"))
+	}
+
+	var notable []UpstreamPower
+	var highest *UpstreamPower
+	for i, ch := range incident.Upstream {
+		if ch.OutOfRange {
+			notable = append(notable, ch)
+		}
+		if highest == nil || ch.Power > highest.Power {
+			highest = &incident.Upstream[i]
+		}
+	}
+	if len(notable) == 0 && highest != nil {
+		notable = append(notable, *highest)
+	}
+	for _, ch := range notable {
+		fmt.Fprintf(&b, ", upstream ch%d power %.1f dBmV", ch.ChannelID, ch.Power)
+	}
+
+	for _, ch := range incident.Errors {
+		if ch.Uncorrected > 0 {
+			fmt.Fprintf(&b, ", downstream ch%d %.0f uncorrected", ch.ChannelID, ch.Uncorrected)
+		}
+	}
+	return b.String()
+}
+
+// Returns a readable name of code, e.g. "T3 timeout" for EventT3Timeout.
+func describeCode(code mb8600.EventCode) string {
+	switch code {
+	case mb8600.EventT3Timeout:
+		return "T3 timeout"
+	case mb8600.EventT4Timeout:
+		return "T4 timeout"
+	case mb8600.EventSyncLoss:
+		return "SYNC loss"
+	case mb8600.EventMDDTimeout:
+		return "MDD timeout"
+	case mb8600.EventDHCPRenew:
+		return "DHCP renew"
+	case mb8600.EventDHCPFailed:
+		return "DHCP failure"
+	case mb8600.EventDSPartialService:
+		return "Downstream partial service"
+	case mb8600.EventUSPartialService:
+		return "Upstream partial service"
+	case mb8600.EventRebootPower:
+		return "Reboot after power loss"
+	case mb8600.EventReboot:
+		return "Reboot"
+	}
+	return string(code)
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package correlate
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+var start = time.Date(2023, 12, 24, 2, 0, 0, 0, time.UTC)
+
+func at(minute int) time.Time {
+	return start.Add(time.Duration(minute) * time.Minute)
+}
+
+func entry(minute int, code mb8600.EventCode) *mb8600.LogEntry {
+	return &mb8600.LogEntry{Timestamp: at(minute), Code: code, Description: string(code)}
+}
+
+// Returns a snapshot at minute with downstream channel 20 at the given
+// uncorrected errors and upstream channels 3 and 4 at the given powers.
+func snapshot(minute int, uncorrected, power3, power4 float64) *mb8600.Snapshot {
+	return &mb8600.Snapshot{
+		Time:       at(minute),
+		Downstream: []*mb8600.DownstreamChannel{{ChannelID: 20, CorrectedErrors: 2 * uncorrected, UncorrectedErrors: uncorrected}},
+		Upstream: []*mb8600.UpstreamChannel{
+			{ChannelID: 4, Power: power4},
+			{ChannelID: 3, Power: power3},
+		},
+	}
+}
+
+func TestCorrelate(t *testing.T) {
+	snapshots := []*mb8600.Snapshot{
+		snapshot(0, 100, 45, 46),
+		snapshot(10, 100, 45, 54),
+		snapshot(15, 400, 45, 54),
+		snapshot(30, 400, 45, 46),
+		snapshot(40, 10, 45, 46),
+		snapshot(50, 60, 45, 46),
+	}
+
+	tests := []struct {
+		name    string
+		entries []*mb8600.LogEntry
+		want    []*Incident
+	}{
+		{
+			"upstream power",
+			[]*mb8600.LogEntry{entry(13, mb8600.EventT3Timeout)},
+			[]*Incident{{
+				Code:        mb8600.EventT3Timeout,
+				Start:       at(13),
+				End:         at(13),
+				Count:       1,
+				Description: "T3_TIMEOUT",
+				Errors:      []ChannelErrors{{ChannelID: 20, Corrected: 600, Uncorrected: 300}},
+				Upstream: []UpstreamPower{
+					{ChannelID: 3, Power: 45},
+					{ChannelID: 4, Power: 54, OutOfRange: true},
+				},
+				Summary: "T3 timeout at 02:13, upstream ch4 power 54.0 dBmV, downstream ch20 300 uncorrected",
+			}},
+		},
+		{
+			"merged repeats",
+			// Newest first, as logged by the modem.
+			[]*mb8600.LogEntry{
+				entry(34, mb8600.EventSyncLoss),
+				entry(32, mb8600.EventSyncLoss),
+				entry(31, mb8600.EventSyncLoss),
+			},
+			[]*Incident{{
+				Code:        mb8600.EventSyncLoss,
+				Start:       at(31),
+				End:         at(34),
+				Count:       3,
+				Description: "SYNC_LOSS",
+				Summary:     "SYNC loss at 02:31 (3 times until 02:34)",
+			}},
+		},
+		{
+			"counter reset skipped",
+			[]*mb8600.LogEntry{entry(41, mb8600.EventRebootPower)},
+			[]*Incident{{
+				Code:        mb8600.EventRebootPower,
+				Start:       at(41),
+				End:         at(41),
+				Count:       1,
+				Description: "REBOOT_POWER",
+				Errors:      []ChannelErrors{{ChannelID: 20, Corrected: 100, Uncorrected: 50}},
+				Summary:     "Reboot after power loss at 02:41, downstream ch20 50 uncorrected",
+			}},
+		},
+		{
+			"highest power when in range",
+			[]*mb8600.LogEntry{entry(29, mb8600.EventT4Timeout)},
+			[]*Incident{{
+				Code:        mb8600.EventT4Timeout,
+				Start:       at(29),
+				End:         at(29),
+				Count:       1,
+				Description: "T4_TIMEOUT",
+				Upstream:    []UpstreamPower{{ChannelID: 3, Power: 45}, {ChannelID: 4, Power: 46}},
+				Summary:     "T4 timeout at 02:29, upstream ch4 power 46.0 dBmV",
+			}},
+		},
+		{
+			"ignored entries",
+			[]*mb8600.LogEntry{
+				entry(13, mb8600.EventRegistrationComplete),
+				{Code: mb8600.EventT3Timeout, Description: "Time Not Established"},
+			},
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Correlate(tt.entries, snapshots, DefaultConfig())
+			if !reflect.DeepEqual(got, tt.want) {
+				for _, incident := range got {
+					t.Logf("got %+v", incident)
+				}
+				t.Errorf("Correlate() = %d incidents, want %d", len(got), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestCorrelate_codes(t *testing.T) {
+	entries := []*mb8600.LogEntry{entry(1, mb8600.EventDHCPRenew), entry(2, mb8600.EventT3Timeout)}
+	snapshots := []*mb8600.Snapshot{snapshot(0, 0, 45, 46)}
+
+	got := Correlate(entries, snapshots, Config{Codes: []mb8600.EventCode{mb8600.EventDHCPRenew}})
+	if len(got) != 1 || got[0].Code != mb8600.EventDHCPRenew || got[0].Summary != "DHCP renew at 02:01" {
+		t.Errorf("Correlate() with codes = %+v", got)
+	}
+
+	// The zero configuration uses the default codes and thresholds.
+	got = Correlate(entries, snapshots, Config{})
+	if len(got) != 2 || got[1].Summary != "T3 timeout at 02:02, upstream ch4 power 46.0 dBmV" {
+		t.Errorf("Correlate() with zero config = %+v", got)
+	}
+}
@@ -0,0 +1,256 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fleet polls several modems at once, e.g. the modems of the units of
+// a building or of a lab, merging their events into a single stream and
+// their latest snapshots into a single set of metrics. Every modem is polled
+// by its own supervised task, so a modem failing or hanging never stalls the
+// others.
+package fleet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/mb8600"
+	"github.com/thelande/mb8600/pkg/supervisor"
+)
+
+const eventBufferSize = 256
+
+// The label holding the device name, which device labels cannot use.
+const DeviceLabel = "device"
+
+var labelNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// An event of one of the devices of a Manager.
+type Event struct {
+	mb8600.Event
+	Device string            `json:"device"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// The state of a device of a Manager.
+type DeviceStatus struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	// The latest successful snapshot, or nil.
+	Snapshot *mb8600.Snapshot `json:"snapshot,omitempty"`
+	// The error of the latest poll, or nil if it succeeded.
+	Err error `json:"-"`
+	// The supervision of the device's poller.
+	Supervision supervisor.Status `json:"supervision"`
+}
+
+// Adds the device name to every record.
+type deviceLogger struct {
+	mb8600.Logger
+	name string
+}
+
+func (l deviceLogger) Log(keyvals ...any) error {
+	return l.Logger.Log(append(keyvals, DeviceLabel, l.name)...)
+}
+
+type device struct {
+	name   string
+	labels map[string]string
+	client mb8600.PollerClient
+
+	mu     sync.Mutex
+	poller *mb8600.Poller
+}
+
+// Returns the poller of the device's current task, or nil before it started.
+func (d *device) current() *mb8600.Poller {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.poller
+}
+
+// Polls a fleet of modems concurrently. Devices are added before Run, which
+// polls each of them every interval in its own supervised task.
+type Manager struct {
+	interval time.Duration
+	logger   mb8600.Logger
+	// How the task polling a device is restarted when it fails or panics.
+	Policy supervisor.Policy
+
+	devices []*device
+	byName  map[string]*device
+	events  chan Event
+	group   *supervisor.Group
+	running bool
+	mu      sync.Mutex
+}
+
+// Returns a manager without devices polling every interval.
+func NewManager(interval time.Duration, logger mb8600.Logger) *Manager {
+	return &Manager{
+		interval: interval,
+		logger:   logger,
+		Policy:   supervisor.DefaultPolicy(),
+		byName:   map[string]*device{},
+		events:   make(chan Event, eventBufferSize),
+	}
+}
+
+// Adds the device name polled through client, e.g. a *mb8600.MotoClient,
+// whose events and metrics are labelled with name and labels. Must be called
+// before Run.
+func (m *Manager) Add(name string, client mb8600.PollerClient, labels map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch {
+	case m.running:
+		return errors.New("devices cannot be added while the manager runs")
+	case name == "":
+		return errors.New("device name must not be empty")
+	case m.byName[name] != nil:
+		return fmt.Errorf("duplicate device %q", name)
+	}
+	for label := range labels {
+		if !labelNameRegexp.MatchString(label) || label == DeviceLabel {
+			return fmt.Errorf("invalid label %q of device %s", label, name)
+		}
+	}
+
+	// The labels are copied so the caller changing them later cannot race
+	// with the events and metrics reading them.
+	d := &device{name: name, labels: maps.Clone(labels), client: client}
+	m.devices = append(m.devices, d)
+	m.byName[name] = d
+	return nil
+}
+
+// Returns the channel the events of every device are delivered on. It is
+// closed when Run returns.
+func (m *Manager) Events() <-chan Event {
+	return m.events
+}
+
+// Polls every device until ctx is cancelled, sending their events on the
+// Events channel. Blocks if the events are not consumed.
+func (m *Manager) Run(ctx context.Context) error {
+	m.mu.Lock()
+	if m.running {
+		m.mu.Unlock()
+		return errors.New("manager is already running")
+	}
+	m.running = true
+	m.group = supervisor.NewGroup(m.Policy, m.logger)
+	devices := m.devices
+	m.mu.Unlock()
+	defer close(m.events)
+
+	for _, d := range devices {
+		d := d
+		m.group.Go(ctx, d.name, func(ctx context.Context) error {
+			return m.poll(ctx, d)
+		})
+	}
+	m.group.Wait()
+	return ctx.Err()
+}
+
+// Polls d until ctx is cancelled, forwarding its events. Every run gets a
+// new poller, as a poller cannot be run again after it stopped, so a restart
+// forgets the device's latest snapshot.
+func (m *Manager) poll(ctx context.Context, d *device) error {
+	var logger mb8600.Logger
+	if m.logger != nil {
+		logger = deviceLogger{m.logger, d.name}
+	}
+	poller := mb8600.NewPoller(d.client, m.interval, logger)
+	d.mu.Lock()
+	d.poller = poller
+	d.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- poller.Run(ctx) }()
+
+	for event := range poller.Events() {
+		select {
+		case m.events <- Event{Event: event, Device: d.name, Labels: d.labels}:
+		case <-ctx.Done():
+		}
+	}
+	return <-done
+}
+
+// Returns the status of every device, in the order they were added.
+func (m *Manager) Statuses() []DeviceStatus {
+	m.mu.Lock()
+	group, devices := m.group, m.devices
+	m.mu.Unlock()
+
+	supervision := map[string]supervisor.Status{}
+	if group != nil {
+		for _, status := range group.Statuses() {
+			supervision[status.Name] = status
+		}
+	}
+
+	statuses := make([]DeviceStatus, 0, len(devices))
+	for _, d := range devices {
+		status := DeviceStatus{Name: d.name, Labels: d.labels, Supervision: supervision[d.name]}
+		if poller := d.current(); poller != nil {
+			status.Snapshot = poller.Last()
+			status.Err = poller.Err()
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// Returns the status of the device name, and false if there is none.
+func (m *Manager) Status(name string) (DeviceStatus, bool) {
+	for _, status := range m.Statuses() {
+		if status.Name == name {
+			return status, true
+		}
+	}
+	return DeviceStatus{}, false
+}
+
+// Returns the names of the labels of the devices, sorted.
+func (m *Manager) labelNames() []string {
+	m.mu.Lock()
+	devices := m.devices
+	m.mu.Unlock()
+
+	seen := map[string]bool{}
+	var names []string
+	for _, d := range devices {
+		for name := range d.labels {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fleet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+// A client reporting a single downstream and upstream channel, with the
+// downstream channel's lock status toggled by unlock, or failing with err.
+type fakeClient struct {
+	mu     sync.Mutex
+	err    error
+	unlock bool
+	panic  bool
+}
+
+func (c *fakeClient) Login() (map[string]string, error) {
+	return nil, nil
+}
+
+func (c *fakeClient) GetDownstreamChannels() ([]*mb8600.DownstreamChannel, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.panic {
+		panic("malformed response")
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+	status := "Locked"
+	if c.unlock {
+		status = "Not Locked"
+	}
+	return []*mb8600.DownstreamChannel{
+		{ChannelID: 1, LockStatus: status, Modulation: "QAM256", Power: 2.5, SignalToNoise: 40},
+	}, nil
+}
+
+func (c *fakeClient) GetUpstreamChannels() ([]*mb8600.UpstreamChannel, error) {
+	return []*mb8600.UpstreamChannel{{ChannelID: 2, LockStatus: "Locked", ChannelType: "SC-QAM", Power: 45}}, nil
+}
+
+func (c *fakeClient) set(fn func(c *fakeClient)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fn(c)
+}
+
+// Runs m until cond returns true, failing the test after a second.
+func runUntil(t *testing.T, m *Manager, cond func() bool) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- m.Run(ctx) }()
+	go func() {
+		for range m.Events() {
+		}
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met, statuses: %+v", m.Statuses())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestManager_Add(t *testing.T) {
+	m := NewManager(time.Minute, nil)
+	tests := []struct {
+		name    string
+		device  string
+		labels  map[string]string
+		wantErr bool
+	}{
+		{"valid", "unit-1", map[string]string{"building": "north"}, false},
+		{"duplicate", "unit-1", nil, true},
+		{"empty name", "", nil, true},
+		{"invalid label", "unit-2", map[string]string{"floor-no": "2"}, true},
+		{"reserved label", "unit-3", map[string]string{DeviceLabel: "x"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := m.Add(tt.device, &fakeClient{}, tt.labels); (err != nil) != tt.wantErr {
+				t.Errorf("Add() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestManager_Add_concurrent(t *testing.T) {
+	m := NewManager(time.Minute, nil)
+	labels := map[string]string{"building": "north"}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			m.Statuses()
+			m.labelNames()
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		if err := m.Add(fmt.Sprintf("unit-%d", i), &fakeClient{}, labels); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+	wg.Wait()
+
+	labels["building"] = "south"
+	if status, _ := m.Status("unit-0"); status.Labels["building"] != "north" {
+		t.Errorf("device labels = %v, want the labels as added", status.Labels)
+	}
+}
+
+func TestManager_Run(t *testing.T) {
+	healthy := &fakeClient{}
+	failing := &fakeClient{err: errors.New("connection refused")}
+	panicking := &fakeClient{panic: true}
+
+	m := NewManager(time.Millisecond, nil)
+	for name, client := range map[string]*fakeClient{"healthy": healthy, "failing": failing, "panicking": panicking} {
+		if err := m.Add(name, client, map[string]string{"site": "lab"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runUntil(t, m, func() bool {
+		h, _ := m.Status("healthy")
+		f, _ := m.Status("failing")
+		p, _ := m.Status("panicking")
+		return h.Snapshot != nil && f.Err != nil && p.Err != nil
+	})
+
+	for _, status := range m.Statuses() {
+		if status.Name != "healthy" && status.Snapshot != nil {
+			t.Errorf("device %s has a snapshot", status.Name)
+		}
+		if status.Labels["site"] != "lab" {
+			t.Errorf("device %s labels = %v", status.Name, status.Labels)
+		}
+	}
+	if _, ok := m.Status("missing"); ok {
+		t.Error("Status() found a missing device")
+	}
+	if err := m.Add("late", &fakeClient{}, nil); err == nil {
+		t.Error("Add() succeeded after Run")
+	}
+}
+
+func TestManager_Events(t *testing.T) {
+	client := &fakeClient{}
+	m := NewManager(time.Millisecond, nil)
+	if err := m.Add("unit-1", client, map[string]string{"site": "lab"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- m.Run(ctx) }()
+
+	for {
+		status, _ := m.Status("unit-1")
+		if status.Snapshot != nil {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	client.set(func(c *fakeClient) { c.unlock = true })
+
+	select {
+	case event := <-m.Events():
+		if event.Type != mb8600.ChannelLostLock || event.Device != "unit-1" || event.Labels["site"] != "lab" {
+			t.Errorf("event = %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event")
+	}
+
+	cancel()
+	for range m.Events() {
+	}
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() error = %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fleet
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+// A metric family in the Prometheus text exposition format.
+type metricFamily struct {
+	name, help, kind string
+	samples          []metricSample
+}
+
+type metricSample struct {
+	labels []string // alternating names and values
+	value  float64
+}
+
+func (f *metricFamily) add(value float64, labels ...string) {
+	f.samples = append(f.samples, metricSample{labels: labels, value: value})
+}
+
+func (f *metricFamily) writeTo(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+	for _, s := range f.samples {
+		pairs := make([]string, 0, len(s.labels)/2)
+		for i := 0; i+1 < len(s.labels); i += 2 {
+			pairs = append(pairs, s.labels[i]+"="+strconv.Quote(s.labels[i+1]))
+		}
+		fmt.Fprintf(w, "%s{%s} %s\n", f.name, strings.Join(pairs, ","), strconv.FormatFloat(s.value, 'g', -1, 64))
+	}
+}
+
+func gauge(name, help string) *metricFamily {
+	return &metricFamily{name: "mb8600_" + name, help: help, kind: "gauge"}
+}
+
+func counter(name, help string) *metricFamily {
+	return &metricFamily{name: "mb8600_" + name, help: help, kind: "counter"}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Writes the metrics of the latest snapshot of every device to w in the
+// Prometheus text exposition format, under the names mb8600d uses for a
+// single modem. Every sample is labelled with the device name and the
+// device's labels, devices without one of the labels getting an empty value.
+func (m *Manager) WriteMetrics(w io.Writer) {
+	labelNames := m.labelNames()
+
+	up := gauge("up", "Whether the modem has been polled successfully.")
+	lastPoll := gauge("last_poll_timestamp_seconds", "The time of the latest successful poll.")
+	restarts := counter("poller_restarts_total", "The restarts of the task polling the modem.")
+	dsLocked := gauge("downstream_locked", "Whether the downstream channel is locked.")
+	dsPower := gauge("downstream_power_dbmv", "The received power of the downstream channel.")
+	dsSNR := gauge("downstream_snr_db", "The signal-to-noise ratio of the downstream channel.")
+	dsCorrected := counter("downstream_corrected_total", "The corrected codewords of the downstream channel since the modem booted.")
+	dsUncorrected := counter("downstream_uncorrected_total", "The uncorrected codewords of the downstream channel since the modem booted.")
+	usLocked := gauge("upstream_locked", "Whether the upstream channel is locked.")
+	usPower := gauge("upstream_power_dbmv", "The transmit power of the upstream channel.")
+
+	for _, status := range m.Statuses() {
+		device := []string{DeviceLabel, status.Name}
+		for _, name := range labelNames {
+			device = append(device, name, status.Labels[name])
+		}
+		// Channel labels are appended to copies of the device labels.
+		labels := func(extra ...string) []string {
+			return append(append(make([]string, 0, len(device)+len(extra)), device...), extra...)
+		}
+
+		snapshot := status.Snapshot
+		up.add(boolValue(snapshot != nil && status.Err == nil), device...)
+		restarts.add(float64(status.Supervision.Restarts), device...)
+		if snapshot == nil {
+			continue
+		}
+		lastPoll.add(float64(snapshot.Time.UnixNano())/1e9, device...)
+
+		downstream := append([]*mb8600.DownstreamChannel(nil), snapshot.Downstream...)
+		mb8600.SortDownstreamByChannelID(downstream)
+		for _, ch := range downstream {
+			l := labels("channel_id", strconv.Itoa(ch.ChannelID), "modulation", ch.Modulation)
+			dsLocked.add(boolValue(ch.LockStatus == "Locked"), l...)
+			dsPower.add(ch.Power, l...)
+			dsSNR.add(ch.SignalToNoise, l...)
+			dsCorrected.add(ch.CorrectedErrors, l...)
+			dsUncorrected.add(ch.UncorrectedErrors, l...)
+		}
+		upstream := append([]*mb8600.UpstreamChannel(nil), snapshot.Upstream...)
+		mb8600.SortUpstreamByChannelID(upstream)
+		for _, ch := range upstream {
+			l := labels("channel_id", strconv.Itoa(ch.ChannelID), "channel_type", ch.ChannelType)
+			usLocked.add(boolValue(ch.LockStatus == "Locked"), l...)
+			usPower.add(ch.Power, l...)
+		}
+	}
+
+	families := []*metricFamily{up, lastPoll, restarts, dsLocked, dsPower, dsSNR, dsCorrected, dsUncorrected, usLocked, usPower}
+	sort.SliceStable(families, func(i, j int) bool { return families[i].name < families[j].name })
+	for _, f := range families {
+		if len(f.samples) > 0 {
+			f.writeTo(w)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fleet
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManager_WriteMetrics(t *testing.T) {
+	m := NewManager(time.Millisecond, nil)
+	if err := m.Add("unit-1", &fakeClient{}, map[string]string{"building": "north"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Add("unit-2", &fakeClient{err: errors.New("timeout")}, nil); err != nil {
+		t.Fatal(err)
+	}
+	runUntil(t, m, func() bool {
+		status, _ := m.Status("unit-1")
+		return status.Snapshot != nil
+	})
+
+	var b strings.Builder
+	m.WriteMetrics(&b)
+	got := b.String()
+	for _, want := range []string{
+		`mb8600_up{device="unit-1",building="north"} 1`,
+		`mb8600_up{device="unit-2",building=""} 0`,
+		`mb8600_downstream_snr_db{device="unit-1",building="north",channel_id="1",modulation="QAM256"} 40`,
+		`mb8600_upstream_power_dbmv{device="unit-1",building="north",channel_id="2",channel_type="SC-QAM"} 45`,
+		"# TYPE mb8600_downstream_uncorrected_total counter",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("WriteMetrics() missing %s in:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, `downstream_snr_db{device="unit-2"`) {
+		t.Errorf("WriteMetrics() has channels of a failing device:\n%s", got)
+	}
+}
@@ -0,0 +1,438 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package graphql serves a read-only GraphQL endpoint over the JSON form of
+// the modem data model, so clients can select only the fields they need.
+//
+// Only the query subset needed for that is supported: selection sets, aliases
+// and literal arguments. Arguments on list fields filter the list by equality,
+// e.g. `{ downstream(kind: "OFDM") { channel_id snr_db } }`. Variables,
+// fragments, directives and introspection are not supported.
+package graphql
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	// The maximum size of a POST body. Queries of the data model are far
+	// smaller.
+	maxRequestSize = 64 << 10
+	// The maximum nesting of selection sets, well beyond the depth of the
+	// data model, which bounds the recursion of the parser.
+	maxDepth = 16
+)
+
+// A field in a selection set.
+type Field struct {
+	Alias      string
+	Name       string
+	Args       map[string]any
+	Selections []*Field
+}
+
+type parser struct {
+	src string
+	pos int
+	// The number of selection sets being parsed.
+	depth int
+}
+
+// Parses a query document into its top-level selection set.
+func Parse(query string) ([]*Field, error) {
+	p := &parser{src: query}
+
+	p.skipIgnored()
+	if word := p.peekName(); word == "query" {
+		p.readName()
+		p.skipIgnored()
+		// Optional operation name.
+		if p.peekName() != "" {
+			p.readName()
+		}
+	} else if word != "" {
+		return nil, fmt.Errorf("unsupported operation: %s", word)
+	}
+
+	selections, err := p.parseSelectionSet()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipIgnored()
+	if p.pos < len(p.src) {
+		return nil, p.errorf("unexpected %q", p.src[p.pos])
+	}
+	return selections, nil
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("syntax error at offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+// Skips whitespace, commas and comments, which are insignificant in GraphQL.
+func (p *parser) skipIgnored() {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		case c == ',' || unicode.IsSpace(rune(c)):
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) expect(c byte) error {
+	p.skipIgnored()
+	if p.pos >= len(p.src) || p.src[p.pos] != c {
+		return p.errorf("expected %q", c)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *parser) peek() byte {
+	p.skipIgnored()
+	if p.pos >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func isNameChar(c byte, first bool) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (!first && c >= '0' && c <= '9')
+}
+
+func (p *parser) peekName() string {
+	end := p.pos
+	for end < len(p.src) && isNameChar(p.src[end], end == p.pos) {
+		end++
+	}
+	return p.src[p.pos:end]
+}
+
+func (p *parser) readName() (string, error) {
+	p.skipIgnored()
+	name := p.peekName()
+	if name == "" {
+		return "", p.errorf("expected name")
+	}
+	p.pos += len(name)
+	return name, nil
+}
+
+func (p *parser) parseSelectionSet() ([]*Field, error) {
+	if err := p.expect('{'); err != nil {
+		return nil, err
+	}
+	if p.depth++; p.depth > maxDepth {
+		return nil, p.errorf("selection sets nested deeper than %d", maxDepth)
+	}
+	defer func() { p.depth-- }()
+
+	var fields []*Field
+	for {
+		switch p.peek() {
+		case '}':
+			p.pos++
+			if len(fields) == 0 {
+				return nil, p.errorf("empty selection set")
+			}
+			return fields, nil
+		case 0:
+			return nil, p.errorf("unterminated selection set")
+		case '.':
+			return nil, p.errorf("fragments are not supported")
+		}
+
+		field, err := p.parseField()
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+}
+
+func (p *parser) parseField() (*Field, error) {
+	name, err := p.readName()
+	if err != nil {
+		return nil, err
+	}
+	field := &Field{Alias: name, Name: name}
+
+	if p.peek() == ':' {
+		p.pos++
+		if field.Name, err = p.readName(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.peek() == '(' {
+		p.pos++
+		field.Args = map[string]any{}
+		for p.peek() != ')' {
+			arg, err := p.readName()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(':'); err != nil {
+				return nil, err
+			}
+			if field.Args[arg], err = p.parseValue(); err != nil {
+				return nil, err
+			}
+		}
+		p.pos++
+	}
+
+	switch p.peek() {
+	case '{':
+		if field.Selections, err = p.parseSelectionSet(); err != nil {
+			return nil, err
+		}
+	case '@':
+		return nil, p.errorf("directives are not supported")
+	}
+
+	return field, nil
+}
+
+func (p *parser) parseValue() (any, error) {
+	switch c := p.peek(); {
+	case c == '"':
+		end := p.pos + 1
+		for end < len(p.src) && p.src[end] != '"' {
+			if p.src[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(p.src) {
+			return nil, p.errorf("unterminated string")
+		}
+		value, err := strconv.Unquote(p.src[p.pos : end+1])
+		if err != nil {
+			return nil, p.errorf("invalid string: %v", err)
+		}
+		p.pos = end + 1
+		return value, nil
+	case c == '-' || (c >= '0' && c <= '9'):
+		end := p.pos + 1
+		for end < len(p.src) && strings.ContainsRune("0123456789.eE+-", rune(p.src[end])) {
+			end++
+		}
+		value, err := strconv.ParseFloat(p.src[p.pos:end], 64)
+		if err != nil {
+			return nil, p.errorf("invalid number: %v", err)
+		}
+		p.pos = end
+		return value, nil
+	case c == '$':
+		return nil, p.errorf("variables are not supported")
+	default:
+		name, err := p.readName()
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		// Enum values are compared as strings.
+		return name, nil
+	}
+}
+
+// Resolves selections against data, which is first converted to its JSON
+// form so that field names match the JSON field names.
+func Execute(selections []*Field, data any) (map[string]any, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var root any
+	if err := json.Unmarshal(raw, &root); err != nil {
+		return nil, err
+	}
+	if root == nil {
+		return nil, fmt.Errorf("no data available")
+	}
+
+	result, err := resolve(selections, root, "")
+	if err != nil {
+		return nil, err
+	}
+	out, _ := result.(map[string]any)
+	return out, nil
+}
+
+func resolve(selections []*Field, value any, path string) (any, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		out := make([]any, 0, len(v))
+		for _, elem := range v {
+			resolved, err := resolve(selections, elem, path)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, resolved)
+		}
+		return out, nil
+	case map[string]any:
+		out := map[string]any{}
+		for _, field := range selections {
+			fieldPath := strings.TrimPrefix(path+"."+field.Name, ".")
+			child, ok := v[field.Name]
+			if !ok {
+				return nil, fmt.Errorf("cannot query field %q", fieldPath)
+			}
+
+			if len(field.Args) > 0 {
+				list, ok := child.([]any)
+				if !ok {
+					return nil, fmt.Errorf("arguments are only supported on list fields: %q", fieldPath)
+				}
+				child = filter(list, field.Args)
+			}
+
+			if field.Selections == nil {
+				if isObject(child) {
+					return nil, fmt.Errorf("field %q must have a selection of subfields", fieldPath)
+				}
+				out[field.Alias] = child
+				continue
+			}
+
+			resolved, err := resolve(field.Selections, child, fieldPath)
+			if err != nil {
+				return nil, err
+			}
+			out[field.Alias] = resolved
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("field %q of a scalar type cannot have a selection", path)
+	}
+}
+
+func isObject(value any) bool {
+	switch v := value.(type) {
+	case map[string]any:
+		return true
+	case []any:
+		return len(v) > 0 && isObject(v[0])
+	}
+	return false
+}
+
+// Returns the elements of list whose fields equal every argument.
+func filter(list []any, args map[string]any) []any {
+	out := []any{}
+	for _, elem := range list {
+		obj, ok := elem.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		match := true
+		for name, want := range args {
+			if fmt.Sprint(obj[name]) != fmt.Sprint(want) {
+				match = false
+				break
+			}
+		}
+		if match {
+			out = append(out, elem)
+		}
+	}
+	return out
+}
+
+type request struct {
+	Query string `json:"query"`
+}
+
+type gqlError struct {
+	Message string `json:"message"`
+}
+
+type response struct {
+	Data   map[string]any `json:"data,omitempty"`
+	Errors []gqlError     `json:"errors,omitempty"`
+}
+
+// Returns a handler executing queries against the value returned by data.
+// Queries are accepted as a JSON POST body of up to 64 KiB or in the query
+// parameter of a GET.
+func Handler(data func() any) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req request
+		switch r.Method {
+		case http.MethodGet:
+			req.Query = r.URL.Query().Get("query")
+		case http.MethodPost:
+			body := http.MaxBytesReader(w, r.Body, maxRequestSize)
+			if err := json.NewDecoder(body).Decode(&req); err != nil {
+				status := http.StatusBadRequest
+				if tooLarge := (*http.MaxBytesError)(nil); errors.As(err, &tooLarge) {
+					status = http.StatusRequestEntityTooLarge
+				}
+				writeResponse(w, status, response{Errors: []gqlError{{err.Error()}}})
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		selections, err := Parse(req.Query)
+		if err != nil {
+			writeResponse(w, http.StatusBadRequest, response{Errors: []gqlError{{err.Error()}}})
+			return
+		}
+
+		result, err := Execute(selections, data())
+		if err != nil {
+			writeResponse(w, http.StatusOK, response{Errors: []gqlError{{err.Error()}}})
+			return
+		}
+		writeResponse(w, http.StatusOK, response{Data: result})
+	})
+}
+
+func writeResponse(w http.ResponseWriter, status int, resp response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
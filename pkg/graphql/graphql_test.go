@@ -0,0 +1,165 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package graphql
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+var snapshot = &mb8600.Snapshot{
+	Downstream: []*mb8600.DownstreamChannel{
+		{Channel: 1, ChannelID: 20, LockStatus: "Locked", Modulation: "QAM256", SignalToNoise: 45.1},
+		{Channel: 33, ChannelID: 193, LockStatus: "Locked", Modulation: "OFDM PLC", SignalToNoise: 43.0},
+	},
+	Upstream: []*mb8600.UpstreamChannel{
+		{Channel: 1, ChannelID: 4, LockStatus: "Locked", ChannelType: "SC-QAM", Power: 45.0},
+	},
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    string
+		wantErr bool
+	}{
+		{
+			"shorthand",
+			`{ upstream { channel_id power_dbmv } }`,
+			`{"upstream":[{"channel_id":4,"power_dbmv":45}]}`,
+			false,
+		},
+		{
+			"filter and alias",
+			`query OFDM {
+				# Only OFDM channels.
+				ofdm: downstream(kind: "OFDM") { id: channel_id, snr_db }
+			}`,
+			`{"ofdm":[{"id":193,"snr_db":43}]}`,
+			false,
+		},
+		{
+			"numeric filter",
+			`{ downstream(channel_id: 20) { modulation } }`,
+			`{"downstream":[{"modulation":"QAM256"}]}`,
+			false,
+		},
+		{"unknown field", `{ downstream { bogus } }`, "", true},
+		{"missing selection", `{ downstream }`, "", true},
+		{"scalar selection", `{ time { bogus } }`, "", true},
+		{"scalar arguments", `{ time(x: 1) }`, "", true},
+		{"mutation", `mutation { reboot }`, "", true},
+		{"fragment", `{ downstream { ...Fields } }`, "", true},
+		{"variable", `{ downstream(kind: $kind) { snr_db } }`, "", true},
+		{"unterminated", `{ downstream { snr_db }`, "", true},
+		{"empty", `{ }`, "", true},
+		{"too deep", strings.Repeat("{ a ", maxDepth) + "{ b }" + strings.Repeat(" }", maxDepth), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selections, err := Parse(tt.query)
+			var got map[string]any
+			if err == nil {
+				got, err = Execute(selections, snapshot)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse()/Execute() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+
+			data, _ := json.Marshal(got)
+			if string(data) != tt.want {
+				t.Errorf("Execute() = %s, want %s", data, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	var current *mb8600.Snapshot
+	server := httptest.NewServer(Handler(func() any { return current }))
+	defer server.Close()
+
+	query := `{ upstream { channel_id } }`
+
+	resp, err := http.Get(server.URL + "?query=" + url.QueryEscape(query))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body response
+	json.NewDecoder(resp.Body).Decode(&body)
+	resp.Body.Close()
+	if len(body.Errors) != 1 {
+		t.Errorf("errors = %v, want no data error", body.Errors)
+	}
+
+	current = snapshot
+	resp, err = http.Post(server.URL, "application/json", strings.NewReader(`{"query": "{ upstream { channel_id } }"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body = response{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || len(body.Errors) != 0 || body.Data["upstream"] == nil {
+		t.Errorf("POST = %v %+v, want data", resp.StatusCode, body)
+	}
+
+	resp, err = http.Post(server.URL, "application/json", strings.NewReader(`{"query": "{"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("POST status = %v, want %v", resp.StatusCode, http.StatusBadRequest)
+	}
+
+	large := `{"query": "{ upstream { channel_id } }` + strings.Repeat(" ", maxRequestSize) + `"}`
+	resp, err = http.Post(server.URL, "application/json", strings.NewReader(large))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body = response{}
+	json.NewDecoder(resp.Body).Decode(&body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge || len(body.Errors) != 1 {
+		t.Errorf("POST of %d bytes = %v %+v, want %v with an error", len(large), resp.StatusCode, body, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestParse_depth(t *testing.T) {
+	nested := func(depth int) string {
+		return strings.Repeat("{ a ", depth-1) + "{ b }" + strings.Repeat(" }", depth-1)
+	}
+	if _, err := Parse(nested(maxDepth)); err != nil {
+		t.Errorf("Parse() of depth %d error = %v", maxDepth, err)
+	}
+	// Far deeper than the parser could recurse without the limit.
+	if _, err := Parse(nested(1 << 20)); err == nil || !strings.Contains(err.Error(), "nested deeper") {
+		t.Errorf("Parse() of depth %d error = %v, want nesting error", 1<<20, err)
+	}
+}
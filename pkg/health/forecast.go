@@ -0,0 +1,210 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"math"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/i18n"
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+// The fewest samples a trend is fitted to.
+const minForecastSamples = 3
+
+// A channel metric projected to cross its limit, from a linear fit of its
+// history.
+type Forecast struct {
+	Direction string
+	ChannelID int
+	// The name of the metric, "power" or "uncorrected errors per hour".
+	Metric string
+	// The fitted value at the time of the latest sample, and the limit it is
+	// heading for.
+	Current float64
+	Limit   float64
+	// The change of the metric per day.
+	Slope float64
+	// The estimated time until the limit is crossed.
+	Remaining time.Duration
+	Reason    string
+
+	reason reason
+}
+
+// Returns the reason for the forecast translated by p.
+func (f *Forecast) LocalizedReason(p *i18n.Printer) string {
+	return f.reason.render(p)
+}
+
+// Evaluates the latest snapshot in history against the one before it, as
+// Evaluate does, and forecasts when trending upstream power levels and
+// downstream uncorrected error rates will cross their limits. History must be
+// ordered oldest first.
+func EvaluateHistory(history []*mb8600.Snapshot, thresholds Thresholds) *Report {
+	if len(history) == 0 {
+		return &Report{}
+	}
+
+	var prev *mb8600.Snapshot
+	if len(history) > 1 {
+		prev = history[len(history)-2]
+	}
+	report := Evaluate(history[len(history)-1], prev, thresholds)
+	report.Forecasts = Forecasts(history, thresholds)
+	return report
+}
+
+// Returns the metrics in history projected to cross their limits within
+// thresholds.ForecastHorizon, downstream channels first. Metrics already
+// beyond their limits are left to Evaluate.
+func Forecasts(history []*mb8600.Snapshot, thresholds Thresholds) []*Forecast {
+	if thresholds.ForecastHorizon <= 0 || len(history) < minForecastSamples {
+		return nil
+	}
+
+	var forecasts []*Forecast
+	for _, id := range channelIDs(history, mb8600.DirectionDownstream) {
+		var samples []sample
+		for idx := 1; idx < len(history); idx++ {
+			prev, curr := downstreamChannel(history[idx-1], id), downstreamChannel(history[idx], id)
+			hours := history[idx].Time.Sub(history[idx-1].Time).Hours()
+			// Counter resets, e.g. after a reboot, break the series.
+			if prev == nil || curr == nil || hours <= 0 || curr.UncorrectedErrors < prev.UncorrectedErrors {
+				continue
+			}
+			samples = append(samples, sample{history[idx].Time, (curr.UncorrectedErrors - prev.UncorrectedErrors) / hours})
+		}
+		if f := forecast(samples, 0, thresholds.MaxUncorrectedPerHour, thresholds.ForecastHorizon); f != nil {
+			f.Direction, f.ChannelID, f.Metric = mb8600.DirectionDownstream, id, "uncorrected errors per hour"
+			forecasts = append(forecasts, f.explain())
+		}
+	}
+
+	for _, id := range channelIDs(history, mb8600.DirectionUpstream) {
+		var samples []sample
+		for _, snapshot := range history {
+			for _, ch := range snapshot.Upstream {
+				if ch.ChannelID == id && ch.LockStatus == "Locked" {
+					samples = append(samples, sample{snapshot.Time, ch.Power})
+				}
+			}
+		}
+		if f := forecast(samples, thresholds.UpstreamPowerMin, thresholds.UpstreamPowerMax, thresholds.ForecastHorizon); f != nil {
+			f.Direction, f.ChannelID, f.Metric = mb8600.DirectionUpstream, id, "power"
+			forecasts = append(forecasts, f.explain())
+		}
+	}
+
+	return forecasts
+}
+
+type sample struct {
+	time  time.Time
+	value float64
+}
+
+// Fits a line to samples and returns when it leaves min..max, or nil if it
+// does not within horizon, already has, or there are too few samples.
+func forecast(samples []sample, min, max float64, horizon time.Duration) *Forecast {
+	if len(samples) < minForecastSamples {
+		return nil
+	}
+
+	// Least squares fit of the value against days since the first sample.
+	origin := samples[0].time
+	var sumX, sumY, sumXY, sumXX float64
+	for _, s := range samples {
+		x := s.time.Sub(origin).Hours() / 24
+		sumX += x
+		sumY += s.value
+		sumXY += x * s.value
+		sumXX += x * x
+	}
+	n := float64(len(samples))
+	denom := n*sumXX - sumX*sumX
+	if denom == 0 {
+		return nil
+	}
+	slope := (n*sumXY - sumX*sumY) / denom
+	intercept := (sumY - slope*sumX) / n
+
+	last := samples[len(samples)-1].time.Sub(origin).Hours() / 24
+	current := intercept + slope*last
+	if current < min || current > max {
+		return nil
+	}
+
+	var limit float64
+	switch {
+	case slope > 0:
+		limit = max
+	case slope < 0:
+		limit = min
+	default:
+		return nil
+	}
+
+	days := (limit - current) / slope
+	remaining := time.Duration(days * 24 * float64(time.Hour))
+	if remaining > horizon {
+		return nil
+	}
+	return &Forecast{Current: current, Limit: limit, Slope: slope, Remaining: remaining}
+}
+
+// Sets the reason of the forecast.
+func (f *Forecast) explain() *Forecast {
+	days := max(int(math.Ceil(f.Remaining.Hours()/24)), 1)
+	format := "%s projected to exceed %.1f in ~%d days"
+	if f.Slope < 0 {
+		format = "%s projected to fall below %.1f in ~%d days"
+	}
+	f.reason = reason{format, []any{term(f.Metric), f.Limit, days}}
+	f.Reason = f.reason.render(nil)
+	return f
+}
+
+// Returns the IDs of the channels in direction seen anywhere in history, in
+// order of first appearance.
+func channelIDs(history []*mb8600.Snapshot, direction string) []int {
+	var ids []int
+	seen := map[int]bool{}
+	add := func(id int) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for _, snapshot := range history {
+		if direction == mb8600.DirectionDownstream {
+			for _, ch := range snapshot.Downstream {
+				add(ch.ChannelID)
+			}
+		} else {
+			for _, ch := range snapshot.Upstream {
+				add(ch.ChannelID)
+			}
+		}
+	}
+	return ids
+}
+
+func downstreamChannel(snapshot *mb8600.Snapshot, id int) *mb8600.DownstreamChannel {
+	return mb8600.FindDownstreamByChannelID(snapshot.Downstream, id)
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"testing"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/i18n"
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+// Returns daily snapshots of upstream channel 4 at the given power levels and
+// of downstream channel 20 with the given uncorrected error counters.
+func dailyHistory(power []float64, uncorrected []float64) []*mb8600.Snapshot {
+	start := time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)
+	var history []*mb8600.Snapshot
+	for idx := 0; idx < max(len(power), len(uncorrected)); idx++ {
+		s := &mb8600.Snapshot{Time: start.Add(time.Duration(idx) * 24 * time.Hour)}
+		if idx < len(power) {
+			s.Upstream = []*mb8600.UpstreamChannel{{ChannelID: 4, LockStatus: "Locked", Power: power[idx]}}
+		}
+		if idx < len(uncorrected) {
+			s.Downstream = []*mb8600.DownstreamChannel{downstream(2.8, 45, uncorrected[idx])}
+		}
+		history = append(history, s)
+	}
+	return history
+}
+
+func TestForecasts(t *testing.T) {
+	tests := []struct {
+		name       string
+		history    []*mb8600.Snapshot
+		want       string
+		wantReason string
+	}{
+		{"too few samples", dailyHistory([]float64{46, 47}, nil), "", ""},
+		{"stable", dailyHistory([]float64{46, 46, 46, 46}, nil), "", ""},
+		{
+			"rising upstream power",
+			dailyHistory([]float64{45, 46, 47, 48}, nil),
+			"upstream",
+			"power projected to exceed 51.0 in ~3 days",
+		},
+		{
+			"falling upstream power",
+			dailyHistory([]float64{40, 39, 38, 37}, nil),
+			"upstream",
+			"power projected to fall below 35.0 in ~2 days",
+		},
+		{"beyond horizon", dailyHistory([]float64{45, 45.01, 45.02, 45.03}, nil), "", ""},
+		{"already beyond limit", dailyHistory([]float64{50, 51, 52, 53}, nil), "", ""},
+		{
+			// 24, 48, 72 and 96 errors per hour.
+			"rising error rate",
+			dailyHistory(nil, []float64{0, 576, 1728, 3456, 5760}),
+			"downstream",
+			"uncorrected errors per hour projected to exceed 100.0 in ~1 days",
+		},
+		{"counter reset", dailyHistory(nil, []float64{0, 576, 0, 1152, 0}), "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Forecasts(tt.history, DefaultThresholds())
+			if tt.want == "" {
+				if len(got) != 0 {
+					t.Errorf("Forecasts() = %+v, want none", got[0])
+				}
+				return
+			}
+			if len(got) != 1 || got[0].Direction != tt.want || got[0].Reason != tt.wantReason {
+				t.Fatalf("Forecasts() = %+v, want one %s forecast: %s", got, tt.want, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestEvaluateHistory(t *testing.T) {
+	history := dailyHistory([]float64{45, 46, 47, 48}, nil)
+	report := EvaluateHistory(history, DefaultThresholds())
+	if report.Status != StatusOK || len(report.Forecasts) != 1 {
+		t.Fatalf("EvaluateHistory() = %+v, want an OK report with one forecast", report)
+	}
+
+	f := report.Forecasts[0]
+	if f.Remaining < 2*24*time.Hour || f.Remaining > 3*24*time.Hour || f.Slope != 1 {
+		t.Errorf("Forecast = %+v, want a slope of 1 and 2-3 days remaining", f)
+	}
+	if got, want := f.LocalizedReason(i18n.NewPrinter(i18n.German)), "Pegel überschreitet voraussichtlich 51.0 in ~3 Tagen"; got != want {
+		t.Errorf("Forecast.LocalizedReason() = %v, want %v", got, want)
+	}
+
+	if report := EvaluateHistory(nil, DefaultThresholds()); report.Status != StatusOK || report.Forecasts != nil {
+		t.Errorf("EvaluateHistory(nil) = %+v, want an empty report", report)
+	}
+}
@@ -0,0 +1,317 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package health evaluates channel signal levels and error counters against
+// DOCSIS guidelines, and flags insecure modem settings.
+package health
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/i18n"
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+type Status int
+
+const (
+	StatusOK Status = iota
+	StatusWarning
+	StatusCritical
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusOK:
+		return "ok"
+	case StatusWarning:
+		return "warning"
+	case StatusCritical:
+		return "critical"
+	}
+	return fmt.Sprintf("Status(%d)", int(s))
+}
+
+// Returns the status name translated by p.
+func (s Status) Localize(p *i18n.Printer) string {
+	return p.Translate(s.String())
+}
+
+// The limits channels are evaluated against. Values outside a limit produce a
+// warning, and values outside it by more than CriticalMargin are critical.
+type Thresholds struct {
+	// Downstream receive power in dBmV.
+	DownstreamPowerMin float64
+	DownstreamPowerMax float64
+	// Upstream transmit power in dBmV.
+	UpstreamPowerMin float64
+	UpstreamPowerMax float64
+	// Minimum downstream SNR in dB by modulation (e.g. "QAM256") or channel
+	// kind (e.g. "OFDM"), falling back to DefaultMinSNR.
+	MinSNR        map[string]float64
+	DefaultMinSNR float64
+	// Margin in dB beyond a limit at which a verdict becomes critical.
+	CriticalMargin float64
+	// Maximum increase of a channel's uncorrected error counter between two
+	// snapshots before a warning, and before the verdict becomes critical.
+	MaxUncorrectedDelta      float64
+	CriticalUncorrectedDelta float64
+	// Minimum number of locked upstream channels, e.g. the number the
+	// provider bonds, or zero to disable the check. Independently of it, a
+	// drop in the count since the previous snapshot is a warning, and a drop
+	// to half or less is critical.
+	MinLockedUpstream int
+	// Uncorrected errors per hour on a downstream channel that forecasts
+	// treat as failing, and how far ahead forecasts are reported. A zero
+	// horizon disables forecasts.
+	MaxUncorrectedPerHour float64
+	ForecastHorizon       time.Duration
+}
+
+// Returns thresholds based on commonly cited DOCSIS guidelines.
+func DefaultThresholds() Thresholds {
+	return Thresholds{
+		DownstreamPowerMin: -7,
+		DownstreamPowerMax: 7,
+		UpstreamPowerMin:   35,
+		UpstreamPowerMax:   51,
+		MinSNR: map[string]float64{
+			"QAM256": 35,
+			"QAM64":  27,
+			"OFDM":   30,
+		},
+		DefaultMinSNR:            30,
+		CriticalMargin:           3,
+		MaxUncorrectedDelta:      0,
+		CriticalUncorrectedDelta: 1000,
+		MaxUncorrectedPerHour:    100,
+		ForecastHorizon:          30 * 24 * time.Hour,
+	}
+}
+
+// The evaluation of a single channel.
+type Verdict struct {
+	Direction string
+	ChannelID int
+	Status    Status
+	Reasons   []string
+
+	reasons []reason
+}
+
+// A reason kept untranslated, so it can be rendered in other languages.
+type reason struct {
+	format string
+	args   []any
+}
+
+// A message argument that is itself translated.
+type term string
+
+type Report struct {
+	// The worst status of any channel or of the upstream channel count.
+	Status Status
+	// The percentage of channels with an OK status.
+	Score    float64
+	Channels []*Verdict
+	// The evaluation of the number of locked upstream channels, which detects
+	// partial upstream service. Its ChannelID is zero.
+	UpstreamCount *Verdict
+	// The evaluation of the partial service flagged by the modem. Its
+	// Direction and ChannelID are empty.
+	PartialService *Verdict
+	// Metrics projected to cross their limits within the forecast horizon,
+	// set by EvaluateHistory.
+	Forecasts []*Forecast
+}
+
+// Evaluates the channels in curr. If prev is not nil, uncorrected error
+// counters are also evaluated by their increase since prev.
+func Evaluate(curr, prev *mb8600.Snapshot, thresholds Thresholds) *Report {
+	report := &Report{}
+
+	prevUncorrected := map[int]float64{}
+	if prev != nil {
+		for _, ch := range prev.Downstream {
+			prevUncorrected[ch.ChannelID] = ch.UncorrectedErrors
+		}
+	}
+
+	for _, ch := range curr.Downstream {
+		v := &Verdict{Direction: mb8600.DirectionDownstream, ChannelID: ch.ChannelID}
+		checkLock(v, ch.LockStatus)
+		checkRange(v, "power", ch.Power, thresholds.DownstreamPowerMin, thresholds.DownstreamPowerMax, thresholds.CriticalMargin)
+		checkSNR(v, ch, thresholds)
+		if old, ok := prevUncorrected[ch.ChannelID]; ok && ch.UncorrectedErrors >= old {
+			checkDelta(v, ch.UncorrectedErrors-old, thresholds)
+		}
+		report.add(v)
+	}
+
+	for _, ch := range curr.Upstream {
+		v := &Verdict{Direction: mb8600.DirectionUpstream, ChannelID: ch.ChannelID}
+		checkLock(v, ch.LockStatus)
+		checkRange(v, "power", ch.Power, thresholds.UpstreamPowerMin, thresholds.UpstreamPowerMax, thresholds.CriticalMargin)
+		report.add(v)
+	}
+
+	report.UpstreamCount = checkUpstreamCount(curr, prev, thresholds)
+	report.Status = max(report.Status, report.UpstreamCount.Status)
+	report.PartialService = checkPartialService(curr)
+	report.Status = max(report.Status, report.PartialService.Status)
+
+	if len(report.Channels) > 0 {
+		var ok int
+		for _, v := range report.Channels {
+			if v.Status == StatusOK {
+				ok++
+			}
+		}
+		report.Score = 100 * float64(ok) / float64(len(report.Channels))
+	}
+
+	return report
+}
+
+func (r *Report) add(v *Verdict) {
+	r.Channels = append(r.Channels, v)
+	r.Status = max(r.Status, v.Status)
+}
+
+// Returns the reasons for the verdict translated by p.
+func (v *Verdict) LocalizedReasons(p *i18n.Printer) []string {
+	reasons := make([]string, 0, len(v.reasons))
+	for _, r := range v.reasons {
+		reasons = append(reasons, r.render(p))
+	}
+	return reasons
+}
+
+func (v *Verdict) flag(status Status, format string, args ...any) {
+	r := reason{format, args}
+	v.Status = max(v.Status, status)
+	v.reasons = append(v.reasons, r)
+	v.Reasons = append(v.Reasons, r.render(nil))
+}
+
+func (r reason) render(p *i18n.Printer) string {
+	args := make([]any, len(r.args))
+	for i, arg := range r.args {
+		if t, ok := arg.(term); ok {
+			arg = p.Translate(string(t))
+		}
+		args[i] = arg
+	}
+	return p.Sprintf(r.format, args...)
+}
+
+func checkLock(v *Verdict, lockStatus string) {
+	if lockStatus != "Locked" {
+		v.flag(StatusCritical, "channel not locked: %s", lockStatus)
+	}
+}
+
+func checkRange(v *Verdict, name term, value, min, max, margin float64) {
+	switch {
+	case value < min-margin || value > max+margin:
+		v.flag(StatusCritical, "%s %.1f far outside %.1f..%.1f", name, value, min, max)
+	case value < min || value > max:
+		v.flag(StatusWarning, "%s %.1f outside %.1f..%.1f", name, value, min, max)
+	}
+}
+
+// Returns the minimum SNR of ch: the one of its modulation, else the one of
+// its kind, else DefaultMinSNR.
+func (t Thresholds) MinSNRFor(ch *mb8600.DownstreamChannel) float64 {
+	if min, ok := t.MinSNR[ch.Modulation]; ok {
+		return min
+	}
+	if min, ok := t.MinSNR[string(ch.Kind())]; ok {
+		return min
+	}
+	return t.DefaultMinSNR
+}
+
+func checkSNR(v *Verdict, ch *mb8600.DownstreamChannel, thresholds Thresholds) {
+	min := thresholds.MinSNRFor(ch)
+	switch {
+	case ch.SignalToNoise < min-thresholds.CriticalMargin:
+		v.flag(StatusCritical, "snr %.1f far below %.1f", ch.SignalToNoise, min)
+	case ch.SignalToNoise < min:
+		v.flag(StatusWarning, "snr %.1f below %.1f", ch.SignalToNoise, min)
+	}
+}
+
+func checkDelta(v *Verdict, delta float64, thresholds Thresholds) {
+	switch {
+	case delta > thresholds.CriticalUncorrectedDelta:
+		v.flag(StatusCritical, "uncorrected errors increased by %.0f", delta)
+	case delta > thresholds.MaxUncorrectedDelta:
+		v.flag(StatusWarning, "uncorrected errors increased by %.0f", delta)
+	}
+}
+
+func checkUpstreamCount(curr, prev *mb8600.Snapshot, thresholds Thresholds) *Verdict {
+	v := &Verdict{Direction: mb8600.DirectionUpstream}
+	locked := curr.LockedUpstreamChannels()
+
+	if prev != nil {
+		if prevLocked := prev.LockedUpstreamChannels(); locked < prevLocked {
+			status := StatusWarning
+			if locked <= prevLocked/2 {
+				status = StatusCritical
+			}
+			v.flag(status, "locked upstream channels dropped from %d to %d", prevLocked, locked)
+		}
+	}
+
+	if min := thresholds.MinLockedUpstream; locked < min {
+		status := StatusWarning
+		if locked <= min/2 {
+			status = StatusCritical
+		}
+		v.flag(status, "%d locked upstream channels, expected %d", locked, min)
+	}
+	return v
+}
+
+// Flags partial service as a warning: the modem is still online, but with
+// reduced capacity.
+func checkPartialService(curr *mb8600.Snapshot) *Verdict {
+	v := &Verdict{}
+	if curr.PartialService == nil {
+		return v
+	}
+	if curr.PartialService.Downstream {
+		v.flag(StatusWarning, "downstream partial service")
+	}
+	if curr.PartialService.Upstream {
+		v.flag(StatusWarning, "upstream partial service")
+	}
+	return v
+}
+
+// Evaluates the account the client is logged in as. An account still using
+// the factory default password is a warning, as anyone on the LAN can then
+// change the modem's settings.
+func CheckAccount(info *mb8600.AccountInfo) *Verdict {
+	v := &Verdict{}
+	if info.DefaultPassword {
+		v.flag(StatusWarning, "default credentials in use for account %s", info.Username)
+	}
+	return v
+}
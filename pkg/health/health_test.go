@@ -0,0 +1,277 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/thelande/mb8600/pkg/i18n"
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+func downstream(power, snr, uncorrected float64) *mb8600.DownstreamChannel {
+	return &mb8600.DownstreamChannel{
+		ChannelID:         20,
+		LockStatus:        "Locked",
+		Modulation:        "QAM256",
+		Power:             power,
+		SignalToNoise:     snr,
+		UncorrectedErrors: uncorrected,
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	strict := DefaultThresholds()
+	strict.MinSNR = map[string]float64{"QAM256": 40}
+	bonded := DefaultThresholds()
+	bonded.MinLockedUpstream = 4
+
+	upstream := func(n int) *mb8600.Snapshot {
+		s := &mb8600.Snapshot{}
+		for i := 1; i <= n; i++ {
+			s.Upstream = append(s.Upstream, &mb8600.UpstreamChannel{ChannelID: i, LockStatus: "Locked", Power: 45})
+		}
+		return s
+	}
+
+	tests := []struct {
+		name       string
+		curr       *mb8600.Snapshot
+		prev       *mb8600.Snapshot
+		thresholds Thresholds
+		want       Status
+		wantScore  float64
+	}{
+		{
+			"healthy",
+			&mb8600.Snapshot{
+				Downstream: []*mb8600.DownstreamChannel{downstream(2.8, 45.1, 0)},
+				Upstream:   []*mb8600.UpstreamChannel{{ChannelID: 4, LockStatus: "Locked", Power: 45}},
+			},
+			nil,
+			DefaultThresholds(),
+			StatusOK,
+			100,
+		},
+		{
+			"low snr",
+			&mb8600.Snapshot{Downstream: []*mb8600.DownstreamChannel{downstream(2.8, 34, 0)}},
+			nil,
+			DefaultThresholds(),
+			StatusWarning,
+			0,
+		},
+		{
+			"very low snr",
+			&mb8600.Snapshot{Downstream: []*mb8600.DownstreamChannel{downstream(2.8, 30, 0)}},
+			nil,
+			DefaultThresholds(),
+			StatusCritical,
+			0,
+		},
+		{
+			"overridden snr",
+			&mb8600.Snapshot{Downstream: []*mb8600.DownstreamChannel{downstream(2.8, 38, 0)}},
+			nil,
+			strict,
+			StatusWarning,
+			0,
+		},
+		{
+			"high downstream power",
+			&mb8600.Snapshot{Downstream: []*mb8600.DownstreamChannel{downstream(8, 45, 0)}},
+			nil,
+			DefaultThresholds(),
+			StatusWarning,
+			0,
+		},
+		{
+			"high upstream power",
+			&mb8600.Snapshot{Upstream: []*mb8600.UpstreamChannel{{ChannelID: 4, LockStatus: "Locked", Power: 56}}},
+			nil,
+			DefaultThresholds(),
+			StatusCritical,
+			0,
+		},
+		{
+			"not locked",
+			&mb8600.Snapshot{Upstream: []*mb8600.UpstreamChannel{{ChannelID: 4, LockStatus: "Not Locked", Power: 45}}},
+			nil,
+			DefaultThresholds(),
+			StatusCritical,
+			0,
+		},
+		{
+			"uncorrected increase",
+			&mb8600.Snapshot{Downstream: []*mb8600.DownstreamChannel{downstream(2.8, 45, 10), downstream(2.8, 45, 0)}},
+			&mb8600.Snapshot{Downstream: []*mb8600.DownstreamChannel{downstream(2.8, 45, 5)}},
+			DefaultThresholds(),
+			StatusWarning,
+			50,
+		},
+		{
+			"counter reset",
+			&mb8600.Snapshot{Downstream: []*mb8600.DownstreamChannel{downstream(2.8, 45, 0)}},
+			&mb8600.Snapshot{Downstream: []*mb8600.DownstreamChannel{downstream(2.8, 45, 5000)}},
+			DefaultThresholds(),
+			StatusOK,
+			100,
+		},
+		{
+			"upstream count dropped",
+			upstream(3),
+			upstream(4),
+			DefaultThresholds(),
+			StatusWarning,
+			100,
+		},
+		{
+			"upstream count halved",
+			upstream(2),
+			upstream(4),
+			DefaultThresholds(),
+			StatusCritical,
+			100,
+		},
+		{
+			"upstream count increased",
+			upstream(4),
+			upstream(2),
+			DefaultThresholds(),
+			StatusOK,
+			100,
+		},
+		{
+			"upstream below minimum",
+			upstream(3),
+			nil,
+			bonded,
+			StatusWarning,
+			100,
+		},
+		{
+			"partial service",
+			&mb8600.Snapshot{
+				Upstream:       upstream(4).Upstream,
+				PartialService: &mb8600.PartialService{Upstream: true},
+			},
+			nil,
+			DefaultThresholds(),
+			StatusWarning,
+			100,
+		},
+		{
+			"full service",
+			&mb8600.Snapshot{
+				Upstream:       upstream(4).Upstream,
+				PartialService: &mb8600.PartialService{},
+			},
+			nil,
+			DefaultThresholds(),
+			StatusOK,
+			100,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Evaluate(tt.curr, tt.prev, tt.thresholds)
+			if got.Status != tt.want {
+				t.Errorf("Evaluate().Status = %v, want %v", got.Status, tt.want)
+			}
+			if got.Score != tt.wantScore {
+				t.Errorf("Evaluate().Score = %v, want %v", got.Score, tt.wantScore)
+			}
+		})
+	}
+}
+
+func TestThresholds_MinSNRFor(t *testing.T) {
+	thresholds := DefaultThresholds()
+	tests := []struct {
+		modulation string
+		want       float64
+	}{
+		{"QAM256", 35},
+		{"QAM64", 27},
+		{"OFDM PLC", 30},
+		{"QAM16", 30},
+	}
+	for _, tt := range tests {
+		ch := &mb8600.DownstreamChannel{Modulation: tt.modulation}
+		if got := thresholds.MinSNRFor(ch); got != tt.want {
+			t.Errorf("MinSNRFor(%s) = %.1f, want %.1f", tt.modulation, got, tt.want)
+		}
+	}
+}
+
+func TestVerdict_LocalizedReasons(t *testing.T) {
+	curr := &mb8600.Snapshot{Downstream: []*mb8600.DownstreamChannel{downstream(12, 30, 0)}}
+	v := Evaluate(curr, nil, DefaultThresholds()).Channels[0]
+
+	tests := []struct {
+		lang       i18n.Language
+		wantStatus string
+		want       []string
+	}{
+		{i18n.English, "critical", []string{"power 12.0 far outside -7.0..7.0", "snr 30.0 far below 35.0"}},
+		{i18n.Spanish, "crítico", []string{"potencia 12.0 muy fuera de -7.0..7.0", "snr 30.0 muy por debajo de 35.0"}},
+		{i18n.German, "kritisch", []string{"Pegel 12.0 weit außerhalb von -7.0..7.0", "SNR 30.0 weit unter 35.0"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.lang), func(t *testing.T) {
+			p := i18n.NewPrinter(tt.lang)
+			if got := v.Status.Localize(p); got != tt.wantStatus {
+				t.Errorf("Status.Localize() = %v, want %v", got, tt.wantStatus)
+			}
+			if got := v.LocalizedReasons(p); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Verdict.LocalizedReasons() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if want := v.LocalizedReasons(nil); !reflect.DeepEqual(v.Reasons, want) {
+		t.Errorf("Verdict.Reasons = %v, want %v", v.Reasons, want)
+	}
+}
+
+func TestCheckAccount(t *testing.T) {
+	tests := []struct {
+		name string
+		info *mb8600.AccountInfo
+		want Status
+	}{
+		{"changed", &mb8600.AccountInfo{Username: "admin"}, StatusOK},
+		{"default", &mb8600.AccountInfo{Username: "admin", DefaultPassword: true}, StatusWarning},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := CheckAccount(tt.info)
+			if v.Status != tt.want {
+				t.Errorf("CheckAccount().Status = %v, want %v", v.Status, tt.want)
+			}
+			if (len(v.Reasons) > 0) != (tt.want != StatusOK) {
+				t.Errorf("CheckAccount().Reasons = %v", v.Reasons)
+			}
+		})
+	}
+
+	v := CheckAccount(&mb8600.AccountInfo{Username: "admin", DefaultPassword: true})
+	if got := v.LocalizedReasons(i18n.NewPrinter(i18n.German)); !reflect.DeepEqual(got, []string{"Standardzugangsdaten für das Konto admin in Verwendung"}) {
+		t.Errorf("Verdict.LocalizedReasons() = %v", got)
+	}
+}
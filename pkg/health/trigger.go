@@ -0,0 +1,125 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Runs an external command, e.g. one starting a packet capture on the router,
+// when a report reaches a given status. The command is passed the context of
+// the trigger in MB8600_TRIGGER_* environment variables:
+//
+//	MB8600_TRIGGER_TIME      the time of the report, in RFC 3339 format
+//	MB8600_TRIGGER_STATUS    the status of the report
+//	MB8600_TRIGGER_SCORE     the percentage of channels with an OK status
+//	MB8600_TRIGGER_CHANNELS  the offending channels, e.g. "downstream:20 upstream:3"
+//	MB8600_TRIGGER_REASONS   the reasons the channels were flagged, separated by "; "
+type CommandTrigger struct {
+	// The command and its arguments. It is not run through a shell.
+	Command []string
+	// The minimum status that fires the trigger. Reports with an OK status
+	// never do.
+	MinStatus Status
+	// The minimum time between two runs of the command.
+	Cooldown time.Duration
+	// The time limit of each run of the command. Zero means no limit.
+	Timeout time.Duration
+	// The environment the command is run with, to which the MB8600_TRIGGER_*
+	// variables are added. The process environment if nil.
+	Env []string
+
+	mu   sync.Mutex
+	last time.Time
+	run  func(ctx context.Context, name string, args, env []string) error
+}
+
+// Returns a trigger running command on critical reports.
+func NewCommandTrigger(command []string, cooldown time.Duration) *CommandTrigger {
+	return &CommandTrigger{Command: command, MinStatus: StatusCritical, Cooldown: cooldown}
+}
+
+// Runs the command if report reaches the trigger's status and the cooldown
+// since the last run has passed. Returns true if the command was run.
+func (t *CommandTrigger) Fire(ctx context.Context, report *Report, now time.Time) (bool, error) {
+	if len(t.Command) == 0 || report.Status < max(t.MinStatus, StatusWarning) {
+		return false, nil
+	}
+
+	t.mu.Lock()
+	if !t.last.IsZero() && now.Sub(t.last) < t.Cooldown {
+		t.mu.Unlock()
+		return false, nil
+	}
+	t.last = now
+	t.mu.Unlock()
+
+	if t.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.Timeout)
+		defer cancel()
+	}
+
+	run := t.run
+	if run == nil {
+		run = runCommand
+	}
+	env := t.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	env = append(slices.Clip(env), triggerEnv(report, now)...)
+	if err := run(ctx, t.Command[0], t.Command[1:], env); err != nil {
+		return true, fmt.Errorf("trigger command %s failed: %w", t.Command[0], err)
+	}
+	return true, nil
+}
+
+func runCommand(ctx context.Context, name string, args, env []string) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = env
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// Returns the environment describing the trigger.
+func triggerEnv(report *Report, now time.Time) []string {
+	var channels, reasons []string
+	for _, v := range report.Channels {
+		if v.Status == StatusOK {
+			continue
+		}
+		channels = append(channels, fmt.Sprintf("%s:%d", v.Direction, v.ChannelID))
+		reasons = append(reasons, v.Reasons...)
+	}
+
+	return []string{
+		"MB8600_TRIGGER_TIME=" + now.Format(time.RFC3339),
+		"MB8600_TRIGGER_STATUS=" + report.Status.String(),
+		fmt.Sprintf("MB8600_TRIGGER_SCORE=%.1f", report.Score),
+		"MB8600_TRIGGER_CHANNELS=" + strings.Join(channels, " "),
+		"MB8600_TRIGGER_REASONS=" + strings.Join(reasons, "; "),
+	}
+}
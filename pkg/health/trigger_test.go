@@ -0,0 +1,88 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+func TestCommandTrigger_Fire(t *testing.T) {
+	critical := Evaluate(&mb8600.Snapshot{Downstream: []*mb8600.DownstreamChannel{downstream(12, 45, 0)}}, nil, DefaultThresholds())
+	warning := Evaluate(&mb8600.Snapshot{Downstream: []*mb8600.DownstreamChannel{downstream(8, 45, 0)}}, nil, DefaultThresholds())
+	now := time.Date(2023, 12, 23, 20, 0, 0, 0, time.UTC)
+
+	var runs [][]string
+	var runErr error
+	trigger := NewCommandTrigger([]string{"capture", "-i", "eth0"}, time.Minute)
+	trigger.Env = []string{"PATH=/usr/bin"}
+	trigger.run = func(ctx context.Context, name string, args, env []string) error {
+		runs = append(runs, append([]string{name}, append(args, env...)...))
+		return runErr
+	}
+
+	tests := []struct {
+		name    string
+		report  *Report
+		now     time.Time
+		want    bool
+		wantErr bool
+	}{
+		{"below status", warning, now, false, false},
+		{"critical", critical, now, true, false},
+		{"cooldown", critical, now.Add(30 * time.Second), false, false},
+		{"after cooldown", critical, now.Add(time.Minute), true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := trigger.Fire(context.Background(), tt.report, tt.now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CommandTrigger.Fire() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("CommandTrigger.Fire() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if len(runs) != 2 {
+		t.Fatalf("command runs = %v, want 2", len(runs))
+	}
+	for _, want := range []string{
+		"capture", "-i", "eth0",
+		"PATH=/usr/bin",
+		"MB8600_TRIGGER_TIME=2023-12-23T20:00:00Z",
+		"MB8600_TRIGGER_STATUS=critical",
+		"MB8600_TRIGGER_SCORE=0.0",
+		"MB8600_TRIGGER_CHANNELS=downstream:20",
+		"MB8600_TRIGGER_REASONS=power 12.0 far outside -7.0..7.0",
+	} {
+		if !slices.Contains(runs[0], want) {
+			t.Errorf("command run %v does not contain %q", runs[0], want)
+		}
+	}
+
+	runErr = errors.New("exit status 1")
+	if _, err := trigger.Fire(context.Background(), critical, now.Add(time.Hour)); err == nil {
+		t.Errorf("CommandTrigger.Fire() error = nil, want the command error")
+	}
+}
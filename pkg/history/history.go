@@ -0,0 +1,200 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Package history keeps the snapshots of a Poller in an append-only JSON
+// Lines file, one snapshot per line, and answers queries over them, such as
+// the errors of a channel over time or the gaps in the modem's service, so
+// intermittent line problems can be shown to an ISP over days or weeks.
+//
+// Appending never rewrites the file, so a crash or power loss loses at most
+// the last snapshot, which is skipped when reading. The file may be
+// compressed with any codec of pkg/compression that supports concatenated
+// streams, as gzip and zstd do; each snapshot is then compressed separately.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/compression"
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+// The longest line read, far above the size of a snapshot of a fully bonded
+// modem.
+const maxLineSize = 4 << 20
+
+type options struct {
+	compression string
+}
+
+type Option func(*options)
+
+// Compresses snapshots appended to a new file with the codec named name, see
+// pkg/compression. An existing file keeps the codec it was written with.
+func WithCompression(name string) Option {
+	return func(o *options) {
+		o.compression = name
+	}
+}
+
+// An append-only store of snapshots. It is safe for concurrent use.
+type Store struct {
+	path  string
+	codec string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Opens the store kept in the file at path, creating it if it does not exist.
+func Open(path string, opts ...Option) (*Store, error) {
+	o := options{compression: compression.None}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	head := make([]byte, 8)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		file.Close()
+		return nil, err
+	}
+	codec := o.compression
+	if n > 0 {
+		codec = compression.Detect(head[:n])
+	}
+	if _, err := compression.Lookup(codec); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("history in %s: %w", path, err)
+	}
+
+	return &Store{path: path, codec: codec, file: file}, nil
+}
+
+// Returns the path of the file the store is kept in.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Appends snapshot to the store.
+func (s *Store) Append(snapshot *mb8600.Snapshot) error {
+	line, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	line, err = compression.Compress(append(line, '\n'), s.codec)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return os.ErrClosed
+	}
+	// A single write, so that a failing disk leaves at most one partial
+	// snapshot behind.
+	_, err = s.file.Write(line)
+	return err
+}
+
+// Flushes the appended snapshots to disk and closes the store.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := errors.Join(s.file.Sync(), s.file.Close())
+	s.file = nil
+	return err
+}
+
+// Calls fn with each snapshot taken at or after since, oldest first, until fn
+// returns an error, which is returned. The snapshots are read from disk, so
+// memory use does not grow with the history.
+func (s *Store) Each(since time.Time, fn func(*mb8600.Snapshot) error) error {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	r, err := compression.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("history in %s: %w", s.path, err)
+	}
+	defer r.Close()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLineSize)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var snapshot mb8600.Snapshot
+		if err := json.Unmarshal(line, &snapshot); err != nil {
+			// A partial last line is left by a crash while appending.
+			if isLastLine(scanner) {
+				break
+			}
+			return fmt.Errorf("history in %s, line %d: %w", s.path, lineNo, err)
+		}
+		if snapshot.Time.Before(since) {
+			continue
+		}
+		if err := fn(&snapshot); err != nil {
+			return err
+		}
+	}
+	// A compressed stream cut short by a crash ends the same way.
+	if err := scanner.Err(); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("history in %s: %w", s.path, err)
+	}
+	return nil
+}
+
+// Returns true if scanner has no lines after the current one.
+func isLastLine(scanner *bufio.Scanner) bool {
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the snapshots taken at or after since, oldest first.
+func (s *Store) Snapshots(since time.Time) ([]*mb8600.Snapshot, error) {
+	var snapshots []*mb8600.Snapshot
+	err := s.Each(since, func(snapshot *mb8600.Snapshot) error {
+		snapshots = append(snapshots, snapshot)
+		return nil
+	})
+	return snapshots, err
+}
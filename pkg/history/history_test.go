@@ -0,0 +1,192 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/compression"
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+var start = time.Date(2023, 12, 16, 0, 0, 0, 0, time.UTC)
+
+// Returns a snapshot taken at start plus offset, with one downstream channel
+// with the given error counters and the given modem uptime.
+func snapshot(offset time.Duration, corrected, uncorrected float64, uptime time.Duration) *mb8600.Snapshot {
+	return &mb8600.Snapshot{
+		Time: start.Add(offset),
+		Downstream: []*mb8600.DownstreamChannel{
+			{ChannelID: 20, LockStatus: "Locked", Modulation: "QAM256", CorrectedErrors: corrected, UncorrectedErrors: uncorrected},
+		},
+		Connection: &mb8600.ConnectionInfo{Uptime: uptime},
+	}
+}
+
+// Returns a store in a temporary file holding snapshots.
+func openStore(t *testing.T, snapshots []*mb8600.Snapshot, opts ...Option) *Store {
+	t.Helper()
+	store, err := Open(filepath.Join(t.TempDir(), "history.jsonl"), opts...)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	for _, s := range snapshots {
+		if err := store.Append(s); err != nil {
+			t.Fatalf("Store.Append() error = %v", err)
+		}
+	}
+	return store
+}
+
+func TestStore(t *testing.T) {
+	snapshots := []*mb8600.Snapshot{
+		snapshot(0, 0, 0, time.Hour),
+		snapshot(time.Minute, 10, 1, time.Hour+time.Minute),
+		snapshot(2*time.Minute, 20, 2, time.Hour+2*time.Minute),
+	}
+
+	for _, codec := range []string{compression.None, compression.Gzip, compression.Zstd} {
+		t.Run(codec, func(t *testing.T) {
+			store := openStore(t, snapshots, WithCompression(codec))
+
+			got, err := store.Snapshots(time.Time{})
+			if err != nil {
+				t.Fatalf("Store.Snapshots() error = %v", err)
+			}
+			if len(got) != 3 || !got[2].Time.Equal(snapshots[2].Time) || got[2].Downstream[0].CorrectedErrors != 20 {
+				t.Errorf("Store.Snapshots() = %+v, want the appended snapshots", got)
+			}
+
+			got, err = store.Snapshots(start.Add(time.Minute))
+			if err != nil || len(got) != 2 {
+				t.Errorf("Store.Snapshots(since) = %d snapshots, %v, want 2", len(got), err)
+			}
+
+			data, err := os.ReadFile(store.Path())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if detected := compression.Detect(data); detected != codec {
+				t.Errorf("file is compressed with %s, want %s", detected, codec)
+			}
+		})
+	}
+}
+
+func TestOpen_keepsCodec(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	store, err := Open(path, WithCompression(compression.Gzip))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	store.Append(snapshot(0, 0, 0, time.Hour))
+	store.Close()
+
+	store, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer store.Close()
+	store.Append(snapshot(time.Minute, 0, 0, time.Hour))
+
+	got, err := store.Snapshots(time.Time{})
+	if err != nil || len(got) != 2 {
+		t.Errorf("Store.Snapshots() = %d snapshots, %v, want 2", len(got), err)
+	}
+}
+
+func TestStore_truncated(t *testing.T) {
+	for _, codec := range []string{compression.None, compression.Gzip, compression.Zstd} {
+		t.Run(codec, func(t *testing.T) {
+			store := openStore(t, []*mb8600.Snapshot{snapshot(0, 0, 0, time.Hour), snapshot(time.Minute, 0, 0, time.Hour)}, WithCompression(codec))
+			store.Close()
+
+			// A crash while appending leaves a partial last snapshot.
+			data, err := os.ReadFile(store.Path())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(store.Path(), data[:len(data)-20], 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := store.Snapshots(time.Time{})
+			if err != nil || len(got) != 1 {
+				t.Errorf("Store.Snapshots() = %d snapshots, %v, want the first", len(got), err)
+			}
+		})
+	}
+}
+
+func TestStore_corrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	if err := os.WriteFile(path, []byte("not json\n{}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer store.Close()
+
+	if _, err := store.Snapshots(time.Time{}); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("Store.Snapshots() error = %v, want one naming line 1", err)
+	}
+}
+
+func TestStore_closed(t *testing.T) {
+	store := openStore(t, nil)
+	if err := store.Close(); err != nil {
+		t.Fatalf("Store.Close() error = %v", err)
+	}
+	if err := store.Append(snapshot(0, 0, 0, 0)); err == nil {
+		t.Errorf("Store.Append() error = nil after Close")
+	}
+}
+
+func TestPoller_RecordTo(t *testing.T) {
+	store := openStore(t, nil)
+	poller := mb8600.NewPoller(&pollerClient{}, time.Minute, nil)
+	poller.RecordTo(store)
+	for i := 0; i < 2; i++ {
+		if _, err := poller.Poll(); err != nil {
+			t.Fatalf("Poller.Poll() error = %v", err)
+		}
+	}
+
+	got, err := store.Snapshots(time.Time{})
+	if err != nil || len(got) != 2 {
+		t.Errorf("Store.Snapshots() = %d snapshots, %v, want 2", len(got), err)
+	}
+}
+
+type pollerClient struct{}
+
+func (pollerClient) Login() (map[string]string, error) { return nil, nil }
+
+func (pollerClient) GetDownstreamChannels() ([]*mb8600.DownstreamChannel, error) {
+	return snapshot(0, 0, 0, 0).Downstream, nil
+}
+
+func (pollerClient) GetUpstreamChannels() ([]*mb8600.UpstreamChannel, error) {
+	return nil, nil
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package history
+
+import (
+	"time"
+
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+// The errors of a downstream channel in the interval between two snapshots,
+// ending at Time.
+type ErrorSample struct {
+	Time time.Time `json:"time"`
+	mb8600.ChannelDelta
+}
+
+// Returns the corrected and uncorrected errors of the downstream channel in
+// each interval between the snapshots taken at or after since. Counters
+// reset by a reboot are handled, see mb8600.ChannelDelta.
+func (s *Store) ErrorsOverTime(channelID int, since time.Time) ([]ErrorSample, error) {
+	var samples []ErrorSample
+	tracker := mb8600.NewStatsTracker()
+	err := s.Each(since, func(snapshot *mb8600.Snapshot) error {
+		tracker.Observe(snapshot)
+		if delta, ok := tracker.Delta(channelID); ok {
+			samples = append(samples, ErrorSample{Time: snapshot.Time, ChannelDelta: delta})
+		}
+		return nil
+	})
+	return samples, err
+}
+
+// A period without service or without polls: the modem was unreachable, the
+// poller was not running or the modem rebooted.
+type Gap struct {
+	// The last snapshot before and the first snapshot after the gap.
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Whether the modem rebooted within the gap, as its uptime or its error
+	// counters went back.
+	Rebooted bool `json:"rebooted"`
+}
+
+// Returns the length of the gap.
+func (g Gap) Duration() time.Duration {
+	return g.End.Sub(g.Start)
+}
+
+// Returns the gaps between the snapshots taken at or after since that are
+// longer than maxInterval, typically a few poll intervals, or span a reboot
+// of the modem.
+func (s *Store) UptimeGaps(since time.Time, maxInterval time.Duration) ([]Gap, error) {
+	var (
+		gaps []Gap
+		prev *mb8600.Snapshot
+	)
+	err := s.Each(since, func(curr *mb8600.Snapshot) error {
+		if prev != nil {
+			rebooted := mb8600.Compare(prev, curr).Reboot != nil
+			if rebooted || curr.Time.Sub(prev.Time) > maxInterval {
+				gaps = append(gaps, Gap{Start: prev.Time, End: curr.Time, Rebooted: rebooted})
+			}
+		}
+		prev = curr
+		return nil
+	})
+	return gaps, err
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package history
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+func TestStore_ErrorsOverTime(t *testing.T) {
+	store := openStore(t, []*mb8600.Snapshot{
+		snapshot(0, 0, 0, time.Hour),
+		snapshot(time.Minute, 10, 1, time.Hour+time.Minute),
+		snapshot(2*time.Minute, 25, 1, time.Hour+2*time.Minute),
+		// Rebooted.
+		snapshot(10*time.Minute, 3, 0, time.Minute),
+	})
+
+	got, err := store.ErrorsOverTime(20, time.Time{})
+	if err != nil {
+		t.Fatalf("Store.ErrorsOverTime() error = %v", err)
+	}
+	want := []ErrorSample{
+		{start.Add(time.Minute), mb8600.ChannelDelta{ChannelID: 20, Interval: time.Minute, CorrectedErrors: 10, UncorrectedErrors: 1}},
+		{start.Add(2 * time.Minute), mb8600.ChannelDelta{ChannelID: 20, Interval: time.Minute, CorrectedErrors: 15}},
+		{start.Add(10 * time.Minute), mb8600.ChannelDelta{ChannelID: 20, Interval: 8 * time.Minute, CorrectedErrors: 3, Reset: true}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Store.ErrorsOverTime() = %+v, want %+v", got, want)
+	}
+
+	if got, err := store.ErrorsOverTime(21, time.Time{}); err != nil || len(got) != 0 {
+		t.Errorf("Store.ErrorsOverTime(unknown channel) = %+v, %v, want none", got, err)
+	}
+	if got, err := store.ErrorsOverTime(20, start.Add(2*time.Minute)); err != nil || len(got) != 1 {
+		t.Errorf("Store.ErrorsOverTime(since) = %+v, %v, want the reboot only", got, err)
+	}
+}
+
+func TestStore_UptimeGaps(t *testing.T) {
+	withoutUptime := func(s *mb8600.Snapshot) *mb8600.Snapshot {
+		s.Connection = nil
+		return s
+	}
+
+	tests := []struct {
+		name      string
+		snapshots []*mb8600.Snapshot
+		want      []Gap
+	}{
+		{
+			"steady",
+			[]*mb8600.Snapshot{snapshot(0, 0, 0, time.Hour), snapshot(time.Minute, 5, 0, time.Hour+time.Minute)},
+			nil,
+		},
+		{
+			"unreachable",
+			[]*mb8600.Snapshot{snapshot(0, 0, 0, time.Hour), snapshot(time.Hour, 5, 0, 2*time.Hour)},
+			[]Gap{{Start: start, End: start.Add(time.Hour)}},
+		},
+		{
+			"rebooted",
+			[]*mb8600.Snapshot{snapshot(0, 5, 0, time.Hour), snapshot(2*time.Minute, 10, 0, time.Minute)},
+			[]Gap{{Start: start, End: start.Add(2 * time.Minute), Rebooted: true}},
+		},
+		{
+			"counters reset",
+			[]*mb8600.Snapshot{withoutUptime(snapshot(0, 5, 0, 0)), withoutUptime(snapshot(time.Minute, 1, 0, 0))},
+			[]Gap{{Start: start, End: start.Add(time.Minute), Rebooted: true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := openStore(t, tt.snapshots)
+			got, err := store.UptimeGaps(time.Time{}, 3*time.Minute)
+			if err != nil {
+				t.Fatalf("Store.UptimeGaps() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Store.UptimeGaps() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGap_Duration(t *testing.T) {
+	if got := (Gap{Start: start, End: start.Add(time.Hour)}).Duration(); got != time.Hour {
+		t.Errorf("Gap.Duration() = %v, want 1h", got)
+	}
+}
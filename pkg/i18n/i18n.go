@@ -0,0 +1,125 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package i18n translates user-facing report output with go-i18n, using the
+// message files embedded from locales, keyed by the English format strings.
+package i18n
+
+import (
+	"embed"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	goi18n "github.com/nicksnyder/go-i18n/v2/i18n"
+	"golang.org/x/text/language"
+)
+
+//go:embed locales/*.toml
+var locales embed.FS
+
+// The translations of every language but English, which is implied by the
+// message IDs.
+var bundle = newBundle()
+
+func newBundle() *goi18n.Bundle {
+	b := goi18n.NewBundle(language.English)
+	b.RegisterUnmarshalFunc("toml", toml.Unmarshal)
+	for _, lang := range Languages()[1:] {
+		if _, err := b.LoadMessageFileFS(locales, "locales/active."+string(lang)+".toml"); err != nil {
+			panic(err)
+		}
+	}
+	return b
+}
+
+type Language string
+
+const (
+	English Language = "en"
+	Spanish Language = "es"
+	German  Language = "de"
+)
+
+// Returns the languages with a translation, English first.
+func Languages() []Language {
+	return []Language{English, Spanish, German}
+}
+
+// Returns the language matching a locale or language tag such as "de",
+// "es-MX" or "de_DE.UTF-8", falling back to English.
+func ParseLanguage(tag string) Language {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	base, _, _ := strings.Cut(tag, ".")
+	base, _, _ = strings.Cut(base, "_")
+	base, _, _ = strings.Cut(base, "-")
+	for _, lang := range Languages() {
+		if Language(base) == lang {
+			return lang
+		}
+	}
+	return English
+}
+
+// Returns the language selected by the LC_ALL, LC_MESSAGES or LANG
+// environment variables, in that order of precedence.
+func LanguageFromEnv() Language {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			return ParseLanguage(value)
+		}
+	}
+	return English
+}
+
+// Formats messages in a single language.
+type Printer struct {
+	lang      Language
+	localizer *goi18n.Localizer
+}
+
+// Returns a Printer for lang.
+func NewPrinter(lang Language) *Printer {
+	return &Printer{lang: lang, localizer: goi18n.NewLocalizer(bundle, string(lang))}
+}
+
+// Returns the printer's language.
+func (p *Printer) Language() Language {
+	if p == nil {
+		return English
+	}
+	return p.lang
+}
+
+// Returns the translation of the English message key, or key itself if it
+// has no translation.
+func (p *Printer) Translate(key string) string {
+	if p == nil {
+		return key
+	}
+	msg, err := p.localizer.Localize(&goi18n.LocalizeConfig{MessageID: key})
+	if err != nil {
+		return key
+	}
+	return msg
+}
+
+// Formats args according to the translation of the English format string.
+// A nil Printer formats in English.
+func (p *Printer) Sprintf(format string, args ...any) string {
+	return fmt.Sprintf(p.Translate(format), args...)
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package i18n
+
+import (
+	"reflect"
+	"regexp"
+	"sort"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+func TestParseLanguage(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want Language
+	}{
+		{"de", German},
+		{"es-MX", Spanish},
+		{"de_DE.UTF-8", German},
+		{"EN_us", English},
+		{"fr_FR.UTF-8", English},
+		{"C", English},
+		{"", English},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			if got := ParseLanguage(tt.tag); got != tt.want {
+				t.Errorf("ParseLanguage() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLanguageFromEnv(t *testing.T) {
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LC_MESSAGES", "es_ES.UTF-8")
+	t.Setenv("LANG", "de_DE.UTF-8")
+	if got := LanguageFromEnv(); got != Spanish {
+		t.Errorf("LanguageFromEnv() = %v, want %v", got, Spanish)
+	}
+}
+
+func TestPrinter_Sprintf(t *testing.T) {
+	tests := []struct {
+		printer *Printer
+		want    string
+	}{
+		{NewPrinter(English), "snr 30.0 below 35.0"},
+		{NewPrinter(Spanish), "snr 30.0 por debajo de 35.0"},
+		{NewPrinter(German), "SNR 30.0 unter 35.0"},
+		{nil, "snr 30.0 below 35.0"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.printer.Language()), func(t *testing.T) {
+			if got := tt.printer.Sprintf("snr %.1f below %.1f", 30.0, 35.0); got != tt.want {
+				t.Errorf("Printer.Sprintf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if got := NewPrinter(German).Translate("untranslated"); got != "untranslated" {
+		t.Errorf("Printer.Translate() = %v, want untranslated", got)
+	}
+}
+
+// Every language must translate the same messages, each taking the same
+// verbs as its English key.
+func TestLocales(t *testing.T) {
+	verbs := regexp.MustCompile(`%[^a-zA-Z%]*[a-zA-Z%]`)
+	var keys []string
+	for _, lang := range Languages()[1:] {
+		path := "locales/active." + string(lang) + ".toml"
+		var messages map[string]string
+		if _, err := toml.DecodeFS(locales, path, &messages); err != nil {
+			t.Fatalf("toml.DecodeFS(%s) error = %v", path, err)
+		}
+
+		var langKeys []string
+		for key, msg := range messages {
+			langKeys = append(langKeys, key)
+			if got, want := verbs.FindAllString(msg, -1), verbs.FindAllString(key, -1); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: %q verbs = %v, want %v", path, key, got, want)
+			}
+			if got := NewPrinter(lang).Translate(key); got != msg {
+				t.Errorf("Printer.Translate(%q) in %v = %q, want %q", key, lang, got, msg)
+			}
+		}
+		sort.Strings(langKeys)
+		if keys != nil && !reflect.DeepEqual(langKeys, keys) {
+			t.Errorf("%s translates %v, want %v", path, langKeys, keys)
+		}
+		keys = langKeys
+	}
+}
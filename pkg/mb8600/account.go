@@ -0,0 +1,74 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"strings"
+)
+
+// The web UI account the client is logged in as.
+type AccountInfo struct {
+	Username string `json:"username"`
+	// Whether the account still has its factory default password.
+	DefaultPassword bool `json:"default_password"`
+}
+
+// Returns the account described by the response to GetMotoStatusSecAccount.
+// DefaultPassword is not part of the response and is left unset.
+func NewAccountInfoFromResponse(resp map[string]string) *AccountInfo {
+	return &AccountInfo{Username: strings.TrimSpace(resp["CurrentUserName"])}
+}
+
+// Returns the account the client is logged in as, and whether it uses the
+// factory default password.
+//
+// The account name is queried with GetMotoStatusSecAccount on models that
+// support it, and is the client's username otherwise. The password is
+// compared against the default of the client's model, or against the
+// defaults of all known models if the model has not been set or detected.
+func (c *MotoClient) GetAccountInfo() (*AccountInfo, error) {
+	creds, err := c.credentials()
+	if err != nil {
+		return nil, err
+	}
+
+	info := &AccountInfo{Username: creds.Username}
+	if c.allowed("GetMotoStatusSecAccount", nil) {
+		resp, err := c.do("GetMotoStatusSecAccount", nil)
+		if err != nil {
+			return nil, err
+		}
+		if info = NewAccountInfoFromResponse(resp); info.Username == "" {
+			info.Username = creds.Username
+		}
+	}
+
+	info.DefaultPassword = c.isDefaultPassword(creds.Password)
+	return info, nil
+}
+
+// Returns true if password is the factory default.
+func (c *MotoClient) isDefaultPassword(password string) bool {
+	if model := c.getModel(); model != "" {
+		return password == ProfileFor(model).DefaultPassword
+	}
+	for _, profile := range modelProfiles {
+		if password == profile.DefaultPassword {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/thelande/mb8600/pkg/mb8600test"
+)
+
+func TestMotoClient_GetAccountInfo(t *testing.T) {
+	tests := []struct {
+		name        string
+		password    string
+		model       ModemModel
+		want        AccountInfo
+		wantQueried bool
+	}{
+		{"MB8600 default", "motorola", ModelMB8600, AccountInfo{"admin", true}, false},
+		{"MB8600 changed", "s3cret", ModelMB8600, AccountInfo{"admin", false}, false},
+		{"MB8611 default", "password", ModelMB8611, AccountInfo{"operator", true}, true},
+		{"MB8611 other model default", "motorola", ModelMB8611, AccountInfo{"operator", false}, true},
+		{"unknown model", "password", "", AccountInfo{"admin", true}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modem := mb8600test.NewModem(username, tt.password)
+			modem.SetResponse("GetMotoStatusSecAccount", map[string]string{"CurrentUserName": "operator"})
+			server := mb8600test.NewServer(modem)
+			defer server.Close()
+
+			var opts []Option
+			if tt.model != "" {
+				opts = append(opts, WithModel(tt.model))
+			}
+			c := NewMotoClient(mb8600test.Address(server), username, tt.password, logger, opts...)
+			if _, err := c.Login(); err != nil {
+				t.Fatalf("MotoClient.Login() error = %v", err)
+			}
+
+			got, err := c.GetAccountInfo()
+			if err != nil {
+				t.Fatalf("MotoClient.GetAccountInfo() error = %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("MotoClient.GetAccountInfo() = %+v, want %+v", *got, tt.want)
+			}
+			if queried := slices.Contains(modem.Requests(), "GetMotoStatusSecAccount"); queried != tt.wantQueried {
+				t.Errorf("GetMotoStatusSecAccount queried = %v, want %v", queried, tt.wantQueried)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var hostnameRegexp = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9_.-]*[a-zA-Z0-9])?$`)
+
+// Parses the address of a modem: a host name or IP address with an optional
+// port, e.g. "192.168.100.1", "192.168.100.1:8443", "fe80::1" or
+// "[fe80::1]:8443". Returns the address as used in URLs, with IPv6 literals
+// bracketed.
+func ParseAddress(address string) (string, error) {
+	address = strings.TrimSpace(address)
+	if address == "" {
+		return "", errors.New("empty address")
+	}
+	if strings.ContainsAny(address, "/?#@ ") {
+		return "", fmt.Errorf("address must be a host and optional port, not a URL: %q", address)
+	}
+
+	// An IPv6 literal without a port, which would otherwise be mistaken for
+	// a host and port.
+	literal := strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+	if ip, err := netip.ParseAddr(literal); err == nil && ip.Is6() {
+		return "[" + escapeZone(literal) + "]", nil
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		if strings.Contains(address, ":") {
+			return "", fmt.Errorf("invalid address %q: %w", address, err)
+		}
+		host = address
+	}
+
+	if _, err := netip.ParseAddr(host); err != nil && !hostnameRegexp.MatchString(host) {
+		return "", fmt.Errorf("invalid host in address %q", address)
+	}
+	if port == "" {
+		return host, nil
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("invalid port in address %q", address)
+	}
+	return escapeZone(net.JoinHostPort(host, port)), nil
+}
+
+// Escapes the zone of an IPv6 literal, e.g. "fe80::1%eth0", for use in a URL.
+func escapeZone(address string) string {
+	return strings.ReplaceAll(address, "%", "%25")
+}
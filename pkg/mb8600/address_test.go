@@ -0,0 +1,120 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/thelande/mb8600/pkg/mb8600test"
+)
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+		wantErr bool
+	}{
+		{"192.168.100.1", "192.168.100.1", false},
+		{" 192.168.100.1:8443 ", "192.168.100.1:8443", false},
+		{"modem.lan", "modem.lan", false},
+		{"modem.lan:443", "modem.lan:443", false},
+		{"fe80::1", "[fe80::1]", false},
+		{"[fe80::1]", "[fe80::1]", false},
+		{"[fe80::1]:8443", "[fe80::1]:8443", false},
+		{"fe80::1%eth0", "[fe80::1%25eth0]", false},
+		{"", "", true},
+		{"https://192.168.100.1/", "", true},
+		{"192.168.100.1:https", "", true},
+		{"192.168.100.1:70000", "", true},
+		{"modem_.lan.", "", true},
+		{"fe80::1:8443:", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			got, err := ParseAddress(tt.address)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseAddress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseAddress() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMotoClient_invalidConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		opts    []Option
+	}{
+		{"address", "https://192.168.100.1/", nil},
+		{"path", address, []Option{WithHNAPPath("HNAP1?x=1")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewMotoClient(tt.address, username, password, logger, tt.opts...)
+			if c.Err() == nil {
+				t.Fatalf("MotoClient.Err() = nil, want error")
+			}
+			if _, err := c.Login(); err != c.Err() {
+				t.Errorf("MotoClient.Login() error = %v, want %v", err, c.Err())
+			}
+			if _, err := c.GetDownstreamChannels(); err != c.Err() {
+				t.Errorf("MotoClient.GetDownstreamChannels() error = %v, want %v", err, c.Err())
+			}
+		})
+	}
+}
+
+// A reverse proxy serving the modem under a prefix.
+func TestMotoClient_WithHNAPPath(t *testing.T) {
+	server := mb8600test.NewServer(mb8600test.NewModem(username, password))
+	defer server.Close()
+	modem := mb8600test.Address(server)
+
+	proxy := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, ok := strings.CutPrefix(r.URL.Path, "/modem")
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		req, _ := http.NewRequest(r.Method, "https://"+modem+path, r.Body)
+		req.Header = r.Header
+		resp, err := server.Client().Do(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+		io.Copy(w, resp.Body)
+	}))
+	defer proxy.Close()
+
+	c := NewMotoClient(strings.TrimPrefix(proxy.URL, "https://"), username, password, logger, WithHNAPPath("/modem/HNAP1/"))
+	if _, err := c.Login(); err != nil {
+		t.Fatalf("MotoClient.Login() error = %v", err)
+	}
+	if _, err := c.GetDownstreamChannels(); err != nil {
+		t.Errorf("MotoClient.GetDownstreamChannels() error = %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import "math"
+
+// Statistics of the downstream channels that share a modulation. Averages
+// over QAM and OFDM channels together mean little, since OFDM channels report
+// SNR as MER and count codewords rather than symbols, so dashboards should
+// aggregate per group.
+type DownstreamGroup struct {
+	Modulation string `json:"modulation"`
+	Channels   int    `json:"channels"`
+	Locked     int    `json:"locked"`
+
+	AverageSNR float64 `json:"average_snr_db"`
+	MinSNR     float64 `json:"min_snr_db"`
+	MaxSNR     float64 `json:"max_snr_db"`
+
+	AveragePower float64 `json:"average_power_dbmv"`
+	MinPower     float64 `json:"min_power_dbmv"`
+	MaxPower     float64 `json:"max_power_dbmv"`
+
+	CorrectedErrors   float64 `json:"corrected_errors"`
+	UncorrectedErrors float64 `json:"uncorrected_errors"`
+}
+
+// Statistics of the upstream channels that share a channel type.
+type UpstreamGroup struct {
+	ChannelType string `json:"channel_type"`
+	Channels    int    `json:"channels"`
+	Locked      int    `json:"locked"`
+
+	AveragePower float64 `json:"average_power_dbmv"`
+	MinPower     float64 `json:"min_power_dbmv"`
+	MaxPower     float64 `json:"max_power_dbmv"`
+}
+
+// Returns the downstream channels aggregated by modulation, in the order each
+// modulation first appears.
+func GroupDownstreamByModulation(channels []*DownstreamChannel) []*DownstreamGroup {
+	var groups []*DownstreamGroup
+	index := make(map[string]*DownstreamGroup)
+	for _, ch := range channels {
+		g := index[ch.Modulation]
+		if g == nil {
+			g = &DownstreamGroup{
+				Modulation: ch.Modulation,
+				MinSNR:     math.Inf(1),
+				MaxSNR:     math.Inf(-1),
+				MinPower:   math.Inf(1),
+				MaxPower:   math.Inf(-1),
+			}
+			index[ch.Modulation] = g
+			groups = append(groups, g)
+		}
+
+		g.Channels++
+		if ch.LockStatus == "Locked" {
+			g.Locked++
+		}
+		g.AverageSNR += ch.SignalToNoise
+		g.MinSNR = min(g.MinSNR, ch.SignalToNoise)
+		g.MaxSNR = max(g.MaxSNR, ch.SignalToNoise)
+		g.AveragePower += ch.Power
+		g.MinPower = min(g.MinPower, ch.Power)
+		g.MaxPower = max(g.MaxPower, ch.Power)
+		g.CorrectedErrors += ch.CorrectedErrors
+		g.UncorrectedErrors += ch.UncorrectedErrors
+	}
+
+	for _, g := range groups {
+		g.AverageSNR /= float64(g.Channels)
+		g.AveragePower /= float64(g.Channels)
+	}
+	return groups
+}
+
+// Returns the upstream channels aggregated by channel type, in the order each
+// type first appears.
+func GroupUpstreamByType(channels []*UpstreamChannel) []*UpstreamGroup {
+	var groups []*UpstreamGroup
+	index := make(map[string]*UpstreamGroup)
+	for _, ch := range channels {
+		g := index[ch.ChannelType]
+		if g == nil {
+			g = &UpstreamGroup{
+				ChannelType: ch.ChannelType,
+				MinPower:    math.Inf(1),
+				MaxPower:    math.Inf(-1),
+			}
+			index[ch.ChannelType] = g
+			groups = append(groups, g)
+		}
+
+		g.Channels++
+		if ch.LockStatus == "Locked" {
+			g.Locked++
+		}
+		g.AveragePower += ch.Power
+		g.MinPower = min(g.MinPower, ch.Power)
+		g.MaxPower = max(g.MaxPower, ch.Power)
+	}
+
+	for _, g := range groups {
+		g.AveragePower /= float64(g.Channels)
+	}
+	return groups
+}
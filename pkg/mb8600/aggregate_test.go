@@ -0,0 +1,79 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGroupDownstreamByModulation(t *testing.T) {
+	channels, err := NewDownstreamChannelsFromResponse(
+		"1^Locked^QAM256^20^531.0^ 2.0^40.0^10^1^|+|" +
+			"2^Not Locked^QAM256^21^537.0^ 4.0^44.0^20^2^|+|" +
+			"3^Locked^OFDM PLC^193^957.0^-1.0^43.0^-1^150^")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groups := GroupDownstreamByModulation(channels)
+	if len(groups) != 2 {
+		t.Fatalf("len(GroupDownstreamByModulation()) = %d, want 2", len(groups))
+	}
+
+	qam := groups[0]
+	want := DownstreamGroup{
+		Modulation: "QAM256", Channels: 2, Locked: 1,
+		AverageSNR: 42, MinSNR: 40, MaxSNR: 44,
+		AveragePower: 3, MinPower: 2, MaxPower: 4,
+		CorrectedErrors: 30, UncorrectedErrors: 3,
+	}
+	if *qam != want {
+		t.Errorf("QAM256 group = %+v, want %+v", *qam, want)
+	}
+
+	ofdm := groups[1]
+	if ofdm.Modulation != "OFDM PLC" || ofdm.Channels != 1 || ofdm.AverageSNR != 43 || ofdm.CorrectedErrors != math.MaxUint32 {
+		t.Errorf("OFDM group = %+v", *ofdm)
+	}
+
+	if groups := GroupDownstreamByModulation(nil); len(groups) != 0 {
+		t.Errorf("GroupDownstreamByModulation(nil) = %v, want none", groups)
+	}
+}
+
+func TestGroupUpstreamByType(t *testing.T) {
+	channels, err := NewUpstreamChannelsFromResponse(
+		"1^Locked^SC-QAM^1^5120^16.4^40.0^|+|" +
+			"2^Locked^SC-QAM^2^5120^22.8^44.0^|+|" +
+			"3^Locked^OFDMA^41^0^37.0^38.5^")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groups := GroupUpstreamByType(channels)
+	if len(groups) != 2 {
+		t.Fatalf("len(GroupUpstreamByType()) = %d, want 2", len(groups))
+	}
+	want := UpstreamGroup{ChannelType: "SC-QAM", Channels: 2, Locked: 2, AveragePower: 42, MinPower: 40, MaxPower: 44}
+	if *groups[0] != want {
+		t.Errorf("SC-QAM group = %+v, want %+v", *groups[0], want)
+	}
+	if groups[1].ChannelType != "OFDMA" || groups[1].AveragePower != 38.5 {
+		t.Errorf("OFDMA group = %+v", *groups[1])
+	}
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+var (
+	macPattern  = regexp.MustCompile(`(?i)\b[0-9a-f]{2}(?:[:-][0-9a-f]{2}){5}\b`)
+	ipv4Pattern = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+	ipv6Pattern = regexp.MustCompile(`(?i)[0-9a-f]{0,4}(?::[0-9a-f]{0,4}){2,7}`)
+)
+
+// Replaces the identifiers in modem data, such as MAC addresses, serial
+// numbers, IP addresses and account names, with pseudonyms, so diagnostic
+// data can be shared publicly.
+//
+// Pseudonyms are an HMAC-SHA256 of the identifier under a key: the same key
+// always maps an identifier to the same pseudonym, so anonymized data from
+// different times can still be correlated. Keep the key secret, as MAC
+// addresses are easily brute-forced from their pseudonyms otherwise.
+type Anonymizer struct {
+	key []byte
+}
+
+// Returns an anonymizer deriving pseudonyms with key.
+func NewAnonymizer(key string) *Anonymizer {
+	return &Anonymizer{key: []byte(key)}
+}
+
+// Returns the keyed hash of value, namespaced by kind so that equal values
+// of different kinds get unrelated pseudonyms.
+func (a *Anonymizer) sum(kind, value string) []byte {
+	h := hmac.New(sha256.New, a.key)
+	h.Write([]byte(kind + "\x00" + value))
+	return h.Sum(nil)
+}
+
+// Returns a pseudonym for the MAC address, itself a locally administered
+// MAC address.
+func (a *Anonymizer) MAC(mac string) string {
+	if mac == "" {
+		return ""
+	}
+	normalized := strings.ToLower(strings.ReplaceAll(mac, "-", ":"))
+	sum := a.sum("mac", normalized)
+	sum[0] = sum[0]&0xfc | 0x02
+	return net.HardwareAddr(sum[:6]).String()
+}
+
+// Returns a pseudonym for the serial number.
+func (a *Anonymizer) Serial(serial string) string {
+	if serial == "" {
+		return ""
+	}
+	return "SERIAL-" + strings.ToUpper(hex.EncodeToString(a.sum("serial", serial)[:5]))
+}
+
+// Returns a pseudonym for the IP address.
+func (a *Anonymizer) IP(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("ipv4-%x", a.sum("ip", ip4.String())[:4])
+	}
+	return fmt.Sprintf("ipv6-%x", a.sum("ip", ip.String())[:4])
+}
+
+// Returns a pseudonym for the account name.
+func (a *Anonymizer) Username(name string) string {
+	if name == "" {
+		return ""
+	}
+	return fmt.Sprintf("user-%x", a.sum("user", name)[:4])
+}
+
+// Returns s with the MAC and IP addresses in it replaced by pseudonyms.
+func (a *Anonymizer) Text(s string) string {
+	s = macPattern.ReplaceAllStringFunc(s, a.MAC)
+	s = ipv4Pattern.ReplaceAllStringFunc(s, func(match string) string {
+		if ip := net.ParseIP(match); ip != nil {
+			return a.IP(ip)
+		}
+		return match
+	})
+	return ipv6Pattern.ReplaceAllStringFunc(s, func(match string) string {
+		// Times such as 12:00:01 match the pattern but do not parse.
+		if ip := net.ParseIP(match); ip != nil && strings.Count(match, ":") >= 2 {
+			return a.IP(ip)
+		}
+		return match
+	})
+}
+
+// Returns a copy of the status with its identifiers replaced by pseudonyms.
+// The channels, which hold no identifiers, are shared with status.
+func (a *Anonymizer) Status(status *ModemStatus) *ModemStatus {
+	anon := *status
+	if status.Software != nil {
+		software := *status.Software
+		software.MACAddress = a.MAC(software.MACAddress)
+		software.SerialNumber = a.Serial(software.SerialNumber)
+		anon.Software = &software
+	}
+	if status.Connection != nil {
+		conn := *status.Connection
+		conn.ConnectivityComment = a.Text(conn.ConnectivityComment)
+		conn.BootComment = a.Text(conn.BootComment)
+		anon.Connection = &conn
+	}
+	if status.Startup != nil {
+		startup := *status.Startup
+		startup.DownstreamComment = a.Text(startup.DownstreamComment)
+		startup.ConnectivityComment = a.Text(startup.ConnectivityComment)
+		startup.BootComment = a.Text(startup.BootComment)
+		startup.ConfigFileComment = a.Text(startup.ConfigFileComment)
+		startup.SecurityComment = a.Text(startup.SecurityComment)
+		anon.Startup = &startup
+	}
+	return &anon
+}
+
+// Returns copies of the log entries with the MAC and IP addresses in their
+// descriptions, e.g. the CM-MAC and CMTS-MAC of T3 timeouts, replaced by
+// pseudonyms.
+func (a *Anonymizer) Logs(entries []*LogEntry) []*LogEntry {
+	anon := make([]*LogEntry, len(entries))
+	for i, entry := range entries {
+		e := *entry
+		e.Description = a.Text(e.Description)
+		anon[i] = &e
+	}
+	return anon
+}
+
+// Returns a copy of the account with its name replaced by a pseudonym.
+func (a *Anonymizer) Account(info *AccountInfo) *AccountInfo {
+	anon := *info
+	anon.Username = a.Username(info.Username)
+	return &anon
+}
+
+// Returns a copy of the status with its MAC address, serial number and the
+// addresses in its comments replaced by pseudonyms derived with key, see
+// Anonymizer.
+func Anonymize(status *ModemStatus, key string) *ModemStatus {
+	return NewAnonymizer(key).Status(status)
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestAnonymizer_Text(t *testing.T) {
+	a := NewAnonymizer("secret")
+	mac := a.MAC("00:11:22:33:44:55")
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"no identifiers", "Honoring MDD; IP provisioning mode = IPv6", "Honoring MDD; IP provisioning mode = IPv6"},
+		{"mac", "CM-MAC=00:11:22:33:44:55;", "CM-MAC=" + mac + ";"},
+		{"mac case and separators", "CM-MAC=00-11-22-33-44-55;", "CM-MAC=" + mac + ";"},
+		{"ipv4", "DHCP from 10.1.2.3 failed", "DHCP from " + a.IP(net.ParseIP("10.1.2.3")) + " failed"},
+		{"ipv6", "Prefix 2001:db8::1 assigned", "Prefix " + a.IP(net.ParseIP("2001:db8::1")) + " assigned"},
+		{"time and version", "12:00:01 firmware 8600-19.3.18", "12:00:01 firmware 8600-19.3.18"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := a.Text(tt.in); got != tt.want {
+				t.Errorf("Anonymizer.Text() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnonymizer_pseudonyms(t *testing.T) {
+	a, b := NewAnonymizer("secret"), NewAnonymizer("other")
+
+	mac := a.MAC("00:11:22:33:44:55")
+	if !regexp.MustCompile(`^[0-9a-f]{2}(:[0-9a-f]{2}){5}$`).MatchString(mac) {
+		t.Errorf("Anonymizer.MAC() = %q, want a MAC address", mac)
+	}
+	if hw, _ := net.ParseMAC(mac); hw[0]&0x03 != 0x02 {
+		t.Errorf("Anonymizer.MAC() = %q, want a locally administered unicast address", mac)
+	}
+	if got := a.MAC("00:11:22:33:44:55"); got != mac {
+		t.Errorf("Anonymizer.MAC() = %q, then %q, want the same pseudonym", mac, got)
+	}
+	if got := b.MAC("00:11:22:33:44:55"); got == mac {
+		t.Errorf("Anonymizer.MAC() = %q with different keys, want different pseudonyms", got)
+	}
+	if got := a.Serial("2345-MB8600-1234"); !strings.HasPrefix(got, "SERIAL-") || strings.Contains(got, "1234") {
+		t.Errorf("Anonymizer.Serial() = %q", got)
+	}
+	if got := a.MAC(""); got != "" {
+		t.Errorf("Anonymizer.MAC(\"\") = %q, want empty", got)
+	}
+}
+
+func TestAnonymize(t *testing.T) {
+	status := &ModemStatus{
+		Software:   &SoftwareStatus{SoftwareVersion: "8600-19.3.18", MACAddress: "00:11:22:33:44:55", SerialNumber: "2345-MB8600-1234"},
+		Connection: &ConnectionInfo{ConnectivityComment: "Operational"},
+		Startup:    &StartupSequence{ConfigFileComment: "TFTP from 10.1.2.3"},
+		Downstream: []*DownstreamChannel{{Channel: 1}},
+	}
+
+	got := Anonymize(status, "secret")
+	if got.Software.MACAddress == status.Software.MACAddress || got.Software.SerialNumber == status.Software.SerialNumber {
+		t.Errorf("Anonymize().Software = %+v, want pseudonyms", got.Software)
+	}
+	if got.Software.SoftwareVersion != "8600-19.3.18" || got.Connection.ConnectivityComment != "Operational" {
+		t.Errorf("Anonymize() = %+v, want non-identifiers kept", got)
+	}
+	if strings.Contains(got.Startup.ConfigFileComment, "10.1.2.3") {
+		t.Errorf("Anonymize().Startup.ConfigFileComment = %q, want the address replaced", got.Startup.ConfigFileComment)
+	}
+	if status.Software.MACAddress != "00:11:22:33:44:55" || status.Startup.ConfigFileComment != "TFTP from 10.1.2.3" {
+		t.Errorf("Anonymize() modified its argument: %+v", status)
+	}
+	if len(got.Downstream) != 1 {
+		t.Errorf("Anonymize().Downstream = %v, want the channels kept", got.Downstream)
+	}
+}
+
+func TestAnonymizer_Logs(t *testing.T) {
+	entries := []*LogEntry{{Priority: 3, Description: "No Ranging Response received - T3 time-out;CM-MAC=00:11:22:33:44:55;CMTS-MAC=00:01:5c:aa:bb:cc;CM-QOS=1.1;CM-VER=3.1;"}}
+
+	got := NewAnonymizer("secret").Logs(entries)
+	if strings.Contains(got[0].Description, "00:11:22") || strings.Contains(got[0].Description, "00:01:5c") {
+		t.Errorf("Anonymizer.Logs() description = %q, want MAC addresses replaced", got[0].Description)
+	}
+	if !strings.HasPrefix(got[0].Description, "No Ranging Response received") || !strings.HasSuffix(got[0].Description, "CM-VER=3.1;") {
+		t.Errorf("Anonymizer.Logs() description = %q, want the rest kept", got[0].Description)
+	}
+	if got[0] == entries[0] {
+		t.Errorf("Anonymizer.Logs() returned the original entry")
+	}
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package auth
+
+import (
+	"testing"
+)
+
+const (
+	publicKey = "jXesCa9ek/lI0/R4TNdr"
+	challenge = "q9l0h9ieIXKwJlEtTXps"
+	password  = "motorola"
+	timestamp = 1703361406202
+)
+
+func TestDigests(t *testing.T) {
+	tests := []struct {
+		name   string
+		digest Digest
+		want   string
+	}{
+		{"md5", HMACMD5, "376888B58EBBAA4207D9D4E898C2E504"},
+		{"sha256", HMACSHA256, "4DDCA70C52F53C97771AA1AD7B0C41C6FA8E528AA51FA05E6A50999C93FE8192"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PrivateKey(tt.digest, publicKey, password, challenge); got != tt.want {
+				t.Errorf("PrivateKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeader(t *testing.T) {
+	tests := []struct {
+		name       string
+		privateKey string
+		want       string
+	}{
+		{"default key", DefaultPrivateKey, "B390D71563C4C02619AF9D61F9D942AF 1703361406202"},
+		{"derived key", PrivateKey(HMACMD5, publicKey, password, challenge), "FD695E907F6790F96AD8EF0FB19BCF32 1703361406202"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Header(HMACMD5, tt.privateKey, "Login", timestamp)
+			if got != tt.want {
+				t.Errorf("Header() = %v, want %v", got, tt.want)
+			}
+			if !Verify(HMACMD5, tt.privateKey, "Login", got) {
+				t.Errorf("Verify(%q) = false, want true", got)
+			}
+			if Verify(HMACMD5, tt.privateKey, "GetMotoStatusLog", got) || Verify(HMACSHA256, tt.privateKey, "Login", got) {
+				t.Errorf("Verify() = true for another action or digest, want false")
+			}
+		})
+	}
+}
+
+func TestNamespaceHeader(t *testing.T) {
+	const namespace = "http://example.com/HNAP1/"
+	if got, want := NamespaceHeader(HMACMD5, DefaultPrivateKey, SOAPNamespace, "Login", timestamp), Header(HMACMD5, DefaultPrivateKey, "Login", timestamp); got != want {
+		t.Errorf("NamespaceHeader() with SOAPNamespace = %v, want %v", got, want)
+	}
+
+	got := NamespaceHeader(HMACMD5, DefaultPrivateKey, namespace, "Login", timestamp)
+	if !NamespaceVerify(HMACMD5, DefaultPrivateKey, namespace, "Login", got) {
+		t.Errorf("NamespaceVerify(%q) = false, want true", got)
+	}
+	if Verify(HMACMD5, DefaultPrivateKey, "Login", got) {
+		t.Errorf("Verify(%q) = true for another namespace, want false", got)
+	}
+}
+
+func TestLoginPassword(t *testing.T) {
+	privateKey := PrivateKey(HMACMD5, publicKey, password, challenge)
+	if got, want := LoginPassword(HMACMD5, privateKey, challenge), "AF4422DC7F165272D1C9F2463733BD3A"; got != want {
+		t.Errorf("LoginPassword() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"maps"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Holds recent responses to read-only actions.
+type responseCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cachedResponse
+}
+
+type cachedResponse struct {
+	resp    map[string]string
+	expires time.Time
+}
+
+func newResponseCache(ttl time.Duration) *responseCache {
+	return &responseCache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: map[string]cachedResponse{},
+	}
+}
+
+// Returns true if responses to action with params may be cached. Only
+// parameterless Get actions are, as they do not change modem state.
+func cacheable(action string, params map[string]string) bool {
+	return strings.HasPrefix(action, "Get") && len(params) == 0
+}
+
+// Returns a copy of the cached response to action, if it has not expired.
+func (rc *responseCache) get(action string) (map[string]string, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	entry, ok := rc.entries[action]
+	if !ok || !rc.now().Before(entry.expires) {
+		return nil, false
+	}
+	return maps.Clone(entry.resp), true
+}
+
+func (rc *responseCache) put(action string, resp map[string]string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.entries[action] = cachedResponse{resp: maps.Clone(resp), expires: rc.now().Add(rc.ttl)}
+}
+
+func (rc *responseCache) clear() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	clear(rc.entries)
+}
+
+// Discards all cached responses, so the next call of each action queries the
+// modem. Does nothing if caching is not enabled.
+func (c *MotoClient) ClearCache() {
+	if c.cache != nil {
+		c.cache.clear()
+	}
+}
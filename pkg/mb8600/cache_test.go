@@ -0,0 +1,116 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"testing"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/mb8600test"
+)
+
+func Test_cacheable(t *testing.T) {
+	tests := []struct {
+		action string
+		params map[string]string
+		want   bool
+	}{
+		{"GetMotoStatusSoftware", nil, true},
+		{"GetHomeConnection", map[string]string{}, true},
+		{"Login", nil, false},
+		{"GetMotoStatusLog", map[string]string{"Page": "1"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			if got := cacheable(tt.action, tt.params); got != tt.want {
+				t.Errorf("cacheable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithCache(t *testing.T) {
+	modem := mb8600test.NewModem(username, password)
+	server := mb8600test.NewServer(modem)
+	defer server.Close()
+
+	c := NewMotoClient(mb8600test.Address(server), username, password, logger, WithCache(time.Minute))
+	now := time.Now()
+	c.cache.now = func() time.Time { return now }
+
+	if _, err := c.Login(); err != nil {
+		t.Fatalf("MotoClient.Login() error = %v", err)
+	}
+
+	countRequests := func() int {
+		count := 0
+		for _, action := range modem.Requests() {
+			if action == "GetMotoStatusDownstreamChannelInfo" {
+				count++
+			}
+		}
+		return count
+	}
+
+	for i := 0; i < 3; i++ {
+		channels, err := c.GetDownstreamChannels()
+		if err != nil || len(channels) != 5 {
+			t.Fatalf("MotoClient.GetDownstreamChannels() = %v, %v, want 5 channels", len(channels), err)
+		}
+	}
+	if got := countRequests(); got != 1 {
+		t.Errorf("requests within ttl = %v, want 1", got)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := c.GetDownstreamChannels(); err != nil {
+		t.Fatalf("MotoClient.GetDownstreamChannels() error = %v", err)
+	}
+	if got := countRequests(); got != 2 {
+		t.Errorf("requests after ttl = %v, want 2", got)
+	}
+
+	c.ClearCache()
+	if _, err := c.GetDownstreamChannels(); err != nil {
+		t.Fatalf("MotoClient.GetDownstreamChannels() error = %v", err)
+	}
+	if got := countRequests(); got != 3 {
+		t.Errorf("requests after ClearCache() = %v, want 3", got)
+	}
+}
+
+func TestWithCache_invalidation(t *testing.T) {
+	modem := mb8600test.NewModem(username, password)
+	modem.SetResponse("SetMotoLagStatus", map[string]string{})
+	server := mb8600test.NewServer(modem)
+	defer server.Close()
+
+	c := NewMotoClient(mb8600test.Address(server), username, password, logger, WithCache(time.Minute), WithActions("SetMotoLagStatus"))
+	if _, err := c.Login(); err != nil {
+		t.Fatalf("MotoClient.Login() error = %v", err)
+	}
+
+	if _, err := c.DoAction("GetMotoLagStatus", nil); err != nil {
+		t.Fatalf("MotoClient.DoAction() error = %v", err)
+	}
+	if _, err := c.DoAction("SetMotoLagStatus", map[string]string{"MotoLagEnable": "1"}); err != nil {
+		t.Fatalf("MotoClient.DoAction() error = %v", err)
+	}
+	if _, ok := c.cache.get("GetMotoLagStatus"); ok {
+		t.Errorf("cached response kept after a Set action")
+	}
+}
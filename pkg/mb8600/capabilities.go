@@ -0,0 +1,168 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Whether the modem supports an action, as found by probing it.
+type Support string
+
+const (
+	// The action answered with its expected fields.
+	Supported Support = "supported"
+	// The modem answered the action with an error, or with its expected
+	// fields missing or empty, as firmware does for actions disabled in some
+	// ISP-provisioned modes, such as DPoE or bridge mode.
+	Unsupported Support = "unsupported"
+	// The action could not be probed, e.g. because the modem was unreachable
+	// or the session was rejected.
+	SupportUnknown Support = "unknown"
+)
+
+// The modem does not support the action, as found by Capabilities. Requests
+// for it fail with this error without being sent.
+var ErrUnsupported = errors.New("action not supported by modem")
+
+// The actions a modem supports, as found by probing each action of its
+// model's profile.
+type Capabilities struct {
+	Time    time.Time          `json:"time"`
+	Actions map[string]Support `json:"actions"`
+}
+
+// Returns true if action was found to be supported.
+func (c *Capabilities) Supports(action string) bool {
+	return c.Actions[action] == Supported
+}
+
+// Returns the actions found to be unsupported, sorted.
+func (c *Capabilities) Unsupported() []string {
+	var actions []string
+	for action, support := range c.Actions {
+		if support == Unsupported {
+			actions = append(actions, action)
+		}
+	}
+	sort.Strings(actions)
+	return actions
+}
+
+// Returns true if any action is unsupported, i.e. the modem runs with
+// reduced capabilities.
+func (c *Capabilities) Degraded() bool {
+	return len(c.Unsupported()) > 0
+}
+
+// Probes every action of the client's model profile, except Login, and
+// returns which the modem supports. The client must be logged in. From then
+// on, requests for actions found unsupported fail with ErrUnsupported
+// without being sent, until Capabilities is called again.
+//
+// Returns an error only if no action could be probed, e.g. because the modem
+// is unreachable, along with the capabilities found.
+func (c *MotoClient) Capabilities() (*Capabilities, error) {
+	if c.configErr != nil {
+		return nil, c.configErr
+	}
+	caps := &Capabilities{Time: c.now(), Actions: map[string]Support{}}
+	var firstErr error
+	probed := false
+	for _, action := range c.Profile().Actions {
+		if action == "Login" {
+			continue
+		}
+		// Probed past the cache and the capabilities found before, so that
+		// an action can be found supported again.
+		resp, err := c.doRetry(context.Background(), action, nil)
+		support := classifySupport(action, resp, err)
+		caps.Actions[action] = support
+		if support == SupportUnknown {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		probed = true
+		if support == Unsupported {
+			logInfo(c.Logger, "msg", "action not supported by modem", "action", action, "err", err)
+		}
+	}
+
+	c.mu.Lock()
+	c.capabilities = caps
+	c.mu.Unlock()
+
+	if !probed && firstErr != nil {
+		return caps, fmt.Errorf("unable to probe capabilities: %w", firstErr)
+	}
+	return caps, nil
+}
+
+// Returns whether the response to action, or the error it failed with, shows
+// the action to be supported.
+func classifySupport(action string, resp map[string]string, err error) Support {
+	if err != nil {
+		var statusErr *StatusError
+		switch {
+		case errors.As(err, &statusErr):
+			// Firmware answers disabled actions with a client or server
+			// error, but a gateway error says nothing about the modem.
+			if statusErr.StatusCode == http.StatusBadGateway || statusErr.StatusCode == http.StatusServiceUnavailable ||
+				statusErr.StatusCode == http.StatusGatewayTimeout {
+				return SupportUnknown
+			}
+			return Unsupported
+		case isRetryable(err), errors.Is(err, ErrUnauthorized), errors.Is(err, ErrAuthLockout),
+			errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+			return SupportUnknown
+		}
+		// The modem answered, but not with a response to the action.
+		return Unsupported
+	}
+
+	if result, ok := resp[resultField(action)]; ok && result != "" && result != "OK" {
+		return Unsupported
+	}
+	fields := responseSchemas[action]
+	if len(fields) == 0 {
+		return Supported
+	}
+	for _, field := range fields {
+		if resp[field] != "" {
+			return Supported
+		}
+	}
+	return Unsupported
+}
+
+// Returns an error wrapping ErrUnsupported if Capabilities found action to be
+// unsupported.
+func (c *MotoClient) checkSupported(action string) error {
+	c.mu.Lock()
+	caps := c.capabilities
+	c.mu.Unlock()
+	if caps != nil && caps.Actions[action] == Unsupported {
+		return fmt.Errorf("action, %s: %w", action, ErrUnsupported)
+	}
+	return nil
+}
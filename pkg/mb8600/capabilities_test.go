@@ -0,0 +1,125 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/thelande/mb8600/pkg/mb8600test"
+)
+
+func TestClassifySupport(t *testing.T) {
+	const action = "GetMotoStatusDownstreamChannelInfo"
+	tests := []struct {
+		name string
+		resp map[string]string
+		err  error
+		want Support
+	}{
+		{"supported", map[string]string{"MotoConnDownstreamChannel": downstreamResponse}, nil, Supported},
+		{"empty", map[string]string{"MotoConnDownstreamChannel": ""}, nil, Unsupported},
+		{"missing fields", map[string]string{action + "Result": "OK"}, nil, Unsupported},
+		{"error result", map[string]string{action + "Result": "ERROR", "MotoConnDownstreamChannel": "x"}, nil, Unsupported},
+		{"not found", nil, &StatusError{Action: action, StatusCode: http.StatusNotFound}, Unsupported},
+		{"server error", nil, &StatusError{Action: action, StatusCode: http.StatusInternalServerError}, Unsupported},
+		{"gateway error", nil, &StatusError{Action: action, StatusCode: http.StatusBadGateway}, SupportUnknown},
+		{"no response", nil, fmt.Errorf("no response from modem"), Unsupported},
+		{"unreachable", nil, &url.Error{Op: "Post", Err: errors.New("connection refused")}, SupportUnknown},
+		{"unauthorized", nil, fmt.Errorf("action, %s: %w", action, ErrUnauthorized), SupportUnknown},
+		{"cancelled", nil, context.Canceled, SupportUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifySupport(action, tt.resp, tt.err); got != tt.want {
+				t.Errorf("classifySupport() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMotoClient_Capabilities(t *testing.T) {
+	modem := mb8600test.NewModem(username, password)
+	server := mb8600test.NewServer(modem)
+	defer server.Close()
+	// As in a provisioning mode without link aggregation or channel info.
+	modem.SetStatus("GetMotoLagStatus", http.StatusNotFound)
+	modem.SetResponse("GetMotoStatusDownstreamChannelInfo", map[string]string{"MotoConnDownstreamChannel": ""})
+
+	c := NewMotoClient(mb8600test.Address(server), username, password, logger)
+	if _, err := c.Login(); err != nil {
+		t.Fatalf("MotoClient.Login() error = %v", err)
+	}
+	caps, err := c.Capabilities()
+	if err != nil {
+		t.Fatalf("MotoClient.Capabilities() error = %v", err)
+	}
+	want := []string{"GetMotoLagStatus", "GetMotoStatusDownstreamChannelInfo"}
+	if got := caps.Unsupported(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Capabilities.Unsupported() = %v, want %v", got, want)
+	}
+	if !caps.Degraded() || !caps.Supports("GetMotoStatusUpstreamChannelInfo") || caps.Supports("Login") {
+		t.Errorf("Capabilities = %+v", caps)
+	}
+
+	before := len(modem.Requests())
+	if _, err := c.GetDownstreamChannels(); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("MotoClient.GetDownstreamChannels() error = %v, want %v", err, ErrUnsupported)
+	}
+	if _, err := c.GetUpstreamChannels(); err != nil {
+		t.Errorf("MotoClient.GetUpstreamChannels() error = %v", err)
+	}
+	if requests := modem.Requests()[before:]; !reflect.DeepEqual(requests, []string{"GetMotoStatusUpstreamChannelInfo"}) {
+		t.Errorf("Modem.Requests() = %v, want only the supported action sent", requests)
+	}
+
+	// Probing again finds restored actions.
+	modem.SetStatus("GetMotoLagStatus", 0)
+	modem.SetResponse("GetMotoStatusDownstreamChannelInfo", map[string]string{"MotoConnDownstreamChannel": downstreamResponse})
+	if caps, err = c.Capabilities(); err != nil || caps.Degraded() {
+		t.Fatalf("MotoClient.Capabilities() = %v, %v, want everything supported", caps.Unsupported(), err)
+	}
+	if _, err := c.GetDownstreamChannels(); err != nil {
+		t.Errorf("MotoClient.GetDownstreamChannels() error = %v", err)
+	}
+}
+
+func TestMotoClient_Capabilities_unreachable(t *testing.T) {
+	server := mb8600test.NewServer(mb8600test.NewModem(username, password))
+	address := mb8600test.Address(server)
+	server.Close()
+
+	c := NewMotoClient(address, username, password, logger)
+	caps, err := c.Capabilities()
+	if err == nil {
+		t.Fatalf("MotoClient.Capabilities() error = nil for an unreachable modem")
+	}
+	for action, support := range caps.Actions {
+		if support != SupportUnknown {
+			t.Errorf("support of %s = %v, want %v", action, support, SupportUnknown)
+		}
+	}
+	// Nothing is marked unsupported, so requests are still sent.
+	if _, err := c.GetDownstreamChannels(); errors.Is(err, ErrUnsupported) {
+		t.Errorf("MotoClient.GetDownstreamChannels() error = %v, want a transport error", err)
+	}
+}
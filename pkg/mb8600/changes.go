@@ -0,0 +1,181 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"sort"
+	"time"
+)
+
+// Identifies a channel by its direction and channel ID.
+type ChannelKey struct {
+	Direction string `json:"direction"`
+	ChannelID int    `json:"channel_id"`
+}
+
+// A channel whose lock status changed, e.g. from "Locked" to "Not Locked".
+type LockChange struct {
+	ChannelKey
+	Previous string `json:"previous"`
+	Current  string `json:"current"`
+}
+
+// A channel whose center frequency, in MHz, changed.
+type FrequencyChange struct {
+	ChannelKey
+	Previous float64 `json:"previous_mhz"`
+	Current  float64 `json:"current_mhz"`
+}
+
+// How a reboot was detected.
+type RebootReason string
+
+const (
+	// The modem's uptime decreased.
+	RebootUptime RebootReason = "uptime"
+	// The downstream error counters decreased, as they are only reset by a
+	// reboot. Used when the uptime is not known.
+	RebootCounters RebootReason = "counters"
+)
+
+// A reboot of the modem between two snapshots.
+type Reboot struct {
+	Reason RebootReason `json:"reason"`
+	// The uptime of the modem in the current snapshot, if known, which
+	// bounds when it rebooted.
+	Uptime time.Duration `json:"uptime,omitempty"`
+}
+
+// The changes between two snapshots, as returned by Compare. Channels are
+// ordered downstream first, then by channel ID.
+type ChangeSet struct {
+	Added            []ChannelKey      `json:"added,omitempty"`
+	Removed          []ChannelKey      `json:"removed,omitempty"`
+	LockChanges      []LockChange      `json:"lock_changes,omitempty"`
+	FrequencyChanges []FrequencyChange `json:"frequency_changes,omitempty"`
+	// The reboot of the modem between the snapshots, or nil.
+	Reboot *Reboot `json:"reboot,omitempty"`
+}
+
+// Returns true if the snapshots compared have no differences.
+func (c *ChangeSet) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.LockChanges) == 0 &&
+		len(c.FrequencyChanges) == 0 && c.Reboot == nil
+}
+
+// The properties of a channel compared by Compare, of either direction.
+type channelState struct {
+	lockStatus string
+	frequency  float64
+}
+
+// Returns the changes from snapshot prev to snapshot curr: the channels added
+// and removed, the lock status and frequency changes of the channels in both
+// and whether the modem rebooted in between.
+func Compare(prev, curr *Snapshot) *ChangeSet {
+	changes := &ChangeSet{Reboot: detectReboot(prev, curr)}
+
+	down := func(s *Snapshot) map[int]channelState {
+		states := make(map[int]channelState, len(s.Downstream))
+		for _, ch := range s.Downstream {
+			states[ch.ChannelID] = channelState{ch.LockStatus, ch.Frequency}
+		}
+		return states
+	}
+	up := func(s *Snapshot) map[int]channelState {
+		states := make(map[int]channelState, len(s.Upstream))
+		for _, ch := range s.Upstream {
+			states[ch.ChannelID] = channelState{ch.LockStatus, ch.Frequency}
+		}
+		return states
+	}
+	changes.compareChannels(DirectionDownstream, down(prev), down(curr))
+	changes.compareChannels(DirectionUpstream, up(prev), up(curr))
+	return changes
+}
+
+func (c *ChangeSet) compareChannels(direction string, prev, curr map[int]channelState) {
+	for _, id := range sortedIDs(curr) {
+		key := ChannelKey{direction, id}
+		old, ok := prev[id]
+		if !ok {
+			c.Added = append(c.Added, key)
+			continue
+		}
+		now := curr[id]
+		if old.lockStatus != now.lockStatus {
+			c.LockChanges = append(c.LockChanges, LockChange{key, old.lockStatus, now.lockStatus})
+		}
+		if old.frequency != now.frequency {
+			c.FrequencyChanges = append(c.FrequencyChanges, FrequencyChange{key, old.frequency, now.frequency})
+		}
+	}
+	for _, id := range sortedIDs(prev) {
+		if _, ok := curr[id]; !ok {
+			c.Removed = append(c.Removed, ChannelKey{direction, id})
+		}
+	}
+}
+
+func sortedIDs(states map[int]channelState) []int {
+	ids := make([]int, 0, len(states))
+	for id := range states {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// Returns the reboot of the modem between prev and curr, detected by its
+// uptime if both snapshots report it and by its error counters otherwise, or
+// nil.
+func detectReboot(prev, curr *Snapshot) *Reboot {
+	if prev.Connection != nil && curr.Connection != nil {
+		if curr.Connection.Uptime < prev.Connection.Uptime {
+			return &Reboot{Reason: RebootUptime, Uptime: curr.Connection.Uptime}
+		}
+		return nil
+	}
+	if countersReset(prev, curr) {
+		return &Reboot{Reason: RebootCounters}
+	}
+	return nil
+}
+
+// Returns true if the error counters of the downstream channels in both prev
+// and curr went backwards, as they only do when the modem restarts. Every
+// channel that had errors must have fewer, and channels missing from either
+// snapshot are ignored, so that a channel dropping out of the list or a
+// partial snapshot is not mistaken for a reboot.
+func countersReset(prev, curr *Snapshot) bool {
+	prevErrors := make(map[int]float64, len(prev.Downstream))
+	for _, ch := range prev.Downstream {
+		prevErrors[ch.ChannelID] = ch.CorrectedErrors + ch.UncorrectedErrors
+	}
+	decreased := false
+	for _, ch := range curr.Downstream {
+		old, ok := prevErrors[ch.ChannelID]
+		if !ok {
+			continue
+		}
+		if errors := ch.CorrectedErrors + ch.UncorrectedErrors; errors < old {
+			decreased = true
+		} else if old > 0 {
+			return false
+		}
+	}
+	return decreased
+}
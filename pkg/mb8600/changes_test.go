@@ -0,0 +1,102 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCompare(t *testing.T) {
+	prev := &Snapshot{
+		Downstream: []*DownstreamChannel{
+			{ChannelID: 2, LockStatus: "Locked", Frequency: 537, CorrectedErrors: 10},
+			{ChannelID: 1, LockStatus: "Locked", Frequency: 531},
+			{ChannelID: 3, LockStatus: "Locked", Frequency: 543},
+		},
+		Upstream: []*UpstreamChannel{
+			{ChannelID: 4, LockStatus: "Locked", Frequency: 35.6},
+			{ChannelID: 5, LockStatus: "Locked", Frequency: 29.2},
+		},
+	}
+	curr := &Snapshot{
+		Downstream: []*DownstreamChannel{
+			{ChannelID: 1, LockStatus: "Locked", Frequency: 531},
+			{ChannelID: 2, LockStatus: "Not Locked", Frequency: 537, CorrectedErrors: 12},
+			{ChannelID: 4, LockStatus: "Locked", Frequency: 549},
+		},
+		Upstream: []*UpstreamChannel{
+			{ChannelID: 4, LockStatus: "Locked", Frequency: 22.8},
+			{ChannelID: 5, LockStatus: "Locked", Frequency: 29.2},
+		},
+	}
+
+	got := Compare(prev, curr)
+	want := &ChangeSet{
+		Added:            []ChannelKey{{DirectionDownstream, 4}},
+		Removed:          []ChannelKey{{DirectionDownstream, 3}},
+		LockChanges:      []LockChange{{ChannelKey{DirectionDownstream, 2}, "Locked", "Not Locked"}},
+		FrequencyChanges: []FrequencyChange{{ChannelKey{DirectionUpstream, 4}, 35.6, 22.8}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Compare() = %+v, want %+v", got, want)
+	}
+	if got.Empty() {
+		t.Errorf("ChangeSet.Empty() = true, want false")
+	}
+	if got := Compare(curr, curr); !got.Empty() {
+		t.Errorf("Compare(curr, curr) = %+v, want no changes", got)
+	}
+}
+
+func TestCompare_reboot(t *testing.T) {
+	withCounters := func(corrected float64, uptime *ConnectionInfo) *Snapshot {
+		return &Snapshot{
+			Downstream: []*DownstreamChannel{{ChannelID: 1, LockStatus: "Locked", CorrectedErrors: corrected}},
+			Connection: uptime,
+		}
+	}
+	uptime := func(d time.Duration) *ConnectionInfo { return &ConnectionInfo{Uptime: d} }
+
+	tests := []struct {
+		name       string
+		prev, curr *Snapshot
+		want       *Reboot
+	}{
+		{"steady", withCounters(5, uptime(time.Hour)), withCounters(6, uptime(time.Hour+time.Minute)), nil},
+		{"uptime decreased", withCounters(5, uptime(time.Hour)), withCounters(6, uptime(time.Minute)), &Reboot{Reason: RebootUptime, Uptime: time.Minute}},
+		// The uptime takes precedence, e.g. when the counters were cleared
+		// in the web UI.
+		{"counters cleared", withCounters(5, uptime(time.Hour)), withCounters(0, uptime(2*time.Hour)), nil},
+		{"counters reset", withCounters(5, nil), withCounters(1, nil), &Reboot{Reason: RebootCounters}},
+		{"uptime unknown", withCounters(5, uptime(time.Hour)), withCounters(6, nil), nil},
+		{
+			"channel dropped out",
+			&Snapshot{Downstream: []*DownstreamChannel{{ChannelID: 1, CorrectedErrors: 50}, {ChannelID: 2, CorrectedErrors: 5}}},
+			&Snapshot{Downstream: []*DownstreamChannel{{ChannelID: 2, CorrectedErrors: 6}}},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Compare(tt.prev, tt.curr).Reboot; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Compare().Reboot = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
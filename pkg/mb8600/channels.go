@@ -16,38 +16,111 @@ limitations under the License.
 package mb8600
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 )
 
+// The kind of a channel, distinguishing DOCSIS 3.0 single-carrier QAM channels
+// from DOCSIS 3.1 OFDM (downstream) and OFDMA (upstream) channels.
+type ChannelKind string
+
+const (
+	ChannelKindSCQAM ChannelKind = "SC-QAM"
+	ChannelKindOFDM  ChannelKind = "OFDM"
+	ChannelKindOFDMA ChannelKind = "OFDMA"
+
+	// The modulation reported for the PHY Link Channel of an OFDM channel.
+	ofdmPLCModulation = "OFDM PLC"
+
+	// Separate the rows of a channel response, and the fields of a row.
+	rowSeparator   = "|+|"
+	fieldSeparator = "^"
+
+	// The most rows parsed leniently from a channel response, far more than
+	// any modem bonds, so that a corrupted response is not parsed into
+	// thousands of channels. Strict parsing, which fails on any bad row, has
+	// no limit and parses every row as it always has.
+	maxChannelRows = 256
+	// The channels parsed into a buffer on the stack, above the channels of a
+	// fully bonded modem. Responses with more channels are still parsed, at
+	// the cost of growing the buffer on the heap.
+	stackChannels = 48
+)
+
+var errTooManyRows = fmt.Errorf("more than %d channel rows", maxChannelRows)
+
+// A row of the modem's Downstream Bonded Channels table. See FrequencyMHz,
+// PowerDBmV and SNRdB for the values as typed units.
 type DownstreamChannel struct {
-	Channel           int
-	ChannelID         int
-	LockStatus        string
-	Modulation        string
-	Frequency         float64
-	Power             float64
-	SignalToNoise     float64
-	CorrectedErrors   float64
-	UncorrectedErrors float64
+	Channel    int    `json:"channel"`
+	ChannelID  int    `json:"channel_id"`
+	LockStatus string `json:"lock_status"`
+	Modulation string `json:"modulation"`
+	// The center frequency in MHz, or the PLC frequency for an OFDM PLC row.
+	Frequency float64 `json:"frequency_mhz"`
+	// The received power in dBmV.
+	Power float64 `json:"power_dbmv"`
+	// The signal-to-noise ratio in dB, or the MER for OFDM channels.
+	SignalToNoise float64 `json:"snr_db"`
+	// The corrected and uncorrected codewords since the modem booted.
+	CorrectedErrors   float64 `json:"corrected_errors"`
+	UncorrectedErrors float64 `json:"uncorrected_errors"`
 }
 
 func NewDownstreamChannelsFromResponse(response string) ([]*DownstreamChannel, error) {
-	var channels []*DownstreamChannel
+	var report ParseReport
+	return parseDownstreamRows(response, &report, false)
+}
+
+// Parses the channels of response like NewDownstreamChannelsFromResponse, but
+// skips the rows that do not parse rather than failing, returning the other
+// channels and a report of the skipped rows.
+func ParseDownstreamChannelsLenient(response string) ([]*DownstreamChannel, *ParseReport) {
+	report := &ParseReport{}
+	channels, _ := parseDownstreamRows(response, report, true)
+	return channels, report
+}
 
-	for _, line := range strings.Split(response, "|+|") {
-		if len(line) == 0 {
-			continue
+// Parses the downstream channel rows of response in a single pass, counting
+// them in report. Rows that do not parse fail the parse, or are skipped and
+// recorded in report if lenient, as are the rows past maxChannelRows.
+//
+// The channels are parsed into a buffer on the stack and then copied into
+// one backing array, so a parse costs two allocations however many channels
+// the response holds.
+func parseDownstreamRows(response string, report *ParseReport, lenient bool) ([]*DownstreamChannel, error) {
+	var buf [stackChannels]DownstreamChannel
+	parsed := buf[:0]
+
+	rows := rowTokenizer{rest: response}
+	for row, ok := rows.next(); ok; row, ok = rows.next() {
+		report.Rows++
+		if lenient && report.Rows > maxChannelRows {
+			report.skip(row, errTooManyRows)
+			break
 		}
 
-		if channel, err := NewDownstreamChannelFromLine(line); err != nil {
-			return nil, err
-		} else {
-			channels = append(channels, channel)
+		parsed = append(parsed, DownstreamChannel{})
+		if err := parseDownstreamChannel(row, &parsed[len(parsed)-1]); err != nil {
+			if !lenient {
+				return nil, err
+			}
+			parsed = parsed[:len(parsed)-1]
+			report.skip(row, err)
 		}
 	}
+	if len(parsed) == 0 {
+		return nil, nil
+	}
 
+	backing := make([]DownstreamChannel, len(parsed))
+	copy(backing, parsed)
+	channels := make([]*DownstreamChannel, len(backing))
+	for i := range backing {
+		channels[i] = &backing[i]
+	}
 	return channels, nil
 }
 
@@ -64,75 +137,180 @@ func (c *DownstreamChannel) Equal(o *DownstreamChannel) bool {
 		c.UncorrectedErrors == o.UncorrectedErrors
 }
 
-func NewDownstreamChannelFromLine(line string) (*DownstreamChannel, error) {
-	parts := strings.Split(line, "^")
-	if len(parts) != 10 {
-		return nil, fmt.Errorf("invalid number of parts in downstream channel line: %d", len(parts))
+// Returns the kind of the channel.
+func (c *DownstreamChannel) Kind() ChannelKind {
+	if strings.HasPrefix(c.Modulation, string(ChannelKindOFDM)) {
+		return ChannelKindOFDM
 	}
+	return ChannelKindSCQAM
+}
+
+// Returns true if the channel row describes the PHY Link Channel (PLC) of an
+// OFDM channel, in which case Frequency is the PLC frequency rather than the
+// channel center frequency.
+func (c *DownstreamChannel) IsPLC() bool {
+	return c.Modulation == ofdmPLCModulation
+}
 
-	// Strip whitespace from all parts.
-	for idx := range parts {
-		parts[idx] = strings.Trim(parts[idx], " ")
+// Splits channels into SC-QAM and OFDM channels, preserving order.
+func PartitionDownstreamChannels(channels []*DownstreamChannel) (scqam, ofdm []*DownstreamChannel) {
+	for _, channel := range channels {
+		if channel.Kind() == ChannelKindOFDM {
+			ofdm = append(ofdm, channel)
+		} else {
+			scqam = append(scqam, channel)
+		}
 	}
+	return scqam, ofdm
+}
 
-	channel, err := strconv.Atoi(parts[0])
-	if err != nil {
-		return nil, err
+// The modem reports OFDM codeword counters as signed 32-bit integers, so they
+// go negative once they pass 2^31. Returns the counter as an unsigned value.
+func unwrapCounter(value float64) float64 {
+	if value < 0 {
+		return value + (1 << 32)
 	}
+	return value
+}
 
-	lockStatus := parts[1]
-	modulation := parts[2]
-	channelId, err := strconv.Atoi(parts[3])
-	if err != nil {
+func NewDownstreamChannelFromLine(line string) (*DownstreamChannel, error) {
+	channel := &DownstreamChannel{}
+	if err := parseDownstreamChannel(line, channel); err != nil {
 		return nil, err
 	}
+	return channel, nil
+}
 
-	frequency, err := strconv.ParseFloat(parts[4], 64)
-	if err != nil {
-		return nil, err
+// Parses a downstream channel row into channel.
+func parseDownstreamChannel(line string, channel *DownstreamChannel) error {
+	var parts [10]string
+	if n := splitFields(line, parts[:]); n != len(parts) {
+		return fmt.Errorf("invalid number of parts in downstream channel line: %d", n)
 	}
 
-	power, err := strconv.ParseFloat(parts[5], 64)
-	if err != nil {
-		return nil, err
+	var err error
+	if channel.Channel, err = strconv.Atoi(parts[0]); err != nil {
+		return err
+	}
+	channel.LockStatus = parts[1]
+	channel.Modulation = parts[2]
+	if channel.ChannelID, err = strconv.Atoi(parts[3]); err != nil {
+		return err
+	}
+	if channel.Frequency, err = strconv.ParseFloat(parts[4], 64); err != nil {
+		return err
+	}
+	if channel.Power, err = strconv.ParseFloat(parts[5], 64); err != nil {
+		return err
+	}
+	if channel.SignalToNoise, err = strconv.ParseFloat(parts[6], 64); err != nil {
+		return err
+	}
+	if channel.CorrectedErrors, err = strconv.ParseFloat(parts[7], 64); err != nil {
+		return err
+	}
+	if channel.UncorrectedErrors, err = strconv.ParseFloat(parts[8], 64); err != nil {
+		return err
 	}
 
-	snr, err := strconv.ParseFloat(parts[6], 64)
-	if err != nil {
-		return nil, err
+	if strings.HasPrefix(channel.Modulation, string(ChannelKindOFDM)) {
+		channel.CorrectedErrors = unwrapCounter(channel.CorrectedErrors)
+		channel.UncorrectedErrors = unwrapCounter(channel.UncorrectedErrors)
 	}
+	return nil
+}
 
-	corrected, err := strconv.ParseFloat(parts[7], 64)
-	if err != nil {
-		return nil, err
+// A channel row that could not be parsed.
+type RowError struct {
+	// The index of the row among the non-empty rows of the response.
+	Row  int
+	Line string
+	Err  error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("channel row %d, %q: %v", e.Row, e.Line, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// The outcome of leniently parsing a channel response.
+type ParseReport struct {
+	// The non-empty rows in the response.
+	Rows int
+	// The rows that were skipped, in order.
+	Skipped []*RowError
+}
+
+func (r *ParseReport) skip(line string, err error) {
+	r.Skipped = append(r.Skipped, &RowError{Row: r.Rows - 1, Line: line, Err: err})
+}
+
+// Returns the number of rows that parsed.
+func (r *ParseReport) Parsed() int {
+	return r.Rows - len(r.Skipped)
+}
+
+// Returns the errors of the skipped rows joined, or nil if none were.
+func (r *ParseReport) Err() error {
+	errs := make([]error, len(r.Skipped))
+	for i, skipped := range r.Skipped {
+		errs[i] = skipped
 	}
+	return errors.Join(errs...)
+}
 
-	uncorrected, err := strconv.ParseFloat(parts[8], 64)
-	if err != nil {
-		return nil, err
+// Yields the non-empty rows of a channel response in a single pass, without
+// allocating.
+type rowTokenizer struct {
+	rest string
+	done bool
+}
+
+// Returns the next non-empty row, or false once there are none.
+func (t *rowTokenizer) next() (string, bool) {
+	for !t.done {
+		var row string
+		var more bool
+		row, t.rest, more = strings.Cut(t.rest, rowSeparator)
+		t.done = !more
+		if len(row) > 0 {
+			return row, true
+		}
 	}
+	return "", false
+}
 
-	return &DownstreamChannel{
-		Channel:           channel,
-		ChannelID:         channelId,
-		LockStatus:        lockStatus,
-		Modulation:        modulation,
-		Frequency:         frequency,
-		Power:             power,
-		SignalToNoise:     snr,
-		CorrectedErrors:   corrected,
-		UncorrectedErrors: uncorrected,
-	}, nil
+// Splits a channel row into parts without allocating, trimming spaces from
+// each. Returns the number of parts in the row, which may exceed len(parts),
+// in which case the extra parts are dropped.
+func splitFields(line string, parts []string) int {
+	var n int
+	for field, rest, more := "", line, true; more; n++ {
+		field, rest, more = strings.Cut(rest, fieldSeparator)
+		if n < len(parts) {
+			parts[n] = strings.Trim(field, " ")
+		}
+	}
+	return n
 }
 
+// A row of the modem's Upstream Bonded Channels table, whose columns are the
+// symbol rate, then the frequency, then the transmit power. See FrequencyMHz,
+// PowerDBmV and SymbolRateKsyms for the values as typed units.
 type UpstreamChannel struct {
-	Channel     int
-	ChannelID   int
-	LockStatus  string
-	ChannelType string
-	SymbolRate  float64
-	Frequency   float64
-	Power       float64
+	Channel     int    `json:"channel"`
+	ChannelID   int    `json:"channel_id"`
+	LockStatus  string `json:"lock_status"`
+	ChannelType string `json:"channel_type"`
+	// The symbol rate in Ksym/s.
+	SymbolRate float64 `json:"symbol_rate_ksyms"`
+	// The center frequency in MHz.
+	Frequency float64 `json:"frequency_mhz"`
+	// The transmit power in dBmV.
+	Power float64 `json:"power_dbmv"`
 }
 
 // Returns true if the channel has the same properties as channel o; false otherwise.
@@ -146,69 +324,107 @@ func (c *UpstreamChannel) Equal(o *UpstreamChannel) bool {
 		c.SymbolRate == o.SymbolRate
 }
 
+// Returns the kind of the channel.
+func (c *UpstreamChannel) Kind() ChannelKind {
+	if c.ChannelType == string(ChannelKindOFDMA) {
+		return ChannelKindOFDMA
+	}
+	return ChannelKindSCQAM
+}
+
+// Splits channels into SC-QAM and OFDMA channels, preserving order.
+func PartitionUpstreamChannels(channels []*UpstreamChannel) (scqam, ofdma []*UpstreamChannel) {
+	for _, channel := range channels {
+		if channel.Kind() == ChannelKindOFDMA {
+			ofdma = append(ofdma, channel)
+		} else {
+			scqam = append(scqam, channel)
+		}
+	}
+	return scqam, ofdma
+}
+
 func NewUpstreamChannelsFromResponse(response string) ([]*UpstreamChannel, error) {
-	var channels []*UpstreamChannel
+	var report ParseReport
+	return parseUpstreamRows(response, &report, false)
+}
 
-	for _, line := range strings.Split(response, "|+|") {
-		if len(line) == 0 {
-			continue
+// Parses the channels of response like NewUpstreamChannelsFromResponse, but
+// skips the rows that do not parse rather than failing, returning the other
+// channels and a report of the skipped rows.
+func ParseUpstreamChannelsLenient(response string) ([]*UpstreamChannel, *ParseReport) {
+	report := &ParseReport{}
+	channels, _ := parseUpstreamRows(response, report, true)
+	return channels, report
+}
+
+// Parses the upstream channel rows of response like parseDownstreamRows.
+func parseUpstreamRows(response string, report *ParseReport, lenient bool) ([]*UpstreamChannel, error) {
+	var buf [stackChannels]UpstreamChannel
+	parsed := buf[:0]
+
+	rows := rowTokenizer{rest: response}
+	for row, ok := rows.next(); ok; row, ok = rows.next() {
+		report.Rows++
+		if lenient && report.Rows > maxChannelRows {
+			report.skip(row, errTooManyRows)
+			break
 		}
 
-		if channel, err := NewUpstreamChannelFromLine(line); err != nil {
-			return nil, err
-		} else {
-			channels = append(channels, channel)
+		parsed = append(parsed, UpstreamChannel{})
+		if err := parseUpstreamChannel(row, &parsed[len(parsed)-1]); err != nil {
+			if !lenient {
+				return nil, err
+			}
+			parsed = parsed[:len(parsed)-1]
+			report.skip(row, err)
 		}
 	}
+	if len(parsed) == 0 {
+		return nil, nil
+	}
 
+	backing := make([]UpstreamChannel, len(parsed))
+	copy(backing, parsed)
+	channels := make([]*UpstreamChannel, len(backing))
+	for i := range backing {
+		channels[i] = &backing[i]
+	}
 	return channels, nil
 }
 
 func NewUpstreamChannelFromLine(line string) (*UpstreamChannel, error) {
-	parts := strings.Split(line, "^")
-	if len(parts) != 8 {
-		return nil, fmt.Errorf("invalid number of parts in upstream channel line: %d", len(parts))
+	channel := &UpstreamChannel{}
+	if err := parseUpstreamChannel(line, channel); err != nil {
+		return nil, err
 	}
+	return channel, nil
+}
 
-	// Strip whitespace from all parts.
-	for idx := range parts {
-		parts[idx] = strings.Trim(parts[idx], " ")
+// Parses an upstream channel row into channel.
+func parseUpstreamChannel(line string, channel *UpstreamChannel) error {
+	var parts [8]string
+	if n := splitFields(line, parts[:]); n != len(parts) {
+		return fmt.Errorf("invalid number of parts in upstream channel line: %d", n)
 	}
 
-	channel, err := strconv.Atoi(parts[0])
-	if err != nil {
-		return nil, err
+	var err error
+	if channel.Channel, err = strconv.Atoi(parts[0]); err != nil {
+		return err
 	}
-
-	lockStatus := parts[1]
-	channelType := parts[2]
-	channelId, err := strconv.Atoi(parts[3])
-	if err != nil {
-		return nil, err
+	channel.LockStatus = parts[1]
+	channel.ChannelType = parts[2]
+	if channel.ChannelID, err = strconv.Atoi(parts[3]); err != nil {
+		return err
 	}
-
-	symbolRate, err := strconv.ParseFloat(parts[4], 64)
-	if err != nil {
-		return nil, err
+	if channel.SymbolRate, err = strconv.ParseFloat(parts[4], 64); err != nil {
+		return err
 	}
-
-	frequency, err := strconv.ParseFloat(parts[5], 64)
-	if err != nil {
-		return nil, err
+	if channel.Frequency, err = strconv.ParseFloat(parts[5], 64); err != nil {
+		return err
 	}
-
-	power, err := strconv.ParseFloat(parts[6], 64)
-	if err != nil {
-		return nil, err
+	if channel.Power, err = strconv.ParseFloat(parts[6], 64); err != nil {
+		return err
 	}
-
-	return &UpstreamChannel{
-		Channel:     channel,
-		ChannelID:   channelId,
-		LockStatus:  lockStatus,
-		ChannelType: channelType,
-		SymbolRate:  symbolRate,
-		Frequency:   frequency,
-		Power:       power,
-	}, nil
+	return nil
 }
@@ -192,3 +192,230 @@ func TestNewUpstreamChannelFromLine(t *testing.T) {
 		})
 	}
 }
+
+func TestParseDownstreamChannelsLenient(t *testing.T) {
+	tests := []struct {
+		name        string
+		response    string
+		want        int
+		wantSkipped []int
+	}{
+		{"empty", "", 0, nil},
+		{"valid", downstreamResponse, 33, nil},
+		{"bad row", "1^Locked^QAM256^20^531.0^ 2.8^45.1^0^0^|+|2^Locked^QAM256^x^489.0^ 3.1^45.4^0^0^|+|3^Locked^QAM256^14^495.0^ 3.0^45.5^0^0^", 2, []int{1}},
+		{"short rows", "1^Locked|+|2^Locked^QAM256^13^489.0^ 3.1^45.4^0^0^|+|3", 1, []int{0, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, report := ParseDownstreamChannelsLenient(tt.response)
+			if len(got) != tt.want {
+				t.Errorf("len(ParseDownstreamChannelsLenient()) = %v, want %v", len(got), tt.want)
+			}
+			if report.Parsed() != tt.want {
+				t.Errorf("report.Parsed() = %v, want %v", report.Parsed(), tt.want)
+			}
+			var skipped []int
+			for _, rowErr := range report.Skipped {
+				skipped = append(skipped, rowErr.Row)
+			}
+			if !reflect.DeepEqual(skipped, tt.wantSkipped) {
+				t.Errorf("skipped rows = %v, want %v", skipped, tt.wantSkipped)
+			}
+			if (report.Err() != nil) != (len(tt.wantSkipped) > 0) {
+				t.Errorf("report.Err() = %v", report.Err())
+			}
+		})
+	}
+}
+
+func TestParseUpstreamChannelsLenient(t *testing.T) {
+	got, report := ParseUpstreamChannelsLenient(upstreamResponse + "|+|2^Locked^SC-QAM^x^5120^35.6^56.0^")
+	if len(got) != 1 || !reflect.DeepEqual(got[0], expUpstreamChannel) {
+		t.Fatalf("ParseUpstreamChannelsLenient() = %v, want [%v]", got, expUpstreamChannel)
+	}
+	if report.Rows != 2 || len(report.Skipped) != 1 || report.Skipped[0].Row != 1 {
+		t.Errorf("report = %+v, want row 1 of 2 skipped", report)
+	}
+}
+
+func TestPartitionDownstreamChannels(t *testing.T) {
+	channels, err := NewDownstreamChannelsFromResponse(downstreamResponse)
+	if err != nil {
+		t.Fatalf("NewDownstreamChannelsFromResponse() error = %v", err)
+	}
+
+	scqam, ofdm := PartitionDownstreamChannels(channels)
+	if len(scqam) != 32 {
+		t.Errorf("len(scqam) = %v, want %v", len(scqam), 32)
+	}
+	if len(ofdm) != 1 {
+		t.Fatalf("len(ofdm) = %v, want %v", len(ofdm), 1)
+	}
+	if !ofdm[0].IsPLC() {
+		t.Errorf("ofdm[0].IsPLC() = false, want true")
+	}
+	// -1565968621 as reported by the modem, unwrapped from a signed 32-bit counter.
+	if want := float64(2728998675); ofdm[0].CorrectedErrors != want {
+		t.Errorf("ofdm[0].CorrectedErrors = %v, want %v", ofdm[0].CorrectedErrors, want)
+	}
+}
+
+func TestPartitionUpstreamChannels(t *testing.T) {
+	channels, err := NewUpstreamChannelsFromResponse(upstreamResponse + "|+|2^Locked^OFDMA^41^0^29.8^40.0^")
+	if err != nil {
+		t.Fatalf("NewUpstreamChannelsFromResponse() error = %v", err)
+	}
+
+	scqam, ofdma := PartitionUpstreamChannels(channels)
+	if len(scqam) != 1 || scqam[0].Kind() != ChannelKindSCQAM {
+		t.Errorf("PartitionUpstreamChannels() scqam = %v, want 1 SC-QAM channel", scqam)
+	}
+	if len(ofdma) != 1 || ofdma[0].ChannelID != 41 {
+		t.Errorf("PartitionUpstreamChannels() ofdma = %v, want channel 41", ofdma)
+	}
+}
+
+func TestChannelsFromResponse_rowLimit(t *testing.T) {
+	row := "1^Locked^QAM256^20^531.0^ 2.8^45.1^0^0^"
+	tests := []struct {
+		name        string
+		rows        int
+		wantSkipped bool
+	}{
+		{"stack buffer", stackChannels, false},
+		{"heap buffer", stackChannels + 1, false},
+		{"limit", maxChannelRows, false},
+		{"over limit", maxChannelRows + 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Strict parsing is not limited.
+			response := strings.Repeat(row+"|+|", tt.rows)
+			got, err := NewDownstreamChannelsFromResponse(response)
+			if err != nil {
+				t.Fatalf("NewDownstreamChannelsFromResponse() error = %v", err)
+			}
+			if len(got) != tt.rows {
+				t.Errorf("len(NewDownstreamChannelsFromResponse()) = %v, want %v", len(got), tt.rows)
+			}
+
+			lenient, report := ParseDownstreamChannelsLenient(response)
+			if want := min(tt.rows, maxChannelRows); len(lenient) != want {
+				t.Errorf("len(ParseDownstreamChannelsLenient()) = %v, want %v", len(lenient), want)
+			}
+			if (len(report.Skipped) > 0) != tt.wantSkipped {
+				t.Errorf("report.Skipped = %v, wantSkipped %v", report.Skipped, tt.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestChannelsFromResponse_allocs(t *testing.T) {
+	if testing.CoverMode() != "" {
+		t.Skip("coverage instrumentation changes allocations")
+	}
+	tests := []struct {
+		name  string
+		parse func() error
+	}{
+		{"downstream", func() error {
+			_, err := NewDownstreamChannelsFromResponse(downstreamResponse)
+			return err
+		}},
+		{"upstream", func() error {
+			_, err := NewUpstreamChannelsFromResponse(upstreamResponse)
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// One array of channels and one slice of pointers into it.
+			if allocs := testing.AllocsPerRun(100, func() {
+				if err := tt.parse(); err != nil {
+					t.Fatal(err)
+				}
+			}); allocs != 2 {
+				t.Errorf("allocations = %v, want 2", allocs)
+			}
+		})
+	}
+}
+
+// Checks that a response parses without panicking, that strict and lenient
+// parsing agree, and that no more channels come out than rows went in.
+func FuzzNewDownstreamChannelsFromResponse(f *testing.F) {
+	f.Add(downstreamResponse)
+	f.Add("")
+	f.Add("|+||+|")
+	f.Add("1^Locked|+|2^Locked^QAM256^13^489.0^ 3.1^45.4^0^0^|+|3")
+	f.Add("1^Locked^QAM256^20^531.0^ 2.8^45.1^99999999999^0^")
+	f.Fuzz(func(t *testing.T, response string) {
+		strict, err := NewDownstreamChannelsFromResponse(response)
+		lenient, report := ParseDownstreamChannelsLenient(response)
+		if report.Rows > strings.Count(response, rowSeparator)+1 {
+			t.Fatalf("report.Rows = %v for %d separators", report.Rows, strings.Count(response, rowSeparator))
+		}
+		if len(lenient) != report.Parsed() {
+			t.Fatalf("len(ParseDownstreamChannelsLenient()) = %v, report.Parsed() = %v", len(lenient), report.Parsed())
+		}
+		if (err == nil) != (len(report.Skipped) == 0) {
+			t.Fatalf("strict error = %v, lenient skipped %v", err, report.Skipped)
+		}
+		if err == nil && !reflect.DeepEqual(strict, lenient) {
+			t.Fatalf("strict = %v, lenient = %v", strict, lenient)
+		}
+	})
+}
+
+// Checks upstream responses like FuzzNewDownstreamChannelsFromResponse.
+func FuzzNewUpstreamChannelsFromResponse(f *testing.F) {
+	f.Add(upstreamResponse)
+	f.Add("")
+	f.Add(upstreamResponse + "|+|2^Locked^SC-QAM^x^5120^35.6^56.0^")
+	f.Add("1^^^^^^^|+|")
+	f.Fuzz(func(t *testing.T, response string) {
+		strict, err := NewUpstreamChannelsFromResponse(response)
+		lenient, report := ParseUpstreamChannelsLenient(response)
+		if report.Rows > strings.Count(response, rowSeparator)+1 {
+			t.Fatalf("report.Rows = %v for %d separators", report.Rows, strings.Count(response, rowSeparator))
+		}
+		if len(lenient) != report.Parsed() {
+			t.Fatalf("len(ParseUpstreamChannelsLenient()) = %v, report.Parsed() = %v", len(lenient), report.Parsed())
+		}
+		if (err == nil) != (len(report.Skipped) == 0) {
+			t.Fatalf("strict error = %v, lenient skipped %v", err, report.Skipped)
+		}
+		if err == nil && !reflect.DeepEqual(strict, lenient) {
+			t.Fatalf("strict = %v, lenient = %v", strict, lenient)
+		}
+	})
+}
+
+func BenchmarkNewDownstreamChannelsFromResponse(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := NewDownstreamChannelsFromResponse(downstreamResponse); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkNewUpstreamChannelsFromResponse(b *testing.B) {
+	response := strings.Repeat(upstreamResponse+"|+|", 8)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := NewUpstreamChannelsFromResponse(response); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseDownstreamChannelsLenient(b *testing.B) {
+	response := downstreamResponse + "|+|34^Locked^QAM256^x^957.0^-0.7^43.0^0^0^"
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, report := ParseDownstreamChannelsLenient(response); len(report.Skipped) != 1 {
+			b.Fatalf("skipped %v, want 1 row", report.Skipped)
+		}
+	}
+}
@@ -16,31 +16,41 @@ limitations under the License.
 package mb8600
 
 import (
-	"bytes"
-	"crypto/hmac"
-	"crypto/md5"
+	"context"
 	"crypto/tls"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"net"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
 	"slices"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
-	"github.com/go-kit/log"
-	"github.com/go-kit/log/level"
+	"github.com/thelande/mb8600/pkg/mb8600/auth"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
-	soapNamespace = "http://purenetworks.com/HNAP1/"
+	soapNamespace = auth.SOAPNamespace
 
 	privateKeyCookieName   = "PrivateKey"
-	defaultPrivateKeyValue = "withoutloginkey"
+	defaultPrivateKeyValue = auth.DefaultPrivateKey
+
+	hnapPath = "/HNAP1/"
+
+	// Batches several parameterless actions into one request. Each action is
+	// passed as a parameter with an empty value.
+	multipleHNAPsAction = "GetMultipleHNAPs"
 
 	uidCookieName   = "uid"
 	defaultUidValue = ""
+
+	SchemeHTTPS = "https"
+	SchemeHTTP  = "http"
 )
 
 var (
@@ -58,14 +68,124 @@ var (
 	}
 )
 
+// A client for the HNAP API of a Motorola modem.
+//
+// A MotoClient is safe for concurrent use by multiple goroutines once
+// constructed, provided its exported fields are not modified. Requests made
+// while a login is in progress wait for it to complete, and concurrent
+// requests rejected by a stale session share a single re-login.
 type MotoClient struct {
 	Address  string
 	Username string
 	Password string
-	Logger   log.Logger
+	Logger   Logger
 
-	client      http.Client
+	client      *http.Client
 	timestamper Timestamper
+	// Derives keys and signs requests, HMAC-MD5 unless set WithDigest.
+	digest auth.Digest
+
+	// The address as used in URLs, and the path of the HNAP endpoint.
+	host     string
+	hnapPath string
+	// An invalid address or option, returned by every request.
+	configErr error
+
+	// Guards scheme, schemeProbed, schemeProbing, wireEncoding, model, parseStats and
+	// capabilities.
+	mu sync.Mutex
+
+	scheme         string
+	schemeFallback bool
+	schemeProbed   bool
+	// Closed when the scheme probe in progress, if any, completes.
+	schemeProbing chan struct{}
+
+	statusPageFallback bool
+	eventCodes         *EventCodeTable
+
+	// Held for writing while logging in, and for reading by every other
+	// request, so no request is signed with a half-negotiated private key.
+	// Guards authenticated and sessionGen.
+	authMu sync.RWMutex
+
+	// Set after a successful login, so rejected requests trigger a re-login.
+	authenticated bool
+	// Incremented on every successful login.
+	sessionGen uint64
+
+	// The estimated time the modem keeps an idle session, in nanoseconds,
+	// and when the session was last used, in Unix nanoseconds. The client
+	// logs in again before an idle session would expire. See WithSessionTTL.
+	sessionTTL  atomic.Int64
+	sessionUsed atomic.Int64
+	now         func() time.Time
+
+	model       ModemModel
+	detectModel bool
+
+	parseStats ParseStats
+
+	// The actions found supported by Capabilities, nil until it is called.
+	capabilities *Capabilities
+
+	// Recent responses, if caching is enabled.
+	cache *responseCache
+
+	// How transient failures are retried, if at all.
+	retry *retryPolicy
+	// Actions besides the Get actions that may be retried.
+	idempotentActions []string
+
+	// Actions allowed in addition to those of the model's profile.
+	customActions []string
+	anyAction     bool
+
+	// Whether GetStatus batches its actions with GetMultipleHNAPs.
+	multipleHNAPs bool
+	// The maximum number of requests GetStatus and GetConnectionInfo issue at
+	// once.
+	concurrency int
+
+	// Creates a span per action, if set.
+	tracer trace.Tracer
+
+	// Called around every HNAP request, in order.
+	hooks []RequestHooks
+
+	// Receives a sanitized copy of every exchange, if set.
+	payloadRecorder  PayloadRecorder
+	payloadSanitizer *payloadSanitizer
+
+	// Whether malformed channel rows are skipped rather than failing the
+	// whole channel list.
+	lenientParsing bool
+
+	// Whether only known success values of LoginResult are accepted.
+	strictLogin bool
+	// Spaces and stops logins after authentication failures.
+	loginGuard *loginGuard
+
+	// Supplies the credentials at each login in place of Username and
+	// Password, if set.
+	credentialsProvider CredentialsProvider
+
+	// The configured encoding of HNAP requests, and the one in use, which
+	// differs from it while EncodingAuto has not settled on XML.
+	encoding     Encoding
+	wireEncoding Encoding
+
+	// The namespace prefixed to the action in the SOAPAction header and
+	// signed in HNAP_AUTH.
+	soapNamespace string
+	// The User-Agent header of HNAP requests, Go's default if empty.
+	userAgent string
+	// Additional headers set on every HNAP request.
+	extraHeaders map[string]string
+
+	// How long Ping waits for an answer and how often WaitForOnline pings.
+	probeTimeout  time.Duration
+	probeInterval time.Duration
 }
 
 type Timestamper interface {
@@ -78,130 +198,345 @@ func (t *DefaultTimestamper) Timestamp() int64 {
 	return time.Now().UnixMilli()
 }
 
-func md5Sum(key, data string) string {
-	h := hmac.New(md5.New, []byte(key))
-	io.WriteString(h, data)
-	return fmt.Sprintf("%X", h.Sum(nil))
-}
-
 // Returns a new client with the specified Timestamper class.
 //
-// The client will be configured to skip SSL certificate verification as the cable
-// modem uses a self-signed certificate.
-func NewMotoClientWithTimestamper(address, username, password string, logger log.Logger, timestamper Timestamper) *MotoClient {
+// The address is a host name or IP address with an optional port, see
+// ParseAddress. An invalid address or option is reported by Err and returned
+// by every request.
+//
+// By default, the client will be configured to skip SSL certificate
+// verification as the cable modem uses a self-signed certificate. This can be
+// changed with the WithTLSConfig, WithTransport or WithHTTPClient options.
+func NewMotoClientWithTimestamper(address, username, password string, logger Logger, timestamper Timestamper, opts ...Option) *MotoClient {
 	c := MotoClient{
 		Address:  address,
 		Username: username,
 		Password: password,
 		Logger:   logger,
+		scheme:   SchemeHTTPS,
+		hnapPath: hnapPath,
+		digest:   auth.HMACMD5,
+
+		soapNamespace: soapNamespace,
+		encoding:      EncodingJSON,
+
+		probeTimeout:  defaultProbeTimeout,
+		probeInterval: defaultProbeInterval,
+		now:           time.Now,
+		loginGuard:    newLoginGuard(),
 	}
+	c.sessionTTL.Store(int64(DefaultSessionTTL))
 
 	insecureTransport := http.Transport{
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 	}
 
-	jar, err := cookiejar.New(nil)
-	if err != nil {
-		panic(err)
-	}
-	c.client = http.Client{
-		Jar:       jar,
+	c.client = &http.Client{
 		Transport: &insecureTransport,
 	}
 	c.timestamper = timestamper
 
+	for _, opt := range opts {
+		opt(&c)
+	}
+	c.wireEncoding = c.encoding
+	if c.encoding == EncodingAuto {
+		c.wireEncoding = EncodingJSON
+	}
+
+	host, err := ParseAddress(address)
+	if err != nil {
+		c.configErr = errors.Join(c.configErr, fmt.Errorf("invalid modem address: %w", err))
+	}
+	c.host = host
+
+	if c.client.Jar == nil {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			c.configErr = errors.Join(c.configErr, fmt.Errorf("creating cookie jar: %w", err))
+		}
+		c.client.Jar = jar
+	}
+
 	return &c
 }
 
 // Returns a new client with the default Timestamper class.
 //
-// The client will be configured to skip SSL certificate verification as the cable
-// modem uses a self-signed certificate.
-func NewMotoClient(address, username, password string, logger log.Logger) *MotoClient {
+// The address is a host name or IP address with an optional port, see
+// ParseAddress. An invalid address or option is reported by Err and returned
+// by every request.
+//
+// By default, the client will be configured to skip SSL certificate
+// verification as the cable modem uses a self-signed certificate. This can be
+// changed with the WithTLSConfig, WithTransport or WithHTTPClient options.
+func NewMotoClient(address, username, password string, logger Logger, opts ...Option) *MotoClient {
 	return NewMotoClientWithTimestamper(
 		address,
 		username,
 		password,
 		logger,
 		&DefaultTimestamper{},
+		opts...,
 	)
 }
 
+// Invokes an arbitrary HNAP action with params and returns the contents of
+// its response, e.g. for firmware-specific actions such as SetMotoLagStatus.
+//
+// The action must be supported by the modem's profile or registered with
+// WithActions, unless the allowlist is disabled with WithAnyAction.
+func (c *MotoClient) DoAction(action string, params map[string]string) (map[string]string, error) {
+	return c.DoActionContext(context.Background(), action, params)
+}
+
+// Invokes action like DoAction, carrying ctx, e.g. to cancel the request or
+// to parent its trace span.
+func (c *MotoClient) DoActionContext(ctx context.Context, action string, params map[string]string) (map[string]string, error) {
+	return c.doContext(ctx, action, params)
+}
+
+// Returns true if action may be invoked by the client. A GetMultipleHNAPs
+// request is allowed if every action it batches is.
+func (c *MotoClient) allowed(action string, params map[string]string) bool {
+	if action == multipleHNAPsAction && !c.anyAction {
+		for batched := range params {
+			if !c.allowed(batched, nil) {
+				return false
+			}
+		}
+		return len(params) > 0
+	}
+	return c.anyAction ||
+		slices.Contains(c.Profile().Actions, action) ||
+		slices.Contains(c.customActions, action)
+}
+
+// Performs action without a caller's context, see doContext.
 func (c *MotoClient) do(action string, params map[string]string) (map[string]string, error) {
-	if !slices.Contains(knownActions, action) {
-		return nil, fmt.Errorf("invalid action: %s", action)
+	return c.doContext(context.Background(), action, params)
+}
+
+// Performs action, using a cached response if caching is enabled and one is
+// available. Fails without a request if the action was found unsupported.
+func (c *MotoClient) doContext(ctx context.Context, action string, params map[string]string) (map[string]string, error) {
+	if err := c.checkSupported(action); err != nil {
+		return nil, err
+	}
+	if c.cache == nil {
+		return c.doRetry(ctx, action, params)
+	}
+
+	if !cacheable(action, params) {
+		resp, err := c.doRetry(ctx, action, params)
+		// Any other action may change the state the cached responses reflect.
+		if err == nil && action != "Login" {
+			c.cache.clear()
+		}
+		return resp, err
 	}
 
-	if params == nil {
-		params = map[string]string{}
+	if resp, ok := c.cache.get(action); ok {
+		logDebug(c.Logger, "msg", "using cached response", "action", action)
+		return resp, nil
 	}
 
-	actionUri := fmt.Sprintf("%s%s", soapNamespace, action)
-	data := map[string]map[string]string{action: params}
-	jsonData, err := json.Marshal(data)
+	resp, err := c.doRetry(ctx, action, params)
 	if err != nil {
 		return nil, err
 	}
+	c.cache.put(action, resp)
+	return resp, nil
+}
 
-	headers := map[string]string{
-		"Accept":       "application/json",
-		"Content-Type": "application/json",
-		"SOAPAction":   actionUri,
-		"HNAP_AUTH":    c.hnapAuth(action),
+// Performs action, retrying transient failures according to the client's
+// retry policy until ctx is done. The attempts share a single trace span.
+func (c *MotoClient) doRetry(ctx context.Context, action string, params map[string]string) (map[string]string, error) {
+	ctx, span := c.startSpan(ctx, action)
+
+	attempt := 1
+	resp, err := c.doUncached(ctx, action, params)
+	for c.retry != nil && attempt < c.retry.maxAttempts && isRetryable(err) && c.retries(action) {
+		delay := c.retry.delay(attempt)
+		logDebug(c.Logger, "msg", "retrying action", "action", action, "attempt", attempt, "delay", delay, "err", err)
+		if c.retry.sleep(ctx, delay) != nil {
+			break
+		}
+
+		attempt++
+		resp, err = c.doUncached(ctx, action, params)
 	}
 
-	req, err := http.NewRequest(http.MethodPost, c.GetHNAPURI(), bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, nil
+	endSpan(span, attempt-1, err)
+	return resp, err
+}
+
+// Performs action, logging in again and retrying once if the modem rejects
+// the request because the session it was authenticated with has gone stale.
+func (c *MotoClient) doUncached(ctx context.Context, action string, params map[string]string) (map[string]string, error) {
+	if err := c.refreshIdleSession(ctx); err != nil {
+		return nil, err
+	}
+
+	c.authMu.RLock()
+	gen, authenticated := c.sessionGen, c.authenticated
+	resp, err := c.doOnce(ctx, action, params)
+	c.authMu.RUnlock()
+	if err == nil && authenticated {
+		c.touchSession()
+	}
+	if !errors.Is(err, ErrUnauthorized) || !authenticated {
+		return resp, err
+	}
+	c.learnSessionTTL()
+
+	if err := c.relogin(ctx, action, gen); err != nil {
+		return nil, err
+	}
+
+	c.authMu.RLock()
+	defer c.authMu.RUnlock()
+	return c.doOnce(ctx, action, params)
+}
+
+// Logs in again after a request made with session generation gen was
+// rejected, unless another request has already done so since.
+func (c *MotoClient) relogin(ctx context.Context, action string, gen uint64) error {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+
+	if c.authenticated && c.sessionGen != gen {
+		return nil
+	}
+
+	logInfo(c.Logger, "msg", "session rejected by modem, logging in again", "action", action)
+	_, err := c.login(ctx)
+	return err
+}
+
+func (c *MotoClient) doOnce(ctx context.Context, action string, params map[string]string) (map[string]string, error) {
+	if c.configErr != nil {
+		return nil, c.configErr
+	}
+	if !c.allowed(action, params) {
+		return nil, fmt.Errorf("invalid action: %s", action)
+	}
+
+	if err := c.ensureScheme(ctx); err != nil {
+		return nil, err
 	}
 
-	for name, value := range headers {
-		req.Header.Set(name, value)
+	if len(c.hooks) == 0 {
+		value, _, err := c.send(ctx, action, params)
+		return value, err
 	}
 
-	level.Debug(c.Logger).Log(
+	for _, hooks := range c.hooks {
+		if hooks.OnRequestStart != nil {
+			hooks.OnRequestStart(action)
+		}
+	}
+	info := RequestInfo{Action: action, Start: time.Now()}
+	value, statusCode, err := c.send(ctx, action, params)
+	info.Duration = time.Since(info.Start)
+	info.StatusCode = statusCode
+	info.Err = err
+	for _, hooks := range c.hooks {
+		if hooks.OnRequestDone != nil {
+			hooks.OnRequestDone(info)
+		}
+	}
+	return value, err
+}
+
+// Sends the request for action and decodes the response. Returns the HTTP
+// status code, or 0 if no response was received.
+func (c *MotoClient) send(ctx context.Context, action string, params map[string]string) (map[string]string, int, error) {
+	encoding := c.GetEncoding()
+	value, statusCode, err := c.sendEncoded(ctx, action, params, encoding)
+	if c.encoding != EncodingAuto || encoding == EncodingXML || statusCode != http.StatusInternalServerError {
+		return value, statusCode, err
+	}
+
+	// Firmware that only speaks SOAP fails JSON requests with a 500. Switch to
+	// XML if the same request succeeds in it, but keep JSON if the modem was
+	// failing for another reason.
+	xmlValue, xmlStatusCode, xmlErr := c.sendEncoded(ctx, action, params, EncodingXML)
+	if xmlErr != nil {
+		logDebug(c.Logger, "msg", "XML SOAP request failed too, keeping JSON", "action", action, "err", xmlErr)
+		return value, statusCode, err
+	}
+	logInfo(c.Logger, "msg", "modem rejected JSON HNAP request, switching to XML SOAP", "action", action)
+	c.mu.Lock()
+	c.wireEncoding = EncodingXML
+	c.mu.Unlock()
+	return xmlValue, xmlStatusCode, nil
+}
+
+// Sends the request for action in the given encoding and decodes the response.
+func (c *MotoClient) sendEncoded(ctx context.Context, action string, params map[string]string, encoding Encoding) (map[string]string, int, error) {
+	req, headers, reqBuf, err := c.newRequest(ctx, action, params, encoding)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer reqBuf.release()
+
+	logDebug(c.Logger,
 		"msg", "making request",
 		"uri", c.GetHNAPURI(),
-		"headers", fmt.Sprintf("%s", headers),
-		"data", fmt.Sprintf("%s", data),
+		"headers", redacted{fields: headers},
+		"data", redacted{fields: params, action: action},
 	)
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return nil, nil
+		return nil, 0, err
 	}
 	defer resp.Body.Close()
 
-	level.Debug(c.Logger).Log("status code", resp.StatusCode, "status", resp.Status)
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("action, %s, received non-OK status code: %d", action, resp.StatusCode)
+	logDebug(c.Logger, "msg", "received status", "status code", resp.StatusCode, "status", resp.Status)
+	respBuf := newPooledBuffer()
+	defer respBuf.release()
+	if _, err := respBuf.buf.ReadFrom(resp.Body); err != nil {
+		return nil, resp.StatusCode, err
 	}
-
-	respData, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, nil
+	respData := respBuf.buf.Bytes()
+
+	if resp.StatusCode >= 500 {
+		err = &StatusError{Action: action, StatusCode: resp.StatusCode}
+	} else if isUnauthorized(action, c.hnapPath, resp, respData) {
+		err = fmt.Errorf("action, %s: %w", action, ErrUnauthorized)
+	} else if resp.StatusCode != http.StatusOK {
+		err = &StatusError{Action: action, StatusCode: resp.StatusCode}
 	}
 
-	var respJsonData map[string]map[string]string
-	if err = json.Unmarshal(respData, &respJsonData); err != nil {
-		return nil, err
+	var value map[string]string
+	if err == nil {
+		if encoding == EncodingXML {
+			value, err = decodeXMLResponse(action, respData)
+		} else {
+			value, err = decodeResponse(action, respData)
+		}
 	}
-
-	key := fmt.Sprintf("%sResponse", action)
-	if value, ok := respJsonData[key]; !ok {
-		return nil, fmt.Errorf("no response from modem")
-	} else {
-		return value, nil
+	if c.payloadRecorder != nil {
+		c.recordPayload(action, encoding, params, resp.StatusCode, respData, err)
 	}
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+	if action != multipleHNAPsAction {
+		logDebug(c.Logger, "msg", "received response", "action", action, "data", redacted{fields: value})
+	}
+	return value, resp.StatusCode, nil
 }
 
-func (c *MotoClient) hnapAuth(action string) string {
-	ts := c.timestamper.Timestamp()
-	data := fmt.Sprintf("%d%s%s", ts, soapNamespace, action)
+// Returns the HNAP_AUTH header of a request for action, signed with the
+// current private key.
+func (c *MotoClient) hnapAuth(action string) (string, error) {
 	pkey, err := c.GetPrivateKey()
 	if err != nil {
-		panic(err)
+		return "", err
 	}
-	return fmt.Sprintf("%s %d", md5Sum(pkey, data), ts)
+	return auth.NamespaceHeader(c.digest, pkey, c.soapNamespace, action, c.timestamper.Timestamp()), nil
 }
 
 func (c *MotoClient) getCookie(name, path, defaultValue string) (string, error) {
@@ -258,7 +593,115 @@ func (c *MotoClient) SetUID(uid string) error {
 
 // Returns the API endpoint URI as a string.
 func (c *MotoClient) GetHNAPURI() string {
-	return fmt.Sprintf("https://%s/HNAP1/", c.Address)
+	return c.url(c.hnapPath)
+}
+
+// Returns the URL of path on the modem.
+func (c *MotoClient) url(path string) string {
+	return fmt.Sprintf("%s://%s%s", c.GetScheme(), c.host, path)
+}
+
+// Returns the error in the client's address or options, if any. Every
+// request fails with it.
+func (c *MotoClient) Err() error {
+	return c.configErr
+}
+
+// Returns the scheme used to communicate with the modem.
+func (c *MotoClient) GetScheme() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.scheme
+}
+
+// Returns the encoding requests are currently sent in: the configured one, or
+// for EncodingAuto, JSON until the modem has been found to reject it.
+func (c *MotoClient) GetEncoding() Encoding {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.wireEncoding
+}
+
+// Probes the scheme on first use if scheme fallback is enabled. Concurrent
+// callers wait for a single probe, which runs without holding c.mu so that an
+// unreachable port only delays the requests that need the scheme. A failed
+// probe is repeated by the next request.
+func (c *MotoClient) ensureScheme(ctx context.Context) error {
+	for {
+		c.mu.Lock()
+		if !c.schemeFallback || c.schemeProbed {
+			c.mu.Unlock()
+			return nil
+		}
+		if probing := c.schemeProbing; probing != nil {
+			c.mu.Unlock()
+			select {
+			case <-probing:
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		probing := make(chan struct{})
+		c.schemeProbing = probing
+		c.mu.Unlock()
+
+		err := c.probeScheme(ctx)
+
+		c.mu.Lock()
+		c.schemeProbing = nil
+		c.mu.Unlock()
+		close(probing)
+		return err
+	}
+}
+
+// Determines which scheme the modem serves HNAP over, preferring HTTPS and
+// falling back to plain HTTP for older firmware, which does not listen for
+// HTTPS. Any other HTTPS failure, such as a certificate that does not verify,
+// is returned, so that an attacker cannot force a downgrade.
+func (c *MotoClient) probeScheme(ctx context.Context) error {
+	var errs []error
+	for _, scheme := range []string{SchemeHTTPS, SchemeHTTP} {
+		uri := fmt.Sprintf("%s://%s%s", scheme, c.host, c.hnapPath)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := c.client.Do(req)
+		if err != nil {
+			logDebug(c.Logger, "msg", "scheme probe failed", "uri", uri, "err", err)
+			errs = append(errs, err)
+			if ctx.Err() != nil || !connectionFailed(err) {
+				break
+			}
+			continue
+		}
+		resp.Body.Close()
+
+		logDebug(c.Logger, "msg", "detected modem scheme", "scheme", scheme)
+		c.mu.Lock()
+		c.scheme = scheme
+		c.schemeProbed = true
+		c.mu.Unlock()
+		return nil
+	}
+
+	return fmt.Errorf("unable to reach modem over https or http: %w", errors.Join(errs...))
+}
+
+// Reports whether err failed to establish a connection at all: it was
+// refused, reset or timed out.
+func connectionFailed(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		(errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// Closes the idle connections to the modem, e.g. when the client is no
+// longer needed, so that no connection goroutines outlive it.
+func (c *MotoClient) CloseIdleConnections() {
+	c.client.CloseIdleConnections()
 }
 
 // Returns the API endpoint URI as a url.URL object.
@@ -275,66 +718,187 @@ func (c *MotoClient) GetHNAPURL() (*url.URL, error) {
 // Returns the login response if the login was successful, or an nil map
 // and an error on a login failure.
 func (c *MotoClient) Login() (map[string]string, error) {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+	return c.login(context.Background())
+}
+
+// Performs the login exchange in a trace span of its own, unless the login
+// guard stops it. Must be called with authMu held for writing.
+func (c *MotoClient) login(ctx context.Context) (map[string]string, error) {
+	if err := c.loginGuard.admit(ctx); err != nil {
+		return nil, err
+	}
+	ctx, span := c.startSpan(ctx, "Login")
+	resp, err := c.loginExchange(ctx)
+	c.loginGuard.record(err)
+	endSpan(span, 0, err)
+	return resp, err
+}
+
+func (c *MotoClient) loginExchange(ctx context.Context) (map[string]string, error) {
+	if c.configErr != nil {
+		return nil, c.configErr
+	}
+
+	creds, err := c.credentials()
+	if err != nil {
+		return nil, err
+	}
+
 	data := map[string]string{
 		"Action":        "request",
 		"Captcha":       "",
 		"PrivateLogin":  "LoginPassword",
-		"Username":      c.Username,
+		"Username":      creds.Username,
 		"LoginPassword": "",
 	}
 
-	resp, err := c.do("Login", data)
+	// Start from a fresh session, as a stale private key would otherwise be
+	// used to sign the challenge request.
+	c.authenticated = false
+	if err := c.SetPrivateKey(defaultPrivateKeyValue); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.doOnce(ctx, "Login", data)
 	if err != nil {
 		return nil, err
 	}
 
-	val, ok := resp["LoginResult"]
-	if !ok || val == "FAILED" {
-		return nil, fmt.Errorf("login failed")
+	if err := c.checkLoginResult(resp); err != nil {
+		return nil, err
 	}
 
 	publicKey := resp["PublicKey"]
 	challenge := resp["Challenge"]
 
-	c.SetPrivateKey(md5Sum(fmt.Sprintf("%s%s", publicKey, c.Password), challenge))
-	c.SetUID(resp["Cookie"])
-
-	pkey, err := c.GetPrivateKey()
-	if err != nil {
+	pkey := auth.PrivateKey(c.digest, publicKey, creds.Password, challenge)
+	if err := c.SetPrivateKey(pkey); err != nil {
+		return nil, err
+	}
+	if err := c.SetUID(resp["Cookie"]); err != nil {
 		return nil, err
 	}
+
 	data["Action"] = "login"
-	data["LoginPassword"] = md5Sum(pkey, challenge)
-	resp, err = c.do("Login", data)
+	data["LoginPassword"] = auth.LoginPassword(c.digest, pkey, challenge)
+	resp, err = c.doOnce(ctx, "Login", data)
 	if err != nil {
 		return nil, err
 	}
 
-	if val, ok = resp["LoginResult"]; !ok || val == "FAILED" {
-		return nil, fmt.Errorf("login failed")
+	if err := c.checkLoginResult(resp); err != nil {
+		return nil, err
+	}
+	c.authenticated = true
+	c.sessionGen++
+	c.touchSession()
+
+	if c.detectModel && c.getModel() == "" {
+		if _, err := c.detectModelOnce(ctx); err != nil {
+			logWarn(c.Logger, "msg", "unable to detect modem model", "err", err)
+		}
 	}
 
 	return resp, nil
 }
 
+// Returns a *LoginError unless the LoginResult of resp is a success. Unknown
+// results are accepted with a warning, or rejected if the client was created
+// WithStrictLogin.
+func (c *MotoClient) checkLoginResult(resp map[string]string) error {
+	result := resp["LoginResult"]
+	ok, failed := loginResult(result)
+	switch {
+	case ok:
+		return nil
+	case failed || c.strictLogin:
+		return &LoginError{Result: result}
+	}
+	logWarn(c.Logger, "msg", "accepting unknown login result", "result", result)
+	return nil
+}
+
 // Returns a list of DownstreamChannel objects, or nil on an error.
 func (c *MotoClient) GetDownstreamChannels() ([]*DownstreamChannel, error) {
 	resp, err := c.do("GetMotoStatusDownstreamChannelInfo", nil)
 	if err != nil {
-		return nil, err
+		downstream, _, err := c.scrapeFallback(err)
+		return downstream, err
 	}
+	logDebug(c.Logger, "msg", "got downstream channels", "data", resp["MotoConnDownstreamChannel"])
+	return c.parseDownstream(resp)
+}
+
+// Parses the channels of a GetMotoStatusDownstreamChannelInfo response,
+// skipping bad rows if the client was created WithLenientParsing.
+func (c *MotoClient) parseDownstream(resp map[string]string) ([]*DownstreamChannel, error) {
 	data := resp["MotoConnDownstreamChannel"]
-	level.Debug(c.Logger).Log("msg", "got downstream channels", "data", data)
-	return NewDownstreamChannelsFromResponse(data)
+	if !c.lenientParsing {
+		channels, err := NewDownstreamChannelsFromResponse(data)
+		c.recordParse("GetMotoStatusDownstreamChannelInfo", resp, "MotoConnDownstreamChannel", len(channels))
+		return channels, err
+	}
+
+	channels, report := ParseDownstreamChannelsLenient(data)
+	c.recordParse("GetMotoStatusDownstreamChannelInfo", resp, "MotoConnDownstreamChannel", len(channels))
+	c.logSkipped(DirectionDownstream, report)
+	return channels, nil
 }
 
 // Returns a list of UpstreamChannel objects, or nil on an error.
 func (c *MotoClient) GetUpstreamChannels() ([]*UpstreamChannel, error) {
 	resp, err := c.do("GetMotoStatusUpstreamChannelInfo", nil)
 	if err != nil {
-		return nil, err
+		_, upstream, err := c.scrapeFallback(err)
+		return upstream, err
 	}
+	logDebug(c.Logger, "msg", "got upstream channels", "data", resp["MotoConnUpstreamChannel"])
+	return c.parseUpstream(resp)
+}
+
+// Parses the channels of a GetMotoStatusUpstreamChannelInfo response,
+// skipping bad rows if the client was created WithLenientParsing.
+func (c *MotoClient) parseUpstream(resp map[string]string) ([]*UpstreamChannel, error) {
 	data := resp["MotoConnUpstreamChannel"]
-	level.Debug(c.Logger).Log("msg", "got upstream channels", "data", data)
-	return NewUpstreamChannelsFromResponse(data)
+	if !c.lenientParsing {
+		channels, err := NewUpstreamChannelsFromResponse(data)
+		c.recordParse("GetMotoStatusUpstreamChannelInfo", resp, "MotoConnUpstreamChannel", len(channels))
+		return channels, err
+	}
+
+	channels, report := ParseUpstreamChannelsLenient(data)
+	c.recordParse("GetMotoStatusUpstreamChannelInfo", resp, "MotoConnUpstreamChannel", len(channels))
+	c.logSkipped(DirectionUpstream, report)
+	return channels, nil
+}
+
+// Logs the rows skipped by a lenient parse.
+func (c *MotoClient) logSkipped(direction string, report *ParseReport) {
+	for _, skipped := range report.Skipped {
+		logWarn(c.Logger, "msg", "skipped malformed channel row", "direction", direction, "row", skipped.Row, "line", skipped.Line, "err", skipped.Err)
+	}
+}
+
+// Returns the entries of the modem's event log, classified using the client's
+// event code table.
+func (c *MotoClient) GetLogs() ([]*LogEntry, error) {
+	resp, err := c.do("GetMotoStatusLog", nil)
+	if err != nil {
+		return nil, err
+	}
+	data := resp["MotoStatusLogList"]
+	logDebug(c.Logger, "msg", "got event log", "data", data)
+
+	entries, err := NewLogEntriesFromResponse(data)
+	if err != nil {
+		return nil, err
+	}
+	if c.eventCodes != nil {
+		for _, entry := range entries {
+			entry.Code = c.eventCodes.Classify(entry.Description)
+		}
+	}
+	return entries, nil
 }
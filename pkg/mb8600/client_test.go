@@ -16,10 +16,23 @@ limitations under the License.
 package mb8600
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/prometheus/common/promlog"
+	"github.com/thelande/mb8600/pkg/mb8600/auth"
+	"github.com/thelande/mb8600/pkg/mb8600test"
 )
 
 const (
@@ -44,31 +57,6 @@ func (t *MockTimestamper) Timestamp() int64 {
 	return t.Value
 }
 
-func Test_md5Sum(t *testing.T) {
-	type args struct {
-		key  string
-		data string
-	}
-	tests := []struct {
-		name string
-		args args
-		want string
-	}{
-		{
-			"test",
-			args{fmt.Sprintf("%s%s", publicKey, password), challenge},
-			"376888B58EBBAA4207D9D4E898C2E504",
-		},
-	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := md5Sum(tt.args.key, tt.args.data); got != tt.want {
-				t.Errorf("md5Sum() = %v, want %v", got, tt.want)
-			}
-		})
-	}
-}
-
 func TestMotoClient_hnapAuth(t *testing.T) {
 	clientNoPkey := NewMotoClientWithTimestamper(
 		address,
@@ -90,7 +78,7 @@ func TestMotoClient_hnapAuth(t *testing.T) {
 		},
 	)
 	clientWithPkey.SetPrivateKey(
-		md5Sum(fmt.Sprintf("%s%s", publicKey, password), challenge),
+		auth.PrivateKey(auth.HMACMD5, publicKey, password, challenge),
 	)
 
 	tests := []struct {
@@ -114,7 +102,11 @@ func TestMotoClient_hnapAuth(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := tt.c.hnapAuth(tt.action); got != tt.want {
+			got, err := tt.c.hnapAuth(tt.action)
+			if err != nil {
+				t.Fatalf("MotoClient.hnapAuth() error = %v", err)
+			}
+			if got != tt.want {
 				t.Errorf("MotoClient.hnapAuth() = %v, want %v", got, tt.want)
 			}
 		})
@@ -148,3 +140,386 @@ func TestMotoClient_SetPrivateKey(t *testing.T) {
 		})
 	}
 }
+
+// A transport refusing HTTPS connections, as older firmware does.
+type httpOnlyTransport struct{}
+
+func (httpOnlyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == SchemeHTTPS {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestMotoClient_probeScheme(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	httpServer := httptest.NewServer(handler)
+	defer httpServer.Close()
+	httpsServer := httptest.NewTLSServer(handler)
+	defer httpsServer.Close()
+
+	pinned, err := PinnedTLSConfig(strings.Repeat("00", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		address string
+		opts    []Option
+		want    string
+		wantErr bool
+	}{
+		{"https", strings.TrimPrefix(httpsServer.URL, "https://"), nil, SchemeHTTPS, false},
+		{"http fallback", strings.TrimPrefix(httpServer.URL, "http://"), []Option{WithTransport(httpOnlyTransport{})}, SchemeHTTP, false},
+		{"mismatched pin", strings.TrimPrefix(httpsServer.URL, "https://"), []Option{WithTLSConfig(pinned)}, SchemeHTTPS, true},
+		{"untrusted certificate", strings.TrimPrefix(httpsServer.URL, "https://"), []Option{WithTLSConfig(&tls.Config{})}, SchemeHTTPS, true},
+		{"no tls", strings.TrimPrefix(httpServer.URL, "http://"), nil, SchemeHTTPS, true},
+		{"unreachable", "127.0.0.1:1", nil, SchemeHTTPS, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewMotoClient(tt.address, username, password, logger, append([]Option{WithSchemeFallback()}, tt.opts...)...)
+			if err := c.probeScheme(context.Background()); (err != nil) != tt.wantErr {
+				t.Errorf("MotoClient.probeScheme() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := c.GetScheme(); got != tt.want {
+				t.Errorf("MotoClient.GetScheme() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMotoClient_ensureScheme_context(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	c := NewMotoClient(strings.TrimPrefix(server.URL, "https://"), username, password, logger, WithSchemeFallback())
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = c.ensureScheme(ctx)
+		}(i)
+	}
+
+	// The client stays usable while the probe is in progress.
+	c.GetScheme()
+
+	wg.Wait()
+	for _, err := range errs {
+		if err == nil {
+			t.Errorf("MotoClient.ensureScheme() error = nil, want error")
+		}
+	}
+	if c.schemeProbed {
+		t.Errorf("MotoClient.schemeProbed = true after a failed probe")
+	}
+}
+
+func TestMotoClient_GetHNAPURI(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{"default", nil, "https://192.168.100.1/HNAP1/"},
+		{"http", []Option{WithScheme(SchemeHTTP)}, "http://192.168.100.1/HNAP1/"},
+		{"path", []Option{WithHNAPPath("/modem/HNAP1")}, "https://192.168.100.1/modem/HNAP1/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewMotoClient(address, username, password, logger, tt.opts...)
+			if err := c.Err(); err != nil {
+				t.Fatalf("MotoClient.Err() = %v", err)
+			}
+			if got := c.GetHNAPURI(); got != tt.want {
+				t.Errorf("MotoClient.GetHNAPURI() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMotoClient_unauthorized(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"body", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("UN-AUTH"))
+		}},
+		{"result", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"GetMotoLagStatusResponse":{"GetMotoLagStatusResult":"UN-AUTH"}}`))
+		}},
+		{"redirect", func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/HNAP1/" {
+				http.Redirect(w, r, "/Login.html", http.StatusFound)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html>login</html>"))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewTLSServer(tt.handler)
+			defer server.Close()
+
+			c := NewMotoClient(strings.TrimPrefix(server.URL, "https://"), username, password, logger)
+			if _, err := c.do("GetMotoLagStatus", nil); !errors.Is(err, ErrUnauthorized) {
+				t.Errorf("MotoClient.do() error = %v, want %v", err, ErrUnauthorized)
+			}
+		})
+	}
+}
+
+func TestMotoClient_serverErrorPage(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("<html>Service Unavailable</html>"))
+	}))
+	defer server.Close()
+
+	c := NewMotoClient(strings.TrimPrefix(server.URL, "https://"), username, password, logger)
+	_, err := c.do("GetMotoLagStatus", nil)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("MotoClient.do() error = %v, want a StatusError with status 503", err)
+	}
+	if errors.Is(err, ErrUnauthorized) || !isRetryable(err) {
+		t.Errorf("MotoClient.do() error = %v, want a retryable error", err)
+	}
+}
+
+func Test_loginResult(t *testing.T) {
+	tests := []struct {
+		result     string
+		wantOK     bool
+		wantFailed bool
+	}{
+		{"OK", true, false},
+		{"ok", true, false},
+		{"SUCCESS", true, false},
+		{" Success ", true, false},
+		{"FAILED", false, true},
+		{"failed", false, true},
+		{"LOGIN_FAIL", false, true},
+		{"ERROR", false, true},
+		{"error: bad password", false, true},
+		{"LOCKUP", false, true},
+		{"", false, true},
+		{"RELOAD", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.result, func(t *testing.T) {
+			ok, failed := loginResult(tt.result)
+			if ok != tt.wantOK || failed != tt.wantFailed {
+				t.Errorf("loginResult() = %v, %v, want %v, %v", ok, failed, tt.wantOK, tt.wantFailed)
+			}
+		})
+	}
+}
+
+func TestMotoClient_Login_result(t *testing.T) {
+	tests := []struct {
+		name    string
+		result  string
+		opts    []Option
+		wantErr bool
+	}{
+		{"success", "success", nil, false},
+		{"error", "ERROR", nil, true},
+		{"unknown", "RELOAD", nil, false},
+		{"unknown strict", "RELOAD", []Option{WithStrictLogin()}, true},
+		{"success strict", "Success", []Option{WithStrictLogin()}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, `{"LoginResponse":{"LoginResult":%q,"Challenge":%q,"PublicKey":%q,"Cookie":"1234"}}`, tt.result, challenge, publicKey)
+			}))
+			defer server.Close()
+
+			c := NewMotoClient(strings.TrimPrefix(server.URL, "https://"), username, password, logger, tt.opts...)
+			_, err := c.Login()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MotoClient.Login() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var loginErr *LoginError
+			if tt.wantErr && (!errors.As(err, &loginErr) || loginErr.Result != tt.result) {
+				t.Errorf("MotoClient.Login() error = %v, want a LoginError with result %q", err, tt.result)
+			}
+		})
+	}
+}
+
+func TestMotoClient_relogin(t *testing.T) {
+	modem := mb8600test.NewModem(username, password)
+	server := mb8600test.NewServer(modem)
+	defer server.Close()
+
+	c := NewMotoClient(mb8600test.Address(server), username, password, logger)
+	if _, err := c.GetUpstreamChannels(); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("MotoClient.GetUpstreamChannels() before login error = %v, want %v", err, ErrUnauthorized)
+	}
+
+	if _, err := c.Login(); err != nil {
+		t.Fatalf("MotoClient.Login() error = %v", err)
+	}
+	modem.Logout()
+	if _, err := c.GetUpstreamChannels(); err != nil {
+		t.Errorf("MotoClient.GetUpstreamChannels() after session expiry error = %v", err)
+	}
+}
+
+func TestMotoClient_WithDigest(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantErr bool
+	}{
+		{"sha256", []Option{WithDigest(auth.HMACSHA256)}, false},
+		{"md5 mismatch", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modem := mb8600test.NewModem(username, password)
+			modem.Digest = auth.HMACSHA256
+			server := mb8600test.NewServer(modem)
+			defer server.Close()
+
+			c := NewMotoClient(mb8600test.Address(server), username, password, logger, tt.opts...)
+			if _, err := c.Login(); (err != nil) != tt.wantErr {
+				t.Fatalf("MotoClient.Login() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if _, err := c.GetUpstreamChannels(); err != nil {
+				t.Errorf("MotoClient.GetUpstreamChannels() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestMotoClient_concurrent(t *testing.T) {
+	modem := mb8600test.NewModem(username, password)
+	server := mb8600test.NewServer(modem)
+	defer server.Close()
+
+	c := NewMotoClient(mb8600test.Address(server), username, password, logger, WithSchemeFallback(), WithModelDetection())
+	if _, err := c.Login(); err != nil {
+		t.Fatalf("MotoClient.Login() error = %v", err)
+	}
+	modem.Logout()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.GetDownstreamChannels(); err != nil {
+				errs <- err
+			}
+			c.Profile()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("MotoClient.GetDownstreamChannels() error = %v", err)
+	}
+
+	// The initial login plus a single shared re-login.
+	logins := 0
+	for _, action := range modem.Requests() {
+		if action == "Login" {
+			logins++
+		}
+	}
+	if logins != 4 {
+		t.Errorf("Login requests = %v, want 4", logins)
+	}
+}
+
+func TestMotoClient_DoAction(t *testing.T) {
+	modem := mb8600test.NewModem(username, password)
+	modem.SetResponse("SetMotoLagStatus", map[string]string{})
+	server := mb8600test.NewServer(modem)
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		action  string
+		wantErr bool
+	}{
+		{"known action", nil, "GetMotoLagStatus", false},
+		{"unknown action", nil, "SetMotoLagStatus", true},
+		{"registered action", []Option{WithActions("SetMotoLagStatus")}, "SetMotoLagStatus", false},
+		{"allowlist disabled", []Option{WithAnyAction()}, "SetMotoLagStatus", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewMotoClient(mb8600test.Address(server), username, password, logger, tt.opts...)
+			if _, err := c.Login(); err != nil {
+				t.Fatalf("MotoClient.Login() error = %v", err)
+			}
+
+			resp, err := c.DoAction(tt.action, map[string]string{"MotoLagEnable": "1"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MotoClient.DoAction() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && resp[tt.action+"Result"] != "OK" {
+				t.Errorf("MotoClient.DoAction() = %v, want an OK result", resp)
+			}
+		})
+	}
+}
+
+func TestMotoClient_WithLenientParsing(t *testing.T) {
+	modem := mb8600test.NewModem(username, password)
+	modem.SetResponse("GetMotoStatusUpstreamChannelInfo", map[string]string{
+		"MotoConnUpstreamChannel": upstreamResponse + "|+|2^Locked^SC-QAM^x^5120^35.6^56.0^",
+	})
+	server := mb8600test.NewServer(modem)
+	defer server.Close()
+
+	strict := NewMotoClient(mb8600test.Address(server), username, password, logger)
+	if _, err := strict.Login(); err != nil {
+		t.Fatalf("MotoClient.Login() error = %v", err)
+	}
+	if _, err := strict.GetUpstreamChannels(); err == nil {
+		t.Error("MotoClient.GetUpstreamChannels() strict error = nil, want an error")
+	}
+
+	lenient := NewMotoClient(mb8600test.Address(server), username, password, logger, WithLenientParsing())
+	if _, err := lenient.Login(); err != nil {
+		t.Fatalf("MotoClient.Login() error = %v", err)
+	}
+	channels, err := lenient.GetUpstreamChannels()
+	if err != nil {
+		t.Fatalf("MotoClient.GetUpstreamChannels() lenient error = %v", err)
+	}
+	if len(channels) != 1 {
+		t.Errorf("len(MotoClient.GetUpstreamChannels()) = %d, want 1", len(channels))
+	}
+	if stats := lenient.ParseStats(); stats.LinesSkipped != 1 {
+		t.Errorf("ParseStats().LinesSkipped = %d, want 1", stats.LinesSkipped)
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import "sort"
+
+// Sorts channels by channel ID in place, keeping the order of equal IDs.
+func SortDownstreamByChannelID(channels []*DownstreamChannel) {
+	sort.SliceStable(channels, func(i, j int) bool { return channels[i].ChannelID < channels[j].ChannelID })
+}
+
+// Sorts channels by channel ID in place, keeping the order of equal IDs.
+func SortUpstreamByChannelID(channels []*UpstreamChannel) {
+	sort.SliceStable(channels, func(i, j int) bool { return channels[i].ChannelID < channels[j].ChannelID })
+}
+
+// Returns the locked channels, preserving order.
+func FilterLockedDownstream(channels []*DownstreamChannel) []*DownstreamChannel {
+	var locked []*DownstreamChannel
+	for _, ch := range channels {
+		if ch.LockStatus == "Locked" {
+			locked = append(locked, ch)
+		}
+	}
+	return locked
+}
+
+// Returns the locked channels, preserving order.
+func FilterLockedUpstream(channels []*UpstreamChannel) []*UpstreamChannel {
+	var locked []*UpstreamChannel
+	for _, ch := range channels {
+		if ch.LockStatus == "Locked" {
+			locked = append(locked, ch)
+		}
+	}
+	return locked
+}
+
+// Returns the first channel with the given channel ID, or nil if there is none.
+// An OFDM channel may appear twice, once for its PLC row.
+func FindDownstreamByChannelID(channels []*DownstreamChannel, id int) *DownstreamChannel {
+	for _, ch := range channels {
+		if ch.ChannelID == id {
+			return ch
+		}
+	}
+	return nil
+}
+
+// Returns the first channel with the given channel ID, or nil if there is none.
+func FindUpstreamByChannelID(channels []*UpstreamChannel, id int) *UpstreamChannel {
+	for _, ch := range channels {
+		if ch.ChannelID == id {
+			return ch
+		}
+	}
+	return nil
+}
+
+// Returns the lowest SNR of the locked channels, and false if none are locked.
+// Unlocked channels report an SNR of zero, so they are skipped. OFDM channels
+// report MER, which runs lower than SC-QAM SNR; pass the channels of one kind
+// from PartitionDownstreamChannels to avoid mixing them.
+func MinSNR(channels []*DownstreamChannel) (float64, bool) {
+	var lowest float64
+	found := false
+	for _, ch := range FilterLockedDownstream(channels) {
+		if !found || ch.SignalToNoise < lowest {
+			lowest, found = ch.SignalToNoise, true
+		}
+	}
+	return lowest, found
+}
+
+// Returns the highest power of the locked channels, and false if none are
+// locked.
+func MaxDownstreamPower(channels []*DownstreamChannel) (float64, bool) {
+	var highest float64
+	found := false
+	for _, ch := range FilterLockedDownstream(channels) {
+		if !found || ch.Power > highest {
+			highest, found = ch.Power, true
+		}
+	}
+	return highest, found
+}
+
+// Returns the highest transmit power of the locked channels, and false if none
+// are locked.
+func MaxUpstreamPower(channels []*UpstreamChannel) (float64, bool) {
+	var highest float64
+	found := false
+	for _, ch := range FilterLockedUpstream(channels) {
+		if !found || ch.Power > highest {
+			highest, found = ch.Power, true
+		}
+	}
+	return highest, found
+}
+
+// Returns the total corrected codewords of the channels.
+func TotalCorrected(channels []*DownstreamChannel) float64 {
+	var total float64
+	for _, ch := range channels {
+		total += ch.CorrectedErrors
+	}
+	return total
+}
+
+// Returns the total uncorrected codewords of the channels.
+func TotalUncorrected(channels []*DownstreamChannel) float64 {
+	var total float64
+	for _, ch := range channels {
+		total += ch.UncorrectedErrors
+	}
+	return total
+}
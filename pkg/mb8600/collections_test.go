@@ -0,0 +1,123 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"reflect"
+	"testing"
+)
+
+func collectionsDownstream(t *testing.T) []*DownstreamChannel {
+	channels, err := NewDownstreamChannelsFromResponse(
+		"1^Locked^QAM256^22^537.0^ 2.0^40.0^10^1^|+|" +
+			"2^Not Locked^QAM256^21^531.0^ 0.0^0.0^0^0^|+|" +
+			"3^Locked^QAM256^20^525.0^ 4.5^38.5^20^2^|+|" +
+			"4^Locked^OFDM PLC^193^957.0^-0.7^43.0^5^150^")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return channels
+}
+
+func channelIDs(channels []*DownstreamChannel) []int {
+	ids := make([]int, len(channels))
+	for i, ch := range channels {
+		ids[i] = ch.ChannelID
+	}
+	return ids
+}
+
+func TestSortDownstreamByChannelID(t *testing.T) {
+	channels := collectionsDownstream(t)
+	SortDownstreamByChannelID(channels)
+	if got, want := channelIDs(channels), []int{20, 21, 22, 193}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SortDownstreamByChannelID() = %v, want %v", got, want)
+	}
+}
+
+func TestFilterLockedDownstream(t *testing.T) {
+	if got, want := channelIDs(FilterLockedDownstream(collectionsDownstream(t))), []int{22, 20, 193}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FilterLockedDownstream() = %v, want %v", got, want)
+	}
+}
+
+func TestFindDownstreamByChannelID(t *testing.T) {
+	channels := collectionsDownstream(t)
+	if ch := FindDownstreamByChannelID(channels, 20); ch == nil || ch.Channel != 3 {
+		t.Errorf("FindDownstreamByChannelID(20) = %v, want channel 3", ch)
+	}
+	if ch := FindDownstreamByChannelID(channels, 99); ch != nil {
+		t.Errorf("FindDownstreamByChannelID(99) = %v, want nil", ch)
+	}
+}
+
+func TestDownstreamAggregates(t *testing.T) {
+	channels := collectionsDownstream(t)
+	scqam, _ := PartitionDownstreamChannels(channels)
+
+	tests := []struct {
+		name      string
+		fn        func([]*DownstreamChannel) (float64, bool)
+		channels  []*DownstreamChannel
+		want      float64
+		wantFound bool
+	}{
+		{"MinSNR skips unlocked", MinSNR, scqam, 38.5, true},
+		{"MinSNR none", MinSNR, nil, 0, false},
+		{"MaxDownstreamPower", MaxDownstreamPower, channels, 4.5, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := tt.fn(tt.channels)
+			if got != tt.want || found != tt.wantFound {
+				t.Errorf("%s = %v, %v, want %v, %v", tt.name, got, found, tt.want, tt.wantFound)
+			}
+		})
+	}
+
+	if got := TotalCorrected(channels); got != 35 {
+		t.Errorf("TotalCorrected() = %v, want 35", got)
+	}
+	if got := TotalUncorrected(scqam); got != 3 {
+		t.Errorf("TotalUncorrected() = %v, want 3", got)
+	}
+}
+
+func TestUpstreamCollections(t *testing.T) {
+	channels, err := NewUpstreamChannelsFromResponse(
+		"1^Locked^SC-QAM^3^5120^22.8^44.0^|+|" +
+			"2^Not Locked^SC-QAM^2^0^0.0^0.0^|+|" +
+			"3^Locked^SC-QAM^1^5120^16.4^47.5^")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := len(FilterLockedUpstream(channels)); got != 2 {
+		t.Errorf("len(FilterLockedUpstream()) = %d, want 2", got)
+	}
+	if ch := FindUpstreamByChannelID(channels, 2); ch == nil || ch.Channel != 2 {
+		t.Errorf("FindUpstreamByChannelID(2) = %v, want channel 2", ch)
+	}
+	if power, ok := MaxUpstreamPower(channels); power != 47.5 || !ok {
+		t.Errorf("MaxUpstreamPower() = %v, %v, want 47.5, true", power, ok)
+	}
+
+	SortUpstreamByChannelID(channels)
+	if channels[0].ChannelID != 1 || channels[2].ChannelID != 3 {
+		t.Errorf("SortUpstreamByChannelID() = %v", channels)
+	}
+}
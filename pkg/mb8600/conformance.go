@@ -0,0 +1,284 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/thelande/mb8600/pkg/i18n"
+)
+
+type ConformanceStatus string
+
+const (
+	// All expected fields were present and the action reported success.
+	ConformancePass ConformanceStatus = "PASS"
+	// The action responded, but the response did not match the expected schema.
+	ConformanceFail ConformanceStatus = "FAIL"
+	// The action could not be invoked at all.
+	ConformanceError ConformanceStatus = "ERROR"
+)
+
+var (
+	// The fields each modeled action is expected to return, not including the
+	// "<Action>Result" field which is checked for every action.
+	responseSchemas = map[string][]string{
+		"Login": {},
+		"GetHomeConnection": {
+			"MotoHomeOnline",
+			"MotoHomeDownNum",
+			"MotoHomeUpNum",
+		},
+		"GetHomeAddress": {
+			"MotoHomeMacAddress",
+			"MotoHomeIpAddress",
+			"MotoHomeIpv6Address",
+			"MotoHomeSfVer",
+		},
+		"GetMotoStatusSoftware": {
+			"StatusSoftwareSpecVer",
+			"StatusSoftwareHdVer",
+			"StatusSoftwareSfVer",
+			"StatusSoftwareMac",
+			"StatusSoftwareSerialNum",
+			"StatusSoftwareCustomerVer",
+		},
+		"GetMotoStatusLog": {
+			"MotoStatusLogList",
+		},
+		"GetMotoLagStatus": {
+			"MotoLagCurrentStatus",
+		},
+		"GetMotoStatusConnectionInfo": {
+			"MotoConnSystemUpTime",
+			"MotoConnNetworkAccess",
+		},
+		"GetMotoStatusDownstreamChannelInfo": {
+			"MotoConnDownstreamChannel",
+		},
+		"GetMotoStatusStartupSequence": {
+			"MotoConnDSFreq",
+			"MotoConnDSComment",
+			"MotoConnConnectivityStatus",
+			"MotoConnConnectivityComment",
+			"MotoConnBootStatus",
+			"MotoConnBootComment",
+			"MotoConnConfigurationFileStatus",
+			"MotoConnConfigurationFileComment",
+			"MotoConnSecurityStatus",
+			"MotoConnSecurityComment",
+		},
+		"GetMotoStatusUpstreamChannelInfo": {
+			"MotoConnUpstreamChannel",
+		},
+		"GetMotoStatusSecAccount": {
+			"CurrentUserName",
+		},
+	}
+)
+
+// The outcome of validating a single action's response.
+type ConformanceResult struct {
+	Action        string
+	Status        ConformanceStatus
+	MissingFields []string
+	UnknownFields []string
+	Problems      []string
+	Err           error
+}
+
+// A conformance matrix covering every modeled action.
+type ConformanceReport struct {
+	Results []*ConformanceResult
+}
+
+// Returns the names of the fields expected in the response to action, or nil
+// if the action is not modeled.
+func ResponseSchema(action string) []string {
+	fields, ok := responseSchemas[action]
+	if !ok {
+		return nil
+	}
+	return append([]string{resultField(action)}, fields...)
+}
+
+func resultField(action string) string {
+	return fmt.Sprintf("%sResult", action)
+}
+
+// Validates a decoded response for action against the expected schema.
+//
+// Missing fields and an unsuccessful result mark the response as failed. Fields that
+// are not part of the schema are recorded but do not fail validation, as
+// firmware revisions commonly add fields.
+func ValidateResponse(action string, resp map[string]string) *ConformanceResult {
+	result := &ConformanceResult{Action: action, Status: ConformancePass}
+
+	if _, ok := responseSchemas[action]; !ok {
+		result.Status = ConformanceError
+		result.Err = fmt.Errorf("invalid action: %s", action)
+		return result
+	}
+
+	result.MissingFields, result.UnknownFields = compareSchema(action, resp)
+
+	// Results are normalized as for logins, as firmware also answers
+	// "SUCCESS" or "success".
+	if val, ok := resp[resultField(action)]; ok {
+		if success, _ := loginResult(val); !success {
+			result.Problems = append(result.Problems, fmt.Sprintf("%s is %q", resultField(action), val))
+		}
+	}
+
+	// Channel payloads must also be parsable.
+	switch action {
+	case "GetMotoStatusDownstreamChannelInfo":
+		if _, err := NewDownstreamChannelsFromResponse(resp["MotoConnDownstreamChannel"]); err != nil {
+			result.Problems = append(result.Problems, err.Error())
+		}
+	case "GetMotoStatusUpstreamChannelInfo":
+		if _, err := NewUpstreamChannelsFromResponse(resp["MotoConnUpstreamChannel"]); err != nil {
+			result.Problems = append(result.Problems, err.Error())
+		}
+	}
+
+	if len(result.MissingFields) > 0 || len(result.Problems) > 0 {
+		result.Status = ConformanceFail
+	}
+
+	return result
+}
+
+// Returns the schema fields of action missing from resp, and the fields of
+// resp that are not part of the schema, sorted.
+func compareSchema(action string, resp map[string]string) (missing, unknown []string) {
+	expected := map[string]bool{}
+	for _, field := range ResponseSchema(action) {
+		expected[field] = true
+		if _, ok := resp[field]; !ok {
+			missing = append(missing, field)
+		}
+	}
+
+	for field := range resp {
+		if !expected[field] {
+			unknown = append(unknown, field)
+		}
+	}
+	sort.Strings(unknown)
+
+	return missing, unknown
+}
+
+// Validates a raw HNAP response body (e.g. a capture from a real modem) for
+// action against the expected schema.
+func ValidateResponseBody(action string, body []byte) *ConformanceResult {
+	var data map[string]map[string]string
+	if err := json.Unmarshal(body, &data); err != nil {
+		return &ConformanceResult{Action: action, Status: ConformanceError, Err: err}
+	}
+
+	resp, ok := data[fmt.Sprintf("%sResponse", action)]
+	if !ok {
+		return &ConformanceResult{
+			Action: action,
+			Status: ConformanceError,
+			Err:    fmt.Errorf("no response from modem"),
+		}
+	}
+
+	return ValidateResponse(action, resp)
+}
+
+// Logs in and exercises every modeled action, validating each response
+// against the expected schema.
+func (c *MotoClient) CheckConformance() *ConformanceReport {
+	report := &ConformanceReport{}
+
+	loginResult := &ConformanceResult{Action: "Login", Status: ConformancePass}
+	if resp, err := c.Login(); err != nil {
+		loginResult.Status = ConformanceError
+		loginResult.Err = err
+	} else {
+		loginResult = ValidateResponse("Login", resp)
+	}
+	report.Results = append(report.Results, loginResult)
+
+	for _, action := range c.Profile().Actions {
+		if action == "Login" {
+			continue
+		}
+
+		resp, err := c.do(action, nil)
+		if err != nil {
+			report.Results = append(report.Results, &ConformanceResult{
+				Action: action,
+				Status: ConformanceError,
+				Err:    err,
+			})
+			continue
+		}
+		report.Results = append(report.Results, ValidateResponse(action, resp))
+	}
+
+	return report
+}
+
+// Returns true if every action in the report passed.
+func (r *ConformanceReport) Passed() bool {
+	for _, result := range r.Results {
+		if result.Status != ConformancePass {
+			return false
+		}
+	}
+	return true
+}
+
+// Renders the report as a text matrix, one action per line.
+func (r *ConformanceReport) String() string {
+	return r.Render(nil)
+}
+
+// Renders the report as a text matrix, one action per line, with headings and
+// details translated by p. A nil Printer renders in English.
+func (r *ConformanceReport) Render(p *i18n.Printer) string {
+	width := len([]rune(p.Translate("ACTION")))
+	for _, result := range r.Results {
+		width = max(width, len(result.Action))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-*s  %-6s  %s\n", width, p.Translate("ACTION"), p.Translate("STATUS"), p.Translate("DETAILS"))
+	for _, result := range r.Results {
+		var details []string
+		if result.Err != nil {
+			details = append(details, result.Err.Error())
+		}
+		if len(result.MissingFields) > 0 {
+			details = append(details, p.Sprintf("missing: %s", strings.Join(result.MissingFields, ",")))
+		}
+		if len(result.UnknownFields) > 0 {
+			details = append(details, p.Sprintf("unknown: %s", strings.Join(result.UnknownFields, ",")))
+		}
+		details = append(details, result.Problems...)
+		fmt.Fprintf(&b, "%-*s  %-6s  %s\n", width, result.Action, result.Status, strings.Join(details, "; "))
+	}
+
+	return b.String()
+}
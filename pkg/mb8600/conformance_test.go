@@ -0,0 +1,191 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/thelande/mb8600/pkg/i18n"
+	"github.com/thelande/mb8600/pkg/mb8600test"
+)
+
+func TestValidateResponse(t *testing.T) {
+	type args struct {
+		action string
+		resp   map[string]string
+	}
+	tests := []struct {
+		name        string
+		args        args
+		want        ConformanceStatus
+		wantMissing []string
+		wantUnknown []string
+	}{
+		{
+			"valid",
+			args{"GetMotoLagStatus", map[string]string{
+				"GetMotoLagStatusResult": "OK",
+				"MotoLagCurrentStatus":   "0",
+			}},
+			ConformancePass,
+			nil,
+			nil,
+		},
+		{
+			"unknown field",
+			args{"GetMotoLagStatus", map[string]string{
+				"GetMotoLagStatusResult": "OK",
+				"MotoLagCurrentStatus":   "0",
+				"MotoLagNew":             "1",
+			}},
+			ConformancePass,
+			nil,
+			[]string{"MotoLagNew"},
+		},
+		{
+			"missing field",
+			args{"GetMotoLagStatus", map[string]string{
+				"GetMotoLagStatusResult": "OK",
+			}},
+			ConformanceFail,
+			[]string{"MotoLagCurrentStatus"},
+			nil,
+		},
+		{
+			"result success",
+			args{"GetMotoLagStatus", map[string]string{
+				"GetMotoLagStatusResult": "success",
+				"MotoLagCurrentStatus":   "0",
+			}},
+			ConformancePass,
+			nil,
+			nil,
+		},
+		{
+			"result not ok",
+			args{"GetMotoLagStatus", map[string]string{
+				"GetMotoLagStatusResult": "ERROR",
+				"MotoLagCurrentStatus":   "0",
+			}},
+			ConformanceFail,
+			nil,
+			nil,
+		},
+		{
+			"bad channel data",
+			args{"GetMotoStatusUpstreamChannelInfo", map[string]string{
+				"GetMotoStatusUpstreamChannelInfoResult": "OK",
+				"MotoConnUpstreamChannel":                "1^Locked^",
+			}},
+			ConformanceFail,
+			nil,
+			nil,
+		},
+		{
+			"unmodeled action",
+			args{"SetMotoLagStatus", map[string]string{}},
+			ConformanceError,
+			nil,
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ValidateResponse(tt.args.action, tt.args.resp)
+			if got.Status != tt.want {
+				t.Errorf("ValidateResponse().Status = %v, want %v", got.Status, tt.want)
+			}
+			if !reflect.DeepEqual(got.MissingFields, tt.wantMissing) {
+				t.Errorf("ValidateResponse().MissingFields = %v, want %v", got.MissingFields, tt.wantMissing)
+			}
+			if !reflect.DeepEqual(got.UnknownFields, tt.wantUnknown) {
+				t.Errorf("ValidateResponse().UnknownFields = %v, want %v", got.UnknownFields, tt.wantUnknown)
+			}
+		})
+	}
+}
+
+func TestValidateResponseBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want ConformanceStatus
+	}{
+		{
+			"valid",
+			`{"GetMotoLagStatusResponse": {"GetMotoLagStatusResult": "OK", "MotoLagCurrentStatus": "0"}}`,
+			ConformancePass,
+		},
+		{"wrong action", `{"LoginResponse": {"LoginResult": "OK"}}`, ConformanceError},
+		{"invalid json", `{`, ConformanceError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ValidateResponseBody("GetMotoLagStatus", []byte(tt.body)); got.Status != tt.want {
+				t.Errorf("ValidateResponseBody().Status = %v, want %v", got.Status, tt.want)
+			}
+		})
+	}
+}
+
+func TestConformanceReport_String(t *testing.T) {
+	report := &ConformanceReport{Results: []*ConformanceResult{
+		{Action: "Login", Status: ConformancePass},
+		{Action: "GetMotoLagStatus", Status: ConformanceFail, MissingFields: []string{"MotoLagCurrentStatus"}},
+	}}
+
+	if report.Passed() {
+		t.Errorf("ConformanceReport.Passed() = true, want false")
+	}
+
+	got := report.String()
+	for _, want := range []string{"Login", "PASS", "FAIL", "missing: MotoLagCurrentStatus"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("ConformanceReport.String() = %q, want it to contain %q", got, want)
+		}
+	}
+
+	got = report.Render(i18n.NewPrinter(i18n.Spanish))
+	for _, want := range []string{"ACCIÓN", "ESTADO", "faltan: MotoLagCurrentStatus"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("ConformanceReport.Render() = %q, want it to contain %q", got, want)
+		}
+	}
+}
+
+func TestMotoClient_CheckConformance(t *testing.T) {
+	modem := mb8600test.NewModem(username, password)
+	server := mb8600test.NewServer(modem)
+	defer server.Close()
+
+	c := NewMotoClient(mb8600test.Address(server), username, password, logger)
+	report := c.CheckConformance()
+	if !report.Passed() {
+		t.Errorf("MotoClient.CheckConformance() failed against fake modem:\n%s", report)
+	}
+	if len(report.Results) != len(knownActions) {
+		t.Errorf("len(MotoClient.CheckConformance().Results) = %v, want %v", len(report.Results), len(knownActions))
+	}
+
+	modem.SetResponse("GetMotoLagStatus", map[string]string{})
+	report = c.CheckConformance()
+	if report.Passed() {
+		t.Errorf("MotoClient.CheckConformance() passed with a missing field")
+	}
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	NetworkAccessAllowed = "Allowed"
+	NetworkAccessDenied  = "Denied"
+)
+
+var (
+	// E.g. "7 days 00h:40m:06s", the format of the modem's web UI.
+	uptimeDaysRegexp = regexp.MustCompile(`^(?:(\d+)\s*days?\s*)?(\d+)h:(\d+)m:(\d+)s$`)
+	// E.g. "7:00:40:06", in days, hours, minutes and seconds.
+	uptimeColonRegexp = regexp.MustCompile(`^(\d+):(\d+):(\d+):(\d+)$`)
+)
+
+// The state of the modem's connection to the cable network.
+type ConnectionInfo struct {
+	// The time since the modem booted.
+	Uptime time.Duration `json:"uptime"`
+	// Whether the modem is allowed on the network, NetworkAccessAllowed or
+	// NetworkAccessDenied.
+	NetworkAccess string `json:"network_access"`
+	// The connectivity and boot steps of the startup sequence.
+	ConnectivityStatus  string `json:"connectivity_status"`
+	ConnectivityComment string `json:"connectivity_comment"`
+	BootStatus          string `json:"boot_status"`
+	BootComment         string `json:"boot_comment"`
+}
+
+// Returns true if the modem is allowed on the network.
+func (i *ConnectionInfo) NetworkAccessAllowed() bool {
+	return strings.EqualFold(i.NetworkAccess, NetworkAccessAllowed)
+}
+
+// Returns the connectivity state, "OK" once the modem is online, or otherwise
+// the step of the startup sequence it is in, e.g. "DHCP" or "Scanning".
+func (i *ConnectionInfo) ConnectivityState() string {
+	if strings.EqualFold(i.ConnectivityStatus, "OK") || i.ConnectivityComment == "" {
+		return i.ConnectivityStatus
+	}
+	return i.ConnectivityComment
+}
+
+// Parses the modem's system uptime, either as "7 days 00h:40m:06s" or
+// "7:00:40:06".
+func ParseUptime(uptime string) (time.Duration, error) {
+	uptime = strings.TrimSpace(uptime)
+
+	match := uptimeDaysRegexp.FindStringSubmatch(uptime)
+	if match == nil {
+		match = uptimeColonRegexp.FindStringSubmatch(uptime)
+	}
+	if match == nil {
+		return 0, fmt.Errorf("invalid uptime: %q", uptime)
+	}
+
+	var d time.Duration
+	for idx, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if match[idx+1] == "" {
+			continue
+		}
+		value, err := strconv.Atoi(match[idx+1])
+		if err != nil {
+			return 0, fmt.Errorf("invalid uptime: %q: %w", uptime, err)
+		}
+		d += time.Duration(value) * unit
+	}
+
+	return d, nil
+}
+
+// Formats d as the modem reports uptime, e.g. "7 days 00h:40m:06s".
+func FormatUptime(d time.Duration) string {
+	d = d.Truncate(time.Second)
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	hours := d / time.Hour
+	d -= hours * time.Hour
+	minutes := d / time.Minute
+	d -= minutes * time.Minute
+	return fmt.Sprintf("%d days %02dh:%02dm:%02ds", days, hours, minutes, d/time.Second)
+}
+
+// Returns the connection info described by the responses to
+// GetMotoStatusConnectionInfo and GetMotoStatusStartupSequence.
+func NewConnectionInfoFromResponse(conn, startup map[string]string) (*ConnectionInfo, error) {
+	uptime, err := ParseUptime(conn["MotoConnSystemUpTime"])
+	if err != nil {
+		return nil, err
+	}
+
+	return &ConnectionInfo{
+		Uptime:              uptime,
+		NetworkAccess:       strings.TrimSpace(conn["MotoConnNetworkAccess"]),
+		ConnectivityStatus:  strings.TrimSpace(startup["MotoConnConnectivityStatus"]),
+		ConnectivityComment: strings.TrimSpace(startup["MotoConnConnectivityComment"]),
+		BootStatus:          strings.TrimSpace(startup["MotoConnBootStatus"]),
+		BootComment:         strings.TrimSpace(startup["MotoConnBootComment"]),
+	}, nil
+}
+
+// Returns the modem's uptime, network access and connectivity state.
+func (c *MotoClient) GetConnectionInfo() (*ConnectionInfo, error) {
+	responses, err := c.doEach(context.Background(), []string{"GetMotoStatusConnectionInfo", "GetMotoStatusStartupSequence"})
+	if err != nil {
+		return nil, err
+	}
+	return NewConnectionInfoFromResponse(responses["GetMotoStatusConnectionInfo"], responses["GetMotoStatusStartupSequence"])
+}
+
+// The steps of the modem's startup sequence, as shown on its connection
+// page.
+type StartupSequence struct {
+	// The frequency of the primary downstream channel, e.g. "531000000 Hz".
+	DownstreamFrequency string `json:"downstream_frequency"`
+	DownstreamComment   string `json:"downstream_comment"`
+	ConnectivityStatus  string `json:"connectivity_status"`
+	ConnectivityComment string `json:"connectivity_comment"`
+	BootStatus          string `json:"boot_status"`
+	BootComment         string `json:"boot_comment"`
+	ConfigFileStatus    string `json:"config_file_status"`
+	ConfigFileComment   string `json:"config_file_comment"`
+	// E.g. "Enabled", with the comment naming the protocol, e.g. "BPI+".
+	SecurityStatus  string `json:"security_status"`
+	SecurityComment string `json:"security_comment"`
+}
+
+// Returns the startup sequence described by the response to
+// GetMotoStatusStartupSequence.
+func NewStartupSequenceFromResponse(resp map[string]string) *StartupSequence {
+	return &StartupSequence{
+		DownstreamFrequency: strings.TrimSpace(resp["MotoConnDSFreq"]),
+		DownstreamComment:   strings.TrimSpace(resp["MotoConnDSComment"]),
+		ConnectivityStatus:  strings.TrimSpace(resp["MotoConnConnectivityStatus"]),
+		ConnectivityComment: strings.TrimSpace(resp["MotoConnConnectivityComment"]),
+		BootStatus:          strings.TrimSpace(resp["MotoConnBootStatus"]),
+		BootComment:         strings.TrimSpace(resp["MotoConnBootComment"]),
+		ConfigFileStatus:    strings.TrimSpace(resp["MotoConnConfigurationFileStatus"]),
+		ConfigFileComment:   strings.TrimSpace(resp["MotoConnConfigurationFileComment"]),
+		SecurityStatus:      strings.TrimSpace(resp["MotoConnSecurityStatus"]),
+		SecurityComment:     strings.TrimSpace(resp["MotoConnSecurityComment"]),
+	}
+}
+
+// Returns the steps of the modem's startup sequence.
+func (c *MotoClient) GetStartupSequence() (*StartupSequence, error) {
+	resp, err := c.do("GetMotoStatusStartupSequence", nil)
+	if err != nil {
+		return nil, err
+	}
+	return NewStartupSequenceFromResponse(resp), nil
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"testing"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/mb8600test"
+)
+
+func TestParseUptime(t *testing.T) {
+	tests := []struct {
+		uptime  string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"7 days 00h:40m:06s", 7*24*time.Hour + 40*time.Minute + 6*time.Second, false},
+		{"1 day 23h:59m:59s", 48*time.Hour - time.Second, false},
+		{" 0 days 00h:00m:42s ", 42 * time.Second, false},
+		{"12h:05m:00s", 12*time.Hour + 5*time.Minute, false},
+		{"7:00:40:06", 7*24*time.Hour + 40*time.Minute + 6*time.Second, false},
+		{"123:4:5:6", 123*24*time.Hour + 4*time.Hour + 5*time.Minute + 6*time.Second, false},
+		{"7 days", 0, true},
+		{"00:40:06", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.uptime, func(t *testing.T) {
+			got, err := ParseUptime(tt.uptime)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseUptime() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseUptime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatUptime(t *testing.T) {
+	tests := []struct {
+		uptime string
+		want   string
+	}{
+		{"7 days 00h:40m:06s", "7 days 00h:40m:06s"},
+		{"7:00:40:06", "7 days 00h:40m:06s"},
+		{"0 days 23h:59m:59s", "0 days 23h:59m:59s"},
+		{"365 days 01h:02m:03s", "365 days 01h:02m:03s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.uptime, func(t *testing.T) {
+			d, err := ParseUptime(tt.uptime)
+			if err != nil {
+				t.Fatalf("ParseUptime() error = %v", err)
+			}
+			if got := FormatUptime(d); got != tt.want {
+				t.Errorf("FormatUptime() = %v, want %v", got, tt.want)
+			}
+			if again, _ := ParseUptime(FormatUptime(d)); again != d {
+				t.Errorf("ParseUptime(FormatUptime()) = %v, want %v", again, d)
+			}
+		})
+	}
+}
+
+func TestMotoClient_GetConnectionInfo(t *testing.T) {
+	modem := mb8600test.NewModem(username, password)
+	server := mb8600test.NewServer(modem)
+	defer server.Close()
+
+	c := NewMotoClient(mb8600test.Address(server), username, password, logger)
+	if _, err := c.Login(); err != nil {
+		t.Fatalf("MotoClient.Login() error = %v", err)
+	}
+
+	info, err := c.GetConnectionInfo()
+	if err != nil {
+		t.Fatalf("MotoClient.GetConnectionInfo() error = %v", err)
+	}
+	want := ConnectionInfo{
+		Uptime:              7*24*time.Hour + 40*time.Minute + 6*time.Second,
+		NetworkAccess:       NetworkAccessAllowed,
+		ConnectivityStatus:  "OK",
+		ConnectivityComment: "Operational",
+		BootStatus:          "OK",
+		BootComment:         "Operational",
+	}
+	if *info != want {
+		t.Errorf("MotoClient.GetConnectionInfo() = %+v, want %+v", *info, want)
+	}
+	if !info.NetworkAccessAllowed() {
+		t.Errorf("ConnectionInfo.NetworkAccessAllowed() = false, want true")
+	}
+
+	modem.SetResponse("GetMotoStatusConnectionInfo", map[string]string{
+		"MotoConnSystemUpTime":  "unknown",
+		"MotoConnNetworkAccess": NetworkAccessDenied,
+	})
+	if _, err := c.GetConnectionInfo(); err == nil {
+		t.Errorf("MotoClient.GetConnectionInfo() error = nil, want error")
+	}
+}
+
+func TestConnectionInfo_ConnectivityState(t *testing.T) {
+	tests := []struct {
+		status, comment string
+		want            string
+	}{
+		{"OK", "Operational", "OK"},
+		{"In Progress", "DHCP", "DHCP"},
+		{"In Progress", "Scanning", "Scanning"},
+		{"Not Synchronized", "", "Not Synchronized"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			info := &ConnectionInfo{ConnectivityStatus: tt.status, ConnectivityComment: tt.comment}
+			if got := info.ConnectivityState(); got != tt.want {
+				t.Errorf("ConnectionInfo.ConnectivityState() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMotoClient_GetStartupSequence(t *testing.T) {
+	server := mb8600test.NewServer(mb8600test.NewModem(username, password))
+	defer server.Close()
+
+	c := NewMotoClient(mb8600test.Address(server), username, password, logger)
+	if _, err := c.Login(); err != nil {
+		t.Fatalf("MotoClient.Login() error = %v", err)
+	}
+
+	got, err := c.GetStartupSequence()
+	if err != nil {
+		t.Fatalf("MotoClient.GetStartupSequence() error = %v", err)
+	}
+	want := StartupSequence{
+		DownstreamFrequency: "531000000 Hz",
+		DownstreamComment:   "Locked",
+		ConnectivityStatus:  "OK",
+		ConnectivityComment: "Operational",
+		BootStatus:          "OK",
+		BootComment:         "Operational",
+		ConfigFileStatus:    "OK",
+		SecurityStatus:      "Enabled",
+		SecurityComment:     "BPI+",
+	}
+	if *got != want {
+		t.Errorf("MotoClient.GetStartupSequence() = %+v, want %+v", *got, want)
+	}
+}
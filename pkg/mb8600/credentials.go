@@ -0,0 +1,175 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// The credentials used to log in to the modem.
+type Credentials struct {
+	// The account name, or empty to use the username the client was created
+	// with.
+	Username string
+	Password string
+}
+
+// Supplies the credentials used to log in, so the password need not be
+// embedded in code or flags. The client asks for the credentials on every
+// login, so a rotated password is picked up without restarting.
+type CredentialsProvider interface {
+	Credentials() (Credentials, error)
+}
+
+// Adapts a function to the CredentialsProvider interface.
+type CredentialsFunc func() (Credentials, error)
+
+func (f CredentialsFunc) Credentials() (Credentials, error) {
+	return f()
+}
+
+// Returns a provider always supplying the given credentials.
+func StaticCredentials(username, password string) CredentialsProvider {
+	return CredentialsFunc(func() (Credentials, error) {
+		return Credentials{Username: username, Password: password}, nil
+	})
+}
+
+// Reads the credentials from environment variables, MB8600_USERNAME and
+// MB8600_PASSWORD unless set otherwise.
+type EnvCredentials struct {
+	UsernameVar string
+	PasswordVar string
+}
+
+func (e *EnvCredentials) Credentials() (Credentials, error) {
+	usernameVar, passwordVar := e.UsernameVar, e.PasswordVar
+	if usernameVar == "" {
+		usernameVar = "MB8600_USERNAME"
+	}
+	if passwordVar == "" {
+		passwordVar = "MB8600_PASSWORD"
+	}
+
+	password, ok := os.LookupEnv(passwordVar)
+	if !ok {
+		return Credentials{}, fmt.Errorf("password variable %s is not set", passwordVar)
+	}
+	return Credentials{Username: os.Getenv(usernameVar), Password: password}, nil
+}
+
+// Reads the password from a file, ignoring a trailing newline. The file must
+// not be accessible by other users, i.e. have a mode of 0600 or stricter, so
+// a world-readable secret is caught rather than used.
+type FileCredentials struct {
+	Path string
+	// The account name, or empty to use the client's username.
+	Username string
+}
+
+func (f *FileCredentials) Credentials() (Credentials, error) {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return Credentials{}, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return Credentials{}, err
+	}
+	// Windows does not report Unix permissions.
+	if perm := info.Mode().Perm(); runtime.GOOS != "windows" && perm&0077 != 0 {
+		return Credentials{}, fmt.Errorf("password file %s is accessible by other users (mode %04o), want 0600", f.Path, perm)
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return Credentials{}, err
+	}
+	return Credentials{Username: f.Username, Password: strings.TrimRight(string(data), "\r\n")}, nil
+}
+
+// Reads the password of Username from the OS keyring, through secret-tool
+// (libsecret) on Linux and the BSDs and the security tool (Keychain) on
+// macOS. Store the password with, respectively:
+//
+//	secret-tool store --label=mb8600 service mb8600 username admin
+//	security add-generic-password -s mb8600 -a admin -w
+type KeyringCredentials struct {
+	// The service the password is stored under, mb8600 if empty.
+	Service  string
+	Username string
+
+	// Runs the keyring tool and returns its output, exec by default.
+	run func(name string, args ...string) ([]byte, error)
+}
+
+func (k *KeyringCredentials) Credentials() (Credentials, error) {
+	service := k.Service
+	if service == "" {
+		service = "mb8600"
+	}
+	run := k.run
+	if run == nil {
+		run = func(name string, args ...string) ([]byte, error) {
+			return exec.Command(name, args...).Output()
+		}
+	}
+
+	var name string
+	var args []string
+	switch runtime.GOOS {
+	case "darwin":
+		name, args = "security", []string{"find-generic-password", "-s", service, "-a", k.Username, "-w"}
+	case "linux", "freebsd", "openbsd", "netbsd":
+		name, args = "secret-tool", []string{"lookup", "service", service, "username", k.Username}
+	default:
+		return Credentials{}, fmt.Errorf("keyring is not supported on %s", runtime.GOOS)
+	}
+
+	out, err := run(name, args...)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("reading password of %s from keyring: %w", k.Username, err)
+	}
+	password := strings.TrimRight(string(out), "\r\n")
+	if password == "" {
+		return Credentials{}, errors.New("keyring has no password for " + k.Username)
+	}
+	return Credentials{Username: k.Username, Password: password}, nil
+}
+
+// Returns the credentials to log in with: those of the client's provider, if
+// it has one, or the username and password it was created with.
+func (c *MotoClient) credentials() (Credentials, error) {
+	if c.credentialsProvider == nil {
+		return Credentials{Username: c.Username, Password: c.Password}, nil
+	}
+	creds, err := c.credentialsProvider.Credentials()
+	if err != nil {
+		return Credentials{}, fmt.Errorf("getting credentials: %w", err)
+	}
+	if creds.Username == "" {
+		creds.Username = c.Username
+	}
+	return creds, nil
+}
@@ -0,0 +1,154 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/thelande/mb8600/pkg/mb8600test"
+)
+
+func TestEnvCredentials(t *testing.T) {
+	t.Setenv("MB8600_PASSWORD", "secret")
+	t.Setenv("MODEM_USER", "admin")
+
+	tests := []struct {
+		name    string
+		env     *EnvCredentials
+		want    Credentials
+		wantErr bool
+	}{
+		{"defaults", &EnvCredentials{}, Credentials{Password: "secret"}, false},
+		{"custom", &EnvCredentials{UsernameVar: "MODEM_USER"}, Credentials{Username: "admin", Password: "secret"}, false},
+		{"unset", &EnvCredentials{PasswordVar: "MB8600_TEST_UNSET"}, Credentials{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.env.Credentials()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EnvCredentials.Credentials() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("EnvCredentials.Credentials() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileCredentials(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not checked on Windows")
+	}
+
+	tests := []struct {
+		name    string
+		mode    os.FileMode
+		want    string
+		wantErr bool
+	}{
+		{"owner only", 0600, "secret", false},
+		{"read only", 0400, "secret", false},
+		{"group readable", 0640, "", true},
+		{"world readable", 0644, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "password")
+			if err := os.WriteFile(path, []byte("secret\n"), tt.mode); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chmod(path, tt.mode); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := (&FileCredentials{Path: path}).Credentials()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FileCredentials.Credentials() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got.Password != tt.want {
+				t.Errorf("FileCredentials.Credentials().Password = %q, want %q", got.Password, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyringCredentials(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("no keyring tool on " + runtime.GOOS)
+	}
+
+	var command []string
+	k := &KeyringCredentials{Username: "admin", run: func(name string, args ...string) ([]byte, error) {
+		command = append([]string{name}, args...)
+		return []byte("secret\n"), nil
+	}}
+	got, err := k.Credentials()
+	if err != nil {
+		t.Fatalf("KeyringCredentials.Credentials() error = %v", err)
+	}
+	if want := (Credentials{Username: "admin", Password: "secret"}); got != want {
+		t.Errorf("KeyringCredentials.Credentials() = %+v, want %+v", got, want)
+	}
+	if !slices.Contains(command, "mb8600") || !slices.Contains(command, "admin") {
+		t.Errorf("keyring command = %v, want the service and username", command)
+	}
+
+	k.run = func(string, ...string) ([]byte, error) { return nil, errors.New("exit status 1") }
+	if _, err := k.Credentials(); err == nil {
+		t.Errorf("KeyringCredentials.Credentials() error = nil when the lookup fails, want error")
+	}
+}
+
+func TestMotoClient_WithCredentials(t *testing.T) {
+	modem := mb8600test.NewModem(username, password)
+	server := mb8600test.NewServer(modem)
+	defer server.Close()
+
+	// The password rotates after the first login.
+	current := "wrong"
+	provider := CredentialsFunc(func() (Credentials, error) {
+		return Credentials{Password: current}, nil
+	})
+	// Without a rate limit, so the second login is not delayed by the first
+	// failing.
+	c := NewMotoClient(mb8600test.Address(server), username, "", logger, WithCredentials(provider), WithLoginRateLimit(0))
+	if _, err := c.Login(); err == nil {
+		t.Fatalf("MotoClient.Login() error = nil with the wrong password, want error")
+	}
+	current = password
+	if _, err := c.Login(); err != nil {
+		t.Fatalf("MotoClient.Login() error = %v", err)
+	}
+
+	info, err := c.GetAccountInfo()
+	if err != nil {
+		t.Fatalf("MotoClient.GetAccountInfo() error = %v", err)
+	}
+	if info.Username != username || !info.DefaultPassword {
+		t.Errorf("MotoClient.GetAccountInfo() = %+v, want the default password of %s", info, username)
+	}
+
+	failing := NewMotoClient(mb8600test.Address(server), username, "", logger, WithCredentials(&EnvCredentials{PasswordVar: "MB8600_TEST_UNSET"}))
+	if _, err := failing.Login(); err == nil {
+		t.Errorf("MotoClient.Login() error = nil without credentials, want error")
+	}
+}
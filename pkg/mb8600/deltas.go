@@ -0,0 +1,139 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// The change in a downstream channel's error counters between two polls.
+type ChannelDelta struct {
+	ChannelID int `json:"channel_id"`
+	// The time between the two polls.
+	Interval          time.Duration `json:"interval"`
+	CorrectedErrors   float64       `json:"corrected_errors"`
+	UncorrectedErrors float64       `json:"uncorrected_errors"`
+	// Whether a counter went backwards, e.g. after a reboot. The deltas are
+	// then the counts since the reset.
+	Reset bool `json:"reset"`
+}
+
+// Returns the corrected errors per second over the interval.
+func (d *ChannelDelta) CorrectedRate() float64 {
+	return rate(d.CorrectedErrors, d.Interval)
+}
+
+// Returns the uncorrected errors per second over the interval.
+func (d *ChannelDelta) UncorrectedRate() float64 {
+	return rate(d.UncorrectedErrors, d.Interval)
+}
+
+func rate(count float64, interval time.Duration) float64 {
+	if interval <= 0 {
+		return 0
+	}
+	return count / interval.Seconds()
+}
+
+type counterSample struct {
+	time        time.Time
+	corrected   float64
+	uncorrected float64
+}
+
+// Computes per-interval deltas of the cumulative downstream error counters
+// from successive snapshots, keyed by channel ID. It is safe for concurrent
+// use.
+type StatsTracker struct {
+	mu      sync.RWMutex
+	samples map[int]counterSample
+	deltas  map[int]*ChannelDelta
+}
+
+// Returns an empty StatsTracker.
+func NewStatsTracker() *StatsTracker {
+	return &StatsTracker{
+		samples: map[int]counterSample{},
+		deltas:  map[int]*ChannelDelta{},
+	}
+}
+
+// Records the counters in snapshot and returns the deltas since the previous
+// snapshot, ordered by channel ID. Channels seen for the first time have no
+// delta, and channels missing from snapshot are forgotten.
+func (t *StatsTracker) Observe(snapshot *Snapshot) []*ChannelDelta {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	samples := make(map[int]counterSample, len(snapshot.Downstream))
+	deltas := make(map[int]*ChannelDelta, len(snapshot.Downstream))
+	for _, ch := range snapshot.Downstream {
+		cur := counterSample{snapshot.Time, ch.CorrectedErrors, ch.UncorrectedErrors}
+		samples[ch.ChannelID] = cur
+
+		prev, ok := t.samples[ch.ChannelID]
+		if !ok || !cur.time.After(prev.time) {
+			continue
+		}
+
+		delta := &ChannelDelta{
+			ChannelID:         ch.ChannelID,
+			Interval:          cur.time.Sub(prev.time),
+			CorrectedErrors:   cur.corrected - prev.corrected,
+			UncorrectedErrors: cur.uncorrected - prev.uncorrected,
+		}
+		if delta.CorrectedErrors < 0 || delta.UncorrectedErrors < 0 {
+			delta.Reset = true
+			delta.CorrectedErrors = cur.corrected
+			delta.UncorrectedErrors = cur.uncorrected
+		}
+		deltas[ch.ChannelID] = delta
+	}
+	t.samples = samples
+	t.deltas = deltas
+
+	return t.sortedDeltas()
+}
+
+// Returns the most recent delta of the channel, if there is one.
+func (t *StatsTracker) Delta(channelID int) (ChannelDelta, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if delta, ok := t.deltas[channelID]; ok {
+		return *delta, true
+	}
+	return ChannelDelta{}, false
+}
+
+// Returns the most recent deltas, ordered by channel ID.
+func (t *StatsTracker) Deltas() []*ChannelDelta {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.sortedDeltas()
+}
+
+func (t *StatsTracker) sortedDeltas() []*ChannelDelta {
+	deltas := make([]*ChannelDelta, 0, len(t.deltas))
+	for _, delta := range t.deltas {
+		d := *delta
+		deltas = append(deltas, &d)
+	}
+	sort.Slice(deltas, func(i, j int) bool { return deltas[i].ChannelID < deltas[j].ChannelID })
+	return deltas
+}
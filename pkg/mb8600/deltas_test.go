@@ -0,0 +1,81 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStatsTracker(t *testing.T) {
+	start := time.Date(2023, 12, 23, 20, 0, 0, 0, time.UTC)
+	tracker := NewStatsTracker()
+
+	if got := tracker.Observe(&Snapshot{
+		Time: start,
+		Downstream: []*DownstreamChannel{
+			{ChannelID: 1, CorrectedErrors: 100, UncorrectedErrors: 10},
+			{ChannelID: 2, CorrectedErrors: 500, UncorrectedErrors: 50},
+		},
+	}); len(got) != 0 {
+		t.Errorf("StatsTracker.Observe() first snapshot = %+v, want no deltas", got)
+	}
+
+	// Channel 2 was reset, and channel 3 is new.
+	got := tracker.Observe(&Snapshot{
+		Time: start.Add(10 * time.Second),
+		Downstream: []*DownstreamChannel{
+			{ChannelID: 1, CorrectedErrors: 150, UncorrectedErrors: 12},
+			{ChannelID: 2, CorrectedErrors: 20, UncorrectedErrors: 60},
+			{ChannelID: 3, CorrectedErrors: 5, UncorrectedErrors: 0},
+		},
+	})
+	want := []*ChannelDelta{
+		{ChannelID: 1, Interval: 10 * time.Second, CorrectedErrors: 50, UncorrectedErrors: 2},
+		{ChannelID: 2, Interval: 10 * time.Second, CorrectedErrors: 20, UncorrectedErrors: 60, Reset: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("StatsTracker.Observe() = %+v, want %+v", got, want)
+	}
+	if !reflect.DeepEqual(tracker.Deltas(), want) {
+		t.Errorf("StatsTracker.Deltas() = %+v, want %+v", tracker.Deltas(), want)
+	}
+
+	delta, ok := tracker.Delta(1)
+	if !ok {
+		t.Fatalf("StatsTracker.Delta(1) not found")
+	}
+	if delta.CorrectedRate() != 5 || delta.UncorrectedRate() != 0.2 {
+		t.Errorf("ChannelDelta rates = %v, %v, want 5, 0.2", delta.CorrectedRate(), delta.UncorrectedRate())
+	}
+	if _, ok := tracker.Delta(3); ok {
+		t.Errorf("StatsTracker.Delta(3) found, want no delta for a new channel")
+	}
+
+	// Channel 1 disappears and its history is dropped.
+	tracker.Observe(&Snapshot{
+		Time:       start.Add(20 * time.Second),
+		Downstream: []*DownstreamChannel{{ChannelID: 3, CorrectedErrors: 5}},
+	})
+	tracker.Observe(&Snapshot{
+		Time:       start.Add(30 * time.Second),
+		Downstream: []*DownstreamChannel{{ChannelID: 1, CorrectedErrors: 200}},
+	})
+	if _, ok := tracker.Delta(1); ok {
+		t.Errorf("StatsTracker.Delta(1) found after the channel was lost, want none")
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const unauthorizedMarker = "UN-AUTH"
+
+var (
+	// The modem rejected the request's HNAP_AUTH, usually because the session
+	// expired or the modem rebooted. Logging in again resolves it.
+	ErrUnauthorized = errors.New("request not authorized by modem")
+
+	// The client stopped logging in after consecutive authentication
+	// failures, so as not to lock the modem's web interface. See
+	// WithLoginLockout.
+	ErrAuthLockout = errors.New("logins stopped after repeated authentication failures")
+)
+
+// The modem answered an action with a status code other than 200 OK.
+type StatusError struct {
+	Action     string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("action, %s, received non-OK status code: %d", e.Action, e.StatusCode)
+}
+
+// The modem rejected a login, e.g. because of wrong credentials.
+type LoginError struct {
+	// The LoginResult the modem answered with, empty if it was missing.
+	Result string
+}
+
+func (e *LoginError) Error() string {
+	if e.Result == "" {
+		return "login failed: no LoginResult in response"
+	}
+	return fmt.Sprintf("login failed: %s", e.Result)
+}
+
+// Returns the outcome of a LoginResult. Firmware differs in the casing and
+// wording of success, so "OK" and "SUCCESS" are matched case-insensitively,
+// and results naming a failure or error are failures. Other results are
+// unknown, neither ok nor failed.
+func loginResult(result string) (ok, failed bool) {
+	normalized := strings.ToUpper(strings.TrimSpace(result))
+	switch normalized {
+	case "OK", "SUCCESS":
+		return true, false
+	case "", "LOCKUP", "REBOOT", "INVALID", unauthorizedMarker:
+		return false, true
+	}
+	return false, strings.Contains(normalized, "FAIL") || strings.Contains(normalized, "ERR")
+}
+
+// Returns true if err is likely to be transient, i.e. a transport failure
+// such as a timeout or reset connection, or a server error from the modem.
+// Authentication, parse and client errors are permanent.
+func isRetryable(err error) bool {
+	if err == nil || errors.Is(err, ErrUnauthorized) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500
+	}
+
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// Returns true if resp, with the given body, is the modem rejecting a request
+// because of its HNAP_AUTH header. Depending on the firmware, the modem either
+// answers with an "UN-AUTH" body or result, or redirects to the login page.
+// Server errors never are: the modem serves HTML error pages while it
+// re-locks its channels, which must be retried rather than logged in again.
+func isUnauthorized(action, hnapPath string, resp *http.Response, body []byte) bool {
+	if resp.StatusCode == http.StatusUnauthorized {
+		return true
+	}
+	if resp.StatusCode >= 500 {
+		return false
+	}
+
+	// Only a successful or redirected request can have landed on the login
+	// page.
+	if resp.StatusCode < 400 {
+		if resp.Request != nil && resp.Request.URL.Path != hnapPath {
+			return true
+		}
+		if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+			return true
+		}
+	}
+
+	trimmed := bytes.TrimSpace(body)
+	if bytes.Equal(trimmed, []byte(unauthorizedMarker)) {
+		return true
+	}
+
+	// Some firmware wraps the rejection in a regular response.
+	return bytes.Contains(trimmed, []byte(`"`+action+`Result":"`+unauthorizedMarker+`"`)) ||
+		bytes.Contains(trimmed, []byte(`<`+action+`Result>`+unauthorizedMarker+`</`+action+`Result>`))
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"regexp"
+)
+
+// A stable code identifying a kind of event log message, independent of the
+// exact phrasing used by the firmware.
+type EventCode string
+
+const (
+	EventUnknown              EventCode = "UNKNOWN"
+	EventT3Timeout            EventCode = "T3_TIMEOUT"
+	EventT4Timeout            EventCode = "T4_TIMEOUT"
+	EventDSPartialService     EventCode = "DS_PARTIAL_SERVICE"
+	EventUSPartialService     EventCode = "US_PARTIAL_SERVICE"
+	EventSyncLoss             EventCode = "SYNC_LOSS"
+	EventMDDTimeout           EventCode = "MDD_TIMEOUT"
+	EventDHCPRenew            EventCode = "DHCP_RENEW"
+	EventDHCPFailed           EventCode = "DHCP_FAILED"
+	EventToDFailure           EventCode = "TOD_FAILURE"
+	EventRebootPower          EventCode = "REBOOT_POWER"
+	EventReboot               EventCode = "REBOOT"
+	EventCMStatus             EventCode = "CM_STATUS"
+	EventRegistrationComplete EventCode = "REGISTRATION_COMPLETE"
+)
+
+type eventRule struct {
+	code    EventCode
+	pattern *regexp.Regexp
+}
+
+// An ordered table of rules translating log descriptions to event codes. The
+// first matching rule wins.
+type EventCodeTable struct {
+	rules []eventRule
+}
+
+var defaultEventRules = []struct {
+	code    EventCode
+	pattern string
+}{
+	{EventT3Timeout, `T3 time[- ]?out`},
+	{EventT4Timeout, `T4 time[- ]?out`},
+	{EventUSPartialService, `(upstream|\bUS\b).*partial service|partial service.*(upstream|\bUS\b)`},
+	{EventDSPartialService, `partial service`},
+	{EventSyncLoss, `loss of sync|SYNC Timing Synchronization failure`},
+	{EventMDDTimeout, `MDD.*time[- ]?out`},
+	{EventDHCPFailed, `DHCP FAILED|DHCP.*no response`},
+	{EventDHCPRenew, `DHCP RENEW`},
+	{EventToDFailure, `ToD request sent.*no response`},
+	{EventRebootPower, `power (reset|cycle|loss|failure)|cold start`},
+	{EventReboot, `reboot|warm start`},
+	{EventCMStatus, `CM-STATUS`},
+	{EventRegistrationComplete, `REGISTRATION COMPLETE`},
+}
+
+// Used when parsing log entries outside of a client.
+var defaultEventCodeTable = DefaultEventCodes()
+
+// Returns a new table holding the built-in rules.
+func DefaultEventCodes() *EventCodeTable {
+	t := &EventCodeTable{}
+	for _, rule := range defaultEventRules {
+		t.rules = append(t.rules, eventRule{rule.code, regexp.MustCompile(`(?i)` + rule.pattern)})
+	}
+	return t
+}
+
+// Adds a rule mapping descriptions matching pattern to code. Patterns are
+// case-insensitive regular expressions. Registered rules take precedence over
+// the rules already in the table.
+func (t *EventCodeTable) Register(code EventCode, pattern string) error {
+	re, err := regexp.Compile(`(?i)` + pattern)
+	if err != nil {
+		return err
+	}
+	t.rules = append([]eventRule{{code, re}}, t.rules...)
+	return nil
+}
+
+// Returns the code of the first rule matching description, or EventUnknown.
+func (t *EventCodeTable) Classify(description string) EventCode {
+	for _, rule := range t.rules {
+		if rule.pattern.MatchString(description) {
+			return rule.code
+		}
+	}
+	return EventUnknown
+}
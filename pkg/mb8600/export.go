@@ -0,0 +1,133 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+var (
+	downstreamCSVHeader = []string{
+		"channel", "channel_id", "kind", "lock_status", "modulation", "frequency_mhz",
+		"power_dbmv", "snr_db", "corrected_errors", "uncorrected_errors",
+	}
+	upstreamCSVHeader = []string{
+		"channel", "channel_id", "kind", "lock_status", "channel_type", "symbol_rate_ksyms",
+		"frequency_mhz", "power_dbmv",
+	}
+	logCSVHeader = []string{
+		"time", "date", "timestamp", "priority", "code", "description",
+	}
+)
+
+// Marshals the channel with unit-suffixed field names and its kind.
+func (c *DownstreamChannel) MarshalJSON() ([]byte, error) {
+	type channel DownstreamChannel
+	return json.Marshal(struct {
+		*channel
+		Kind ChannelKind `json:"kind"`
+	}{(*channel)(c), c.Kind()})
+}
+
+// Marshals the channel with unit-suffixed field names and its kind.
+func (c *UpstreamChannel) MarshalJSON() ([]byte, error) {
+	type channel UpstreamChannel
+	return json.Marshal(struct {
+		*channel
+		Kind ChannelKind `json:"kind"`
+	}{(*channel)(c), c.Kind()})
+}
+
+// Marshals the event, including the error message if there is one.
+func (e Event) MarshalJSON() ([]byte, error) {
+	type event Event
+	var errMsg string
+	if e.Err != nil {
+		errMsg = e.Err.Error()
+	}
+	return json.Marshal(struct {
+		event
+		Error string `json:"error,omitempty"`
+	}{event(e), errMsg})
+}
+
+// Writes data as CSV with a header row to w. Supported types are
+// []*DownstreamChannel, []*UpstreamChannel and []*LogEntry.
+func WriteCSV(w io.Writer, data any) error {
+	var records [][]string
+
+	switch v := data.(type) {
+	case []*DownstreamChannel:
+		records = append(records, downstreamCSVHeader)
+		for _, c := range v {
+			records = append(records, []string{
+				strconv.Itoa(c.Channel),
+				strconv.Itoa(c.ChannelID),
+				string(c.Kind()),
+				c.LockStatus,
+				c.Modulation,
+				formatFloat(c.Frequency),
+				formatFloat(c.Power),
+				formatFloat(c.SignalToNoise),
+				formatFloat(c.CorrectedErrors),
+				formatFloat(c.UncorrectedErrors),
+			})
+		}
+	case []*UpstreamChannel:
+		records = append(records, upstreamCSVHeader)
+		for _, c := range v {
+			records = append(records, []string{
+				strconv.Itoa(c.Channel),
+				strconv.Itoa(c.ChannelID),
+				string(c.Kind()),
+				c.LockStatus,
+				c.ChannelType,
+				formatFloat(c.SymbolRate),
+				formatFloat(c.Frequency),
+				formatFloat(c.Power),
+			})
+		}
+	case []*LogEntry:
+		records = append(records, logCSVHeader)
+		for _, e := range v {
+			var timestamp string
+			if !e.Timestamp.IsZero() {
+				timestamp = e.Timestamp.Format(time.RFC3339)
+			}
+			records = append(records, []string{
+				e.Time,
+				e.Date,
+				timestamp,
+				strconv.Itoa(e.Priority),
+				string(e.Code),
+				e.Description,
+			})
+		}
+	default:
+		return fmt.Errorf("unsupported type for CSV export: %T", data)
+	}
+
+	return csv.NewWriter(w).WriteAll(records)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDownstreamChannel_MarshalJSON(t *testing.T) {
+	data, err := json.Marshal(expDownstreamChannel)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	want := `{"channel":1,"channel_id":20,"lock_status":"Locked","modulation":"QAM256","frequency_mhz":531,"power_dbmv":2.8,"snr_db":45.1,"corrected_errors":0,"uncorrected_errors":0,"kind":"SC-QAM"}`
+	if string(data) != want {
+		t.Errorf("json.Marshal() = %s, want %s", data, want)
+	}
+
+	var got DownstreamChannel
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if !got.Equal(expDownstreamChannel) {
+		t.Errorf("json.Unmarshal() = %v, want %v", got, expDownstreamChannel)
+	}
+}
+
+func TestUpstreamChannel_MarshalJSON(t *testing.T) {
+	data, err := json.Marshal([]*UpstreamChannel{expUpstreamChannel})
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	want := `[{"channel":1,"channel_id":4,"lock_status":"Locked","channel_type":"SC-QAM","symbol_rate_ksyms":5120,"frequency_mhz":35.6,"power_dbmv":56,"kind":"SC-QAM"}]`
+	if string(data) != want {
+		t.Errorf("json.Marshal() = %s, want %s", data, want)
+	}
+}
+
+func TestEvent_MarshalJSON(t *testing.T) {
+	event := Event{Type: ModemUnreachable, Time: time.Unix(0, 0).UTC(), Err: fmt.Errorf("timeout")}
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	want := `{"type":"ModemUnreachable","time":"1970-01-01T00:00:00Z","previous":0,"current":0,"error":"timeout"}`
+	if string(data) != want {
+		t.Errorf("json.Marshal() = %s, want %s", data, want)
+	}
+
+	event = Event{Type: UpstreamChannelCountChanged, Time: time.Unix(0, 0).UTC(), Direction: DirectionUpstream, Previous: 0, Current: 4}
+	data, err = json.Marshal(event)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	want = `{"type":"UpstreamChannelCountChanged","time":"1970-01-01T00:00:00Z","direction":"upstream","previous":0,"current":4}`
+	if string(data) != want {
+		t.Errorf("json.Marshal() = %s, want %s", data, want)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    any
+		want    string
+		wantErr bool
+	}{
+		{
+			"downstream",
+			[]*DownstreamChannel{expDownstreamChannel},
+			"channel,channel_id,kind,lock_status,modulation,frequency_mhz,power_dbmv,snr_db,corrected_errors,uncorrected_errors\n" +
+				"1,20,SC-QAM,Locked,QAM256,531,2.8,45.1,0,0\n",
+			false,
+		},
+		{
+			"upstream",
+			[]*UpstreamChannel{expUpstreamChannel},
+			"channel,channel_id,kind,lock_status,channel_type,symbol_rate_ksyms,frequency_mhz,power_dbmv\n" +
+				"1,4,SC-QAM,Locked,SC-QAM,5120,35.6,56\n",
+			false,
+		},
+		{
+			"logs",
+			[]*LogEntry{{Time: "Time Not Established", Date: "Time Not Established", Priority: 3, Description: "Lost MDD Timeout, retrying", Code: EventMDDTimeout}},
+			"time,date,timestamp,priority,code,description\n" +
+				"Time Not Established,Time Not Established,,3,MDD_TIMEOUT,\"Lost MDD Timeout, retrying\"\n",
+			false,
+		},
+		{"unsupported", []string{"a"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := WriteCSV(&buf, tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("WriteCSV() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(buf.String(), tt.want) {
+				t.Errorf("WriteCSV() = %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
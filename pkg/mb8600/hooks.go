@@ -0,0 +1,43 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import "time"
+
+// Describes a completed HNAP request.
+type RequestInfo struct {
+	// The HNAP action, e.g. "Login" or "GetMultipleHNAPs" for a batch.
+	Action string
+	Start  time.Time
+	// The time from sending the request to decoding the response.
+	Duration time.Duration
+	// The HTTP status code, or 0 if no response was received.
+	StatusCode int
+	// The error the request failed with, if any, e.g. a *StatusError or
+	// ErrUnauthorized.
+	Err error
+}
+
+// Callbacks invoked around every HNAP request the client sends, including
+// logins and retries, e.g. to record metrics or traces. Either may be nil.
+// They are called synchronously from the requesting goroutine, possibly
+// concurrently, and must not block.
+type RequestHooks struct {
+	// Called before the request for action is sent.
+	OnRequestStart func(action string)
+	// Called once the request has completed or failed.
+	OnRequestDone func(info RequestInfo)
+}
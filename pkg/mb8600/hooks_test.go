@@ -0,0 +1,94 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/thelande/mb8600/pkg/mb8600test"
+)
+
+// Records the requests reported to its hooks.
+type hookRecorder struct {
+	mu      sync.Mutex
+	started []string
+	done    []RequestInfo
+}
+
+func (r *hookRecorder) hooks() RequestHooks {
+	return RequestHooks{
+		OnRequestStart: func(action string) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.started = append(r.started, action)
+		},
+		OnRequestDone: func(info RequestInfo) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.done = append(r.done, info)
+		},
+	}
+}
+
+func TestMotoClient_WithRequestHooks(t *testing.T) {
+	modem := mb8600test.NewModem(username, password)
+	modem.SetStatus("GetMotoStatusLog", http.StatusInternalServerError)
+	server := mb8600test.NewServer(modem)
+	defer server.Close()
+
+	var first, second hookRecorder
+	c := NewMotoClient(mb8600test.Address(server), username, password, logger,
+		WithRequestHooks(first.hooks()), WithRequestHooks(second.hooks()))
+	if _, err := c.Login(); err != nil {
+		t.Fatalf("MotoClient.Login() error = %v", err)
+	}
+	if _, err := c.GetDownstreamChannels(); err != nil {
+		t.Fatalf("MotoClient.GetDownstreamChannels() error = %v", err)
+	}
+	if _, err := c.GetLogs(); err == nil {
+		t.Fatalf("MotoClient.GetLogs() error = nil, want error")
+	}
+	// Rejected before sending, so not reported.
+	c.DoAction("SetMotoReboot", nil)
+
+	want := []string{"Login", "Login", "GetMotoStatusDownstreamChannelInfo", "GetMotoStatusLog"}
+	for _, r := range []*hookRecorder{&first, &second} {
+		if !slices.Equal(r.started, want) {
+			t.Errorf("OnRequestStart actions = %v, want %v", r.started, want)
+		}
+		if len(r.done) != len(want) {
+			t.Fatalf("OnRequestDone calls = %v, want %v", len(r.done), len(want))
+		}
+	}
+
+	for i, info := range first.done {
+		if info.Action != want[i] || info.Start.IsZero() || info.Duration <= 0 {
+			t.Errorf("OnRequestDone(%+v), want action %s with timing", info, want[i])
+		}
+	}
+	if got := first.done[2]; got.StatusCode != http.StatusOK || got.Err != nil {
+		t.Errorf("OnRequestDone(%+v), want status 200 and no error", got)
+	}
+	var statusErr *StatusError
+	if got := first.done[3]; got.StatusCode != http.StatusInternalServerError || !errors.As(got.Err, &statusErr) {
+		t.Errorf("OnRequestDone(%+v), want status 500 and a StatusError", got)
+	}
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Package htmlscrape parses the modem's HTML pages for data that is not
+// available over HNAP, such as the product information page.
+//
+// The pages are meant for people rather than programs and their layout varies
+// between firmware versions, so the parsers are best-effort: they look for
+// labelled table rows anywhere on a page and leave fields they cannot find
+// empty. Prefer the HNAP API of mb8600.MotoClient where it has the data.
+package htmlscrape
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+const (
+	// The product information page.
+	ProductInfoPath = "/MotoSwInfo.asp"
+	// The connection status page, which does not require a login.
+	ConnectionPath = "/MotoConnection.asp"
+)
+
+var (
+	rowRegexp  = regexp.MustCompile(`(?is)<tr[^>]*>(.*?)</tr>`)
+	cellRegexp = regexp.MustCompile(`(?is)<t[dh][^>]*>(.*?)</t[dh]>`)
+	tagRegexp  = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// Fetches pages of the modem's web UI. It is implemented by
+// *mb8600.MotoClient.
+type Fetcher interface {
+	FetchPage(path string) ([]byte, error)
+}
+
+var _ Fetcher = (*mb8600.MotoClient)(nil)
+
+// Returns the text of the cells of every table row on the page, with markup
+// removed and whitespace collapsed. Rows without cells are skipped.
+func Rows(page []byte) [][]string {
+	var rows [][]string
+	for _, row := range rowRegexp.FindAllSubmatch(page, -1) {
+		var cells []string
+		for _, cell := range cellRegexp.FindAllSubmatch(row[1], -1) {
+			text := html.UnescapeString(tagRegexp.ReplaceAllString(string(cell[1]), ""))
+			cells = append(cells, strings.Join(strings.Fields(text), " "))
+		}
+		if len(cells) > 0 {
+			rows = append(rows, cells)
+		}
+	}
+	return rows
+}
+
+// Returns the rows of the page that start with a label, keyed by the label in
+// lower case without a trailing colon, e.g. "hardware version". The values
+// are the remaining cells of the row. The first row with a label wins.
+func Labels(page []byte) map[string][]string {
+	labels := map[string][]string{}
+	for _, row := range Rows(page) {
+		if len(row) < 2 {
+			continue
+		}
+		label := strings.ToLower(strings.TrimSpace(strings.TrimSuffix(row[0], ":")))
+		if _, ok := labels[label]; label != "" && !ok {
+			labels[label] = row[1:]
+		}
+	}
+	return labels
+}
+
+// Returns the first value of the first label present in labels.
+func lookup(labels map[string][]string, names ...string) string {
+	for _, name := range names {
+		if values, ok := labels[name]; ok {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// Parses the product information page. Returns an error if none of the
+// fields are found.
+func ParseProductInfo(page []byte) (*mb8600.SoftwareStatus, error) {
+	labels := Labels(page)
+	status := &mb8600.SoftwareStatus{
+		SoftwareVersion: lookup(labels, "software version"),
+		HardwareVersion: lookup(labels, "hardware version"),
+		SpecVersion:     lookup(labels, "standard specification compliant", "specification version"),
+		CustomerVersion: lookup(labels, "customer version"),
+		MACAddress:      lookup(labels, "cable modem mac address", "mac address"),
+		SerialNumber:    lookup(labels, "serial number"),
+	}
+
+	if *status == (mb8600.SoftwareStatus{}) {
+		return nil, fmt.Errorf("no product information found in page")
+	}
+	return status, nil
+}
+
+// Parses the connection status page. A missing or unparsable uptime is left
+// zero. Returns an error if none of the fields are found.
+func ParseConnectionInfo(page []byte) (*mb8600.ConnectionInfo, error) {
+	labels := Labels(page)
+	info := &mb8600.ConnectionInfo{
+		NetworkAccess: lookup(labels, "network access"),
+	}
+	if uptime, err := mb8600.ParseUptime(lookup(labels, "system up time", "system uptime")); err == nil {
+		info.Uptime = uptime
+	}
+	// The startup sequence table has a status and a comment column.
+	if values, ok := labels["connectivity state"]; ok {
+		info.ConnectivityStatus, info.ConnectivityComment = statusAndComment(values)
+	}
+	if values, ok := labels["boot state"]; ok {
+		info.BootStatus, info.BootComment = statusAndComment(values)
+	}
+
+	if *info == (mb8600.ConnectionInfo{}) {
+		return nil, fmt.Errorf("no connection information found in page")
+	}
+	return info, nil
+}
+
+func statusAndComment(values []string) (status, comment string) {
+	if len(values) > 1 {
+		return values[0], values[1]
+	}
+	return values[0], ""
+}
+
+// Fetches and parses the product information page. Requires a login.
+func GetProductInfo(f Fetcher) (*mb8600.SoftwareStatus, error) {
+	page, err := f.FetchPage(ProductInfoPath)
+	if err != nil {
+		return nil, err
+	}
+	return ParseProductInfo(page)
+}
+
+// Fetches and parses the connection status page.
+func GetConnectionInfo(f Fetcher) (*mb8600.ConnectionInfo, error) {
+	page, err := f.FetchPage(ConnectionPath)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConnectionInfo(page)
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package htmlscrape
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+const productInfoPage = `<html><body>
+<table class="moto-table-content">
+<tr><th colspan="2">Information</th></tr>
+<tr><td class="moto-param-name">Standard Specification Compliant</td><td class="moto-param-value">DOCSIS 3.1</td></tr>
+<tr><td class="moto-param-name">Hardware Version</td><td class="moto-param-value">V1.0</td></tr>
+<tr><td class="moto-param-name">Software Version</td><td class="moto-param-value"> 8600-19.3.18 </td></tr>
+<tr><td class="moto-param-name">Cable Modem MAC Address</td><td class="moto-param-value">00:11:22:33:44:55</td></tr>
+<tr><td class="moto-param-name">Serial Number:</td><td class="moto-param-value"><span>2013-MB8600-00000001</span></td></tr>
+</table>
+</body></html>`
+
+const connectionPage = `<html><body>
+<table>
+<tr><td>Procedure</td><td>Status</td><td>Comment</td></tr>
+<tr><td>Connectivity State</td><td>OK</td><td>Operational</td></tr>
+<tr><td>Boot State</td><td>OK</td><td>Operational</td></tr>
+</table>
+<table>
+<tr><td>System Up Time</td><td>7 days 00h:40m:06s</td></tr>
+<tr><td>Network Access</td><td>Allowed</td></tr>
+</table>
+</body></html>`
+
+type fakeFetcher map[string]string
+
+func (f fakeFetcher) FetchPage(path string) ([]byte, error) {
+	page, ok := f[path]
+	if !ok {
+		return nil, fmt.Errorf("page, %s, received non-OK status code: 404", path)
+	}
+	return []byte(page), nil
+}
+
+func TestGetProductInfo(t *testing.T) {
+	tests := []struct {
+		name    string
+		pages   fakeFetcher
+		want    *mb8600.SoftwareStatus
+		wantErr bool
+	}{
+		{
+			"valid",
+			fakeFetcher{ProductInfoPath: productInfoPage},
+			&mb8600.SoftwareStatus{
+				SoftwareVersion: "8600-19.3.18",
+				HardwareVersion: "V1.0",
+				SpecVersion:     "DOCSIS 3.1",
+				MACAddress:      "00:11:22:33:44:55",
+				SerialNumber:    "2013-MB8600-00000001",
+			},
+			false,
+		},
+		{"no fields", fakeFetcher{ProductInfoPath: connectionPage}, nil, true},
+		{"not found", fakeFetcher{}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetProductInfo(tt.pages)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetProductInfo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetProductInfo() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetConnectionInfo(t *testing.T) {
+	tests := []struct {
+		name    string
+		page    string
+		want    *mb8600.ConnectionInfo
+		wantErr bool
+	}{
+		{
+			"valid",
+			connectionPage,
+			&mb8600.ConnectionInfo{
+				Uptime:              7*24*time.Hour + 40*time.Minute + 6*time.Second,
+				NetworkAccess:       "Allowed",
+				ConnectivityStatus:  "OK",
+				ConnectivityComment: "Operational",
+				BootStatus:          "OK",
+				BootComment:         "Operational",
+			},
+			false,
+		},
+		{
+			"partial",
+			"<table><tr><td>Network Access</td><td>Denied</td></tr><tr><td>System Up Time</td><td>soon</td></tr></table>",
+			&mb8600.ConnectionInfo{NetworkAccess: "Denied"},
+			false,
+		},
+		{"no fields", productInfoPage, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetConnectionInfo(fakeFetcher{ConnectionPath: tt.page})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetConnectionInfo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetConnectionInfo() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const lineProtocolPrefix = "mb8600_"
+
+var (
+	// Escapes tag keys and values, and field keys.
+	lineProtocolKeyEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	// Escapes string field values.
+	lineProtocolStringEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`)
+)
+
+// Encodes channel and connection data as InfluxDB line protocol, e.g. for the
+// Telegraf exec and execd inputs.
+//
+// Each channel kind is written to its own measurement, e.g.
+// mb8600_downstream_ofdm, tagged with the channel ID, modulation and lock
+// status. Points are timestamped with the time passed to each method, or
+// left for the receiver to timestamp if it is the zero time.
+type LineProtocolEncoder struct {
+	w *bufio.Writer
+}
+
+// Returns an encoder writing to w.
+func NewLineProtocolEncoder(w io.Writer) *LineProtocolEncoder {
+	return &LineProtocolEncoder{w: bufio.NewWriter(w)}
+}
+
+// Encodes the channels and connection state of snapshot, timestamped with the
+// snapshot time, along with an mb8600_upstream_summary point counting the
+// locked upstream channels.
+func (e *LineProtocolEncoder) EncodeSnapshot(snapshot *Snapshot) error {
+	e.encodeDownstream(snapshot.Downstream, snapshot.Time)
+	e.encodeUpstream(snapshot.Upstream, snapshot.Time)
+	e.point(lineProtocolPrefix+"upstream_summary", nil, [][2]string{
+		{"channels", formatIntField(int64(len(snapshot.Upstream)))},
+		{"locked_channels", formatIntField(int64(snapshot.LockedUpstreamChannels()))},
+	}, snapshot.Time)
+	if snapshot.Connection != nil {
+		e.encodeConnection(snapshot.Connection, snapshot.Time)
+	}
+	return e.w.Flush()
+}
+
+// Encodes one point per downstream channel.
+func (e *LineProtocolEncoder) EncodeDownstream(channels []*DownstreamChannel, t time.Time) error {
+	e.encodeDownstream(channels, t)
+	return e.w.Flush()
+}
+
+// Encodes one point per upstream channel.
+func (e *LineProtocolEncoder) EncodeUpstream(channels []*UpstreamChannel, t time.Time) error {
+	e.encodeUpstream(channels, t)
+	return e.w.Flush()
+}
+
+// Encodes the connection state as a single mb8600_connection point.
+func (e *LineProtocolEncoder) EncodeConnection(info *ConnectionInfo, t time.Time) error {
+	e.encodeConnection(info, t)
+	return e.w.Flush()
+}
+
+func (e *LineProtocolEncoder) encodeDownstream(channels []*DownstreamChannel, t time.Time) {
+	for _, ch := range channels {
+		e.point(channelMeasurement(DirectionDownstream, ch.Kind()), [][2]string{
+			{"channel_id", strconv.Itoa(ch.ChannelID)},
+			{"lock_status", ch.LockStatus},
+			{"modulation", ch.Modulation},
+		}, [][2]string{
+			{"frequency_mhz", formatFloatField(ch.Frequency)},
+			{"power_dbmv", formatFloatField(ch.Power)},
+			{"snr_db", formatFloatField(ch.SignalToNoise)},
+			{"corrected_errors", formatIntField(int64(ch.CorrectedErrors))},
+			{"uncorrected_errors", formatIntField(int64(ch.UncorrectedErrors))},
+		}, t)
+	}
+}
+
+func (e *LineProtocolEncoder) encodeUpstream(channels []*UpstreamChannel, t time.Time) {
+	for _, ch := range channels {
+		e.point(channelMeasurement(DirectionUpstream, ch.Kind()), [][2]string{
+			{"channel_id", strconv.Itoa(ch.ChannelID)},
+			{"lock_status", ch.LockStatus},
+			{"modulation", ch.ChannelType},
+		}, [][2]string{
+			{"frequency_mhz", formatFloatField(ch.Frequency)},
+			{"power_dbmv", formatFloatField(ch.Power)},
+			{"symbol_rate_ksyms", formatFloatField(ch.SymbolRate)},
+		}, t)
+	}
+}
+
+func (e *LineProtocolEncoder) encodeConnection(info *ConnectionInfo, t time.Time) {
+	e.point(lineProtocolPrefix+"connection", [][2]string{
+		{"connectivity_state", info.ConnectivityState()},
+	}, [][2]string{
+		{"uptime_seconds", formatIntField(int64(info.Uptime.Seconds()))},
+		{"network_access", strconv.FormatBool(info.NetworkAccessAllowed())},
+		{"boot_status", formatStringField(info.BootStatus)},
+	}, t)
+}
+
+// Writes a point. Tags with empty values are omitted, as line protocol does
+// not allow them.
+func (e *LineProtocolEncoder) point(measurement string, tags, fields [][2]string, t time.Time) {
+	e.w.WriteString(lineProtocolKeyEscaper.Replace(measurement))
+	for _, tag := range tags {
+		if tag[1] == "" {
+			continue
+		}
+		e.w.WriteByte(',')
+		e.w.WriteString(lineProtocolKeyEscaper.Replace(tag[0]))
+		e.w.WriteByte('=')
+		e.w.WriteString(lineProtocolKeyEscaper.Replace(tag[1]))
+	}
+	for idx, field := range fields {
+		if idx == 0 {
+			e.w.WriteByte(' ')
+		} else {
+			e.w.WriteByte(',')
+		}
+		e.w.WriteString(lineProtocolKeyEscaper.Replace(field[0]))
+		e.w.WriteByte('=')
+		e.w.WriteString(field[1])
+	}
+	if !t.IsZero() {
+		e.w.WriteByte(' ')
+		e.w.WriteString(strconv.FormatInt(t.UnixNano(), 10))
+	}
+	e.w.WriteByte('\n')
+}
+
+// Returns the measurement of a channel, e.g. mb8600_downstream_scqam.
+func channelMeasurement(direction string, kind ChannelKind) string {
+	return lineProtocolPrefix + direction + "_" + strings.ToLower(strings.ReplaceAll(string(kind), "-", ""))
+}
+
+func formatFloatField(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func formatIntField(value int64) string {
+	return strconv.FormatInt(value, 10) + "i"
+}
+
+func formatStringField(value string) string {
+	return `"` + lineProtocolStringEscaper.Replace(value) + `"`
+}
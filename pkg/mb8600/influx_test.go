@@ -0,0 +1,66 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestLineProtocolEncoder(t *testing.T) {
+	now := time.Unix(1703361406, 0)
+	snapshot := &Snapshot{
+		Time: now,
+		Downstream: []*DownstreamChannel{
+			{ChannelID: 1, LockStatus: "Locked", Modulation: "QAM256", Frequency: 531, Power: 2.1, SignalToNoise: 40.5, CorrectedErrors: 12, UncorrectedErrors: 3},
+			{ChannelID: 33, LockStatus: "Not Locked", Modulation: "OFDM PLC", Frequency: 690, CorrectedErrors: 4294967290},
+		},
+		Upstream: []*UpstreamChannel{
+			{ChannelID: 4, LockStatus: "Locked", ChannelType: "SC-QAM", SymbolRate: 5120, Frequency: 35.6, Power: 56},
+		},
+		Connection: &ConnectionInfo{
+			Uptime:             7*24*time.Hour + 40*time.Minute + 6*time.Second,
+			NetworkAccess:      "Allowed",
+			ConnectivityStatus: "OK",
+			BootStatus:         `"OK"`,
+		},
+	}
+
+	var b bytes.Buffer
+	if err := NewLineProtocolEncoder(&b).EncodeSnapshot(snapshot); err != nil {
+		t.Fatalf("LineProtocolEncoder.EncodeSnapshot() error = %v", err)
+	}
+	want := `mb8600_downstream_scqam,channel_id=1,lock_status=Locked,modulation=QAM256 frequency_mhz=531,power_dbmv=2.1,snr_db=40.5,corrected_errors=12i,uncorrected_errors=3i 1703361406000000000
+mb8600_downstream_ofdm,channel_id=33,lock_status=Not\ Locked,modulation=OFDM\ PLC frequency_mhz=690,power_dbmv=0,snr_db=0,corrected_errors=4294967290i,uncorrected_errors=0i 1703361406000000000
+mb8600_upstream_scqam,channel_id=4,lock_status=Locked,modulation=SC-QAM frequency_mhz=35.6,power_dbmv=56,symbol_rate_ksyms=5120 1703361406000000000
+mb8600_upstream_summary channels=1i,locked_channels=1i 1703361406000000000
+mb8600_connection,connectivity_state=OK uptime_seconds=607206i,network_access=true,boot_status="\"OK\"" 1703361406000000000
+`
+	if got := b.String(); got != want {
+		t.Errorf("LineProtocolEncoder.EncodeSnapshot() =\n%s\nwant\n%s", got, want)
+	}
+
+	// The receiver timestamps points without a time.
+	b.Reset()
+	if err := NewLineProtocolEncoder(&b).EncodeUpstream(snapshot.Upstream, time.Time{}); err != nil {
+		t.Fatalf("LineProtocolEncoder.EncodeUpstream() error = %v", err)
+	}
+	want = "mb8600_upstream_scqam,channel_id=4,lock_status=Locked,modulation=SC-QAM frequency_mhz=35.6,power_dbmv=56,symbol_rate_ksyms=5120\n"
+	if got := b.String(); got != want {
+		t.Errorf("LineProtocolEncoder.EncodeUpstream() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package kitlog adapts go-kit loggers for use with the mb8600 package,
+// translating its log levels so go-kit's level filters apply to them.
+package kitlog
+
+import (
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+type logger struct {
+	next log.Logger
+}
+
+// Returns an mb8600.Logger writing to the given go-kit logger.
+func New(next log.Logger) mb8600.Logger {
+	return &logger{next: next}
+}
+
+func (l *logger) Log(keyvals ...any) error {
+	for idx := 0; idx+1 < len(keyvals); idx += 2 {
+		if keyvals[idx] != mb8600.LevelKey {
+			continue
+		}
+		if lvl, ok := keyvals[idx+1].(mb8600.Level); ok {
+			keyvals[idx] = level.Key()
+			keyvals[idx+1] = levelValue(lvl)
+		}
+	}
+	return l.next.Log(keyvals...)
+}
+
+func levelValue(lvl mb8600.Level) level.Value {
+	switch lvl {
+	case mb8600.LevelDebug:
+		return level.DebugValue()
+	case mb8600.LevelWarn:
+		return level.WarnValue()
+	case mb8600.LevelError:
+		return level.ErrorValue()
+	}
+	return level.InfoValue()
+}
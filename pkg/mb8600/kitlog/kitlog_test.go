@@ -0,0 +1,39 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kitlog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+func TestNew(t *testing.T) {
+	var b bytes.Buffer
+	logger := New(level.NewFilter(log.NewLogfmtLogger(&b), level.AllowInfo()))
+
+	logger.Log(mb8600.LevelKey, mb8600.LevelDebug, "msg", "hidden")
+	logger.Log(mb8600.LevelKey, mb8600.LevelWarn, "msg", "shown")
+
+	if got := b.String(); strings.Contains(got, "hidden") || !strings.Contains(got, "level=warn msg=shown") {
+		t.Errorf("New() logged %q, want only the warning", got)
+	}
+}
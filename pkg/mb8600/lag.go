@@ -0,0 +1,58 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The link aggregation (LAG) state of the modem's two LAN ports, which can be
+// bonded into a single 2 Gbps link with a switch or router supporting 802.3ad.
+type LagStatus struct {
+	// Whether the LAN ports are bonded.
+	Enabled bool `json:"enabled"`
+	// The status as reported by the modem, e.g. "0" or "1".
+	Status string `json:"status"`
+}
+
+// Returns the LAG state described by the response to GetMotoLagStatus. The
+// status is reported as "1" or "0" by most firmware, and as "Enabled" or
+// "Disabled" by some.
+func NewLagStatusFromResponse(resp map[string]string) (*LagStatus, error) {
+	status := strings.TrimSpace(resp["MotoLagCurrentStatus"])
+	switch strings.ToLower(status) {
+	case "1", "enabled":
+		return &LagStatus{Enabled: true, Status: status}, nil
+	case "0", "disabled":
+		return &LagStatus{Enabled: false, Status: status}, nil
+	}
+	return nil, fmt.Errorf("invalid link aggregation status: %q", status)
+}
+
+// Returns the link aggregation state of the LAN ports. Fails without querying
+// the modem if its model has no bondable ports.
+func (c *MotoClient) GetLagStatus() (*LagStatus, error) {
+	if profile := c.Profile(); !profile.LinkAggregation {
+		return nil, fmt.Errorf("link aggregation is not supported by the %s", profile.Model)
+	}
+
+	resp, err := c.do("GetMotoLagStatus", nil)
+	if err != nil {
+		return nil, err
+	}
+	return NewLagStatusFromResponse(resp)
+}
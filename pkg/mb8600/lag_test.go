@@ -0,0 +1,79 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/thelande/mb8600/pkg/mb8600test"
+)
+
+func TestNewLagStatusFromResponse(t *testing.T) {
+	tests := []struct {
+		status  string
+		want    bool
+		wantErr bool
+	}{
+		{"0", false, false},
+		{"1", true, false},
+		{" Enabled ", true, false},
+		{"disabled", false, false},
+		{"", false, true},
+		{"2", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			got, err := NewLagStatusFromResponse(map[string]string{"MotoLagCurrentStatus": tt.status})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewLagStatusFromResponse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.Enabled != tt.want {
+				t.Errorf("NewLagStatusFromResponse().Enabled = %v, want %v", got.Enabled, tt.want)
+			}
+		})
+	}
+}
+
+func TestMotoClient_GetLagStatus(t *testing.T) {
+	modem := mb8600test.NewModem(username, password)
+	modem.SetResponse("GetMotoLagStatus", map[string]string{"MotoLagCurrentStatus": "1"})
+	server := mb8600test.NewServer(modem)
+	defer server.Close()
+
+	c := NewMotoClient(mb8600test.Address(server), username, password, logger)
+	if _, err := c.Login(); err != nil {
+		t.Fatalf("MotoClient.Login() error = %v", err)
+	}
+	got, err := c.GetLagStatus()
+	if err != nil {
+		t.Fatalf("MotoClient.GetLagStatus() error = %v", err)
+	}
+	if want := (LagStatus{Enabled: true, Status: "1"}); *got != want {
+		t.Errorf("MotoClient.GetLagStatus() = %+v, want %+v", *got, want)
+	}
+
+	// Models without bondable ports are not queried.
+	c = NewMotoClient(mb8600test.Address(server), username, password, logger, WithModel(ModelMB8611))
+	requests := len(modem.Requests())
+	if _, err := c.GetLagStatus(); err == nil {
+		t.Errorf("MotoClient.GetLagStatus() error = nil, want error for MB8611")
+	}
+	if got := modem.Requests()[requests:]; slices.Contains(got, "GetMotoLagStatus") {
+		t.Errorf("Modem.Requests() = %v, want no GetMotoLagStatus", got)
+	}
+}
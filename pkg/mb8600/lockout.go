@@ -0,0 +1,149 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Defaults of the login guard, see WithLoginRateLimit and WithLoginLockout.
+// The MB8600 locks its web interface after a handful of failed logins, so a
+// client with a wrong password must stop well before that.
+const (
+	DefaultLoginInterval    = 5 * time.Second
+	DefaultLoginMaxFailures = 3
+	DefaultLoginLockout     = 15 * time.Minute
+)
+
+// Spaces login attempts after failures and stops them altogether after
+// consecutive authentication failures, so a client with wrong credentials
+// does not lock the modem's web interface.
+type loginGuard struct {
+	// The minimum time between a failed login and the next attempt.
+	interval time.Duration
+	// The consecutive authentication failures that stop logins, and for how
+	// long. Logins are never stopped if maxFailures is 0, and stay stopped
+	// until reset if cooldown is 0.
+	maxFailures int
+	cooldown    time.Duration
+
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+
+	mu          sync.Mutex
+	failures    int
+	lastFailure time.Time
+	locked      bool
+	lockedUntil time.Time
+}
+
+func newLoginGuard() *loginGuard {
+	return &loginGuard{
+		interval:    DefaultLoginInterval,
+		maxFailures: DefaultLoginMaxFailures,
+		cooldown:    DefaultLoginLockout,
+		now:         time.Now,
+		sleep:       sleepContext,
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Returns an error wrapping ErrAuthLockout while logins are stopped, or
+// waits until the interval since the last failed login has passed.
+func (g *loginGuard) admit(ctx context.Context) error {
+	g.mu.Lock()
+	now := g.now()
+	if g.locked {
+		if g.cooldown == 0 {
+			g.mu.Unlock()
+			return fmt.Errorf("%w: %d consecutive failed logins", ErrAuthLockout, g.failures)
+		}
+		if now.Before(g.lockedUntil) {
+			g.mu.Unlock()
+			return fmt.Errorf("%w: %d consecutive failed logins, retrying after %s",
+				ErrAuthLockout, g.failures, g.lockedUntil.Format(time.RFC3339))
+		}
+		// Allow a single attempt once the cooldown is over; another failure
+		// stops logins again.
+		g.locked = false
+		g.failures = g.maxFailures - 1
+	}
+	var wait time.Duration
+	if g.failures > 0 {
+		wait = g.lastFailure.Add(g.interval).Sub(now)
+	}
+	g.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	return g.sleep(ctx, wait)
+}
+
+// Records the outcome of a login. Only authentication failures count
+// towards the lockout, not transport failures, which say nothing about the
+// credentials.
+func (g *loginGuard) record(err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if err == nil {
+		g.failures = 0
+		return
+	}
+	if !isAuthFailure(err) {
+		return
+	}
+	g.failures++
+	g.lastFailure = g.now()
+	if g.maxFailures > 0 && g.failures >= g.maxFailures {
+		g.locked = true
+		g.lockedUntil = g.lastFailure.Add(g.cooldown)
+	}
+}
+
+func (g *loginGuard) reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.failures = 0
+	g.locked = false
+}
+
+// Returns true if err is the modem rejecting the credentials of a login.
+func isAuthFailure(err error) bool {
+	var loginErr *LoginError
+	return errors.As(err, &loginErr) || errors.Is(err, ErrUnauthorized)
+}
+
+// Re-enables logins stopped after consecutive authentication failures, e.g.
+// once the password has been corrected. See WithLoginLockout.
+func (c *MotoClient) ResetLoginLockout() {
+	c.loginGuard.reset()
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/mb8600test"
+)
+
+// Returns a guard on a fake clock that records its waits instead of
+// sleeping.
+func newTestLoginGuard(maxFailures int, cooldown time.Duration) (*loginGuard, *time.Time, *[]time.Duration) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var waits []time.Duration
+	g := newLoginGuard()
+	g.maxFailures = maxFailures
+	g.cooldown = cooldown
+	g.now = func() time.Time { return now }
+	g.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		now = now.Add(d)
+		return nil
+	}
+	return g, &now, &waits
+}
+
+func TestLoginGuard(t *testing.T) {
+	rejected := &LoginError{Result: "FAILED"}
+	g, now, waits := newTestLoginGuard(3, time.Hour)
+
+	// Transport failures neither wait nor count.
+	for i := 0; i < 5; i++ {
+		if err := g.admit(context.Background()); err != nil {
+			t.Fatalf("admit() after transport failures error = %v", err)
+		}
+		g.record(fmt.Errorf("dial tcp: i/o timeout"))
+	}
+	if len(*waits) != 0 {
+		t.Errorf("waits = %v after transport failures, want none", *waits)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := g.admit(context.Background()); err != nil {
+			t.Fatalf("admit() after %d failures error = %v", i, err)
+		}
+		g.record(rejected)
+		*now = now.Add(time.Second)
+	}
+	if want := []time.Duration{4 * time.Second, 4 * time.Second}; fmt.Sprint(*waits) != fmt.Sprint(want) {
+		t.Errorf("waits = %v, want %v", *waits, want)
+	}
+	if err := g.admit(context.Background()); !errors.Is(err, ErrAuthLockout) {
+		t.Fatalf("admit() after 3 failures error = %v, want %v", err, ErrAuthLockout)
+	}
+
+	// After the cooldown a single attempt is allowed.
+	*now = now.Add(time.Hour)
+	if err := g.admit(context.Background()); err != nil {
+		t.Fatalf("admit() after the cooldown error = %v", err)
+	}
+	g.record(fmt.Errorf("action, Login: %w", ErrUnauthorized))
+	if err := g.admit(context.Background()); !errors.Is(err, ErrAuthLockout) {
+		t.Fatalf("admit() after a failure following the cooldown error = %v, want %v", err, ErrAuthLockout)
+	}
+
+	g.reset()
+	if err := g.admit(context.Background()); err != nil {
+		t.Fatalf("admit() after reset error = %v", err)
+	}
+	g.record(nil)
+	g.record(rejected)
+	g.record(rejected)
+	if err := g.admit(context.Background()); errors.Is(err, ErrAuthLockout) {
+		t.Errorf("admit() error = %v, want a success to have reset the failures", err)
+	}
+}
+
+func TestLoginGuard_noCooldown(t *testing.T) {
+	g, now, _ := newTestLoginGuard(1, 0)
+	g.record(&LoginError{Result: "FAILED"})
+	*now = now.Add(24 * time.Hour)
+	if err := g.admit(context.Background()); !errors.Is(err, ErrAuthLockout) {
+		t.Errorf("admit() error = %v, want %v until reset", err, ErrAuthLockout)
+	}
+}
+
+func TestLoginGuard_disabled(t *testing.T) {
+	g, _, waits := newTestLoginGuard(0, time.Hour)
+	g.interval = 0
+	for i := 0; i < 10; i++ {
+		if err := g.admit(context.Background()); err != nil {
+			t.Fatalf("admit() error = %v", err)
+		}
+		g.record(&LoginError{Result: "FAILED"})
+	}
+	if len(*waits) != 0 {
+		t.Errorf("waits = %v, want none", *waits)
+	}
+}
+
+func TestLoginGuard_cancelled(t *testing.T) {
+	g := newLoginGuard()
+	g.record(&LoginError{Result: "FAILED"})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := g.admit(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("admit() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestMotoClient_loginLockout(t *testing.T) {
+	modem := mb8600test.NewModem(username, password)
+	server := mb8600test.NewServer(modem)
+	defer server.Close()
+
+	c := NewMotoClient(mb8600test.Address(server), username, "wrong", logger,
+		WithLoginRateLimit(0), WithLoginLockout(2, 0))
+	for i := 0; i < 2; i++ {
+		if _, err := c.Login(); err == nil || errors.Is(err, ErrAuthLockout) {
+			t.Fatalf("MotoClient.Login() %d error = %v, want a rejected login", i, err)
+		}
+	}
+	before := len(modem.Requests())
+	if _, err := c.Login(); !errors.Is(err, ErrAuthLockout) {
+		t.Fatalf("MotoClient.Login() error = %v, want %v", err, ErrAuthLockout)
+	}
+	if _, err := c.GetDownstreamChannels(); err == nil {
+		t.Errorf("MotoClient.GetDownstreamChannels() error = nil while locked out")
+	}
+	if requests := modem.Requests()[before:]; len(requests) > 1 {
+		t.Errorf("Modem.Requests() = %v while locked out, want no login", requests)
+	}
+
+	c.Password = password
+	c.ResetLoginLockout()
+	if _, err := c.Login(); err != nil {
+		t.Errorf("MotoClient.Login() after reset error = %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+)
+
+// The key under which the level of a log record is passed to a Logger.
+const LevelKey = "level"
+
+// The severity of a log record, passed to a Logger under LevelKey.
+type Level string
+
+const (
+	LevelDebug Level = "debug"
+	LevelInfo  Level = "info"
+	LevelWarn  Level = "warn"
+	LevelError Level = "error"
+)
+
+// Receives structured log records as alternating keys and values, including
+// a "msg" and a LevelKey entry. It has the same method as go-kit's
+// log.Logger, so go-kit loggers can be used directly; use the kitlog package
+// to keep go-kit's level filtering working. NewSlogLogger adapts a
+// log/slog logger.
+type Logger interface {
+	Log(keyvals ...any) error
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Log(keyvals ...any) error { return nil }
+
+// Returns a Logger that discards all records.
+func NewNopLogger() Logger {
+	return nopLogger{}
+}
+
+func logAt(logger Logger, lvl Level, keyvals ...any) {
+	if logger == nil {
+		return
+	}
+	logger.Log(append([]any{LevelKey, lvl}, keyvals...)...)
+}
+
+func logDebug(logger Logger, keyvals ...any) { logAt(logger, LevelDebug, keyvals...) }
+func logInfo(logger Logger, keyvals ...any)  { logAt(logger, LevelInfo, keyvals...) }
+func logWarn(logger Logger, keyvals ...any)  { logAt(logger, LevelWarn, keyvals...) }
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// Returns a Logger writing records to the given log/slog logger.
+func NewSlogLogger(logger *slog.Logger) Logger {
+	return &slogLogger{logger: logger}
+}
+
+func (l *slogLogger) Log(keyvals ...any) error {
+	lvl := slog.LevelInfo
+	var msg string
+	attrs := make([]slog.Attr, 0, len(keyvals)/2)
+
+	for idx := 0; idx < len(keyvals); idx += 2 {
+		key := fmt.Sprint(keyvals[idx])
+		var value any = "(MISSING)"
+		if idx+1 < len(keyvals) {
+			value = keyvals[idx+1]
+		}
+
+		switch {
+		case key == LevelKey:
+			lvl = slogLevel(value)
+		case key == "msg" && msg == "":
+			msg = fmt.Sprint(value)
+		default:
+			attrs = append(attrs, slog.Any(key, value))
+		}
+	}
+
+	l.logger.LogAttrs(context.Background(), lvl, msg, attrs...)
+	return nil
+}
+
+func slogLevel(value any) slog.Level {
+	switch Level(fmt.Sprint(value)) {
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelWarn:
+		return slog.LevelWarn
+	case LevelError:
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// Request and response fields that carry credentials or session secrets.
+var redactedFields = map[string]bool{
+	"HNAP_AUTH":     true,
+	"LoginPassword": true,
+	"PrivateKey":    true,
+	"Cookie":        true,
+	"Password":      true,
+}
+
+const redactedValue = "[REDACTED]"
+
+// Returns a copy of fields with secret values replaced, for logging.
+func redact(fields map[string]string) map[string]string {
+	out := maps.Clone(fields)
+	for key, value := range out {
+		if redactedFields[key] && value != "" {
+			out[key] = redactedValue
+		}
+	}
+	return out
+}
+
+// Formats fields with secret values replaced when a record is written, so
+// records dropped by a level filter cost neither the copy nor the formatting.
+type redacted struct {
+	fields map[string]string
+	// If set, the fields are formatted nested under the action name, as they
+	// are sent.
+	action string
+}
+
+func (r redacted) String() string {
+	if r.action != "" {
+		return fmt.Sprintf("%s", map[string]map[string]string{r.action: redact(r.fields)})
+	}
+	return fmt.Sprintf("%s", redact(r.fields))
+}
+
+// Keeps encoders that prefer encoding.TextMarshaler, such as JSON handlers,
+// from encoding the unredacted fields.
+func (r redacted) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
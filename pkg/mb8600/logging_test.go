@@ -0,0 +1,134 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/thelande/mb8600/pkg/mb8600test"
+)
+
+// Records log records as formatted strings.
+type recordingLogger struct {
+	mu      sync.Mutex
+	records []string
+}
+
+func (l *recordingLogger) Log(keyvals ...any) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records = append(l.records, fmt.Sprint(keyvals...))
+	return nil
+}
+
+func TestNewSlogLogger(t *testing.T) {
+	var b bytes.Buffer
+	handler := slog.NewTextHandler(&b, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	logger := NewSlogLogger(slog.New(handler))
+
+	logDebug(logger, "msg", "hidden")
+	logWarn(logger, "msg", "poll failed", "err", "timeout", "odd")
+
+	want := "level=WARN msg=\"poll failed\" err=timeout odd=(MISSING)\n"
+	if got := b.String(); got != want {
+		t.Errorf("NewSlogLogger() logged %q, want %q", got, want)
+	}
+}
+
+func Test_redact(t *testing.T) {
+	fields := map[string]string{
+		"Action":        "login",
+		"Username":      "admin",
+		"LoginPassword": "0123456789ABCDEF",
+		"HNAP_AUTH":     "ABCDEF 1703361406202",
+		"Captcha":       "",
+	}
+	want := map[string]string{
+		"Action":        "login",
+		"Username":      "admin",
+		"LoginPassword": redactedValue,
+		"HNAP_AUTH":     redactedValue,
+		"Captcha":       "",
+	}
+	if got := redact(fields); !reflect.DeepEqual(got, want) {
+		t.Errorf("redact() = %v, want %v", got, want)
+	}
+	if fields["LoginPassword"] == redactedValue {
+		t.Errorf("redact() modified its argument")
+	}
+}
+
+// Debug logging of a login must not reveal the password digest, the private
+// key or the session cookie.
+func TestMotoClient_logRedaction(t *testing.T) {
+	server := mb8600test.NewServer(mb8600test.NewModem(username, password))
+	defer server.Close()
+
+	rec := &recordingLogger{}
+	c := NewMotoClient(mb8600test.Address(server), username, password, rec)
+	if _, err := c.Login(); err != nil {
+		t.Fatalf("MotoClient.Login() error = %v", err)
+	}
+	if _, err := c.GetDownstreamChannels(); err != nil {
+		t.Fatalf("MotoClient.GetDownstreamChannels() error = %v", err)
+	}
+
+	privateKey, _ := c.GetPrivateKey()
+	uid, _ := c.GetUID()
+	logs := strings.Join(rec.records, "\n")
+	for name, secret := range map[string]string{"private key": privateKey, "uid": uid, "password": password} {
+		if strings.Contains(logs, secret) {
+			t.Errorf("debug log contains the %s", name)
+		}
+	}
+	if !strings.Contains(logs, redactedValue) {
+		t.Errorf("debug log contains no redacted values")
+	}
+}
+
+func Test_redacted(t *testing.T) {
+	fields := map[string]string{"Username": "admin", "LoginPassword": "secret"}
+
+	var b bytes.Buffer
+	NewSlogLogger(slog.New(slog.NewJSONHandler(&b, nil))).Log(
+		"msg", "making request",
+		"data", redacted{fields: fields, action: "Login"},
+		"headers", redacted{fields: fields},
+	)
+	if strings.Contains(b.String(), "secret") || !strings.Contains(b.String(), redactedValue) {
+		t.Errorf("JSON log = %s, want redacted values", b.String())
+	}
+
+	want := "map[Login:map[LoginPassword:[REDACTED] Username:admin]]"
+	if got := fmt.Sprint(redacted{fields: fields, action: "Login"}); got != want {
+		t.Errorf("redacted.String() = %v, want %v", got, want)
+	}
+}
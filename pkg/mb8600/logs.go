@@ -0,0 +1,92 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	logEntrySeparator = "}-{"
+	logTimeLayout     = "15:04:05 Mon Jan 02 2006"
+)
+
+// An entry in the modem's event log.
+type LogEntry struct {
+	// The time and date as reported by the modem.
+	Time string `json:"time"`
+	Date string `json:"date"`
+	// The parsed timestamp, or the zero time if the modem had not established
+	// the time of day when the event was logged.
+	Timestamp   time.Time `json:"timestamp"`
+	Priority    int       `json:"priority"`
+	Description string    `json:"description"`
+	// The normalized code of the event.
+	Code EventCode `json:"code"`
+}
+
+func NewLogEntriesFromResponse(response string) ([]*LogEntry, error) {
+	var entries []*LogEntry
+
+	for _, line := range strings.Split(response, logEntrySeparator) {
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		if entry, err := NewLogEntryFromLine(line); err != nil {
+			return nil, err
+		} else {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, nil
+}
+
+func NewLogEntryFromLine(line string) (*LogEntry, error) {
+	parts := strings.SplitN(line, "^", 4)
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("invalid number of parts in log entry line: %d", len(parts))
+	}
+
+	// Strip whitespace from all parts.
+	for idx := range parts {
+		parts[idx] = strings.TrimSpace(parts[idx])
+	}
+
+	priority, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return nil, err
+	}
+
+	// The description may carry a trailing separator.
+	description := strings.TrimSpace(strings.TrimSuffix(parts[3], "^"))
+
+	// Unparsable timestamps (e.g. "Time Not Established") are left as zero.
+	timestamp, _ := time.ParseInLocation(logTimeLayout, fmt.Sprintf("%s %s", parts[0], parts[1]), time.Local)
+
+	return &LogEntry{
+		Time:        parts[0],
+		Date:        parts[1],
+		Timestamp:   timestamp,
+		Priority:    priority,
+		Description: description,
+		Code:        defaultEventCodeTable.Classify(description),
+	}, nil
+}
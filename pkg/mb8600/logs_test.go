@@ -0,0 +1,138 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+const (
+	logResponse = "   18:56:01  ^  Sun Dec 24 2023  ^3^No Ranging Response received - T3 time-out;CM-MAC=00:00:00:00:00:00;CMTS-MAC=00:00:00:00:00:01;CM-QOS=1.1;CM-VER=3.1;}-{   Time Not Established  ^  Time Not Established  ^5^Cable Modem Reboot due to power reset^}-{   12:00:00  ^  Mon Dec 25 2023  ^6^Honoring MDD; IP provisioning mode = IPv6"
+)
+
+func TestNewLogEntriesFromResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     []EventCode
+		wantErr  bool
+	}{
+		{"empty", "", nil, false},
+		{"valid", logResponse, []EventCode{EventT3Timeout, EventRebootPower, EventUnknown}, false},
+		{"invalid priority", "12:00:00^Mon Dec 25 2023^x^test", nil, true},
+		{"too few", "12:00:00^Mon Dec 25 2023", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewLogEntriesFromResponse(tt.response)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewLogEntriesFromResponse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			var codes []EventCode
+			for _, entry := range got {
+				codes = append(codes, entry.Code)
+			}
+			if !reflect.DeepEqual(codes, tt.want) {
+				t.Errorf("NewLogEntriesFromResponse() codes = %v, want %v", codes, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewLogEntryFromLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want *LogEntry
+	}{
+		{
+			"timestamp",
+			"   18:56:01  ^  Sun Dec 24 2023  ^3^Lost MDD Timeout^",
+			&LogEntry{
+				Time:        "18:56:01",
+				Date:        "Sun Dec 24 2023",
+				Timestamp:   time.Date(2023, 12, 24, 18, 56, 1, 0, time.Local),
+				Priority:    3,
+				Description: "Lost MDD Timeout",
+				Code:        EventMDDTimeout,
+			},
+		},
+		{
+			"no timestamp",
+			"Time Not Established^Time Not Established^3^Lost MDD Timeout",
+			&LogEntry{
+				Time:        "Time Not Established",
+				Date:        "Time Not Established",
+				Priority:    3,
+				Description: "Lost MDD Timeout",
+				Code:        EventMDDTimeout,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewLogEntryFromLine(tt.line)
+			if err != nil {
+				t.Fatalf("NewLogEntryFromLine() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewLogEntryFromLine() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventCodeTable_Classify(t *testing.T) {
+	custom := DefaultEventCodes()
+	if err := custom.Register("US_POWER_MAX", `maximum power`); err != nil {
+		t.Fatalf("EventCodeTable.Register() error = %v", err)
+	}
+	if err := custom.Register(EventReboot, `reset requested`); err != nil {
+		t.Fatalf("EventCodeTable.Register() error = %v", err)
+	}
+	if err := custom.Register(EventUnknown, `(`); err == nil {
+		t.Errorf("EventCodeTable.Register() error = nil, want error for invalid pattern")
+	}
+
+	tests := []struct {
+		name        string
+		table       *EventCodeTable
+		description string
+		want        EventCode
+	}{
+		{"t3", DefaultEventCodes(), "Started Unicast Maintenance Ranging - No Response received - T3 time-out", EventT3Timeout},
+		{"t4", DefaultEventCodes(), "Received Response to Broadcast Maintenance Request, But no Unicast Maintenance opportunities received - T4 time out", EventT4Timeout},
+		{"ds partial", DefaultEventCodes(), "Partial Service - Downstream", EventDSPartialService},
+		{"us partial", DefaultEventCodes(), "Upstream Partial Service", EventUSPartialService},
+		{"sync", DefaultEventCodes(), "SYNC Timing Synchronization failure - Loss of Sync", EventSyncLoss},
+		{"case insensitive", DefaultEventCodes(), "dhcp renew warning - field invalid", EventDHCPRenew},
+		{"unknown", DefaultEventCodes(), "TLV-11 - unrecognized OID", EventUnknown},
+		{"custom", custom, "Transmitting at maximum power", "US_POWER_MAX"},
+		{"custom precedence", custom, "Reboot: reset requested", EventReboot},
+		{"custom keeps defaults", custom, "Lost MDD Timeout", EventMDDTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.table.Classify(tt.description); got != tt.want {
+				t.Errorf("EventCodeTable.Classify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
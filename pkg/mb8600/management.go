@@ -0,0 +1,168 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// Smoothing factors of the latency averages: the fast one follows the
+	// last few requests, the slow one the long-term baseline.
+	fastLatencyAlpha = 0.2
+	slowLatencyAlpha = 0.01
+)
+
+// Indirect indicators of stress on the modem's management plane, whose CPU
+// also serves the web interface and HNAP. Polling too aggressively shows as
+// rising latency, server errors and dropped connections, and sessions being
+// expired, forcing logins.
+type ManagementHealth struct {
+	// The requests observed within the window.
+	Requests int `json:"requests"`
+	// The recent request latency relative to the long-term baseline, 1 when
+	// unchanged.
+	LatencyRatio float64 `json:"latency_ratio"`
+	// The fraction of requests within the window failing with a 5xx status
+	// or without a response, e.g. a reset connection.
+	ErrorRate float64 `json:"error_rate"`
+	// The login exchanges within the window, scaled to an hour.
+	LoginsPerHour float64 `json:"logins_per_hour"`
+	// The composite health from 0, a struggling modem, to 1, the lowest of
+	// the scores of the three indicators.
+	Score float64 `json:"score"`
+}
+
+// A single request, as kept for the window.
+type managementSample struct {
+	start  time.Time
+	failed bool
+	login  bool
+}
+
+// Derives the management plane health from the requests of a client, see
+// ManagementHealth. Register it with WithRequestHooks(m.Hooks()). It is safe
+// for concurrent use.
+type ManagementMonitor struct {
+	window time.Duration
+	now    func() time.Time
+
+	mu          sync.Mutex
+	samples     []managementSample
+	fastLatency float64
+	slowLatency float64
+}
+
+// Returns a monitor reporting on the requests of the last window, e.g. an
+// hour.
+func NewManagementMonitor(window time.Duration) *ManagementMonitor {
+	return &ManagementMonitor{window: window, now: time.Now}
+}
+
+// Returns hooks feeding the monitor.
+func (m *ManagementMonitor) Hooks() RequestHooks {
+	return RequestHooks{OnRequestDone: m.Observe}
+}
+
+// Returns true if the request failed in a way suggesting an overloaded modem.
+func isStressFailure(info RequestInfo) bool {
+	if info.Err == nil {
+		return false
+	}
+	if info.StatusCode >= http.StatusInternalServerError {
+		return true
+	}
+	return info.StatusCode == 0 && !errors.Is(info.Err, ErrUnauthorized)
+}
+
+// Records a completed request.
+func (m *ManagementMonitor) Observe(info RequestInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prune(info.Start)
+	m.samples = append(m.samples, managementSample{
+		start:  info.Start,
+		failed: isStressFailure(info),
+		login:  info.Action == "Login",
+	})
+
+	// Only answered requests say something about the modem's latency.
+	if info.StatusCode == 0 {
+		return
+	}
+	latency := info.Duration.Seconds()
+	if m.slowLatency == 0 {
+		m.fastLatency, m.slowLatency = latency, latency
+		return
+	}
+	m.fastLatency += fastLatencyAlpha * (latency - m.fastLatency)
+	m.slowLatency += slowLatencyAlpha * (latency - m.slowLatency)
+}
+
+// Drops the samples that fell out of the window ending at now.
+func (m *ManagementMonitor) prune(now time.Time) {
+	cutoff := now.Add(-m.window)
+	i := 0
+	for i < len(m.samples) && m.samples[i].start.Before(cutoff) {
+		i++
+	}
+	m.samples = m.samples[i:]
+}
+
+// Returns score clamped to [0, 1].
+func clampScore(score float64) float64 {
+	return math.Max(0, math.Min(1, score))
+}
+
+// Returns the health over the current window.
+func (m *ManagementMonitor) Health() ManagementHealth {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prune(m.now())
+	h := ManagementHealth{Requests: len(m.samples), LatencyRatio: 1, Score: 1}
+	if m.slowLatency > 0 {
+		h.LatencyRatio = m.fastLatency / m.slowLatency
+	}
+
+	var failed, logins int
+	for _, s := range m.samples {
+		if s.failed {
+			failed++
+		}
+		if s.login {
+			logins++
+		}
+	}
+	if len(m.samples) > 0 {
+		h.ErrorRate = float64(failed) / float64(len(m.samples))
+	}
+	// Each login exchange is two requests.
+	h.LoginsPerHour = float64(logins) / 2 / m.window.Hours()
+
+	// Latency four times the baseline, half the requests failing or six
+	// logins an hour each mean a struggling modem.
+	h.Score = math.Min(
+		clampScore(1-(h.LatencyRatio-1)/3),
+		math.Min(clampScore(1-2*h.ErrorRate), clampScore(1-(h.LoginsPerHour-1)/5)),
+	)
+	return h
+}
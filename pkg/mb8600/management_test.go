@@ -0,0 +1,144 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestManagementMonitor_Health(t *testing.T) {
+	start := time.Date(2023, 12, 16, 12, 0, 0, 0, time.UTC)
+	ok := func(d time.Duration) RequestInfo {
+		return RequestInfo{Action: "GetMotoStatusSoftware", Duration: d, StatusCode: http.StatusOK}
+	}
+
+	tests := []struct {
+		name          string
+		requests      []RequestInfo
+		wantRatio     float64
+		wantErrorRate float64
+		wantLogins    float64
+		wantScore     float64
+	}{
+		{
+			"idle",
+			nil,
+			1, 0, 0, 1,
+		},
+		{
+			"steady",
+			[]RequestInfo{ok(time.Second), ok(time.Second), ok(time.Second), ok(time.Second)},
+			1, 0, 0, 1,
+		},
+		{
+			"server errors and resets",
+			[]RequestInfo{
+				ok(time.Second),
+				{Action: "GetMotoStatusLog", Duration: time.Second, StatusCode: http.StatusServiceUnavailable, Err: &StatusError{StatusCode: 503}},
+				{Action: "GetMotoStatusLog", Err: errors.New("connection reset by peer")},
+				{Action: "GetMotoStatusLog", Err: fmt.Errorf("action, x: %w", ErrUnauthorized)},
+			},
+			1, 0.5, 0, 0,
+		},
+		{
+			"login churn",
+			[]RequestInfo{
+				{Action: "Login", StatusCode: http.StatusOK, Duration: time.Second},
+				{Action: "Login", StatusCode: http.StatusOK, Duration: time.Second},
+				{Action: "Login", StatusCode: http.StatusOK, Duration: time.Second},
+				{Action: "Login", StatusCode: http.StatusOK, Duration: time.Second},
+				{Action: "Login", StatusCode: http.StatusOK, Duration: time.Second},
+				{Action: "Login", StatusCode: http.StatusOK, Duration: time.Second},
+			},
+			1, 0, 3, 0.6,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewManagementMonitor(time.Hour)
+			m.now = func() time.Time { return start.Add(time.Hour) }
+			for i, info := range tt.requests {
+				info.Start = start.Add(time.Duration(i) * time.Minute)
+				m.Observe(info)
+			}
+
+			got := m.Health()
+			if got.Requests != len(tt.requests) {
+				t.Errorf("ManagementMonitor.Health().Requests = %v, want %v", got.Requests, len(tt.requests))
+			}
+			for _, v := range []struct {
+				name      string
+				got, want float64
+			}{
+				{"LatencyRatio", got.LatencyRatio, tt.wantRatio},
+				{"ErrorRate", got.ErrorRate, tt.wantErrorRate},
+				{"LoginsPerHour", got.LoginsPerHour, tt.wantLogins},
+				{"Score", got.Score, tt.wantScore},
+			} {
+				if math.Abs(v.got-v.want) > 1e-9 {
+					t.Errorf("ManagementMonitor.Health().%s = %v, want %v", v.name, v.got, v.want)
+				}
+			}
+		})
+	}
+}
+
+func TestManagementMonitor_latency(t *testing.T) {
+	start := time.Date(2023, 12, 16, 12, 0, 0, 0, time.UTC)
+	m := NewManagementMonitor(time.Hour)
+	m.now = func() time.Time { return start }
+
+	observe := func(n int, d time.Duration) {
+		for i := 0; i < n; i++ {
+			m.Observe(RequestInfo{Action: "GetMotoStatusSoftware", Start: start, Duration: d, StatusCode: http.StatusOK})
+		}
+	}
+	observe(100, 200*time.Millisecond)
+	if got := m.Health(); got.LatencyRatio != 1 || got.Score != 1 {
+		t.Fatalf("ManagementMonitor.Health() = %+v, want a steady baseline", got)
+	}
+
+	// The modem slows down to a multiple of its usual latency.
+	observe(20, time.Second)
+	got := m.Health()
+	if got.LatencyRatio < 2.5 {
+		t.Errorf("ManagementMonitor.Health().LatencyRatio = %v, want at least 2.5", got.LatencyRatio)
+	}
+	if got.Score > 0.5 {
+		t.Errorf("ManagementMonitor.Health().Score = %v, want at most 0.5", got.Score)
+	}
+}
+
+func TestManagementMonitor_window(t *testing.T) {
+	start := time.Date(2023, 12, 16, 12, 0, 0, 0, time.UTC)
+	m := NewManagementMonitor(time.Hour)
+	m.Observe(RequestInfo{Action: "GetMotoStatusLog", Start: start, Err: errors.New("connection refused")})
+
+	m.now = func() time.Time { return start.Add(30 * time.Minute) }
+	if got := m.Health(); got.ErrorRate != 1 {
+		t.Errorf("ManagementMonitor.Health().ErrorRate = %v, want 1 within the window", got.ErrorRate)
+	}
+	m.now = func() time.Time { return start.Add(2 * time.Hour) }
+	if got := m.Health(); got.Requests != 0 || got.Score != 1 {
+		t.Errorf("ManagementMonitor.Health() = %+v, want the failure forgotten", got)
+	}
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// A Motorola modem model speaking the HNAP protocol.
+type ModemModel string
+
+const (
+	ModelMB8600 ModemModel = "MB8600"
+	ModelMB8611 ModemModel = "MB8611"
+	ModelMB7621 ModemModel = "MB7621"
+)
+
+// Describes how a model differs from the others.
+type ModelProfile struct {
+	Model ModemModel
+	// The actions the model supports.
+	Actions []string
+	// Whether the model is DOCSIS 3.1 and reports OFDM/OFDMA channels.
+	OFDM bool
+	// Whether the model has bondable LAN ports.
+	LinkAggregation bool
+	// The factory default credentials of the web UI.
+	DefaultUsername string
+	DefaultPassword string
+}
+
+var (
+	modelProfiles = map[ModemModel]*ModelProfile{
+		ModelMB8600: {
+			Model:           ModelMB8600,
+			Actions:         knownActions,
+			OFDM:            true,
+			LinkAggregation: true,
+			DefaultUsername: "admin",
+			DefaultPassword: "motorola",
+		},
+		ModelMB8611: {
+			Model:           ModelMB8611,
+			Actions:         append(slices.Clone(knownActions), "GetMotoStatusSecAccount"),
+			OFDM:            true,
+			LinkAggregation: false,
+			DefaultUsername: "admin",
+			DefaultPassword: "password",
+		},
+		ModelMB7621: {
+			Model:           ModelMB7621,
+			Actions:         slices.DeleteFunc(slices.Clone(knownActions), func(a string) bool { return a == "GetMotoLagStatus" }),
+			OFDM:            false,
+			LinkAggregation: false,
+			DefaultUsername: "admin",
+			DefaultPassword: "motorola",
+		},
+	}
+
+	// Software version prefixes, e.g. "8600-19.3.18".
+	modelVersionPrefixes = map[string]ModemModel{
+		"8600": ModelMB8600,
+		"8611": ModelMB8611,
+		"7621": ModelMB7621,
+	}
+)
+
+// Returns the profile of model, or the MB8600 profile if the model is not
+// known.
+func ProfileFor(model ModemModel) *ModelProfile {
+	if profile, ok := modelProfiles[model]; ok {
+		return profile
+	}
+	return modelProfiles[ModelMB8600]
+}
+
+// Returns the model running the given software version, as reported in
+// StatusSoftwareSfVer, or an error if it is not recognized.
+func ModelFromSoftwareVersion(version string) (ModemModel, error) {
+	prefix, _, _ := strings.Cut(strings.TrimSpace(version), "-")
+	if model, ok := modelVersionPrefixes[prefix]; ok {
+		return model, nil
+	}
+	return "", fmt.Errorf("unrecognized software version: %q", version)
+}
+
+// Returns the profile of the client's model.
+func (c *MotoClient) Profile() *ModelProfile {
+	return ProfileFor(c.getModel())
+}
+
+func (c *MotoClient) getModel() ModemModel {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.model
+}
+
+// Queries the modem's software version to determine its model, and adjusts
+// the client to it. Requires a login.
+func (c *MotoClient) DetectModel() (ModemModel, error) {
+	resp, err := c.do("GetMotoStatusSoftware", nil)
+	if err != nil {
+		return "", err
+	}
+	return c.setModelFromSoftware(resp)
+}
+
+// Detects the model without re-login handling, for use during a login.
+func (c *MotoClient) detectModelOnce(ctx context.Context) (ModemModel, error) {
+	resp, err := c.doOnce(ctx, "GetMotoStatusSoftware", nil)
+	if err != nil {
+		return "", err
+	}
+	return c.setModelFromSoftware(resp)
+}
+
+func (c *MotoClient) setModelFromSoftware(resp map[string]string) (ModemModel, error) {
+	model, err := ModelFromSoftwareVersion(resp["StatusSoftwareSfVer"])
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.model = model
+	return model, nil
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/thelande/mb8600/pkg/mb8600test"
+)
+
+func TestModelFromSoftwareVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    ModemModel
+		wantErr bool
+	}{
+		{"8600-19.3.18", ModelMB8600, false},
+		{" 8611-19.2.18 ", ModelMB8611, false},
+		{"7621-5.7.1.5", ModelMB7621, false},
+		{"SB6183-1.0", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			got, err := ModelFromSoftwareVersion(tt.version)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ModelFromSoftwareVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ModelFromSoftwareVersion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProfileFor(t *testing.T) {
+	tests := []struct {
+		model      ModemModel
+		want       ModemModel
+		wantLAG    bool
+		wantAction string
+		hasAction  bool
+	}{
+		{ModelMB8600, ModelMB8600, true, "GetMotoLagStatus", true},
+		{ModelMB8611, ModelMB8611, false, "GetMotoStatusSecAccount", true},
+		{ModelMB7621, ModelMB7621, false, "GetMotoLagStatus", false},
+		{"", ModelMB8600, true, "GetMotoStatusSecAccount", false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.want), func(t *testing.T) {
+			got := ProfileFor(tt.model)
+			if got.Model != tt.want {
+				t.Errorf("ProfileFor().Model = %v, want %v", got.Model, tt.want)
+			}
+			if got.LinkAggregation != tt.wantLAG {
+				t.Errorf("ProfileFor().LinkAggregation = %v, want %v", got.LinkAggregation, tt.wantLAG)
+			}
+			if slices.Contains(got.Actions, tt.wantAction) != tt.hasAction {
+				t.Errorf("ProfileFor().Actions contains %s = %v, want %v", tt.wantAction, !tt.hasAction, tt.hasAction)
+			}
+		})
+	}
+}
+
+func TestMotoClient_DetectModel(t *testing.T) {
+	modem := mb8600test.NewModem(username, password)
+	fields := mb8600test.DefaultResponses()["GetMotoStatusSoftware"]
+	fields["StatusSoftwareSfVer"] = "7621-5.7.1.5"
+	modem.SetResponse("GetMotoStatusSoftware", fields)
+	server := mb8600test.NewServer(modem)
+	defer server.Close()
+
+	c := NewMotoClient(mb8600test.Address(server), username, password, logger, WithModelDetection())
+	if _, err := c.Login(); err != nil {
+		t.Fatalf("MotoClient.Login() error = %v", err)
+	}
+	if got := c.Profile().Model; got != ModelMB7621 {
+		t.Errorf("MotoClient.Profile().Model = %v, want %v", got, ModelMB7621)
+	}
+	if _, err := c.do("GetMotoLagStatus", nil); err == nil {
+		t.Errorf("MotoClient.do(GetMotoLagStatus) error = nil, want error for MB7621")
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"context"
+	"net/url"
+	"time"
+)
+
+// The methods of MotoClient, so code using the client can be tested against
+// a fake such as testutil.Client, or wrap the client, e.g. to cache or
+// rate limit it. Code needing only part of it should declare a smaller
+// interface, as PollerClient does.
+type ModemClient interface {
+	// Authentication and sessions.
+	Login() (map[string]string, error)
+	Session() (*Session, error)
+	RestoreSession(session *Session) error
+	SaveSession(store SessionStore) error
+	LoadSession(store SessionStore) error
+	SessionTTL() time.Duration
+	ResetLoginLockout()
+	GetPrivateKey() (string, error)
+	GetUID() (string, error)
+	SetPrivateKey(key string) error
+	SetUID(uid string) error
+
+	// Requests.
+	DoAction(action string, params map[string]string) (map[string]string, error)
+	DoActionContext(ctx context.Context, action string, params map[string]string) (map[string]string, error)
+	GetDownstreamChannels() ([]*DownstreamChannel, error)
+	GetUpstreamChannels() ([]*UpstreamChannel, error)
+	GetLogs() ([]*LogEntry, error)
+	GetSoftwareStatus() (*SoftwareStatus, error)
+	GetConnectionInfo() (*ConnectionInfo, error)
+	GetStartupSequence() (*StartupSequence, error)
+	GetLagStatus() (*LagStatus, error)
+	GetAccountInfo() (*AccountInfo, error)
+	GetPartialService() (PartialService, error)
+	GetStatus() (*ModemStatus, error)
+	GetStatusContext(ctx context.Context) (*ModemStatus, error)
+	ScrapeChannels() ([]*DownstreamChannel, []*UpstreamChannel, error)
+	FetchPage(path string) ([]byte, error)
+	ParseStats() ParseStats
+	ClearCache()
+
+	// Models and capabilities.
+	Profile() *ModelProfile
+	DetectModel() (ModemModel, error)
+	Capabilities() (*Capabilities, error)
+	CheckConformance() *ConformanceReport
+
+	// Reachability.
+	Ping(ctx context.Context) error
+	WaitForOnline(ctx context.Context) error
+
+	// Configuration.
+	Err() error
+	GetScheme() string
+	GetEncoding() Encoding
+	GetHNAPURI() string
+	GetHNAPURL() (*url.URL, error)
+	GetStatusPageURI() string
+	CloseIdleConnections()
+}
+
+var (
+	_ ModemClient  = (*MotoClient)(nil)
+	_ PollerClient = ModemClient(nil)
+)
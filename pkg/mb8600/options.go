@@ -0,0 +1,470 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/mb8600/auth"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Configures optional behavior of a MotoClient. Options are applied in the
+// order they are passed to the constructor.
+type Option func(*MotoClient)
+
+// Uses a copy of the supplied http.Client for all requests. A cookie jar is
+// added to the copy if the client does not have one, as the jar holds the
+// session state.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *MotoClient) {
+		cp := *client
+		c.client = &cp
+	}
+}
+
+// Uses the supplied RoundTripper for all requests, e.g. to route requests
+// through a proxy.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *MotoClient) {
+		c.client.Transport = transport
+	}
+}
+
+// Applies update to a copy of the client's *http.Transport, or of
+// http.DefaultTransport if the client has none. Custom RoundTrippers are left
+// untouched.
+func updateTransport(c *MotoClient, update func(t *http.Transport)) {
+	var transport *http.Transport
+	switch t := c.client.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		return
+	}
+	update(transport)
+	c.client.Transport = transport
+}
+
+// Uses the supplied TLS configuration in place of the default, which skips
+// certificate verification.
+//
+// This only applies when the client's transport is an *http.Transport.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(c *MotoClient) {
+		updateTransport(c, func(t *http.Transport) {
+			t.TLSClientConfig = config
+		})
+	}
+}
+
+// Sets the overall time limit for each request made to the modem.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *MotoClient) {
+		c.client.Timeout = timeout
+	}
+}
+
+// The time limits of the stages of a request. A zero value leaves the limit
+// of that stage unchanged.
+type Timeouts struct {
+	// Establishing the TCP connection. Keep it short so an unreachable modem
+	// fails fast.
+	Dial time.Duration
+	// Completing the TLS handshake once connected.
+	TLSHandshake time.Duration
+	// Waiting for the response headers once the request is sent. The modem
+	// is slow to answer some actions, such as the event log, under load.
+	ResponseHeader time.Duration
+	// The whole request, including reading the body, as set by WithTimeout.
+	Overall time.Duration
+}
+
+// Sets separate time limits for each stage of a request, so a slow but
+// working modem is given time to answer while a dead one fails fast.
+//
+// The dial, TLS handshake and response header limits only apply when the
+// client's transport is an *http.Transport.
+func WithTimeouts(timeouts Timeouts) Option {
+	return func(c *MotoClient) {
+		if timeouts.Dial < 0 || timeouts.TLSHandshake < 0 || timeouts.ResponseHeader < 0 || timeouts.Overall < 0 {
+			c.configErr = errors.Join(c.configErr, fmt.Errorf("invalid timeouts: %+v", timeouts))
+			return
+		}
+		if timeouts.Overall > 0 {
+			c.client.Timeout = timeouts.Overall
+		}
+		updateTransport(c, func(t *http.Transport) {
+			if timeouts.Dial > 0 {
+				t.DialContext = (&net.Dialer{Timeout: timeouts.Dial, KeepAlive: 30 * time.Second}).DialContext
+			}
+			if timeouts.TLSHandshake > 0 {
+				t.TLSHandshakeTimeout = timeouts.TLSHandshake
+			}
+			if timeouts.ResponseHeader > 0 {
+				t.ResponseHeaderTimeout = timeouts.ResponseHeader
+			}
+		})
+	}
+}
+
+// Uses the supplied Timestamper when computing the HNAP_AUTH header.
+func WithTimestamper(timestamper Timestamper) Option {
+	return func(c *MotoClient) {
+		c.timestamper = timestamper
+	}
+}
+
+// Sets the scheme used to communicate with the modem, SchemeHTTPS (default) or
+// SchemeHTTP. Some older firmware revisions only serve HNAP over plain HTTP.
+func WithScheme(scheme string) Option {
+	return func(c *MotoClient) {
+		c.scheme = scheme
+		c.schemeFallback = false
+	}
+}
+
+// Probes the modem before the first request, using HTTPS if it is available
+// and falling back to plain HTTP if HTTPS connections are refused, reset or
+// time out. Certificate and handshake errors are returned, never fallen back
+// from.
+func WithSchemeFallback() Option {
+	return func(c *MotoClient) {
+		c.schemeFallback = true
+		c.schemeProbed = false
+	}
+}
+
+// Sets the path of the HNAP endpoint in place of "/HNAP1/", e.g. when the
+// modem is reached through a reverse proxy that serves it under a prefix.
+func WithHNAPPath(path string) Option {
+	return func(c *MotoClient) {
+		u, err := url.Parse(path)
+		if err != nil || u.Path != path || !strings.HasPrefix(path, "/") {
+			c.configErr = errors.Join(c.configErr, fmt.Errorf("invalid HNAP path: %q", path))
+			return
+		}
+		if !strings.HasSuffix(path, "/") {
+			path += "/"
+		}
+		c.hnapPath = path
+	}
+}
+
+// Falls back to scraping the unauthenticated HTML status page when fetching
+// channels over HNAP fails, e.g. on ISP-locked firmware where login is
+// unavailable.
+func WithStatusPageFallback() Option {
+	return func(c *MotoClient) {
+		c.statusPageFallback = true
+	}
+}
+
+// Classifies event log entries using the supplied table instead of the
+// built-in rules.
+func WithEventCodes(table *EventCodeTable) Option {
+	return func(c *MotoClient) {
+		c.eventCodes = table
+	}
+}
+
+// Sets the model of the modem, adjusting the actions the client allows.
+func WithModel(model ModemModel) Option {
+	return func(c *MotoClient) {
+		c.model = model
+	}
+}
+
+// Detects the model of the modem after the first successful login.
+func WithModelDetection() Option {
+	return func(c *MotoClient) {
+		c.detectModel = true
+	}
+}
+
+// Reuses the responses to parameterless Get actions (e.g.
+// GetMotoStatusDownstreamChannelInfo) for ttl, so that several consumers
+// polling within a short window do not each query the modem.
+func WithCache(ttl time.Duration) Option {
+	return func(c *MotoClient) {
+		c.cache = newResponseCache(ttl)
+	}
+}
+
+// Retries requests failing with a transient error, such as a timeout or a
+// server error while the modem re-locks its channels, up to maxAttempts
+// attempts in total. The delay before each retry starts at backoff and doubles
+// with every attempt, up to a minute, with random jitter. Authentication and
+// parse failures are not retried, and neither are actions other than Get
+// actions unless they are marked with WithIdempotentActions.
+func WithRetry(maxAttempts int, backoff time.Duration) Option {
+	return func(c *MotoClient) {
+		if maxAttempts <= 0 || backoff <= 0 {
+			c.configErr = errors.Join(c.configErr, fmt.Errorf("invalid retry attempts or backoff: %v, %v", maxAttempts, backoff))
+			return
+		}
+		c.retry = newRetryPolicy(maxAttempts, backoff)
+	}
+}
+
+// Marks actions beyond the Get actions as safe to send again, so WithRetry
+// retries them. Actions that change the modem's state, such as a reboot,
+// should not be marked.
+func WithIdempotentActions(actions ...string) Option {
+	return func(c *MotoClient) {
+		c.idempotentActions = append(c.idempotentActions, actions...)
+	}
+}
+
+// Allows the client to invoke actions beyond those of the modem's profile,
+// e.g. firmware-specific actions called through DoAction.
+func WithActions(actions ...string) Option {
+	return func(c *MotoClient) {
+		c.customActions = append(c.customActions, actions...)
+	}
+}
+
+// Disables the action allowlist, so DoAction may invoke any action.
+func WithAnyAction() Option {
+	return func(c *MotoClient) {
+		c.anyAction = true
+	}
+}
+
+// Sets how long Ping waits for the modem to answer and how often
+// WaitForOnline pings it. The defaults are 2 and 5 seconds.
+func WithProbe(timeout, interval time.Duration) Option {
+	return func(c *MotoClient) {
+		if timeout <= 0 || interval <= 0 {
+			c.configErr = errors.Join(c.configErr, fmt.Errorf("invalid probe timeout or interval: %v, %v", timeout, interval))
+			return
+		}
+		c.probeTimeout = timeout
+		c.probeInterval = interval
+	}
+}
+
+// Logs in with the credentials supplied by provider, asked for at every
+// login, in place of the username and password the client was created with.
+// The client's username is used if the provider supplies none, and still
+// identifies saved sessions.
+func WithCredentials(provider CredentialsProvider) Option {
+	return func(c *MotoClient) {
+		c.credentialsProvider = provider
+	}
+}
+
+// Traces every HNAP action in an OpenTelemetry span of its own, created by a
+// tracer of provider, covering its retries and any re-login, with the
+// attributes listed with AttributeAction. Spans are children of the span in
+// the context passed to the *Context methods, and the context is passed on
+// to the HTTP requests, so an instrumented transport adds child spans.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(c *MotoClient) {
+		c.tracer = provider.Tracer(tracerName)
+	}
+}
+
+// Calls hooks around every HNAP request. Hooks added by several options are
+// called in the order the options are given.
+func WithRequestHooks(hooks RequestHooks) Option {
+	return func(c *MotoClient) {
+		c.hooks = append(c.hooks, hooks)
+	}
+}
+
+// Passes every HNAP request and the raw response to it to recorder, e.g. a
+// PayloadFile to attach to a bug report. Passwords, keys and session
+// cookies are redacted first, and MAC addresses, IP addresses, serial
+// numbers and account names replaced by pseudonyms.
+func WithPayloadRecorder(recorder PayloadRecorder) Option {
+	return func(c *MotoClient) {
+		c.payloadRecorder = recorder
+		c.payloadSanitizer = newPayloadSanitizer()
+	}
+}
+
+// Sets how HNAP requests are encoded, EncodingJSON by default. Use
+// EncodingXML for firmware that only accepts SOAP envelopes, or EncodingAuto
+// to switch to them if the modem rejects JSON.
+func WithEncoding(encoding Encoding) Option {
+	return func(c *MotoClient) {
+		if _, err := ParseEncoding(string(encoding)); err != nil {
+			c.configErr = errors.Join(c.configErr, err)
+			return
+		}
+		c.encoding = encoding
+	}
+}
+
+// Sets the User-Agent header of HNAP requests, e.g. to match a rule of a
+// reverse proxy in front of the modem, rather than Go's default.
+func WithUserAgent(userAgent string) Option {
+	return func(c *MotoClient) {
+		c.userAgent = userAgent
+	}
+}
+
+// Sets an additional header on every HNAP request, e.g. for a reverse proxy
+// in front of the modem. The headers of the HNAP protocol itself cannot be
+// overridden.
+func WithHeader(name, value string) Option {
+	return func(c *MotoClient) {
+		for _, reserved := range []string{"Accept", "Content-Type", "SOAPAction", "HNAP_AUTH", "User-Agent"} {
+			if strings.EqualFold(name, reserved) {
+				c.configErr = errors.Join(c.configErr, fmt.Errorf("header %s is set by the client", reserved))
+				return
+			}
+		}
+		if c.extraHeaders == nil {
+			c.extraHeaders = map[string]string{}
+		}
+		c.extraHeaders[name] = value
+	}
+}
+
+// Sets the namespace of the SOAPAction header, by default
+// "http://purenetworks.com/HNAP1/", for firmware that deviates from it. The
+// namespace is also signed in the HNAP_AUTH header.
+func WithSOAPNamespace(namespace string) Option {
+	return func(c *MotoClient) {
+		if namespace == "" {
+			c.configErr = errors.Join(c.configErr, errors.New("empty SOAP namespace"))
+			return
+		}
+		c.soapNamespace = namespace
+	}
+}
+
+// Sets how long the modem is expected to keep an idle session, by default
+// DefaultSessionTTL. The client logs in again before an idle session would
+// expire rather than having its next request rejected, and shortens the
+// lifetime if the modem expires sessions sooner. Zero disables the
+// pre-emptive login.
+func WithSessionTTL(ttl time.Duration) Option {
+	return func(c *MotoClient) {
+		c.sessionTTL.Store(int64(max(ttl, 0)))
+	}
+}
+
+// Skips channel rows that do not parse, logging and counting them in
+// ParseStats, rather than failing the whole channel list. Parsing is strict
+// by default.
+func WithLenientParsing() Option {
+	return func(c *MotoClient) {
+		c.lenientParsing = true
+	}
+}
+
+// Accepts only "OK" and "SUCCESS", in any casing, as a successful
+// LoginResult. By default, results that name neither a success nor a failure
+// are accepted with a warning, as firmware varies in its wording.
+func WithStrictLogin() Option {
+	return func(c *MotoClient) {
+		c.strictLogin = true
+	}
+}
+
+// Waits at least interval after a failed login before attempting another, so
+// a misconfigured client does not hammer the modem with logins. Defaults to
+// DefaultLoginInterval; zero disables the wait.
+func WithLoginRateLimit(interval time.Duration) Option {
+	return func(c *MotoClient) {
+		c.loginGuard.interval = max(interval, 0)
+	}
+}
+
+// Stops logging in after maxFailures consecutive logins rejected by the
+// modem, failing logins with ErrAuthLockout for cooldown, or until
+// ResetLoginLockout if cooldown is 0. The first login after the cooldown is
+// attempted, and stops logins again if it fails. Defaults to
+// DefaultLoginMaxFailures and DefaultLoginLockout; a maxFailures of 0 never
+// stops logins.
+func WithLoginLockout(maxFailures int, cooldown time.Duration) Option {
+	return func(c *MotoClient) {
+		c.loginGuard.maxFailures = max(maxFailures, 0)
+		c.loginGuard.cooldown = max(cooldown, 0)
+	}
+}
+
+// Uses d in place of HMAC-MD5 to derive the login keys and sign requests,
+// e.g. auth.HMACSHA256 for Arris firmware using that variant.
+func WithDigest(d auth.Digest) Option {
+	return func(c *MotoClient) {
+		c.digest = d
+	}
+}
+
+// Makes GetStatus fetch everything with a single GetMultipleHNAPs request
+// instead of one request per action, as the modem's own web UI does.
+func WithMultipleHNAPs() Option {
+	return func(c *MotoClient) {
+		c.multipleHNAPs = true
+	}
+}
+
+// Lets GetStatus and GetConnectionInfo issue up to limit of their
+// independent requests concurrently, to cut latency on modems without
+// GetMultipleHNAPs. A limit below 2 issues them one at a time.
+func WithConcurrency(limit int) Option {
+	return func(c *MotoClient) {
+		c.concurrency = limit
+	}
+}
+
+// Returns a TLS configuration that only accepts a server certificate with the
+// given SHA-256 fingerprint. The fingerprint is hex encoded and may contain
+// colons, e.g. as printed by `openssl x509 -fingerprint -sha256`.
+//
+// This allows the modem's self-signed certificate to be pinned rather than
+// skipping verification entirely.
+func PinnedTLSConfig(fingerprint string) (*tls.Config, error) {
+	want, err := hex.DecodeString(strings.ReplaceAll(fingerprint, ":", ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate fingerprint: %w", err)
+	}
+	if len(want) != sha256.Size {
+		return nil, fmt.Errorf("invalid certificate fingerprint length: %d", len(want))
+	}
+
+	return &tls.Config{
+		// Verification of the chain is replaced by the fingerprint check below.
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return fmt.Errorf("no server certificate presented")
+			}
+			got := sha256.Sum256(rawCerts[0])
+			if !bytes.Equal(got[:], want) {
+				return fmt.Errorf("server certificate fingerprint mismatch: %X", got)
+			}
+			return nil
+		},
+	}, nil
+}
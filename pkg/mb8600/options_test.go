@@ -0,0 +1,257 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/mb8600test"
+)
+
+func TestNewMotoClient_options(t *testing.T) {
+	hc := &http.Client{}
+	tlsConfig := &tls.Config{ServerName: "modem"}
+
+	tests := []struct {
+		name  string
+		opts  []Option
+		check func(c *MotoClient) error
+	}{
+		{
+			"defaults",
+			nil,
+			func(c *MotoClient) error {
+				transport := c.client.Transport.(*http.Transport)
+				if !transport.TLSClientConfig.InsecureSkipVerify {
+					return fmt.Errorf("InsecureSkipVerify = false, want true")
+				}
+				return nil
+			},
+		},
+		{
+			"timeout",
+			[]Option{WithTimeout(5 * time.Second)},
+			func(c *MotoClient) error {
+				if c.client.Timeout != 5*time.Second {
+					return fmt.Errorf("Timeout = %v, want %v", c.client.Timeout, 5*time.Second)
+				}
+				return nil
+			},
+		},
+		{
+			"timeouts",
+			[]Option{WithTimeouts(Timeouts{Dial: time.Second, ResponseHeader: 20 * time.Second, Overall: time.Minute})},
+			func(c *MotoClient) error {
+				transport := c.client.Transport.(*http.Transport)
+				if transport.DialContext == nil {
+					return fmt.Errorf("DialContext = nil, want a dialer")
+				}
+				if transport.ResponseHeaderTimeout != 20*time.Second {
+					return fmt.Errorf("ResponseHeaderTimeout = %v, want %v", transport.ResponseHeaderTimeout, 20*time.Second)
+				}
+				if transport.TLSHandshakeTimeout != 0 {
+					return fmt.Errorf("TLSHandshakeTimeout = %v, want 0", transport.TLSHandshakeTimeout)
+				}
+				if c.client.Timeout != time.Minute {
+					return fmt.Errorf("Timeout = %v, want %v", c.client.Timeout, time.Minute)
+				}
+				if !transport.TLSClientConfig.InsecureSkipVerify {
+					return fmt.Errorf("InsecureSkipVerify = false, want true")
+				}
+				return nil
+			},
+		},
+		{
+			"invalid timeouts",
+			[]Option{WithTimeouts(Timeouts{Dial: -time.Second})},
+			func(c *MotoClient) error {
+				if c.Err() == nil {
+					return fmt.Errorf("Err() = nil, want error")
+				}
+				return nil
+			},
+		},
+		{
+			"tls config",
+			[]Option{WithTLSConfig(tlsConfig)},
+			func(c *MotoClient) error {
+				transport := c.client.Transport.(*http.Transport)
+				if transport.TLSClientConfig != tlsConfig {
+					return fmt.Errorf("TLSClientConfig = %v, want %v", transport.TLSClientConfig, tlsConfig)
+				}
+				return nil
+			},
+		},
+		{
+			"http client",
+			[]Option{WithHTTPClient(hc)},
+			func(c *MotoClient) error {
+				if c.client.Jar == nil {
+					return fmt.Errorf("Jar = nil, want a cookie jar")
+				}
+				if hc.Jar != nil {
+					return fmt.Errorf("supplied client was modified")
+				}
+				return nil
+			},
+		},
+		{
+			"timestamper",
+			[]Option{WithTimestamper(&MockTimestamper{Value: timestamp})},
+			func(c *MotoClient) error {
+				if got := c.timestamper.Timestamp(); got != timestamp {
+					return fmt.Errorf("Timestamp() = %v, want %v", got, timestamp)
+				}
+				return nil
+			},
+		},
+		{
+			"reserved header",
+			[]Option{WithHeader("hnap_auth", "x")},
+			func(c *MotoClient) error {
+				if c.Err() == nil {
+					return fmt.Errorf("Err() = nil, want error")
+				}
+				return nil
+			},
+		},
+		{
+			"empty soap namespace",
+			[]Option{WithSOAPNamespace("")},
+			func(c *MotoClient) error {
+				if c.Err() == nil {
+					return fmt.Errorf("Err() = nil, want error")
+				}
+				return nil
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewMotoClient(address, username, password, logger, tt.opts...)
+			if err := tt.check(c); err != nil {
+				t.Errorf("NewMotoClient() %v", err)
+			}
+		})
+	}
+}
+
+func TestWithTimeouts_responseHeader(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		wantErr bool
+	}{
+		{"slow modem", time.Second, false},
+		{"too slow", 10 * time.Millisecond, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewMotoClient(server.Listener.Addr().String(), username, password, logger,
+				WithTimeouts(Timeouts{Dial: time.Second, ResponseHeader: tt.timeout}))
+			if err := c.Ping(context.Background()); (err != nil) != tt.wantErr {
+				t.Errorf("MotoClient.Ping() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPinnedTLSConfig(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	sum := sha256.Sum256(server.Certificate().Raw)
+
+	tests := []struct {
+		name        string
+		fingerprint string
+		wantErr     bool
+		wantReqErr  bool
+	}{
+		{"match", fmt.Sprintf("%X", sum), false, false},
+		{"mismatch", fmt.Sprintf("%X", sha256.Sum256(nil)), false, true},
+		{"invalid", "zz", true, false},
+		{"short", "AB:CD", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := PinnedTLSConfig(tt.fingerprint)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PinnedTLSConfig() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+			resp, err := client.Get(server.URL)
+			if (err != nil) != tt.wantReqErr {
+				t.Errorf("Get() error = %v, wantReqErr %v", err, tt.wantReqErr)
+			}
+			if err == nil {
+				resp.Body.Close()
+			}
+		})
+	}
+}
+
+func TestWithHeaders(t *testing.T) {
+	const namespace = "http://example.com/HNAP1/"
+	modem := mb8600test.NewModem(username, password)
+	modem.Namespace = namespace
+
+	var header http.Header
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Clone()
+		modem.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	c := NewMotoClient(mb8600test.Address(server), username, password, logger,
+		WithUserAgent("mb8600-exporter/1.0"),
+		WithHeader("X-Forwarded-For", "10.0.0.2"),
+		WithSOAPNamespace(namespace))
+	if _, err := c.Login(); err != nil {
+		t.Fatalf("MotoClient.Login() error = %v", err)
+	}
+	if _, err := c.GetUpstreamChannels(); err != nil {
+		t.Fatalf("MotoClient.GetUpstreamChannels() error = %v", err)
+	}
+
+	for name, want := range map[string]string{
+		"User-Agent":      "mb8600-exporter/1.0",
+		"X-Forwarded-For": "10.0.0.2",
+		"SOAPAction":      namespace + "GetMotoStatusUpstreamChannelInfo",
+	} {
+		if got := header.Get(name); got != want {
+			t.Errorf("%s header = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package parquetexport writes modem snapshots as Parquet files using
+// github.com/xitongsys/parquet-go, keeping that dependency out of the core
+// mb8600 package.
+package parquetexport
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/thelande/mb8600/pkg/mb8600"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// A row of the downstream export. The columns match the CSV export,
+// preceded by the time of the snapshot.
+type downstreamRow struct {
+	Time              int64   `parquet:"name=time, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Channel           int32   `parquet:"name=channel, type=INT32"`
+	ChannelID         int32   `parquet:"name=channel_id, type=INT32"`
+	Kind              string  `parquet:"name=kind, type=BYTE_ARRAY, convertedtype=UTF8"`
+	LockStatus        string  `parquet:"name=lock_status, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Modulation        string  `parquet:"name=modulation, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Frequency         float64 `parquet:"name=frequency_mhz, type=DOUBLE"`
+	Power             float64 `parquet:"name=power_dbmv, type=DOUBLE"`
+	SignalToNoise     float64 `parquet:"name=snr_db, type=DOUBLE"`
+	CorrectedErrors   int64   `parquet:"name=corrected_errors, type=INT64"`
+	UncorrectedErrors int64   `parquet:"name=uncorrected_errors, type=INT64"`
+}
+
+// A row of the upstream export.
+type upstreamRow struct {
+	Time        int64   `parquet:"name=time, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Channel     int32   `parquet:"name=channel, type=INT32"`
+	ChannelID   int32   `parquet:"name=channel_id, type=INT32"`
+	Kind        string  `parquet:"name=kind, type=BYTE_ARRAY, convertedtype=UTF8"`
+	LockStatus  string  `parquet:"name=lock_status, type=BYTE_ARRAY, convertedtype=UTF8"`
+	ChannelType string  `parquet:"name=channel_type, type=BYTE_ARRAY, convertedtype=UTF8"`
+	SymbolRate  float64 `parquet:"name=symbol_rate_ksyms, type=DOUBLE"`
+	Frequency   float64 `parquet:"name=frequency_mhz, type=DOUBLE"`
+	Power       float64 `parquet:"name=power_dbmv, type=DOUBLE"`
+}
+
+// Writes the channels of the given direction in snapshots to w as a Parquet
+// file, one row per channel per snapshot.
+func Write(w io.Writer, snapshots []*mb8600.Snapshot, direction string) error {
+	var (
+		schema any
+		rows   []any
+	)
+	switch direction {
+	case mb8600.DirectionDownstream:
+		schema = new(downstreamRow)
+		for _, s := range snapshots {
+			for _, c := range s.Downstream {
+				rows = append(rows, downstreamRow{
+					Time:              s.Time.UnixMilli(),
+					Channel:           int32(c.Channel),
+					ChannelID:         int32(c.ChannelID),
+					Kind:              string(c.Kind()),
+					LockStatus:        c.LockStatus,
+					Modulation:        c.Modulation,
+					Frequency:         c.Frequency,
+					Power:             c.Power,
+					SignalToNoise:     c.SignalToNoise,
+					CorrectedErrors:   int64(c.CorrectedErrors),
+					UncorrectedErrors: int64(c.UncorrectedErrors),
+				})
+			}
+		}
+	case mb8600.DirectionUpstream:
+		schema = new(upstreamRow)
+		for _, s := range snapshots {
+			for _, c := range s.Upstream {
+				rows = append(rows, upstreamRow{
+					Time:        s.Time.UnixMilli(),
+					Channel:     int32(c.Channel),
+					ChannelID:   int32(c.ChannelID),
+					Kind:        string(c.Kind()),
+					LockStatus:  c.LockStatus,
+					ChannelType: c.ChannelType,
+					SymbolRate:  c.SymbolRate,
+					Frequency:   c.Frequency,
+					Power:       c.Power,
+				})
+			}
+		}
+	default:
+		return fmt.Errorf("invalid direction: %s", direction)
+	}
+
+	pw, err := writer.NewParquetWriterFromWriter(w, schema, 1)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := pw.Write(row); err != nil {
+			return err
+		}
+	}
+	return pw.WriteStop()
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package parquetexport
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/mb8600"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+// A file in memory for the Parquet reader.
+type bufferFile struct {
+	*bytes.Reader
+}
+
+func (f bufferFile) Write([]byte) (int, error)                 { return 0, os.ErrPermission }
+func (f bufferFile) Close() error                              { return nil }
+func (f bufferFile) Create(string) (source.ParquetFile, error) { return nil, os.ErrPermission }
+
+func (f bufferFile) Open(string) (source.ParquetFile, error) {
+	data := make([]byte, f.Size())
+	f.ReadAt(data, 0)
+	return bufferFile{bytes.NewReader(data)}, nil
+}
+
+func TestWrite(t *testing.T) {
+	now := time.Date(2023, 12, 23, 20, 0, 0, 0, time.UTC)
+	downstream := &mb8600.DownstreamChannel{
+		Channel: 1, ChannelID: 20, LockStatus: "Locked", Modulation: "QAM256",
+		Frequency: 531, Power: 2.8, SignalToNoise: 45.1, UncorrectedErrors: 42,
+	}
+	upstream := &mb8600.UpstreamChannel{
+		Channel: 1, ChannelID: 4, LockStatus: "Locked", ChannelType: "SC-QAM",
+		SymbolRate: 5120, Frequency: 35.6, Power: 56,
+	}
+	snapshots := []*mb8600.Snapshot{
+		{Time: now, Downstream: []*mb8600.DownstreamChannel{downstream}, Upstream: []*mb8600.UpstreamChannel{upstream}},
+		{Time: now.Add(time.Minute), Downstream: []*mb8600.DownstreamChannel{downstream}},
+	}
+
+	tests := []struct {
+		direction string
+		want      any
+		wantErr   bool
+	}{
+		{mb8600.DirectionDownstream, []downstreamRow{
+			{now.UnixMilli(), 1, 20, "SC-QAM", "Locked", "QAM256", 531, 2.8, 45.1, 0, 42},
+			{now.Add(time.Minute).UnixMilli(), 1, 20, "SC-QAM", "Locked", "QAM256", 531, 2.8, 45.1, 0, 42},
+		}, false},
+		{mb8600.DirectionUpstream, []upstreamRow{
+			{now.UnixMilli(), 1, 4, "SC-QAM", "Locked", "SC-QAM", 5120, 35.6, 56},
+		}, false},
+		{"sideways", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.direction, func(t *testing.T) {
+			var b bytes.Buffer
+			err := Write(&b, snapshots, tt.direction)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Write() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			typ := reflect.TypeOf(tt.want)
+			r, err := reader.NewParquetReader(bufferFile{bytes.NewReader(b.Bytes())}, reflect.New(typ.Elem()).Interface(), 1)
+			if err != nil {
+				t.Fatalf("NewParquetReader() error = %v", err)
+			}
+			defer r.ReadStop()
+			rows := reflect.New(typ)
+			rows.Elem().Set(reflect.MakeSlice(typ, int(r.GetNumRows()), int(r.GetNumRows())))
+			if err := r.Read(rows.Interface()); err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			if got := rows.Elem().Interface(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Write() rows = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"regexp"
+)
+
+var (
+	partialServiceRegexp = regexp.MustCompile(`(?i)partial service`)
+	upstreamRegexp       = regexp.MustCompile(`(?i)upstream|\bUS\b`)
+	downstreamRegexp     = regexp.MustCompile(`(?i)downstream|\bDS\b`)
+)
+
+// Whether the modem is in partial service, bonding fewer channels than it is
+// provisioned for, in either direction. The modem stays online in partial
+// service, but with reduced capacity, and usually recovers only once the
+// impairment causing it is fixed or the modem is restarted.
+type PartialService struct {
+	Downstream bool `json:"downstream"`
+	Upstream   bool `json:"upstream"`
+}
+
+// Returns true if the modem is in partial service in either direction.
+func (p PartialService) Any() bool {
+	return p.Downstream || p.Upstream
+}
+
+// Returns the partial service flagged in text, e.g. "Partial Service (US
+// only)". A flag naming no direction is taken as downstream, as in the
+// event code table.
+func partialServiceIn(text string) PartialService {
+	if !partialServiceRegexp.MatchString(text) {
+		return PartialService{}
+	}
+	p := PartialService{
+		Downstream: downstreamRegexp.MatchString(text),
+		Upstream:   upstreamRegexp.MatchString(text),
+	}
+	if !p.Any() {
+		p.Downstream = true
+	}
+	return p
+}
+
+// Returns the partial service the modem flags in the connectivity and boot
+// steps of its startup sequence.
+func (i *ConnectionInfo) PartialService() PartialService {
+	var p PartialService
+	for _, text := range []string{i.ConnectivityStatus, i.ConnectivityComment, i.BootStatus, i.BootComment} {
+		flagged := partialServiceIn(text)
+		p.Downstream = p.Downstream || flagged.Downstream
+		p.Upstream = p.Upstream || flagged.Upstream
+	}
+	return p
+}
+
+// Returns the partial service indicated by the event log, in the order the
+// modem reports it, newest first. A direction is in partial service if a
+// partial service event for it was logged after the modem last rebooted or
+// completed registration.
+//
+// The modem does not log leaving partial service without re-registering, so
+// prefer ConnectionInfo.PartialService where the firmware reports it.
+func PartialServiceFromLogs(entries []*LogEntry) PartialService {
+	var p PartialService
+	for _, entry := range entries {
+		switch entry.Code {
+		case EventRegistrationComplete, EventReboot, EventRebootPower:
+			return p
+		case EventDSPartialService:
+			p.Downstream = true
+		case EventUSPartialService:
+			p.Upstream = true
+		}
+	}
+	return p
+}
+
+// Returns the partial service flagged by the modem in its connection info or,
+// failing that, its event log.
+func (c *MotoClient) GetPartialService() (PartialService, error) {
+	info, err := c.GetConnectionInfo()
+	if err != nil {
+		return PartialService{}, err
+	}
+	if p := info.PartialService(); p.Any() {
+		return p, nil
+	}
+
+	entries, err := c.GetLogs()
+	if err != nil {
+		return PartialService{}, err
+	}
+	return PartialServiceFromLogs(entries), nil
+}
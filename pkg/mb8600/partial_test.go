@@ -0,0 +1,99 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"testing"
+
+	"github.com/thelande/mb8600/pkg/mb8600test"
+)
+
+func TestConnectionInfo_PartialService(t *testing.T) {
+	tests := []struct {
+		name string
+		info ConnectionInfo
+		want PartialService
+	}{
+		{"operational", ConnectionInfo{ConnectivityStatus: "OK", ConnectivityComment: "Operational"}, PartialService{}},
+		{"upstream", ConnectionInfo{ConnectivityStatus: "OK", ConnectivityComment: "Partial Service (US only)"}, PartialService{Upstream: true}},
+		{"downstream", ConnectionInfo{ConnectivityStatus: "Partial Service (DS only)"}, PartialService{Downstream: true}},
+		{"both", ConnectionInfo{BootComment: "Partial Service (DS+US)"}, PartialService{Downstream: true, Upstream: true}},
+		{"undirected", ConnectionInfo{ConnectivityComment: "partial service"}, PartialService{Downstream: true}},
+		{"separate steps", ConnectionInfo{ConnectivityComment: "Partial Service - Upstream", BootComment: "Partial Service - Downstream"}, PartialService{Downstream: true, Upstream: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.info.PartialService(); got != tt.want {
+				t.Errorf("ConnectionInfo.PartialService() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPartialServiceFromLogs(t *testing.T) {
+	entry := func(code EventCode) *LogEntry { return &LogEntry{Code: code} }
+
+	tests := []struct {
+		name    string
+		entries []*LogEntry
+		want    PartialService
+	}{
+		{"empty", nil, PartialService{}},
+		{"downstream", []*LogEntry{entry(EventT3Timeout), entry(EventDSPartialService)}, PartialService{Downstream: true}},
+		{"both", []*LogEntry{entry(EventUSPartialService), entry(EventDSPartialService)}, PartialService{Downstream: true, Upstream: true}},
+		{"registered since", []*LogEntry{entry(EventRegistrationComplete), entry(EventUSPartialService)}, PartialService{}},
+		{"rebooted since", []*LogEntry{entry(EventRebootPower), entry(EventDSPartialService)}, PartialService{}},
+		{"before reboot", []*LogEntry{entry(EventUSPartialService), entry(EventReboot), entry(EventDSPartialService)}, PartialService{Upstream: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PartialServiceFromLogs(tt.entries); got != tt.want {
+				t.Errorf("PartialServiceFromLogs() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMotoClient_GetPartialService(t *testing.T) {
+	modem := mb8600test.NewModem(username, password)
+	server := mb8600test.NewServer(modem)
+	defer server.Close()
+
+	c := NewMotoClient(mb8600test.Address(server), username, password, logger)
+	if _, err := c.Login(); err != nil {
+		t.Fatalf("MotoClient.Login() error = %v", err)
+	}
+
+	if got, err := c.GetPartialService(); err != nil || got.Any() {
+		t.Errorf("MotoClient.GetPartialService() = %+v, %v, want full service", got, err)
+	}
+
+	modem.SetResponse("GetMotoStatusLog", map[string]string{
+		"MotoStatusLogList": "   18:56:01  ^  Sun Dec 24 2023  ^3^Partial Service - Downstream^",
+	})
+	if got, err := c.GetPartialService(); err != nil || got != (PartialService{Downstream: true}) {
+		t.Errorf("MotoClient.GetPartialService() = %+v, %v, want downstream from the log", got, err)
+	}
+
+	modem.SetResponse("GetMotoStatusStartupSequence", map[string]string{
+		"MotoConnConnectivityStatus":  "OK",
+		"MotoConnConnectivityComment": "Partial Service (US only)",
+	})
+	if got, err := c.GetPartialService(); err != nil || got != (PartialService{Upstream: true}) {
+		t.Errorf("MotoClient.GetPartialService() = %+v, %v, want upstream from the connection info", got, err)
+	}
+}
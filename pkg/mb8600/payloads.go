@@ -0,0 +1,286 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An HNAP request and the raw response to it, captured by a PayloadRecorder
+// for a bug report. Secrets and identifiers are replaced before it is
+// recorded.
+type Payload struct {
+	Time     time.Time `json:"time"`
+	Action   string    `json:"action"`
+	Encoding Encoding  `json:"encoding"`
+	// The parameters of the request.
+	Request    map[string]string `json:"request,omitempty"`
+	StatusCode int               `json:"status_code"`
+	// The body of the response, as received.
+	Response string `json:"response"`
+	// The error decoding the response, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// Decodes the response as the client did, e.g. to reproduce a parsing
+// failure from a captured payload.
+func (p *Payload) Decode() (map[string]string, error) {
+	if p.Encoding == EncodingXML {
+		return decodeXMLResponse(p.Action, []byte(p.Response))
+	}
+	return decodeResponse(p.Action, []byte(p.Response))
+}
+
+// Receives the payloads captured with WithPayloadRecorder.
+type PayloadRecorder interface {
+	RecordPayload(p *Payload) error
+}
+
+// Fields whose values are replaced in captured payloads in addition to
+// redactedFields, as they would allow the password to be brute-forced from
+// the login exchange.
+var payloadSecretFields = []string{"Challenge", "PublicKey"}
+
+// Fields holding identifiers, replaced by pseudonyms in captured payloads.
+// MAC addresses elsewhere are replaced too.
+var payloadIdentifierFields = map[string]func(a *Anonymizer, value string) string{
+	"StatusSoftwareSerialNum": (*Anonymizer).Serial,
+	"Username":                (*Anonymizer).Username,
+}
+
+// Matches a field of a JSON or XML response body, capturing the name and
+// the value.
+var (
+	payloadJSONField = regexp.MustCompile(`"(\w+)"(\s*:\s*)"((?:[^"\\]|\\.)*)"`)
+	payloadXMLField  = regexp.MustCompile(`<(\w+)>([^<]*)</`)
+)
+
+// Replaces the secrets and identifiers of payloads. The pseudonyms are only
+// consistent within a capture.
+type payloadSanitizer struct {
+	anonymizer *Anonymizer
+}
+
+func newPayloadSanitizer() *payloadSanitizer {
+	key := make([]byte, 16)
+	rand.Read(key)
+	return &payloadSanitizer{anonymizer: NewAnonymizer(hex.EncodeToString(key))}
+}
+
+// Returns the replacement of a secret or identifier field, or value if the
+// field is neither.
+func (s *payloadSanitizer) field(name, value string) string {
+	if value == "" {
+		return value
+	}
+	if redactedFields[name] || slices.Contains(payloadSecretFields, name) {
+		return redactedValue
+	}
+	if pseudonym, ok := payloadIdentifierFields[name]; ok {
+		return pseudonym(s.anonymizer, value)
+	}
+	return value
+}
+
+// Returns a copy of the request parameters with their secrets and
+// identifiers replaced.
+func (s *payloadSanitizer) fields(fields map[string]string) map[string]string {
+	if fields == nil {
+		return nil
+	}
+	out := make(map[string]string, len(fields))
+	for name, value := range fields {
+		if replaced := s.field(name, value); replaced != value {
+			out[name] = replaced
+		} else {
+			out[name] = s.anonymizer.Text(value)
+		}
+	}
+	return out
+}
+
+// Returns the response body with its secrets and identifiers replaced,
+// leaving the structure intact so that it decodes as the original did.
+func (s *payloadSanitizer) body(body string) string {
+	body = payloadJSONField.ReplaceAllStringFunc(body, func(match string) string {
+		m := payloadJSONField.FindStringSubmatch(match)
+		return `"` + m[1] + `"` + m[2] + `"` + s.field(m[1], m[3]) + `"`
+	})
+	body = payloadXMLField.ReplaceAllStringFunc(body, func(match string) string {
+		m := payloadXMLField.FindStringSubmatch(match)
+		return "<" + m[1] + ">" + s.field(m[1], m[2]) + "</"
+	})
+	// Replaces the MAC and IP addresses in the remaining fields, and any
+	// outside of fields, e.g. in a malformed body.
+	return s.anonymizer.Text(body)
+}
+
+// Records a sanitized copy of an exchange, logging rather than failing the
+// request if the recorder does.
+func (c *MotoClient) recordPayload(action string, encoding Encoding, params map[string]string, statusCode int, body []byte, decodeErr error) {
+	p := &Payload{
+		Time:       c.now(),
+		Action:     action,
+		Encoding:   encoding,
+		Request:    c.payloadSanitizer.fields(params),
+		StatusCode: statusCode,
+		Response:   c.payloadSanitizer.body(string(body)),
+	}
+	if decodeErr != nil {
+		p.Error = c.payloadSanitizer.body(decodeErr.Error())
+	}
+	if err := c.payloadRecorder.RecordPayload(p); err != nil {
+		logWarn(c.Logger, "msg", "failed to record payload", "action", action, "err", err)
+	}
+}
+
+// A PayloadRecorder writing payloads to a file as JSON lines, to be attached
+// to a bug report and replayed with LoadPayloadFile.
+type PayloadFile struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// Creates the file at path, truncating it if it exists, and returns a
+// recorder writing to it.
+func CreatePayloadFile(path string) (*PayloadFile, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &PayloadFile{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+func (f *PayloadFile) RecordPayload(p *Payload) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.enc.Encode(p)
+}
+
+func (f *PayloadFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+// Reads payloads written by a PayloadFile.
+func ReadPayloads(r io.Reader) ([]*Payload, error) {
+	var payloads []*Payload
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var p Payload
+		if err := json.Unmarshal(scanner.Bytes(), &p); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		payloads = append(payloads, &p)
+	}
+	return payloads, scanner.Err()
+}
+
+// Reads the payloads of the file at path.
+func LoadPayloadFile(path string) ([]*Payload, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	payloads, err := ReadPayloads(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return payloads, nil
+}
+
+// Answers HNAP requests with captured payloads, so that a client using it
+// with WithTransport parses the responses of a user's modem without access
+// to it.
+//
+// The payloads of each action are replayed in the order they were captured,
+// the last one repeating once they run out. Requests for actions without
+// payloads are answered with 404 Not Found.
+type ReplayTransport struct {
+	mu       sync.Mutex
+	payloads map[string][]*Payload
+}
+
+// Returns a transport replaying payloads.
+func NewReplayTransport(payloads []*Payload) *ReplayTransport {
+	t := &ReplayTransport{payloads: make(map[string][]*Payload)}
+	for _, p := range payloads {
+		t.payloads[p.Action] = append(t.payloads[p.Action], p)
+	}
+	return t
+}
+
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	soapAction := strings.Trim(req.Header.Get("SOAPAction"), `"`)
+	action := soapAction[strings.LastIndex(soapAction, "/")+1:]
+
+	t.mu.Lock()
+	queue := t.payloads[action]
+	var p *Payload
+	if len(queue) > 0 {
+		p = queue[0]
+		if len(queue) > 1 {
+			t.payloads[action] = queue[1:]
+		}
+	}
+	t.mu.Unlock()
+
+	resp := &http.Response{
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Request:    req,
+	}
+	if p == nil {
+		resp.StatusCode = http.StatusNotFound
+		resp.Body = io.NopCloser(strings.NewReader(""))
+	} else {
+		resp.StatusCode = p.StatusCode
+		resp.Body = io.NopCloser(strings.NewReader(p.Response))
+		resp.ContentLength = int64(len(p.Response))
+		if p.Encoding == EncodingXML {
+			resp.Header.Set("Content-Type", "text/xml; charset=utf-8")
+		} else {
+			resp.Header.Set("Content-Type", "application/json")
+		}
+	}
+	resp.Status = fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	return resp, nil
+}
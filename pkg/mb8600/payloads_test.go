@@ -0,0 +1,165 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/thelande/mb8600/pkg/mb8600test"
+)
+
+func TestMotoClient_WithPayloadRecorder(t *testing.T) {
+	modem := mb8600test.NewModem(username, password)
+	server := mb8600test.NewServer(modem)
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "payloads.jsonl")
+	file, err := CreatePayloadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewMotoClient(mb8600test.Address(server), username, password, logger, WithPayloadRecorder(file))
+	if _, err := c.Login(); err != nil {
+		t.Fatalf("MotoClient.Login() error = %v", err)
+	}
+	wantDownstream, err := c.GetDownstreamChannels()
+	if err != nil {
+		t.Fatalf("MotoClient.GetDownstreamChannels() error = %v", err)
+	}
+	wantSoftware, err := c.GetSoftwareStatus()
+	if err != nil {
+		t.Fatalf("MotoClient.GetSoftwareStatus() error = %v", err)
+	}
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, _ := c.GetPrivateKey()
+	for _, secret := range []string{password, privateKey, "00:11:22:33:44:55", "2018123456789", `"admin"`} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("captured payloads contain %q", secret)
+		}
+	}
+
+	payloads, err := LoadPayloadFile(path)
+	if err != nil {
+		t.Fatalf("LoadPayloadFile() error = %v", err)
+	}
+	var actions []string
+	for _, p := range payloads {
+		actions = append(actions, p.Action)
+	}
+	want := []string{"Login", "Login", "GetMotoStatusDownstreamChannelInfo", "GetMotoStatusSoftware"}
+	if !reflect.DeepEqual(actions, want) {
+		t.Fatalf("captured actions = %v, want %v", actions, want)
+	}
+	if got := payloads[1].Request["LoginPassword"]; got != redactedValue {
+		t.Errorf("captured LoginPassword = %q, want %q", got, redactedValue)
+	}
+
+	// Replaying the capture parses the same channels without the modem.
+	replay := NewMotoClient("192.0.2.1", username, password, logger, WithTransport(NewReplayTransport(payloads)))
+	if _, err := replay.Login(); err != nil {
+		t.Fatalf("replayed MotoClient.Login() error = %v", err)
+	}
+	got, err := replay.GetDownstreamChannels()
+	if err != nil {
+		t.Fatalf("replayed MotoClient.GetDownstreamChannels() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, wantDownstream) {
+		t.Errorf("replayed MotoClient.GetDownstreamChannels() = %v, want %v", got, wantDownstream)
+	}
+	software, err := replay.GetSoftwareStatus()
+	if err != nil {
+		t.Fatalf("replayed MotoClient.GetSoftwareStatus() error = %v", err)
+	}
+	if software.MACAddress == wantSoftware.MACAddress || software.SerialNumber == wantSoftware.SerialNumber {
+		t.Errorf("replayed software status = %+v, want pseudonyms", software)
+	}
+	if software.SoftwareVersion != wantSoftware.SoftwareVersion {
+		t.Errorf("replayed SoftwareVersion = %q, want %q", software.SoftwareVersion, wantSoftware.SoftwareVersion)
+	}
+}
+
+func TestPayloadSanitizer_body(t *testing.T) {
+	s := &payloadSanitizer{anonymizer: NewAnonymizer("secret")}
+	tests := []struct {
+		name, body string
+		absent     []string
+	}{
+		{
+			name:   "json",
+			body:   `{"LoginResponse":{"Challenge":"abc","PublicKey":"def","Cookie":"123","LoginResult":"OK"}}`,
+			absent: []string{"abc", "def", "123"},
+		},
+		{
+			name:   "xml",
+			body:   `<GetMotoStatusSoftwareResponse><StatusSoftwareMac>00:11:22:33:44:55</StatusSoftwareMac><StatusSoftwareSerialNum>2018123456789</StatusSoftwareSerialNum></GetMotoStatusSoftwareResponse>`,
+			absent: []string{"00:11:22:33:44:55", "2018123456789"},
+		},
+		{
+			name:   "malformed",
+			body:   `{"GetMotoStatusSoftwareResponse":{"StatusSoftwareMac":"00:11:22:33:44:55",`,
+			absent: []string{"00:11:22:33:44:55"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := s.body(tt.body)
+			for _, value := range tt.absent {
+				if strings.Contains(got, value) {
+					t.Errorf("payloadSanitizer.body() = %s, contains %q", got, value)
+				}
+			}
+		})
+	}
+}
+
+func TestPayload_Decode(t *testing.T) {
+	payloads, err := ReadPayloads(strings.NewReader(`{"action":"GetMotoStatusSoftware","encoding":"json","status_code":200,"response":"{\"GetMotoStatusSoftwareResponse\":"}
+
+{"action":"GetMotoStatusSoftware","encoding":"json","status_code":200,"response":"{\"GetMotoStatusSoftwareResponse\":{\"StatusSoftwareSfVer\":\"8600-19.3.18\"}}"}
+`))
+	if err != nil {
+		t.Fatalf("ReadPayloads() error = %v", err)
+	}
+	if len(payloads) != 2 {
+		t.Fatalf("ReadPayloads() = %d payloads, want 2", len(payloads))
+	}
+	if _, err := payloads[0].Decode(); err == nil {
+		t.Errorf("Payload.Decode() of a truncated response error = nil, want error")
+	}
+	got, err := payloads[1].Decode()
+	if err != nil {
+		t.Fatalf("Payload.Decode() error = %v", err)
+	}
+	if got["StatusSoftwareSfVer"] != "8600-19.3.18" {
+		t.Errorf("Payload.Decode() = %v", got)
+	}
+
+	if _, err := ReadPayloads(strings.NewReader("{\n")); err == nil {
+		t.Errorf("ReadPayloads() of invalid JSON error = nil, want error")
+	}
+}
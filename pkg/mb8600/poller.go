@@ -0,0 +1,531 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	eventBufferSize = 64
+
+	DirectionDownstream = "downstream"
+	DirectionUpstream   = "upstream"
+)
+
+type EventType string
+
+const (
+	// A channel that was locked is no longer locked or is no longer reported.
+	ChannelLostLock EventType = "ChannelLostLock"
+	// A channel that was not locked is now locked.
+	ChannelRelocked EventType = "ChannelRelocked"
+	// A downstream channel's uncorrected error counter increased.
+	UncorrectedErrorsIncreased EventType = "UncorrectedErrorsIncreased"
+	// The modem's uptime or error counters went backwards, indicating a
+	// reboot, as detected by Compare. Current holds the uptime in seconds if
+	// it is known.
+	ModemRebooted EventType = "ModemRebooted"
+	// The modem could not be polled.
+	ModemUnreachable EventType = "ModemUnreachable"
+	// The modem could be polled again after being unreachable.
+	ModemReachable EventType = "ModemReachable"
+	// The connectivity state reported by the modem changed, e.g. from "OK" to
+	// "DHCP".
+	ConnectivityStateChanged EventType = "ConnectivityStateChanged"
+	// The number of locked upstream channels changed, e.g. from 4 to 2 when
+	// the modem falls back to partial upstream service. Previous and Current
+	// hold the counts.
+	UpstreamChannelCountChanged EventType = "UpstreamChannelCountChanged"
+	// The modem entered or left partial service in Direction. PreviousState
+	// and CurrentState are PartialServiceFull or PartialServiceActive.
+	PartialServiceChanged EventType = "PartialServiceChanged"
+	// A channel metric moved away from its recent values, as flagged by a
+	// SnapshotObserver such as anomaly.Detector. Metric names the metric,
+	// Previous holds its baseline, Current its value and Score how unusual
+	// the value is.
+	ChannelAnomaly EventType = "ChannelAnomaly"
+)
+
+// The states of a PartialServiceChanged event.
+const (
+	PartialServiceFull   = "full"
+	PartialServiceActive = "partial"
+)
+
+// A change detected between two polls.
+type Event struct {
+	Type      EventType `json:"type"`
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction,omitempty"`
+	ChannelID int       `json:"channel_id,omitempty"`
+	// The previous and current values of a change. Zero is a valid value,
+	// e.g. when no upstream channels remain locked, so they are always
+	// encoded.
+	Previous float64 `json:"previous"`
+	Current  float64 `json:"current"`
+	// The previous and current states of a state change.
+	PreviousState string `json:"previous_state,omitempty"`
+	CurrentState  string `json:"current_state,omitempty"`
+	// The metric and score of a ChannelAnomaly event.
+	Metric string  `json:"metric,omitempty"`
+	Score  float64 `json:"score,omitempty"`
+	Err    error   `json:"-"`
+}
+
+// The data gathered by a single poll.
+type Snapshot struct {
+	Time       time.Time            `json:"time"`
+	Downstream []*DownstreamChannel `json:"downstream"`
+	Upstream   []*UpstreamChannel   `json:"upstream"`
+	// How the channel data of this poll parsed, if the client reports it.
+	ParseStats *ParseStats `json:"parse_stats,omitempty"`
+	// The connection state, if the client reports it.
+	Connection *ConnectionInfo `json:"connection,omitempty"`
+	// The partial service flagged in the connection state, if the client
+	// reports it.
+	PartialService *PartialService `json:"partial_service,omitempty"`
+}
+
+// Returns the number of locked upstream channels.
+func (s *Snapshot) LockedUpstreamChannels() int {
+	return len(FilterLockedUpstream(s.Upstream))
+}
+
+// The client methods used by the Poller.
+type PollerClient interface {
+	Login() (map[string]string, error)
+	GetDownstreamChannels() ([]*DownstreamChannel, error)
+	GetUpstreamChannels() ([]*UpstreamChannel, error)
+}
+
+// Keeps the snapshots taken by a Poller, e.g. a history.Store.
+type SnapshotRecorder interface {
+	Append(snapshot *Snapshot) error
+}
+
+// Inspects the snapshots taken by a Poller and returns events of its own,
+// e.g. anomaly.Detector.
+type SnapshotObserver interface {
+	ObserveSnapshot(snapshot *Snapshot) []Event
+}
+
+// Periodically polls the modem and emits events describing changes between
+// polls.
+type Poller struct {
+	client   PollerClient
+	interval time.Duration
+	logger   Logger
+	events   chan Event
+	now      func() time.Time
+	recorder SnapshotRecorder
+	observer SnapshotObserver
+	onDemand bool
+	requests chan struct{}
+
+	mu           sync.RWMutex
+	last         *Snapshot
+	lastErr      error
+	pending      *pollRequest
+	connectivity string
+
+	// Serializes polls, guarding the session state below.
+	pollMu      sync.Mutex
+	loggedIn    bool
+	unreachable bool
+}
+
+// A poll requested by Refresh, shared by the callers waiting for it.
+type pollRequest struct {
+	done     chan struct{}
+	snapshot *Snapshot
+	err      error
+}
+
+// Returns a new Poller that polls client every interval.
+func NewPoller(client PollerClient, interval time.Duration, logger Logger) *Poller {
+	return &Poller{
+		client:   client,
+		interval: interval,
+		logger:   logger,
+		events:   make(chan Event, eventBufferSize),
+		now:      time.Now,
+		requests: make(chan struct{}, 1),
+	}
+}
+
+// Makes Run poll only at start and when Refresh is called, rather than every
+// interval, e.g. to poll the modem when Prometheus scrapes. Must be called
+// before Run.
+func (p *Poller) PollOnDemand() {
+	p.onDemand = true
+}
+
+// Appends every successful snapshot to recorder. Must be called before Run.
+func (p *Poller) RecordTo(recorder SnapshotRecorder) {
+	p.recorder = recorder
+}
+
+// Adds the events observer returns for every successful snapshot to those of
+// the poll. Must be called before Run.
+func (p *Poller) ObserveWith(observer SnapshotObserver) {
+	p.observer = observer
+}
+
+// Returns the channel events are delivered on. It is closed when Run returns.
+func (p *Poller) Events() <-chan Event {
+	return p.events
+}
+
+// Returns the most recent successful snapshot, or nil if there is none. It is
+// safe to call while Run is active.
+func (p *Poller) Last() *Snapshot {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.last
+}
+
+// Returns the error of the latest poll by Run, or nil if it succeeded. It is
+// safe to call while Run is active.
+func (p *Poller) Err() error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.lastErr
+}
+
+// Has Run poll the modem and returns the snapshot taken, or the error of the
+// poll. Callers arriving while a requested poll is pending share it. Blocks
+// until the poll is done or ctx is cancelled, so Run must be active.
+func (p *Poller) Refresh(ctx context.Context) (*Snapshot, error) {
+	p.mu.Lock()
+	request := p.pending
+	if request == nil {
+		request = &pollRequest{done: make(chan struct{})}
+		p.pending = request
+		select {
+		case p.requests <- struct{}{}:
+		default:
+		}
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-request.done:
+		return request.snapshot, request.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Returns the last connectivity state reported by the modem, or an empty
+// string if the client does not report it. It is safe to call while Run is
+// active.
+func (p *Poller) ConnectivityState() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.connectivity
+}
+
+// Polls immediately and then every interval, or on request if PollOnDemand
+// was called, until ctx is cancelled, sending events on the Events channel.
+// Blocks if the events are not consumed.
+func (p *Poller) Run(ctx context.Context) error {
+	defer close(p.events)
+
+	// A nil channel never fires, so on demand only requests trigger polls.
+	var tick <-chan time.Time
+	if !p.onDemand {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		// Requests arriving during the poll wait for the next one, so every
+		// caller of Refresh gets a snapshot taken after it asked.
+		p.mu.Lock()
+		request := p.pending
+		p.pending = nil
+		select {
+		case <-p.requests:
+		default:
+		}
+		p.mu.Unlock()
+
+		events, err := p.pollRecover()
+		if err != nil {
+			logWarn(p.logger, "msg", "poll failed", "err", err)
+		}
+		p.mu.Lock()
+		p.lastErr = err
+		p.mu.Unlock()
+		if request != nil {
+			if err == nil {
+				request.snapshot = p.Last()
+			}
+			request.err = err
+			close(request.done)
+		}
+
+		for _, event := range events {
+			select {
+			case p.events <- event:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		select {
+		case <-tick:
+		case <-p.requests:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Polls once, returning a panic in the client as an error so that a single
+// malformed response does not stop polling.
+func (p *Poller) pollRecover() (events []Event, err error) {
+	p.pollMu.Lock()
+	defer p.pollMu.Unlock()
+	defer func() {
+		if r := recover(); r != nil {
+			p.loggedIn = false
+			err = fmt.Errorf("poll panicked: %v", r)
+		}
+	}()
+	return p.poll()
+}
+
+// Polls the modem once, logging in if needed, and returns the events
+// describing changes since the previous successful poll. It is safe to call
+// while Run is active; the polls are taken one at a time.
+func (p *Poller) Poll() ([]Event, error) {
+	p.pollMu.Lock()
+	defer p.pollMu.Unlock()
+	return p.poll()
+}
+
+// Polls once. The caller must hold pollMu.
+func (p *Poller) poll() ([]Event, error) {
+	now := p.now()
+
+	snapshot, err := p.snapshot(now)
+	if err != nil {
+		p.loggedIn = false
+		if p.unreachable {
+			return nil, err
+		}
+		p.unreachable = true
+		return []Event{{Type: ModemUnreachable, Time: now, Err: err}}, err
+	}
+
+	var events []Event
+	if p.unreachable {
+		p.unreachable = false
+		events = append(events, Event{Type: ModemReachable, Time: now})
+	}
+
+	if last := p.Last(); last != nil {
+		events = append(events, diffSnapshots(last, snapshot)...)
+	}
+
+	p.mu.Lock()
+	p.last = snapshot
+	// The last known state is kept when a poll fails to report it.
+	if snapshot.Connection != nil {
+		state := snapshot.Connection.ConnectivityState()
+		if p.connectivity != "" && state != p.connectivity {
+			events = append(events, Event{
+				Type:          ConnectivityStateChanged,
+				Time:          now,
+				PreviousState: p.connectivity,
+				CurrentState:  state,
+			})
+		}
+		p.connectivity = state
+	}
+	p.mu.Unlock()
+
+	if p.recorder != nil {
+		if err := p.recorder.Append(snapshot); err != nil {
+			logWarn(p.logger, "msg", "unable to record snapshot", "err", err)
+		}
+	}
+	if p.observer != nil {
+		events = append(events, p.observer.ObserveSnapshot(snapshot)...)
+	}
+	return events, nil
+}
+
+func (p *Poller) snapshot(now time.Time) (*Snapshot, error) {
+	if !p.loggedIn {
+		if _, err := p.client.Login(); err != nil {
+			return nil, err
+		}
+		p.loggedIn = true
+	}
+
+	statser, hasStats := p.client.(interface{ ParseStats() ParseStats })
+	var before ParseStats
+	if hasStats {
+		before = statser.ParseStats()
+	}
+
+	downstream, err := p.client.GetDownstreamChannels()
+	if err != nil {
+		return nil, err
+	}
+
+	upstream, err := p.client.GetUpstreamChannels()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &Snapshot{Time: now, Downstream: downstream, Upstream: upstream}
+	if hasStats {
+		stats := statser.ParseStats().Sub(before)
+		snapshot.ParseStats = &stats
+	}
+
+	if connector, ok := p.client.(interface {
+		GetConnectionInfo() (*ConnectionInfo, error)
+	}); ok {
+		info, err := connector.GetConnectionInfo()
+		if err != nil {
+			logDebug(p.logger, "msg", "unable to get connection info", "err", err)
+		}
+		snapshot.Connection = info
+		if info != nil {
+			partial := info.PartialService()
+			snapshot.PartialService = &partial
+		}
+	}
+	return snapshot, nil
+}
+
+func diffSnapshots(prev, curr *Snapshot) []Event {
+	var events []Event
+
+	prevDown := map[int]*DownstreamChannel{}
+	for _, ch := range prev.Downstream {
+		prevDown[ch.ChannelID] = ch
+	}
+
+	reboot := Compare(prev, curr).Reboot
+	rebooted := reboot != nil
+	if rebooted {
+		events = append(events, Event{
+			Type:    ModemRebooted,
+			Time:    curr.Time,
+			Current: reboot.Uptime.Seconds(),
+		})
+	}
+
+	currDown := map[int]bool{}
+	for _, ch := range curr.Downstream {
+		currDown[ch.ChannelID] = true
+		old, ok := prevDown[ch.ChannelID]
+		if !ok {
+			continue
+		}
+
+		events = append(events, lockEvents(curr.Time, DirectionDownstream, ch.ChannelID, old.LockStatus, ch.LockStatus)...)
+		if !rebooted && ch.UncorrectedErrors > old.UncorrectedErrors {
+			events = append(events, Event{
+				Type:      UncorrectedErrorsIncreased,
+				Time:      curr.Time,
+				Direction: DirectionDownstream,
+				ChannelID: ch.ChannelID,
+				Previous:  old.UncorrectedErrors,
+				Current:   ch.UncorrectedErrors,
+			})
+		}
+	}
+	for _, ch := range prev.Downstream {
+		if !currDown[ch.ChannelID] {
+			events = append(events, lockEvents(curr.Time, DirectionDownstream, ch.ChannelID, ch.LockStatus, "")...)
+		}
+	}
+
+	prevUp := map[int]*UpstreamChannel{}
+	for _, ch := range prev.Upstream {
+		prevUp[ch.ChannelID] = ch
+	}
+	currUp := map[int]bool{}
+	for _, ch := range curr.Upstream {
+		currUp[ch.ChannelID] = true
+		if old, ok := prevUp[ch.ChannelID]; ok {
+			events = append(events, lockEvents(curr.Time, DirectionUpstream, ch.ChannelID, old.LockStatus, ch.LockStatus)...)
+		}
+	}
+	for _, ch := range prev.Upstream {
+		if !currUp[ch.ChannelID] {
+			events = append(events, lockEvents(curr.Time, DirectionUpstream, ch.ChannelID, ch.LockStatus, "")...)
+		}
+	}
+	if prevLocked, currLocked := prev.LockedUpstreamChannels(), curr.LockedUpstreamChannels(); prevLocked != currLocked {
+		events = append(events, Event{
+			Type:      UpstreamChannelCountChanged,
+			Time:      curr.Time,
+			Direction: DirectionUpstream,
+			Previous:  float64(prevLocked),
+			Current:   float64(currLocked),
+		})
+	}
+	if prev.PartialService != nil && curr.PartialService != nil {
+		events = append(events, partialServiceEvents(curr.Time, DirectionDownstream, prev.PartialService.Downstream, curr.PartialService.Downstream)...)
+		events = append(events, partialServiceEvents(curr.Time, DirectionUpstream, prev.PartialService.Upstream, curr.PartialService.Upstream)...)
+	}
+
+	return events
+}
+
+// Returns a PartialServiceChanged event if the partial service in direction
+// changed from prev to curr.
+func partialServiceEvents(t time.Time, direction string, prev, curr bool) []Event {
+	if prev == curr {
+		return nil
+	}
+	state := func(partial bool) string {
+		if partial {
+			return PartialServiceActive
+		}
+		return PartialServiceFull
+	}
+	return []Event{{
+		Type:          PartialServiceChanged,
+		Time:          t,
+		Direction:     direction,
+		PreviousState: state(prev),
+		CurrentState:  state(curr),
+	}}
+}
+
+func lockEvents(t time.Time, direction string, channelID int, prev, curr string) []Event {
+	wasLocked, isLocked := prev == "Locked", curr == "Locked"
+	switch {
+	case wasLocked && !isLocked:
+		return []Event{{Type: ChannelLostLock, Time: t, Direction: direction, ChannelID: channelID}}
+	case !wasLocked && isLocked:
+		return []Event{{Type: ChannelRelocked, Time: t, Direction: direction, ChannelID: channelID}}
+	}
+	return nil
+}
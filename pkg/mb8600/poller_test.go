@@ -0,0 +1,509 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+type fakePollerClient struct {
+	downstream []*DownstreamChannel
+	upstream   []*UpstreamChannel
+	err        error
+	logins     int
+}
+
+func (f *fakePollerClient) Login() (map[string]string, error) {
+	f.logins++
+	return map[string]string{"LoginResult": "OK"}, f.err
+}
+
+func (f *fakePollerClient) GetDownstreamChannels() ([]*DownstreamChannel, error) {
+	return f.downstream, f.err
+}
+
+func (f *fakePollerClient) GetUpstreamChannels() ([]*UpstreamChannel, error) {
+	return f.upstream, f.err
+}
+
+func eventTypes(events []Event) []EventType {
+	var types []EventType
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func TestPoller_Poll(t *testing.T) {
+	locked := &DownstreamChannel{ChannelID: 20, LockStatus: "Locked", CorrectedErrors: 10, UncorrectedErrors: 5}
+	errorsUp := &DownstreamChannel{ChannelID: 20, LockStatus: "Locked", CorrectedErrors: 10, UncorrectedErrors: 8}
+	unlocked := &DownstreamChannel{ChannelID: 20, LockStatus: "Not Locked", CorrectedErrors: 10, UncorrectedErrors: 5}
+	reset := &DownstreamChannel{ChannelID: 20, LockStatus: "Locked"}
+	up := &UpstreamChannel{ChannelID: 4, LockStatus: "Locked"}
+	upUnlocked := &UpstreamChannel{ChannelID: 4, LockStatus: "Not Locked"}
+
+	tests := []struct {
+		name string
+		prev *fakePollerClient
+		curr *fakePollerClient
+		want []EventType
+	}{
+		{
+			"no change",
+			&fakePollerClient{downstream: []*DownstreamChannel{locked}},
+			&fakePollerClient{downstream: []*DownstreamChannel{locked}},
+			nil,
+		},
+		{
+			"lost lock",
+			&fakePollerClient{downstream: []*DownstreamChannel{locked}},
+			&fakePollerClient{downstream: []*DownstreamChannel{unlocked}},
+			[]EventType{ChannelLostLock},
+		},
+		{
+			"relocked",
+			&fakePollerClient{downstream: []*DownstreamChannel{unlocked}},
+			&fakePollerClient{downstream: []*DownstreamChannel{locked}},
+			[]EventType{ChannelRelocked},
+		},
+		{
+			"upstream removed",
+			&fakePollerClient{upstream: []*UpstreamChannel{up}},
+			&fakePollerClient{},
+			[]EventType{ChannelLostLock, UpstreamChannelCountChanged},
+		},
+		{
+			"upstream relocked",
+			&fakePollerClient{upstream: []*UpstreamChannel{upUnlocked}},
+			&fakePollerClient{upstream: []*UpstreamChannel{up}},
+			[]EventType{ChannelRelocked, UpstreamChannelCountChanged},
+		},
+		{
+			"uncorrected increased",
+			&fakePollerClient{downstream: []*DownstreamChannel{locked}},
+			&fakePollerClient{downstream: []*DownstreamChannel{errorsUp}},
+			[]EventType{UncorrectedErrorsIncreased},
+		},
+		{
+			"rebooted",
+			&fakePollerClient{downstream: []*DownstreamChannel{errorsUp}},
+			&fakePollerClient{downstream: []*DownstreamChannel{reset}},
+			[]EventType{ModemRebooted},
+		},
+		{
+			"unreachable",
+			&fakePollerClient{downstream: []*DownstreamChannel{locked}},
+			&fakePollerClient{err: fmt.Errorf("timeout")},
+			[]EventType{ModemUnreachable},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPoller(tt.prev, time.Minute, logger)
+			if events, err := p.Poll(); err != nil || len(events) != 0 {
+				t.Fatalf("Poller.Poll() = %v, %v, want no events", events, err)
+			}
+
+			p.client = tt.curr
+			events, _ := p.Poll()
+			if got := eventTypes(events); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Poller.Poll() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffSnapshots_reboot(t *testing.T) {
+	channel := func(id int, corrected, uncorrected float64) *DownstreamChannel {
+		return &DownstreamChannel{ChannelID: id, LockStatus: "Locked", CorrectedErrors: corrected, UncorrectedErrors: uncorrected}
+	}
+	uptime := func(d time.Duration) *ConnectionInfo { return &ConnectionInfo{Uptime: d} }
+
+	tests := []struct {
+		name       string
+		prev, curr *Snapshot
+		want       []EventType
+	}{
+		{
+			"channel dropped out",
+			&Snapshot{Downstream: []*DownstreamChannel{channel(1, 100, 50), channel(2, 10, 5)}},
+			&Snapshot{Downstream: []*DownstreamChannel{channel(2, 10, 7)}},
+			[]EventType{UncorrectedErrorsIncreased, ChannelLostLock},
+		},
+		{
+			"counters reset",
+			&Snapshot{Downstream: []*DownstreamChannel{channel(1, 100, 50), channel(2, 0, 0)}},
+			&Snapshot{Downstream: []*DownstreamChannel{channel(1, 1, 0), channel(2, 0, 0)}},
+			[]EventType{ModemRebooted},
+		},
+		{
+			"one channel decreased",
+			&Snapshot{Downstream: []*DownstreamChannel{channel(1, 100, 50), channel(2, 10, 5)}},
+			&Snapshot{Downstream: []*DownstreamChannel{channel(1, 1, 0), channel(2, 10, 6)}},
+			[]EventType{UncorrectedErrorsIncreased},
+		},
+		{
+			"uptime decreased",
+			&Snapshot{Downstream: []*DownstreamChannel{channel(1, 100, 50)}, Connection: uptime(time.Hour)},
+			&Snapshot{Downstream: []*DownstreamChannel{channel(1, 100, 50)}, Connection: uptime(time.Minute)},
+			[]EventType{ModemRebooted},
+		},
+		{
+			"counters cleared",
+			&Snapshot{Downstream: []*DownstreamChannel{channel(1, 100, 50)}, Connection: uptime(time.Hour)},
+			&Snapshot{Downstream: []*DownstreamChannel{channel(1, 0, 0)}, Connection: uptime(2 * time.Hour)},
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := eventTypes(diffSnapshots(tt.prev, tt.curr)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffSnapshots() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnapshot_LockedUpstreamChannels(t *testing.T) {
+	s := &Snapshot{Upstream: []*UpstreamChannel{
+		{ChannelID: 1, LockStatus: "Locked"},
+		{ChannelID: 2, LockStatus: "Not Locked"},
+		{ChannelID: 3, LockStatus: "Locked"},
+	}}
+	if got := s.LockedUpstreamChannels(); got != 2 {
+		t.Errorf("Snapshot.LockedUpstreamChannels() = %v, want 2", got)
+	}
+
+	events := diffSnapshots(s, &Snapshot{Upstream: s.Upstream[:1]})
+	want := Event{Type: UpstreamChannelCountChanged, Direction: DirectionUpstream, Previous: 2, Current: 1}
+	if len(events) == 0 || !reflect.DeepEqual(events[len(events)-1], want) {
+		t.Errorf("diffSnapshots() = %+v, want last event %+v", events, want)
+	}
+}
+
+func TestPoller_reachability(t *testing.T) {
+	client := &fakePollerClient{err: fmt.Errorf("timeout")}
+	p := NewPoller(client, time.Minute, logger)
+
+	for _, want := range [][]EventType{{ModemUnreachable}, nil} {
+		events, err := p.Poll()
+		if err == nil {
+			t.Errorf("Poller.Poll() error = nil, want error")
+		}
+		if got := eventTypes(events); !reflect.DeepEqual(got, want) {
+			t.Errorf("Poller.Poll() = %v, want %v", got, want)
+		}
+	}
+
+	client.err = nil
+	events, err := p.Poll()
+	if err != nil {
+		t.Fatalf("Poller.Poll() error = %v", err)
+	}
+	if got := eventTypes(events); !reflect.DeepEqual(got, []EventType{ModemReachable}) {
+		t.Errorf("Poller.Poll() = %v, want %v", got, []EventType{ModemReachable})
+	}
+	if client.logins != 3 {
+		t.Errorf("logins = %v, want %v", client.logins, 3)
+	}
+}
+
+// Returns an event per snapshot observed, counting them in Current.
+type fakeObserver struct {
+	observed int
+}
+
+func (f *fakeObserver) ObserveSnapshot(snapshot *Snapshot) []Event {
+	f.observed++
+	return []Event{{Type: ChannelAnomaly, Time: snapshot.Time, Current: float64(f.observed)}}
+}
+
+func TestPoller_ObserveWith(t *testing.T) {
+	client := &fakePollerClient{err: fmt.Errorf("timeout")}
+	p := NewPoller(client, time.Minute, logger)
+	observer := &fakeObserver{}
+	p.ObserveWith(observer)
+
+	if _, err := p.Poll(); err == nil {
+		t.Fatalf("Poller.Poll() error = nil, want error")
+	}
+	client.err = nil
+	events, err := p.Poll()
+	if err != nil {
+		t.Fatalf("Poller.Poll() error = %v", err)
+	}
+	if want := []EventType{ModemReachable, ChannelAnomaly}; !reflect.DeepEqual(eventTypes(events), want) {
+		t.Errorf("Poller.Poll() = %v, want %v", eventTypes(events), want)
+	}
+	if observer.observed != 1 {
+		t.Errorf("observed snapshots = %v, want 1, failed polls are not observed", observer.observed)
+	}
+}
+
+func TestPoller_Run(t *testing.T) {
+	ignore := goleak.IgnoreCurrent()
+	t.Cleanup(func() { goleak.VerifyNone(t, ignore) })
+	client := &fakePollerClient{err: fmt.Errorf("timeout")}
+	p := NewPoller(client, time.Millisecond, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- p.Run(ctx) }()
+
+	event := <-p.Events()
+	if event.Type != ModemUnreachable {
+		t.Errorf("event.Type = %v, want %v", event.Type, ModemUnreachable)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Poller.Run() error = %v, want %v", err, context.Canceled)
+	}
+	if _, ok := <-p.Events(); ok {
+		t.Errorf("Poller.Events() not closed after Run returned")
+	}
+}
+
+func TestPoller_Poll_concurrent(t *testing.T) {
+	ignore := goleak.IgnoreCurrent()
+	t.Cleanup(func() { goleak.VerifyNone(t, ignore) })
+	client := &fakePollerClient{err: fmt.Errorf("timeout")}
+	p := NewPoller(client, time.Millisecond, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- p.Run(ctx) }()
+	go func() {
+		for range p.Events() {
+		}
+	}()
+
+	// Under -race, the failing polls of both must not race on the session
+	// state.
+	for i := 0; i < 100; i++ {
+		p.Poll()
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Poller.Run() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+// A client that counts its requests for channels.
+type fakeCountingClient struct {
+	fakePollerClient
+	polls int
+}
+
+func (f *fakeCountingClient) GetDownstreamChannels() ([]*DownstreamChannel, error) {
+	f.polls++
+	return f.fakePollerClient.GetDownstreamChannels()
+}
+
+func TestPoller_Refresh(t *testing.T) {
+	ignore := goleak.IgnoreCurrent()
+	t.Cleanup(func() { goleak.VerifyNone(t, ignore) })
+	client := &fakeCountingClient{fakePollerClient: fakePollerClient{
+		downstream: []*DownstreamChannel{{ChannelID: 20, LockStatus: "Locked"}},
+	}}
+	// On demand, the interval must not cause polls.
+	p := NewPoller(client, time.Millisecond, logger)
+	p.PollOnDemand()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- p.Run(ctx) }()
+	go func() {
+		for range p.Events() {
+		}
+	}()
+
+	for i := 1; i <= 3; i++ {
+		snapshot, err := p.Refresh(ctx)
+		if err != nil || snapshot == nil {
+			t.Fatalf("Poller.Refresh() = %v, %v, want snapshot", snapshot, err)
+		}
+		if snapshot != p.Last() {
+			t.Errorf("Poller.Refresh() = %p, want Poller.Last() %p", snapshot, p.Last())
+		}
+		// The poll at start may or may not have served the first refresh.
+		if client.polls < i || client.polls > i+1 {
+			t.Errorf("polls after %d refreshes = %d", i, client.polls)
+		}
+	}
+	polls := client.polls
+	time.Sleep(20 * time.Millisecond)
+	if _, err := p.Refresh(ctx); err != nil {
+		t.Fatalf("Poller.Refresh() error = %v", err)
+	}
+	if client.polls != polls+1 {
+		t.Errorf("polls = %d, want %d: polled without a refresh", client.polls, polls+1)
+	}
+
+	client.err = fmt.Errorf("timeout")
+	if _, err := p.Refresh(ctx); err == nil {
+		t.Errorf("Poller.Refresh() error = nil, want poll error")
+	}
+	if p.Err() == nil {
+		t.Errorf("Poller.Err() = nil after failed poll")
+	}
+
+	cancelled, cancelRefresh := context.WithCancel(ctx)
+	cancelRefresh()
+	cancel()
+	<-done
+	if _, err := p.Refresh(cancelled); err != context.Canceled {
+		t.Errorf("Poller.Refresh() after Run returned error = %v, want %v", err, context.Canceled)
+	}
+}
+
+// A client that panics on its first request for channels.
+type fakePanickingClient struct {
+	fakePollerClient
+	panicked bool
+}
+
+func (f *fakePanickingClient) GetDownstreamChannels() ([]*DownstreamChannel, error) {
+	if !f.panicked {
+		f.panicked = true
+		panic("index out of range")
+	}
+	return f.fakePollerClient.GetDownstreamChannels()
+}
+
+func TestPoller_Run_panic(t *testing.T) {
+	ignore := goleak.IgnoreCurrent()
+	t.Cleanup(func() { goleak.VerifyNone(t, ignore) })
+	client := &fakePanickingClient{fakePollerClient: fakePollerClient{
+		downstream: []*DownstreamChannel{{ChannelID: 20, LockStatus: "Locked"}},
+	}}
+	p := NewPoller(client, time.Millisecond, logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- p.Run(ctx) }()
+	go func() {
+		for range p.Events() {
+		}
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for p.Last() == nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("Poller did not recover from a panicking client")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if client.logins != 2 {
+		t.Errorf("client logins = %d, want 2", client.logins)
+	}
+
+	cancel()
+	<-done
+}
+
+// A client that also reports connection info.
+type fakeConnectingClient struct {
+	fakePollerClient
+	connection *ConnectionInfo
+	connErr    error
+}
+
+func (f *fakeConnectingClient) GetConnectionInfo() (*ConnectionInfo, error) {
+	return f.connection, f.connErr
+}
+
+func TestPoller_connectivity(t *testing.T) {
+	client := &fakeConnectingClient{}
+	p := NewPoller(client, time.Minute, logger)
+
+	steps := []struct {
+		status, comment string
+		connErr         error
+		want            []Event
+		wantState       string
+	}{
+		{"OK", "Operational", nil, nil, "OK"},
+		{"In Progress", "DHCP", nil, []Event{{Type: ConnectivityStateChanged, PreviousState: "OK", CurrentState: "DHCP"}}, "DHCP"},
+		{"", "", fmt.Errorf("timeout"), nil, "DHCP"},
+		{"OK", "Operational", nil, []Event{{Type: ConnectivityStateChanged, PreviousState: "DHCP", CurrentState: "OK"}}, "OK"},
+	}
+	for idx, step := range steps {
+		client.connection, client.connErr = nil, step.connErr
+		if step.connErr == nil {
+			client.connection = &ConnectionInfo{ConnectivityStatus: step.status, ConnectivityComment: step.comment}
+		}
+
+		events, err := p.Poll()
+		if err != nil {
+			t.Fatalf("step %d: Poller.Poll() error = %v", idx, err)
+		}
+		for i := range events {
+			events[i].Time = time.Time{}
+		}
+		if !reflect.DeepEqual(events, step.want) {
+			t.Errorf("step %d: Poller.Poll() = %+v, want %+v", idx, events, step.want)
+		}
+		if got := p.ConnectivityState(); got != step.wantState {
+			t.Errorf("step %d: Poller.ConnectivityState() = %v, want %v", idx, got, step.wantState)
+		}
+	}
+}
+
+func TestPoller_partialService(t *testing.T) {
+	client := &fakeConnectingClient{}
+	p := NewPoller(client, time.Minute, logger)
+
+	steps := []struct {
+		comment string
+		want    []Event
+	}{
+		{"Operational", nil},
+		{"Partial Service (US only)", []Event{{Type: PartialServiceChanged, Direction: DirectionUpstream, PreviousState: PartialServiceFull, CurrentState: PartialServiceActive}}},
+		{"Partial Service (DS only)", []Event{
+			{Type: PartialServiceChanged, Direction: DirectionDownstream, PreviousState: PartialServiceFull, CurrentState: PartialServiceActive},
+			{Type: PartialServiceChanged, Direction: DirectionUpstream, PreviousState: PartialServiceActive, CurrentState: PartialServiceFull},
+		}},
+		{"Operational", []Event{{Type: PartialServiceChanged, Direction: DirectionDownstream, PreviousState: PartialServiceActive, CurrentState: PartialServiceFull}}},
+	}
+	for idx, step := range steps {
+		client.connection = &ConnectionInfo{ConnectivityStatus: "OK", ConnectivityComment: step.comment}
+
+		events, err := p.Poll()
+		if err != nil {
+			t.Fatalf("step %d: Poller.Poll() error = %v", idx, err)
+		}
+		for i := range events {
+			events[i].Time = time.Time{}
+		}
+		if !reflect.DeepEqual(events, step.want) {
+			t.Errorf("step %d: Poller.Poll() = %+v, want %+v", idx, events, step.want)
+		}
+		if got, want := *p.Last().PartialService, client.connection.PartialService(); got != want {
+			t.Errorf("step %d: Snapshot.PartialService = %+v, want %+v", idx, got, want)
+		}
+	}
+}
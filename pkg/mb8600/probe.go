@@ -0,0 +1,81 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// How long Ping waits for the modem to answer by default.
+	defaultProbeTimeout = 2 * time.Second
+	// How often WaitForOnline pings the modem by default.
+	defaultProbeInterval = 5 * time.Second
+)
+
+// Checks that the modem's web server is reachable, without logging in.
+//
+// Returns nil if the HNAP endpoint answers, with any status, within the
+// probe timeout, see WithProbe, or the transport error otherwise.
+func (c *MotoClient) Ping(ctx context.Context) error {
+	if c.configErr != nil {
+		return c.configErr
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.probeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.GetHNAPURI(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return nil
+}
+
+// Blocks until the modem is reachable, e.g. after a reboot, pinging it every
+// probe interval, see WithProbe.
+//
+// Returns nil once a ping succeeds, or an error wrapping the context error
+// and the last ping failure if ctx is done first. The modem forgets all
+// sessions on reboot, the next request logs in again.
+func (c *MotoClient) WaitForOnline(ctx context.Context) error {
+	ticker := time.NewTicker(c.probeInterval)
+	defer ticker.Stop()
+
+	for {
+		err := c.Ping(ctx)
+		if err == nil {
+			return nil
+		}
+		logDebug(c.Logger, "msg", "modem is offline", "err", err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for modem: %w (last error: %v)", ctx.Err(), err)
+		case <-ticker.C:
+		}
+	}
+}
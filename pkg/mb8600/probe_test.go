@@ -0,0 +1,98 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/mb8600test"
+)
+
+// Fails the first down round trips, as a rebooting modem does, then passes
+// requests on to the underlying transport.
+type rebootingTransport struct {
+	down  int32
+	calls atomic.Int32
+	next  http.RoundTripper
+}
+
+func (t *rebootingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.calls.Add(1) <= t.down {
+		return nil, errors.New("connection refused")
+	}
+	return t.next.RoundTrip(req)
+}
+
+func TestMotoClient_Ping(t *testing.T) {
+	server := mb8600test.NewServer(mb8600test.NewModem(username, password))
+	defer server.Close()
+
+	c := NewMotoClient(mb8600test.Address(server), username, password, logger, WithHTTPClient(server.Client()))
+	if err := c.Ping(context.Background()); err != nil {
+		t.Errorf("MotoClient.Ping() error = %v", err)
+	}
+
+	server.Close()
+	if err := c.Ping(context.Background()); err == nil {
+		t.Errorf("MotoClient.Ping() error = nil after shutdown, want error")
+	}
+}
+
+func TestMotoClient_WaitForOnline(t *testing.T) {
+	tests := []struct {
+		name    string
+		down    int32
+		timeout time.Duration
+		wantErr bool
+	}{
+		{"online", 0, time.Second, false},
+		{"back after reboot", 3, time.Second, false},
+		{"never back", 1 << 30, 50 * time.Millisecond, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modem := mb8600test.NewModem(username, password)
+			server := mb8600test.NewServer(modem)
+			defer server.Close()
+
+			transport := &rebootingTransport{down: tt.down, next: server.Client().Transport}
+			c := NewMotoClient(mb8600test.Address(server), username, password, logger,
+				WithTransport(transport), WithProbe(time.Second, time.Millisecond))
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			err := c.WaitForOnline(ctx)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MotoClient.WaitForOnline() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("MotoClient.WaitForOnline() error = %v, want %v", err, context.DeadlineExceeded)
+			}
+			if !tt.wantErr && transport.calls.Load() != tt.down+1 {
+				t.Errorf("pings = %v, want %v", transport.calls.Load(), tt.down+1)
+			}
+			if len(modem.Requests()) != 0 {
+				t.Errorf("Modem.Requests() = %v, want no HNAP actions", modem.Requests())
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"context"
+	"math/rand"
+	"slices"
+	"strings"
+	"time"
+)
+
+// The longest delay between two attempts, however many attempts came before.
+const maxRetryDelay = time.Minute
+
+// Retries transient failures with exponential backoff.
+type retryPolicy struct {
+	maxAttempts int
+	backoff     time.Duration
+	sleep       func(ctx context.Context, d time.Duration) error
+	jitter      func() float64
+}
+
+func newRetryPolicy(maxAttempts int, backoff time.Duration) *retryPolicy {
+	return &retryPolicy{
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		sleep:       sleepContext,
+		jitter:      rand.Float64,
+	}
+}
+
+// Returns the delay before the attempt following the given one: the backoff
+// doubled for each previous attempt, up to maxRetryDelay, reduced by a random
+// amount of up to half so that several collectors do not retry in lockstep.
+func (p *retryPolicy) delay(attempt int) time.Duration {
+	d := min(p.backoff, maxRetryDelay)
+	for i := 1; i < attempt && d < maxRetryDelay; i++ {
+		d = min(2*d, maxRetryDelay)
+	}
+	return d/2 + time.Duration(p.jitter()*float64(d/2))
+}
+
+// Returns true if action may be sent again after a failure. Get actions only
+// read the modem's state; anything else, such as a reboot, must be marked
+// idempotent with WithIdempotentActions.
+func (c *MotoClient) retries(action string) bool {
+	return strings.HasPrefix(action, "Get") || slices.Contains(c.idempotentActions, action)
+}
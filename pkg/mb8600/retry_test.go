@@ -0,0 +1,178 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/mb8600test"
+)
+
+func Test_isRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"server error", &StatusError{"GetHomeAddress", http.StatusServiceUnavailable}, true},
+		{"client error", &StatusError{"GetHomeAddress", http.StatusNotFound}, false},
+		{"transport", &url.Error{Op: "Post", URL: "https://modem", Err: errors.New("timeout")}, true},
+		{"unauthorized", fmt.Errorf("action, Login: %w", ErrUnauthorized), false},
+		{"parse", errors.New("invalid number of parts"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(tt.err); got != tt.want {
+				t.Errorf("isRetryable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_retryPolicy_delay(t *testing.T) {
+	p := newRetryPolicy(5, 100*time.Millisecond)
+	for attempt, want := range map[int]time.Duration{1: 100, 2: 200, 3: 400} {
+		want *= time.Millisecond
+		p.jitter = func() float64 { return 0 }
+		if got := p.delay(attempt); got != want/2 {
+			t.Errorf("retryPolicy.delay(%d) without jitter = %v, want %v", attempt, got, want/2)
+		}
+		p.jitter = func() float64 { return 1 }
+		if got := p.delay(attempt); got != want {
+			t.Errorf("retryPolicy.delay(%d) with full jitter = %v, want %v", attempt, got, want)
+		}
+	}
+
+	// The delay is capped rather than overflowing.
+	p.jitter = func() float64 { return 1 }
+	for _, attempt := range []int{20, 64, 1000} {
+		if got := p.delay(attempt); got != maxRetryDelay {
+			t.Errorf("retryPolicy.delay(%d) = %v, want %v", attempt, got, maxRetryDelay)
+		}
+	}
+}
+
+func TestWithRetry_invalid(t *testing.T) {
+	for _, opt := range []Option{WithRetry(0, time.Second), WithRetry(3, 0), WithRetry(-1, -time.Second)} {
+		if c := NewMotoClient("192.168.100.1", username, password, logger, opt); c.Err() == nil {
+			t.Errorf("MotoClient.Err() = nil, want error")
+		}
+	}
+}
+
+func Test_sleepContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if err := sleepContext(ctx, time.Hour); !errors.Is(err, context.Canceled) {
+		t.Errorf("sleepContext() error = %v, want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("sleepContext() took %v after cancellation", elapsed)
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	modem := mb8600test.NewModem(username, password)
+	var failures atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("SOAPAction") != "http://purenetworks.com/HNAP1/Login" && failures.Add(-1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		modem.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		failures  int32
+		wantSleep int
+		wantErr   bool
+	}{
+		{"no failures", 0, 0, false},
+		{"transient", 2, 2, false},
+		{"persistent", 3, 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewMotoClient(mb8600test.Address(server), username, password, logger, WithRetry(3, time.Second))
+			var sleeps int
+			c.retry.sleep = func(context.Context, time.Duration) error { sleeps++; return nil }
+			if _, err := c.Login(); err != nil {
+				t.Fatalf("MotoClient.Login() error = %v", err)
+			}
+
+			failures.Store(tt.failures)
+			if _, err := c.GetDownstreamChannels(); (err != nil) != tt.wantErr {
+				t.Errorf("MotoClient.GetDownstreamChannels() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if sleeps != tt.wantSleep {
+				t.Errorf("retries = %v, want %v", sleeps, tt.wantSleep)
+			}
+		})
+	}
+}
+
+func TestWithRetry_idempotent(t *testing.T) {
+	modem := mb8600test.NewModem(username, password)
+	var attempts atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("SOAPAction") == "http://purenetworks.com/HNAP1/SetStatusSecuritySettings" {
+			attempts.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		modem.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name string
+		opts []Option
+		want int32
+	}{
+		{"not retried", []Option{WithRetry(3, time.Second), WithAnyAction()}, 1},
+		{"marked idempotent", []Option{WithRetry(3, time.Second), WithAnyAction(), WithIdempotentActions("SetStatusSecuritySettings")}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewMotoClient(mb8600test.Address(server), username, password, logger, tt.opts...)
+			c.retry.sleep = func(context.Context, time.Duration) error { return nil }
+			if _, err := c.Login(); err != nil {
+				t.Fatalf("MotoClient.Login() error = %v", err)
+			}
+
+			attempts.Store(0)
+			if _, err := c.DoAction("SetStatusSecuritySettings", map[string]string{"MotoStatusSecurityAction": "1"}); err == nil {
+				t.Errorf("MotoClient.DoAction() error = nil, want error")
+			}
+			if got := attempts.Load(); got != tt.want {
+				t.Errorf("attempts = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
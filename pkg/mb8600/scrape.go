@@ -0,0 +1,137 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	statusPagePath = "/MotoConnection.asp"
+
+	downstreamStatusColumns = 9
+	upstreamStatusColumns   = 7
+)
+
+var (
+	rowRegexp  = regexp.MustCompile(`(?is)<tr[^>]*>(.*?)</tr>`)
+	cellRegexp = regexp.MustCompile(`(?is)<td[^>]*>(.*?)</td>`)
+	tagRegexp  = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// Returns the URI of the unauthenticated HTML status page.
+func (c *MotoClient) GetStatusPageURI() string {
+	return c.url(statusPagePath)
+}
+
+// Fetches the HTML status page and parses the channel tables from it.
+//
+// This does not require logging in and is intended as a degraded fallback for
+// firmware where HNAP login is unavailable. Only the fields shown on the page
+// are populated.
+func (c *MotoClient) ScrapeChannels() ([]*DownstreamChannel, []*UpstreamChannel, error) {
+	page, err := c.FetchPage(statusPagePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return ParseStatusPage(string(page))
+}
+
+// Fetches an HTML page of the modem's web UI, e.g. "/MotoSwInfo.asp". Pages
+// other than the status page require a login.
+func (c *MotoClient) FetchPage(path string) ([]byte, error) {
+	if c.configErr != nil {
+		return nil, c.configErr
+	}
+	resp, err := c.client.Get(c.url(path))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("page, %s, received non-OK status code: %d", path, resp.StatusCode)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// Parses the downstream and upstream channel tables from the HTML status page.
+//
+// Rows are identified by their number of cells and a numeric first cell, so
+// header rows and unrelated tables are skipped.
+func ParseStatusPage(page string) ([]*DownstreamChannel, []*UpstreamChannel, error) {
+	var (
+		downstream []*DownstreamChannel
+		upstream   []*UpstreamChannel
+	)
+
+	for _, row := range rowRegexp.FindAllStringSubmatch(page, -1) {
+		var cells []string
+		for _, cell := range cellRegexp.FindAllStringSubmatch(row[1], -1) {
+			text := html.UnescapeString(tagRegexp.ReplaceAllString(cell[1], ""))
+			cells = append(cells, strings.Join(strings.Fields(text), " "))
+		}
+
+		if len(cells) == 0 {
+			continue
+		}
+		if _, err := strconv.Atoi(cells[0]); err != nil {
+			continue
+		}
+
+		// Reuse the HNAP line parsers, which expect a trailing separator.
+		line := strings.Join(cells, "^") + "^"
+		switch len(cells) {
+		case downstreamStatusColumns:
+			channel, err := NewDownstreamChannelFromLine(line)
+			if err != nil {
+				return nil, nil, err
+			}
+			downstream = append(downstream, channel)
+		case upstreamStatusColumns:
+			channel, err := NewUpstreamChannelFromLine(line)
+			if err != nil {
+				return nil, nil, err
+			}
+			upstream = append(upstream, channel)
+		}
+	}
+
+	if len(downstream) == 0 && len(upstream) == 0 {
+		return nil, nil, fmt.Errorf("no channel tables found in status page")
+	}
+
+	return downstream, upstream, nil
+}
+
+// Returns the channels from the status page if HNAP failed with err and the
+// fallback is enabled, otherwise returns err.
+func (c *MotoClient) scrapeFallback(err error) ([]*DownstreamChannel, []*UpstreamChannel, error) {
+	if !c.statusPageFallback {
+		return nil, nil, err
+	}
+
+	logWarn(c.Logger, "msg", "HNAP request failed, falling back to status page", "err", err)
+	return c.ScrapeChannels()
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const statusPage = `<html><body>
+<table class="moto-table-content">
+<tr><td class="moto-param-header-s">Channel</td><td>Lock Status</td><td>Modulation</td><td>Channel ID</td><td>Freq. (MHz)</td><td>Pwr (dBmV)</td><td>SNR (dB)</td><td>Corrected</td><td>Uncorrected</td></tr>
+<tr>
+  <td class="moto-content-value">1</td>
+  <td class="moto-content-value">Locked</td>
+  <td class="moto-content-value">QAM256</td>
+  <td class="moto-content-value">20</td>
+  <td class="moto-content-value">531.0</td>
+  <td class="moto-content-value"> 2.8</td>
+  <td class="moto-content-value">45.1</td>
+  <td class="moto-content-value">0</td>
+  <td class="moto-content-value">0</td>
+</tr>
+</table>
+<table class="moto-table-content">
+<tr><td>Channel</td><td>Lock Status</td><td>Channel Type</td><td>Channel ID</td><td>Symb. Rate (Ksym/sec)</td><td>Freq. (MHz)</td><td>Pwr (dBmV)</td></tr>
+<tr><td>1</td><td><b>Locked</b></td><td>SC-QAM</td><td>4</td><td>5120</td><td>35.6</td><td>56.0</td></tr>
+</table>
+</body></html>`
+
+func TestParseStatusPage(t *testing.T) {
+	tests := []struct {
+		name           string
+		page           string
+		wantDownstream []*DownstreamChannel
+		wantUpstream   []*UpstreamChannel
+		wantErr        bool
+	}{
+		{
+			"valid",
+			statusPage,
+			[]*DownstreamChannel{expDownstreamChannel},
+			[]*UpstreamChannel{expUpstreamChannel},
+			false,
+		},
+		{"no tables", "<html></html>", nil, nil, true},
+		{
+			"invalid value",
+			"<table><tr><td>1</td><td>Locked</td><td>SC-QAM</td><td>x</td><td>5120</td><td>35.6</td><td>56.0</td></tr></table>",
+			nil,
+			nil,
+			true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			downstream, upstream, err := ParseStatusPage(tt.page)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseStatusPage() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(downstream, tt.wantDownstream) {
+				t.Errorf("ParseStatusPage() downstream = %v, want %v", downstream, tt.wantDownstream)
+			}
+			if !reflect.DeepEqual(upstream, tt.wantUpstream) {
+				t.Errorf("ParseStatusPage() upstream = %v, want %v", upstream, tt.wantUpstream)
+			}
+		})
+	}
+}
+
+func TestMotoClient_statusPageFallback(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == statusPagePath {
+			w.Write([]byte(statusPage))
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+	addr := strings.TrimPrefix(server.URL, "https://")
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		want    int
+		wantErr bool
+	}{
+		{"disabled", nil, 0, true},
+		{"enabled", []Option{WithStatusPageFallback()}, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewMotoClient(addr, username, password, logger, tt.opts...)
+			got, err := c.GetDownstreamChannels()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("MotoClient.GetDownstreamChannels() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if len(got) != tt.want {
+				t.Errorf("len(MotoClient.GetDownstreamChannels()) = %v, want %v", len(got), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/atomicfile"
+)
+
+const (
+	// How long the modem is assumed to keep an idle session, until a shorter
+	// lifetime is observed.
+	DefaultSessionTTL = 10 * time.Minute
+
+	// The shortest session lifetime learned from rejected requests, so a
+	// modem reboot shortly after a request does not collapse the estimate.
+	minSessionTTL = time.Minute
+)
+
+var (
+	// No session has been saved, or the client has not logged in.
+	ErrNoSession = errors.New("no session")
+)
+
+// The authenticated state of a client, which can be saved and restored to
+// reuse a login across process restarts.
+type Session struct {
+	Address    string     `json:"address"`
+	Username   string     `json:"username"`
+	Scheme     string     `json:"scheme"`
+	PrivateKey string     `json:"private_key"`
+	UID        string     `json:"uid"`
+	Model      ModemModel `json:"model,omitempty"`
+	// When the session was saved.
+	Saved time.Time `json:"saved"`
+}
+
+// Stores a session between runs.
+type SessionStore interface {
+	// Returns the stored session, or ErrNoSession if there is none.
+	Load() (*Session, error)
+	Save(session *Session) error
+}
+
+// Stores a session as JSON in a file, which is readable by its owner only as
+// the session grants access to the modem.
+type FileSessionStore struct {
+	Path string
+}
+
+func (s *FileSessionStore) Load() (*Session, error) {
+	data, err := os.ReadFile(s.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNoSession
+	} else if err != nil {
+		return nil, err
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("invalid session in %s: %w", s.Path, err)
+	}
+	return &session, nil
+}
+
+func (s *FileSessionStore) Save(session *Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(s.Path, data, 0600)
+}
+
+// Returns the client's authenticated state, or ErrNoSession if it has not
+// logged in.
+func (c *MotoClient) Session() (*Session, error) {
+	c.authMu.RLock()
+	defer c.authMu.RUnlock()
+	if !c.authenticated {
+		return nil, ErrNoSession
+	}
+
+	privateKey, err := c.GetPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	uid, err := c.GetUID()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Session{
+		Address:    c.Address,
+		Username:   c.Username,
+		Scheme:     c.GetScheme(),
+		PrivateKey: privateKey,
+		UID:        uid,
+		Model:      c.getModel(),
+		Saved:      time.Now(),
+	}, nil
+}
+
+// Adopts a session saved by a client of the same modem and user, so requests
+// are made without logging in first. If the modem has since expired the
+// session, the client logs in again on the first rejected request.
+func (c *MotoClient) RestoreSession(session *Session) error {
+	if session.Address != c.Address || session.Username != c.Username {
+		return fmt.Errorf("session is for %s@%s, not %s@%s", session.Username, session.Address, c.Username, c.Address)
+	}
+
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+
+	c.mu.Lock()
+	if session.Scheme != "" {
+		c.scheme = session.Scheme
+		c.schemeProbed = true
+	}
+	if session.Model != "" {
+		c.model = session.Model
+	}
+	c.mu.Unlock()
+
+	if err := c.SetPrivateKey(session.PrivateKey); err != nil {
+		return err
+	}
+	if err := c.SetUID(session.UID); err != nil {
+		return err
+	}
+	c.authenticated = true
+	c.sessionGen++
+	c.sessionUsed.Store(session.Saved.UnixNano())
+	return nil
+}
+
+// Saves the client's session to store.
+func (c *MotoClient) SaveSession(store SessionStore) error {
+	session, err := c.Session()
+	if err != nil {
+		return err
+	}
+	return store.Save(session)
+}
+
+// Restores the session saved in store. Returns ErrNoSession if there is none.
+func (c *MotoClient) LoadSession(store SessionStore) error {
+	session, err := store.Load()
+	if err != nil {
+		return err
+	}
+	return c.RestoreSession(session)
+}
+
+// Returns how long the client expects the modem to keep an idle session: the
+// configured lifetime, or a shorter one learned from requests the modem
+// rejected sooner. Zero means the client does not log in pre-emptively.
+func (c *MotoClient) SessionTTL() time.Duration {
+	return time.Duration(c.sessionTTL.Load())
+}
+
+// Records that the session was just used, which restarts the modem's idle
+// timer.
+func (c *MotoClient) touchSession() {
+	c.sessionUsed.Store(c.now().UnixNano())
+}
+
+// Returns how long the session has been idle.
+func (c *MotoClient) sessionIdle() time.Duration {
+	return c.now().Sub(time.Unix(0, c.sessionUsed.Load()))
+}
+
+// Shortens the session lifetime estimate after the modem rejected a session
+// that had been idle for less than it.
+func (c *MotoClient) learnSessionTTL() {
+	ttl, idle := c.SessionTTL(), c.sessionIdle()
+	if ttl <= 0 || idle >= ttl || idle < minSessionTTL {
+		return
+	}
+	if c.sessionTTL.CompareAndSwap(int64(ttl), int64(idle)) {
+		logInfo(c.Logger, "msg", "learned shorter modem session lifetime", "previous", ttl, "ttl", idle)
+	}
+}
+
+// Logs in again if the session has been idle for nearly its lifetime, so the
+// next request is not rejected by the modem and delayed by a re-login.
+func (c *MotoClient) refreshIdleSession(ctx context.Context) error {
+	ttl := c.SessionTTL()
+	if ttl <= 0 {
+		return nil
+	}
+	// Refresh with a tenth of the lifetime to spare, as the modem's clock
+	// for the session starts before ours.
+	idle := c.sessionIdle()
+	c.authMu.RLock()
+	authenticated := c.authenticated
+	c.authMu.RUnlock()
+	if !authenticated || idle < ttl-ttl/10 {
+		return nil
+	}
+
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+
+	// Another request may have logged in meanwhile.
+	if !c.authenticated || c.sessionIdle() < ttl-ttl/10 {
+		return nil
+	}
+
+	logDebug(c.Logger, "msg", "session idle, logging in again before the modem expires it", "idle", idle, "ttl", ttl)
+	_, err := c.login(ctx)
+	return err
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/mb8600test"
+)
+
+func TestMotoClient_SaveSession(t *testing.T) {
+	modem := mb8600test.NewModem(username, password)
+	server := mb8600test.NewServer(modem)
+	defer server.Close()
+	store := &FileSessionStore{Path: filepath.Join(t.TempDir(), "session.json")}
+
+	c := NewMotoClient(mb8600test.Address(server), username, password, logger)
+	if err := c.LoadSession(store); !errors.Is(err, ErrNoSession) {
+		t.Errorf("MotoClient.LoadSession() error = %v, want ErrNoSession", err)
+	}
+	if err := c.SaveSession(store); !errors.Is(err, ErrNoSession) {
+		t.Errorf("MotoClient.SaveSession() before login error = %v, want ErrNoSession", err)
+	}
+	if _, err := c.Login(); err != nil {
+		t.Fatalf("MotoClient.Login() error = %v", err)
+	}
+	if err := c.SaveSession(store); err != nil {
+		t.Fatalf("MotoClient.SaveSession() error = %v", err)
+	}
+
+	// A new client reuses the session without logging in.
+	restored := NewMotoClient(mb8600test.Address(server), username, password, logger)
+	if err := restored.LoadSession(store); err != nil {
+		t.Fatalf("MotoClient.LoadSession() error = %v", err)
+	}
+	if _, err := restored.GetDownstreamChannels(); err != nil {
+		t.Fatalf("MotoClient.GetDownstreamChannels() error = %v", err)
+	}
+	want := []string{"Login", "Login", "GetMotoStatusDownstreamChannelInfo"}
+	if got := modem.Requests(); !slices.Equal(got, want) {
+		t.Errorf("Modem.Requests() = %v, want %v", got, want)
+	}
+
+	// An expired session is replaced by a new login.
+	modem.Logout()
+	if _, err := restored.GetDownstreamChannels(); err != nil {
+		t.Errorf("MotoClient.GetDownstreamChannels() after logout error = %v", err)
+	}
+
+	other := NewMotoClient("10.0.0.1", username, password, logger)
+	if err := other.LoadSession(store); err == nil {
+		t.Errorf("MotoClient.LoadSession() of another modem error = nil, want error")
+	}
+}
+
+func countLogins(requests []string) int {
+	var n int
+	for _, action := range requests {
+		if action == "Login" {
+			n++
+		}
+	}
+	return n
+}
+
+func TestMotoClient_refreshIdleSession(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []Option
+		idle       time.Duration
+		wantLogins int
+	}{
+		{"active", nil, 5 * time.Minute, 0},
+		{"nearly expired", nil, 9*time.Minute + 30*time.Second, 2},
+		{"custom ttl", []Option{WithSessionTTL(3 * time.Minute)}, 5 * time.Minute, 2},
+		{"disabled", []Option{WithSessionTTL(0)}, time.Hour, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modem := mb8600test.NewModem(username, password)
+			server := mb8600test.NewServer(modem)
+			defer server.Close()
+
+			now := time.Date(2023, 12, 16, 0, 0, 0, 0, time.UTC)
+			c := NewMotoClient(mb8600test.Address(server), username, password, logger, tt.opts...)
+			c.now = func() time.Time { return now }
+			if _, err := c.Login(); err != nil {
+				t.Fatalf("MotoClient.Login() error = %v", err)
+			}
+			logins := countLogins(modem.Requests())
+
+			now = now.Add(tt.idle)
+			if _, err := c.GetUpstreamChannels(); err != nil {
+				t.Fatalf("MotoClient.GetUpstreamChannels() error = %v", err)
+			}
+			if got := countLogins(modem.Requests()) - logins; got != tt.wantLogins {
+				t.Errorf("logins after %s idle = %d, want %d", tt.idle, got, tt.wantLogins)
+			}
+		})
+	}
+}
+
+func TestMotoClient_learnSessionTTL(t *testing.T) {
+	modem := mb8600test.NewModem(username, password)
+	server := mb8600test.NewServer(modem)
+	defer server.Close()
+
+	now := time.Date(2023, 12, 16, 0, 0, 0, 0, time.UTC)
+	c := NewMotoClient(mb8600test.Address(server), username, password, logger)
+	c.now = func() time.Time { return now }
+	if c.SessionTTL() != DefaultSessionTTL {
+		t.Errorf("MotoClient.SessionTTL() = %s, want %s", c.SessionTTL(), DefaultSessionTTL)
+	}
+	if _, err := c.Login(); err != nil {
+		t.Fatalf("MotoClient.Login() error = %v", err)
+	}
+
+	// A rejection shortly after a request, e.g. a modem reboot, says little
+	// about the lifetime.
+	now = now.Add(10 * time.Second)
+	modem.Logout()
+	if _, err := c.GetUpstreamChannels(); err != nil {
+		t.Fatalf("MotoClient.GetUpstreamChannels() error = %v", err)
+	}
+	if c.SessionTTL() != DefaultSessionTTL {
+		t.Errorf("MotoClient.SessionTTL() after early rejection = %s, want %s", c.SessionTTL(), DefaultSessionTTL)
+	}
+
+	now = now.Add(4 * time.Minute)
+	modem.Logout()
+	if _, err := c.GetUpstreamChannels(); err != nil {
+		t.Fatalf("MotoClient.GetUpstreamChannels() error = %v", err)
+	}
+	if c.SessionTTL() != 4*time.Minute {
+		t.Errorf("MotoClient.SessionTTL() = %s, want 4m0s", c.SessionTTL())
+	}
+}
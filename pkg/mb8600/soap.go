@@ -0,0 +1,141 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// How HNAP requests and responses are encoded.
+type Encoding string
+
+const (
+	// The JSON shorthand of the modem's web interface, {"<Action>":{...}}.
+	EncodingJSON Encoding = "json"
+	// The classic SOAP envelope, for firmware that rejects JSON.
+	EncodingXML Encoding = "xml"
+	// JSON, switching to XML for good if the modem answers a JSON request
+	// with 500 Internal Server Error and the same request in XML succeeds.
+	EncodingAuto Encoding = "auto"
+)
+
+// Returns the encoding named json, xml or auto.
+func ParseEncoding(name string) (Encoding, error) {
+	switch e := Encoding(strings.ToLower(name)); e {
+	case EncodingJSON, EncodingXML, EncodingAuto:
+		return e, nil
+	}
+	return "", fmt.Errorf("unknown HNAP encoding: %s", name)
+}
+
+const (
+	soapEnvelopeNamespace = "http://schemas.xmlsoap.org/soap/envelope/"
+
+	soapEnvelopeStart = `<?xml version="1.0" encoding="utf-8"?>` + "\n" +
+		`<soap:Envelope xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:soap="` + soapEnvelopeNamespace + `">` + "\n" +
+		"<soap:Body>\n"
+	soapEnvelopeEnd = "</soap:Body>\n</soap:Envelope>\n"
+)
+
+// Writes the SOAP envelope of a request for action with params, the params
+// being child elements of the action element in the namespace.
+func encodeXMLRequest(buf *bytes.Buffer, namespace, action string, params map[string]string) error {
+	buf.WriteString(soapEnvelopeStart)
+	buf.WriteString("<" + action + ` xmlns="`)
+	if err := xml.EscapeText(buf, []byte(namespace)); err != nil {
+		return err
+	}
+	buf.WriteString(`">`)
+
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		buf.WriteString("<" + name + ">")
+		if err := xml.EscapeText(buf, []byte(params[name])); err != nil {
+			return err
+		}
+		buf.WriteString("</" + name + ">")
+	}
+
+	buf.WriteString("</" + action + ">\n")
+	buf.WriteString(soapEnvelopeEnd)
+	return nil
+}
+
+// An element of a SOAP response, with its text or child elements.
+type xmlNode struct {
+	XMLName  xml.Name
+	Text     string    `xml:",chardata"`
+	Children []xmlNode `xml:",any"`
+}
+
+// Returns the fields of the SOAP response to action in body, the children of
+// the <Action>Response element. As with JSON, the responses batched in a
+// GetMultipleHNAPs response are returned as JSON objects keyed by
+// "<Action>Response".
+func decodeXMLResponse(action string, body []byte) (map[string]string, error) {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("no response from modem")
+		} else if err != nil {
+			return nil, err
+		}
+
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != action+"Response" {
+			continue
+		}
+		var node xmlNode
+		if err := dec.DecodeElement(&node, &start); err != nil {
+			return nil, err
+		}
+		return xmlFields(node)
+	}
+}
+
+// Returns the children of node by name: their text, or the JSON object of
+// their own children's text if they have any.
+func xmlFields(node xmlNode) (map[string]string, error) {
+	fields := make(map[string]string, len(node.Children))
+	for _, child := range node.Children {
+		if len(child.Children) == 0 {
+			fields[child.XMLName.Local] = child.Text
+			continue
+		}
+		nested, err := xmlFields(child)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(nested)
+		if err != nil {
+			return nil, err
+		}
+		fields[child.XMLName.Local] = string(data)
+	}
+	return fields, nil
+}
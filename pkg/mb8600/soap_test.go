@@ -0,0 +1,166 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/thelande/mb8600/pkg/mb8600test"
+)
+
+func Test_encodeXMLRequest(t *testing.T) {
+	var b bytes.Buffer
+	err := encodeXMLRequest(&b, soapNamespace, "Login", map[string]string{"Username": "admin", "LoginPassword": `<&>"`, "Action": "request"})
+	if err != nil {
+		t.Fatalf("encodeXMLRequest() error = %v", err)
+	}
+	want := `<?xml version="1.0" encoding="utf-8"?>
+<soap:Envelope xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+<soap:Body>
+<Login xmlns="http://purenetworks.com/HNAP1/"><Action>request</Action><LoginPassword>&lt;&amp;&gt;&#34;</LoginPassword><Username>admin</Username></Login>
+</soap:Body>
+</soap:Envelope>
+`
+	if got := b.String(); got != want {
+		t.Errorf("encodeXMLRequest() = %s, want %s", got, want)
+	}
+}
+
+func Test_decodeXMLResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		action  string
+		body    string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			"fields",
+			"GetMotoStatusSoftware",
+			`<?xml version="1.0"?><soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>
+				<GetMotoStatusSoftwareResponse xmlns="http://purenetworks.com/HNAP1/">
+					<StatusSoftwareSfVer>8600-19.3.18</StatusSoftwareSfVer>
+					<StatusSoftwareSpecVer>DOCSIS 3.1</StatusSoftwareSpecVer>
+					<GetMotoStatusSoftwareResult>OK</GetMotoStatusSoftwareResult>
+				</GetMotoStatusSoftwareResponse>
+			</soap:Body></soap:Envelope>`,
+			map[string]string{"StatusSoftwareSfVer": "8600-19.3.18", "StatusSoftwareSpecVer": "DOCSIS 3.1", "GetMotoStatusSoftwareResult": "OK"},
+			false,
+		},
+		{
+			"multiple",
+			multipleHNAPsAction,
+			`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><GetMultipleHNAPsResponse>` +
+				`<GetHomeConnectionResponse><MotoHomeOnline>Connected</MotoHomeOnline></GetHomeConnectionResponse>` +
+				`<GetMultipleHNAPsResult>OK</GetMultipleHNAPsResult>` +
+				`</GetMultipleHNAPsResponse></soap:Body></soap:Envelope>`,
+			map[string]string{"GetHomeConnectionResponse": `{"MotoHomeOnline":"Connected"}`, "GetMultipleHNAPsResult": "OK"},
+			false,
+		},
+		{"missing", "GetMotoStatusLog", `<soap:Envelope><soap:Body/></soap:Envelope>`, nil, true},
+		{"invalid", "GetMotoStatusLog", `<soap:Envelope>`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeXMLResponse(tt.action, []byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeXMLResponse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decodeXMLResponse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMotoClient_WithEncoding(t *testing.T) {
+	tests := []struct {
+		name         string
+		soapOnly     bool
+		encoding     Encoding
+		wantEncoding Encoding
+		wantErr      bool
+	}{
+		{"json", false, EncodingJSON, EncodingJSON, false},
+		{"json rejected", true, EncodingJSON, EncodingJSON, true},
+		{"xml", true, EncodingXML, EncodingXML, false},
+		{"auto json", false, EncodingAuto, EncodingJSON, false},
+		{"auto xml", true, EncodingAuto, EncodingXML, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modem := mb8600test.NewModem(username, password)
+			modem.SOAPOnly = tt.soapOnly
+			server := mb8600test.NewServer(modem)
+			defer server.Close()
+
+			c := NewMotoClient(mb8600test.Address(server), username, password, logger, WithEncoding(tt.encoding), WithMultipleHNAPs())
+			status, err := c.GetStatus()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("MotoClient.GetStatus() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := c.GetEncoding(); got != tt.wantEncoding {
+				t.Errorf("MotoClient.GetEncoding() = %s, want %s", got, tt.wantEncoding)
+			}
+			if err != nil {
+				return
+			}
+			if len(status.Downstream) == 0 || status.Software.SoftwareVersion == "" {
+				t.Errorf("MotoClient.GetStatus() = %+v, want the modem's status", status)
+			}
+			if _, err := c.GetLogs(); err != nil {
+				t.Errorf("MotoClient.GetLogs() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestWithEncoding_invalid(t *testing.T) {
+	c := NewMotoClient(address, username, password, logger, WithEncoding("yaml"))
+	if c.Err() == nil {
+		t.Error("MotoClient.Err() = nil, want an error")
+	}
+}
+
+func TestWireFormat_xml(t *testing.T) {
+	transport := &recordingTransport{
+		handler:  mb8600test.NewModem(username, password),
+		requests: map[string][]string{},
+	}
+	c := NewMotoClientWithTimestamper(address, username, password, logger, &MockTimestamper{timestamp}, WithTransport(transport), WithEncoding(EncodingXML))
+
+	if _, err := c.Login(); err != nil {
+		t.Fatalf("MotoClient.Login() error = %v", err)
+	}
+	if _, err := c.doMultiple(context.Background(), statusActions); err != nil {
+		t.Fatalf("MotoClient.doMultiple() error = %v", err)
+	}
+
+	for _, action := range []string{"Login", multipleHNAPsAction} {
+		t.Run(action, func(t *testing.T) {
+			requests := transport.requests[`"`+soapNamespace+action+`"`]
+			if len(requests) == 0 {
+				t.Fatalf("no %s request recorded", action)
+			}
+			checkGolden(t, "xml/"+action, strings.Join(requests, "\n"))
+		})
+	}
+}
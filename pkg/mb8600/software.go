@@ -0,0 +1,126 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"cmp"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The hardware and firmware of the modem.
+type SoftwareStatus struct {
+	// The firmware version, e.g. "8600-19.3.18".
+	SoftwareVersion string `json:"software_version"`
+	HardwareVersion string `json:"hardware_version"`
+	// The DOCSIS specification version, e.g. "DOCSIS 3.1".
+	SpecVersion     string `json:"spec_version"`
+	CustomerVersion string `json:"customer_version"`
+	MACAddress      string `json:"mac_address"`
+	SerialNumber    string `json:"serial_number"`
+}
+
+// Returns the software status described by the response to
+// GetMotoStatusSoftware.
+func NewSoftwareStatusFromResponse(resp map[string]string) *SoftwareStatus {
+	return &SoftwareStatus{
+		SoftwareVersion: strings.TrimSpace(resp["StatusSoftwareSfVer"]),
+		HardwareVersion: strings.TrimSpace(resp["StatusSoftwareHdVer"]),
+		SpecVersion:     strings.TrimSpace(resp["StatusSoftwareSpecVer"]),
+		CustomerVersion: strings.TrimSpace(resp["StatusSoftwareCustomerVer"]),
+		MACAddress:      strings.TrimSpace(resp["StatusSoftwareMac"]),
+		SerialNumber:    strings.TrimSpace(resp["StatusSoftwareSerialNum"]),
+	}
+}
+
+// Returns the modem's hardware and firmware versions.
+func (c *MotoClient) GetSoftwareStatus() (*SoftwareStatus, error) {
+	resp, err := c.do("GetMotoStatusSoftware", nil)
+	if err != nil {
+		return nil, err
+	}
+	return NewSoftwareStatusFromResponse(resp), nil
+}
+
+// Compares the running firmware against expected, returning -1, 0 or +1 if
+// it is older than, the same as or newer than expected. See CompareVersions.
+func (s *SoftwareStatus) CompareVersion(expected string) (int, error) {
+	return CompareVersions(s.SoftwareVersion, expected)
+}
+
+// Compares two firmware versions such as "8600-19.3.18", returning -1, 0 or
+// +1 if a is older than, the same as or newer than b. Components are compared
+// numerically where both are numbers. The model prefixes must match, but
+// either version may omit it, e.g. "19.3.18".
+func CompareVersions(a, b string) (int, error) {
+	modelA, partsA, err := splitVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	modelB, partsB, err := splitVersion(b)
+	if err != nil {
+		return 0, err
+	}
+	if modelA != "" && modelB != "" && modelA != modelB {
+		return 0, fmt.Errorf("versions are for different models: %q, %q", a, b)
+	}
+
+	for idx := 0; idx < max(len(partsA), len(partsB)); idx++ {
+		var pa, pb string
+		if idx < len(partsA) {
+			pa = partsA[idx]
+		}
+		if idx < len(partsB) {
+			pb = partsB[idx]
+		}
+		if c := compareVersionPart(pa, pb); c != 0 {
+			return c, nil
+		}
+	}
+	return 0, nil
+}
+
+func splitVersion(version string) (model string, parts []string, err error) {
+	version = strings.TrimSpace(version)
+	if before, after, found := strings.Cut(version, "-"); found {
+		model, version = before, after
+	}
+	if version == "" {
+		return "", nil, fmt.Errorf("invalid version: %q", version)
+	}
+	return model, strings.Split(version, "."), nil
+}
+
+// Compares two version components such as "18" or "18a" by their numeric
+// prefix and then by their suffix. A missing component is treated as 0.
+func compareVersionPart(a, b string) int {
+	numA, suffixA := splitVersionPart(a)
+	numB, suffixB := splitVersionPart(b)
+	if c := cmp.Compare(numA, numB); c != 0 {
+		return c
+	}
+	return strings.Compare(suffixA, suffixB)
+}
+
+func splitVersionPart(part string) (int, string) {
+	idx := strings.IndexFunc(part, func(r rune) bool { return r < '0' || r > '9' })
+	if idx < 0 {
+		idx = len(part)
+	}
+	num, _ := strconv.Atoi(part[:idx])
+	return num, part[idx:]
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"testing"
+
+	"github.com/thelande/mb8600/pkg/mb8600test"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b    string
+		want    int
+		wantErr bool
+	}{
+		{"8600-19.3.18", "8600-19.3.18", 0, false},
+		{"8600-19.3.18", "8600-19.3.19", -1, false},
+		{"8600-19.3.18", "8600-19.10.1", -1, false},
+		{"8600-20.1.0", "8600-19.3.18", 1, false},
+		{"8600-19.3", "8600-19.3.0", 0, false},
+		{"8600-19.3.18a", "8600-19.3.18", 1, false},
+		{"8600-19.3.18a", "8600-19.3.19", -1, false},
+		{"19.3.18", "8600-19.3.18", 0, false},
+		{"8611-19.3.18", "8600-19.3.18", 0, true},
+		{"8600-", "8600-19.3.18", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			got, err := CompareVersions(tt.a, tt.b)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CompareVersions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("CompareVersions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMotoClient_GetSoftwareStatus(t *testing.T) {
+	server := mb8600test.NewServer(mb8600test.NewModem(username, password))
+	defer server.Close()
+
+	c := NewMotoClient(mb8600test.Address(server), username, password, logger)
+	if _, err := c.Login(); err != nil {
+		t.Fatalf("MotoClient.Login() error = %v", err)
+	}
+
+	status, err := c.GetSoftwareStatus()
+	if err != nil {
+		t.Fatalf("MotoClient.GetSoftwareStatus() error = %v", err)
+	}
+	want := SoftwareStatus{
+		SoftwareVersion: "8600-19.3.18",
+		HardwareVersion: "V1.0",
+		SpecVersion:     "DOCSIS 3.1",
+		CustomerVersion: "Prod_19.3_d31",
+		MACAddress:      "00:11:22:33:44:55",
+		SerialNumber:    "2018123456789",
+	}
+	if *status != want {
+		t.Errorf("MotoClient.GetSoftwareStatus() = %+v, want %+v", *status, want)
+	}
+
+	if got, err := status.CompareVersion("8600-19.3.17"); err != nil || got != 1 {
+		t.Errorf("SoftwareStatus.CompareVersion() = %v, %v, want 1", got, err)
+	}
+}
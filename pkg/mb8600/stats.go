@@ -0,0 +1,88 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import "strings"
+
+// Counts describing how well the channel data returned by the modem parsed,
+// so that partially understood responses are visible.
+type ParseStats struct {
+	// Channel lines that parsed successfully.
+	LinesParsed uint64 `json:"lines_parsed"`
+	// Channel lines that were discarded because they, or another line in the
+	// same response, could not be parsed.
+	LinesSkipped uint64 `json:"lines_skipped"`
+	// Response fields that are not part of the action's schema.
+	UnknownFields uint64 `json:"unknown_fields"`
+	// Responses that were missing fields of the action's schema.
+	SchemaMismatches uint64 `json:"schema_mismatches"`
+}
+
+// Returns the counts accumulated since o was taken.
+func (s ParseStats) Sub(o ParseStats) ParseStats {
+	return ParseStats{
+		LinesParsed:      s.LinesParsed - o.LinesParsed,
+		LinesSkipped:     s.LinesSkipped - o.LinesSkipped,
+		UnknownFields:    s.UnknownFields - o.UnknownFields,
+		SchemaMismatches: s.SchemaMismatches - o.SchemaMismatches,
+	}
+}
+
+func (s *ParseStats) add(o ParseStats) {
+	s.LinesParsed += o.LinesParsed
+	s.LinesSkipped += o.LinesSkipped
+	s.UnknownFields += o.UnknownFields
+	s.SchemaMismatches += o.SchemaMismatches
+}
+
+// Returns the number of non-empty channel lines in response.
+func countChannelLines(response string) int {
+	count := 0
+	for _, line := range strings.Split(response, "|+|") {
+		if len(line) > 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// Returns the parse statistics accumulated by the client since it was
+// created.
+func (c *MotoClient) ParseStats() ParseStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.parseStats
+}
+
+// Records the outcome of parsing the channel data in field of the response
+// to action, of which parsed lines were kept.
+func (c *MotoClient) recordParse(action string, resp map[string]string, field string, parsed int) {
+	lines := countChannelLines(resp[field])
+	missing, unknown := compareSchema(action, resp)
+
+	stats := ParseStats{
+		LinesParsed:   uint64(parsed),
+		LinesSkipped:  uint64(lines - parsed),
+		UnknownFields: uint64(len(unknown)),
+	}
+	if len(missing) > 0 {
+		stats.SchemaMismatches = 1
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.parseStats.add(stats)
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"testing"
+
+	"github.com/thelande/mb8600/pkg/mb8600test"
+)
+
+func Test_countChannelLines(t *testing.T) {
+	tests := []struct {
+		response string
+		want     int
+	}{
+		{"", 0},
+		{"1^Locked^", 1},
+		{"1^Locked^|+|2^Locked^|+|", 2},
+	}
+	for _, tt := range tests {
+		if got := countChannelLines(tt.response); got != tt.want {
+			t.Errorf("countChannelLines(%q) = %v, want %v", tt.response, got, tt.want)
+		}
+	}
+}
+
+func TestMotoClient_ParseStats(t *testing.T) {
+	modem := mb8600test.NewModem(username, password)
+	server := mb8600test.NewServer(modem)
+	defer server.Close()
+
+	c := NewMotoClient(mb8600test.Address(server), username, password, logger)
+	if _, err := c.Login(); err != nil {
+		t.Fatalf("MotoClient.Login() error = %v", err)
+	}
+
+	if _, err := c.GetDownstreamChannels(); err != nil {
+		t.Fatalf("MotoClient.GetDownstreamChannels() error = %v", err)
+	}
+	want := ParseStats{LinesParsed: 5}
+	if got := c.ParseStats(); got != want {
+		t.Errorf("MotoClient.ParseStats() = %+v, want %+v", got, want)
+	}
+
+	modem.SetResponse("GetMotoStatusUpstreamChannelInfo", map[string]string{
+		"MotoConnUpstreamChannel": "1^Locked^SC-QAM^4^5120^35.6^56.0^|+|2^Locked^",
+		"MotoConnUpstreamNew":     "1",
+	})
+	if _, err := c.GetUpstreamChannels(); err == nil {
+		t.Errorf("MotoClient.GetUpstreamChannels() error = nil, want error")
+	}
+	want = ParseStats{LinesParsed: 5, LinesSkipped: 2, UnknownFields: 1}
+	if got := c.ParseStats(); got != want {
+		t.Errorf("MotoClient.ParseStats() = %+v, want %+v", got, want)
+	}
+
+	modem.SetResponse("GetMotoStatusUpstreamChannelInfo", map[string]string{})
+	if _, err := c.GetUpstreamChannels(); err != nil {
+		t.Errorf("MotoClient.GetUpstreamChannels() error = %v", err)
+	}
+	before := want
+	want.SchemaMismatches = 1
+	if got := c.ParseStats(); got != want {
+		t.Errorf("MotoClient.ParseStats() = %+v, want %+v", got, want)
+	}
+	if got := c.ParseStats().Sub(before); got != (ParseStats{SchemaMismatches: 1}) {
+		t.Errorf("ParseStats.Sub() = %+v, want one schema mismatch", got)
+	}
+}
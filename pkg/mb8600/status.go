@@ -0,0 +1,198 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// The actions GetStatus gathers its data from.
+	statusActions = []string{
+		"GetMotoStatusSoftware",
+		"GetMotoStatusConnectionInfo",
+		"GetMotoStatusStartupSequence",
+		"GetMotoStatusDownstreamChannelInfo",
+		"GetMotoStatusUpstreamChannelInfo",
+	}
+)
+
+// Everything the modem reports about its state, as gathered by GetStatus.
+type ModemStatus struct {
+	Time       time.Time            `json:"time"`
+	Software   *SoftwareStatus      `json:"software"`
+	Connection *ConnectionInfo      `json:"connection"`
+	Startup    *StartupSequence     `json:"startup"`
+	Downstream []*DownstreamChannel `json:"downstream"`
+	Upstream   []*UpstreamChannel   `json:"upstream"`
+}
+
+// Returns the channels and connection state of the status as a Snapshot.
+func (s *ModemStatus) Snapshot() *Snapshot {
+	snapshot := &Snapshot{
+		Time:       s.Time,
+		Downstream: s.Downstream,
+		Upstream:   s.Upstream,
+		Connection: s.Connection,
+	}
+	if s.Connection != nil {
+		partial := s.Connection.PartialService()
+		snapshot.PartialService = &partial
+	}
+	return snapshot
+}
+
+// Logs in if the client has not done so yet, then gathers the software
+// status, connection info, startup sequence and both channel lists.
+//
+// The data is fetched with one request per action, issued concurrently if the
+// client was created WithConcurrency, or with a single GetMultipleHNAPs
+// request if the client was created WithMultipleHNAPs.
+func (c *MotoClient) GetStatus() (*ModemStatus, error) {
+	return c.GetStatusContext(context.Background())
+}
+
+// Gathers the status like GetStatus, carrying ctx, e.g. to cancel the
+// requests or to parent their trace spans.
+func (c *MotoClient) GetStatusContext(ctx context.Context) (*ModemStatus, error) {
+	if err := c.ensureLogin(ctx); err != nil {
+		return nil, err
+	}
+
+	var responses map[string]map[string]string
+	var err error
+	if c.multipleHNAPs {
+		responses, err = c.doMultiple(ctx, statusActions)
+	} else {
+		responses, err = c.doEach(ctx, statusActions)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	status := &ModemStatus{
+		Time:     time.Now(),
+		Software: NewSoftwareStatusFromResponse(responses["GetMotoStatusSoftware"]),
+		Startup:  NewStartupSequenceFromResponse(responses["GetMotoStatusStartupSequence"]),
+	}
+
+	status.Connection, err = NewConnectionInfoFromResponse(responses["GetMotoStatusConnectionInfo"], responses["GetMotoStatusStartupSequence"])
+	if err != nil {
+		return nil, err
+	}
+
+	status.Downstream, err = c.parseDownstream(responses["GetMotoStatusDownstreamChannelInfo"])
+	if err != nil {
+		return nil, err
+	}
+
+	status.Upstream, err = c.parseUpstream(responses["GetMotoStatusUpstreamChannelInfo"])
+	if err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// Logs in unless the client is already authenticated.
+func (c *MotoClient) ensureLogin(ctx context.Context) error {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+
+	if c.authenticated {
+		return nil
+	}
+	_, err := c.login(ctx)
+	return err
+}
+
+// Performs each of actions, returning the responses keyed by action. Up to
+// the client's concurrency limit of actions are in flight at once. The
+// failures of all actions are joined into the returned error.
+func (c *MotoClient) doEach(ctx context.Context, actions []string) (map[string]map[string]string, error) {
+	results := make([]map[string]string, len(actions))
+	errs := make([]error, len(actions))
+
+	limit := max(c.concurrency, 1)
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for idx, action := range actions {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(idx int, action string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[idx], errs[idx] = c.doContext(ctx, action, nil)
+		}(idx, action)
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	responses := make(map[string]map[string]string, len(actions))
+	for idx, action := range actions {
+		responses[action] = results[idx]
+	}
+	return responses, nil
+}
+
+// Performs actions with a single GetMultipleHNAPs request, returning the
+// responses keyed by action. The responses are cached if caching is enabled.
+func (c *MotoClient) doMultiple(ctx context.Context, actions []string) (map[string]map[string]string, error) {
+	params := make(map[string]string, len(actions))
+	for _, action := range actions {
+		params[action] = ""
+	}
+
+	// The batch is not passed through the cache, as it would otherwise be
+	// treated as a state-changing action.
+	resp, err := c.doRetry(ctx, multipleHNAPsAction, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var result string
+	if err := json.Unmarshal([]byte(resp[resultField(multipleHNAPsAction)]), &result); err == nil && result != "OK" {
+		return nil, fmt.Errorf("%s failed: %s", multipleHNAPsAction, result)
+	}
+
+	responses := make(map[string]map[string]string, len(actions))
+	for _, action := range actions {
+		raw, ok := resp[action+"Response"]
+		if !ok {
+			return nil, fmt.Errorf("action, %s: no response from modem", action)
+		}
+
+		var fields map[string]string
+		if err := json.Unmarshal([]byte(raw), &fields); err != nil {
+			return nil, fmt.Errorf("action, %s: %w", action, err)
+		}
+		logDebug(c.Logger, "msg", "received response", "action", action, "data", redacted{fields: fields})
+
+		responses[action] = fields
+		if c.cache != nil {
+			c.cache.put(action, fields)
+		}
+	}
+	return responses, nil
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/mb8600test"
+)
+
+func TestMotoClient_GetStatus(t *testing.T) {
+	tests := []struct {
+		name         string
+		opts         []Option
+		wantRequests []string
+	}{
+		{
+			"sequential",
+			nil,
+			[]string{"Login", "Login", "GetMotoStatusSoftware", "GetMotoStatusConnectionInfo", "GetMotoStatusStartupSequence", "GetMotoStatusDownstreamChannelInfo", "GetMotoStatusUpstreamChannelInfo"},
+		},
+		{
+			"batched",
+			[]Option{WithMultipleHNAPs()},
+			[]string{"Login", "Login", "GetMultipleHNAPs"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modem := mb8600test.NewModem(username, password)
+			server := mb8600test.NewServer(modem)
+			defer server.Close()
+
+			c := NewMotoClient(mb8600test.Address(server), username, password, logger, tt.opts...)
+			status, err := c.GetStatus()
+			if err != nil {
+				t.Fatalf("MotoClient.GetStatus() error = %v", err)
+			}
+			if got := modem.Requests(); !reflect.DeepEqual(got, tt.wantRequests) {
+				t.Errorf("Modem.Requests() = %v, want %v", got, tt.wantRequests)
+			}
+
+			if status.Software.SoftwareVersion != "8600-19.3.18" || !status.Connection.NetworkAccessAllowed() ||
+				status.Startup.SecurityComment != "BPI+" || len(status.Downstream) != 5 || len(status.Upstream) != 4 {
+				t.Errorf("MotoClient.GetStatus() = %+v", status)
+			}
+			if got := status.Snapshot().LockedUpstreamChannels(); got != 4 {
+				t.Errorf("ModemStatus.Snapshot().LockedUpstreamChannels() = %v, want 4", got)
+			}
+
+			// An authenticated client does not log in again.
+			if _, err := c.GetStatus(); err != nil {
+				t.Fatalf("MotoClient.GetStatus() error = %v", err)
+			}
+			if got := modem.Requests(); got[len(tt.wantRequests)] == "Login" {
+				t.Errorf("MotoClient.GetStatus() logged in again: %v", got)
+			}
+
+			modem.SetStatus("GetMotoStatusUpstreamChannelInfo", http.StatusInternalServerError)
+			if _, err := c.GetStatus(); err == nil {
+				t.Errorf("MotoClient.GetStatus() error = nil, want error")
+			}
+		})
+	}
+}
+
+// Serves modem while tracking the greatest number of concurrent requests.
+type concurrencyTracker struct {
+	modem *mb8600test.Modem
+
+	mu      sync.Mutex
+	current int
+	peak    int
+}
+
+func (t *concurrencyTracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t.mu.Lock()
+	t.current++
+	t.peak = max(t.peak, t.current)
+	t.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+	t.modem.ServeHTTP(w, r)
+
+	t.mu.Lock()
+	t.current--
+	t.mu.Unlock()
+}
+
+func TestMotoClient_GetStatus_concurrency(t *testing.T) {
+	tests := []struct {
+		limit   int
+		wantMax int
+	}{
+		{0, 1},
+		{1, 1},
+		{3, 3},
+		{10, 5},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.limit), func(t *testing.T) {
+			tracker := &concurrencyTracker{modem: mb8600test.NewModem(username, password)}
+			server := httptest.NewTLSServer(tracker)
+			defer server.Close()
+
+			c := NewMotoClient(mb8600test.Address(server), username, password, logger, WithConcurrency(tt.limit))
+			if _, err := c.GetStatus(); err != nil {
+				t.Fatalf("MotoClient.GetStatus() error = %v", err)
+			}
+			if tracker.peak > tt.wantMax || (tt.wantMax > 1 && tracker.peak < 2) {
+				t.Errorf("peak concurrent requests = %v, want at most %v and concurrent", tracker.peak, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestMotoClient_GetStatus_joinedErrors(t *testing.T) {
+	modem := mb8600test.NewModem(username, password)
+	server := mb8600test.NewServer(modem)
+	defer server.Close()
+
+	modem.SetStatus("GetMotoStatusSoftware", http.StatusInternalServerError)
+	modem.SetStatus("GetMotoStatusUpstreamChannelInfo", http.StatusServiceUnavailable)
+
+	c := NewMotoClient(mb8600test.Address(server), username, password, logger, WithConcurrency(5))
+	_, err := c.GetStatus()
+
+	var codes []int
+	for _, err := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) {
+			codes = append(codes, statusErr.StatusCode)
+		}
+	}
+	if want := []int{http.StatusInternalServerError, http.StatusServiceUnavailable}; !reflect.DeepEqual(codes, want) {
+		t.Errorf("MotoClient.GetStatus() error = %v, want status codes %v", err, want)
+	}
+}
+
+func TestMotoClient_GetStatus_relogin(t *testing.T) {
+	modem := mb8600test.NewModem(username, password)
+	server := mb8600test.NewServer(modem)
+	defer server.Close()
+
+	c := NewMotoClient(mb8600test.Address(server), username, password, logger, WithMultipleHNAPs(), WithCache(time.Minute))
+	if _, err := c.GetStatus(); err != nil {
+		t.Fatalf("MotoClient.GetStatus() error = %v", err)
+	}
+
+	// A stale session is renewed for batched requests too.
+	modem.Logout()
+	if _, err := c.GetStatus(); err != nil {
+		t.Fatalf("MotoClient.GetStatus() after logout error = %v", err)
+	}
+
+	// The batched responses populate the cache.
+	before := len(modem.Requests())
+	if _, err := c.GetUpstreamChannels(); err != nil {
+		t.Fatalf("MotoClient.GetUpstreamChannels() error = %v", err)
+	}
+	if got := len(modem.Requests()); got != before {
+		t.Errorf("MotoClient.GetUpstreamChannels() made %d requests, want 0", got-before)
+	}
+}
+
+func TestMotoClient_allowed_multipleHNAPs(t *testing.T) {
+	c := NewMotoClient("192.168.100.1", username, password, logger, WithModel(ModelMB7621))
+	tests := []struct {
+		name   string
+		params map[string]string
+		want   bool
+	}{
+		{"supported", map[string]string{"GetMotoStatusSoftware": ""}, true},
+		{"unsupported", map[string]string{"GetMotoStatusSoftware": "", "GetMotoLagStatus": ""}, false},
+		{"empty", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.allowed(multipleHNAPsAction, tt.params); got != tt.want {
+				t.Errorf("MotoClient.allowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
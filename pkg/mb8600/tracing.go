@@ -0,0 +1,71 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The instrumentation name of the client's tracer.
+const tracerName = "github.com/thelande/mb8600/pkg/mb8600"
+
+// The attributes set on the client's spans.
+const (
+	// The HNAP action, e.g. "GetMotoStatusLog".
+	AttributeAction = attribute.Key("hnap.action")
+	// The modem address the client was created with.
+	AttributeAddress = attribute.Key("server.address")
+	// The HTTP status code of the last attempt, if a response was received.
+	AttributeStatusCode = attribute.Key("http.response.status_code")
+	// The number of retries after the first attempt.
+	AttributeRetries = attribute.Key("hnap.retries")
+)
+
+// Starts the client span of an HNAP action, named "HNAP <action>". Without
+// a tracer, the span does nothing.
+func (c *MotoClient) startSpan(ctx context.Context, action string) (context.Context, trace.Span) {
+	if c.tracer == nil {
+		return ctx, trace.SpanFromContext(context.Background())
+	}
+	return c.tracer.Start(ctx, "HNAP "+action,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(AttributeAction.String(action), AttributeAddress.String(c.Address)),
+	)
+}
+
+// Records the outcome of an action on its span and ends it.
+func endSpan(span trace.Span, retries int, err error) {
+	span.SetAttributes(AttributeRetries.Int(retries))
+
+	var statusErr *StatusError
+	switch {
+	case err == nil:
+		span.SetAttributes(AttributeStatusCode.Int(http.StatusOK))
+	case errors.As(err, &statusErr):
+		span.SetAttributes(AttributeStatusCode.Int(statusErr.StatusCode))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/mb8600test"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Records the span in the context of each request.
+type spanTransport struct {
+	next  http.RoundTripper
+	spans []trace.SpanID
+}
+
+func (t *spanTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.spans = append(t.spans, trace.SpanFromContext(req.Context()).SpanContext().SpanID())
+	return t.next.RoundTrip(req)
+}
+
+// Returns the attributes of span as Go values.
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]any {
+	attributes := map[attribute.Key]any{}
+	for _, kv := range span.Attributes() {
+		attributes[kv.Key] = kv.Value.AsInterface()
+	}
+	return attributes
+}
+
+func TestMotoClient_WithTracerProvider(t *testing.T) {
+	modem := mb8600test.NewModem(username, password)
+	server := mb8600test.NewServer(modem)
+	defer server.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	defer provider.Shutdown(context.Background())
+	failing := &rebootingTransport{next: server.Client().Transport}
+	transport := &spanTransport{next: failing}
+	c := NewMotoClient(mb8600test.Address(server), username, password, logger,
+		WithTracerProvider(provider), WithTransport(transport), WithRetry(3, time.Millisecond))
+	c.retry.sleep = func(context.Context, time.Duration) error { return nil }
+
+	if _, err := c.Login(); err != nil {
+		t.Fatalf("MotoClient.Login() error = %v", err)
+	}
+
+	// The first attempt fails with a reset connection.
+	failing.down = failing.calls.Load() + 1
+	ctx, root := provider.Tracer("test").Start(context.Background(), "poll")
+	if _, err := c.DoActionContext(ctx, "GetMotoStatusLog", nil); err != nil {
+		t.Fatalf("MotoClient.DoActionContext() error = %v", err)
+	}
+	root.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("spans = %v, want 3", len(spans))
+	}
+	login, action := spans[0], spans[1]
+	if login.Name() != "HNAP Login" || login.Parent().IsValid() || login.Status().Code != codes.Unset {
+		t.Errorf("login span = %v, parent %v, status %v, want a root span", login.Name(), login.Parent(), login.Status())
+	}
+	if action.Name() != "HNAP GetMotoStatusLog" || action.Parent().SpanID() != root.SpanContext().SpanID() || action.SpanKind() != trace.SpanKindClient {
+		t.Errorf("action span = %v, parent %v, kind %v, want a client span child of the caller's span", action.Name(), action.Parent(), action.SpanKind())
+	}
+	want := map[attribute.Key]any{
+		AttributeAction:     "GetMotoStatusLog",
+		AttributeAddress:    mb8600test.Address(server),
+		AttributeRetries:    int64(1),
+		AttributeStatusCode: int64(http.StatusOK),
+	}
+	attributes := spanAttributes(action)
+	for key, value := range want {
+		if attributes[key] != value {
+			t.Errorf("action span attribute %s = %v, want %v", key, attributes[key], value)
+		}
+	}
+
+	// Both attempts of the action carried its span.
+	id := action.SpanContext().SpanID()
+	if n := len(transport.spans); n != 4 || transport.spans[2] != id || transport.spans[3] != id {
+		t.Errorf("request spans = %v, want the action span on both attempts", transport.spans)
+	}
+
+	modem.SetStatus("GetMotoStatusSoftware", http.StatusInternalServerError)
+	c.DoAction("GetMotoStatusSoftware", nil)
+	spans = recorder.Ended()
+	failed := spans[len(spans)-1]
+	attributes = spanAttributes(failed)
+	if failed.Status().Code != codes.Error || attributes[AttributeStatusCode] != int64(http.StatusInternalServerError) || attributes[AttributeRetries] != int64(2) {
+		t.Errorf("failed span status %v, attributes %v, want an error, status 500 and 2 retries", failed.Status(), attributes)
+	}
+}
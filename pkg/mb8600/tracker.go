@@ -0,0 +1,133 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// When a channel was first observed and last seen locked. Channels are
+// identified by direction and frequency, as channel IDs are reassigned when
+// the modem re-ranges.
+type ChannelHistory struct {
+	Direction string  `json:"direction"`
+	Frequency float64 `json:"frequency_mhz"`
+	// The channel ID most recently reported for the frequency.
+	ChannelID int       `json:"channel_id"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	// The zero time if the channel was never seen locked.
+	LastLocked time.Time `json:"last_locked"`
+}
+
+type channelKey struct {
+	direction string
+	frequency float64
+}
+
+// Tracks the history of every channel observed in a series of snapshots. It
+// is safe for concurrent use, and its state can be persisted as JSON.
+type ChannelTracker struct {
+	mu       sync.RWMutex
+	channels map[channelKey]*ChannelHistory
+}
+
+// Returns an empty ChannelTracker.
+func NewChannelTracker() *ChannelTracker {
+	return &ChannelTracker{channels: map[channelKey]*ChannelHistory{}}
+}
+
+// Records the channels in snapshot.
+func (t *ChannelTracker) Observe(snapshot *Snapshot) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, ch := range snapshot.Downstream {
+		t.observe(DirectionDownstream, ch.Frequency, ch.ChannelID, ch.LockStatus, snapshot.Time)
+	}
+	for _, ch := range snapshot.Upstream {
+		t.observe(DirectionUpstream, ch.Frequency, ch.ChannelID, ch.LockStatus, snapshot.Time)
+	}
+}
+
+func (t *ChannelTracker) observe(direction string, frequency float64, channelID int, lockStatus string, now time.Time) {
+	key := channelKey{direction, frequency}
+	h, ok := t.channels[key]
+	if !ok {
+		h = &ChannelHistory{Direction: direction, Frequency: frequency, FirstSeen: now}
+		t.channels[key] = h
+	}
+
+	h.ChannelID = channelID
+	h.LastSeen = now
+	if lockStatus == "Locked" {
+		h.LastLocked = now
+	}
+}
+
+// Returns the history of every channel, ordered by direction and frequency.
+func (t *ChannelTracker) Channels() []ChannelHistory {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	channels := make([]ChannelHistory, 0, len(t.channels))
+	for _, h := range t.channels {
+		channels = append(channels, *h)
+	}
+	sort.Slice(channels, func(i, j int) bool {
+		if channels[i].Direction != channels[j].Direction {
+			return channels[i].Direction < channels[j].Direction
+		}
+		return channels[i].Frequency < channels[j].Frequency
+	})
+	return channels
+}
+
+// Returns the channels that were seen locked at some point, but not since
+// the given time, e.g. channels lost after an outage.
+func (t *ChannelTracker) LostSince(since time.Time) []ChannelHistory {
+	var lost []ChannelHistory
+	for _, h := range t.Channels() {
+		if !h.LastLocked.IsZero() && h.LastLocked.Before(since) {
+			lost = append(lost, h)
+		}
+	}
+	return lost
+}
+
+func (t *ChannelTracker) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Channels())
+}
+
+// Replaces the tracked state with the JSON produced by MarshalJSON.
+func (t *ChannelTracker) UnmarshalJSON(data []byte) error {
+	var channels []ChannelHistory
+	if err := json.Unmarshal(data, &channels); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.channels = make(map[channelKey]*ChannelHistory, len(channels))
+	for _, h := range channels {
+		h := h
+		t.channels[channelKey{h.Direction, h.Frequency}] = &h
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChannelTracker(t *testing.T) {
+	start := time.Date(2023, 12, 23, 20, 0, 0, 0, time.UTC)
+	tracker := NewChannelTracker()
+
+	tracker.Observe(&Snapshot{
+		Time: start,
+		Downstream: []*DownstreamChannel{
+			{ChannelID: 1, Frequency: 531, LockStatus: "Locked"},
+			{ChannelID: 2, Frequency: 537, LockStatus: "Locked"},
+		},
+		Upstream: []*UpstreamChannel{{ChannelID: 4, Frequency: 35.6, LockStatus: "Locked"}},
+	})
+	// The channel at 537 MHz is lost, and 531 MHz is renumbered.
+	tracker.Observe(&Snapshot{
+		Time: start.Add(time.Hour),
+		Downstream: []*DownstreamChannel{
+			{ChannelID: 3, Frequency: 531, LockStatus: "Locked"},
+			{ChannelID: 4, Frequency: 543, LockStatus: "Not Locked"},
+		},
+		Upstream: []*UpstreamChannel{{ChannelID: 4, Frequency: 35.6, LockStatus: "Locked"}},
+	})
+
+	want := []ChannelHistory{
+		{DirectionDownstream, 531, 3, start, start.Add(time.Hour), start.Add(time.Hour)},
+		{DirectionDownstream, 537, 2, start, start, start},
+		{DirectionDownstream, 543, 4, start.Add(time.Hour), start.Add(time.Hour), time.Time{}},
+		{DirectionUpstream, 35.6, 4, start, start.Add(time.Hour), start.Add(time.Hour)},
+	}
+	if got := tracker.Channels(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ChannelTracker.Channels() = %+v, want %+v", got, want)
+	}
+
+	if got := tracker.LostSince(start.Add(time.Minute)); !reflect.DeepEqual(got, want[1:2]) {
+		t.Errorf("ChannelTracker.LostSince() = %+v, want %+v", got, want[1:2])
+	}
+
+	data, err := json.Marshal(tracker)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	restored := NewChannelTracker()
+	if err := json.Unmarshal(data, restored); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if got := restored.Channels(); !reflect.DeepEqual(got, want) {
+		t.Errorf("restored ChannelTracker.Channels() = %+v, want %+v", got, want)
+	}
+}
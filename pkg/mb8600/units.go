@@ -0,0 +1,113 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"math"
+	"strconv"
+)
+
+// A frequency in megahertz, the unit the modem reports channel frequencies in.
+type MegaHertz float64
+
+// Returns the frequency in hertz.
+func (f MegaHertz) Hertz() float64 {
+	return float64(f) * 1e6
+}
+
+func (f MegaHertz) String() string {
+	return strconv.FormatFloat(float64(f), 'f', -1, 64) + " MHz"
+}
+
+// Returns the frequency given in hertz in megahertz.
+func MegaHertzFromHertz(hz float64) MegaHertz {
+	return MegaHertz(hz / 1e6)
+}
+
+// A power level in decibels relative to one millivolt, the unit the modem
+// reports channel power in.
+type DBmV float64
+
+// Returns the power level in decibels relative to one microvolt.
+func (p DBmV) DBuV() float64 {
+	return float64(p) + 60
+}
+
+// Returns the power level as a voltage in millivolts.
+func (p DBmV) Millivolts() float64 {
+	return math.Pow(10, float64(p)/20)
+}
+
+func (p DBmV) String() string {
+	return strconv.FormatFloat(float64(p), 'f', -1, 64) + " dBmV"
+}
+
+// A ratio in decibels, the unit the modem reports the signal-to-noise ratio
+// (or MER, for OFDM channels) in.
+type DB float64
+
+// Returns the ratio as a plain power ratio.
+func (r DB) Ratio() float64 {
+	return math.Pow(10, float64(r)/10)
+}
+
+func (r DB) String() string {
+	return strconv.FormatFloat(float64(r), 'f', -1, 64) + " dB"
+}
+
+// A symbol rate in kilosymbols per second, the unit the modem reports upstream
+// symbol rates in.
+type KiloSymbolsPerSecond float64
+
+// Returns the symbol rate in symbols per second.
+func (r KiloSymbolsPerSecond) SymbolsPerSecond() float64 {
+	return float64(r) * 1e3
+}
+
+func (r KiloSymbolsPerSecond) String() string {
+	return strconv.FormatFloat(float64(r), 'f', -1, 64) + " Ksym/s"
+}
+
+// Returns the center frequency of the channel, or the PLC frequency for an
+// OFDM PLC row.
+func (c *DownstreamChannel) FrequencyMHz() MegaHertz {
+	return MegaHertz(c.Frequency)
+}
+
+// Returns the received power of the channel.
+func (c *DownstreamChannel) PowerDBmV() DBmV {
+	return DBmV(c.Power)
+}
+
+// Returns the signal-to-noise ratio (MER for OFDM) of the channel.
+func (c *DownstreamChannel) SNRdB() DB {
+	return DB(c.SignalToNoise)
+}
+
+// Returns the center frequency of the channel.
+func (c *UpstreamChannel) FrequencyMHz() MegaHertz {
+	return MegaHertz(c.Frequency)
+}
+
+// Returns the transmit power of the channel.
+func (c *UpstreamChannel) PowerDBmV() DBmV {
+	return DBmV(c.Power)
+}
+
+// Returns the symbol rate of the channel.
+func (c *UpstreamChannel) SymbolRateKsyms() KiloSymbolsPerSecond {
+	return KiloSymbolsPerSecond(c.SymbolRate)
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"math"
+	"testing"
+)
+
+func TestUnits(t *testing.T) {
+	near := func(got, want float64) bool { return math.Abs(got-want) < 1e-9 }
+
+	tests := []struct {
+		name      string
+		got, want float64
+	}{
+		{"MegaHertz.Hertz", MegaHertz(531).Hertz(), 531e6},
+		{"MegaHertzFromHertz", float64(MegaHertzFromHertz(35.6e6)), 35.6},
+		{"DBmV.DBuV", DBmV(2.8).DBuV(), 62.8},
+		{"DBmV.Millivolts", DBmV(20).Millivolts(), 10},
+		{"DB.Ratio", DB(30).Ratio(), 1000},
+		{"KiloSymbolsPerSecond.SymbolsPerSecond", KiloSymbolsPerSecond(5120).SymbolsPerSecond(), 5.12e6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !near(tt.got, tt.want) {
+				t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+			}
+		})
+	}
+
+	if s := MegaHertz(531).String(); s != "531 MHz" {
+		t.Errorf("MegaHertz.String() = %q", s)
+	}
+	if s := DBmV(-0.7).String(); s != "-0.7 dBmV" {
+		t.Errorf("DBmV.String() = %q", s)
+	}
+}
+
+func TestChannelUnits(t *testing.T) {
+	if got := expDownstreamChannel.FrequencyMHz(); got != 531 {
+		t.Errorf("DownstreamChannel.FrequencyMHz() = %v, want 531 MHz", got)
+	}
+	if got := expDownstreamChannel.PowerDBmV(); got != 2.8 {
+		t.Errorf("DownstreamChannel.PowerDBmV() = %v, want 2.8 dBmV", got)
+	}
+	if got := expDownstreamChannel.SNRdB(); got != 45.1 {
+		t.Errorf("DownstreamChannel.SNRdB() = %v, want 45.1 dB", got)
+	}
+
+	// The upstream row 1^Locked^SC-QAM^4^5120^35.6^56.0^ holds the symbol
+	// rate, frequency and power in that order.
+	ch, err := NewUpstreamChannelFromLine("1^Locked^SC-QAM^4^5120^35.6^56.0^")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ch.SymbolRateKsyms() != 5120 || ch.FrequencyMHz() != 35.6 || ch.PowerDBmV() != 56 {
+		t.Errorf("UpstreamChannel = %v, %v, %v, want 5120 Ksym/s, 35.6 MHz, 56 dBmV", ch.SymbolRateKsyms(), ch.FrequencyMHz(), ch.PowerDBmV())
+	}
+}
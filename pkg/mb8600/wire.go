@@ -0,0 +1,191 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// Holds the buffers used for request and response bodies, which are reused
+// across requests to keep frequent polling from churning the heap.
+var bufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// A pooled buffer shared by a request and the bodies read from it, returned
+// to bufferPool once all of them are released.
+type pooledBuffer struct {
+	buf  *bytes.Buffer
+	refs atomic.Int32
+}
+
+func newPooledBuffer() *pooledBuffer {
+	p := &pooledBuffer{buf: bufferPool.Get().(*bytes.Buffer)}
+	p.buf.Reset()
+	p.refs.Store(1)
+	return p
+}
+
+func (p *pooledBuffer) release() {
+	if p.refs.Add(-1) == 0 {
+		bufferPool.Put(p.buf)
+	}
+}
+
+// Returns a body reading the buffer, which holds a reference to it until it
+// is closed. The transport may close a request body after the response is
+// returned, so the buffer cannot be released before then.
+func (p *pooledBuffer) body() io.ReadCloser {
+	p.refs.Add(1)
+	return &pooledBody{Reader: bytes.NewReader(p.buf.Bytes()), p: p}
+}
+
+type pooledBody struct {
+	*bytes.Reader
+	p    *pooledBuffer
+	once sync.Once
+}
+
+func (b *pooledBody) Close() error {
+	b.once.Do(b.p.release)
+	return nil
+}
+
+// Returns the HNAP request for action with params in the given encoding,
+// signed with the client's current private key, and the headers set on it. The request body is held in
+// the returned buffer, which the caller must release once the request is done.
+//
+// Modems are picky about the exact body and headers, so changes to the wire
+// format must keep the golden files in testdata/wire passing.
+func (c *MotoClient) newRequest(ctx context.Context, action string, params map[string]string, encoding Encoding) (*http.Request, map[string]string, *pooledBuffer, error) {
+	p := newPooledBuffer()
+	var err error
+	if encoding == EncodingXML {
+		err = encodeXMLRequest(p.buf, c.soapNamespace, action, params)
+	} else {
+		err = encodeRequest(p.buf, action, params)
+	}
+	if err != nil {
+		p.release()
+		return nil, nil, nil, err
+	}
+
+	hnapAuth, err := c.hnapAuth(action)
+	if err != nil {
+		p.release()
+		return nil, nil, nil, err
+	}
+	headers := map[string]string{
+		"Accept":       "application/json",
+		"Content-Type": "application/json",
+		"SOAPAction":   c.soapNamespace + action,
+		"HNAP_AUTH":    hnapAuth,
+	}
+	if encoding == EncodingXML {
+		headers["Accept"] = "text/xml"
+		headers["Content-Type"] = "text/xml; charset=utf-8"
+		headers["SOAPAction"] = `"` + c.soapNamespace + action + `"`
+	}
+	if c.userAgent != "" {
+		headers["User-Agent"] = c.userAgent
+	}
+	for name, value := range c.extraHeaders {
+		headers[name] = value
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.GetHNAPURI(), p.body())
+	if err != nil {
+		p.release()
+		return nil, nil, nil, err
+	}
+	req.ContentLength = int64(p.buf.Len())
+	req.GetBody = func() (io.ReadCloser, error) { return p.body(), nil }
+
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	return req, headers, p, nil
+}
+
+// Writes the body of a request for action with params, {"<action>":{...}},
+// as json.Marshal would encode it. Nil params are encoded as an empty object.
+func encodeRequest(buf *bytes.Buffer, action string, params map[string]string) error {
+	enc := json.NewEncoder(buf)
+
+	buf.WriteByte('{')
+	if err := enc.Encode(action); err != nil {
+		return err
+	}
+	buf.Truncate(buf.Len() - 1)
+	buf.WriteByte(':')
+	if len(params) == 0 {
+		buf.WriteString("{}}")
+		return nil
+	}
+	if err := enc.Encode(params); err != nil {
+		return err
+	}
+	buf.Truncate(buf.Len() - 1)
+	buf.WriteByte('}')
+	return nil
+}
+
+// Returns the fields of the response to action in body.
+func decodeResponse(action string, body []byte) (map[string]string, error) {
+	if action == multipleHNAPsAction {
+		return decodeMultipleResponse(body)
+	}
+
+	var data map[string]map[string]string
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, err
+	}
+
+	value, ok := data[fmt.Sprintf("%sResponse", action)]
+	if !ok {
+		return nil, fmt.Errorf("no response from modem")
+	}
+	return value, nil
+}
+
+// Decodes the body of a GetMultipleHNAPs response, whose fields are the
+// responses to the batched actions. Returns the JSON encoding of each
+// response keyed by "<Action>Response", which keeps the result usable by the
+// rest of the request pipeline.
+func decodeMultipleResponse(body []byte) (map[string]string, error) {
+	var data map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, err
+	}
+
+	fields, ok := data[multipleHNAPsAction+"Response"]
+	if !ok {
+		return nil, fmt.Errorf("no response from modem")
+	}
+
+	resp := make(map[string]string, len(fields))
+	for key, value := range fields {
+		resp[key] = string(value)
+	}
+	return resp, nil
+}
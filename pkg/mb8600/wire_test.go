@@ -0,0 +1,193 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/thelande/mb8600/pkg/mb8600test"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// Records the requests sent by a client, serving them with handler instead of
+// the network.
+type recordingTransport struct {
+	handler  http.Handler
+	requests map[string][]string
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	action := strings.TrimPrefix(req.Header.Get("SOAPAction"), soapNamespace)
+	t.requests[action] = append(t.requests[action], formatWireRequest(req, body))
+
+	rec := httptest.NewRecorder()
+	t.handler.ServeHTTP(rec, req)
+	return rec.Result(), nil
+}
+
+// Returns the method, URL, headers in canonical order and body of req.
+func formatWireRequest(req *http.Request, body []byte) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s\n", req.Method, req.URL)
+
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		for _, value := range req.Header[name] {
+			fmt.Fprintf(&b, "%s: %s\n", name, value)
+		}
+	}
+
+	fmt.Fprintf(&b, "\n%s\n", body)
+	return b.String()
+}
+
+// Compares got with the golden file testdata/wire/<name>.golden, rewriting it
+// instead if -update is set.
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+
+	path := filepath.Join("testdata", "wire", name+".golden")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unable to read golden file (run with -update to create it): %v", err)
+	}
+	if got != string(want) {
+		t.Errorf("wire format of %s changed:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+func Test_encodeRequest(t *testing.T) {
+	tests := []struct {
+		action string
+		params map[string]string
+	}{
+		{"GetMotoStatusLog", nil},
+		{"GetMotoStatusLog", map[string]string{}},
+		{"Login", map[string]string{"Username": "admin", "LoginPassword": "<&>\"", "Action": "request"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			params := tt.params
+			if params == nil {
+				params = map[string]string{}
+			}
+			want, _ := json.Marshal(map[string]map[string]string{tt.action: params})
+
+			var b bytes.Buffer
+			if err := encodeRequest(&b, tt.action, tt.params); err != nil {
+				t.Fatalf("encodeRequest() error = %v", err)
+			}
+			if got := b.String(); got != string(want) {
+				t.Errorf("encodeRequest() = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestWireFormat(t *testing.T) {
+	transport := &recordingTransport{
+		handler:  mb8600test.NewModem(username, password),
+		requests: map[string][]string{},
+	}
+	c := NewMotoClientWithTimestamper(address, username, password, logger, &MockTimestamper{timestamp}, WithTransport(transport))
+
+	if _, err := c.Login(); err != nil {
+		t.Fatalf("MotoClient.Login() error = %v", err)
+	}
+	actions := slices.DeleteFunc(slices.Clone(knownActions), func(a string) bool { return a == "Login" })
+	for _, action := range actions {
+		if _, err := c.DoAction(action, nil); err != nil {
+			t.Fatalf("MotoClient.DoAction(%s) error = %v", action, err)
+		}
+	}
+	if _, err := c.doMultiple(context.Background(), statusActions); err != nil {
+		t.Fatalf("MotoClient.doMultiple() error = %v", err)
+	}
+
+	for _, action := range append([]string{"Login", multipleHNAPsAction}, actions...) {
+		t.Run(action, func(t *testing.T) {
+			requests := transport.requests[action]
+			if len(requests) == 0 {
+				t.Fatalf("no %s request recorded", action)
+			}
+			checkGolden(t, action, strings.Join(requests, "\n"))
+		})
+	}
+}
+
+// Answers every request with the same response body.
+type cannedTransport struct {
+	body []byte
+}
+
+func (t *cannedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		io.Copy(io.Discard, req.Body)
+		req.Body.Close()
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(t.body)),
+		Request:    req,
+	}, nil
+}
+
+func BenchmarkMotoClient_GetDownstreamChannels(b *testing.B) {
+	body := []byte(`{"GetMotoStatusDownstreamChannelInfoResponse":{"MotoConnDownstreamChannel":"` + downstreamResponse + `","GetMotoStatusDownstreamChannelInfoResult":"OK"}}`)
+	c := NewMotoClientWithTimestamper(address, username, password, NewNopLogger(), &MockTimestamper{timestamp}, WithTransport(&cannedTransport{body}))
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := c.GetDownstreamChannels(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package mb8600test provides a fake MB8600 HNAP endpoint for testing code
+// that uses the mb8600 client without a physical modem.
+//
+// The fake implements the two-phase Login challenge, verifies the HNAP_AUTH
+// digest of every request and serves configurable canned responses per action,
+// individually or batched with GetMultipleHNAPs:
+//
+//	modem := mb8600test.NewModem("admin", "motorola")
+//	server := mb8600test.NewServer(modem)
+//	defer server.Close()
+//	client := mb8600.NewMotoClient(mb8600test.Address(server), "admin", "motorola", logger)
+package mb8600test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/thelande/mb8600/pkg/mb8600/auth"
+)
+
+const (
+	soapNamespace     = auth.SOAPNamespace
+	defaultPrivateKey = auth.DefaultPrivateKey
+
+	multipleHNAPsAction = "GetMultipleHNAPs"
+
+	// The body returned when a request fails HNAP_AUTH verification.
+	UnauthorizedBody = "UN-AUTH"
+)
+
+// A fake modem implementing http.Handler.
+type Modem struct {
+	Username string
+	Password string
+
+	// The values handed out in the Login challenge.
+	PublicKey string
+	Challenge string
+	Cookie    string
+
+	// The keyed hash the modem authenticates with, HMAC-MD5 by default.
+	Digest auth.Digest
+	// The namespace of the SOAPAction header, auth.SOAPNamespace by default.
+	Namespace string
+	// Answers JSON requests with 500 Internal Server Error, as firmware that
+	// only accepts SOAP envelopes does. SOAP requests are always accepted.
+	SOAPOnly bool
+
+	mu         sync.Mutex
+	responses  map[string]map[string]string
+	statuses   map[string]int
+	privateKey string
+	loggedIn   bool
+	requests   []string
+}
+
+// Returns a fake modem accepting the given credentials and serving the
+// default responses.
+func NewModem(username, password string) *Modem {
+	m := &Modem{
+		Username:  username,
+		Password:  password,
+		PublicKey: "jXesCa9ek/lI0/R4TNdr",
+		Challenge: "q9l0h9ieIXKwJlEtTXps",
+		Cookie:    "1234567890",
+		Digest:    auth.HMACMD5,
+		Namespace: soapNamespace,
+		responses: map[string]map[string]string{},
+		statuses:  map[string]int{},
+	}
+	for action, fields := range DefaultResponses() {
+		m.responses[action] = fields
+	}
+	return m
+}
+
+// Starts a TLS test server for modem. Use Address to get the address to pass
+// to the client.
+func NewServer(modem *Modem) *httptest.Server {
+	return httptest.NewTLSServer(modem)
+}
+
+// Returns the host:port of server.
+func Address(server *httptest.Server) string {
+	return server.Listener.Addr().String()
+}
+
+// Sets the fields returned for action. The "<Action>Result" field is added
+// with the value "OK" if it is not present.
+func (m *Modem) SetResponse(action string, fields map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.responses[action] = fields
+}
+
+// Makes requests for action fail with the given HTTP status code. A code of
+// 0 or 200 restores normal behavior.
+func (m *Modem) SetStatus(action string, code int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.statuses[action] = code
+}
+
+// Forgets the current session, as the modem does on reboot or session expiry.
+func (m *Modem) Logout() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.loggedIn = false
+	m.privateKey = ""
+}
+
+// Returns the actions requested so far, in order.
+func (m *Modem) Requests() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.requests...)
+}
+
+func (m *Modem) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/HNAP1/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	action := strings.Trim(r.Header.Get("SOAPAction"), `"`)
+	action, ok := strings.CutPrefix(action, m.Namespace)
+	if !ok {
+		http.Error(w, "unknown SOAPAction namespace", http.StatusBadRequest)
+		return
+	}
+
+	soap := strings.Contains(r.Header.Get("Content-Type"), "xml")
+	if !soap && m.SOAPOnly {
+		http.Error(w, "unsupported request encoding", http.StatusInternalServerError)
+		return
+	}
+
+	var body map[string]map[string]string
+	var err error
+	if soap {
+		body, err = decodeSOAPRequest(r.Body)
+	} else {
+		err = json.NewDecoder(r.Body).Decode(&body)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	params, ok := body[action]
+	if !ok {
+		http.Error(w, "action does not match SOAPAction", http.StatusBadRequest)
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests = append(m.requests, action)
+
+	if code := m.statuses[action]; code != 0 && code != http.StatusOK {
+		w.WriteHeader(code)
+		return
+	}
+
+	if !m.authorized(action, params, r.Header.Get("HNAP_AUTH")) {
+		io.WriteString(w, UnauthorizedBody)
+		return
+	}
+
+	if action == multipleHNAPsAction {
+		writeResponse(w, soap, m.Namespace, action, m.multipleResponse(params))
+		return
+	}
+
+	var fields map[string]string
+	if action == "Login" {
+		fields = m.login(params)
+	} else {
+		fields = m.response(action)
+	}
+	if fields == nil {
+		http.Error(w, "unknown action", http.StatusNotFound)
+		return
+	}
+
+	response := make(map[string]any, len(fields))
+	for name, value := range fields {
+		response[name] = value
+	}
+	writeResponse(w, soap, m.Namespace, action, response)
+}
+
+// Writes the response to action with fields, in a SOAP envelope if soap is
+// set or as JSON otherwise.
+func writeResponse(w http.ResponseWriter, soap bool, namespace, action string, fields map[string]any) {
+	if soap {
+		w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		writeSOAPResponse(w, namespace, action, fields)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]map[string]any{action + "Response": fields})
+}
+
+// Verifies the HNAP_AUTH header, "<digest> <timestamp>", of a request.
+func (m *Modem) authorized(action string, params map[string]string, header string) bool {
+	digest, ts, ok := strings.Cut(header, " ")
+	if !ok {
+		return false
+	}
+	data := ts + m.Namespace + action
+
+	// A new challenge may be requested with or without an existing session.
+	if action == "Login" && params["Action"] == "request" {
+		return digest == m.Digest.Sum(defaultPrivateKey, data) ||
+			(m.privateKey != "" && digest == m.Digest.Sum(m.privateKey, data))
+	}
+
+	if m.privateKey == "" || (action != "Login" && !m.loggedIn) {
+		return false
+	}
+	return digest == m.Digest.Sum(m.privateKey, data)
+}
+
+func (m *Modem) login(params map[string]string) map[string]string {
+	switch params["Action"] {
+	case "request":
+		m.loggedIn = false
+		if params["Username"] != m.Username {
+			m.privateKey = ""
+			return map[string]string{"LoginResult": "FAILED"}
+		}
+		m.privateKey = m.Digest.Sum(m.PublicKey+m.Password, m.Challenge)
+		return map[string]string{
+			"LoginResult": "OK",
+			"Challenge":   m.Challenge,
+			"PublicKey":   m.PublicKey,
+			"Cookie":      m.Cookie,
+		}
+	case "login":
+		if params["LoginPassword"] != m.Digest.Sum(m.privateKey, m.Challenge) {
+			return map[string]string{"LoginResult": "FAILED"}
+		}
+		m.loggedIn = true
+		return map[string]string{"LoginResult": "OK"}
+	}
+	return map[string]string{"LoginResult": "FAILED"}
+}
+
+func (m *Modem) response(action string) map[string]string {
+	fields, ok := m.responses[action]
+	if !ok {
+		return nil
+	}
+
+	out := map[string]string{action + "Result": "OK"}
+	for key, value := range fields {
+		out[key] = value
+	}
+	return out
+}
+
+// Returns the response to a GetMultipleHNAPs request for the actions named by
+// params. The batch fails if any of the actions is unknown or set to fail.
+func (m *Modem) multipleResponse(params map[string]string) map[string]any {
+	out := map[string]any{multipleHNAPsAction + "Result": "OK"}
+	for action := range params {
+		fields := m.response(action)
+		if code := m.statuses[action]; fields == nil || (code != 0 && code != http.StatusOK) {
+			return map[string]any{multipleHNAPsAction + "Result": "ERROR"}
+		}
+		out[action+"Response"] = fields
+	}
+	return out
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mb8600test
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+func TestModem_login(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		password string
+		wantErr  bool
+	}{
+		{"valid", "admin", "motorola", false},
+		{"wrong password", "admin", "wrong", true},
+		{"wrong username", "root", "motorola", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer(NewModem("admin", "motorola"))
+			defer server.Close()
+
+			c := mb8600.NewMotoClient(Address(server), tt.username, tt.password, log.NewNopLogger())
+			if _, err := c.Login(); (err != nil) != tt.wantErr {
+				t.Errorf("MotoClient.Login() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestModem_actions(t *testing.T) {
+	modem := NewModem("admin", "motorola")
+	server := NewServer(modem)
+	defer server.Close()
+
+	c := mb8600.NewMotoClient(Address(server), "admin", "motorola", log.NewNopLogger())
+
+	if _, err := c.GetDownstreamChannels(); err == nil {
+		t.Errorf("MotoClient.GetDownstreamChannels() before login error = nil, want error")
+	}
+
+	if _, err := c.Login(); err != nil {
+		t.Fatalf("MotoClient.Login() error = %v", err)
+	}
+
+	downstream, err := c.GetDownstreamChannels()
+	if err != nil || len(downstream) != 5 {
+		t.Errorf("MotoClient.GetDownstreamChannels() = %v, %v, want 5 channels", len(downstream), err)
+	}
+
+	modem.SetResponse("GetMotoStatusUpstreamChannelInfo", map[string]string{
+		"MotoConnUpstreamChannel": "1^Locked^SC-QAM^4^5120^35.6^56.0^",
+	})
+	upstream, err := c.GetUpstreamChannels()
+	if err != nil || len(upstream) != 1 {
+		t.Errorf("MotoClient.GetUpstreamChannels() = %v, %v, want 1 channel", len(upstream), err)
+	}
+
+	modem.SetStatus("GetMotoStatusUpstreamChannelInfo", http.StatusInternalServerError)
+	if _, err := c.GetUpstreamChannels(); err == nil {
+		t.Errorf("MotoClient.GetUpstreamChannels() error = nil, want error")
+	}
+
+	// The client logs in again when the modem forgets the session.
+	modem.Logout()
+	if _, err := c.GetDownstreamChannels(); err != nil {
+		t.Errorf("MotoClient.GetDownstreamChannels() after logout error = %v", err)
+	}
+
+	want := []string{
+		"GetMotoStatusDownstreamChannelInfo",
+		"Login",
+		"Login",
+		"GetMotoStatusDownstreamChannelInfo",
+		"GetMotoStatusUpstreamChannelInfo",
+		"GetMotoStatusUpstreamChannelInfo",
+		"GetMotoStatusDownstreamChannelInfo",
+		"Login",
+		"Login",
+		"GetMotoStatusDownstreamChannelInfo",
+	}
+	if got := modem.Requests(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Modem.Requests() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600test
+
+const (
+	DownstreamChannels = "1^Locked^QAM256^20^531.0^ 2.8^45.1^0^0^|+|2^Locked^QAM256^13^489.0^ 3.1^45.4^0^0^|+|3^Locked^QAM256^14^495.0^ 3.0^45.5^10^0^|+|4^Locked^QAM256^15^501.0^ 3.0^41.6^0^0^|+|5^Locked^OFDM PLC^193^957.0^-0.7^43.0^-1565968621^150^"
+	UpstreamChannels   = "1^Locked^SC-QAM^4^5120^35.6^46.0^|+|2^Locked^SC-QAM^1^5120^16.4^45.5^|+|3^Locked^SC-QAM^2^5120^22.8^45.8^|+|4^Locked^SC-QAM^3^5120^29.2^46.0^"
+	EventLog           = "   18:56:01  ^  Sun Dec 24 2023  ^3^No Ranging Response received - T3 time-out;CM-MAC=00:00:00:00:00:00;CMTS-MAC=00:00:00:00:00:01;CM-QOS=1.1;CM-VER=3.1;}-{   Time Not Established  ^  Time Not Established  ^5^Cable Modem Reboot due to power reset^"
+)
+
+// Returns the responses a healthy modem gives for every status action, not
+// including the "<Action>Result" fields.
+func DefaultResponses() map[string]map[string]string {
+	return map[string]map[string]string{
+		"GetHomeConnection": {
+			"MotoHomeOnline":  "Connected",
+			"MotoHomeDownNum": "5",
+			"MotoHomeUpNum":   "4",
+		},
+		"GetHomeAddress": {
+			"MotoHomeMacAddress":  "00:11:22:33:44:55",
+			"MotoHomeIpAddress":   "203.0.113.10",
+			"MotoHomeIpv6Address": "2001:db8::10",
+			"MotoHomeSfVer":       "8600-19.3.18",
+		},
+		"GetMotoStatusSoftware": {
+			"StatusSoftwareSpecVer":     "DOCSIS 3.1",
+			"StatusSoftwareHdVer":       "V1.0",
+			"StatusSoftwareSfVer":       "8600-19.3.18",
+			"StatusSoftwareMac":         "00:11:22:33:44:55",
+			"StatusSoftwareSerialNum":   "2018123456789",
+			"StatusSoftwareCustomerVer": "Prod_19.3_d31",
+		},
+		"GetMotoStatusLog": {
+			"MotoStatusLogList": EventLog,
+		},
+		"GetMotoLagStatus": {
+			"MotoLagCurrentStatus": "0",
+		},
+		"GetMotoStatusConnectionInfo": {
+			"MotoConnSystemUpTime":  "7 days 00h:40m:06s",
+			"MotoConnNetworkAccess": "Allowed",
+		},
+		"GetMotoStatusDownstreamChannelInfo": {
+			"MotoConnDownstreamChannel": DownstreamChannels,
+		},
+		"GetMotoStatusStartupSequence": {
+			"MotoConnDSFreq":                   "531000000 Hz",
+			"MotoConnDSComment":                "Locked",
+			"MotoConnConnectivityStatus":       "OK",
+			"MotoConnConnectivityComment":      "Operational",
+			"MotoConnBootStatus":               "OK",
+			"MotoConnBootComment":              "Operational",
+			"MotoConnConfigurationFileStatus":  "OK",
+			"MotoConnConfigurationFileComment": "",
+			"MotoConnSecurityStatus":           "Enabled",
+			"MotoConnSecurityComment":          "BPI+",
+		},
+		"GetMotoStatusUpstreamChannelInfo": {
+			"MotoConnUpstreamChannel": UpstreamChannels,
+		},
+		"GetMotoStatusSecAccount": {
+			"CurrentUserName": "admin",
+		},
+	}
+}
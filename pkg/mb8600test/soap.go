@@ -0,0 +1,86 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mb8600test
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// An element of a SOAP request, with its text or child elements.
+type soapNode struct {
+	XMLName  xml.Name
+	Text     string     `xml:",chardata"`
+	Children []soapNode `xml:",any"`
+}
+
+// Decodes a SOAP request envelope into the params of its action, keyed by
+// the action, as the JSON requests are.
+func decodeSOAPRequest(r io.Reader) (map[string]map[string]string, error) {
+	var envelope soapNode
+	if err := xml.NewDecoder(r).Decode(&envelope); err != nil {
+		return nil, err
+	}
+	for _, body := range envelope.Children {
+		if body.XMLName.Local != "Body" || len(body.Children) != 1 {
+			continue
+		}
+		action := body.Children[0]
+		params := map[string]string{}
+		for _, param := range action.Children {
+			params[param.XMLName.Local] = param.Text
+		}
+		return map[string]map[string]string{action.XMLName.Local: params}, nil
+	}
+	return nil, fmt.Errorf("no action in SOAP envelope")
+}
+
+// Writes a SOAP response envelope for action with fields, which are strings
+// or, for GetMultipleHNAPs, maps of the fields of the batched responses.
+func writeSOAPResponse(w io.Writer, namespace, action string, fields map[string]any) {
+	io.WriteString(w, `<?xml version="1.0" encoding="utf-8"?>`+"\n"+
+		`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>`)
+	fmt.Fprintf(w, `<%sResponse xmlns="`, action)
+	xml.EscapeText(w, []byte(namespace))
+	io.WriteString(w, `">`)
+	writeSOAPFields(w, fields)
+	fmt.Fprintf(w, "</%sResponse></soap:Body></soap:Envelope>\n", action)
+}
+
+func writeSOAPFields(w io.Writer, fields map[string]any) {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(w, "<%s>", name)
+		switch value := fields[name].(type) {
+		case string:
+			xml.EscapeText(w, []byte(value))
+		case map[string]string:
+			nested := make(map[string]any, len(value))
+			for k, v := range value {
+				nested[k] = v
+			}
+			writeSOAPFields(w, nested)
+		}
+		fmt.Fprintf(w, "</%s>", name)
+	}
+}
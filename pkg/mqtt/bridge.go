@@ -0,0 +1,273 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+const (
+	DefaultDiscoveryPrefix = "homeassistant"
+	DefaultTopicPrefix     = "mb8600"
+
+	PayloadOnline  = "online"
+	PayloadOffline = "offline"
+)
+
+var invalidNodeIDRegexp = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// Publishes messages to an MQTT broker. It is implemented by *Client.
+type Publisher interface {
+	Publish(topic string, payload []byte, retain bool) error
+}
+
+var _ Publisher = (*Client)(nil)
+
+// The device a sensor belongs to, in the Home Assistant discovery format.
+type device struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model,omitempty"`
+	SWVersion    string   `json:"sw_version,omitempty"`
+	HWVersion    string   `json:"hw_version,omitempty"`
+}
+
+// A Home Assistant MQTT discovery sensor configuration.
+type sensorConfig struct {
+	Name              string  `json:"name"`
+	UniqueID          string  `json:"unique_id"`
+	StateTopic        string  `json:"state_topic"`
+	ValueTemplate     string  `json:"value_template"`
+	AvailabilityTopic string  `json:"availability_topic"`
+	UnitOfMeasurement string  `json:"unit_of_measurement,omitempty"`
+	DeviceClass       string  `json:"device_class,omitempty"`
+	StateClass        string  `json:"state_class,omitempty"`
+	EntityCategory    string  `json:"entity_category,omitempty"`
+	Device            *device `json:"device"`
+}
+
+// The payload of the state topic, which every sensor reads its value from.
+type state struct {
+	UptimeSeconds     int64                      `json:"uptime_seconds"`
+	NetworkAccess     string                     `json:"network_access"`
+	ConnectivityState string                     `json:"connectivity_state"`
+	SoftwareVersion   string                     `json:"software_version"`
+	LockedUpstream    int                        `json:"locked_upstream_channels"`
+	Downstream        map[string]downstreamState `json:"downstream"`
+	Upstream          map[string]upstreamState   `json:"upstream"`
+}
+
+type downstreamState struct {
+	SNR               float64 `json:"snr_db"`
+	Power             float64 `json:"power_dbmv"`
+	CorrectedErrors   float64 `json:"corrected_errors"`
+	UncorrectedErrors float64 `json:"uncorrected_errors"`
+}
+
+type upstreamState struct {
+	Power float64 `json:"power_dbmv"`
+}
+
+// Publishes snapshots of a modem as a Home Assistant device: a retained
+// discovery configuration per sensor, and a JSON state message per snapshot
+// that the sensors read their values from. Channel sensors are announced when
+// a channel appears and removed when it disappears.
+type Bridge struct {
+	publisher Publisher
+	// The prefix of discovery topics, DefaultDiscoveryPrefix by default.
+	DiscoveryPrefix string
+	// The prefix of state and availability topics, DefaultTopicPrefix by
+	// default.
+	TopicPrefix string
+
+	device *device
+	nodeID string
+
+	mu        sync.Mutex
+	announced map[string]bool
+}
+
+// Returns a bridge publishing to p for the modem described by software,
+// which identifies the device in Home Assistant.
+func NewBridge(p Publisher, software *mb8600.SoftwareStatus) *Bridge {
+	nodeID := NodeID(software)
+	dev := &device{
+		Identifiers:  []string{nodeID},
+		Name:         "Motorola cable modem",
+		Manufacturer: "Motorola",
+		SWVersion:    software.SoftwareVersion,
+		HWVersion:    software.HardwareVersion,
+	}
+	if model, err := mb8600.ModelFromSoftwareVersion(software.SoftwareVersion); err == nil {
+		dev.Model = string(model)
+		dev.Name = "Motorola " + string(model)
+	}
+
+	return &Bridge{
+		publisher:       p,
+		DiscoveryPrefix: DefaultDiscoveryPrefix,
+		TopicPrefix:     DefaultTopicPrefix,
+		device:          dev,
+		nodeID:          nodeID,
+		announced:       map[string]bool{},
+	}
+}
+
+// Returns the identifier of the modem in topics and unique IDs: its MAC
+// address without separators, or "mb8600" if it is not known.
+func NodeID(software *mb8600.SoftwareStatus) string {
+	id := strings.ToLower(invalidNodeIDRegexp.ReplaceAllString(software.MACAddress, ""))
+	if id == "" {
+		return DefaultTopicPrefix
+	}
+	return id
+}
+
+// Returns the topic the availability of the modem is published to, for use
+// in the client's will and birth messages.
+func AvailabilityTopic(topicPrefix, nodeID string) string {
+	return fmt.Sprintf("%s/%s/availability", topicPrefix, nodeID)
+}
+
+func (b *Bridge) stateTopic() string {
+	return fmt.Sprintf("%s/%s/state", b.TopicPrefix, b.nodeID)
+}
+
+func (b *Bridge) configTopic(objectID string) string {
+	return fmt.Sprintf("%s/sensor/%s/%s/config", b.DiscoveryPrefix, b.nodeID, objectID)
+}
+
+// Announces any new sensors, removes the sensors of lost channels and
+// publishes the state of snapshot.
+func (b *Bridge) Publish(snapshot *mb8600.Snapshot) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	st := state{
+		SoftwareVersion: b.device.SWVersion,
+		LockedUpstream:  snapshot.LockedUpstreamChannels(),
+		Downstream:      map[string]downstreamState{},
+		Upstream:        map[string]upstreamState{},
+	}
+	if conn := snapshot.Connection; conn != nil {
+		st.UptimeSeconds = int64(conn.Uptime.Seconds())
+		st.NetworkAccess = conn.NetworkAccess
+		st.ConnectivityState = conn.ConnectivityState()
+	}
+
+	sensors := b.modemSensors()
+	for _, ch := range snapshot.Downstream {
+		id := strconv.Itoa(ch.ChannelID)
+		st.Downstream[id] = downstreamState{ch.SignalToNoise, ch.Power, ch.CorrectedErrors, ch.UncorrectedErrors}
+		sensors = append(sensors,
+			b.sensor("downstream_"+id+"_snr", "Downstream "+id+" SNR", "{{ value_json.downstream['"+id+"'].snr_db }}", "dB", "signal_strength"),
+			b.sensor("downstream_"+id+"_power", "Downstream "+id+" power", "{{ value_json.downstream['"+id+"'].power_dbmv }}", "dBmV", ""),
+		)
+	}
+	for _, ch := range snapshot.Upstream {
+		id := strconv.Itoa(ch.ChannelID)
+		st.Upstream[id] = upstreamState{ch.Power}
+		sensors = append(sensors,
+			b.sensor("upstream_"+id+"_power", "Upstream "+id+" power", "{{ value_json.upstream['"+id+"'].power_dbmv }}", "dBmV", ""),
+		)
+	}
+
+	if err := b.announce(sensors); err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return b.publisher.Publish(b.stateTopic(), payload, false)
+}
+
+// Returns the sensors of the modem itself.
+func (b *Bridge) modemSensors() []*sensorConfig {
+	uptime := b.sensor("uptime", "Uptime", "{{ value_json.uptime_seconds }}", "s", "duration")
+	firmware := b.sensor("firmware", "Firmware", "{{ value_json.software_version }}", "", "")
+	firmware.StateClass = ""
+	firmware.EntityCategory = "diagnostic"
+	access := b.sensor("network_access", "Network access", "{{ value_json.network_access }}", "", "")
+	access.StateClass = ""
+	connectivity := b.sensor("connectivity_state", "Connectivity", "{{ value_json.connectivity_state }}", "", "")
+	connectivity.StateClass = ""
+	lockedUpstream := b.sensor("locked_upstream_channels", "Locked upstream channels", "{{ value_json.locked_upstream_channels }}", "", "")
+	return []*sensorConfig{uptime, firmware, access, connectivity, lockedUpstream}
+}
+
+// Returns a numeric sensor with the given object ID.
+func (b *Bridge) sensor(objectID, name, template, unit, deviceClass string) *sensorConfig {
+	return &sensorConfig{
+		Name:              name,
+		UniqueID:          b.nodeID + "_" + objectID,
+		StateTopic:        b.stateTopic(),
+		ValueTemplate:     template,
+		AvailabilityTopic: AvailabilityTopic(b.TopicPrefix, b.nodeID),
+		UnitOfMeasurement: unit,
+		DeviceClass:       deviceClass,
+		StateClass:        "measurement",
+		Device:            b.device,
+	}
+}
+
+// Publishes the configuration of the sensors not announced yet, and an empty
+// configuration, which deletes the sensor, for announced sensors missing
+// from sensors.
+func (b *Bridge) announce(sensors []*sensorConfig) error {
+	current := map[string]bool{}
+	for _, sensor := range sensors {
+		topic := b.configTopic(strings.TrimPrefix(sensor.UniqueID, b.nodeID+"_"))
+		current[topic] = true
+		if b.announced[topic] {
+			continue
+		}
+
+		payload, err := json.Marshal(sensor)
+		if err != nil {
+			return err
+		}
+		if err := b.publisher.Publish(topic, payload, true); err != nil {
+			return err
+		}
+		b.announced[topic] = true
+	}
+
+	var lost []string
+	for topic := range b.announced {
+		if !current[topic] {
+			lost = append(lost, topic)
+		}
+	}
+	sort.Strings(lost)
+	for _, topic := range lost {
+		if err := b.publisher.Publish(topic, nil, true); err != nil {
+			return err
+		}
+		delete(b.announced, topic)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mqtt
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+type recordingPublisher struct {
+	messages []Message
+}
+
+func (p *recordingPublisher) Publish(topic string, payload []byte, retain bool) error {
+	p.messages = append(p.messages, Message{topic, payload, retain})
+	return nil
+}
+
+func (p *recordingPublisher) topics() []string {
+	var topics []string
+	for _, m := range p.messages {
+		topics = append(topics, m.Topic)
+	}
+	return topics
+}
+
+func TestBridge(t *testing.T) {
+	software := &mb8600.SoftwareStatus{
+		SoftwareVersion: "8600-19.3.18",
+		HardwareVersion: "V1.0",
+		MACAddress:      "00:11:22:AA:BB:CC",
+	}
+	if got := NodeID(software); got != "001122aabbcc" {
+		t.Fatalf("NodeID() = %s, want 001122aabbcc", got)
+	}
+
+	p := &recordingPublisher{}
+	bridge := NewBridge(p, software)
+	snapshot := &mb8600.Snapshot{
+		Time:       time.Date(2023, 12, 23, 20, 0, 0, 0, time.UTC),
+		Downstream: []*mb8600.DownstreamChannel{{ChannelID: 20, SignalToNoise: 40.5, Power: 2.8}},
+		Upstream:   []*mb8600.UpstreamChannel{{ChannelID: 4, LockStatus: "Locked", Power: 56}},
+		Connection: &mb8600.ConnectionInfo{Uptime: 90 * time.Second, NetworkAccess: "Allowed", ConnectivityStatus: "OK"},
+	}
+	if err := bridge.Publish(snapshot); err != nil {
+		t.Fatalf("Bridge.Publish() error = %v", err)
+	}
+
+	want := []string{
+		"homeassistant/sensor/001122aabbcc/uptime/config",
+		"homeassistant/sensor/001122aabbcc/firmware/config",
+		"homeassistant/sensor/001122aabbcc/network_access/config",
+		"homeassistant/sensor/001122aabbcc/connectivity_state/config",
+		"homeassistant/sensor/001122aabbcc/locked_upstream_channels/config",
+		"homeassistant/sensor/001122aabbcc/downstream_20_snr/config",
+		"homeassistant/sensor/001122aabbcc/downstream_20_power/config",
+		"homeassistant/sensor/001122aabbcc/upstream_4_power/config",
+		"mb8600/001122aabbcc/state",
+	}
+	if got := p.topics(); !slices.Equal(got, want) {
+		t.Errorf("Bridge.Publish() topics = %v, want %v", got, want)
+	}
+
+	var config sensorConfig
+	if err := json.Unmarshal(p.messages[5].Payload, &config); err != nil {
+		t.Fatalf("invalid sensor config: %v", err)
+	}
+	if !p.messages[5].Retain || config.UnitOfMeasurement != "dB" || config.Device.Model != "MB8600" ||
+		config.AvailabilityTopic != "mb8600/001122aabbcc/availability" ||
+		config.ValueTemplate != "{{ value_json.downstream['20'].snr_db }}" {
+		t.Errorf("downstream SNR sensor config = %+v", config)
+	}
+
+	var st state
+	if err := json.Unmarshal(p.messages[8].Payload, &st); err != nil {
+		t.Fatalf("invalid state: %v", err)
+	}
+	if st.UptimeSeconds != 90 || st.SoftwareVersion != "8600-19.3.18" || st.Downstream["20"].SNR != 40.5 || st.Upstream["4"].Power != 56 || st.LockedUpstream != 1 {
+		t.Errorf("state = %+v", st)
+	}
+
+	// Known sensors are not announced again, and the sensors of the lost
+	// upstream channel are removed.
+	p.messages = nil
+	snapshot.Upstream = nil
+	if err := bridge.Publish(snapshot); err != nil {
+		t.Fatalf("Bridge.Publish() error = %v", err)
+	}
+	want = []string{
+		"homeassistant/sensor/001122aabbcc/upstream_4_power/config",
+		"mb8600/001122aabbcc/state",
+	}
+	if got := p.topics(); !slices.Equal(got, want) {
+		t.Errorf("Bridge.Publish() topics = %v, want %v", got, want)
+	}
+	if len(p.messages[0].Payload) != 0 || !p.messages[0].Retain {
+		t.Errorf("removed sensor config = %+v, want an empty retained message", p.messages[0])
+	}
+}
@@ -0,0 +1,377 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Package mqtt publishes modem status and channel metrics to an MQTT broker,
+// announcing them to Home Assistant through MQTT discovery.
+//
+// It includes a minimal MQTT 3.1.1 client that only publishes at QoS 0, which
+// is all the bridge needs.
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// MQTT control packet types, in the upper four bits of the first byte.
+const (
+	packetConnect    = 0x10
+	packetConnAck    = 0x20
+	packetPublish    = 0x30
+	packetPingReq    = 0xc0
+	packetDisconnect = 0xe0
+
+	connectFlagUsername     = 0x80
+	connectFlagPassword     = 0x40
+	connectFlagWillRetain   = 0x20
+	connectFlagWill         = 0x04
+	connectFlagCleanSession = 0x02
+
+	publishFlagRetain = 0x01
+
+	protocolLevel = 4
+
+	// The keep-alive is sent in seconds as a 16-bit integer.
+	maxKeepAlive = math.MaxUint16 * time.Second
+)
+
+var connAckErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// A message published to a topic.
+type Message struct {
+	Topic   string
+	Payload []byte
+	Retain  bool
+}
+
+// The settings of a Client.
+type ClientOptions struct {
+	ClientID string
+	Username string
+	Password string
+	// The interval of keep-alive pings, rounded up to whole seconds and at
+	// most 65535s. Zero disables them, in which case the broker will not
+	// notice a dead connection.
+	KeepAlive   time.Duration
+	DialTimeout time.Duration
+	// The time allowed to write a packet before the connection is dropped.
+	// Defaults to 10 seconds.
+	WriteTimeout time.Duration
+	// Published by the broker when the connection is lost.
+	Will *Message
+	// Published after every connect, e.g. to mark the client available again.
+	Birth *Message
+}
+
+// A minimal MQTT 3.1.1 client publishing at QoS 0. It connects on the first
+// publish, and reconnects on the next publish after the connection fails. It
+// is safe for concurrent use.
+type Client struct {
+	addr string
+	opts ClientOptions
+
+	mu   sync.Mutex
+	conn *conn
+}
+
+// A connection to the broker and the goroutines serving it.
+type conn struct {
+	net.Conn
+	timeout time.Duration
+	writeMu sync.Mutex
+	done    chan struct{}
+	wg      sync.WaitGroup
+
+	// Closed when reading or pinging fails.
+	failed   chan struct{}
+	failOnce sync.Once
+}
+
+// Returns a client of the broker at addr, e.g. "localhost:1883".
+func NewClient(addr string, opts ClientOptions) *Client {
+	if opts.DialTimeout == 0 {
+		opts.DialTimeout = 10 * time.Second
+	}
+	if opts.WriteTimeout == 0 {
+		opts.WriteTimeout = 10 * time.Second
+	}
+	return &Client{addr: addr, opts: opts}
+}
+
+// Publishes payload to topic, connecting first if needed.
+func (c *Client) Publish(topic string, payload []byte, retain bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn != nil && c.conn.isFailed() {
+		c.disconnect()
+	}
+	if c.conn == nil {
+		if err := c.connect(); err != nil {
+			return err
+		}
+	}
+
+	if err := c.conn.write(publishPacket(topic, payload, retain)); err != nil {
+		c.disconnect()
+		return err
+	}
+	return nil
+}
+
+// Disconnects from the broker, which discards the will.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.write([]byte{packetDisconnect, 0})
+	c.disconnect()
+	return err
+}
+
+// Returns an error if the options cannot be sent in a CONNECT packet.
+func (o *ClientOptions) validate() error {
+	if o.Password != "" && o.Username == "" {
+		return errors.New("a password requires a username")
+	}
+	if o.KeepAlive < 0 || o.KeepAlive > maxKeepAlive {
+		return fmt.Errorf("keep-alive must be between 0 and %s: %s", maxKeepAlive, o.KeepAlive)
+	}
+	return nil
+}
+
+func (c *Client) connect() error {
+	if err := c.opts.validate(); err != nil {
+		return err
+	}
+	nc, err := net.DialTimeout("tcp", c.addr, c.opts.DialTimeout)
+	if err != nil {
+		return err
+	}
+
+	nc.SetDeadline(time.Now().Add(c.opts.DialTimeout))
+	if _, err := nc.Write(connectPacket(&c.opts)); err != nil {
+		nc.Close()
+		return err
+	}
+	r := bufio.NewReader(nc)
+	header, body, err := readPacket(r)
+	if err != nil {
+		nc.Close()
+		return fmt.Errorf("unable to read CONNACK: %w", err)
+	}
+	if header&0xf0 != packetConnAck || len(body) != 2 {
+		nc.Close()
+		return fmt.Errorf("unexpected packet in place of CONNACK: %#x", header)
+	}
+	if code := body[1]; code != 0 {
+		nc.Close()
+		if msg, ok := connAckErrors[code]; ok {
+			return fmt.Errorf("connection refused: %s", msg)
+		}
+		return fmt.Errorf("connection refused: code %d", code)
+	}
+	nc.SetDeadline(time.Time{})
+
+	c.conn = &conn{Conn: nc, timeout: c.opts.WriteTimeout, done: make(chan struct{}), failed: make(chan struct{})}
+	c.conn.wg.Add(1)
+	go c.conn.drain(r)
+	if c.opts.KeepAlive > 0 {
+		c.conn.wg.Add(1)
+		go c.conn.ping(c.opts.KeepAlive)
+	}
+
+	if birth := c.opts.Birth; birth != nil {
+		if err := c.conn.write(publishPacket(birth.Topic, birth.Payload, birth.Retain)); err != nil {
+			c.disconnect()
+			return err
+		}
+	}
+	return nil
+}
+
+// Closes the connection and waits for its goroutines to exit.
+func (c *Client) disconnect() {
+	close(c.conn.done)
+	c.conn.Close()
+	c.conn.wg.Wait()
+	c.conn = nil
+}
+
+func (c *conn) write(packet []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.SetWriteDeadline(time.Now().Add(c.timeout))
+	_, err := c.Write(packet)
+	return err
+}
+
+// Closes the connection and marks it failed, so the next publish reconnects.
+func (c *conn) fail() {
+	c.failOnce.Do(func() {
+		close(c.failed)
+		c.Close()
+	})
+}
+
+func (c *conn) isFailed() bool {
+	select {
+	case <-c.failed:
+		return true
+	default:
+		return false
+	}
+}
+
+// Reads and discards the packets sent by the broker, PINGRESP at QoS 0,
+// until the connection is closed.
+func (c *conn) drain(r *bufio.Reader) {
+	defer c.wg.Done()
+	for {
+		if _, _, err := readPacket(r); err != nil {
+			c.fail()
+			return
+		}
+	}
+}
+
+// Pings the broker every interval. A failed ping fails the connection.
+func (c *conn) ping(interval time.Duration) {
+	defer c.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+		if err := c.write([]byte{packetPingReq, 0}); err != nil {
+			c.fail()
+			return
+		}
+	}
+}
+
+func connectPacket(opts *ClientOptions) []byte {
+	var flags byte = connectFlagCleanSession
+	body := appendString(nil, "MQTT")
+	body = append(body, protocolLevel, 0)
+	body = binary.BigEndian.AppendUint16(body, uint16((opts.KeepAlive+time.Second-1)/time.Second))
+	body = appendString(body, opts.ClientID)
+	if will := opts.Will; will != nil {
+		flags |= connectFlagWill
+		if will.Retain {
+			flags |= connectFlagWillRetain
+		}
+		body = appendString(body, will.Topic)
+		body = appendBytes(body, will.Payload)
+	}
+	if opts.Username != "" {
+		flags |= connectFlagUsername
+		body = appendString(body, opts.Username)
+	}
+	if opts.Password != "" {
+		flags |= connectFlagPassword
+		body = appendString(body, opts.Password)
+	}
+	// The flags follow the protocol name and level.
+	body[7] = flags
+
+	return appendPacket(packetConnect, body)
+}
+
+func publishPacket(topic string, payload []byte, retain bool) []byte {
+	var header byte = packetPublish
+	if retain {
+		header |= publishFlagRetain
+	}
+	body := appendString(nil, topic)
+	return appendPacket(header, append(body, payload...))
+}
+
+func appendPacket(header byte, body []byte) []byte {
+	packet := []byte{header}
+	// The remaining length is a variable length integer, 7 bits per byte.
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(packet, body...)
+}
+
+func appendString(b []byte, s string) []byte {
+	return appendBytes(b, []byte(s))
+}
+
+func appendBytes(b []byte, data []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+	return append(b, data...)
+}
+
+// Reads a packet, returning its first byte and its body.
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var length, shift int
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		shift += 7
+		if shift > 21 {
+			return 0, nil, errors.New("malformed remaining length")
+		}
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
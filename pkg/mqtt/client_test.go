@@ -0,0 +1,286 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+// A fake broker accepting connections and recording their CONNECT and
+// PUBLISH packets.
+type fakeBroker struct {
+	listener net.Listener
+	// The CONNACK return code sent to clients.
+	returnCode byte
+
+	mu       sync.Mutex
+	connects [][]byte
+	messages []Message
+	conns    []net.Conn
+	wg       sync.WaitGroup
+}
+
+func newFakeBroker(t *testing.T, returnCode byte) *fakeBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &fakeBroker{listener: listener, returnCode: returnCode}
+	b.wg.Add(1)
+	go b.serve()
+	t.Cleanup(b.close)
+	return b
+}
+
+func (b *fakeBroker) serve() {
+	defer b.wg.Done()
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		b.mu.Lock()
+		b.conns = append(b.conns, conn)
+		b.mu.Unlock()
+		b.wg.Add(1)
+		go b.handle(conn)
+	}
+}
+
+func (b *fakeBroker) handle(conn net.Conn) {
+	defer b.wg.Done()
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	for {
+		header, body, err := readPacket(r)
+		if err != nil {
+			return
+		}
+		switch header & 0xf0 {
+		case packetConnect:
+			b.mu.Lock()
+			b.connects = append(b.connects, body)
+			b.mu.Unlock()
+			conn.Write([]byte{packetConnAck, 2, 0, b.returnCode})
+		case packetPublish:
+			n := binary.BigEndian.Uint16(body)
+			b.mu.Lock()
+			b.messages = append(b.messages, Message{
+				Topic:   string(body[2 : 2+n]),
+				Payload: body[2+n:],
+				Retain:  header&publishFlagRetain != 0,
+			})
+			b.mu.Unlock()
+		case packetDisconnect:
+			return
+		}
+	}
+}
+
+// Drops every open connection, as if the broker restarted.
+func (b *fakeBroker) dropConnections() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, conn := range b.conns {
+		conn.Close()
+	}
+}
+
+func (b *fakeBroker) close() {
+	b.listener.Close()
+	b.dropConnections()
+	b.wg.Wait()
+}
+
+// Waits for the broker to have received n messages and returns them.
+func (b *fakeBroker) waitMessages(t *testing.T, n int) []Message {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		b.mu.Lock()
+		messages := append([]Message(nil), b.messages...)
+		b.mu.Unlock()
+		if len(messages) >= n || time.Now().After(deadline) {
+			return messages
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClient(t *testing.T) {
+	ignore := goleak.IgnoreCurrent()
+	t.Cleanup(func() { goleak.VerifyNone(t, ignore) })
+	broker := newFakeBroker(t, 0)
+
+	c := NewClient(broker.listener.Addr().String(), ClientOptions{
+		ClientID:  "mb8600",
+		Username:  "user",
+		Password:  "secret",
+		KeepAlive: time.Minute,
+		Will:      &Message{Topic: "mb8600/availability", Payload: []byte(PayloadOffline), Retain: true},
+		Birth:     &Message{Topic: "mb8600/availability", Payload: []byte(PayloadOnline), Retain: true},
+	})
+	defer c.Close()
+
+	if err := c.Publish("mb8600/state", []byte(`{"snr_db":40.5}`), false); err != nil {
+		t.Fatalf("Client.Publish() error = %v", err)
+	}
+	want := []Message{
+		{"mb8600/availability", []byte(PayloadOnline), true},
+		{"mb8600/state", []byte(`{"snr_db":40.5}`), false},
+	}
+	if got := broker.waitMessages(t, 2); !reflect.DeepEqual(got, want) {
+		t.Errorf("published messages = %v, want %v", got, want)
+	}
+
+	// The protocol name and level, the flags and a keep-alive of 60s.
+	wantHeader := []byte{0, 4, 'M', 'Q', 'T', 'T', protocolLevel, 0xe6, 0, 60}
+	broker.mu.Lock()
+	connect := broker.connects[0]
+	broker.mu.Unlock()
+	if !bytes.HasPrefix(connect, wantHeader) {
+		t.Errorf("CONNECT variable header = %v, want %v", connect[:len(wantHeader)], wantHeader)
+	}
+
+	// The client reconnects on the publish after the connection is lost.
+	c.mu.Lock()
+	failed := c.conn.failed
+	c.mu.Unlock()
+	broker.dropConnections()
+	select {
+	case <-failed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("connection not failed after the broker dropped it")
+	}
+	if err := c.Publish("mb8600/state", []byte("{}"), false); err != nil {
+		t.Fatalf("Client.Publish() after reconnect error = %v", err)
+	}
+	if got := broker.waitMessages(t, 4); len(got) != 4 {
+		t.Errorf("published messages = %v, want the birth and state again", got)
+	}
+}
+
+func TestClient_writeTimeout(t *testing.T) {
+	ignore := goleak.IgnoreCurrent()
+	t.Cleanup(func() { goleak.VerifyNone(t, ignore) })
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// A broker that accepts the connection and then stops reading.
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		readPacket(bufio.NewReader(conn))
+		conn.Write([]byte{packetConnAck, 2, 0, 0})
+		<-stop
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	c := NewClient(listener.Addr().String(), ClientOptions{WriteTimeout: 100 * time.Millisecond})
+	defer c.Close()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.Publish("mb8600/state", make([]byte, 64<<20), false)
+	}()
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Errorf("Client.Publish() error = nil, want timeout")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Client.Publish() blocked on a broker that does not read")
+	}
+}
+
+func TestClient_invalidOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts ClientOptions
+	}{
+		{"password without username", ClientOptions{Password: "secret"}},
+		{"keep-alive too long", ClientOptions{KeepAlive: 24 * time.Hour}},
+		{"negative keep-alive", ClientOptions{KeepAlive: -time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Nothing listens on the address, the options fail before dialing.
+			c := NewClient("127.0.0.1:1", tt.opts)
+			err := c.Publish("mb8600/state", nil, false)
+			if err == nil || errors.Is(err, syscall.ECONNREFUSED) {
+				t.Errorf("Client.Publish() error = %v, want invalid options", err)
+			}
+		})
+	}
+}
+
+func TestClient_refused(t *testing.T) {
+	ignore := goleak.IgnoreCurrent()
+	t.Cleanup(func() { goleak.VerifyNone(t, ignore) })
+	broker := newFakeBroker(t, 4)
+
+	c := NewClient(broker.listener.Addr().String(), ClientOptions{Username: "user", Password: "wrong"})
+	defer c.Close()
+	if err := c.Publish("mb8600/state", nil, false); err == nil {
+		t.Errorf("Client.Publish() error = nil, want error")
+	}
+}
+
+func Test_appendPacket(t *testing.T) {
+	tests := []struct {
+		length     int
+		wantLength []byte
+	}{
+		{0, []byte{0}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{16383, []byte{0xff, 0x7f}},
+		{16384, []byte{0x80, 0x80, 0x01}},
+	}
+	for _, tt := range tests {
+		packet := appendPacket(packetPublish, make([]byte, tt.length))
+		if got := packet[1 : 1+len(tt.wantLength)]; !bytes.Equal(got, tt.wantLength) {
+			t.Errorf("appendPacket() remaining length of %d = %v, want %v", tt.length, got, tt.wantLength)
+		}
+
+		header, body, err := readPacket(bufio.NewReader(bytes.NewReader(packet)))
+		if err != nil || header != packetPublish || len(body) != tt.length {
+			t.Errorf("readPacket() = %#x, %d bytes, %v, want %#x, %d bytes", header, len(body), err, packetPublish, tt.length)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package notify sends alerts, e.g. to chat webhooks, when the health of a
+// modem changes: a channel loses its lock, the SNR of a downstream channel
+// drops below its threshold or the modem reboots.
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/health"
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+// The default minimum time between two notifications of the same alert.
+const DefaultMinInterval = 15 * time.Minute
+
+// The kind of an alert.
+type Kind string
+
+const (
+	// A channel is not locked.
+	ChannelUnlocked Kind = "channel_unlocked"
+	// The SNR of a downstream channel is below its threshold.
+	SNRBelowThreshold Kind = "snr_below_threshold"
+	// The modem rebooted between two snapshots.
+	ModemRebooted Kind = "modem_rebooted"
+)
+
+// A condition of the modem worth notifying about.
+type Alert struct {
+	Kind      Kind      `json:"kind"`
+	Time      time.Time `json:"time"`
+	Direction string    `json:"direction,omitempty"`
+	ChannelID int       `json:"channel_id,omitempty"`
+	// The measured value and the threshold it crossed, for
+	// SNRBelowThreshold.
+	Value     float64 `json:"value,omitempty"`
+	Threshold float64 `json:"threshold,omitempty"`
+	// A human readable description of the alert.
+	Message string `json:"message"`
+}
+
+// Returns the key identifying the condition of the alert, the same for
+// every alert about it.
+func (a *Alert) Key() string {
+	return fmt.Sprintf("%s/%s/%d", a.Kind, a.Direction, a.ChannelID)
+}
+
+// Sends alerts somewhere, e.g. to a webhook.
+type Sender interface {
+	Send(ctx context.Context, alert *Alert) error
+}
+
+// Returns the alerts for the conditions of curr, prev being the snapshot
+// before it or nil. Reboots are only detected with prev.
+func Detect(prev, curr *mb8600.Snapshot, thresholds health.Thresholds) []*Alert {
+	var alerts []*Alert
+	if prev != nil {
+		if reboot := mb8600.Compare(prev, curr).Reboot; reboot != nil {
+			alerts = append(alerts, &Alert{
+				Kind:    ModemRebooted,
+				Time:    curr.Time,
+				Message: fmt.Sprintf("modem rebooted (detected by %s)", reboot.Reason),
+			})
+		}
+	}
+
+	unlocked := func(direction string, id int, status string) {
+		alerts = append(alerts, &Alert{
+			Kind:      ChannelUnlocked,
+			Time:      curr.Time,
+			Direction: direction,
+			ChannelID: id,
+			Message:   fmt.Sprintf("%s channel %d not locked: %s", direction, id, status),
+		})
+	}
+	for _, ch := range curr.Downstream {
+		if ch.LockStatus != "Locked" {
+			unlocked(mb8600.DirectionDownstream, ch.ChannelID, ch.LockStatus)
+			continue
+		}
+		if min := thresholds.MinSNRFor(ch); ch.SignalToNoise < min {
+			alerts = append(alerts, &Alert{
+				Kind:      SNRBelowThreshold,
+				Time:      curr.Time,
+				Direction: mb8600.DirectionDownstream,
+				ChannelID: ch.ChannelID,
+				Value:     ch.SignalToNoise,
+				Threshold: min,
+				Message:   fmt.Sprintf("downstream channel %d snr %.1f below %.1f", ch.ChannelID, ch.SignalToNoise, min),
+			})
+		}
+	}
+	for _, ch := range curr.Upstream {
+		if ch.LockStatus != "Locked" {
+			unlocked(mb8600.DirectionUpstream, ch.ChannelID, ch.LockStatus)
+		}
+	}
+	return alerts
+}
+
+// Notifies senders of the conditions detected in snapshots. A condition is
+// notified when it starts rather than on every snapshot it persists in, and
+// not again within MinInterval of its last notification, so that a flapping
+// channel does not notify on every flap.
+type Notifier struct {
+	Senders    []Sender
+	Thresholds health.Thresholds
+	// The minimum time between two notifications of the same condition.
+	MinInterval time.Duration
+
+	mu       sync.Mutex
+	active   map[string]bool
+	notified map[string]time.Time
+}
+
+// Returns a notifier sending to senders with the default thresholds and
+// DefaultMinInterval.
+func NewNotifier(senders ...Sender) *Notifier {
+	return &Notifier{Senders: senders, Thresholds: health.DefaultThresholds(), MinInterval: DefaultMinInterval}
+}
+
+// Detects the conditions of curr, prev being the snapshot before it or nil,
+// and sends an alert for each that started and was not notified within
+// MinInterval. Returns the alerts sent, and the errors of the senders.
+func (n *Notifier) Notify(ctx context.Context, prev, curr *mb8600.Snapshot) ([]*Alert, error) {
+	due := n.filter(Detect(prev, curr, n.Thresholds), curr.Time)
+
+	var errs []error
+	for _, alert := range due {
+		for _, sender := range n.Senders {
+			if err := sender.Send(ctx, alert); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return due, errors.Join(errs...)
+}
+
+// Returns the alerts for conditions that started, excluding those notified
+// within MinInterval before now, and records them as notified.
+func (n *Notifier) filter(alerts []*Alert, now time.Time) []*Alert {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.notified == nil {
+		n.notified = map[string]time.Time{}
+	}
+	active := make(map[string]bool, len(alerts))
+	var due []*Alert
+	for _, alert := range alerts {
+		key := alert.Key()
+		if active[key] {
+			continue
+		}
+		// Reboots are events rather than conditions, so they never stay
+		// active.
+		started := !n.active[key]
+		if alert.Kind != ModemRebooted {
+			active[key] = true
+		}
+		if !started {
+			continue
+		}
+		if last, ok := n.notified[key]; ok && now.Sub(last) < n.MinInterval {
+			continue
+		}
+		n.notified[key] = now
+		due = append(due, alert)
+	}
+	n.active = active
+	return due
+}
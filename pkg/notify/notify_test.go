@@ -0,0 +1,140 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/health"
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+var start = time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)
+
+// Returns a snapshot at minute offset with downstream channel 1 at snr, with
+// the given lock status, and the modem up for uptime.
+func snapshot(minute int, lock string, snr float64, uptime time.Duration) *mb8600.Snapshot {
+	return &mb8600.Snapshot{
+		Time: start.Add(time.Duration(minute) * time.Minute),
+		Downstream: []*mb8600.DownstreamChannel{
+			{ChannelID: 1, LockStatus: lock, Modulation: "QAM256", SignalToNoise: snr},
+		},
+		Upstream:   []*mb8600.UpstreamChannel{{ChannelID: 2, LockStatus: "Locked"}},
+		Connection: &mb8600.ConnectionInfo{Uptime: uptime},
+	}
+}
+
+// Returns the keys of alerts.
+func keys(alerts []*Alert) []string {
+	var keys []string
+	for _, alert := range alerts {
+		keys = append(keys, alert.Key())
+	}
+	return keys
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name       string
+		prev, curr *mb8600.Snapshot
+		want       []string
+	}{
+		{"healthy", nil, snapshot(0, "Locked", 40, time.Hour), nil},
+		{"unlocked", nil, snapshot(0, "Not Locked", 40, time.Hour), []string{"channel_unlocked/downstream/1"}},
+		{"low snr", nil, snapshot(0, "Locked", 30, time.Hour), []string{"snr_below_threshold/downstream/1"}},
+		{
+			"reboot",
+			snapshot(0, "Locked", 40, time.Hour),
+			snapshot(1, "Locked", 40, time.Minute),
+			[]string{"modem_rebooted//0"},
+		},
+		{"reboot without prev", nil, snapshot(1, "Locked", 40, time.Minute), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := keys(Detect(tt.prev, tt.curr, health.DefaultThresholds()))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Detect() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+type fakeSender struct {
+	sent []*Alert
+	err  error
+}
+
+func (s *fakeSender) Send(ctx context.Context, alert *Alert) error {
+	s.sent = append(s.sent, alert)
+	return s.err
+}
+
+func TestNotifier_Notify(t *testing.T) {
+	sender := &fakeSender{}
+	n := NewNotifier(sender)
+	n.MinInterval = 10 * time.Minute
+
+	steps := []struct {
+		snapshot *mb8600.Snapshot
+		want     []string
+	}{
+		{snapshot(0, "Locked", 40, time.Hour), nil},
+		{snapshot(1, "Not Locked", 40, time.Hour), []string{"channel_unlocked/downstream/1"}},
+		// Still unlocked, so not notified again.
+		{snapshot(2, "Not Locked", 40, time.Hour), nil},
+		{snapshot(3, "Locked", 40, time.Hour), nil},
+		// Flapping within the minimum interval.
+		{snapshot(4, "Not Locked", 40, time.Hour), nil},
+		{snapshot(5, "Locked", 40, time.Hour), nil},
+		{snapshot(12, "Not Locked", 40, time.Hour), []string{"channel_unlocked/downstream/1"}},
+		{snapshot(13, "Locked", 30, 0), []string{"modem_rebooted//0", "snr_below_threshold/downstream/1"}},
+	}
+
+	var prev *mb8600.Snapshot
+	for i, step := range steps {
+		got, err := n.Notify(context.Background(), prev, step.snapshot)
+		if err != nil {
+			t.Fatalf("step %d: Notify() error = %v", i, err)
+		}
+		if !reflect.DeepEqual(keys(got), step.want) {
+			t.Errorf("step %d: Notify() = %v, want %v", i, keys(got), step.want)
+		}
+		prev = step.snapshot
+	}
+	if len(sender.sent) != 4 {
+		t.Errorf("sent %d alerts, want 4", len(sender.sent))
+	}
+}
+
+func TestNotifier_Notify_error(t *testing.T) {
+	failing := &fakeSender{err: errors.New("unreachable")}
+	working := &fakeSender{}
+	n := NewNotifier(failing, working)
+
+	if _, err := n.Notify(context.Background(), nil, snapshot(0, "Not Locked", 40, time.Hour)); err == nil {
+		t.Error("Notify() succeeded with a failing sender")
+	}
+	if len(working.sent) != 1 {
+		t.Errorf("working sender got %d alerts, want 1", len(working.sent))
+	}
+}
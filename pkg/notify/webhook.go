@@ -0,0 +1,127 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// The payload format of a webhook.
+type Format string
+
+const (
+	// The alert as JSON.
+	FormatJSON Format = "json"
+	// A Slack incoming webhook message.
+	FormatSlack Format = "slack"
+	// A Discord webhook message.
+	FormatDiscord Format = "discord"
+)
+
+// The default template of the text of Slack and Discord messages.
+const DefaultTemplate = "mb8600: {{.Message}}"
+
+var defaultTemplate = template.Must(template.New("alert").Parse(DefaultTemplate))
+
+// Returns the format named name.
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(name)); f {
+	case FormatJSON, FormatSlack, FormatDiscord:
+		return f, nil
+	}
+	return "", fmt.Errorf("invalid webhook format, want json, slack or discord: %q", name)
+}
+
+// Posts alerts to an HTTP webhook.
+type Webhook struct {
+	URL    string
+	Format Format
+	// The template of the text of Slack and Discord messages, executed with
+	// the *Alert. DefaultTemplate if nil.
+	Template *template.Template
+	// The client posting the alerts, with a 10 second timeout if nil.
+	Client *http.Client
+}
+
+var _ Sender = (*Webhook)(nil)
+
+var defaultClient = &http.Client{Timeout: 10 * time.Second}
+
+// Returns a webhook posting alerts in format to url.
+func NewWebhook(url string, format Format) *Webhook {
+	return &Webhook{URL: url, Format: format}
+}
+
+// Posts alert to the webhook. Responses other than 2xx are an error.
+func (w *Webhook) Send(ctx context.Context, alert *Alert) error {
+	payload, err := w.payload(alert)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := w.Client
+	if client == nil {
+		client = defaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to post alert to webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook rejected alert: %s", resp.Status)
+	}
+	return nil
+}
+
+// Returns the body posted for alert.
+func (w *Webhook) payload(alert *Alert) ([]byte, error) {
+	switch w.Format {
+	case FormatJSON, "":
+		return json.Marshal(alert)
+	case FormatSlack, FormatDiscord:
+	default:
+		return nil, fmt.Errorf("invalid webhook format: %q", w.Format)
+	}
+
+	tmpl := w.Template
+	if tmpl == nil {
+		tmpl = defaultTemplate
+	}
+	var text strings.Builder
+	if err := tmpl.Execute(&text, alert); err != nil {
+		return nil, err
+	}
+	if w.Format == FormatSlack {
+		return json.Marshal(map[string]string{"text": text.String()})
+	}
+	return json.Marshal(map[string]string{"content": text.String()})
+}
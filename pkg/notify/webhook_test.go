@@ -0,0 +1,99 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package notify
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestWebhook_Send(t *testing.T) {
+	alert := &Alert{
+		Kind:      ChannelUnlocked,
+		Time:      time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC),
+		Direction: "downstream",
+		ChannelID: 1,
+		Message:   "downstream channel 1 not locked: Not Locked",
+	}
+
+	tests := []struct {
+		name     string
+		format   Format
+		template string
+		want     string
+	}{
+		{
+			"json",
+			FormatJSON,
+			"",
+			`{"kind":"channel_unlocked","time":"2023-12-01T00:00:00Z","direction":"downstream","channel_id":1,"message":"downstream channel 1 not locked: Not Locked"}`,
+		},
+		{"slack", FormatSlack, "", `{"text":"mb8600: downstream channel 1 not locked: Not Locked"}`},
+		{"discord", FormatDiscord, "", `{"content":"mb8600: downstream channel 1 not locked: Not Locked"}`},
+		{"template", FormatSlack, "{{.Kind}} on {{.ChannelID}}", `{"text":"channel_unlocked on 1"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				got = string(body)
+			}))
+			defer server.Close()
+
+			w := NewWebhook(server.URL, tt.format)
+			if tt.template != "" {
+				w.Template = template.Must(template.New("").Parse(tt.template))
+			}
+			if err := w.Send(context.Background(), alert); err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Send() posted %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhook_Send_rejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	err := NewWebhook(server.URL, FormatJSON).Send(context.Background(), &Alert{Kind: ModemRebooted})
+	if err == nil {
+		t.Error("Send() succeeded for a rejected alert")
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, name := range []string{"json", "Slack", "discord"} {
+		if _, err := ParseFormat(name); err != nil {
+			t.Errorf("ParseFormat(%q) error = %v", name, err)
+		}
+	}
+	if _, err := ParseFormat("teams"); err == nil {
+		t.Error("ParseFormat(teams) succeeded")
+	}
+}
@@ -0,0 +1,247 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package render formats channels and event logs as human-readable tables,
+// laid out like the modem's web interface, for the CLI and quick debugging:
+//
+//	render.DownstreamChannels(os.Stdout, channels, render.Text)
+package render
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+// The output format of a table.
+type Format int
+
+const (
+	// Space-aligned columns for terminals.
+	Text Format = iota
+	// A GitHub-flavored Markdown table, e.g. for issues.
+	Markdown
+)
+
+// Returns the format named text or markdown.
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "text":
+		return Text, nil
+	case "markdown", "md":
+		return Markdown, nil
+	}
+	return 0, fmt.Errorf("unknown render format: %s", name)
+}
+
+// A column of a table.
+type Column struct {
+	Header string
+	// Right-aligns the cells, as for numbers.
+	Right bool
+}
+
+// A table of preformatted cells.
+type Table struct {
+	Columns []Column
+	Rows    [][]string
+}
+
+// Appends a row of cells. Missing cells are left empty and extra cells are
+// dropped.
+func (t *Table) Append(cells ...string) {
+	t.Rows = append(t.Rows, cells)
+}
+
+// Writes the table to w in the given format.
+func (t *Table) Write(w io.Writer, format Format) error {
+	var b strings.Builder
+	switch format {
+	case Text:
+		t.writeText(&b)
+	case Markdown:
+		t.writeMarkdown(&b)
+	default:
+		return fmt.Errorf("unknown render format: %d", format)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Returns the cell of row in column i, or an empty string if there is none.
+func cell(row []string, i int) string {
+	if i < len(row) {
+		return row[i]
+	}
+	return ""
+}
+
+// Returns s padded with spaces to width characters.
+func pad(s string, width int, right bool) string {
+	fill := strings.Repeat(" ", max(width-utf8.RuneCountInString(s), 0))
+	if right {
+		return fill + s
+	}
+	return s + fill
+}
+
+func (t *Table) writeText(b *strings.Builder) {
+	widths := make([]int, len(t.Columns))
+	for i, col := range t.Columns {
+		widths[i] = utf8.RuneCountInString(col.Header)
+		for _, row := range t.Rows {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell(row, i)))
+		}
+	}
+
+	writeLine := func(cells func(i int) string) {
+		var line strings.Builder
+		for i, col := range t.Columns {
+			if i > 0 {
+				line.WriteString("  ")
+			}
+			line.WriteString(pad(cells(i), widths[i], col.Right))
+		}
+		b.WriteString(strings.TrimRight(line.String(), " "))
+		b.WriteByte('\n')
+	}
+
+	writeLine(func(i int) string { return t.Columns[i].Header })
+	for _, row := range t.Rows {
+		writeLine(func(i int) string { return cell(row, i) })
+	}
+}
+
+// Escapes the pipes in a Markdown cell.
+var markdownEscaper = strings.NewReplacer("|", `\|`, "\n", " ")
+
+func (t *Table) writeMarkdown(b *strings.Builder) {
+	writeLine := func(cells func(i int) string) {
+		b.WriteByte('|')
+		for i := range t.Columns {
+			b.WriteString(" " + cells(i) + " |")
+		}
+		b.WriteByte('\n')
+	}
+
+	writeLine(func(i int) string { return markdownEscaper.Replace(t.Columns[i].Header) })
+	writeLine(func(i int) string {
+		if t.Columns[i].Right {
+			return "---:"
+		}
+		return "---"
+	})
+	for _, row := range t.Rows {
+		writeLine(func(i int) string { return markdownEscaper.Replace(cell(row, i)) })
+	}
+}
+
+func formatFloat(f float64, prec int) string {
+	return strconv.FormatFloat(f, 'f', prec, 64)
+}
+
+// Returns a table of the downstream channels with the columns of the modem's
+// Downstream Bonded Channels table.
+func DownstreamTable(channels []*mb8600.DownstreamChannel) *Table {
+	t := &Table{Columns: []Column{
+		{"Channel", true},
+		{"Lock Status", false},
+		{"Modulation", false},
+		{"Channel ID", true},
+		{"Freq. (MHz)", true},
+		{"Pwr (dBmV)", true},
+		{"SNR (dB)", true},
+		{"Corrected", true},
+		{"Uncorrected", true},
+	}}
+	for _, ch := range channels {
+		t.Append(
+			strconv.Itoa(ch.Channel),
+			ch.LockStatus,
+			ch.Modulation,
+			strconv.Itoa(ch.ChannelID),
+			formatFloat(ch.Frequency, 1),
+			formatFloat(ch.Power, 1),
+			formatFloat(ch.SignalToNoise, 1),
+			formatFloat(ch.CorrectedErrors, 0),
+			formatFloat(ch.UncorrectedErrors, 0),
+		)
+	}
+	return t
+}
+
+// Returns a table of the upstream channels with the columns of the modem's
+// Upstream Bonded Channels table.
+func UpstreamTable(channels []*mb8600.UpstreamChannel) *Table {
+	t := &Table{Columns: []Column{
+		{"Channel", true},
+		{"Lock Status", false},
+		{"Channel Type", false},
+		{"Channel ID", true},
+		{"Symb. Rate (Ksym/sec)", true},
+		{"Freq. (MHz)", true},
+		{"Pwr (dBmV)", true},
+	}}
+	for _, ch := range channels {
+		t.Append(
+			strconv.Itoa(ch.Channel),
+			ch.LockStatus,
+			ch.ChannelType,
+			strconv.Itoa(ch.ChannelID),
+			formatFloat(ch.SymbolRate, 0),
+			formatFloat(ch.Frequency, 1),
+			formatFloat(ch.Power, 1),
+		)
+	}
+	return t
+}
+
+// Returns a table of the event log entries with the columns of the modem's
+// Event Log page.
+func LogTable(entries []*mb8600.LogEntry) *Table {
+	t := &Table{Columns: []Column{
+		{"Time", false},
+		{"Priority", true},
+		{"Description", false},
+	}}
+	for _, entry := range entries {
+		t.Append(
+			strings.TrimSpace(entry.Time+" "+entry.Date),
+			strconv.Itoa(entry.Priority),
+			entry.Description,
+		)
+	}
+	return t
+}
+
+// Writes the downstream channels to w as a table in the given format.
+func DownstreamChannels(w io.Writer, channels []*mb8600.DownstreamChannel, format Format) error {
+	return DownstreamTable(channels).Write(w, format)
+}
+
+// Writes the upstream channels to w as a table in the given format.
+func UpstreamChannels(w io.Writer, channels []*mb8600.UpstreamChannel, format Format) error {
+	return UpstreamTable(channels).Write(w, format)
+}
+
+// Writes the event log entries to w as a table in the given format.
+func Logs(w io.Writer, entries []*mb8600.LogEntry, format Format) error {
+	return LogTable(entries).Write(w, format)
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+func TestTable_Write(t *testing.T) {
+	table := &Table{Columns: []Column{{"Name", false}, {"Value", true}}}
+	table.Append("snr", "41.2")
+	table.Append("uncorrected|total", "1234567")
+	table.Append("short")
+
+	tests := []struct {
+		name   string
+		format Format
+		want   string
+	}{
+		{
+			"text",
+			Text,
+			"Name                 Value\n" +
+				"snr                   41.2\n" +
+				"uncorrected|total  1234567\n" +
+				"short\n",
+		},
+		{
+			"markdown",
+			Markdown,
+			"| Name | Value |\n" +
+				"| --- | ---: |\n" +
+				"| snr | 41.2 |\n" +
+				`| uncorrected\|total | 1234567 |` + "\n" +
+				"| short |  |\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			if err := table.Write(&b, tt.format); err != nil {
+				t.Fatalf("Table.Write() error = %v", err)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("Table.Write() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+
+	if err := table.Write(&strings.Builder{}, Format(9)); err == nil {
+		t.Errorf("Table.Write() error = nil for an unknown format, want error")
+	}
+}
+
+func TestDownstreamChannels(t *testing.T) {
+	channels := []*mb8600.DownstreamChannel{
+		{Channel: 1, ChannelID: 20, LockStatus: "Locked", Modulation: "QAM256", Frequency: 561, Power: 2.3, SignalToNoise: 40.9, CorrectedErrors: 12, UncorrectedErrors: 0},
+		{Channel: 33, ChannelID: 193, LockStatus: "Locked", Modulation: "OFDM PLC", Frequency: 957, Power: -1.8, SignalToNoise: 39.5, CorrectedErrors: 345678, UncorrectedErrors: 9},
+	}
+	want := "" +
+		"Channel  Lock Status  Modulation  Channel ID  Freq. (MHz)  Pwr (dBmV)  SNR (dB)  Corrected  Uncorrected\n" +
+		"      1  Locked       QAM256              20        561.0         2.3      40.9         12            0\n" +
+		"     33  Locked       OFDM PLC           193        957.0        -1.8      39.5     345678            9\n"
+
+	var b strings.Builder
+	if err := DownstreamChannels(&b, channels, Text); err != nil {
+		t.Fatalf("DownstreamChannels() error = %v", err)
+	}
+	if got := b.String(); got != want {
+		t.Errorf("DownstreamChannels() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestUpstreamChannels(t *testing.T) {
+	channels := []*mb8600.UpstreamChannel{
+		{Channel: 1, ChannelID: 1, LockStatus: "Locked", ChannelType: "SC-QAM", SymbolRate: 5120, Frequency: 16.4, Power: 44.3},
+	}
+	want := "" +
+		"| Channel | Lock Status | Channel Type | Channel ID | Symb. Rate (Ksym/sec) | Freq. (MHz) | Pwr (dBmV) |\n" +
+		"| ---: | --- | --- | ---: | ---: | ---: | ---: |\n" +
+		"| 1 | Locked | SC-QAM | 1 | 5120 | 16.4 | 44.3 |\n"
+
+	var b strings.Builder
+	if err := UpstreamChannels(&b, channels, Markdown); err != nil {
+		t.Fatalf("UpstreamChannels() error = %v", err)
+	}
+	if got := b.String(); got != want {
+		t.Errorf("UpstreamChannels() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestLogs(t *testing.T) {
+	entries := []*mb8600.LogEntry{
+		{Time: "12:00:01", Date: "Sat Dec 16 2023", Priority: 3, Description: "No Ranging Response received - T3 time-out"},
+		{Time: "Time Not Established", Priority: 6, Description: "Honoring MDD; IP provisioning mode = IPv6"},
+	}
+	want := "" +
+		"Time                      Priority  Description\n" +
+		"12:00:01 Sat Dec 16 2023         3  No Ranging Response received - T3 time-out\n" +
+		"Time Not Established             6  Honoring MDD; IP provisioning mode = IPv6\n"
+
+	var b strings.Builder
+	if err := Logs(&b, entries, Text); err != nil {
+		t.Fatalf("Logs() error = %v", err)
+	}
+	if got := b.String(); got != want {
+		t.Errorf("Logs() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Format
+		wantErr bool
+	}{
+		{"text", Text, false},
+		{"Markdown", Markdown, false},
+		{"md", Markdown, false},
+		{"html", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFormat(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFormat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseFormat() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schema
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// The directories of the packages declaring the documented types, relative
+// to the pkg directory of the module.
+var sourcePackages = map[string]string{
+	"github.com/thelande/mb8600/pkg/mb8600": "mb8600",
+	"github.com/thelande/mb8600/pkg/health": "health",
+}
+
+// Doc comments of types, keyed by "<import path>.<type>", and of struct
+// fields, keyed by "<import path>.<type>.<field>".
+type Docs map[string]string
+
+// Returns the doc comments of the documented types, parsed from the source in
+// pkgDir, the pkg directory of the module.
+func SourceDocs(pkgDir string) (Docs, error) {
+	docs := Docs{}
+	for importPath, dir := range sourcePackages {
+		if err := docs.Parse(importPath, filepath.Join(pkgDir, dir)); err != nil {
+			return nil, err
+		}
+	}
+	return docs, nil
+}
+
+// Adds the doc comments of the types declared in the Go package in dir,
+// imported as importPath, to d.
+func (d Docs) Parse(importPath, dir string) error {
+	fset := token.NewFileSet()
+	notTest := func(info fs.FileInfo) bool { return !strings.HasSuffix(info.Name(), "_test.go") }
+	pkgs, err := parser.ParseDir(fset, dir, notTest, parser.ParseComments)
+	if err != nil {
+		return err
+	}
+
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				gen, ok := decl.(*ast.GenDecl)
+				if !ok || gen.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range gen.Specs {
+					d.addType(importPath, gen, spec.(*ast.TypeSpec))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (d Docs) addType(importPath string, gen *ast.GenDecl, spec *ast.TypeSpec) {
+	key := importPath + "." + spec.Name.Name
+	doc := spec.Doc
+	if doc == nil && len(gen.Specs) == 1 {
+		doc = gen.Doc
+	}
+	if text := commentText(doc); text != "" {
+		d[key] = text
+	}
+
+	st, ok := spec.Type.(*ast.StructType)
+	if !ok {
+		return
+	}
+	for _, field := range st.Fields.List {
+		text := commentText(field.Doc)
+		if text == "" {
+			text = commentText(field.Comment)
+		}
+		if text == "" {
+			continue
+		}
+		for _, name := range field.Names {
+			d[key+"."+name.Name] = text
+		}
+	}
+}
+
+// Returns the text of a comment as one line.
+func commentText(group *ast.CommentGroup) string {
+	return strings.Join(strings.Fields(group.Text()), " ")
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+//go:build ignore
+
+// Writes the schema documents of the package, run by go generate.
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/thelande/mb8600/pkg/schema"
+)
+
+func main() {
+	docs, err := schema.SourceDocs("..")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, doc := range schema.Documents {
+		data, err := schema.Marshal(doc, docs)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(schema.Path(doc.Name), data, 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
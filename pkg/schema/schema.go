@@ -0,0 +1,298 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package schema provides JSON Schema documents describing the JSON output of
+// the module, such as ModemStatus, for validating it in downstream pipelines
+// and generating typed clients in other languages.
+//
+// The documents are generated from the Go types and their doc comments, and
+// embedded in the package. Regenerate them after changing an output type:
+//
+//	go generate ./pkg/schema
+package schema
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/health"
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+//go:generate go run gen.go
+
+// The version of the documents, incremented on incompatible changes to the
+// output. Compatible additions keep the version.
+const Version = 1
+
+// The JSON Schema dialect of the documents.
+const Dialect = "https://json-schema.org/draft/2020-12/schema"
+
+//go:embed v1/*.json
+var files embed.FS
+
+// A JSON output of the module with a schema.
+type Document struct {
+	// The name of the document, e.g. "modem-status".
+	Name  string
+	Title string
+	// A value of the type the document describes.
+	Value any
+}
+
+// The documents provided by the package.
+var Documents = []Document{
+	{"modem-status", "Modem status", mb8600.ModemStatus{}},
+	{"snapshot", "Poll snapshot", mb8600.Snapshot{}},
+	{"downstream-channels", "Downstream channels", []*mb8600.DownstreamChannel{}},
+	{"upstream-channels", "Upstream channels", []*mb8600.UpstreamChannel{}},
+	{"log-entries", "Event log entries", []*mb8600.LogEntry{}},
+	{"health-report", "Channel health report", health.Report{}},
+}
+
+// Returns the names of the documents.
+func Names() []string {
+	names := make([]string, len(Documents))
+	for i, doc := range Documents {
+		names[i] = doc.Name
+	}
+	return names
+}
+
+// Returns the embedded document with the given name.
+func Get(name string) ([]byte, error) {
+	for _, doc := range Documents {
+		if doc.Name == name {
+			return files.ReadFile(Path(name))
+		}
+	}
+	return nil, fmt.Errorf("unknown schema: %s (known: %s)", name, strings.Join(Names(), ", "))
+}
+
+// Returns the path of the document with the given name in the package
+// directory.
+func Path(name string) string {
+	return fmt.Sprintf("v%d/%s.json", Version, name)
+}
+
+// Returns the $id of the document with the given name.
+func ID(name string) string {
+	return fmt.Sprintf("https://github.com/thelande/mb8600/schemas/v%d/%s.json", Version, name)
+}
+
+// A JSON Schema, limited to the keywords the generator uses.
+type Schema struct {
+	Schema      string             `json:"$schema,omitempty"`
+	ID          string             `json:"$id,omitempty"`
+	Ref         string             `json:"$ref,omitempty"`
+	Title       string             `json:"title,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Type        any                `json:"type,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Enum        []any              `json:"enum,omitempty"`
+	AnyOf       []*Schema          `json:"anyOf,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	// A schema, or false to forbid other properties.
+	AdditionalProperties any                `json:"additionalProperties,omitempty"`
+	Defs                 map[string]*Schema `json:"$defs,omitempty"`
+}
+
+// Types with a JSON encoding other than their reflected one.
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	statusType   = reflect.TypeOf(health.Status(0))
+)
+
+// Properties added to a type by its MarshalJSON method.
+var extraProperties = map[reflect.Type]map[string]*Schema{
+	reflect.TypeOf(mb8600.DownstreamChannel{}): {"kind": channelKind([]mb8600.ChannelKind{mb8600.ChannelKindSCQAM, mb8600.ChannelKindOFDM})},
+	reflect.TypeOf(mb8600.UpstreamChannel{}):   {"kind": channelKind([]mb8600.ChannelKind{mb8600.ChannelKindSCQAM, mb8600.ChannelKindOFDMA})},
+}
+
+func channelKind(kinds []mb8600.ChannelKind) *Schema {
+	enum := make([]any, len(kinds))
+	for i, kind := range kinds {
+		enum[i] = string(kind)
+	}
+	return &Schema{Type: "string", Enum: enum, Description: "The kind of the channel, distinguishing DOCSIS 3.0 single-carrier QAM channels from DOCSIS 3.1 OFDM (downstream) and OFDMA (upstream) channels."}
+}
+
+// Returns the schema of doc, described with docs.
+func Generate(doc Document, docs Docs) *Schema {
+	g := &generator{docs: docs, defs: map[string]*Schema{}}
+	s := g.schema(reflect.TypeOf(doc.Value))
+	s.Schema = Dialect
+	s.ID = ID(doc.Name)
+	s.Title = doc.Title
+	if len(g.defs) > 0 {
+		s.Defs = g.defs
+	}
+	return s
+}
+
+// Returns the schema of doc as indented JSON, as it is embedded.
+func Marshal(doc Document, docs Docs) ([]byte, error) {
+	data, err := json.MarshalIndent(Generate(doc, docs), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+type generator struct {
+	docs Docs
+	defs map[string]*Schema
+}
+
+// Returns the schema of values of type t.
+func (g *generator) schema(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case durationType:
+		return &Schema{Type: "integer", Description: "A duration in nanoseconds."}
+	case statusType:
+		return &Schema{Type: "integer", Enum: []any{0, 1, 2}, Description: "The status: 0 (ok), 1 (warning) or 2 (critical)."}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return nullable(g.schema(t.Elem()))
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string", Description: g.docs[typeKey(t)]}
+	case reflect.Array:
+		return &Schema{Type: "array", Items: g.schema(deref(t.Elem()))}
+	case reflect.Slice:
+		return nullable(&Schema{Type: "array", Items: g.schema(deref(t.Elem()))})
+	case reflect.Map:
+		return nullable(&Schema{Type: "object", AdditionalProperties: g.schema(deref(t.Elem()))})
+	case reflect.Struct:
+		return g.ref(t)
+	}
+	// Interfaces and other kinds accept any value.
+	return &Schema{}
+}
+
+// Returns a reference to the definition of the struct type t, adding it to
+// the definitions if it is not there yet.
+func (g *generator) ref(t reflect.Type) *Schema {
+	name := t.Name()
+	if _, ok := g.defs[name]; !ok {
+		def := &Schema{
+			Type:                 "object",
+			Description:          g.docs[typeKey(t)],
+			Properties:           map[string]*Schema{},
+			AdditionalProperties: false,
+		}
+		// Added before its fields, so recursive types terminate.
+		g.defs[name] = def
+		g.addFields(def, t)
+		for prop, s := range extraProperties[t] {
+			def.Properties[prop] = s
+			def.Required = append(def.Required, prop)
+		}
+		sort.Strings(def.Required)
+	}
+	return &Schema{Ref: "#/$defs/" + name}
+}
+
+// Adds the properties encoding/json marshals the fields of t as to def.
+func (g *generator) addFields(def *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				g.addFields(def, embedded)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		s := g.schema(field.Type)
+		if doc := g.docs[typeKey(t)+"."+field.Name]; doc != "" {
+			s = describe(s, doc)
+		}
+		def.Properties[name] = s
+		if !strings.Contains(opts, "omitempty") {
+			def.Required = append(def.Required, name)
+		}
+	}
+}
+
+// Returns s allowing null, as for a nil pointer, slice or map.
+func nullable(s *Schema) *Schema {
+	if s.Ref != "" {
+		return &Schema{AnyOf: []*Schema{s, {Type: "null"}}}
+	}
+	if typ, ok := s.Type.(string); ok {
+		s.Type = []string{typ, "null"}
+	}
+	return s
+}
+
+// Returns s with the description doc, followed by the description of its type
+// if it has one.
+func describe(s *Schema, doc string) *Schema {
+	if s.Description != "" {
+		doc += " " + s.Description
+	}
+	s.Description = doc
+	return s
+}
+
+// Returns the type t points to, or t if it is not a pointer. Elements of
+// slices and maps are never nil in the output, so they are not nullable.
+func deref(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Pointer {
+		return t.Elem()
+	}
+	return t
+}
+
+// Returns the key of the doc comment of the named type t in Docs.
+func typeKey(t reflect.Type) string {
+	return t.PkgPath() + "." + t.Name()
+}
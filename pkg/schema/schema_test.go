@@ -0,0 +1,194 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/health"
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+func TestDocumentsUpToDate(t *testing.T) {
+	docs, err := SourceDocs("..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, doc := range Documents {
+		t.Run(doc.Name, func(t *testing.T) {
+			want, err := Marshal(doc, docs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Get(doc.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s is out of date, run go generate ./pkg/schema", Path(doc.Name))
+			}
+		})
+	}
+}
+
+func TestGet_unknown(t *testing.T) {
+	if _, err := Get("nope"); err == nil {
+		t.Error("Get(nope) error = nil, want an error")
+	}
+}
+
+// Returns the status of a modem with an OFDM channel, as GetStatus would.
+func testStatus() *mb8600.ModemStatus {
+	downstream, _ := mb8600.NewDownstreamChannelsFromResponse("1^Locked^QAM256^20^531.0^ 2.8^45.1^0^0^|+|33^Locked^OFDM PLC^193^957.0^-0.7^43.0^-1565968621^150^")
+	upstream, _ := mb8600.NewUpstreamChannelsFromResponse("1^Locked^SC-QAM^4^5120^35.6^56.0^|+|2^Locked^OFDMA^41^0^37.0^38.5^")
+	return &mb8600.ModemStatus{
+		Time:       time.Date(2023, 12, 16, 0, 0, 0, 0, time.UTC),
+		Software:   &mb8600.SoftwareStatus{SoftwareVersion: "8600-19.3.18", SpecVersion: "DOCSIS 3.1"},
+		Connection: &mb8600.ConnectionInfo{Uptime: time.Hour, NetworkAccess: mb8600.NetworkAccessAllowed},
+		Startup:    &mb8600.StartupSequence{BootStatus: "OK"},
+		Downstream: downstream,
+		Upstream:   upstream,
+	}
+}
+
+func TestSchemasMatchOutput(t *testing.T) {
+	status := testStatus()
+	prev := status.Snapshot()
+	curr := status.Snapshot()
+	curr.Downstream[0].UncorrectedErrors += 5000
+
+	logs, err := mb8600.NewLogEntriesFromResponse("   18:56:01  ^  Sun Dec 24 2023  ^3^No Ranging Response received - T3 time-out;}-{   Time Not Established  ^  Time Not Established  ^5^Cable Modem Reboot due to power reset^")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outputs := map[string]any{
+		"modem-status":        status,
+		"snapshot":            curr,
+		"downstream-channels": status.Downstream,
+		"upstream-channels":   status.Upstream,
+		"log-entries":         logs,
+		"health-report":       health.Evaluate(curr, prev, health.DefaultThresholds()),
+	}
+	for _, doc := range Documents {
+		t.Run(doc.Name, func(t *testing.T) {
+			output, ok := outputs[doc.Name]
+			if !ok {
+				t.Fatalf("no output to validate %s against", doc.Name)
+			}
+			data, err := json.Marshal(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var value any
+			if err := json.Unmarshal(data, &value); err != nil {
+				t.Fatal(err)
+			}
+
+			s := Generate(doc, Docs{})
+			if err := validate(value, s, s.Defs, "$"); err != nil {
+				t.Errorf("output does not match the schema: %v\n%s", err, data)
+			}
+		})
+	}
+}
+
+// Validates value against the keywords of s the generator uses.
+func validate(value any, s *Schema, defs map[string]*Schema, path string) error {
+	if s.Ref != "" {
+		return validate(value, defs[strings.TrimPrefix(s.Ref, "#/$defs/")], defs, path)
+	}
+	if len(s.AnyOf) > 0 {
+		var errs []string
+		for _, alt := range s.AnyOf {
+			err := validate(value, alt, defs, path)
+			if err == nil {
+				return nil
+			}
+			errs = append(errs, err.Error())
+		}
+		return fmt.Errorf("%s matches none of: %s", path, strings.Join(errs, "; "))
+	}
+	if s.Type != nil && !slices.Contains(types(s.Type), jsonType(value)) &&
+		!(jsonType(value) == "integer" && slices.Contains(types(s.Type), "number")) {
+		return fmt.Errorf("%s is %s, want %v", path, jsonType(value), s.Type)
+	}
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(e any) bool { return fmt.Sprint(e) == fmt.Sprint(value) }) {
+		return fmt.Errorf("%s is %v, want one of %v", path, value, s.Enum)
+	}
+
+	switch v := value.(type) {
+	case []any:
+		for i, item := range v {
+			if err := validate(item, s.Items, defs, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				return fmt.Errorf("%s is missing %s", path, name)
+			}
+		}
+		for name, item := range v {
+			prop, ok := s.Properties[name]
+			if !ok {
+				additional, ok := s.AdditionalProperties.(*Schema)
+				if !ok {
+					return fmt.Errorf("%s has undeclared property %s", path, name)
+				}
+				prop = additional
+			}
+			if err := validate(item, prop, defs, path+"."+name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func types(typ any) []string {
+	if typ, ok := typ.(string); ok {
+		return []string{typ}
+	}
+	return typ.([]string)
+}
+
+func jsonType(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	}
+	return "object"
+}
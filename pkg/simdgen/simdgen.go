@@ -0,0 +1,385 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Package simdgen generates realistic synthetic modem data, following a
+// configurable degradation scenario, so the daemon, exporters and health
+// engine can be demoed and tested end to end without a modem.
+//
+// A Generator produces a snapshot per poll interval. Apply also serves them
+// from an mb8600test.Modem, so the whole client stack can be exercised.
+package simdgen
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/mb8600"
+	"github.com/thelande/mb8600/pkg/mb8600test"
+)
+
+// A degradation scenario played by a Generator. Degradations ramp up over
+// the first rampSteps snapshots and then hold.
+type Scenario string
+
+const (
+	// A modem with good levels and the occasional corrected error.
+	Healthy Scenario = "healthy"
+	// Noise entering the plant: the SNR drops, most at low frequencies, and
+	// corrected and then uncorrected errors climb.
+	NoiseIngress Scenario = "noise-ingress"
+	// Downstream and upstream power drifting out of range, as with a failing
+	// amplifier.
+	PowerDrift Scenario = "power-drift"
+	// A downstream channel repeatedly losing and regaining lock.
+	Flapping Scenario = "flapping"
+	// Upstream channels failing one by one, leaving the modem in partial
+	// service.
+	PartialService Scenario = "partial-service"
+	// The modem rebooting periodically, resetting its uptime and counters.
+	Reboots Scenario = "reboots"
+)
+
+var scenarios = []Scenario{Healthy, NoiseIngress, PowerDrift, Flapping, PartialService, Reboots}
+
+const (
+	// The snapshots over which degradations ramp up.
+	rampSteps = 60
+	// The snapshots between reboots in the Reboots scenario.
+	rebootSteps = 40
+	// The snapshots a channel stays locked or unlocked in the Flapping
+	// scenario.
+	flapSteps = 3
+
+	ofdmPLCChannelID = 193
+)
+
+// Returns the available scenarios.
+func Scenarios() []Scenario {
+	return append([]Scenario(nil), scenarios...)
+}
+
+// Returns the scenario named name.
+func ParseScenario(name string) (Scenario, error) {
+	for _, s := range scenarios {
+		if string(s) == name {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("unknown scenario %q, want one of %v", name, scenarios)
+}
+
+// Configures a Generator. The zero value generates a healthy modem.
+type Config struct {
+	Scenario Scenario
+	// The SC-QAM downstream channels, 24 if zero. An OFDM channel is added.
+	DownstreamChannels int
+	// The upstream channels, 4 if zero.
+	UpstreamChannels int
+	// The time of the first snapshot, the current time if zero.
+	Start time.Time
+	// The time between snapshots, 30 seconds if zero.
+	Interval time.Duration
+	// The seed of the random noise, so a run can be repeated.
+	Seed int64
+}
+
+// The levels a channel returns to, around which noise is added.
+type baseline struct {
+	power float64
+	snr   float64
+}
+
+// Generates synthetic snapshots. It is not safe for concurrent use.
+type Generator struct {
+	cfg  Config
+	rand *rand.Rand
+	step int
+	time time.Time
+	// The uptime of the modem at the current snapshot.
+	uptime time.Duration
+
+	downstream []*mb8600.DownstreamChannel
+	upstream   []*mb8600.UpstreamChannel
+	baselines  map[mb8600.ChannelKey]baseline
+}
+
+// Returns a generator for cfg.
+func New(cfg Config) *Generator {
+	if cfg.Scenario == "" {
+		cfg.Scenario = Healthy
+	}
+	if cfg.DownstreamChannels <= 0 {
+		cfg.DownstreamChannels = 24
+	}
+	if cfg.UpstreamChannels <= 0 {
+		cfg.UpstreamChannels = 4
+	}
+	if cfg.Start.IsZero() {
+		cfg.Start = time.Now().Truncate(time.Second)
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = 30 * time.Second
+	}
+
+	g := &Generator{
+		cfg:       cfg,
+		rand:      rand.New(rand.NewSource(cfg.Seed)),
+		time:      cfg.Start,
+		uptime:    7*24*time.Hour + 40*time.Minute,
+		baselines: map[mb8600.ChannelKey]baseline{},
+	}
+
+	for idx := 0; idx < cfg.DownstreamChannels; idx++ {
+		ch := &mb8600.DownstreamChannel{
+			Channel:    idx + 1,
+			ChannelID:  idx + 1,
+			LockStatus: "Locked",
+			Modulation: "QAM256",
+			// The SC-QAM channels of a North American plant, 6 MHz apart.
+			Frequency: 489 + 6*float64(idx),
+		}
+		g.downstream = append(g.downstream, ch)
+		g.baselines[mb8600.ChannelKey{Direction: mb8600.DirectionDownstream, ChannelID: ch.ChannelID}] = baseline{
+			power: 2 + g.rand.NormFloat64(),
+			snr:   41 + g.rand.NormFloat64()*0.8,
+		}
+	}
+	plc := &mb8600.DownstreamChannel{
+		Channel:    cfg.DownstreamChannels + 1,
+		ChannelID:  ofdmPLCChannelID,
+		LockStatus: "Locked",
+		Modulation: "OFDM PLC",
+		Frequency:  957,
+	}
+	g.downstream = append(g.downstream, plc)
+	g.baselines[mb8600.ChannelKey{Direction: mb8600.DirectionDownstream, ChannelID: plc.ChannelID}] = baseline{power: -0.7, snr: 43}
+
+	for idx := 0; idx < cfg.UpstreamChannels; idx++ {
+		ch := &mb8600.UpstreamChannel{
+			Channel:     idx + 1,
+			ChannelID:   idx + 1,
+			LockStatus:  "Locked",
+			ChannelType: "SC-QAM",
+			SymbolRate:  5120,
+			// Upstream channels 6.4 MHz apart, below the 42 MHz split.
+			Frequency: round1(16.4 + 6.4*float64(idx)),
+		}
+		g.upstream = append(g.upstream, ch)
+		g.baselines[mb8600.ChannelKey{Direction: mb8600.DirectionUpstream, ChannelID: ch.ChannelID}] = baseline{
+			power: 45 + g.rand.NormFloat64()*0.5,
+		}
+	}
+	return g
+}
+
+// Returns the next snapshot, one interval after the previous one. The first
+// call returns the snapshot at the start time.
+func (g *Generator) Next() *mb8600.Snapshot {
+	if g.step > 0 {
+		g.time = g.time.Add(g.cfg.Interval)
+		g.uptime += g.cfg.Interval
+	}
+	// The degradation, from 0 to 1.
+	severity := math.Min(1, float64(g.step)/rampSteps)
+
+	rebooted := g.cfg.Scenario == Reboots && g.step > 0 && g.step%rebootSteps == 0
+	if rebooted {
+		g.uptime = g.cfg.Interval / 2
+	}
+
+	snapshot := &mb8600.Snapshot{Time: g.time}
+	for idx, ch := range g.downstream {
+		g.updateDownstream(ch, idx, severity, rebooted)
+		c := *ch
+		snapshot.Downstream = append(snapshot.Downstream, &c)
+	}
+	for idx, ch := range g.upstream {
+		g.updateUpstream(ch, idx, severity)
+		c := *ch
+		snapshot.Upstream = append(snapshot.Upstream, &c)
+	}
+
+	snapshot.Connection = &mb8600.ConnectionInfo{
+		Uptime:              g.uptime.Truncate(time.Second),
+		NetworkAccess:       mb8600.NetworkAccessAllowed,
+		ConnectivityStatus:  "OK",
+		ConnectivityComment: "Operational",
+		BootStatus:          "OK",
+		BootComment:         "Operational",
+	}
+	if len(mb8600.FilterLockedUpstream(snapshot.Upstream)) < len(snapshot.Upstream) {
+		snapshot.Connection.ConnectivityComment = "Partial Service (US only)"
+	}
+	partial := snapshot.Connection.PartialService()
+	snapshot.PartialService = &partial
+
+	g.step++
+	return snapshot
+}
+
+func (g *Generator) updateDownstream(ch *mb8600.DownstreamChannel, idx int, severity float64, rebooted bool) {
+	base := g.baselines[mb8600.ChannelKey{Direction: mb8600.DirectionDownstream, ChannelID: ch.ChannelID}]
+	power := base.power + g.rand.NormFloat64()*0.2
+	snr := base.snr + g.rand.NormFloat64()*0.3
+	// The chance of a corrected error burst in an interval.
+	burst := 0.05
+
+	switch g.cfg.Scenario {
+	case NoiseIngress:
+		// Ingress is worst at the low end of the spectrum.
+		position := float64(idx) / float64(len(g.downstream))
+		snr -= 12 * severity * (1 - position/2)
+		burst += severity
+	case PowerDrift:
+		power += 10 * severity
+	}
+
+	if rebooted {
+		ch.CorrectedErrors, ch.UncorrectedErrors = 0, 0
+	}
+
+	ch.LockStatus = "Locked"
+	if g.cfg.Scenario == Flapping && idx == len(g.downstream)/2 && (g.step/flapSteps)%2 == 1 {
+		ch.LockStatus = "Not Locked"
+		power, snr, burst = 0, 0, 0
+	}
+
+	ch.Power = round1(power)
+	ch.SignalToNoise = round1(snr)
+	if g.rand.Float64() < burst {
+		ch.CorrectedErrors += float64(1 + g.rand.Intn(20+int(2000*severity)))
+	}
+	// Uncorrectable codewords appear once the SNR nears the QAM256 limit.
+	if ch.LockStatus == "Locked" && snr < 33 {
+		ch.UncorrectedErrors += float64(g.rand.Intn(1 + int(20*(33-snr))))
+	}
+}
+
+func (g *Generator) updateUpstream(ch *mb8600.UpstreamChannel, idx int, severity float64) {
+	base := g.baselines[mb8600.ChannelKey{Direction: mb8600.DirectionUpstream, ChannelID: ch.ChannelID}]
+	power := base.power + g.rand.NormFloat64()*0.2
+
+	switch g.cfg.Scenario {
+	case PowerDrift:
+		power += 8 * severity
+	case PartialService:
+		// From the tenth snapshot on, another channel fails every ten,
+		// keeping at least one.
+		failed := min(g.step/10, len(g.upstream)-1)
+		if idx >= len(g.upstream)-failed {
+			ch.LockStatus = "Not Locked"
+			ch.Power = 0
+			return
+		}
+	}
+	ch.LockStatus = "Locked"
+	ch.Power = round1(power)
+}
+
+// Rounds value to a tenth, the precision the modem reports levels in.
+func round1(value float64) float64 {
+	return math.Round(value*10) / 10
+}
+
+// Returns the HNAP response fields describing snapshot, keyed by action, as
+// the modem would return them.
+func Responses(snapshot *mb8600.Snapshot) map[string]map[string]string {
+	responses := map[string]map[string]string{
+		"GetMotoStatusDownstreamChannelInfo": {"MotoConnDownstreamChannel": FormatDownstream(snapshot.Downstream)},
+		"GetMotoStatusUpstreamChannelInfo":   {"MotoConnUpstreamChannel": FormatUpstream(snapshot.Upstream)},
+	}
+	if conn := snapshot.Connection; conn != nil {
+		responses["GetMotoStatusConnectionInfo"] = map[string]string{
+			"MotoConnSystemUpTime":  mb8600.FormatUptime(conn.Uptime),
+			"MotoConnNetworkAccess": conn.NetworkAccess,
+		}
+		startup := mb8600test.DefaultResponses()["GetMotoStatusStartupSequence"]
+		startup["MotoConnConnectivityStatus"] = conn.ConnectivityStatus
+		startup["MotoConnConnectivityComment"] = conn.ConnectivityComment
+		startup["MotoConnBootStatus"] = conn.BootStatus
+		startup["MotoConnBootComment"] = conn.BootComment
+		responses["GetMotoStatusStartupSequence"] = startup
+	}
+	return responses
+}
+
+// Returns the next snapshot of g and makes modem serve it.
+func (g *Generator) Apply(modem *mb8600test.Modem) *mb8600.Snapshot {
+	snapshot := g.Next()
+	for action, fields := range Responses(snapshot) {
+		modem.SetResponse(action, fields)
+	}
+	return snapshot
+}
+
+// Formats channels as the modem reports them in the
+// MotoConnDownstreamChannel field.
+func FormatDownstream(channels []*mb8600.DownstreamChannel) string {
+	rows := make([]string, 0, len(channels))
+	for _, ch := range channels {
+		corrected, uncorrected := ch.CorrectedErrors, ch.UncorrectedErrors
+		if ch.Kind() == mb8600.ChannelKindOFDM {
+			corrected, uncorrected = wrapCounter(corrected), wrapCounter(uncorrected)
+		}
+		rows = append(rows, strings.Join([]string{
+			strconv.Itoa(ch.Channel),
+			ch.LockStatus,
+			ch.Modulation,
+			strconv.Itoa(ch.ChannelID),
+			formatLevel(ch.Frequency),
+			formatLevel(ch.Power),
+			formatLevel(ch.SignalToNoise),
+			strconv.FormatFloat(corrected, 'f', 0, 64),
+			strconv.FormatFloat(uncorrected, 'f', 0, 64),
+		}, "^")+"^")
+	}
+	return strings.Join(rows, "|+|")
+}
+
+// Formats channels as the modem reports them in the MotoConnUpstreamChannel
+// field.
+func FormatUpstream(channels []*mb8600.UpstreamChannel) string {
+	rows := make([]string, 0, len(channels))
+	for _, ch := range channels {
+		rows = append(rows, strings.Join([]string{
+			strconv.Itoa(ch.Channel),
+			ch.LockStatus,
+			ch.ChannelType,
+			strconv.Itoa(ch.ChannelID),
+			strconv.FormatFloat(ch.SymbolRate, 'f', -1, 64),
+			formatLevel(ch.Frequency),
+			formatLevel(ch.Power),
+		}, "^")+"^")
+	}
+	return strings.Join(rows, "|+|")
+}
+
+func formatLevel(value float64) string {
+	return strconv.FormatFloat(value, 'f', 1, 64)
+}
+
+// Returns counter as the modem reports OFDM counters, a signed 32-bit
+// integer that goes negative past 2^31.
+func wrapCounter(counter float64) float64 {
+	counter = math.Mod(counter, 1<<32)
+	if counter >= 1<<31 {
+		counter -= 1 << 32
+	}
+	return counter
+}
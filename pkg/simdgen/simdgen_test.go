@@ -0,0 +1,186 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package simdgen
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/health"
+	"github.com/thelande/mb8600/pkg/mb8600"
+	"github.com/thelande/mb8600/pkg/mb8600test"
+)
+
+var start = time.Date(2023, 12, 16, 0, 0, 0, 0, time.UTC)
+
+// Returns the snapshots of the first n polls of scenario.
+func run(scenario Scenario, n int) []*mb8600.Snapshot {
+	g := New(Config{Scenario: scenario, Start: start, Seed: 1})
+	snapshots := make([]*mb8600.Snapshot, n)
+	for i := range snapshots {
+		snapshots[i] = g.Next()
+	}
+	return snapshots
+}
+
+func TestGenerator_Next(t *testing.T) {
+	snapshots := run(Healthy, 2)
+	first, second := snapshots[0], snapshots[1]
+
+	if !first.Time.Equal(start) || second.Time.Sub(first.Time) != 30*time.Second {
+		t.Errorf("snapshot times = %v, %v, want 30s apart from %v", first.Time, second.Time, start)
+	}
+	if len(first.Downstream) != 25 || len(first.Upstream) != 4 {
+		t.Errorf("channels = %d/%d, want 25/4", len(first.Downstream), len(first.Upstream))
+	}
+	if second.Connection.Uptime-first.Connection.Uptime != 30*time.Second {
+		t.Errorf("uptime advanced by %v, want 30s", second.Connection.Uptime-first.Connection.Uptime)
+	}
+	// Each snapshot owns its channels.
+	if first.Downstream[0] == second.Downstream[0] {
+		t.Errorf("snapshots share channels")
+	}
+	if report := health.Evaluate(second, first, health.DefaultThresholds()); report.Status != health.StatusOK {
+		t.Errorf("health = %v, want ok: %+v", report.Status, report.Channels)
+	}
+}
+
+func TestGenerator_deterministic(t *testing.T) {
+	if a, b := run(NoiseIngress, 5), run(NoiseIngress, 5); !reflect.DeepEqual(a, b) {
+		t.Errorf("runs with the same seed differ")
+	}
+}
+
+func TestScenarios(t *testing.T) {
+	tests := []struct {
+		scenario Scenario
+		check    func(t *testing.T, snapshots []*mb8600.Snapshot)
+	}{
+		{Healthy, func(t *testing.T, snapshots []*mb8600.Snapshot) {
+			last := snapshots[len(snapshots)-1]
+			if got := health.Evaluate(last, snapshots[len(snapshots)-2], health.DefaultThresholds()).Status; got != health.StatusOK {
+				t.Errorf("health = %v, want ok", got)
+			}
+		}},
+		{NoiseIngress, func(t *testing.T, snapshots []*mb8600.Snapshot) {
+			first, last := snapshots[0], snapshots[len(snapshots)-1]
+			if last.Downstream[0].SignalToNoise > first.Downstream[0].SignalToNoise-8 {
+				t.Errorf("snr went from %v to %v, want a drop of over 8 dB", first.Downstream[0].SignalToNoise, last.Downstream[0].SignalToNoise)
+			}
+			if mb8600.TotalUncorrected(last.Downstream) == 0 {
+				t.Errorf("no uncorrected errors, want some")
+			}
+		}},
+		{PowerDrift, func(t *testing.T, snapshots []*mb8600.Snapshot) {
+			if got := health.Evaluate(snapshots[len(snapshots)-1], nil, health.DefaultThresholds()).Status; got == health.StatusOK {
+				t.Errorf("health = ok, want power out of range")
+			}
+		}},
+		{Flapping, func(t *testing.T, snapshots []*mb8600.Snapshot) {
+			var changes int
+			for i := 1; i < len(snapshots); i++ {
+				changes += len(mb8600.Compare(snapshots[i-1], snapshots[i]).LockChanges)
+			}
+			if changes < 10 {
+				t.Errorf("%d lock changes, want the channel to flap", changes)
+			}
+		}},
+		{PartialService, func(t *testing.T, snapshots []*mb8600.Snapshot) {
+			last := snapshots[len(snapshots)-1]
+			if last.LockedUpstreamChannels() != 1 || !last.PartialService.Upstream {
+				t.Errorf("%d upstream locked, partial service %+v, want 1 in partial service", last.LockedUpstreamChannels(), last.PartialService)
+			}
+			if snapshots[0].PartialService.Any() {
+				t.Errorf("partial service from the start, want it to develop")
+			}
+		}},
+		{Reboots, func(t *testing.T, snapshots []*mb8600.Snapshot) {
+			var reboots int
+			for i := 1; i < len(snapshots); i++ {
+				if mb8600.Compare(snapshots[i-1], snapshots[i]).Reboot != nil {
+					reboots++
+				}
+			}
+			if reboots != 2 {
+				t.Errorf("%d reboots, want 2", reboots)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.scenario), func(t *testing.T) {
+			tt.check(t, run(tt.scenario, 100))
+		})
+	}
+}
+
+func TestParseScenario(t *testing.T) {
+	for _, s := range Scenarios() {
+		if got, err := ParseScenario(string(s)); err != nil || got != s {
+			t.Errorf("ParseScenario(%q) = %v, %v", s, got, err)
+		}
+	}
+	if _, err := ParseScenario("meteor-strike"); err == nil {
+		t.Errorf("ParseScenario() error = nil, want error")
+	}
+}
+
+func TestFormat_roundTrip(t *testing.T) {
+	snapshot := run(NoiseIngress, 80)[79]
+	// Past 2^31, OFDM counters are reported negative.
+	snapshot.Downstream[len(snapshot.Downstream)-1].CorrectedErrors = 1<<31 + 5
+
+	downstream, err := mb8600.NewDownstreamChannelsFromResponse(FormatDownstream(snapshot.Downstream))
+	if err != nil {
+		t.Fatalf("NewDownstreamChannelsFromResponse() error = %v", err)
+	}
+	if !reflect.DeepEqual(downstream, snapshot.Downstream) {
+		t.Errorf("downstream round trip = %+v, want %+v", downstream[0], snapshot.Downstream[0])
+	}
+	upstream, err := mb8600.NewUpstreamChannelsFromResponse(FormatUpstream(snapshot.Upstream))
+	if err != nil {
+		t.Fatalf("NewUpstreamChannelsFromResponse() error = %v", err)
+	}
+	if !reflect.DeepEqual(upstream, snapshot.Upstream) {
+		t.Errorf("upstream round trip = %+v, want %+v", upstream, snapshot.Upstream)
+	}
+}
+
+func TestGenerator_Apply(t *testing.T) {
+	modem := mb8600test.NewModem("admin", "motorola")
+	server := mb8600test.NewServer(modem)
+	defer server.Close()
+
+	g := New(Config{Scenario: PartialService, Start: start})
+	var want *mb8600.Snapshot
+	for i := 0; i < 25; i++ {
+		want = g.Apply(modem)
+	}
+
+	client := mb8600.NewMotoClient(mb8600test.Address(server), "admin", "motorola", nil)
+	status, err := client.GetStatus()
+	if err != nil {
+		t.Fatalf("MotoClient.GetStatus() error = %v", err)
+	}
+	got := status.Snapshot()
+	if !reflect.DeepEqual(got.Upstream, want.Upstream) || !reflect.DeepEqual(got.PartialService, want.PartialService) {
+		t.Errorf("served snapshot = %+v, want %+v", got, want)
+	}
+	if got.Connection.Uptime != want.Connection.Uptime {
+		t.Errorf("served uptime = %v, want %v", got.Connection.Uptime, want.Connection.Uptime)
+	}
+}
@@ -0,0 +1,249 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// Package supervisor runs long-lived tasks, such as the polling loop of each
+// modem, restarting them with exponential backoff when they fail or panic, so
+// that one broken task never stalls the others.
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+// The state of a supervised task.
+type State string
+
+const (
+	StateRunning State = "running"
+	// The task failed and is waiting to be restarted.
+	StateBackoff State = "backoff"
+	// The task returned without an error, or was cancelled.
+	StateStopped State = "stopped"
+	// The task failed more times in a row than the policy allows, and is not
+	// restarted again.
+	StateFailed State = "failed"
+)
+
+// How failed tasks are restarted.
+type Policy struct {
+	// The delay before the first restart, doubled on every consecutive
+	// failure up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// A task that ran at least this long before failing is restarted after
+	// InitialBackoff again. Zero never resets the backoff.
+	ResetAfter time.Duration
+	// The number of consecutive failures after which a task is given up on,
+	// or zero to restart it indefinitely.
+	MaxRestarts int
+}
+
+// Returns a policy restarting tasks indefinitely after 1s, backing off to at
+// most one minute.
+func DefaultPolicy() Policy {
+	return Policy{
+		InitialBackoff: time.Second,
+		MaxBackoff:     time.Minute,
+		ResetAfter:     time.Minute,
+	}
+}
+
+// A long-lived task. It should return when ctx is cancelled.
+type Task func(ctx context.Context) error
+
+// The supervision status of a task.
+type Status struct {
+	Name  string `json:"name"`
+	State State  `json:"state"`
+	// The number of times the task was restarted.
+	Restarts  int       `json:"restarts"`
+	LastError string    `json:"last_error,omitempty"`
+	LastStart time.Time `json:"last_start"`
+	LastExit  time.Time `json:"last_exit,omitempty"`
+}
+
+// Returns true unless the task is failing.
+func (s *Status) Healthy() bool {
+	return s.State == StateRunning || s.State == StateStopped
+}
+
+// Supervises a group of tasks independently of each other. It is safe for
+// concurrent use.
+type Group struct {
+	policy Policy
+	logger mb8600.Logger
+	now    func() time.Time
+	after  func(time.Duration) <-chan time.Time
+
+	mu    sync.Mutex
+	tasks []*Status
+	wg    sync.WaitGroup
+}
+
+// Returns an empty group restarting tasks according to policy.
+func NewGroup(policy Policy, logger mb8600.Logger) *Group {
+	return &Group{
+		policy: policy,
+		logger: logger,
+		now:    time.Now,
+		after:  time.After,
+	}
+}
+
+// Starts fn in a new goroutine under supervision until ctx is cancelled.
+func (g *Group) Go(ctx context.Context, name string, fn Task) {
+	status := &Status{Name: name, State: StateRunning, LastStart: g.now()}
+	g.mu.Lock()
+	g.tasks = append(g.tasks, status)
+	g.mu.Unlock()
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		g.supervise(ctx, status, fn)
+	}()
+}
+
+// Waits for every task to stop or be given up on.
+func (g *Group) Wait() {
+	g.wg.Wait()
+}
+
+// Returns the status of every task, in the order they were started.
+func (g *Group) Statuses() []Status {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	statuses := make([]Status, len(g.tasks))
+	for idx, status := range g.tasks {
+		statuses[idx] = *status
+	}
+	return statuses
+}
+
+// Returns true if every task is healthy.
+func (g *Group) Healthy() bool {
+	for _, status := range g.Statuses() {
+		if !status.Healthy() {
+			return false
+		}
+	}
+	return true
+}
+
+func (g *Group) update(status *Status, fn func(s *Status)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	fn(status)
+}
+
+func (g *Group) log(lvl mb8600.Level, keyvals ...any) {
+	if g.logger != nil {
+		g.logger.Log(append([]any{mb8600.LevelKey, lvl}, keyvals...)...)
+	}
+}
+
+func (g *Group) supervise(ctx context.Context, status *Status, fn Task) {
+	backoff := g.policy.InitialBackoff
+	failures := 0
+
+	for {
+		start := g.now()
+		g.update(status, func(s *Status) {
+			s.State = StateRunning
+			s.LastStart = start
+		})
+
+		err := run(ctx, fn)
+		exit := g.now()
+		if err == nil || ctx.Err() != nil {
+			g.update(status, func(s *Status) {
+				s.State = StateStopped
+				s.LastExit = exit
+			})
+			return
+		}
+
+		if g.policy.ResetAfter > 0 && exit.Sub(start) >= g.policy.ResetAfter {
+			backoff = g.policy.InitialBackoff
+			failures = 0
+		}
+		failures++
+
+		if g.policy.MaxRestarts > 0 && failures > g.policy.MaxRestarts {
+			g.log(mb8600.LevelError, "msg", "task failed too often, giving up", "task", status.Name, "err", err)
+			g.update(status, func(s *Status) {
+				s.State = StateFailed
+				s.LastError = err.Error()
+				s.LastExit = exit
+			})
+			return
+		}
+
+		keyvals := []any{"msg", "task failed, restarting", "task", status.Name, "backoff", backoff, "err", err}
+		var panicErr *panicError
+		if errors.As(err, &panicErr) {
+			keyvals = append(keyvals, "stack", string(panicErr.stack))
+		}
+		g.log(mb8600.LevelWarn, keyvals...)
+		g.update(status, func(s *Status) {
+			s.State = StateBackoff
+			s.LastError = err.Error()
+			s.LastExit = exit
+		})
+
+		select {
+		case <-ctx.Done():
+			g.update(status, func(s *Status) { s.State = StateStopped })
+			return
+		case <-g.after(backoff):
+		}
+
+		g.update(status, func(s *Status) { s.Restarts++ })
+		backoff = min(backoff*2, g.policy.MaxBackoff)
+	}
+}
+
+// A panic recovered from a task.
+type panicError struct {
+	value any
+	stack []byte
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.value)
+}
+
+// Runs fn, returning a panic as an error.
+func run(ctx context.Context, fn Task) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &panicError{r, debug.Stack()}
+		}
+	}()
+
+	err = fn(ctx)
+	if errors.Is(err, context.Canceled) && ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
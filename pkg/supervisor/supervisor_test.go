@@ -0,0 +1,113 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+// Returns a group that restarts tasks without waiting, recording the backoff
+// delays it would have waited.
+func newTestGroup(policy Policy) (*Group, func() []time.Duration) {
+	var (
+		mu     sync.Mutex
+		delays []time.Duration
+	)
+	g := NewGroup(policy, nil)
+	g.after = func(d time.Duration) <-chan time.Time {
+		mu.Lock()
+		delays = append(delays, d)
+		mu.Unlock()
+		ch := make(chan time.Time, 1)
+		ch <- time.Time{}
+		return ch
+	}
+	return g, func() []time.Duration {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(delays)
+	}
+}
+
+func TestGroup_restart(t *testing.T) {
+	ignore := goleak.IgnoreCurrent()
+	t.Cleanup(func() { goleak.VerifyNone(t, ignore) })
+	g, delays := newTestGroup(Policy{InitialBackoff: time.Second, MaxBackoff: 3 * time.Second, ResetAfter: time.Hour, MaxRestarts: 4})
+
+	attempts := 0
+	g.Go(context.Background(), "flaky", func(ctx context.Context) error {
+		attempts++
+		switch attempts {
+		case 1:
+			return errors.New("unreachable")
+		case 2:
+			panic("nil map")
+		case 3, 4:
+			return errors.New("unreachable")
+		}
+		return nil
+	})
+	g.Wait()
+
+	if want := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second}; !slices.Equal(delays(), want) {
+		t.Errorf("backoff delays = %v, want %v", delays(), want)
+	}
+	status := g.Statuses()[0]
+	if status.State != StateStopped || status.Restarts != 4 || status.LastError != "unreachable" || !status.Healthy() {
+		t.Errorf("Group.Statuses() = %+v, want stopped after 4 restarts", status)
+	}
+}
+
+func TestGroup_giveUp(t *testing.T) {
+	ignore := goleak.IgnoreCurrent()
+	t.Cleanup(func() { goleak.VerifyNone(t, ignore) })
+	g, _ := newTestGroup(Policy{InitialBackoff: time.Second, MaxBackoff: time.Minute, ResetAfter: time.Hour, MaxRestarts: 2})
+
+	g.Go(context.Background(), "broken", func(ctx context.Context) error { panic("always") })
+	// A healthy task keeps running regardless.
+	ctx, cancel := context.WithCancel(context.Background())
+	g.Go(ctx, "healthy", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for g.Statuses()[0].State != StateFailed {
+		if time.Now().After(deadline) {
+			t.Fatalf("Group.Statuses() = %+v, want the broken task to fail", g.Statuses())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if g.Healthy() {
+		t.Errorf("Group.Healthy() = true, want false")
+	}
+	if got := g.Statuses(); got[0].Restarts != 2 || got[0].LastError != "panic: always" || got[1].State != StateRunning {
+		t.Errorf("Group.Statuses() = %+v", got)
+	}
+
+	cancel()
+	g.Wait()
+	if got := g.Statuses()[1]; got.State != StateStopped || got.LastError != "" {
+		t.Errorf("cancelled task status = %+v, want stopped without error", got)
+	}
+}
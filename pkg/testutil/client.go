@@ -0,0 +1,523 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package testutil provides fakes of the mb8600 client for unit tests of
+// code using it, without a modem or an HTTP server. To test against the HNAP
+// protocol itself, use the fake endpoint of package mb8600test.
+package testutil
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/mb8600"
+	"github.com/thelande/mb8600/pkg/mb8600test"
+)
+
+// A fake mb8600.ModemClient serving the responses of a healthy modem without
+// HTTP, for unit tests of code accepting the interface. Its methods parse
+// canned action responses like MotoClient does, so responses set with
+// SetResponse change every method derived from them, and fail with the
+// errors set with SetError. It is safe for concurrent use.
+type Client struct {
+	// The address and username reported in sessions.
+	Address  string
+	Username string
+
+	mu         sync.Mutex
+	responses  map[string]map[string]string
+	errors     map[string]error
+	pages      map[string][]byte
+	calls      []string
+	session    *mb8600.Session
+	privateKey string
+	uid        string
+}
+
+var _ mb8600.ModemClient = (*Client)(nil)
+
+// Returns a client answering with mb8600test.DefaultResponses.
+func NewClient() *Client {
+	return &Client{
+		Address:   "192.168.100.1",
+		Username:  "admin",
+		responses: mb8600test.DefaultResponses(),
+		errors:    map[string]error{},
+		pages:     map[string][]byte{},
+	}
+}
+
+// Sets the fields of the response to action, as returned by DoAction and
+// parsed by the methods querying it.
+func (c *Client) SetResponse(action string, fields map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.responses[action] = fields
+}
+
+// Makes the method, e.g. "GetDownstreamChannels", or DoAction of the action,
+// e.g. "GetMotoStatusLog", fail with err, or succeed again if err is nil.
+// Methods derived from a failing action fail too.
+func (c *Client) SetError(name string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err == nil {
+		delete(c.errors, name)
+	} else {
+		c.errors[name] = err
+	}
+}
+
+// Sets the page returned by FetchPage for path.
+func (c *Client) SetPage(path string, page []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pages[path] = page
+}
+
+// Returns the names of the methods called, in order.
+func (c *Client) Calls() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.calls...)
+}
+
+// Records a call of method and returns the error set for it.
+func (c *Client) call(method string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, method)
+	return c.errors[method]
+}
+
+// Returns the response to action, or the error set for it.
+func (c *Client) response(action string) (map[string]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.errors[action]; err != nil {
+		return nil, err
+	}
+	resp, ok := c.responses[action]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", action, mb8600.ErrUnsupported)
+	}
+	fields := make(map[string]string, len(resp))
+	for k, v := range resp {
+		fields[k] = v
+	}
+	return fields, nil
+}
+
+func (c *Client) Login() (map[string]string, error) {
+	if err := c.call("Login"); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.privateKey, c.uid = "0123456789ABCDEF", "fake-uid"
+	c.session = &mb8600.Session{
+		Address:    c.Address,
+		Username:   c.Username,
+		Scheme:     "https",
+		PrivateKey: c.privateKey,
+		UID:        c.uid,
+		Saved:      time.Now(),
+	}
+	return map[string]string{"LoginResult": "OK"}, nil
+}
+
+func (c *Client) Session() (*mb8600.Session, error) {
+	if err := c.call("Session"); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.session == nil {
+		return nil, mb8600.ErrNoSession
+	}
+	session := *c.session
+	return &session, nil
+}
+
+func (c *Client) RestoreSession(session *mb8600.Session) error {
+	if err := c.call("RestoreSession"); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	restored := *session
+	c.session = &restored
+	c.privateKey, c.uid = session.PrivateKey, session.UID
+	return nil
+}
+
+func (c *Client) SaveSession(store mb8600.SessionStore) error {
+	if err := c.call("SaveSession"); err != nil {
+		return err
+	}
+	session, err := c.Session()
+	if err != nil {
+		return err
+	}
+	return store.Save(session)
+}
+
+func (c *Client) LoadSession(store mb8600.SessionStore) error {
+	if err := c.call("LoadSession"); err != nil {
+		return err
+	}
+	session, err := store.Load()
+	if err != nil {
+		return err
+	}
+	return c.RestoreSession(session)
+}
+
+func (c *Client) SessionTTL() time.Duration {
+	c.call("SessionTTL")
+	return mb8600.DefaultSessionTTL
+}
+
+func (c *Client) ResetLoginLockout() {
+	c.call("ResetLoginLockout")
+}
+
+func (c *Client) GetPrivateKey() (string, error) {
+	if err := c.call("GetPrivateKey"); err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.privateKey, nil
+}
+
+func (c *Client) GetUID() (string, error) {
+	if err := c.call("GetUID"); err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.uid, nil
+}
+
+func (c *Client) SetPrivateKey(key string) error {
+	if err := c.call("SetPrivateKey"); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.privateKey = key
+	return nil
+}
+
+func (c *Client) SetUID(uid string) error {
+	if err := c.call("SetUID"); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.uid = uid
+	return nil
+}
+
+func (c *Client) DoAction(action string, params map[string]string) (map[string]string, error) {
+	if err := c.call("DoAction"); err != nil {
+		return nil, err
+	}
+	return c.response(action)
+}
+
+func (c *Client) DoActionContext(ctx context.Context, action string, params map[string]string) (map[string]string, error) {
+	if err := c.call("DoActionContext"); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.response(action)
+}
+
+func (c *Client) GetDownstreamChannels() ([]*mb8600.DownstreamChannel, error) {
+	if err := c.call("GetDownstreamChannels"); err != nil {
+		return nil, err
+	}
+	resp, err := c.response("GetMotoStatusDownstreamChannelInfo")
+	if err != nil {
+		return nil, err
+	}
+	return mb8600.NewDownstreamChannelsFromResponse(resp["MotoConnDownstreamChannel"])
+}
+
+func (c *Client) GetUpstreamChannels() ([]*mb8600.UpstreamChannel, error) {
+	if err := c.call("GetUpstreamChannels"); err != nil {
+		return nil, err
+	}
+	resp, err := c.response("GetMotoStatusUpstreamChannelInfo")
+	if err != nil {
+		return nil, err
+	}
+	return mb8600.NewUpstreamChannelsFromResponse(resp["MotoConnUpstreamChannel"])
+}
+
+func (c *Client) GetLogs() ([]*mb8600.LogEntry, error) {
+	if err := c.call("GetLogs"); err != nil {
+		return nil, err
+	}
+	resp, err := c.response("GetMotoStatusLog")
+	if err != nil {
+		return nil, err
+	}
+	return mb8600.NewLogEntriesFromResponse(resp["MotoStatusLogList"])
+}
+
+func (c *Client) GetSoftwareStatus() (*mb8600.SoftwareStatus, error) {
+	if err := c.call("GetSoftwareStatus"); err != nil {
+		return nil, err
+	}
+	resp, err := c.response("GetMotoStatusSoftware")
+	if err != nil {
+		return nil, err
+	}
+	return mb8600.NewSoftwareStatusFromResponse(resp), nil
+}
+
+func (c *Client) GetConnectionInfo() (*mb8600.ConnectionInfo, error) {
+	if err := c.call("GetConnectionInfo"); err != nil {
+		return nil, err
+	}
+	conn, err := c.response("GetMotoStatusConnectionInfo")
+	if err != nil {
+		return nil, err
+	}
+	startup, err := c.response("GetMotoStatusStartupSequence")
+	if err != nil {
+		return nil, err
+	}
+	return mb8600.NewConnectionInfoFromResponse(conn, startup)
+}
+
+func (c *Client) GetStartupSequence() (*mb8600.StartupSequence, error) {
+	if err := c.call("GetStartupSequence"); err != nil {
+		return nil, err
+	}
+	resp, err := c.response("GetMotoStatusStartupSequence")
+	if err != nil {
+		return nil, err
+	}
+	return mb8600.NewStartupSequenceFromResponse(resp), nil
+}
+
+func (c *Client) GetLagStatus() (*mb8600.LagStatus, error) {
+	if err := c.call("GetLagStatus"); err != nil {
+		return nil, err
+	}
+	resp, err := c.response("GetMotoLagStatus")
+	if err != nil {
+		return nil, err
+	}
+	return mb8600.NewLagStatusFromResponse(resp)
+}
+
+func (c *Client) GetAccountInfo() (*mb8600.AccountInfo, error) {
+	if err := c.call("GetAccountInfo"); err != nil {
+		return nil, err
+	}
+	resp, err := c.response("GetMotoStatusSecAccount")
+	if err != nil {
+		return nil, err
+	}
+	return mb8600.NewAccountInfoFromResponse(resp), nil
+}
+
+func (c *Client) GetPartialService() (mb8600.PartialService, error) {
+	if err := c.call("GetPartialService"); err != nil {
+		return mb8600.PartialService{}, err
+	}
+	info, err := c.GetConnectionInfo()
+	if err != nil {
+		return mb8600.PartialService{}, err
+	}
+	if p := info.PartialService(); p.Any() {
+		return p, nil
+	}
+	entries, err := c.GetLogs()
+	if err != nil {
+		return mb8600.PartialService{}, err
+	}
+	return mb8600.PartialServiceFromLogs(entries), nil
+}
+
+func (c *Client) GetStatus() (*mb8600.ModemStatus, error) {
+	return c.GetStatusContext(context.Background())
+}
+
+func (c *Client) GetStatusContext(ctx context.Context) (*mb8600.ModemStatus, error) {
+	if err := c.call("GetStatusContext"); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	status := &mb8600.ModemStatus{Time: time.Now()}
+	var err error
+	if status.Software, err = c.GetSoftwareStatus(); err != nil {
+		return nil, err
+	}
+	if status.Connection, err = c.GetConnectionInfo(); err != nil {
+		return nil, err
+	}
+	if status.Startup, err = c.GetStartupSequence(); err != nil {
+		return nil, err
+	}
+	if status.Downstream, err = c.GetDownstreamChannels(); err != nil {
+		return nil, err
+	}
+	if status.Upstream, err = c.GetUpstreamChannels(); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+func (c *Client) ScrapeChannels() ([]*mb8600.DownstreamChannel, []*mb8600.UpstreamChannel, error) {
+	if err := c.call("ScrapeChannels"); err != nil {
+		return nil, nil, err
+	}
+	downstream, err := c.GetDownstreamChannels()
+	if err != nil {
+		return nil, nil, err
+	}
+	upstream, err := c.GetUpstreamChannels()
+	if err != nil {
+		return nil, nil, err
+	}
+	return downstream, upstream, nil
+}
+
+func (c *Client) FetchPage(path string) ([]byte, error) {
+	if err := c.call("FetchPage"); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	page, ok := c.pages[path]
+	if !ok {
+		return nil, fmt.Errorf("unexpected response status: 404 Not Found")
+	}
+	return page, nil
+}
+
+func (c *Client) ParseStats() mb8600.ParseStats {
+	c.call("ParseStats")
+	return mb8600.ParseStats{}
+}
+
+func (c *Client) ClearCache() {
+	c.call("ClearCache")
+}
+
+func (c *Client) Profile() *mb8600.ModelProfile {
+	c.call("Profile")
+	return mb8600.ProfileFor(mb8600.ModelMB8600)
+}
+
+func (c *Client) DetectModel() (mb8600.ModemModel, error) {
+	if err := c.call("DetectModel"); err != nil {
+		return "", err
+	}
+	resp, err := c.response("GetMotoStatusSoftware")
+	if err != nil {
+		return "", err
+	}
+	return mb8600.ModelFromSoftwareVersion(resp["StatusSoftwareSfVer"])
+}
+
+// Reports the actions of the profile with a response as supported, and the
+// others as unsupported.
+func (c *Client) Capabilities() (*mb8600.Capabilities, error) {
+	if err := c.call("Capabilities"); err != nil {
+		return nil, err
+	}
+	caps := &mb8600.Capabilities{Time: time.Now(), Actions: map[string]mb8600.Support{}}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, action := range mb8600.ProfileFor(mb8600.ModelMB8600).Actions {
+		if _, ok := c.responses[action]; ok {
+			caps.Actions[action] = mb8600.Supported
+		} else {
+			caps.Actions[action] = mb8600.Unsupported
+		}
+	}
+	return caps, nil
+}
+
+// Returns an empty report, as the canned responses conform by construction.
+func (c *Client) CheckConformance() *mb8600.ConformanceReport {
+	c.call("CheckConformance")
+	return &mb8600.ConformanceReport{}
+}
+
+func (c *Client) Ping(ctx context.Context) error {
+	if err := c.call("Ping"); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+func (c *Client) WaitForOnline(ctx context.Context) error {
+	if err := c.call("WaitForOnline"); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+func (c *Client) Err() error {
+	return c.call("Err")
+}
+
+func (c *Client) GetScheme() string {
+	c.call("GetScheme")
+	return "https"
+}
+
+func (c *Client) GetEncoding() mb8600.Encoding {
+	c.call("GetEncoding")
+	return mb8600.EncodingJSON
+}
+
+func (c *Client) GetHNAPURI() string {
+	c.call("GetHNAPURI")
+	return "https://" + c.Address + "/HNAP1/"
+}
+
+func (c *Client) GetHNAPURL() (*url.URL, error) {
+	if err := c.call("GetHNAPURL"); err != nil {
+		return nil, err
+	}
+	return url.Parse("https://" + c.Address + "/HNAP1/")
+}
+
+func (c *Client) GetStatusPageURI() string {
+	c.call("GetStatusPageURI")
+	return "https://" + c.Address + "/MotoConnection.asp"
+}
+
+func (c *Client) CloseIdleConnections() {
+	c.call("CloseIdleConnections")
+}
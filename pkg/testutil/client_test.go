@@ -0,0 +1,152 @@
+/*
+Copyright 2023 Thomas Helander
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package testutil
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/thelande/mb8600/pkg/mb8600"
+)
+
+func TestClient_defaults(t *testing.T) {
+	c := NewClient()
+
+	downstream, err := c.GetDownstreamChannels()
+	if err != nil || len(downstream) != 5 {
+		t.Fatalf("GetDownstreamChannels() = %d channels, %v", len(downstream), err)
+	}
+	upstream, err := c.GetUpstreamChannels()
+	if err != nil || len(upstream) != 4 {
+		t.Fatalf("GetUpstreamChannels() = %d channels, %v", len(upstream), err)
+	}
+	software, err := c.GetSoftwareStatus()
+	if err != nil || software.SerialNumber != "2018123456789" {
+		t.Errorf("GetSoftwareStatus() = %+v, %v", software, err)
+	}
+	model, err := c.DetectModel()
+	if err != nil || model != mb8600.ModelMB8600 {
+		t.Errorf("DetectModel() = %s, %v", model, err)
+	}
+	status, err := c.GetStatus()
+	if err != nil || status.Connection.Uptime != 7*24*time.Hour+40*time.Minute+6*time.Second {
+		t.Errorf("GetStatus() = %+v, %v", status, err)
+	}
+	caps, err := c.Capabilities()
+	if err != nil || !caps.Supports("GetMotoStatusSoftware") {
+		t.Errorf("Capabilities() = %+v, %v", caps, err)
+	}
+}
+
+func TestClient_SetError(t *testing.T) {
+	errTimeout := errors.New("timeout")
+	tests := []struct {
+		name string
+		set  string
+		call func(c *Client) error
+	}{
+		{"method", "GetLogs", func(c *Client) error { _, err := c.GetLogs(); return err }},
+		{"action", "GetMotoStatusStartupSequence", func(c *Client) error { _, err := c.GetConnectionInfo(); return err }},
+		{"derived", "GetConnectionInfo", func(c *Client) error { _, err := c.GetStatus(); return err }},
+		{"login", "Login", func(c *Client) error { _, err := c.Login(); return err }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient()
+			c.SetError(tt.set, errTimeout)
+			if err := tt.call(c); !errors.Is(err, errTimeout) {
+				t.Errorf("error = %v, want %v", err, errTimeout)
+			}
+			c.SetError(tt.set, nil)
+			if err := tt.call(c); err != nil {
+				t.Errorf("error after clearing = %v", err)
+			}
+		})
+	}
+}
+
+func TestClient_SetResponse(t *testing.T) {
+	c := NewClient()
+	c.SetResponse("GetMotoStatusDownstreamChannelInfo", map[string]string{
+		"MotoConnDownstreamChannel": "1^Not Locked^QAM256^20^531.0^ 2.8^45.1^0^0^",
+	})
+	downstream, err := c.GetDownstreamChannels()
+	if err != nil || len(downstream) != 1 || downstream[0].LockStatus != "Not Locked" {
+		t.Errorf("GetDownstreamChannels() = %+v, %v", downstream, err)
+	}
+
+	if _, err := c.DoAction("GetMotoStatusSomething", nil); !errors.Is(err, mb8600.ErrUnsupported) {
+		t.Errorf("DoAction() of an unknown action error = %v", err)
+	}
+	if got, want := c.Calls(), []string{"GetDownstreamChannels", "DoAction"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Calls() = %v, want %v", got, want)
+	}
+}
+
+func TestClient_session(t *testing.T) {
+	c := NewClient()
+	if _, err := c.Session(); !errors.Is(err, mb8600.ErrNoSession) {
+		t.Fatalf("Session() before login error = %v", err)
+	}
+	if _, err := c.Login(); err != nil {
+		t.Fatal(err)
+	}
+	session, err := c.Session()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other := NewClient()
+	if err := other.RestoreSession(session); err != nil {
+		t.Fatal(err)
+	}
+	if key, _ := other.GetPrivateKey(); key != session.PrivateKey {
+		t.Errorf("GetPrivateKey() = %q, want %q", key, session.PrivateKey)
+	}
+}
+
+func TestClient_poller(t *testing.T) {
+	c := NewClient()
+	poller := mb8600.NewPoller(c, time.Minute, nil)
+	if _, err := poller.Poll(); err != nil {
+		t.Fatal(err)
+	}
+
+	c.SetResponse("GetMotoStatusUpstreamChannelInfo", map[string]string{
+		"MotoConnUpstreamChannel": "1^Not Locked^SC-QAM^4^5120^35.6^46.0^",
+	})
+	events, err := poller.Poll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lost int
+	for _, event := range events {
+		if event.Type == mb8600.ChannelLostLock {
+			lost++
+		}
+	}
+	if lost != 4 {
+		t.Errorf("Poll() = %d lost lock events, want 4: %+v", lost, events)
+	}
+
+	if err := c.Ping(context.Background()); err != nil {
+		t.Errorf("Ping() error = %v", err)
+	}
+}